@@ -0,0 +1,13 @@
+//go:build js && wasm
+
+// Command moego-wasm exposes graph routing simulation to the browser. Build
+// it with GOOS=js GOARCH=wasm and load it with Go's wasm_exec.js; it
+// installs moegoSimulate on the global object.
+package main
+
+import "github.com/forrestdevs/moego/pkg/core/wasmexport"
+
+func main() {
+	wasmexport.Register()
+	select {}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/eval"
+	"github.com/forrestdevs/moego/pkg/eval/compare"
+	"github.com/forrestdevs/moego/pkg/tools"
+	dotenv "github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+// ChatState is the state used by chat graphs
+type ChatState struct {
+	Messages []core.Message `json:"messages"`
+}
+
+// chatSession is a conversation that can be driven from the terminal
+type chatSession interface {
+	ThreadID() string
+	TurnStream(ctx context.Context, userInput string, onStream func(core.StreamEvent)) (string, error)
+	Close()
+}
+
+// graphs is the registry of graphs available to the chat command
+var graphs = map[string]func(apiKey string, logger *zap.Logger) (chatSession, error){
+	"assistant": newAssistantSession,
+}
+
+// docGraphs is the registry of graphs the docs command can document. The
+// graphs are only built, so no API key is needed.
+var docGraphs = map[string]func(format core.DocFormat) (string, error){
+	"assistant": func(format core.DocFormat) (string, error) {
+		graph, err := newAssistantGraph("", zap.NewNop())
+		if err != nil {
+			return "", err
+		}
+		return core.GenerateDocs(graph, format)
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "chat":
+		if err := runChat(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+	case "docs":
+		if err := runDocs(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+	case "compare":
+		regressed, err := runCompare(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if regressed {
+			os.Exit(1)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(graphs))
+	for name := range graphs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "usage: moego chat [-graph name]\n       moego docs [-format markdown|html] [-o file] graph\n       moego compare [-json] baseline.jsonl candidate.jsonl\n\navailable graphs: %s\n", strings.Join(names, ", "))
+}
+
+// runChat runs an interactive terminal chat against a registered graph
+func runChat(args []string) error {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	graphName := fs.String("graph", "assistant", "name of the graph to chat with")
+	fs.Parse(args)
+
+	if err := dotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found: %v", err)
+	}
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return fmt.Errorf("OPENAI_API_KEY environment variable is required")
+	}
+
+	newSession, ok := graphs[*graphName]
+	if !ok {
+		usage()
+		return fmt.Errorf("unknown graph: %s", *graphName)
+	}
+
+	session, err := newSession(apiKey, zap.NewNop())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	fmt.Printf("Chatting with %s (thread %s). Type \"exit\" to quit.\n", *graphName, session.ThreadID())
+
+	ctx := context.Background()
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			continue
+		}
+		if input == "exit" || input == "quit" {
+			return nil
+		}
+
+		streamed := false
+		reply, err := session.TurnStream(ctx, input, func(evt core.StreamEvent) {
+			if chunk, ok := evt.Data.(core.MessageChunk); ok && chunk.Type == core.ChunkContent {
+				fmt.Print(chunk.Content)
+				streamed = true
+			}
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			continue
+		}
+
+		if streamed {
+			fmt.Println()
+		} else {
+			fmt.Println(reply)
+		}
+	}
+}
+
+// runDocs writes the generated docs of a registered graph to a file
+func runDocs(args []string) error {
+	fs := flag.NewFlagSet("docs", flag.ExitOnError)
+	format := fs.String("format", string(core.DocMarkdown), "output format, markdown or html")
+	output := fs.String("o", "", "file to write, by default the graph name with a .md or .html extension")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+		return fmt.Errorf("docs needs a graph name")
+	}
+	graphName := fs.Arg(0)
+	generate, ok := docGraphs[graphName]
+	if !ok {
+		usage()
+		return fmt.Errorf("unknown graph: %s", graphName)
+	}
+
+	docs, err := generate(core.DocFormat(*format))
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		path = graphName + ".md"
+		if core.DocFormat(*format) == core.DocHTML {
+			path = graphName + ".html"
+		}
+	}
+	if err := os.WriteFile(path, []byte(docs), 0o644); err != nil {
+		return fmt.Errorf("failed to write docs: %w", err)
+	}
+	fmt.Printf("Wrote %s\n", path)
+	return nil
+}
+
+// runCompare compares a recorded candidate run against a baseline and prints
+// the report. It reports whether any regression was found.
+func runCompare(args []string) (bool, error) {
+	defaults := compare.DefaultOptions()
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON instead of markdown")
+	minSimilarity := fs.Float64("similarity", defaults.MinSimilarity, "minimum output similarity of matched nodes")
+	latency := fs.Float64("latency", defaults.LatencyThreshold, "allowed latency growth as a fraction")
+	tokens := fs.Float64("tokens", defaults.TokenThreshold, "allowed token growth as a fraction")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		usage()
+		return false, fmt.Errorf("compare needs a baseline and a candidate recording")
+	}
+
+	baseline, err := eval.LoadRun(fs.Arg(0))
+	if err != nil {
+		return false, err
+	}
+	candidate, err := eval.LoadRun(fs.Arg(1))
+	if err != nil {
+		return false, err
+	}
+
+	opts := defaults
+	opts.MinSimilarity = *minSimilarity
+	opts.LatencyThreshold = *latency
+	opts.TokenThreshold = *tokens
+	report := compare.Compare(baseline, candidate, opts)
+
+	if *asJSON {
+		data, err := report.JSON()
+		if err != nil {
+			return false, err
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Print(report.Markdown())
+	}
+	return report.Regressed(), nil
+}
+
+// newAssistantSession creates a single-node assistant graph with a calculator
+func newAssistantSession(apiKey string, logger *zap.Logger) (chatSession, error) {
+	graph, err := newAssistantGraph(apiKey, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.NewConversationDriver(graph, ChatState{},
+		func(state ChatState, input string) ChatState {
+			state.Messages = append(state.Messages, core.Message{Role: core.RoleUser, Content: input})
+			return state
+		},
+		func(state ChatState) string {
+			if len(state.Messages) == 0 {
+				return ""
+			}
+			return state.Messages[len(state.Messages)-1].Content
+		},
+	)
+}
+
+// newAssistantGraph builds the assistant graph
+func newAssistantGraph(apiKey string, logger *zap.Logger) (*core.StateGraph[ChatState], error) {
+	assistant := agent.NewOpenAIAgent("assistant", apiKey, core.NewZapLogger(logger))
+	assistant.AddTool(tools.NewCalculator())
+	if err := assistant.Configure(map[string]interface{}{
+		"model":         "gpt-4o-mini",
+		"stream_tokens": true,
+	}); err != nil {
+		return nil, err
+	}
+
+	graph := core.NewStateGraph[ChatState]()
+	graph.SetName("assistant")
+	graph.SetLogger(core.NewZapLogger(logger))
+	graph.SetStreamConfig(core.StreamConfig{
+		Modes:      []core.StreamMode{core.StreamMessages},
+		BufferSize: 100,
+	})
+
+	graph.AddNodeWithOptions("assistant", func(ctx context.Context, state ChatState) (ChatState, error) {
+		responses, err := assistant.ProcessMessage(ctx, state.Messages[len(state.Messages)-1])
+		if err != nil {
+			return state, err
+		}
+		state.Messages = append(state.Messages, responses...)
+		return state, nil
+	}, core.NodeOptions{
+		Description: "Answers the user, using the calculator for arithmetic",
+		Agent:       assistant,
+	})
+	graph.AddConditionalEdges("assistant", func(state ChatState) ([]string, error) {
+		return []string{core.END}, nil
+	}, map[string]string{core.END: core.END})
+	graph.SetEntryPoint("assistant")
+
+	return graph, nil
+}
@@ -9,7 +9,7 @@ import (
 	dotenv "github.com/joho/godotenv"
 
 	"github.com/forrestdevs/moego/pkg/agent"
-	// "github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/core"
 	// "github.com/forrestdevs/moego/pkg/router"
 	"github.com/forrestdevs/moego/pkg/tools"
 
@@ -47,13 +47,13 @@ func main() {
 	// r := router.NewSimpleRouter(logger)
 
 	// Create and configure agents
-	mathExpert := agent.NewOpenAIAgent("math_expert", apiKey, logger)
+	mathExpert := agent.NewOpenAIAgent("math_expert", apiKey, core.NewZapLogger(logger))
 	mathExpert.AddTool(tools.NewCalculator())
 	mathExpert.Configure(map[string]interface{}{
 		"model": "gpt-4o-mini",
 	})
 
-	assistant := agent.NewOpenAIAgent("assistant", apiKey, logger)
+	assistant := agent.NewOpenAIAgent("assistant", apiKey, core.NewZapLogger(logger))
 	assistant.Configure(map[string]interface{}{
 		"model": "gpt-3.5-turbo",
 	})
@@ -47,8 +47,11 @@ func main() {
 		logger.Fatal("OPENAI_API_KEY environment variable is required")
 	}
 
+	// Agents and the graph log through the zap adapter
+	graphLogger := core.NewZapLogger(logger)
+
 	// Create agents
-	mathExpert := agent.NewOpenAIAgent("math_expert", apiKey, logger)
+	mathExpert := agent.NewOpenAIAgent("math_expert", apiKey, graphLogger)
 	mathExpert.AddTool(tools.NewCalculator())
 	mathExpert.Configure(map[string]interface{}{
 		"model": "gpt-4o-mini",
@@ -56,7 +59,7 @@ func main() {
 			"Always explain your reasoning and show your work.",
 	})
 
-	poet := agent.NewOpenAIAgent("poet", apiKey, logger)
+	poet := agent.NewOpenAIAgent("poet", apiKey, graphLogger)
 	poet.Configure(map[string]interface{}{
 		"model": "gpt-4o-mini",
 		"system_message": "You are a creative poet. When given a number, create a beautiful and " +
@@ -65,6 +68,7 @@ func main() {
 
 	// Create the graph
 	graph := core.NewStateGraph[State]()
+	graph.SetLogger(graphLogger)
 
 	// Configure streaming
 	graph.SetStreamConfig(core.StreamConfig{
@@ -153,7 +157,7 @@ func main() {
 
 	// Create channels for streaming
 	ctx := context.Background()
-	streamCh, eventCh, err := runnable.Stream(ctx, State{
+	streamCh, eventCh, resultCh, err := runnable.Stream(ctx, State{
 		Messages: []core.Message{},
 	})
 	if err != nil {
@@ -215,4 +219,11 @@ func main() {
 	case <-done:
 		logger.Info("Graph execution completed")
 	}
+
+	// The final state arrives whichever stream modes are active
+	if result := <-resultCh; result.Err != nil {
+		logger.Error("Graph execution failed", zap.Error(result.Err))
+	} else {
+		logger.Info("Final result", zap.Float64("result", result.State.Result))
+	}
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	dotenv "github.com/joho/godotenv"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/prebuilt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func main() {
+	// Load .env file
+	if err := dotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found: %v", err)
+	}
+
+	// Initialize logger
+	config := zap.NewDevelopmentConfig()
+	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	config.EncoderConfig.TimeKey = "timestamp"
+	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	logger, err := config.Build()
+	if err != nil {
+		log.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Sync()
+
+	// Get OpenAI API key from environment
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		logger.Fatal("OPENAI_API_KEY environment variable is required")
+	}
+
+	graphLogger := core.NewZapLogger(logger)
+	newAgent := func(id, systemMessage string) agent.Agent {
+		a := agent.NewOpenAIAgent(id, apiKey, graphLogger)
+		a.Configure(map[string]interface{}{
+			"model":          "gpt-4o-mini",
+			"system_message": systemMessage,
+		})
+		return a
+	}
+
+	// The research team gathers sourced findings
+	research := prebuilt.NewSupervisor(
+		newAgent("research_lead", "You lead a research team. Have the researcher gather findings, "+
+			"then the fact checker verify them, and finish with the verified findings and their numbered sources."),
+		map[string]agent.Agent{
+			"researcher": newAgent("researcher", "You are a researcher. Write concise findings, "+
+				"each followed by a numbered source like [1], and list the sources at the end."),
+			"fact_checker": newAgent("fact_checker", "You are a fact checker. Flag claims without a "+
+				"source and remove the ones you can't support, keeping the numbered sources."),
+		},
+		prebuilt.WithMaxTurns(4),
+	)
+
+	// The writing team turns findings into a report
+	writing := prebuilt.NewSupervisor(
+		newAgent("writing_lead", "You lead a writing team. Have the writer draft the report, then the "+
+			"editor polish it, and finish with the complete report."),
+		map[string]agent.Agent{
+			"writer": newAgent("writer", "You are a technical writer. Write a short report from the findings "+
+				"in the task, citing them with their numbered sources and ending with a references section."),
+			"editor": newAgent("editor", "You are an editor. Tighten the report without dropping any citation."),
+		},
+		prebuilt.WithMaxTurns(4),
+	)
+
+	graph, err := prebuilt.NewHierarchicalTeams(
+		newAgent("director", "You direct a research team and a writing team. Delegate research first, "+
+			"then hand the findings to the writing team, including them in full in the task, and finish "+
+			"with the writing team's report."),
+		map[string]*prebuilt.Supervisor{
+			"research": research,
+			"writing":  writing,
+		},
+		prebuilt.HierarchicalOptions{MaxDelegations: 4},
+	)
+	if err != nil {
+		logger.Fatal("Failed to build teams", zap.Error(err))
+	}
+	graph.SetLogger(graphLogger)
+	graph.SetStreamConfig(core.StreamConfig{
+		Modes:      []core.StreamMode{core.StreamDebug},
+		BufferSize: 100,
+	})
+
+	runnable, err := graph.Compile()
+	if err != nil {
+		logger.Fatal("Failed to compile graph", zap.Error(err))
+	}
+
+	events, wait := runnable.InvokeStreaming(context.Background(), prebuilt.TeamState{
+		Request: "Write a short cited report on the energy use of training large language models.",
+	})
+	for evt := range events {
+		e, ok := evt.Data.(core.Event)
+		if !ok {
+			continue
+		}
+		switch e.Type {
+		case prebuilt.EventTeamDecision:
+			logger.Info("Decision",
+				zap.String("by", e.Name),
+				zap.Any("next", e.Metadata["next"]),
+				zap.Any("reason", e.Metadata["reason"]))
+		case prebuilt.EventTeamStep:
+			logger.Info("Step",
+				zap.Any("team", e.Metadata["team"]),
+				zap.Any("worker", e.Metadata["worker"]),
+				zap.Any("turn", e.Metadata["turn"]))
+		}
+	}
+
+	final, err := wait()
+	if err != nil {
+		logger.Fatal("Run failed", zap.Error(err))
+	}
+	fmt.Println(final.Answer)
+}
@@ -0,0 +1,36 @@
+package agenttest
+
+import (
+	"net/http"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// replayAPIKey is sent by replaying agents, which never reach the API
+const replayAPIKey = "agenttest-replay"
+
+// NewRecordingAgent creates an OpenAI agent whose model requests are served
+// from the cassette at fixture when it has a recording for them, and are
+// otherwise sent to the API and recorded. The first run of a test records
+// the fixture and later runs replay it.
+func NewRecordingAgent(id, apiKey string, logger core.Logger, fixture string, opts ...agent.Option) (agent.Agent, error) {
+	cassette, err := LoadCassette(fixture)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: cassette.Transport(http.DefaultTransport)}
+	return agent.NewOpenAIAgent(id, apiKey, logger, append(opts, agent.WithHTTPClient(client))...), nil
+}
+
+// NewReplayAgent creates an OpenAI agent that only replays the cassette at
+// fixture. Requests without a recording fail with an error naming
+// ErrNoRecording, so no API key is needed.
+func NewReplayAgent(id string, logger core.Logger, fixture string, opts ...agent.Option) (agent.Agent, error) {
+	cassette, err := LoadCassette(fixture)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: cassette.Transport(nil)}
+	return agent.NewOpenAIAgent(id, replayAPIKey, logger, append(opts, agent.WithHTTPClient(client))...), nil
+}
@@ -0,0 +1,254 @@
+// Package agenttest records the model responses of agents to fixture files
+// and replays them, so graphs calling LLMs can be tested deterministically,
+// quickly and without an API key
+package agenttest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// ErrNoRecording is reported when a replayed request has no recorded
+	// response in the cassette
+	ErrNoRecording = errors.New("no recorded response for request")
+)
+
+// cassetteVersion is the version of the fixture file format
+const cassetteVersion = 1
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	// Key is the hash of the request, see RequestKey
+	Key string `json:"key"`
+
+	// Method and Path identify the endpoint that was called
+	Method string `json:"method"`
+	Path   string `json:"path"`
+
+	// Request is the request body, kept for reading fixtures
+	Request json.RawMessage `json:"request,omitempty"`
+
+	// Status, ContentType and Body are the recorded response. Streamed
+	// responses are kept as the raw server-sent events.
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// Cassette is a fixture file of recorded interactions
+type Cassette struct {
+	path string
+
+	mu           sync.Mutex
+	interactions map[string]Interaction
+	order        []string
+}
+
+// cassetteFile is the JSON form of a cassette
+type cassetteFile struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadCassette reads the cassette at path. A missing file gives an empty
+// cassette that is created when the first interaction is recorded.
+func LoadCassette(path string) (*Cassette, error) {
+	c := &Cassette{path: path, interactions: make(map[string]Interaction)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	if file.Version != cassetteVersion {
+		return nil, fmt.Errorf("cassette %s has unsupported version %d", path, file.Version)
+	}
+	for _, in := range file.Interactions {
+		c.add(in)
+	}
+	return c, nil
+}
+
+// Len returns the number of recorded interactions
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.order)
+}
+
+// Lookup returns the interaction recorded for a request key
+func (c *Cassette) Lookup(key string) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	in, ok := c.interactions[key]
+	return in, ok
+}
+
+// Record adds an interaction and writes the cassette to its file
+func (c *Cassette) Record(in Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(in)
+	return c.save()
+}
+
+// add stores an interaction, replacing one with the same key. The caller
+// must hold mu unless the cassette isn't shared yet.
+func (c *Cassette) add(in Interaction) {
+	if _, exists := c.interactions[in.Key]; !exists {
+		c.order = append(c.order, in.Key)
+	}
+	c.interactions[in.Key] = in
+}
+
+// save writes the cassette in recording order. The caller must hold mu.
+func (c *Cassette) save() error {
+	file := cassetteFile{Version: cassetteVersion}
+	for _, key := range c.order {
+		file.Interactions = append(file.Interactions, c.interactions[key])
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// RequestKey hashes the method, path and body of a request. JSON bodies are
+// normalized first, so field order doesn't change the key.
+func RequestKey(method, path string, body []byte) string {
+	if normalized, ok := normalizeJSON(body); ok {
+		body = normalized
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", method, path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeJSON re-encodes a JSON document with sorted object keys
+func normalizeJSON(body []byte) ([]byte, bool) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, false
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Transport returns an HTTP transport serving requests from the cassette.
+// Requests without a recording are sent through next and recorded, or, when
+// next is nil, answered with a 404 error naming ErrNoRecording.
+func (c *Cassette) Transport(next http.RoundTripper) http.RoundTripper {
+	return &cassetteTransport{cassette: c, next: next}
+}
+
+type cassetteTransport struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	key := RequestKey(req.Method, req.URL.Path, body)
+
+	if in, ok := t.cassette.Lookup(key); ok {
+		return replay(req, in), nil
+	}
+
+	if t.next == nil {
+		// A client error, so the API client doesn't retry it
+		message, _ := json.Marshal(fmt.Sprintf("%v: %s %s (key %s)", ErrNoRecording, req.Method, req.URL.Path, key))
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader([]byte(`{"error":{"message":` + string(message) + `,"type":"no_recording"}}`))),
+			Request:    req,
+		}, nil
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	in := Interaction{
+		Key:         key,
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(respBody),
+	}
+	if json.Valid(body) {
+		in.Request = body
+	}
+	// Failed requests aren't worth replaying
+	if resp.StatusCode < 400 {
+		if err := t.cassette.Record(in); err != nil {
+			return nil, err
+		}
+	}
+	return replay(req, in), nil
+}
+
+// replay builds the response of a recorded interaction
+func replay(req *http.Request, in Interaction) *http.Response {
+	header := http.Header{}
+	if in.ContentType != "" {
+		header.Set("Content-Type", in.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(in.Body))),
+		ContentLength: int64(len(in.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,92 @@
+package agenttest_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// ask configures the agent and sends it the prompt
+func ask(t *testing.T, a agent.Agent, prompt string) ([]core.Message, error) {
+	t.Helper()
+	if err := a.Configure(map[string]interface{}{
+		"model":          "gpt-4o-mini",
+		"system_message": "You are a helpful assistant.",
+	}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	return a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: prompt})
+}
+
+func TestReplaySampleFixture(t *testing.T) {
+	a, err := agenttest.NewReplayAgent("greeter", nil, "testdata/hello.json")
+	if err != nil {
+		t.Fatalf("NewReplayAgent: %v", err)
+	}
+	replies, err := ask(t, a, "Say hello")
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if len(replies) != 1 || replies[0].Content != "Hello! How can I help you today?" {
+		t.Errorf("replies = %+v, want the recorded greeting", replies)
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	// The recording agent sends unrecorded requests through the default
+	// transport, which the fake model stands in for
+	upstream := agenttest.NewFakeModel(agenttest.FakeReply{Content: "Bonjour!"})
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = upstream
+	t.Cleanup(func() { http.DefaultTransport = defaultTransport })
+	fixture := filepath.Join(t.TempDir(), "bonjour.json")
+
+	// The first run records
+	recorder, err := agenttest.NewRecordingAgent("greeter", "key", nil, fixture)
+	if err != nil {
+		t.Fatalf("NewRecordingAgent: %v", err)
+	}
+	if replies, err := ask(t, recorder, "Say hello in French"); err != nil || replies[0].Content != "Bonjour!" {
+		t.Fatalf("recording run = %+v, %v", replies, err)
+	}
+
+	// Later runs replay without reaching the model
+	recorder, err = agenttest.NewRecordingAgent("greeter", "key", nil, fixture)
+	if err != nil {
+		t.Fatalf("NewRecordingAgent: %v", err)
+	}
+	if replies, err := ask(t, recorder, "Say hello in French"); err != nil || replies[0].Content != "Bonjour!" {
+		t.Errorf("second recording run = %+v, %v", replies, err)
+	}
+	replayer, err := agenttest.NewReplayAgent("greeter", nil, fixture)
+	if err != nil {
+		t.Fatalf("NewReplayAgent: %v", err)
+	}
+	if replies, err := ask(t, replayer, "Say hello in French"); err != nil || replies[0].Content != "Bonjour!" {
+		t.Errorf("replay = %+v, %v", replies, err)
+	}
+	if n := len(upstream.Requests()); n != 1 {
+		t.Errorf("the model was called %d times, want once while recording", n)
+	}
+
+	// An unrecorded request fails rather than reaching the API
+	replayer, _ = agenttest.NewReplayAgent("greeter", nil, fixture)
+	if _, err := ask(t, replayer, "Say goodbye"); err == nil || !strings.Contains(err.Error(), agenttest.ErrNoRecording.Error()) {
+		t.Errorf("unrecorded request = %v, want ErrNoRecording", err)
+	}
+}
+
+func TestRequestKeyIgnoresFieldOrder(t *testing.T) {
+	a := agenttest.RequestKey("POST", "/v1/chat/completions", []byte(`{"model":"m","stream":true}`))
+	b := agenttest.RequestKey("POST", "/v1/chat/completions", []byte(`{"stream":true, "model":"m"}`))
+	c := agenttest.RequestKey("POST", "/v1/chat/completions", []byte(`{"stream":false,"model":"m"}`))
+	if a != b || a == c {
+		t.Errorf("keys %s, %s, %s: want equal bodies in any order to match and others not", a, b, c)
+	}
+}
@@ -0,0 +1,264 @@
+package agenttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// conformanceModel is the model every agent under test is configured with
+const conformanceModel = "conformance-model"
+
+// conformanceTimeout bounds every call the suite makes
+const conformanceTimeout = 10 * time.Second
+
+// Factory creates a fresh, unconfigured agent that sends its model requests
+// through transport. The transport speaks the protocol the suite was run
+// with.
+type Factory func(transport http.RoundTripper) agent.Agent
+
+// RunConformance checks an Agent implementation speaking the provider
+// protocol against the contract all agents share:
+//
+//   - Configure rejects an invalid model and accepts a valid one
+//   - ProcessMessage returns at least one message, the last from the assistant
+//   - tools reach the model with their name, description and schema intact
+//   - tool results are sent back to the model before it answers
+//   - rejected credentials fail with an error matching agent.ErrUnauthorized
+//   - concurrent ProcessMessage calls on different threads are safe
+//   - conversations on different threads don't see each other's history
+//
+// Run it with the race detector to enforce the concurrency guarantee.
+func RunConformance(t *testing.T, protocol Protocol, factory Factory) {
+	fakeModel := func(replies ...FakeReply) *FakeModel {
+		return NewFakeModelFor(protocol, replies...)
+	}
+
+	t.Run("Configure", func(t *testing.T) {
+		a := factory(fakeModel())
+		if err := a.Configure(map[string]interface{}{"model": 42}); err == nil {
+			t.Error("Configure accepted a non-string model")
+		}
+		if err := a.Configure(map[string]interface{}{"model": conformanceModel}); err != nil {
+			t.Errorf("Configure rejected a valid config: %v", err)
+		}
+	})
+
+	t.Run("AssistantReply", func(t *testing.T) {
+		fake := fakeModel(FakeReply{Content: "hello from the model"})
+		a := configured(t, factory(fake))
+
+		replies := process(t, context.Background(), a, "hi")
+		last := replies[len(replies)-1]
+		if last.Role != core.RoleAssistant {
+			t.Errorf("last reply has role %q, want %q", last.Role, core.RoleAssistant)
+		}
+		if last.Content != "hello from the model" {
+			t.Errorf("reply content = %q, want the model's content", last.Content)
+		}
+	})
+
+	t.Run("ToolSchema", func(t *testing.T) {
+		fake := fakeModel()
+		a := configured(t, factory(fake))
+		tool := newConformanceTool("")
+		a.AddTool(tool)
+
+		process(t, context.Background(), a, "hi")
+		requests := fake.Requests()
+		if len(requests) == 0 {
+			t.Fatal("no request reached the model")
+		}
+		description, schema, ok := protocol.Tool(requests[0], tool.Name())
+		if !ok {
+			t.Fatalf("tool %s wasn't sent to the model", tool.Name())
+		}
+		if description != tool.Description() {
+			t.Errorf("tool description = %q, want %q", description, tool.Description())
+		}
+		if !jsonEqual(schema, tool.JSONSchema()) {
+			t.Errorf("tool schema = %v, want %v", schema, tool.JSONSchema())
+		}
+	})
+
+	t.Run("ToolResults", func(t *testing.T) {
+		fake := fakeModel(
+			FakeReply{ToolCalls: []FakeToolCall{{ID: "call_lookup", Name: "conformance_lookup", Arguments: `{"query":"answer"}`}}},
+			FakeReply{Content: "the answer is 42"},
+		)
+		a := configured(t, factory(fake))
+		tool := newConformanceTool("42")
+		a.AddTool(tool)
+
+		replies := process(t, context.Background(), a, "look it up")
+		if got := replies[len(replies)-1].Content; got != "the answer is 42" {
+			t.Errorf("reply content = %q, want the answer after the tool call", got)
+		}
+		if tool.calls() != 1 {
+			t.Errorf("tool ran %d times, want 1", tool.calls())
+		}
+
+		requests := fake.Requests()
+		if len(requests) < 2 {
+			t.Fatalf("model got %d requests, want a second one with the tool result", len(requests))
+		}
+		if !protocol.HasToolResult(requests[1], "call_lookup", "42") {
+			t.Errorf("second request doesn't carry the tool result: %v", protocol.Texts(requests[1]))
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		a := configured(t, factory(fakeModel(FakeReply{Status: http.StatusUnauthorized})))
+
+		ctx, cancel := context.WithTimeout(context.Background(), conformanceTimeout)
+		defer cancel()
+		_, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "hi"})
+		if !errors.Is(err, agent.ErrUnauthorized) {
+			t.Errorf("error = %v, want one matching agent.ErrUnauthorized", err)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		a := configured(t, factory(fakeModel()))
+
+		const callers = 8
+		var wg sync.WaitGroup
+		errs := make([]error, callers)
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(core.WithThreadID(context.Background(), fmt.Sprintf("thread-%d", i)), conformanceTimeout)
+				defer cancel()
+				_, errs[i] = a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "hi"})
+			}()
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("caller %d: %v", i, err)
+			}
+		}
+	})
+
+	t.Run("ThreadIsolation", func(t *testing.T) {
+		fake := fakeModel()
+		a := configured(t, factory(fake))
+		alpha := core.WithThreadID(context.Background(), "alpha")
+		beta := core.WithThreadID(context.Background(), "beta")
+
+		process(t, alpha, a, "first message on alpha")
+		process(t, beta, a, "first message on beta")
+		process(t, alpha, a, "second message on alpha")
+
+		requests := fake.Requests()
+		if len(requests) != 3 {
+			t.Fatalf("model got %d requests, want 3", len(requests))
+		}
+		if mentions(protocol, requests[1], "first message on alpha") {
+			t.Error("thread beta saw the history of thread alpha")
+		}
+		if !mentions(protocol, requests[2], "first message on alpha") {
+			t.Error("thread alpha lost its history")
+		}
+		if mentions(protocol, requests[2], "first message on beta") {
+			t.Error("thread alpha saw the history of thread beta")
+		}
+	})
+}
+
+// configured configures an agent with the conformance model
+func configured(t *testing.T, a agent.Agent) agent.Agent {
+	t.Helper()
+	if err := a.Configure(map[string]interface{}{"model": conformanceModel}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	return a
+}
+
+// process sends a user message and checks that replies came back
+func process(t *testing.T, ctx context.Context, a agent.Agent, content string) []core.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(ctx, conformanceTimeout)
+	defer cancel()
+	replies, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: content})
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if len(replies) == 0 {
+		t.Fatal("ProcessMessage returned no messages")
+	}
+	return replies
+}
+
+// mentions reports whether any message of a request contains the text
+func mentions(protocol Protocol, request map[string]interface{}, text string) bool {
+	for _, content := range protocol.Texts(request) {
+		if strings.Contains(content, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonEqual compares two values by their JSON form
+func jsonEqual(a, b interface{}) bool {
+	var va, vb interface{}
+	da, errA := json.Marshal(a)
+	db, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	if json.Unmarshal(da, &va) != nil || json.Unmarshal(db, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// conformanceTool is a tool returning a fixed result and counting its calls
+type conformanceTool struct {
+	*core.BaseTool
+	result string
+
+	mu sync.Mutex
+	n  int
+}
+
+func newConformanceTool(result string) *conformanceTool {
+	return &conformanceTool{
+		BaseTool: core.NewBaseTool("conformance_lookup", "Looks up an answer", map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "What to look up",
+				},
+			},
+			"required": []interface{}{"query"},
+		}),
+		result: result,
+	}
+}
+
+func (t *conformanceTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n++
+	return t.result, nil
+}
+
+func (t *conformanceTool) calls() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.n
+}
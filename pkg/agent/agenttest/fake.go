@@ -0,0 +1,117 @@
+package agenttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// FakeReply is a scripted response of a FakeModel
+type FakeReply struct {
+	// Content is the text of the reply
+	Content string
+
+	// Reasoning is the reasoning streamed before the content, as providers
+	// with reasoning models send it
+	Reasoning string
+
+	// ToolCalls are the tool calls of the reply
+	ToolCalls []FakeToolCall
+
+	// Fingerprint is the system fingerprint of the backend sending the reply
+	Fingerprint string
+
+	// Status, when set, answers with this HTTP status and an error body
+	// instead of a completion
+	Status int
+}
+
+// FakeToolCall is a tool call in a scripted reply
+type FakeToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// FakeModel is an HTTP transport that speaks a provider's protocol with
+// scripted replies, and records the requests it gets
+type FakeModel struct {
+	protocol Protocol
+
+	mu       sync.Mutex
+	replies  []FakeReply
+	requests []map[string]interface{}
+}
+
+// NewFakeModel creates a fake speaking the OpenAI chat completions
+// streaming protocol, answering with the replies in order. Once they run
+// out it answers "ok".
+func NewFakeModel(replies ...FakeReply) *FakeModel {
+	return NewFakeModelFor(OpenAI, replies...)
+}
+
+// NewFakeModelFor creates a fake speaking the protocol, answering with the
+// replies in order. Once they run out it answers "ok".
+func NewFakeModelFor(protocol Protocol, replies ...FakeReply) *FakeModel {
+	return &FakeModel{protocol: protocol, replies: replies}
+}
+
+// Requests returns the decoded bodies of the requests received so far
+func (f *FakeModel) Requests() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}(nil), f.requests...)
+}
+
+// RoundTrip answers a request with the next scripted reply
+func (f *FakeModel) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body map[string]interface{}
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, fmt.Errorf("fake model got invalid request: %w", err)
+		}
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, body)
+	reply := FakeReply{Content: "ok"}
+	if len(f.replies) > 0 {
+		reply = f.replies[0]
+		f.replies = f.replies[1:]
+	}
+	f.mu.Unlock()
+
+	if reply.Status != 0 {
+		return &http.Response{
+			StatusCode: reply.Status,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(f.protocol.Error(reply.Status))),
+			Request:    req,
+		}, nil
+	}
+
+	contentType, payload := f.protocol.Response(reply)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(strings.NewReader(payload)),
+		Request:    req,
+	}, nil
+}
+
+// id returns the ID of the call, generating one from its index when the
+// script leaves it out
+func (c FakeToolCall) id(index int) string {
+	if c.ID != "" {
+		return c.ID
+	}
+	return fmt.Sprintf("call_%d", index)
+}
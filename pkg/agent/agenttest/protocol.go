@@ -0,0 +1,218 @@
+package agenttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Protocol is the wire format of a model provider's API. It lets a
+// FakeModel answer agents for any provider, and the conformance suite read
+// what they sent.
+type Protocol interface {
+	// Response renders a scripted reply as the content type and body of a
+	// successful response
+	Response(reply FakeReply) (contentType, body string)
+
+	// Error renders the body of a response with a failure status
+	Error(status int) string
+
+	// Tool returns the description and input schema of the named tool in
+	// a request, and whether the request has the tool
+	Tool(request map[string]interface{}, name string) (description string, schema interface{}, ok bool)
+
+	// HasToolResult reports whether a request carries the result of a
+	// tool call
+	HasToolResult(request map[string]interface{}, callID, result string) bool
+
+	// Texts returns the text of every message of a request
+	Texts(request map[string]interface{}) []string
+}
+
+// OpenAI is the OpenAI chat completions streaming protocol
+var OpenAI Protocol = openAIProtocol{}
+
+// openAIProtocol implements Protocol for OpenAI chat completions
+type openAIProtocol struct{}
+
+// Response renders the reply as a single streamed chunk and a usage chunk
+func (openAIProtocol) Response(r FakeReply) (string, string) {
+	delta := map[string]interface{}{"role": "assistant"}
+	finish := "stop"
+	if r.Content != "" {
+		delta["content"] = r.Content
+	}
+	if r.Reasoning != "" {
+		delta["reasoning_content"] = r.Reasoning
+	}
+	if len(r.ToolCalls) > 0 {
+		calls := make([]map[string]interface{}, len(r.ToolCalls))
+		for i, call := range r.ToolCalls {
+			calls[i] = map[string]interface{}{
+				"index": i,
+				"id":    call.id(i),
+				"type":  "function",
+				"function": map[string]interface{}{
+					"name":      call.Name,
+					"arguments": call.Arguments,
+				},
+			}
+		}
+		delta["tool_calls"] = calls
+		finish = "tool_calls"
+	}
+
+	chunk, _ := json.Marshal(map[string]interface{}{
+		"id":                 "chatcmpl-fake",
+		"object":             "chat.completion.chunk",
+		"created":            1,
+		"model":              "fake",
+		"system_fingerprint": r.Fingerprint,
+		"choices":            []map[string]interface{}{{"index": 0, "delta": delta, "finish_reason": finish}},
+	})
+	usage, _ := json.Marshal(map[string]interface{}{
+		"id":      "chatcmpl-fake",
+		"object":  "chat.completion.chunk",
+		"created": 1,
+		"model":   "fake",
+		"choices": []interface{}{},
+		"usage":   map[string]int{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+	})
+	return "text/event-stream", "data: " + string(chunk) + "\n\ndata: " + string(usage) + "\n\ndata: [DONE]\n\n"
+}
+
+func (openAIProtocol) Error(status int) string {
+	return fmt.Sprintf(`{"error":{"message":"fake error %d","type":"fake_error"}}`, status)
+}
+
+func (openAIProtocol) Tool(request map[string]interface{}, name string) (string, interface{}, bool) {
+	tools, _ := request["tools"].([]interface{})
+	for _, raw := range tools {
+		tool, _ := raw.(map[string]interface{})
+		function, _ := tool["function"].(map[string]interface{})
+		if function["name"] == name {
+			description, _ := function["description"].(string)
+			return description, function["parameters"], true
+		}
+	}
+	return "", nil, false
+}
+
+func (openAIProtocol) HasToolResult(request map[string]interface{}, callID, result string) bool {
+	messages, _ := request["messages"].([]interface{})
+	for _, raw := range messages {
+		msg, _ := raw.(map[string]interface{})
+		if msg["role"] == "tool" && msg["tool_call_id"] == callID && strings.Contains(contentText(msg["content"]), result) {
+			return true
+		}
+	}
+	return false
+}
+
+func (openAIProtocol) Texts(request map[string]interface{}) []string {
+	messages, _ := request["messages"].([]interface{})
+	texts := make([]string, 0, len(messages))
+	for _, raw := range messages {
+		msg, _ := raw.(map[string]interface{})
+		texts = append(texts, contentText(msg["content"]))
+	}
+	return texts
+}
+
+// contentText flattens message content, which is a string or a list of parts
+func contentText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var sb strings.Builder
+		for _, raw := range c {
+			if part, ok := raw.(map[string]interface{}); ok {
+				if text, ok := part["text"].(string); ok {
+					sb.WriteString(text)
+				}
+			}
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+// Anthropic is the Anthropic Messages API protocol, answered without
+// streaming
+var Anthropic Protocol = anthropicProtocol{}
+
+// anthropicProtocol implements Protocol for the Anthropic Messages API
+type anthropicProtocol struct{}
+
+// Response renders the reply as a message with a fixed usage
+func (anthropicProtocol) Response(r FakeReply) (string, string) {
+	var content []map[string]interface{}
+	if r.Reasoning != "" {
+		content = append(content, map[string]interface{}{"type": "thinking", "thinking": r.Reasoning})
+	}
+	if r.Content != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": r.Content})
+	}
+	stop := "end_turn"
+	for i, call := range r.ToolCalls {
+		input := json.RawMessage(call.Arguments)
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		content = append(content, map[string]interface{}{"type": "tool_use", "id": call.id(i), "name": call.Name, "input": input})
+		stop = "tool_use"
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":          "msg_fake",
+		"type":        "message",
+		"role":        "assistant",
+		"model":       "fake",
+		"stop_reason": stop,
+		"content":     content,
+		"usage":       map[string]int{"input_tokens": 10, "output_tokens": 5},
+	})
+	return "application/json", string(body)
+}
+
+func (anthropicProtocol) Error(status int) string {
+	return fmt.Sprintf(`{"type":"error","error":{"type":"fake_error","message":"fake error %d"}}`, status)
+}
+
+func (anthropicProtocol) Tool(request map[string]interface{}, name string) (string, interface{}, bool) {
+	tools, _ := request["tools"].([]interface{})
+	for _, raw := range tools {
+		tool, _ := raw.(map[string]interface{})
+		if tool["name"] == name {
+			description, _ := tool["description"].(string)
+			return description, tool["input_schema"], true
+		}
+	}
+	return "", nil, false
+}
+
+func (anthropicProtocol) HasToolResult(request map[string]interface{}, callID, result string) bool {
+	messages, _ := request["messages"].([]interface{})
+	for _, raw := range messages {
+		msg, _ := raw.(map[string]interface{})
+		blocks, _ := msg["content"].([]interface{})
+		for _, rawBlock := range blocks {
+			block, _ := rawBlock.(map[string]interface{})
+			if block["type"] == "tool_result" && block["tool_use_id"] == callID && strings.Contains(contentText(block["content"]), result) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (anthropicProtocol) Texts(request map[string]interface{}) []string {
+	messages, _ := request["messages"].([]interface{})
+	texts := make([]string, 0, len(messages))
+	for _, raw := range messages {
+		msg, _ := raw.(map[string]interface{})
+		texts = append(texts, contentText(msg["content"]))
+	}
+	return texts
+}
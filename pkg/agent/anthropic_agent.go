@@ -0,0 +1,691 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// anthropicMessagesURL is the endpoint of the Anthropic Messages API
+const anthropicMessagesURL = "https://api.anthropic.com/v1/messages"
+
+// anthropicVersion is the API version the agent's requests are written for
+const anthropicVersion = "2023-06-01"
+
+// defaultAnthropicMaxTokens is used when no max_tokens is configured, the
+// API requires every request to set one
+const defaultAnthropicMaxTokens = 1024
+
+// Lifetimes of Anthropic prompt cache entries
+const (
+	PromptCacheTTL5m = "5m"
+	PromptCacheTTL1h = "1h"
+)
+
+// AnthropicAgent is an agent backed by the Anthropic Messages API.
+//
+// With prompt caching on, which is the default, requests mark cache
+// breakpoints on the system prompt, the last tool definition and the last
+// message, so the static prefix and the conversation so far are read from
+// Anthropic's prompt cache on the next request.
+//
+// Requests whose context carries a thread ID keep their history in the
+// agent's memory store, like those of OpenAI agents.
+type AnthropicAgent struct {
+	id     string
+	url    string
+	apiKey string
+	client *http.Client
+	logger core.Logger
+	config map[string]interface{}
+	tools  []core.Tool
+
+	// historyMu guards history
+	historyMu sync.Mutex
+
+	// history is the conversation of requests without a thread
+	history []anthropicMessage
+
+	// memory holds the history of requests made on a thread
+	memory MemoryStore
+
+	// toolTimeout bounds each individual tool execution
+	toolTimeout time.Duration
+
+	// retryPolicy retries failed requests
+	retryPolicy core.RetryPolicy
+
+	// propagateMetadata are the request metadata keys copied to replies and events
+	propagateMetadata []string
+
+	// usageMu guards usage
+	usageMu sync.Mutex
+
+	// usage accumulates token usage over all requests
+	usage core.UsageStats
+
+	// breaker optionally stops requests while the provider is failing
+	breaker *core.CircuitBreaker
+}
+
+// NewAnthropicAgent creates an agent backed by the Anthropic Messages API.
+// A nil logger discards everything.
+func NewAnthropicAgent(id string, apiKey string, logger core.Logger, opts ...Option) Agent {
+	if logger == nil {
+		logger = core.NopLogger()
+	}
+
+	var o agentOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	client := o.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &AnthropicAgent{
+		id:      id,
+		url:     anthropicMessagesURL,
+		apiKey:  apiKey,
+		client:  client,
+		logger:  logger.With("agent_id", id),
+		config:  map[string]interface{}{"prompt_cache": true},
+		tools:   make([]core.Tool, 0),
+		history: make([]anthropicMessage, 0),
+
+		toolTimeout:       defaultToolTimeout,
+		propagateMetadata: core.DefaultPropagatedMetadata,
+		breaker:           o.breaker(id),
+		memory:            o.memoryStore(),
+	}
+}
+
+func (a *AnthropicAgent) ID() string {
+	return a.id
+}
+
+// Configure sets the model and request options. Besides model,
+// system_message, max_tokens, max_tool_iterations, tool_timeout,
+// retry_policy and propagate_metadata as for OpenAI agents, prompt_cache
+// turns cache breakpoints on or off and prompt_cache_ttl sets their
+// lifetime to PromptCacheTTL5m or PromptCacheTTL1h.
+func (a *AnthropicAgent) Configure(config map[string]interface{}) error {
+	if model, ok := config["model"].(string); !ok {
+		return fmt.Errorf("model must be a string")
+	} else {
+		a.config["model"] = model
+	}
+
+	if raw, ok := config["system_message"]; ok {
+		systemMessage, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("system_message must be a string")
+		}
+		a.config["system_message"] = systemMessage
+	}
+
+	if raw, ok := config["max_tokens"]; ok {
+		maxTokens, err := toInt64(raw)
+		if err != nil || maxTokens <= 0 {
+			return fmt.Errorf("max_tokens must be a positive integer")
+		}
+		a.config["max_tokens"] = int(maxTokens)
+	}
+
+	if raw, ok := config["max_tool_iterations"]; ok {
+		iterations, err := toInt64(raw)
+		if err != nil || iterations <= 0 {
+			return fmt.Errorf("max_tool_iterations must be a positive integer")
+		}
+		a.config["max_tool_iterations"] = int(iterations)
+	}
+
+	if raw, ok := config["prompt_cache"]; ok {
+		enabled, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("prompt_cache must be a bool")
+		}
+		a.config["prompt_cache"] = enabled
+	}
+
+	if raw, ok := config["prompt_cache_ttl"]; ok {
+		ttl, ok := raw.(string)
+		if !ok || (ttl != PromptCacheTTL5m && ttl != PromptCacheTTL1h) {
+			return fmt.Errorf("prompt_cache_ttl must be %s or %s", PromptCacheTTL5m, PromptCacheTTL1h)
+		}
+		a.config["prompt_cache_ttl"] = ttl
+	}
+
+	if raw, ok := config["tool_timeout"]; ok {
+		switch v := raw.(type) {
+		case time.Duration:
+			a.toolTimeout = v
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid tool_timeout: %w", err)
+			}
+			a.toolTimeout = d
+		default:
+			return fmt.Errorf("tool_timeout must be a duration or duration string")
+		}
+		if a.toolTimeout <= 0 {
+			return fmt.Errorf("tool_timeout must be positive")
+		}
+	}
+
+	if raw, ok := config["retry_policy"]; ok {
+		policy, ok := raw.(core.RetryPolicy)
+		if !ok {
+			return fmt.Errorf("retry_policy must be a core.RetryPolicy")
+		}
+		a.retryPolicy = policy
+	}
+
+	if raw, ok := config["propagate_metadata"]; ok {
+		keys, ok := raw.([]string)
+		if !ok {
+			return fmt.Errorf("propagate_metadata must be a []string")
+		}
+		a.propagateMetadata = keys
+	}
+	return nil
+}
+
+// Model returns the configured model
+func (a *AnthropicAgent) Model() string {
+	model, _ := a.config["model"].(string)
+	return model
+}
+
+// Tools returns the tools added to the agent
+func (a *AnthropicAgent) Tools() []core.Tool {
+	return a.tools
+}
+
+// AddTool adds a tool to the agent. A tool with an invalid name is logged
+// here and fails ProcessMessage with ErrInvalidToolName.
+func (a *AnthropicAgent) AddTool(tool core.Tool) {
+	if err := ValidateToolName(tool.Name()); err != nil {
+		a.logger.Error("Invalid tool name", "error", err)
+	}
+	a.tools = append(a.tools, tool)
+}
+
+func (a *AnthropicAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	a.logger.Debug("Processing message", "content", msg.Content)
+
+	// Replies and events carry the request's correlation metadata
+	propagated := core.PropagateMetadata(msg, a.propagateMetadata)
+
+	for _, tool := range a.tools {
+		if err := ValidateToolName(tool.Name()); err != nil {
+			return nil, err
+		}
+	}
+
+	model, _ := a.config["model"].(string)
+	if model == "" {
+		return nil, fmt.Errorf("model must be configured")
+	}
+	maxIterations, ok := a.config["max_tool_iterations"].(int)
+	if !ok {
+		maxIterations = defaultMaxToolIterations
+	}
+
+	// Threads keep their history in the memory store, other requests
+	// continue the agent's own history
+	threadID := core.ThreadIDFromContext(ctx)
+	var history []anthropicMessage
+	if threadID != "" {
+		history = toAnthropicMessages(a.memory.Load(threadID))
+	} else {
+		a.historyMu.Lock()
+		history = append(history, a.history...)
+		a.historyMu.Unlock()
+	}
+	history = append(history, anthropicMessage{
+		Role:    "user",
+		Content: []anthropicBlock{{Type: "text", Text: msg.Content}},
+	})
+
+	var reply anthropicResponse
+	var toolResults []string
+	iterations := 0
+	exhausted := false
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("agent loop aborted: %w", err)
+		}
+
+		req := a.buildRequest(model, history)
+		err := core.Retry(ctx, a.retryPolicy, a.guard(func(ctx context.Context) error {
+			var err error
+			reply, err = a.send(ctx, req)
+			return err
+		}))
+		if err != nil {
+			return nil, err
+		}
+
+		usage := reply.Usage.usage()
+		metadata := map[string]interface{}{
+			"agent_id":        a.id,
+			"model":           model,
+			"usage":           usage,
+			"cache_hit_ratio": a.recordUsage(usage).CacheHitRatio(),
+		}
+		for k, v := range propagated {
+			metadata[k] = v
+		}
+		if budget := core.TokenBudgetFromContext(ctx); budget != nil {
+			budget.Spend(usage.TotalTokens)
+		}
+		core.EmitEvent(ctx, core.Event{
+			Type:      core.EventChatModelEnd,
+			Name:      a.id,
+			Timestamp: time.Now(),
+			Metadata:  metadata,
+		})
+		a.logger.Debug("Message finished",
+			"stop_reason", reply.StopReason,
+			"cache_read_tokens", reply.Usage.CacheReadInputTokens,
+			"cache_write_tokens", reply.Usage.CacheCreationInputTokens)
+
+		history = append(history, anthropicMessage{Role: "assistant", Content: reply.Content})
+		if reply.StopReason != "tool_use" {
+			break
+		}
+
+		// Execute the requested tools and answer all of them in one message
+		var results []anthropicBlock
+		for _, block := range reply.Content {
+			if block.Type != "tool_use" {
+				continue
+			}
+			started := time.Now()
+			result, err := a.executeTool(ctx, block.Name, block.Input)
+			traced := core.ToolCallRecord{
+				Tool:      block.Name,
+				Arguments: string(block.Input),
+				Result:    result,
+				Start:     started,
+				Duration:  time.Since(started),
+			}
+			if err != nil {
+				traced.Error = err.Error()
+			}
+			core.RecordToolCall(ctx, traced)
+			if err != nil {
+				return nil, err
+			}
+			toolResults = append(toolResults, result)
+			results = append(results, anthropicBlock{Type: "tool_result", ToolUseID: block.ID, Content: result})
+		}
+		history = append(history, anthropicMessage{Role: "user", Content: results})
+
+		// A model that keeps calling tools is cut off with what it has said so far
+		iterations++
+		if iterations >= maxIterations {
+			a.logger.Warn("Tool loop stopped at max_tool_iterations", "iterations", iterations)
+			exhausted = true
+			break
+		}
+	}
+	// History is only saved once the turn completes, so a failed turn
+	// doesn't leave unanswered tool calls behind
+	if threadID != "" {
+		a.memory.Save(threadID, fromAnthropicMessages(history))
+	} else {
+		a.historyMu.Lock()
+		a.history = history
+		a.historyMu.Unlock()
+	}
+
+	response := core.Message{
+		Role:     core.RoleAssistant,
+		Content:  reply.text(),
+		Metadata: propagated,
+	}
+	if exhausted {
+		metadata := make(map[string]interface{}, len(propagated)+1)
+		for k, v := range propagated {
+			metadata[k] = v
+		}
+		metadata["warning"] = fmt.Sprintf("stopped after %d tool iterations without a final answer", iterations)
+		response.Metadata = metadata
+	}
+
+	a.logger.Info("Message processed",
+		"response", response.Content,
+		"tool_results", toolResults)
+
+	return []core.Message{response}, nil
+}
+
+// buildRequest assembles a request for the history. Cache breakpoints are
+// set on copies, the history itself never carries them.
+func (a *AnthropicAgent) buildRequest(model string, history []anthropicMessage) anthropicRequest {
+	maxTokens, ok := a.config["max_tokens"].(int)
+	if !ok {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	req := anthropicRequest{
+		Model:     model,
+		MaxTokens: maxTokens,
+		Messages:  history,
+	}
+	if systemMessage, _ := a.config["system_message"].(string); systemMessage != "" {
+		req.System = []anthropicBlock{{Type: "text", Text: systemMessage}}
+	}
+	for _, tool := range a.tools {
+		req.Tools = append(req.Tools, anthropicTool{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			InputSchema: tool.JSONSchema(),
+		})
+	}
+
+	if enabled, _ := a.config["prompt_cache"].(bool); !enabled {
+		return req
+	}
+	ttl, _ := a.config["prompt_cache_ttl"].(string)
+	breakpoint := &anthropicCacheControl{Type: "ephemeral", TTL: ttl}
+
+	// Tools come before the system prompt in the cached prefix, so marking
+	// both caches them separately from each other and from the messages
+	if n := len(req.Tools); n > 0 {
+		req.Tools = append([]anthropicTool(nil), req.Tools...)
+		req.Tools[n-1].CacheControl = breakpoint
+	}
+	if n := len(req.System); n > 0 {
+		req.System[n-1].CacheControl = breakpoint
+	}
+	if n := len(history); n > 0 {
+		last := history[n-1]
+		last.Content = append([]anthropicBlock(nil), last.Content...)
+		last.Content[len(last.Content)-1].CacheControl = breakpoint
+		req.Messages = append(append([]anthropicMessage(nil), history[:n-1]...), last)
+	}
+	return req
+}
+
+// send posts a request to the Messages API
+func (a *AnthropicAgent) send(ctx context.Context, req anthropicRequest) (anthropicResponse, error) {
+	var reply anthropicResponse
+	body, err := json.Marshal(req)
+	if err != nil {
+		return reply, core.NoRetry(fmt.Errorf("failed to marshal request: %w", err))
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return reply, core.NoRetry(fmt.Errorf("failed to create request: %w", err))
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Api-Key", a.apiKey)
+	httpReq.Header.Set("Anthropic-Version", anthropicVersion)
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return reply, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return reply, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(respBody, &apiErr)
+		err := fmt.Errorf("anthropic API returned %d: %s %s", resp.StatusCode, apiErr.Error.Type, apiErr.Error.Message)
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			// Retrying won't fix the credentials
+			return reply, core.NoRetry(fmt.Errorf("%w: %w", ErrUnauthorized, err))
+		case resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+			return reply, core.NoRetry(err)
+		}
+		return reply, err
+	}
+
+	if err := json.Unmarshal(respBody, &reply); err != nil {
+		return reply, core.NoRetry(fmt.Errorf("failed to decode response: %w", err))
+	}
+	return reply, nil
+}
+
+// executeTool runs the named tool under the configured tool timeout
+func (a *AnthropicAgent) executeTool(ctx context.Context, name string, input json.RawMessage) (string, error) {
+	for _, t := range a.tools {
+		if t.Name() != name {
+			continue
+		}
+
+		var args map[string]interface{}
+		if len(input) > 0 {
+			if err := json.Unmarshal(input, &args); err != nil {
+				return "", fmt.Errorf("failed to unmarshal tool arguments: %w", err)
+			}
+		}
+
+		// Never give a tool more time than the run has left
+		timeout := a.toolTimeout
+		if budget, ok := core.RemainingBudget(ctx); ok && budget < timeout {
+			timeout = budget
+		}
+		toolCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		result, err := t.Execute(toolCtx, args)
+		if err != nil {
+			return "", fmt.Errorf("failed to execute tool: %w", err)
+		}
+		resultStr := fmt.Sprintf("%v", result)
+		a.logger.Debug("Tool executed",
+			"tool", name,
+			"result", resultStr)
+		return resultStr, nil
+	}
+
+	a.logger.Warn("Tool not found", "tool", name)
+	return fmt.Sprintf("error: unknown tool %q", name), nil
+}
+
+// Usage returns the token usage accumulated over all of the agent's requests
+func (a *AnthropicAgent) Usage() core.UsageStats {
+	a.usageMu.Lock()
+	defer a.usageMu.Unlock()
+	return a.usage
+}
+
+// recordUsage adds the usage of a request and returns the new totals
+func (a *AnthropicAgent) recordUsage(usage core.Usage) core.UsageStats {
+	a.usageMu.Lock()
+	defer a.usageMu.Unlock()
+	a.usage.Add(usage)
+	return a.usage
+}
+
+// guard runs a request through the agent's circuit breaker, if it has one
+func (a *AnthropicAgent) guard(attempt func(ctx context.Context) error) func(ctx context.Context) error {
+	if a.breaker == nil {
+		return attempt
+	}
+	return func(ctx context.Context) error {
+		err := a.breaker.Do(ctx, attempt)
+		if errors.Is(err, core.ErrCircuitOpen) {
+			return core.NoRetry(err)
+		}
+		return err
+	}
+}
+
+// anthropicRequest is the body of a Messages API request
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    []anthropicBlock   `json:"system,omitempty"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+}
+
+// anthropicCacheControl marks the end of a prefix to cache
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+	TTL  string `json:"ttl,omitempty"`
+}
+
+// anthropicBlock is a content block of a message or the system prompt
+type anthropicBlock struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text,omitempty"`
+	ID           string                 `json:"id,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Input        json.RawMessage        `json:"input,omitempty"`
+	ToolUseID    string                 `json:"tool_use_id,omitempty"`
+	Content      string                 `json:"content,omitempty"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+// anthropicMessage is a message of the conversation
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicTool is a tool definition
+type anthropicTool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	InputSchema  map[string]interface{} `json:"input_schema"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+// toAnthropicMessages converts stored history to messages. The results of
+// the tool calls of an assistant message are answered together in the user
+// message that follows it, as the API requires.
+func toAnthropicMessages(msgs []core.Message) []anthropicMessage {
+	history := make([]anthropicMessage, 0, len(msgs))
+	for _, m := range msgs {
+		switch m.Role {
+		case core.RoleUser:
+			history = append(history, anthropicMessage{
+				Role:    "user",
+				Content: []anthropicBlock{{Type: "text", Text: m.Content}},
+			})
+		case core.RoleAssistant:
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if len(input) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+			history = append(history, anthropicMessage{Role: "assistant", Content: blocks})
+		case core.RoleTool:
+			result := anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}
+			if n := len(history); n > 0 && history[n-1].isToolResults() {
+				history[n-1].Content = append(history[n-1].Content, result)
+				continue
+			}
+			history = append(history, anthropicMessage{Role: "user", Content: []anthropicBlock{result}})
+		}
+	}
+	return history
+}
+
+// fromAnthropicMessages converts messages to the history kept in a memory
+// store, with a tool message for every tool result
+func fromAnthropicMessages(history []anthropicMessage) []core.Message {
+	msgs := make([]core.Message, 0, len(history))
+	for _, m := range history {
+		if m.isToolResults() {
+			for _, block := range m.Content {
+				msgs = append(msgs, core.Message{Role: core.RoleTool, Content: block.Content, ToolCallID: block.ToolUseID})
+			}
+			continue
+		}
+		msg := core.Message{Role: core.Role(m.Role)}
+		for _, block := range m.Content {
+			switch block.Type {
+			case "text":
+				msg.Content += block.Text
+			case "tool_use":
+				msg.ToolCalls = append(msg.ToolCalls, core.ToolCall{
+					ID:       block.ID,
+					Type:     "function",
+					Function: core.ToolCallFunction{Name: block.Name, Arguments: string(block.Input)},
+				})
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// isToolResults reports whether the message answers tool calls
+func (m anthropicMessage) isToolResults() bool {
+	return m.Role == "user" && len(m.Content) > 0 && m.Content[0].Type == "tool_result"
+}
+
+// anthropicResponse is the body of a Messages API response
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	StopReason string           `json:"stop_reason"`
+	Content    []anthropicBlock `json:"content"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+// text joins the text blocks of the response
+func (r anthropicResponse) text() string {
+	var parts []string
+	for _, block := range r.Content {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// anthropicUsage is the token usage of a response. Input tokens don't
+// include those read from or written to the prompt cache.
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// usage converts the usage to the provider-neutral form, whose prompt
+// tokens include the cached ones so that cache hit ratios compare
+func (u anthropicUsage) usage() core.Usage {
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	return core.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
+}
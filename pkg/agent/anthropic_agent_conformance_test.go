@@ -0,0 +1,21 @@
+package agent_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+)
+
+func TestAnthropicAgentConformance(t *testing.T) {
+	agenttest.RunConformance(t, agenttest.Anthropic, func(model http.RoundTripper) agent.Agent {
+		server := httptest.NewServer(modelHandler(model))
+		t.Cleanup(server.Close)
+		target, _ := url.Parse(server.URL)
+		client := &http.Client{Transport: redirectTransport{target: target}}
+		return agent.NewAnthropicAgent("conformance", "key", nil, agent.WithHTTPClient(client))
+	})
+}
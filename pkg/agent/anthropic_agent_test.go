@@ -0,0 +1,180 @@
+package agent_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// anthropicServer answers Messages API requests with the replies in turn
+// and records the requests it got
+type anthropicServer struct {
+	mu       sync.Mutex
+	replies  []string
+	requests []map[string]interface{}
+	headers  []http.Header
+}
+
+func (s *anthropicServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&request)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, request)
+	s.headers = append(s.headers, r.Header.Clone())
+	reply := s.replies[0]
+	s.replies = s.replies[1:]
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, reply)
+}
+
+// newAnthropicAgent creates an agent talking to the server
+func newAnthropicAgent(t *testing.T, s *anthropicServer, config map[string]interface{}, tools ...core.Tool) agent.Agent {
+	t.Helper()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	target, _ := url.Parse(server.URL)
+	client := &http.Client{Transport: redirectTransport{target: target}}
+	a := agent.NewAnthropicAgent("claude", "key", nil, agent.WithHTTPClient(client))
+	if err := a.Configure(config); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	for _, tool := range tools {
+		a.AddTool(tool)
+	}
+	return a
+}
+
+// cacheControls returns the paths of the request's parts carrying a cache
+// breakpoint, with the ttl of each
+func cacheControls(request map[string]interface{}) []string {
+	var marked []string
+	mark := func(path string, part interface{}) {
+		fields, _ := part.(map[string]interface{})
+		if control, ok := fields["cache_control"].(map[string]interface{}); ok {
+			ttl, _ := control["ttl"].(string)
+			marked = append(marked, path+":"+ttl)
+		}
+	}
+	for i, block := range request["system"].([]interface{}) {
+		mark(fmt.Sprintf("system.%d", i), block)
+	}
+	if tools, ok := request["tools"].([]interface{}); ok {
+		for i, tool := range tools {
+			mark(fmt.Sprintf("tools.%d", i), tool)
+		}
+	}
+	for i, m := range request["messages"].([]interface{}) {
+		content, _ := m.(map[string]interface{})["content"].([]interface{})
+		for j, block := range content {
+			mark(fmt.Sprintf("messages.%d.%d", i, j), block)
+		}
+	}
+	return marked
+}
+
+func TestAnthropicAgentMarksCacheBreakpoints(t *testing.T) {
+	s := &anthropicServer{replies: []string{
+		`{"stop_reason":"tool_use","content":[{"type":"tool_use","id":"call_1","name":"lookup","input":{}}],
+		  "usage":{"input_tokens":10,"output_tokens":5,"cache_creation_input_tokens":90}}`,
+		`{"stop_reason":"end_turn","content":[{"type":"text","text":"found it"}],
+		  "usage":{"input_tokens":20,"output_tokens":5,"cache_read_input_tokens":80}}`,
+	}}
+	lookup := newFuncTool("lookup", func(ctx context.Context) (interface{}, error) { return "42", nil })
+	extra := newFuncTool("extra", func(ctx context.Context) (interface{}, error) { return "", nil })
+	a := newAnthropicAgent(t, s, map[string]interface{}{
+		"model":            "claude-test",
+		"system_message":   "You are a librarian.",
+		"prompt_cache_ttl": agent.PromptCacheTTL1h,
+	}, extra, lookup)
+
+	replies, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "find it"})
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if len(replies) != 1 || replies[0].Content != "found it" {
+		t.Errorf("replies = %+v, want the final answer", replies)
+	}
+
+	if got := s.headers[0].Get("X-Api-Key"); got != "key" {
+		t.Errorf("api key header = %q, want key", got)
+	}
+	if got := s.headers[0].Get("Anthropic-Version"); got == "" {
+		t.Error("request lacks the anthropic-version header")
+	}
+	if got := strings.Join(cacheControls(s.requests[0]), ","); got != "system.0:1h,tools.1:1h,messages.0.0:1h" {
+		t.Errorf("first request breakpoints = %s, want the system prompt, last tool and last message", got)
+	}
+	// Only the newest message is marked, earlier ones are read from the cache
+	if got := strings.Join(cacheControls(s.requests[1]), ","); got != "system.0:1h,tools.1:1h,messages.2.0:1h" {
+		t.Errorf("second request breakpoints = %s, want the breakpoint moved to the tool result", got)
+	}
+
+	usage := a.(*agent.AnthropicAgent).Usage()
+	if usage.Requests != 2 || usage.PromptTokens != 200 || usage.CachedTokens != 80 || usage.CacheWriteTokens != 90 {
+		t.Errorf("usage = %+v, want 2 requests of 200 prompt tokens, 80 cached and 90 written", usage)
+	}
+	if ratio := usage.CacheHitRatio(); ratio != 0.4 {
+		t.Errorf("cache hit ratio = %v, want 0.4", ratio)
+	}
+}
+
+func TestAnthropicAgentPromptCacheOff(t *testing.T) {
+	s := &anthropicServer{replies: []string{
+		`{"stop_reason":"end_turn","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":10,"output_tokens":1}}`,
+	}}
+	a := newAnthropicAgent(t, s, map[string]interface{}{
+		"model":          "claude-test",
+		"system_message": "Be brief.",
+		"prompt_cache":   false,
+	})
+	if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hello"}); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if got := cacheControls(s.requests[0]); len(got) != 0 {
+		t.Errorf("breakpoints = %v, want none with prompt caching off", got)
+	}
+}
+
+func TestAnthropicAgentThreadKeepsToolTurns(t *testing.T) {
+	s := &anthropicServer{replies: []string{
+		`{"stop_reason":"tool_use","content":[{"type":"tool_use","id":"call_1","name":"lookup","input":{}},{"type":"tool_use","id":"call_2","name":"lookup","input":{}}]}`,
+		`{"stop_reason":"end_turn","content":[{"type":"text","text":"found both"}]}`,
+		`{"stop_reason":"end_turn","content":[{"type":"text","text":"you're welcome"}]}`,
+	}}
+	lookup := newFuncTool("lookup", func(ctx context.Context) (interface{}, error) { return "42", nil })
+	a := newAnthropicAgent(t, s, map[string]interface{}{"model": "claude-test"}, lookup)
+	ctx := core.WithThreadID(context.Background(), "support")
+
+	for _, content := range []string{"find them", "thanks"} {
+		if _, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: content}); err != nil {
+			t.Fatalf("ProcessMessage: %v", err)
+		}
+	}
+
+	// The thread's history comes back from the memory store in the shape
+	// the API requires, both results answering the calls in one message
+	var turns []string
+	for _, m := range s.requests[2]["messages"].([]interface{}) {
+		msg := m.(map[string]interface{})
+		var types []string
+		for _, block := range msg["content"].([]interface{}) {
+			types = append(types, block.(map[string]interface{})["type"].(string))
+		}
+		turns = append(turns, msg["role"].(string)+":"+strings.Join(types, "+"))
+	}
+	want := "user:text,assistant:tool_use+tool_use,user:tool_result+tool_result,assistant:text,user:text"
+	if got := strings.Join(turns, ","); got != want {
+		t.Errorf("third request messages = %s, want %s", got, want)
+	}
+}
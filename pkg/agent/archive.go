@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrThreadNotArchived is returned when unarchiving a thread that isn't
+	// in the archive
+	ErrThreadNotArchived = errors.New("thread is not archived")
+)
+
+// archiveNamespace is the store namespace archived threads are kept under
+const archiveNamespace = "archived_threads"
+
+// ArchivedThread is the archived history of a thread
+type ArchivedThread struct {
+	ThreadID   string         `json:"thread_id"`
+	Messages   []core.Message `json:"messages"`
+	ArchivedAt time.Time      `json:"archived_at"`
+}
+
+// ArchiveStats counts archived and restored threads
+type ArchiveStats struct {
+	// Archived is the number of threads moved to the archive
+	Archived int64 `json:"archived"`
+
+	// Restored is the number of threads restored from the archive
+	Restored int64 `json:"restored"`
+}
+
+// ThreadArchiver moves threads that have been idle too long out of an
+// in-memory history store into a persistent core.Store, so that live
+// history doesn't grow forever. Unarchive brings a thread back so its
+// conversation can continue.
+type ThreadArchiver struct {
+	live    *InMemoryStore
+	archive core.Store
+	idle    time.Duration
+
+	// Keep reports whether a thread must stay live, for example because its
+	// graph run is waiting on an interrupt. Nil archives every idle thread.
+	Keep func(threadID string) bool
+
+	archived atomic.Int64
+	restored atomic.Int64
+}
+
+// NewThreadArchiver creates an archiver for threads of live that are idle
+// for longer than idle
+func NewThreadArchiver(live *InMemoryStore, archive core.Store, idle time.Duration) *ThreadArchiver {
+	return &ThreadArchiver{
+		live:    live,
+		archive: archive,
+		idle:    idle,
+	}
+}
+
+// ArchiveIdle archives all idle threads and returns how many were archived
+func (a *ThreadArchiver) ArchiveIdle(ctx context.Context) (int, error) {
+	count := 0
+	for _, threadID := range a.live.IdleThreads(a.idle) {
+		if a.Keep != nil && a.Keep(threadID) {
+			continue
+		}
+		data, err := json.Marshal(ArchivedThread{
+			ThreadID:   threadID,
+			Messages:   a.live.Load(threadID),
+			ArchivedAt: time.Now(),
+		})
+		if err != nil {
+			return count, err
+		}
+		if err := a.archive.Put(ctx, archiveNamespace, threadID, data); err != nil {
+			return count, fmt.Errorf("failed to archive thread %s: %w", threadID, err)
+		}
+		a.live.Delete(threadID)
+		a.archived.Add(1)
+		count++
+	}
+	return count, nil
+}
+
+// Unarchive restores the history of an archived thread to the live store
+// and removes it from the archive
+func (a *ThreadArchiver) Unarchive(ctx context.Context, threadID string) error {
+	data, found, err := a.archive.Get(ctx, archiveNamespace, threadID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrThreadNotArchived, threadID)
+	}
+	var thread ArchivedThread
+	if err := json.Unmarshal(data, &thread); err != nil {
+		return fmt.Errorf("failed to decode archived thread %s: %w", threadID, err)
+	}
+
+	a.live.Save(threadID, thread.Messages)
+	if err := a.archive.Delete(ctx, archiveNamespace, threadID); err != nil {
+		return err
+	}
+	a.restored.Add(1)
+	return nil
+}
+
+// Run archives idle threads every interval until ctx is done
+func (a *ThreadArchiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if n, err := a.ArchiveIdle(ctx); err != nil {
+				core.LoggerFromContext(ctx).Error("Failed to archive idle threads", "error", err, "archived", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stats returns the number of threads archived and restored so far
+func (a *ThreadArchiver) Stats() ArchiveStats {
+	return ArchiveStats{
+		Archived: a.archived.Load(),
+		Restored: a.restored.Load(),
+	}
+}
@@ -0,0 +1,48 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func TestArchiveAndUnarchiveIdleThreads(t *testing.T) {
+	ctx := context.Background()
+	live := agent.NewInMemoryStore()
+	history := []core.Message{{Role: core.RoleUser, Content: "hi"}, {Role: core.RoleAssistant, Content: "hello"}}
+	live.Save("idle", history)
+	live.Save("interrupted", history)
+	archiver := agent.NewThreadArchiver(live, core.NewMemoryStore(), 10*time.Millisecond)
+	archiver.Keep = func(threadID string) bool { return threadID == "interrupted" }
+
+	time.Sleep(20 * time.Millisecond)
+	live.Save("active", history)
+
+	n, err := archiver.ArchiveIdle(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("ArchiveIdle = %d, %v, want only the idle thread archived", n, err)
+	}
+	if msgs := live.Load("idle"); len(msgs) != 0 {
+		t.Errorf("archived thread still live: %+v", msgs)
+	}
+	if len(live.Load("interrupted")) != 2 || len(live.Load("active")) != 2 {
+		t.Error("a kept or active thread was archived")
+	}
+
+	if err := archiver.Unarchive(ctx, "idle"); err != nil {
+		t.Fatalf("Unarchive: %v", err)
+	}
+	if msgs := live.Load("idle"); len(msgs) != 2 || msgs[1].Content != "hello" {
+		t.Errorf("restored history = %+v, want the archived one", msgs)
+	}
+	if err := archiver.Unarchive(ctx, "idle"); !errors.Is(err, agent.ErrThreadNotArchived) {
+		t.Errorf("second Unarchive = %v, want ErrThreadNotArchived", err)
+	}
+	if stats := archiver.Stats(); stats.Archived != 1 || stats.Restored != 1 {
+		t.Errorf("stats = %+v, want one archived and one restored", stats)
+	}
+}
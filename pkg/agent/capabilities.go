@@ -0,0 +1,69 @@
+package agent
+
+import "sync"
+
+// Capability is a feature a model may support
+type Capability string
+
+const (
+	// CapabilityTools means the model can call tools
+	CapabilityTools Capability = "tools"
+
+	// CapabilityVision means the model accepts images
+	CapabilityVision Capability = "vision"
+)
+
+var (
+	capabilitiesMu sync.RWMutex
+
+	// modelCapabilities holds the capabilities of known models
+	modelCapabilities = map[string][]Capability{
+		"gpt-4o":        {CapabilityTools, CapabilityVision},
+		"gpt-4o-mini":   {CapabilityTools, CapabilityVision},
+		"gpt-4.1":       {CapabilityTools, CapabilityVision},
+		"gpt-4.1-mini":  {CapabilityTools, CapabilityVision},
+		"gpt-4.1-nano":  {CapabilityTools, CapabilityVision},
+		"gpt-4-turbo":   {CapabilityTools, CapabilityVision},
+		"gpt-4":         {CapabilityTools},
+		"gpt-3.5-turbo": {CapabilityTools},
+		"o1":            {CapabilityTools, CapabilityVision},
+		"o1-mini":       {},
+		"o3-mini":       {CapabilityTools},
+	}
+)
+
+// RegisterModel sets the capabilities of a model, replacing any registered
+// before
+func RegisterModel(model string, capabilities ...Capability) {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+	modelCapabilities[model] = append([]Capability(nil), capabilities...)
+}
+
+// ModelCapabilities returns the capabilities of a model and whether the
+// model is registered
+func ModelCapabilities(model string) ([]Capability, bool) {
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	capabilities, ok := modelCapabilities[model]
+	return append([]Capability(nil), capabilities...), ok
+}
+
+// SupportsAll reports whether the model is registered with all of the
+// capabilities. Unregistered models support nothing.
+func SupportsAll(model string, capabilities ...Capability) bool {
+	supported, _ := ModelCapabilities(model)
+	for _, want := range capabilities {
+		found := false
+		for _, have := range supported {
+			if have == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
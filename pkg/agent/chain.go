@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrEmptyChain is returned when a chain has no agents
+	ErrEmptyChain = errors.New("chain has no agents")
+
+	// ErrEmptyReply is returned when an agent in a chain replies with nothing
+	// the next agent could use as input
+	ErrEmptyReply = errors.New("agent returned no reply")
+)
+
+// chainAgent runs agents one after another
+type chainAgent struct {
+	id     string
+	agents []Agent
+}
+
+// Chain returns an agent that runs the given agents in order. Each agent's
+// last reply is sent to the next agent as a user message, and the replies of
+// all agents are returned together. It is a shortcut for linear pipelines
+// that don't need a graph.
+func Chain(agents ...Agent) Agent {
+	ids := make([]string, len(agents))
+	for i, a := range agents {
+		ids[i] = a.ID()
+	}
+
+	return &chainAgent{
+		id:     "chain(" + strings.Join(ids, ",") + ")",
+		agents: agents,
+	}
+}
+
+func (c *chainAgent) ID() string {
+	return c.id
+}
+
+// Configure applies the config to every agent in the chain
+func (c *chainAgent) Configure(config map[string]interface{}) error {
+	for _, a := range c.agents {
+		if err := a.Configure(config); err != nil {
+			return fmt.Errorf("agent %s: %w", a.ID(), err)
+		}
+	}
+	return nil
+}
+
+// AddTool adds the tool to every agent in the chain
+func (c *chainAgent) AddTool(tool core.Tool) {
+	for _, a := range c.agents {
+		a.AddTool(tool)
+	}
+}
+
+func (c *chainAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	if len(c.agents) == 0 {
+		return nil, ErrEmptyChain
+	}
+
+	var replies []core.Message
+	input := msg
+	for _, a := range c.agents {
+		if err := ctx.Err(); err != nil {
+			return replies, err
+		}
+
+		responses, err := a.ProcessMessage(ctx, input)
+		if err != nil {
+			return replies, fmt.Errorf("agent %s: %w", a.ID(), err)
+		}
+		replies = append(replies, responses...)
+
+		last, ok := lastReply(responses)
+		if !ok {
+			return replies, fmt.Errorf("%w: %s", ErrEmptyReply, a.ID())
+		}
+		metadata := last.Metadata
+		if metadata == nil {
+			metadata = input.Metadata
+		}
+		input = core.Message{
+			Role:     core.RoleUser,
+			Content:  last.Content,
+			Metadata: metadata,
+		}
+	}
+
+	return replies, nil
+}
+
+// lastReply returns the last message with content, skipping tool calls and
+// empty messages
+func lastReply(responses []core.Message) (core.Message, bool) {
+	for i := len(responses) - 1; i >= 0; i-- {
+		if strings.TrimSpace(responses[i].Content) != "" {
+			return responses[i], true
+		}
+	}
+	return core.Message{}, false
+}
@@ -0,0 +1,70 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// stubAgent replies with what its function makes of the message
+type stubAgent struct {
+	id    string
+	reply func(msg core.Message) ([]core.Message, error)
+}
+
+func (a *stubAgent) ID() string                                    { return a.id }
+func (a *stubAgent) Configure(config map[string]interface{}) error { return nil }
+func (a *stubAgent) AddTool(tool core.Tool)                        {}
+
+func (a *stubAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	return a.reply(msg)
+}
+
+// appending returns an agent answering with the input and its suffix
+func appending(id, suffix string) *stubAgent {
+	return &stubAgent{id: id, reply: func(msg core.Message) ([]core.Message, error) {
+		return []core.Message{{Role: core.RoleAssistant, Content: msg.Content + suffix}}, nil
+	}}
+}
+
+func TestChainOfThreeAgents(t *testing.T) {
+	chain := agent.Chain(appending("a", " A"), appending("b", " B"), appending("c", " C"))
+
+	replies, err := chain.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "in"})
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	var contents []string
+	for _, r := range replies {
+		contents = append(contents, r.Content)
+	}
+	if got := strings.Join(contents, "|"); got != "in A|in A B|in A B C" {
+		t.Errorf("replies = %s, want every agent fed the previous reply", got)
+	}
+}
+
+func TestChainErrors(t *testing.T) {
+	ctx := context.Background()
+	msg := core.Message{Role: core.RoleUser, Content: "in"}
+	boom := errors.New("boom")
+	failing := &stubAgent{id: "failing", reply: func(core.Message) ([]core.Message, error) { return nil, boom }}
+	silent := &stubAgent{id: "silent", reply: func(core.Message) ([]core.Message, error) { return nil, nil }}
+
+	if _, err := agent.Chain().ProcessMessage(ctx, msg); !errors.Is(err, agent.ErrEmptyChain) {
+		t.Errorf("empty chain = %v, want ErrEmptyChain", err)
+	}
+	replies, err := agent.Chain(appending("a", " A"), failing, appending("c", " C")).ProcessMessage(ctx, msg)
+	if !errors.Is(err, boom) || !strings.Contains(err.Error(), "failing") {
+		t.Errorf("failing agent = %v, want boom naming the agent", err)
+	}
+	if len(replies) != 1 {
+		t.Errorf("replies before the failure = %v, want the first agent's", replies)
+	}
+	if _, err := agent.Chain(silent, appending("c", " C")).ProcessMessage(ctx, msg); !errors.Is(err, agent.ErrEmptyReply) || !strings.Contains(err.Error(), "silent") {
+		t.Errorf("empty reply = %v, want ErrEmptyReply naming the agent", err)
+	}
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// RequestHook receives every chat completion request exactly as it is sent,
+// including the system message, history and tools
+type RequestHook func(ctx context.Context, params openai.ChatCompletionNewParams)
+
+// ResponseHook receives every chat completion once its stream was read,
+// assembled from the streamed chunks
+type ResponseHook func(ctx context.Context, completion openai.ChatCompletion)
+
+// WithRequestHook calls hook before every completion request, including
+// retries and requests to fallback models
+func WithRequestHook(hook RequestHook) Option {
+	return func(o *agentOptions) {
+		o.requestHook = hook
+	}
+}
+
+// WithResponseHook calls hook with every completion received
+func WithResponseHook(hook ResponseHook) Option {
+	return func(o *agentOptions) {
+		o.responseHook = hook
+	}
+}
+
+// debugPayloadsKey marks the contexts of requests whose payloads are logged
+type debugPayloadsKey struct{}
+
+// redactedHeaders are the request headers whose values are never logged
+var redactedHeaders = []string{"Authorization", "Api-Key", "Openai-Organization", "Openai-Project"}
+
+// observeRequest passes a request to the request hook and, with
+// debug_payloads set, logs it at debug level
+func (a *OpenAIAgent) observeRequest(ctx context.Context, params openai.ChatCompletionNewParams, debug bool) {
+	if a.requestHook != nil {
+		a.requestHook(ctx, params)
+	}
+	if debug {
+		payload, err := json.Marshal(params)
+		if err != nil {
+			a.logger.Debug("Completion request not serializable", "error", err)
+			return
+		}
+		a.logger.Debug("Completion request", "payload", string(payload))
+	}
+}
+
+// observeResponse passes a completion to the response hook and, with
+// debug_payloads set, logs it at debug level
+func (a *OpenAIAgent) observeResponse(ctx context.Context, completion openai.ChatCompletion, debug bool) {
+	if a.responseHook != nil {
+		a.responseHook(ctx, completion)
+	}
+	if debug {
+		payload, err := json.Marshal(completion)
+		if err != nil {
+			a.logger.Debug("Completion response not serializable", "error", err)
+			return
+		}
+		a.logger.Debug("Completion response", "payload", string(payload))
+	}
+}
+
+// debugMiddleware logs the HTTP exchange of requests made with
+// debug_payloads set, with credentials redacted from the headers. Bodies
+// are streamed and logged by observeRequest and observeResponse instead.
+func debugMiddleware(logger core.Logger) option.Middleware {
+	return func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		if debug, _ := req.Context().Value(debugPayloadsKey{}).(bool); !debug {
+			return next(req)
+		}
+		logger.Debug("Completion HTTP request",
+			"method", req.Method,
+			"url", req.URL.String(),
+			"headers", redactHeaders(req.Header))
+		resp, err := next(req)
+		if err != nil {
+			logger.Debug("Completion HTTP request failed", "error", err)
+			return resp, err
+		}
+		logger.Debug("Completion HTTP response",
+			"status", resp.StatusCode,
+			"headers", redactHeaders(resp.Header))
+		return resp, nil
+	}
+}
+
+// redactHeaders flattens headers for logging, hiding credentials
+func redactHeaders(header http.Header) map[string]string {
+	out := make(map[string]string, len(header))
+	for key, values := range header {
+		out[key] = strings.Join(values, ", ")
+	}
+	for _, key := range redactedHeaders {
+		if _, ok := out[key]; ok {
+			out[key] = "[REDACTED]"
+		}
+	}
+	return out
+}
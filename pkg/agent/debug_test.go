@@ -0,0 +1,120 @@
+package agent_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/openai/openai-go"
+)
+
+// lineLogger keeps every line logged, with its fields formatted
+type lineLogger struct {
+	mu     *sync.Mutex
+	lines  *[]string
+	fields []interface{}
+}
+
+func newLineLogger() *lineLogger {
+	return &lineLogger{mu: &sync.Mutex{}, lines: &[]string{}}
+}
+
+func (l *lineLogger) Debug(msg string, kv ...interface{}) { l.add(msg, kv) }
+func (l *lineLogger) Info(msg string, kv ...interface{})  { l.add(msg, kv) }
+func (l *lineLogger) Warn(msg string, kv ...interface{})  { l.add(msg, kv) }
+func (l *lineLogger) Error(msg string, kv ...interface{}) { l.add(msg, kv) }
+
+func (l *lineLogger) With(kv ...interface{}) core.Logger {
+	return &lineLogger{mu: l.mu, lines: l.lines, fields: append(append([]interface{}(nil), l.fields...), kv...)}
+}
+
+func (l *lineLogger) add(msg string, kv []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.lines = append(*l.lines, msg+" "+fmt.Sprint(append(append([]interface{}(nil), l.fields...), kv...)...))
+}
+
+// find returns the first line starting with the message
+func (l *lineLogger) find(msg string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range *l.lines {
+		if strings.HasPrefix(line, msg+" ") {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestRequestHookSeesAssembledParams(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "sunny"})
+	var requests []openai.ChatCompletionNewParams
+	var responses []openai.ChatCompletion
+	a := agent.NewOpenAIAgent("test", "key", nil,
+		agent.WithHTTPClient(&http.Client{Transport: fake}),
+		agent.WithRequestHook(func(ctx context.Context, params openai.ChatCompletionNewParams) {
+			requests = append(requests, params)
+		}),
+		agent.WithResponseHook(func(ctx context.Context, completion openai.ChatCompletion) {
+			responses = append(responses, completion)
+		}))
+	if err := a.Configure(map[string]interface{}{"model": "fake", "system_message": "Be brief."}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	a.AddTool(newFuncTool("weather", func(ctx context.Context) (interface{}, error) { return "sunny", nil }))
+
+	if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "weather?"}); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if len(requests) != 1 || len(responses) != 1 {
+		t.Fatalf("hooks saw %d requests and %d responses, want one each", len(requests), len(responses))
+	}
+	params := requests[0]
+	if params.Model.Value != "fake" {
+		t.Errorf("model = %q, want fake", params.Model.Value)
+	}
+	if n := len(params.Messages.Value); n != 2 {
+		t.Errorf("request has %d messages, want the system message and the user's", n)
+	}
+	if tools := params.Tools.Value; len(tools) != 1 || tools[0].Function.Value.Name.Value != "weather" {
+		t.Errorf("tools = %+v, want weather", tools)
+	}
+	if got := responses[0].Choices[0].Message.Content; got != "sunny" {
+		t.Errorf("response content = %q, want the assembled reply", got)
+	}
+}
+
+func TestDebugPayloadsRedactCredentials(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "hi"})
+	logger := newLineLogger()
+	a := agent.NewOpenAIAgent("test", "sk-secret", logger, agent.WithHTTPClient(&http.Client{Transport: fake}))
+	if err := a.Configure(map[string]interface{}{"model": "fake", "debug_payloads": true}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hello"}); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+
+	request := logger.find("Completion request")
+	if !strings.Contains(request, `"hello"`) {
+		t.Errorf("logged request = %q, want the payload with the user's message", request)
+	}
+	if response := logger.find("Completion response"); !strings.Contains(response, `"hi"`) {
+		t.Errorf("logged response = %q, want the assembled reply", response)
+	}
+	headers := logger.find("Completion HTTP request")
+	if !strings.Contains(headers, "Authorization:[REDACTED]") {
+		t.Errorf("logged headers = %q, want Authorization redacted", headers)
+	}
+	for _, line := range *logger.lines {
+		if strings.Contains(line, "sk-secret") {
+			t.Errorf("the API key was logged: %q", line)
+		}
+	}
+}
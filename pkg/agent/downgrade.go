@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// EventModelDowngrade is emitted when an agent switches to a cheaper model
+// because the run's token budget is running low
+const EventModelDowngrade core.EventType = "on_model_downgrade"
+
+// Middleware wraps an agent with additional behavior
+type Middleware func(Agent) Agent
+
+// DowngradeRule switches an agent to another model once the run has
+// RemainingTokens or fewer tokens left
+type DowngradeRule struct {
+	// RemainingTokens is the remaining budget at or below which the rule applies
+	RemainingTokens int
+
+	// Model is the model to switch to
+	Model string
+
+	// Require lists capabilities the model must have besides those the agent
+	// uses, such as CapabilityVision for agents that are sent images
+	Require []Capability
+}
+
+// downgradeAgent switches the model of the wrapped agent as the budget runs out
+type downgradeAgent struct {
+	Agent
+	rules    []DowngradeRule
+	hasTools bool
+}
+
+// AutoDowngrade returns a middleware that switches the agent to cheaper
+// models as the token budget of the run runs low, so a run finishes with a
+// weaker model rather than failing. Of the rules whose threshold has been
+// reached the one with the lowest threshold wins, skipping models that lack
+// a capability the agent needs: tools when it has any, plus those the rule
+// requires. The switch lasts for the rest of the run, since the budget only
+// shrinks. Runs without a token budget are never downgraded.
+//
+// The model is switched through a configuration override for the agent's
+// ID, so the wrapped agent must honor overrides like OpenAIAgent does.
+func AutoDowngrade(rules []DowngradeRule) Middleware {
+	sorted := append([]DowngradeRule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].RemainingTokens < sorted[j].RemainingTokens
+	})
+
+	return func(a Agent) Agent {
+		return &downgradeAgent{Agent: a, rules: sorted}
+	}
+}
+
+func (d *downgradeAgent) AddTool(tool core.Tool) {
+	d.hasTools = true
+	d.Agent.AddTool(tool)
+}
+
+func (d *downgradeAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	budget := core.TokenBudgetFromContext(ctx)
+	if budget == nil {
+		return d.Agent.ProcessMessage(ctx, msg)
+	}
+
+	from := d.currentModel(ctx)
+	remaining := budget.Remaining()
+	rule, ok := d.ruleFor(remaining, from)
+	if !ok {
+		return d.Agent.ProcessMessage(ctx, msg)
+	}
+
+	if budget.RecordDowngrade(d.ID(), rule.Model) {
+		core.LoggerFromContext(ctx).Info("Downgrading model",
+			"agent_id", d.ID(),
+			"from", from,
+			"to", rule.Model,
+			"remaining_tokens", remaining)
+		core.EmitEvent(ctx, core.Event{
+			Type:      EventModelDowngrade,
+			Name:      d.ID(),
+			Timestamp: time.Now(),
+			Metadata: map[string]interface{}{
+				"from":             from,
+				"to":               rule.Model,
+				"remaining_tokens": remaining,
+			},
+		})
+	}
+
+	ctx = core.WithAgentOverride(ctx, d.ID(), map[string]interface{}{"model": rule.Model})
+	replies, err := d.Agent.ProcessMessage(ctx, msg)
+	for i := range replies {
+		metadata := make(map[string]interface{}, len(replies[i].Metadata)+2)
+		for k, v := range replies[i].Metadata {
+			metadata[k] = v
+		}
+		metadata["model"] = rule.Model
+		metadata["downgraded_from"] = from
+		replies[i].Metadata = metadata
+	}
+	return replies, err
+}
+
+// ruleFor returns the rule to apply with remaining tokens left
+func (d *downgradeAgent) ruleFor(remaining int, current string) (DowngradeRule, bool) {
+	required := d.requiredCapabilities()
+	for _, rule := range d.rules {
+		if remaining > rule.RemainingTokens {
+			continue
+		}
+		if rule.Model == "" || rule.Model == current {
+			continue
+		}
+		if SupportsAll(rule.Model, append(required, rule.Require...)...) {
+			return rule, true
+		}
+	}
+	return DowngradeRule{}, false
+}
+
+// requiredCapabilities returns the capabilities the agent uses
+func (d *downgradeAgent) requiredCapabilities() []Capability {
+	hasTools := d.hasTools
+	if t, ok := d.Agent.(interface{ Tools() []core.Tool }); ok && len(t.Tools()) > 0 {
+		hasTools = true
+	}
+	if hasTools {
+		return []Capability{CapabilityTools}
+	}
+	return nil
+}
+
+// currentModel returns the model the agent would use without a downgrade
+func (d *downgradeAgent) currentModel(ctx context.Context) string {
+	if model, ok := core.AgentConfigFromContext(ctx, d.ID())["model"].(string); ok {
+		return model
+	}
+	if m, ok := d.Agent.(interface{ Model() string }); ok {
+		return m.Model()
+	}
+	return ""
+}
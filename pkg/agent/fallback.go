@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/openai/openai-go"
+)
+
+// EventModelFallback is emitted when an agent gives up on a model and tries
+// the next one of its model_fallback list
+const EventModelFallback core.EventType = "on_model_fallback"
+
+// ShouldFallback reports whether a failed completion is worth trying on
+// another model: the model is rate limited, overloaded, failing, timing out,
+// unknown or deprecated, or the connection to it failed. Bad requests,
+// rejected credentials and cancellation are fatal, since another model
+// wouldn't fare better.
+func ShouldFallback(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrUnauthorized) {
+		return false
+	}
+
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound, http.StatusRequestTimeout, http.StatusConflict, http.StatusGone, http.StatusTooManyRequests:
+			return true
+		}
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, core.ErrCircuitOpen)
+}
+
+// parseModels reads a list of model names from configuration, given as
+// []string or, when decoded from JSON, []interface{}
+func parseModels(raw interface{}) ([]string, error) {
+	var models []string
+	switch v := raw.(type) {
+	case []string:
+		models = append(models, v...)
+	case []interface{}:
+		for _, item := range v {
+			model, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", item)
+			}
+			models = append(models, model)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %T", raw)
+	}
+	for _, model := range models {
+		if model == "" {
+			return nil, fmt.Errorf("model names must not be empty")
+		}
+	}
+	return models, nil
+}
@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// languageNames names the languages of common locales in English, which
+// models follow more reliably than bare locale codes
+var languageNames = map[string]string{
+	"ar": "Arabic",
+	"de": "German",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"tr": "Turkish",
+	"zh": "Chinese",
+}
+
+// localeInstruction asks the model to respond in the language of a locale.
+// The full locale is kept so regional conventions, such as de-AT, carry over.
+func localeInstruction(locale string) string {
+	language, _, _ := strings.Cut(locale, "-")
+	if name, ok := languageNames[strings.ToLower(language)]; ok {
+		return fmt.Sprintf("Always respond in %s (locale %s), whatever language the request is written in.", name, locale)
+	}
+	return fmt.Sprintf("Always respond in the language of locale %s, whatever language the request is written in.", locale)
+}
@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/openai/openai-go"
+)
+
+// MemoryStore holds conversation history per thread, so that a conversation
+// outlives the agent instance handling it. Agents use it for requests whose
+// context carries a thread ID (see core.WithThreadID).
+type MemoryStore interface {
+	// Load returns the history of the thread, which is empty for a new thread
+	Load(threadID string) []core.Message
+
+	// Save replaces the history of the thread
+	Save(threadID string, msgs []core.Message)
+}
+
+// InMemoryStore is a MemoryStore that keeps history in process memory
+type InMemoryStore struct {
+	mu      sync.Mutex
+	threads map[string][]core.Message
+
+	// lastUsed is when each thread was last loaded or saved
+	lastUsed map[string]time.Time
+}
+
+// NewInMemoryStore creates an empty in-memory history store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		threads:  make(map[string][]core.Message),
+		lastUsed: make(map[string]time.Time),
+	}
+}
+
+// Load returns a copy of the history of the thread
+func (s *InMemoryStore) Load(threadID string) []core.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.threads[threadID]; ok {
+		s.lastUsed[threadID] = time.Now()
+	}
+	return append([]core.Message(nil), s.threads[threadID]...)
+}
+
+// Save replaces the history of the thread
+func (s *InMemoryStore) Save(threadID string, msgs []core.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.threads[threadID] = append([]core.Message(nil), msgs...)
+	s.lastUsed[threadID] = time.Now()
+}
+
+// Delete removes the history of the thread
+func (s *InMemoryStore) Delete(threadID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.threads, threadID)
+	delete(s.lastUsed, threadID)
+}
+
+// IdleThreads returns the threads that haven't been used for longer than idle
+func (s *InMemoryStore) IdleThreads(idle time.Duration) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := time.Now().Add(-idle)
+	var ids []string
+	for id, used := range s.lastUsed {
+		if used.Before(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// WithMemoryStore makes the agent keep thread history in store. Agents
+// sharing a store continue each other's conversations on the same thread.
+// By default each agent has its own in-memory store. Agents running inside
+// a graph should share the graph's core.ThreadStore, which saves history
+// together with the graph state.
+func WithMemoryStore(store MemoryStore) Option {
+	return func(o *agentOptions) {
+		o.memory = store
+	}
+}
+
+// memoryStore returns the configured memory store or a new in-memory one
+func (o agentOptions) memoryStore() MemoryStore {
+	if o.memory == nil {
+		return NewInMemoryStore()
+	}
+	return o.memory
+}
+
+// historyMessage is a history entry in the chat completions wire format
+type historyMessage struct {
+	Role       core.Role       `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	Name       string          `json:"name"`
+	ToolCalls  []core.ToolCall `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+}
+
+// fromParams converts the agent's history to messages for a memory store
+func fromParams(history []openai.ChatCompletionMessageParamUnion) ([]core.Message, error) {
+	msgs := make([]core.Message, 0, len(history))
+	for _, param := range history {
+		data, err := json.Marshal(param)
+		if err != nil {
+			return nil, err
+		}
+		var m historyMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		content, err := contentText(m.Content)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, core.Message{
+			Role:       m.Role,
+			Content:    content,
+			Name:       m.Name,
+			ToolCalls:  m.ToolCalls,
+			ToolCallID: m.ToolCallID,
+		})
+	}
+	return msgs, nil
+}
+
+// contentText flattens message content, which is either a string or a list
+// of text parts
+func contentText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("unsupported message content: %w", err)
+	}
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(part.Text)
+	}
+	return b.String(), nil
+}
+
+// toParams converts messages from a memory store to the agent's history
+func toParams(msgs []core.Message) ([]openai.ChatCompletionMessageParamUnion, error) {
+	history := make([]openai.ChatCompletionMessageParamUnion, 0, len(msgs))
+	for _, m := range msgs {
+		switch m.Role {
+		case core.RoleSystem:
+			history = append(history, openai.SystemMessage(m.Content))
+		case core.RoleUser:
+			history = append(history, openai.UserMessage(m.Content))
+		case core.RoleAssistant:
+			param := openai.ChatCompletionAssistantMessageParam{
+				Role: openai.F(openai.ChatCompletionAssistantMessageParamRoleAssistant),
+			}
+			if m.Content != "" {
+				param = openai.AssistantMessage(m.Content)
+			}
+			if len(m.ToolCalls) > 0 {
+				calls := make([]openai.ChatCompletionMessageToolCallParam, len(m.ToolCalls))
+				for i, call := range m.ToolCalls {
+					calls[i] = openai.ChatCompletionMessageToolCallParam{
+						ID:   openai.F(call.ID),
+						Type: openai.F(openai.ChatCompletionMessageToolCallTypeFunction),
+						Function: openai.F(openai.ChatCompletionMessageToolCallFunctionParam{
+							Name:      openai.F(call.Function.Name),
+							Arguments: openai.F(call.Function.Arguments),
+						}),
+					}
+				}
+				param.ToolCalls = openai.F(calls)
+			}
+			history = append(history, param)
+		case core.RoleTool:
+			history = append(history, openai.ToolMessage(m.ToolCallID, m.Content))
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", m.Role)
+		}
+	}
+	return history, nil
+}
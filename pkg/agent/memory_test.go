@@ -0,0 +1,64 @@
+package agent_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// requestTexts returns the role and text of every message of a request
+func requestTexts(request map[string]interface{}) []string {
+	messages, _ := request["messages"].([]interface{})
+	var texts []string
+	for _, m := range messages {
+		msg, _ := m.(map[string]interface{})
+		role, _ := msg["role"].(string)
+		texts = append(texts, role+": "+messageText(msg))
+	}
+	return texts
+}
+
+func TestAgentsSharingMemoryStore(t *testing.T) {
+	fake := agenttest.NewFakeModel(
+		agenttest.FakeReply{Content: "Nice to meet you, Ada"},
+		agenttest.FakeReply{Content: "You're Ada"},
+		agenttest.FakeReply{Content: "I don't know"},
+	)
+	store := agent.NewInMemoryStore()
+	newAgent := func(opts ...agent.Option) agent.Agent {
+		opts = append(opts, agent.WithHTTPClient(&http.Client{Transport: fake}))
+		a := agent.NewOpenAIAgent("test", "key", nil, opts...)
+		if err := a.Configure(map[string]interface{}{"model": "fake"}); err != nil {
+			t.Fatalf("Configure: %v", err)
+		}
+		return a
+	}
+	ctx := core.WithThreadID(context.Background(), "thread-1")
+
+	if _, err := newAgent(agent.WithMemoryStore(store)).ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "I'm Ada"}); err != nil {
+		t.Fatalf("first agent: %v", err)
+	}
+	if _, err := newAgent(agent.WithMemoryStore(store)).ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "Who am I?"}); err != nil {
+		t.Fatalf("second agent: %v", err)
+	}
+	want := []string{"user: I'm Ada", "assistant: Nice to meet you, Ada", "user: Who am I?"}
+	if got := requestTexts(fake.Requests()[1]); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("second agent sent %q, want the first agent's turn before its own %q", got, want)
+	}
+	if saved := store.Load("thread-1"); len(saved) != 4 || saved[3].Content != "You're Ada" {
+		t.Errorf("saved history = %+v, want both turns", saved)
+	}
+
+	// An agent with its own store starts the thread afresh
+	if _, err := newAgent().ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "Who am I?"}); err != nil {
+		t.Fatalf("third agent: %v", err)
+	}
+	if got := requestTexts(fake.Requests()[2]); strings.Join(got, "|") != "user: Who am I?" {
+		t.Errorf("agent with its own store sent %q, want only its message", got)
+	}
+}
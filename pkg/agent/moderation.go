@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
+)
+
+var (
+	// ErrContentFlagged is matched by errors returned for content a
+	// moderator flagged
+	ErrContentFlagged = errors.New("content flagged by moderation")
+)
+
+// Policies for content a moderator flags
+const (
+	ModerationReject  = "reject"
+	ModerationReplace = "replace"
+)
+
+// Directions of moderated content
+const (
+	ModerationInbound  = "inbound"
+	ModerationOutbound = "outbound"
+)
+
+// defaultModerationReplacement is the reply used for flagged content under
+// the replace policy when no moderation_replacement is configured
+const defaultModerationReplacement = "Sorry, I can't help with that."
+
+// Moderator checks content before it is sent to or returned from a model
+type Moderator interface {
+	// Check reports whether the text is flagged and in which categories
+	Check(ctx context.Context, text string) (flagged bool, categories []string, err error)
+}
+
+// ModerationError is returned for flagged content under the reject policy
+type ModerationError struct {
+	// Direction is ModerationInbound for user content and
+	// ModerationOutbound for model output
+	Direction string
+
+	// Categories are the categories the content was flagged in
+	Categories []string
+}
+
+func (e *ModerationError) Error() string {
+	return fmt.Sprintf("%s content flagged by moderation: %s", e.Direction, strings.Join(e.Categories, ", "))
+}
+
+// Is makes errors.Is match ErrContentFlagged
+func (e *ModerationError) Is(target error) bool {
+	return target == ErrContentFlagged
+}
+
+// OpenAIModerator checks content with the OpenAI moderation endpoint
+type OpenAIModerator struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAIModerator creates a moderator using the given moderation model.
+// An empty model uses the endpoint's default.
+func NewOpenAIModerator(apiKey, model string, opts ...Option) *OpenAIModerator {
+	var o agentOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	requestOptions := []option.RequestOption{option.WithAPIKey(apiKey)}
+	if o.httpClient != nil {
+		requestOptions = append(requestOptions, option.WithHTTPClient(o.httpClient))
+	}
+	return &OpenAIModerator{
+		client: openai.NewClient(requestOptions...),
+		model:  model,
+	}
+}
+
+// Check sends the text to the moderation endpoint
+func (m *OpenAIModerator) Check(ctx context.Context, text string) (bool, []string, error) {
+	params := openai.ModerationNewParams{
+		Input: openai.F[openai.ModerationNewParamsInputUnion](shared.UnionString(text)),
+	}
+	if m.model != "" {
+		params.Model = openai.F(openai.ModerationModel(m.model))
+	}
+
+	resp, err := m.client.Moderations.New(ctx, params)
+	if err != nil {
+		return false, nil, err
+	}
+
+	flagged := false
+	var categories []string
+	for _, result := range resp.Results {
+		if !result.Flagged {
+			continue
+		}
+		flagged = true
+
+		data, err := json.Marshal(result.Categories)
+		if err != nil {
+			return false, nil, err
+		}
+		var byName map[string]bool
+		if err := json.Unmarshal(data, &byName); err != nil {
+			return false, nil, err
+		}
+		for name, on := range byName {
+			if on {
+				categories = append(categories, name)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return flagged, categories, nil
+}
@@ -0,0 +1,145 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// phraseModerator flags text containing its phrase
+type phraseModerator struct {
+	phrase string
+}
+
+func (m phraseModerator) Check(ctx context.Context, text string) (bool, []string, error) {
+	if strings.Contains(text, m.phrase) {
+		return true, []string{"harassment"}, nil
+	}
+	return false, nil, nil
+}
+
+// moderatedAgent creates an agent talking to the fake model, moderated by
+// a phraseModerator under the policy
+func moderatedAgent(t *testing.T, fake *agenttest.FakeModel, policy string) agent.Agent {
+	t.Helper()
+	a := newTestAgent(t, fake)
+	if err := a.Configure(map[string]interface{}{
+		"model":             "fake",
+		"moderator":         phraseModerator{phrase: "rude words"},
+		"moderation_policy": policy,
+	}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	return a
+}
+
+func TestModerationRejectsFlaggedContent(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "some rude words back"})
+	a := moderatedAgent(t, fake, agent.ModerationReject)
+
+	_, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hello, rude words"})
+	var flagged *agent.ModerationError
+	if !errors.As(err, &flagged) || flagged.Direction != agent.ModerationInbound || !errors.Is(err, agent.ErrContentFlagged) {
+		t.Fatalf("inbound = %v, want an inbound ModerationError", err)
+	}
+	if len(fake.Requests()) != 0 {
+		t.Error("flagged user content was sent to the model")
+	}
+
+	_, err = a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hello"})
+	if !errors.As(err, &flagged) || flagged.Direction != agent.ModerationOutbound || flagged.Categories[0] != "harassment" {
+		t.Errorf("outbound = %v, want an outbound ModerationError", err)
+	}
+}
+
+func TestModerationReplacesFlaggedContent(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "some rude words back"})
+	a := moderatedAgent(t, fake, agent.ModerationReplace)
+
+	replies, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hello"})
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if len(replies) != 1 || strings.Contains(replies[0].Content, "rude words") || replies[0].Metadata["moderation"] == nil {
+		t.Errorf("replies = %+v, want the safe replacement", replies)
+	}
+}
+
+func TestModerationReplacedReplyNotKept(t *testing.T) {
+	fake := agenttest.NewFakeModel(
+		agenttest.FakeReply{Content: "some rude words back"},
+		agenttest.FakeReply{Content: "some rude words again"},
+		agenttest.FakeReply{Content: "sorry"},
+	)
+	store := agent.NewInMemoryStore()
+	a := agent.NewOpenAIAgent("test", "key", nil, agent.WithHTTPClient(&http.Client{Transport: fake}), agent.WithMemoryStore(store))
+	if err := a.Configure(map[string]interface{}{
+		"model":             "fake",
+		"moderator":         phraseModerator{phrase: "rude words"},
+		"moderation_policy": agent.ModerationReplace,
+	}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	// A thread saves its history to the store
+	ctx := core.WithThreadID(context.Background(), "support")
+	if _, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "hello"}); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	for _, m := range store.Load("support") {
+		if strings.Contains(m.Content, "rude words") {
+			t.Errorf("thread history keeps the flagged reply: %+v", m)
+		}
+	}
+
+	// Requests without a thread continue the agent's own history
+	for _, content := range []string{"hello", "are you there?"} {
+		if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: content}); err != nil {
+			t.Fatalf("ProcessMessage: %v", err)
+		}
+	}
+	requests := fake.Requests()
+	if got := strings.Join(requestTexts(requests[len(requests)-1]), " | "); strings.Contains(got, "rude words") {
+		t.Errorf("last request = %s, want the flagged reply replaced", got)
+	}
+}
+
+func TestOpenAIModeratorCategories(t *testing.T) {
+	var sent string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		sent = string(body)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body: io.NopCloser(strings.NewReader(`{"id":"modr-1","model":"omni-moderation-latest","results":[
+				{"flagged":true,"categories":{"violence":true,"harassment":true,"sexual":false}}]}`)),
+		}, nil
+	})}
+	moderator := agent.NewOpenAIModerator("key", "omni-moderation-latest", agent.WithHTTPClient(client))
+
+	flagged, categories, err := moderator.Check(context.Background(), "rude words")
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if !flagged || strings.Join(categories, ",") != "harassment,violence" {
+		t.Errorf("Check = %v, %v, want flagged for harassment and violence", flagged, categories)
+	}
+	if !strings.Contains(sent, `"rude words"`) || !strings.Contains(sent, "omni-moderation-latest") {
+		t.Errorf("request = %s, want the text and model", sent)
+	}
+}
+
+// roundTripFunc is an HTTP transport running a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
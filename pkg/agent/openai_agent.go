@@ -3,36 +3,174 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/forrestdevs/moego/pkg/core"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go/shared"
-	"go.uber.org/zap"
 )
 
+var (
+	// ErrToolChoiceMismatch is returned when tool_choice forces a tool call
+	// but the model replies with content or calls a different tool
+	ErrToolChoiceMismatch = errors.New("model did not call the required tool")
+
+	// ErrInvalidToolName is returned when a tool's name isn't accepted by the
+	// OpenAI API
+	ErrInvalidToolName = errors.New("invalid tool name")
+
+	// ErrUnauthorized is matched by errors returned when the model provider
+	// rejects the agent's credentials
+	ErrUnauthorized = errors.New("model provider rejected credentials")
+)
+
+// toolNamePattern is the pattern OpenAI requires function names to match
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ValidateToolName checks a tool name against OpenAI's naming constraints:
+// 1 to 64 letters, digits, underscores and dashes
+func ValidateToolName(name string) error {
+	if !toolNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q must be 1 to 64 letters, digits, underscores or dashes", ErrInvalidToolName, name)
+	}
+	return nil
+}
+
+// Policies for a reply that doesn't honor a forced tool_choice
+const (
+	MismatchError       = "error"
+	MismatchReprompt    = "reprompt"
+	MismatchPassThrough = "pass_through"
+)
+
+// maxToolChoiceReprompts bounds how often the model is asked again to call the required tool
+const maxToolChoiceReprompts = 2
+
 type OpenAIAgent struct {
 	id      string
 	client  *openai.Client
-	logger  *zap.Logger
+	logger  core.Logger
 	config  map[string]interface{}
 	tools   []core.Tool
 	history []openai.ChatCompletionMessageParamUnion
+
+	// toolTimeout bounds each individual tool execution
+	toolTimeout time.Duration
+
+	// resultTransformer is applied to every tool result before it is added to history
+	resultTransformer core.ResultTransformer
+
+	// retryPolicy retries failed completion requests
+	retryPolicy core.RetryPolicy
+
+	// propagateMetadata are the request metadata keys copied to replies and events
+	propagateMetadata []string
+
+	// contextMetadata are the request metadata keys shown to the model
+	contextMetadata []string
+
+	// usageMu guards usage
+	usageMu sync.Mutex
+
+	// usage accumulates token usage over all requests
+	usage core.UsageStats
+
+	// breaker optionally stops completion requests while the provider is failing
+	breaker *core.CircuitBreaker
+
+	// toolResultTransformers override resultTransformer for specific tools
+	toolResultTransformers map[string]core.ResultTransformer
+
+	// memory holds the history of requests made on a thread
+	memory MemoryStore
+
+	// moderator optionally checks user content and model output
+	moderator Moderator
+
+	// moderationPolicy is ModerationReject or ModerationReplace
+	moderationPolicy string
+
+	// moderationReplacement is the reply for flagged content under ModerationReplace
+	moderationReplacement string
+
+	// streamGuard optionally checks model output while it streams
+	streamGuard StreamGuard
+
+	// streamGuardInterval is the number of tokens between guard checks,
+	// zero leaves it to the guard
+	streamGuardInterval int
+
+	// streamGuardRefusal replaces output the stream guard cut off
+	streamGuardRefusal string
+
+	// responseValidator optionally checks the final reply, which the model
+	// is asked to correct when it fails
+	responseValidator ResponseValidator
+
+	// requestHook and responseHook optionally observe every completion
+	requestHook  RequestHook
+	responseHook ResponseHook
+
+	// toolSelection optionally narrows the tools sent with each request
+	toolSelection *toolSelection
 }
 
-func NewOpenAIAgent(id string, apiKey string, logger *zap.Logger) Agent {
-	client := openai.NewClient(
+// defaultToolTimeout is used when no tool_timeout is configured
+const defaultToolTimeout = 30 * time.Second
+
+// defaultMaxToolIterations bounds the tool round-trips of a single
+// ProcessMessage when no max_tool_iterations is configured
+const defaultMaxToolIterations = 10
+
+// NewOpenAIAgent creates an agent backed by the OpenAI chat completions API.
+// A nil logger discards everything, zap loggers are wrapped with
+// core.NewZapLogger.
+func NewOpenAIAgent(id string, apiKey string, logger core.Logger, opts ...Option) Agent {
+	if logger == nil {
+		logger = core.NopLogger()
+	}
+
+	var o agentOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	logger = logger.With("agent_id", id)
+	requestOptions := []option.RequestOption{
 		option.WithAPIKey(apiKey),
-	)
+		option.WithMiddleware(debugMiddleware(logger)),
+	}
+	if o.httpClient != nil {
+		requestOptions = append(requestOptions, option.WithHTTPClient(o.httpClient))
+	}
+	client := openai.NewClient(requestOptions...)
 
 	return &OpenAIAgent{
 		id:      id,
 		client:  client,
-		logger:  logger.With(zap.String("agent_id", id)),
+		logger:  logger,
 		config:  make(map[string]interface{}),
 		tools:   make([]core.Tool, 0),
 		history: make([]openai.ChatCompletionMessageParamUnion, 0),
+
+		toolTimeout:       defaultToolTimeout,
+		propagateMetadata: core.DefaultPropagatedMetadata,
+		breaker:           o.breaker(id),
+		memory:            o.memoryStore(),
+		requestHook:       o.requestHook,
+		responseHook:      o.responseHook,
+		toolSelection:     o.toolSelection(),
+
+		moderationPolicy:      ModerationReject,
+		moderationReplacement: defaultModerationReplacement,
+		streamGuardRefusal:    defaultModerationReplacement,
 	}
 }
 
@@ -46,23 +184,384 @@ func (a *OpenAIAgent) Configure(config map[string]interface{}) error {
 	} else {
 		a.config["model"] = model
 	}
+
+	if raw, ok := config["system_message"]; ok {
+		systemMessage, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("system_message must be a string")
+		}
+		a.config["system_message"] = systemMessage
+	}
+
+	if raw, ok := config["seed"]; ok {
+		seed, err := toInt64(raw)
+		if err != nil {
+			return fmt.Errorf("seed must be an integer: %w", err)
+		}
+		a.config["seed"] = seed
+	}
+
+	if raw, ok := config["logit_bias"]; ok {
+		bias, err := parseLogitBias(raw)
+		if err != nil {
+			return err
+		}
+		a.config["logit_bias"] = bias
+	}
+
+	for _, key := range []string{"presence_penalty", "frequency_penalty"} {
+		if raw, ok := config[key]; ok {
+			penalty, err := parsePenalty(key, raw)
+			if err != nil {
+				return err
+			}
+			a.config[key] = penalty
+		}
+	}
+
+	if raw, ok := config["tool_choice"]; ok {
+		toolChoice, ok := raw.(string)
+		if !ok || toolChoice == "" {
+			return fmt.Errorf("tool_choice must be auto, none, required or a tool name")
+		}
+		a.config["tool_choice"] = toolChoice
+	}
+
+	if raw, ok := config["tool_choice_mismatch"]; ok {
+		policy, ok := raw.(string)
+		if !ok || (policy != MismatchError && policy != MismatchReprompt && policy != MismatchPassThrough) {
+			return fmt.Errorf("tool_choice_mismatch must be one of %s, %s or %s", MismatchError, MismatchReprompt, MismatchPassThrough)
+		}
+		a.config["tool_choice_mismatch"] = policy
+	}
+
+	if raw, ok := config["stream_tokens"]; ok {
+		streamTokens, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("stream_tokens must be a bool")
+		}
+		a.config["stream_tokens"] = streamTokens
+	}
+
+	if raw, ok := config["model_fallback"]; ok {
+		models, err := parseModels(raw)
+		if err != nil {
+			return fmt.Errorf("model_fallback must be a list of model names: %w", err)
+		}
+		a.config["model_fallback"] = models
+	}
+
+	if raw, ok := config["debug_payloads"]; ok {
+		debug, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("debug_payloads must be a bool")
+		}
+		a.config["debug_payloads"] = debug
+	}
+
+	if raw, ok := config["respond_in_locale"]; ok {
+		respondInLocale, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("respond_in_locale must be a bool")
+		}
+		a.config["respond_in_locale"] = respondInLocale
+	}
+
+	if raw, ok := config["strict_tools"]; ok {
+		strict, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("strict_tools must be a bool")
+		}
+		a.config["strict_tools"] = strict
+	}
+
+	if raw, ok := config["strict_tool_retries"]; ok {
+		retries, err := toInt64(raw)
+		if err != nil || retries < 0 {
+			return fmt.Errorf("strict_tool_retries must be a non-negative integer")
+		}
+		a.config["strict_tool_retries"] = int(retries)
+	}
+
+	if raw, ok := config["max_tool_iterations"]; ok {
+		iterations, err := toInt64(raw)
+		if err != nil || iterations <= 0 {
+			return fmt.Errorf("max_tool_iterations must be a positive integer")
+		}
+		a.config["max_tool_iterations"] = int(iterations)
+	}
+
+	if raw, ok := config["moderator"]; ok {
+		moderator, ok := raw.(Moderator)
+		if !ok {
+			return fmt.Errorf("moderator must be a Moderator")
+		}
+		a.moderator = moderator
+	}
+
+	if raw, ok := config["moderation_policy"]; ok {
+		policy, ok := raw.(string)
+		if !ok || (policy != ModerationReject && policy != ModerationReplace) {
+			return fmt.Errorf("moderation_policy must be %s or %s", ModerationReject, ModerationReplace)
+		}
+		a.moderationPolicy = policy
+	}
+
+	if raw, ok := config["moderation_replacement"]; ok {
+		replacement, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("moderation_replacement must be a string")
+		}
+		a.moderationReplacement = replacement
+	}
+
+	if raw, ok := config["stream_guard"]; ok {
+		guard, ok := raw.(StreamGuard)
+		if !ok {
+			return fmt.Errorf("stream_guard must be a StreamGuard")
+		}
+		a.streamGuard = guard
+	}
+
+	if raw, ok := config["stream_guard_interval"]; ok {
+		interval, err := toInt64(raw)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("stream_guard_interval must be a positive integer")
+		}
+		a.streamGuardInterval = int(interval)
+	}
+
+	if raw, ok := config["stream_guard_refusal"]; ok {
+		refusal, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("stream_guard_refusal must be a string")
+		}
+		a.streamGuardRefusal = refusal
+	}
+
+	if raw, ok := config["response_validator"]; ok {
+		validator, ok := raw.(ResponseValidator)
+		if !ok {
+			fn, isFunc := raw.(func(string) error)
+			if !isFunc {
+				return fmt.Errorf("response_validator must be a ResponseValidator")
+			}
+			validator = fn
+		}
+		a.responseValidator = validator
+	}
+
+	if raw, ok := config["response_validation_retries"]; ok {
+		retries, err := toInt64(raw)
+		if err != nil || retries < 0 {
+			return fmt.Errorf("response_validation_retries must be a non-negative integer")
+		}
+		a.config["response_validation_retries"] = int(retries)
+	}
+
+	if raw, ok := config["tool_timeout"]; ok {
+		switch v := raw.(type) {
+		case time.Duration:
+			a.toolTimeout = v
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid tool_timeout: %w", err)
+			}
+			a.toolTimeout = d
+		default:
+			return fmt.Errorf("tool_timeout must be a duration or duration string")
+		}
+		if a.toolTimeout <= 0 {
+			return fmt.Errorf("tool_timeout must be positive")
+		}
+	}
+
+	if raw, ok := config["retry_policy"]; ok {
+		policy, ok := raw.(core.RetryPolicy)
+		if !ok {
+			return fmt.Errorf("retry_policy must be a core.RetryPolicy")
+		}
+		a.retryPolicy = policy
+	}
+
+	if raw, ok := config["propagate_metadata"]; ok {
+		keys, ok := raw.([]string)
+		if !ok {
+			return fmt.Errorf("propagate_metadata must be a []string")
+		}
+		a.propagateMetadata = keys
+	}
+
+	if raw, ok := config["metadata_context"]; ok {
+		keys, ok := raw.([]string)
+		if !ok {
+			return fmt.Errorf("metadata_context must be a []string")
+		}
+		a.contextMetadata = keys
+	}
+
+	if raw, ok := config["result_transformer"]; ok {
+		switch v := raw.(type) {
+		case core.ResultTransformer:
+			a.resultTransformer = v
+		case func(string, interface{}) (interface{}, error):
+			a.resultTransformer = v
+		default:
+			return fmt.Errorf("result_transformer must be a core.ResultTransformer")
+		}
+	}
+
+	if raw, ok := config["tool_result_transformers"]; ok {
+		transformers, ok := raw.(map[string]core.ResultTransformer)
+		if !ok {
+			return fmt.Errorf("tool_result_transformers must be a map[string]core.ResultTransformer")
+		}
+		a.toolResultTransformers = transformers
+	}
 	return nil
 }
 
+// Model returns the configured model
+func (a *OpenAIAgent) Model() string {
+	model, _ := a.config["model"].(string)
+	return model
+}
+
+// Description describes the agent for generated graph docs
+func (a *OpenAIAgent) Description() string {
+	if model := a.Model(); model != "" {
+		return fmt.Sprintf("Agent %s answering with %s", a.id, model)
+	}
+	return "Agent " + a.id
+}
+
+// Tools returns the tools added to the agent
+func (a *OpenAIAgent) Tools() []core.Tool {
+	return a.tools
+}
+
+// AddTool adds a tool to the agent. A tool with an invalid name is logged
+// here and fails ProcessMessage with ErrInvalidToolName, since the API would
+// reject the whole request.
 func (a *OpenAIAgent) AddTool(tool core.Tool) {
+	if err := ValidateToolName(tool.Name()); err != nil {
+		a.logger.Error("Invalid tool name", "error", err)
+	}
 	a.tools = append(a.tools, tool)
 }
 
+// Clone returns a copy of the agent with the same configuration, tools and
+// client but an empty history and memory store, so independent requests can
+// run in parallel
+func (a *OpenAIAgent) Clone() Agent {
+	config := make(map[string]interface{}, len(a.config))
+	for k, v := range a.config {
+		config[k] = v
+	}
+	transformers := make(map[string]core.ResultTransformer, len(a.toolResultTransformers))
+	for k, v := range a.toolResultTransformers {
+		transformers[k] = v
+	}
+
+	return &OpenAIAgent{
+		id:      a.id,
+		client:  a.client,
+		logger:  a.logger,
+		config:  config,
+		tools:   append([]core.Tool(nil), a.tools...),
+		history: make([]openai.ChatCompletionMessageParamUnion, 0),
+
+		toolTimeout:            a.toolTimeout,
+		resultTransformer:      a.resultTransformer,
+		retryPolicy:            a.retryPolicy,
+		propagateMetadata:      a.propagateMetadata,
+		contextMetadata:        a.contextMetadata,
+		breaker:                a.breaker,
+		toolResultTransformers: transformers,
+		memory:                 NewInMemoryStore(),
+		moderator:              a.moderator,
+		moderationPolicy:       a.moderationPolicy,
+		moderationReplacement:  a.moderationReplacement,
+		streamGuard:            a.streamGuard,
+		streamGuardInterval:    a.streamGuardInterval,
+		streamGuardRefusal:     a.streamGuardRefusal,
+		responseValidator:      a.responseValidator,
+		requestHook:            a.requestHook,
+		responseHook:           a.responseHook,
+		toolSelection:          a.toolSelection,
+	}
+}
+
 func (a *OpenAIAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
-	a.logger.Debug("Processing message", zap.String("content", msg.Content))
+	a.logger.Debug("Processing message", "content", msg.Content)
+
+	// Replies and events carry the request's correlation metadata
+	propagated := core.PropagateMetadata(msg, a.propagateMetadata)
+
+	// The API rejects the whole request over one badly named tool
+	for _, tool := range a.tools {
+		if err := ValidateToolName(tool.Name()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Flagged user content never reaches the model
+	if reply, err := a.moderate(ctx, ModerationInbound, msg.Content, propagated); reply != nil || err != nil {
+		return reply, err
+	}
+
+	// Threads keep their history in the memory store, other requests
+	// continue the agent's own history
+	threadID := core.ThreadIDFromContext(ctx)
+	history := a.history
+	if threadID != "" {
+		loaded, err := toParams(a.memory.Load(threadID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load history of thread %s: %w", threadID, err)
+		}
+		history = loaded
+	}
 
 	// Add the incoming message to history
-	a.history = append(a.history, openai.UserMessage(msg.Content))
+	history = append(history, openai.UserMessage(withMetadataHeader(msg, a.contextMetadata)))
+
+	// In strict mode arguments are validated before execution, and the
+	// schemas sent are adjusted to the form OpenAI's strict mode requires
+	strict, _ := a.config["strict_tools"].(bool)
+	strictRetries, ok := a.config["strict_tool_retries"].(int)
+	if !ok {
+		strictRetries = defaultStrictToolRetries
+	}
+	invalidCalls := 0
+
+	validationRetries, ok := a.config["response_validation_retries"].(int)
+	if !ok {
+		validationRetries = defaultResponseValidationRetries
+	}
+	invalidReplies := 0
+
+	maxIterations, ok := a.config["max_tool_iterations"].(int)
+	if !ok {
+		maxIterations = defaultMaxToolIterations
+	}
+	iterations := 0
+	exhausted := false
 
 	// Convert tools to OpenAI format
 	toolParams := make([]openai.ChatCompletionToolParam, 0)
-	for _, tool := range a.tools {
+	for _, tool := range a.selectTools(ctx, msg.Content) {
 		schema := tool.JSONSchema()
+		if strict {
+			var changes []string
+			schema, changes = StrictSchema(schema)
+			if len(changes) > 0 {
+				a.logger.Debug("Adjusted tool schema for strict mode",
+					"tool", tool.Name(),
+					"changes", changes,
+					"schema", schema)
+			}
+		}
 		schemaJSON, err := json.Marshal(schema)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal tool schema: %w", err)
@@ -73,86 +572,763 @@ func (a *OpenAIAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]c
 			return nil, fmt.Errorf("failed to unmarshal schema to function parameters: %w", err)
 		}
 
+		function := openai.FunctionDefinitionParam{
+			Name:        openai.String(tool.Name()),
+			Description: openai.String(tool.Description()),
+			Parameters:  openai.F(params),
+		}
+		if strict {
+			function.Strict = openai.F(true)
+		}
 		toolParams = append(toolParams, openai.ChatCompletionToolParam{
-			Type: openai.F(openai.ChatCompletionToolTypeFunction),
-			Function: openai.F(openai.FunctionDefinitionParam{
-				Name:        openai.String(tool.Name()),
-				Description: openai.String(tool.Description()),
-				Parameters:  openai.F(params),
-			}),
+			Type:     openai.F(openai.ChatCompletionToolTypeFunction),
+			Function: openai.F(function),
 		})
 	}
 
 	// Get model from config
-	model := a.config["model"].(string)
+	config, err := a.runConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	model := config["model"].(string)
+	fallbacks, _ := config["model_fallback"].([]string)
+	var failedModels []string
+	systemMessage, _ := config["system_message"].(string)
 
-	// Create chat completion request
-	params := openai.ChatCompletionNewParams{
-		Messages: openai.F(a.history),
-		Model:    openai.F(model),
+	// Runs with a locale get an instruction to answer in its language
+	if respondInLocale, _ := config["respond_in_locale"].(bool); respondInLocale {
+		if locale := core.LocaleFromContext(ctx); locale != "" {
+			systemMessage = strings.TrimSpace(localeInstruction(locale) + "\n\n" + systemMessage)
+		}
+	}
+
+	streamTokens, _ := config["stream_tokens"].(bool)
+
+	// Log the exact payloads exchanged with the API
+	debugPayloads, _ := config["debug_payloads"].(bool)
+	if debugPayloads {
+		ctx = context.WithValue(ctx, debugPayloadsKey{}, true)
 	}
 
-	// Add tools if available
-	if len(toolParams) > 0 {
-		params.Tools = openai.F(toolParams)
+	toolChoice, _ := config["tool_choice"].(string)
+	mismatchPolicy, ok := config["tool_choice_mismatch"].(string)
+	if !ok {
+		mismatchPolicy = MismatchError
 	}
 
-	// Stream the response
-	stream := a.client.Chat.Completions.NewStreaming(ctx, params)
-	acc := openai.ChatCompletionAccumulator{}
+	// A forced tool choice only applies until the model complies, after
+	// which it must be free to answer with the tool results
+	forceTool := len(toolParams) > 0 && toolChoice != "" && toolChoice != "auto" && toolChoice != "none"
+	reprompts := 0
 
 	var toolResults []string
-	for stream.Next() {
-		chunk := stream.Current()
-		acc.AddChunk(chunk)
-
-		// Handle tool calls as they come in
-		if tool, ok := acc.JustFinishedToolCall(); ok {
-			a.logger.Debug("Tool call received",
-				zap.String("tool", tool.Name),
-				zap.String("args", tool.Arguments))
-
-			// Find and execute the tool
-			for _, t := range a.tools {
-				if t.Name() == tool.Name {
-					var args map[string]interface{}
-					if err := json.Unmarshal([]byte(tool.Arguments), &args); err != nil {
-						return nil, fmt.Errorf("failed to unmarshal tool arguments: %w", err)
+	var reply openai.ChatCompletionMessage
+	var reasoning strings.Builder
+	var guardStopped *streamGuardRun
+	for {
+		// Stop before starting another completion if the request was cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("agent loop aborted: %w", err)
+		}
+
+		// Create chat completion request. The system message always comes
+		// first and tools keep their registration order, so consecutive
+		// requests share the longest prefix for automatic prompt caching.
+		messages := history
+		if systemMessage != "" {
+			messages = append([]openai.ChatCompletionMessageParamUnion{openai.SystemMessage(systemMessage)}, history...)
+		}
+		params := openai.ChatCompletionNewParams{
+			Messages: openai.F(messages),
+			Model:    openai.F(model),
+			StreamOptions: openai.F(openai.ChatCompletionStreamOptionsParam{
+				IncludeUsage: openai.F(true),
+			}),
+		}
+
+		// Add tools if available
+		if len(toolParams) > 0 {
+			params.Tools = openai.F(toolParams)
+			if toolChoice != "" {
+				params.ToolChoice = openai.F(toolChoiceParam(toolChoice, forceTool))
+			}
+		}
+
+		// Request best-effort deterministic sampling
+		if seed, ok := config["seed"].(int64); ok {
+			params.Seed = openai.F(seed)
+		}
+
+		if bias, ok := config["logit_bias"].(map[string]int64); ok && len(bias) > 0 {
+			params.LogitBias = openai.F(bias)
+		}
+		if penalty, ok := config["presence_penalty"].(float64); ok {
+			params.PresencePenalty = openai.F(penalty)
+		}
+		if penalty, ok := config["frequency_penalty"].(float64); ok {
+			params.FrequencyPenalty = openai.F(penalty)
+		}
+
+		// Stream the response, retrying failures that happen before any
+		// chunk has been passed on to the caller
+		var acc openai.ChatCompletionAccumulator
+		var usage core.Usage
+		var guard *streamGuardRun
+		var received bool
+		err := core.Retry(ctx, a.retryPolicy, a.guard(func(ctx context.Context) error {
+			acc = openai.ChatCompletionAccumulator{}
+			usage = core.Usage{}
+			guard = a.newStreamGuardRun()
+			received = false
+
+			emitContent := func(tokens []string) {
+				if !streamTokens {
+					return
+				}
+				for _, token := range tokens {
+					core.EmitMessage(ctx, core.MessageChunk{Type: core.ChunkContent, Name: a.id, Content: token})
+				}
+			}
+
+			a.observeRequest(ctx, params, debugPayloads)
+			stream := a.client.Chat.Completions.NewStreaming(ctx, params)
+			if stream.Err() == nil {
+				// Close the stream on every return, and as soon as the
+				// context is cancelled so a blocked read gives up its
+				// connection right away
+				stop := context.AfterFunc(ctx, func() { stream.Close() })
+				defer func() {
+					stop()
+					stream.Close()
+				}()
+			}
+			for stream.Next() {
+				received = true
+				chunk := stream.Current()
+				acc.AddChunk(chunk)
+
+				// Usage arrives on a final chunk without choices
+				if chunk.Usage.TotalTokens > 0 {
+					usage = core.Usage{
+						PromptTokens:     int(chunk.Usage.PromptTokens),
+						CompletionTokens: int(chunk.Usage.CompletionTokens),
+						TotalTokens:      int(chunk.Usage.TotalTokens),
+						CachedTokens:     int(chunk.Usage.PromptTokensDetails.CachedTokens),
 					}
+				}
 
-					result, err := t.Execute(ctx, args)
+				// Capture reasoning separately from the answer. Providers that
+				// don't support it simply never send it.
+				for _, choice := range chunk.Choices {
+					if choice.Index != 0 {
+						continue
+					}
+					if delta := reasoningDelta(choice.Delta); delta != "" {
+						reasoning.WriteString(delta)
+						if streamTokens {
+							core.EmitMessage(ctx, core.MessageChunk{Type: core.ChunkReasoning, Name: a.id, Content: delta})
+						}
+					}
+					if choice.Delta.Content == "" {
+						continue
+					}
+					if guard == nil {
+						emitContent([]string{choice.Delta.Content})
+						continue
+					}
+					passed, stop, err := guard.add(ctx, choice.Delta.Content)
 					if err != nil {
-						return nil, fmt.Errorf("failed to execute tool: %w", err)
+						return core.NoRetry(err)
+					}
+					emitContent(passed)
+					if stop {
+						// Abort the completion, the rest of it is never read
+						return nil
 					}
+				}
 
-					resultStr := fmt.Sprintf("%v", result)
-					toolResults = append(toolResults, resultStr)
-					a.logger.Debug("Tool executed",
-						zap.String("tool", tool.Name),
-						zap.String("result", resultStr))
+				// Log tool calls as they come in
+				if tool, ok := acc.JustFinishedToolCall(); ok {
+					a.logger.Debug("Tool call received",
+						"tool", tool.Name,
+						"args", tool.Arguments)
 				}
+
+				// Handle content as it comes in
+				if content, ok := acc.JustFinishedContent(); ok {
+					a.logger.Debug("Content received", "content", content)
+				}
+			}
+
+			if err := stream.Err(); err != nil {
+				var apiErr *openai.Error
+				if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+					// Retrying won't fix the credentials
+					return core.NoRetry(fmt.Errorf("%w: %w", ErrUnauthorized, err))
+				}
+				err = fmt.Errorf("stream error: %w", err)
+				if received {
+					return core.NoRetry(err)
+				}
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				// A closed stream ends like a finished one
+				return core.NoRetry(err)
+			}
+
+			if guard != nil {
+				passed, _, err := guard.finish(ctx)
+				if err != nil {
+					return core.NoRetry(err)
+				}
+				emitContent(passed)
+			}
+			a.observeResponse(ctx, acc.ChatCompletion, debugPayloads)
+			return nil
+		}))
+		if err != nil {
+			// Try the next model unless the caller already got tokens of this one
+			if len(fallbacks) > 0 && !(received && streamTokens) && ctx.Err() == nil && ShouldFallback(err) {
+				next := fallbacks[0]
+				fallbacks = fallbacks[1:]
+				a.logger.Warn("Falling back to the next model", "from", model, "to", next, "error", err)
+				core.EmitEvent(ctx, core.Event{
+					Type:      EventModelFallback,
+					Name:      a.id,
+					Timestamp: time.Now(),
+					Metadata: map[string]interface{}{
+						"agent_id": a.id,
+						"from":     model,
+						"to":       next,
+						"error":    err.Error(),
+					},
+				})
+				failedModels = append(failedModels, model)
+				model = next
+				continue
 			}
+			return nil, err
 		}
 
-		// Handle content as it comes in
-		if content, ok := acc.JustFinishedContent(); ok {
-			a.logger.Debug("Content received", zap.String("content", content))
+		if guard != nil && guard.reason != "" {
+			// The partial output is dropped in favor of the refusal, also
+			// from the history the model sees next
+			a.logger.Warn("Stream cut off by guard",
+				"reason", guard.reason,
+				"tokens", guard.tokens)
+
+			// An aborted stream never gets to its usage chunk, so the
+			// tokens are estimated from the prompt and the streamed deltas
+			if usage.TotalTokens == 0 {
+				usage = guard.estimateUsage(messages)
+			}
+			a.spendUsage(ctx, usage)
+			core.EmitEvent(ctx, core.Event{
+				Type:      EventStreamGuardStop,
+				Name:      a.id,
+				Timestamp: time.Now(),
+				Metadata: map[string]interface{}{
+					"agent_id": a.id,
+					"model":    model,
+					"reason":   guard.reason,
+					"tokens":   guard.tokens,
+					"usage":    usage,
+				},
+			})
+			if streamTokens {
+				core.EmitMessage(ctx, core.MessageChunk{Type: core.ChunkContent, Name: a.id, Content: a.streamGuardRefusal})
+			}
+			reply = openai.ChatCompletionMessage{
+				Role:    openai.ChatCompletionMessageRoleAssistant,
+				Content: a.streamGuardRefusal,
+			}
+			history = append(history, reply)
+			guardStopped = guard
+			break
 		}
-	}
 
-	if err := stream.Err(); err != nil {
-		return nil, fmt.Errorf("stream error: %w", err)
+		if len(acc.Choices) == 0 {
+			return nil, fmt.Errorf("no choices in completion response")
+		}
+
+		// Surface the backend fingerprint so callers can tell when it changes
+		metadata := map[string]interface{}{
+			"agent_id":           a.id,
+			"model":              model,
+			"system_fingerprint": acc.SystemFingerprint,
+		}
+		if seed, ok := config["seed"].(int64); ok {
+			metadata["seed"] = seed
+		}
+		for k, v := range propagated {
+			metadata[k] = v
+		}
+		if usage.TotalTokens > 0 {
+			metadata["usage"] = usage
+			metadata["cache_hit_ratio"] = a.spendUsage(ctx, usage).CacheHitRatio()
+		}
+		core.EmitEvent(ctx, core.Event{
+			Type:      core.EventChatModelEnd,
+			Name:      a.id,
+			Timestamp: time.Now(),
+			Metadata:  metadata,
+		})
+		a.logger.Debug("Completion finished",
+			"system_fingerprint", acc.SystemFingerprint)
+
+		reply = acc.Choices[0].Message
+
+		if forceTool {
+			if reason := a.toolChoiceMismatch(toolChoice, reply); reason != "" {
+				switch {
+				case mismatchPolicy == MismatchReprompt && reprompts < maxToolChoiceReprompts:
+					reprompts++
+					a.logger.Warn("Re-prompting for required tool call", "reason", reason)
+					// Unanswered tool calls can't stay in history, so only plain content is kept
+					if len(reply.ToolCalls) == 0 {
+						history = append(history, reply)
+					}
+					history = append(history, openai.UserMessage(repromptMessage(toolChoice)))
+					continue
+				case mismatchPolicy != MismatchPassThrough:
+					return nil, fmt.Errorf("%w: %s", ErrToolChoiceMismatch, reason)
+				}
+			}
+			forceTool = false
+		}
+
+		history = append(history, reply)
+
+		if len(reply.ToolCalls) == 0 {
+			if a.responseValidator == nil {
+				break
+			}
+			err := a.responseValidator(reply.Content)
+			if err == nil {
+				break
+			}
+			if invalidReplies >= validationRetries {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+			}
+			// Let the model correct its reply
+			invalidReplies++
+			a.logger.Warn("Re-prompting for an invalid response", "error", err, "attempt", invalidReplies)
+			history = append(history, openai.UserMessage(invalidResponseMessage(err)))
+			continue
+		}
+
+		// Execute the requested tools and feed the results back to the model
+		for _, call := range reply.ToolCalls {
+			if err := ctx.Err(); err != nil {
+				return nil, fmt.Errorf("agent loop aborted: %w", err)
+			}
+
+			started := time.Now()
+			resultStr, err := a.executeTool(ctx, call.Function.Name, call.Function.Arguments, strict)
+			traced := core.ToolCallRecord{
+				Tool:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+				Result:    resultStr,
+				Start:     started,
+				Duration:  time.Since(started),
+			}
+			if err != nil {
+				traced.Error = err.Error()
+			}
+			core.RecordToolCall(ctx, traced)
+
+			if errors.Is(err, ErrInvalidToolArguments) && invalidCalls < strictRetries {
+				// Let the model correct its arguments
+				invalidCalls++
+				a.logger.Warn("Returning invalid tool arguments to the model", "error", err)
+				resultStr = fmt.Sprintf("Error: %v. Call the tool again with arguments that match its schema.", err)
+				err = nil
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			toolResults = append(toolResults, resultStr)
+			history = append(history, openai.ToolMessage(call.ID, resultStr))
+		}
+
+		// A model that keeps calling tools is cut off with what it has said so far
+		iterations++
+		if iterations >= maxIterations {
+			a.logger.Warn("Tool loop stopped at max_tool_iterations", "iterations", iterations)
+			exhausted = true
+			break
+		}
 	}
 
 	// Create response message
 	response := core.Message{
-		Role:    core.RoleAssistant,
-		Content: acc.Choices[0].Message.Content,
+		Role:      core.RoleAssistant,
+		Content:   reply.Content,
+		Reasoning: reasoning.String(),
+		Metadata:  propagated,
+	}
+	if exhausted {
+		metadata := make(map[string]interface{}, len(propagated)+1)
+		for k, v := range propagated {
+			metadata[k] = v
+		}
+		metadata["warning"] = fmt.Sprintf("stopped after %d tool iterations without a final answer", iterations)
+		response.Metadata = metadata
+	}
+	if guardStopped != nil {
+		metadata := make(map[string]interface{}, len(propagated)+1)
+		for k, v := range propagated {
+			metadata[k] = v
+		}
+		metadata["stream_guard"] = map[string]interface{}{
+			"reason": guardStopped.reason,
+			"tokens": guardStopped.tokens,
+		}
+		response.Metadata = metadata
+	}
+
+	// With fallbacks configured, callers can tell which model answered
+	if _, ok := config["model_fallback"]; ok {
+		metadata := make(map[string]interface{}, len(response.Metadata)+2)
+		for k, v := range response.Metadata {
+			metadata[k] = v
+		}
+		metadata["model"] = model
+		if len(failedModels) > 0 {
+			metadata["fallback_from"] = failedModels
+		}
+		response.Metadata = metadata
+	}
+
+	// Flagged model output is rejected or replaced before it is returned
+	if reply, err := a.moderate(ctx, ModerationOutbound, response.Content, propagated); reply != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		response = reply[0]
+		// Later turns must not send the flagged reply back to the model
+		replaceLastReply(history, response.Content)
+	}
+
+	// History is only saved once the turn completes, so a failed turn
+	// doesn't leave unanswered tool calls behind
+	if threadID != "" {
+		saved, err := fromParams(history)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save history of thread %s: %w", threadID, err)
+		}
+		a.memory.Save(threadID, saved)
+	} else {
+		a.history = history
 	}
 
 	a.logger.Info("Message processed",
-		zap.String("response", response.Content),
-		zap.Strings("tool_results", toolResults))
+		"response", response.Content,
+		"tool_results", toolResults)
 
 	return []core.Message{response}, nil
 }
+
+// moderate checks content with the moderator, if one is set. For flagged
+// content it returns a ModerationError under the reject policy, or the
+// replacement reply under the replace policy.
+func (a *OpenAIAgent) moderate(ctx context.Context, direction, content string, propagated map[string]interface{}) ([]core.Message, error) {
+	if a.moderator == nil || content == "" {
+		return nil, nil
+	}
+
+	flagged, categories, err := a.moderator.Check(ctx, content)
+	if err != nil {
+		return nil, fmt.Errorf("moderation check failed: %w", err)
+	}
+	if !flagged {
+		return nil, nil
+	}
+
+	a.logger.Warn("Content flagged by moderation",
+		"direction", direction,
+		"categories", categories)
+	if a.moderationPolicy != ModerationReplace {
+		return nil, &ModerationError{Direction: direction, Categories: categories}
+	}
+
+	metadata := make(map[string]interface{}, len(propagated)+1)
+	for k, v := range propagated {
+		metadata[k] = v
+	}
+	metadata["moderation"] = map[string]interface{}{
+		"direction":  direction,
+		"categories": categories,
+	}
+	return []core.Message{{
+		Role:     core.RoleAssistant,
+		Content:  a.moderationReplacement,
+		Metadata: metadata,
+	}}, nil
+}
+
+// replaceLastReply swaps the content of the last model reply in history,
+// keeping its tool calls
+func replaceLastReply(history []openai.ChatCompletionMessageParamUnion, content string) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if reply, ok := history[i].(openai.ChatCompletionMessage); ok {
+			reply.Content = content
+			history[i] = reply
+			return
+		}
+	}
+}
+
+// executeTool runs the named tool under the configured tool timeout.
+// The derived context is released as soon as the tool returns. In strict
+// mode arguments that don't match the tool's schema fail with
+// ErrInvalidToolArguments without running the tool.
+func (a *OpenAIAgent) executeTool(ctx context.Context, name, arguments string, strict bool) (string, error) {
+	for _, t := range a.tools {
+		if t.Name() != name {
+			continue
+		}
+
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			if strict {
+				return "", fmt.Errorf("%w for %s: %v", ErrInvalidToolArguments, name, err)
+			}
+			return "", fmt.Errorf("failed to unmarshal tool arguments: %w", err)
+		}
+
+		if strict {
+			args = relaxArgs(t.JSONSchema(), args)
+			if err := t.Validate(args); err != nil {
+				return "", fmt.Errorf("%w for %s: %v", ErrInvalidToolArguments, name, err)
+			}
+		}
+
+		// Never give a tool more time than the run has left
+		timeout := a.toolTimeout
+		if budget, ok := core.RemainingBudget(ctx); ok && budget < timeout {
+			timeout = budget
+		}
+		toolCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		result, err := t.Execute(toolCtx, args)
+		if err != nil {
+			return "", fmt.Errorf("failed to execute tool: %w", err)
+		}
+
+		if transform := a.transformerFor(name); transform != nil {
+			result, err = transform(name, result)
+			if err != nil {
+				return "", fmt.Errorf("failed to transform tool result: %w", err)
+			}
+		}
+
+		resultStr := fmt.Sprintf("%v", result)
+		a.logger.Debug("Tool executed",
+			"tool", name,
+			"result", resultStr)
+		return resultStr, nil
+	}
+
+	a.logger.Warn("Tool not found", "tool", name)
+	return fmt.Sprintf("error: unknown tool %q", name), nil
+}
+
+// transformerFor returns the result transformer for the named tool, if any
+func (a *OpenAIAgent) transformerFor(name string) core.ResultTransformer {
+	if transform, ok := a.toolResultTransformers[name]; ok {
+		return transform
+	}
+	return a.resultTransformer
+}
+
+// Usage returns the token usage accumulated over all of the agent's requests
+func (a *OpenAIAgent) Usage() core.UsageStats {
+	a.usageMu.Lock()
+	defer a.usageMu.Unlock()
+	return a.usage
+}
+
+// recordUsage adds the usage of a request and returns the new totals
+func (a *OpenAIAgent) recordUsage(usage core.Usage) core.UsageStats {
+	a.usageMu.Lock()
+	defer a.usageMu.Unlock()
+	a.usage.Add(usage)
+	return a.usage
+}
+
+// spendUsage records the usage of a completion and charges it to the run's
+// token budget, if any
+func (a *OpenAIAgent) spendUsage(ctx context.Context, usage core.Usage) core.UsageStats {
+	if budget := core.TokenBudgetFromContext(ctx); budget != nil {
+		budget.Spend(usage.TotalTokens)
+	}
+	return a.recordUsage(usage)
+}
+
+// guard runs a completion attempt through the agent's circuit breaker, if it
+// has one. An open circuit is not retried so fallbacks can take over at once.
+func (a *OpenAIAgent) guard(attempt func(ctx context.Context) error) func(ctx context.Context) error {
+	if a.breaker == nil {
+		return attempt
+	}
+	return func(ctx context.Context) error {
+		err := a.breaker.Do(ctx, attempt)
+		if errors.Is(err, core.ErrCircuitOpen) {
+			return core.NoRetry(err)
+		}
+		return err
+	}
+}
+
+// withMetadataHeader prefixes the message content with the selected metadata
+// as a JSON header, so the model can use it as context
+func withMetadataHeader(msg core.Message, keys []string) string {
+	selected := core.PropagateMetadata(msg, keys)
+	if len(selected) == 0 {
+		return msg.Content
+	}
+	header, err := json.Marshal(selected)
+	if err != nil {
+		return msg.Content
+	}
+	return "Context: " + string(header) + "\n\n" + msg.Content
+}
+
+// runConfig returns the agent's configuration with any overrides for this
+// agent carried by ctx applied, such as those of an experiment variant
+func (a *OpenAIAgent) runConfig(ctx context.Context) (map[string]interface{}, error) {
+	overrides := core.AgentConfigFromContext(ctx, a.id)
+	if len(overrides) == 0 {
+		return a.config, nil
+	}
+
+	config := make(map[string]interface{}, len(a.config)+len(overrides))
+	for k, v := range a.config {
+		config[k] = v
+	}
+	for k, v := range overrides {
+		switch k {
+		case "model", "system_message", "tool_choice", "tool_choice_mismatch":
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s override must be a string", k)
+			}
+			config[k] = s
+		case "stream_tokens":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("stream_tokens override must be a bool")
+			}
+			config[k] = b
+		case "seed":
+			seed, err := toInt64(v)
+			if err != nil {
+				return nil, fmt.Errorf("seed override must be an integer: %w", err)
+			}
+			config[k] = seed
+		default:
+			return nil, fmt.Errorf("unsupported config override: %s", k)
+		}
+	}
+	return config, nil
+}
+
+// toInt64 converts an integral config value to int64
+func toInt64(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, fmt.Errorf("%v is not a whole number", v)
+		}
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+// reasoningDelta extracts reasoning content from a streamed delta. The field
+// isn't part of the OpenAI schema, so it is read from the raw JSON under the
+// names used by providers that support it.
+func reasoningDelta(delta openai.ChatCompletionChunkChoicesDelta) string {
+	raw := delta.JSON.RawJSON()
+	if !strings.Contains(raw, "reasoning") {
+		return ""
+	}
+	var fields struct {
+		ReasoningContent string `json:"reasoning_content"`
+		Reasoning        string `json:"reasoning"`
+	}
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return ""
+	}
+	if fields.ReasoningContent != "" {
+		return fields.ReasoningContent
+	}
+	return fields.Reasoning
+}
+
+// toolChoiceParam builds the tool_choice request parameter. Once a forced
+// choice has been honored it falls back to auto.
+func toolChoiceParam(toolChoice string, force bool) openai.ChatCompletionToolChoiceOptionUnionParam {
+	switch {
+	case toolChoice == "none":
+		return openai.ChatCompletionToolChoiceOptionBehaviorNone
+	case !force || toolChoice == "auto":
+		return openai.ChatCompletionToolChoiceOptionBehaviorAuto
+	case toolChoice == "required":
+		return openai.ChatCompletionToolChoiceOptionBehaviorRequired
+	default:
+		return openai.ChatCompletionNamedToolChoiceParam{
+			Type: openai.F(openai.ChatCompletionNamedToolChoiceTypeFunction),
+			Function: openai.F(openai.ChatCompletionNamedToolChoiceFunctionParam{
+				Name: openai.String(toolChoice),
+			}),
+		}
+	}
+}
+
+// toolChoiceMismatch describes how a reply fails to honor a forced tool
+// choice, or returns an empty string if it complies
+func (a *OpenAIAgent) toolChoiceMismatch(toolChoice string, reply openai.ChatCompletionMessage) string {
+	if len(reply.ToolCalls) == 0 {
+		return "model replied with content instead of a tool call"
+	}
+	for _, call := range reply.ToolCalls {
+		if toolChoice != "required" && call.Function.Name != toolChoice {
+			return fmt.Sprintf("model called %q instead of %q", call.Function.Name, toolChoice)
+		}
+		if !a.hasTool(call.Function.Name) {
+			return fmt.Sprintf("model called unknown tool %q", call.Function.Name)
+		}
+	}
+	return ""
+}
+
+// hasTool reports whether a tool with the given name is registered
+func (a *OpenAIAgent) hasTool(name string) bool {
+	for _, t := range a.tools {
+		if t.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// repromptMessage asks the model to comply with the forced tool choice
+func repromptMessage(toolChoice string) string {
+	if toolChoice == "required" {
+		return "You must respond by calling one of the available tools."
+	}
+	return fmt.Sprintf("You must respond by calling the %s tool.", toolChoice)
+}
@@ -0,0 +1,53 @@
+package agent_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+)
+
+func TestOpenAIAgentConformance(t *testing.T) {
+	agenttest.RunConformance(t, agenttest.OpenAI, func(model http.RoundTripper) agent.Agent {
+		server := httptest.NewServer(modelHandler(model))
+		t.Cleanup(server.Close)
+		target, _ := url.Parse(server.URL)
+		client := &http.Client{Transport: redirectTransport{target: target}}
+		return agent.NewOpenAIAgent("conformance", "key", nil, agent.WithHTTPClient(client))
+	})
+}
+
+// modelHandler serves the responses of a fake model over HTTP
+func modelHandler(model http.RoundTripper) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := model.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for key, values := range resp.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	})
+}
+
+// redirectTransport sends every request to the test server instead of the
+// provider's API
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
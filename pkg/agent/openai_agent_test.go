@@ -0,0 +1,709 @@
+package agent_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// funcTool is a tool running a function
+type funcTool struct {
+	*core.BaseTool
+	fn func(ctx context.Context) (interface{}, error)
+}
+
+func newFuncTool(name string, fn func(ctx context.Context) (interface{}, error)) *funcTool {
+	schema := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	return &funcTool{BaseTool: core.NewBaseTool(name, name+" tool", schema), fn: fn}
+}
+
+func (t *funcTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	return t.fn(ctx)
+}
+
+// newTestAgent creates an agent talking to the fake model
+func newTestAgent(t *testing.T, fake *agenttest.FakeModel, tools ...core.Tool) agent.Agent {
+	t.Helper()
+	a := agent.NewOpenAIAgent("test", "key", nil, agent.WithHTTPClient(&http.Client{Transport: fake}))
+	if err := a.Configure(map[string]interface{}{"model": "fake"}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	for _, tool := range tools {
+		a.AddTool(tool)
+	}
+	return a
+}
+
+// assertToolCallsAnswered fails when a request has an assistant message
+// whose tool calls aren't all followed by a tool reply, which the API
+// rejects
+func assertToolCallsAnswered(t *testing.T, request map[string]interface{}) {
+	t.Helper()
+	messages, _ := request["messages"].([]interface{})
+	pending := make(map[string]bool)
+	for _, m := range messages {
+		msg, _ := m.(map[string]interface{})
+		switch msg["role"] {
+		case "assistant":
+			calls, _ := msg["tool_calls"].([]interface{})
+			for _, c := range calls {
+				call, _ := c.(map[string]interface{})
+				id, _ := call["id"].(string)
+				pending[id] = true
+			}
+		case "tool":
+			id, _ := msg["tool_call_id"].(string)
+			delete(pending, id)
+		default:
+			if len(pending) > 0 {
+				t.Fatalf("tool calls %v unanswered in request %v", pending, messages)
+			}
+		}
+	}
+	if len(pending) > 0 {
+		t.Fatalf("tool calls %v unanswered in request %v", pending, messages)
+	}
+}
+
+func TestHistoryAfterCancelAfterFirstTool(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{ToolCalls: []agenttest.FakeToolCall{
+		{ID: "call_a", Name: "first", Arguments: "{}"},
+		{ID: "call_b", Name: "second", Arguments: "{}"},
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	first := newFuncTool("first", func(context.Context) (interface{}, error) {
+		cancel()
+		return "done", nil
+	})
+	second := newFuncTool("second", func(context.Context) (interface{}, error) {
+		t.Error("second tool ran after the request was cancelled")
+		return "done", nil
+	})
+	a := newTestAgent(t, fake, first, second)
+
+	if _, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "go"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled turn = %v, want context.Canceled", err)
+	}
+	if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "again"}); err != nil {
+		t.Fatalf("turn after cancelled turn: %v", err)
+	}
+	requests := fake.Requests()
+	assertToolCallsAnswered(t, requests[len(requests)-1])
+}
+
+func TestHistoryAfterToolError(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{ToolCalls: []agenttest.FakeToolCall{
+		{ID: "call_a", Name: "broken", Arguments: "{}"},
+	}})
+	broken := newFuncTool("broken", func(context.Context) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	a := newTestAgent(t, fake, broken)
+	ctx := context.Background()
+
+	if _, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "go"}); err == nil {
+		t.Fatal("turn with a failing tool succeeded")
+	}
+	if _, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "again"}); err != nil {
+		t.Fatalf("turn after failed turn: %v", err)
+	}
+	requests := fake.Requests()
+	assertToolCallsAnswered(t, requests[len(requests)-1])
+}
+
+func TestHistoryKeptAfterSuccessfulTurn(t *testing.T) {
+	fake := agenttest.NewFakeModel(
+		agenttest.FakeReply{ToolCalls: []agenttest.FakeToolCall{{ID: "call_a", Name: "lookup", Arguments: "{}"}}},
+		agenttest.FakeReply{Content: "found it"},
+	)
+	lookup := newFuncTool("lookup", func(context.Context) (interface{}, error) {
+		return "42", nil
+	})
+	a := newTestAgent(t, fake, lookup)
+	ctx := context.Background()
+
+	for _, content := range []string{"look it up", "thanks"} {
+		if _, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: content}); err != nil {
+			t.Fatalf("ProcessMessage(%q): %v", content, err)
+		}
+	}
+	requests := fake.Requests()
+	last := requests[len(requests)-1]
+	assertToolCallsAnswered(t, last)
+	// user, assistant tool call, tool reply, assistant answer, user
+	if messages, _ := last["messages"].([]interface{}); len(messages) != 5 {
+		t.Errorf("last request has %d messages, want the 5 of both turns: %v", len(messages), messages)
+	}
+}
+
+// toolReply returns the text of the tool reply to the call in request
+func toolReply(request map[string]interface{}, callID string) (string, bool) {
+	messages, _ := request["messages"].([]interface{})
+	for _, m := range messages {
+		msg, _ := m.(map[string]interface{})
+		if msg["role"] == "tool" && msg["tool_call_id"] == callID {
+			return messageText(msg), true
+		}
+	}
+	return "", false
+}
+
+// messageText returns the text of a request message, whose content is a
+// string or a list of text parts
+func messageText(msg map[string]interface{}) string {
+	if content, ok := msg["content"].(string); ok {
+		return content
+	}
+	parts, _ := msg["content"].([]interface{})
+	var text strings.Builder
+	for _, p := range parts {
+		part, _ := p.(map[string]interface{})
+		s, _ := part["text"].(string)
+		text.WriteString(s)
+	}
+	return text.String()
+}
+
+func TestResultTransformerCapsToolResult(t *testing.T) {
+	fake := agenttest.NewFakeModel(
+		agenttest.FakeReply{ToolCalls: []agenttest.FakeToolCall{{ID: "call_a", Name: "dump", Arguments: "{}"}}},
+		agenttest.FakeReply{Content: "done"},
+	)
+	dump := newFuncTool("dump", func(context.Context) (interface{}, error) {
+		return strings.Repeat("x", 5000), nil
+	})
+	a := newTestAgent(t, fake, dump)
+	if err := a.Configure(map[string]interface{}{"model": "fake", "result_transformer": core.TruncateResult(100)}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "dump it"}); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	requests := fake.Requests()
+	reply, ok := toolReply(requests[len(requests)-1], "call_a")
+	if !ok {
+		t.Fatal("no tool reply sent to the model")
+	}
+	if want := strings.Repeat("x", 100) + "... [truncated 4900 characters]"; reply != want {
+		t.Errorf("tool reply has %d characters, want the result capped at 100: %.120s", len(reply), reply)
+	}
+}
+
+// agentEvents runs the agent on the message as the node of a graph
+// streaming debug events, and returns the events
+func agentEvents(t *testing.T, a agent.Agent, content string) []core.Event {
+	t.Helper()
+	g := core.NewStateGraph[string]()
+	g.SetStreamConfig(core.StreamConfig{Modes: []core.StreamMode{core.StreamDebug}, BufferSize: 256})
+	g.AddNode("agent", func(ctx context.Context, s string) (string, error) {
+		replies, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: s})
+		if err != nil {
+			return s, err
+		}
+		return replies[len(replies)-1].Content, nil
+	})
+	g.SetEntryPoint("agent")
+	g.AddConditionalEdges("agent", func(string) ([]string, error) { return []string{core.END}, nil }, nil)
+	r, err := g.Compile()
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	stream, wait := r.InvokeStreaming(context.Background(), content)
+	var events []core.Event
+	for evt := range stream {
+		if graphEvent, ok := evt.Data.(core.Event); ok {
+			events = append(events, graphEvent)
+		}
+	}
+	if _, err := wait(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return events
+}
+
+func TestSeedReachesRequestAndEvents(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "hi", Fingerprint: "fp_123"})
+	a := newTestAgent(t, fake)
+	if err := a.Configure(map[string]interface{}{"model": "fake", "seed": 42}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	events := agentEvents(t, a, "hello")
+	if seed := fake.Requests()[0]["seed"]; seed != float64(42) {
+		t.Errorf("request seed = %v, want 42", seed)
+	}
+	var end *core.Event
+	for i, evt := range events {
+		if evt.Type == core.EventChatModelEnd {
+			end = &events[i]
+		}
+	}
+	if end == nil {
+		t.Fatal("no chat model end event")
+	}
+	if end.Metadata["system_fingerprint"] != "fp_123" || end.Metadata["seed"] != int64(42) {
+		t.Errorf("chat model end metadata = %v, want the fingerprint and seed", end.Metadata)
+	}
+}
+
+func TestReasoningDeltaKeptApartFromContent(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Reasoning: "6 times 7 is 42", Content: "42"})
+	a := newTestAgent(t, fake)
+
+	replies, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "6*7?"})
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	reply := replies[len(replies)-1]
+	if reply.Reasoning != "6 times 7 is 42" {
+		t.Errorf("reasoning = %q, want the streamed reasoning", reply.Reasoning)
+	}
+	if reply.Content != "42" {
+		t.Errorf("content = %q, want the answer without the reasoning", reply.Content)
+	}
+}
+
+func TestRequiredToolChoiceAnsweredWithContent(t *testing.T) {
+	lookup := func() core.Tool {
+		return newFuncTool("lookup", func(context.Context) (interface{}, error) { return "42", nil })
+	}
+	configure := func(t *testing.T, a agent.Agent, policy string) {
+		t.Helper()
+		if err := a.Configure(map[string]interface{}{"model": "fake", "tool_choice": "required", "tool_choice_mismatch": policy}); err != nil {
+			t.Fatalf("Configure: %v", err)
+		}
+	}
+	ask := core.Message{Role: core.RoleUser, Content: "look it up"}
+
+	t.Run("error", func(t *testing.T) {
+		fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "I know it already"})
+		a := newTestAgent(t, fake, lookup())
+		configure(t, a, agent.MismatchError)
+		if _, err := a.ProcessMessage(context.Background(), ask); !errors.Is(err, agent.ErrToolChoiceMismatch) {
+			t.Fatalf("ProcessMessage = %v, want ErrToolChoiceMismatch", err)
+		}
+	})
+
+	t.Run("reprompt", func(t *testing.T) {
+		fake := agenttest.NewFakeModel(
+			agenttest.FakeReply{Content: "I know it already"},
+			agenttest.FakeReply{ToolCalls: []agenttest.FakeToolCall{{ID: "call_a", Name: "lookup", Arguments: "{}"}}},
+			agenttest.FakeReply{Content: "it is 42"},
+		)
+		a := newTestAgent(t, fake, lookup())
+		configure(t, a, agent.MismatchReprompt)
+		replies, err := a.ProcessMessage(context.Background(), ask)
+		if err != nil {
+			t.Fatalf("ProcessMessage: %v", err)
+		}
+		if got := replies[len(replies)-1].Content; got != "it is 42" {
+			t.Errorf("answer = %q, want the one after the tool call", got)
+		}
+		if len(fake.Requests()) != 3 {
+			t.Errorf("model got %d requests, want a re-prompt", len(fake.Requests()))
+		}
+	})
+
+	t.Run("pass through", func(t *testing.T) {
+		fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "I know it already"})
+		a := newTestAgent(t, fake, lookup())
+		configure(t, a, agent.MismatchPassThrough)
+		replies, err := a.ProcessMessage(context.Background(), ask)
+		if err != nil {
+			t.Fatalf("ProcessMessage: %v", err)
+		}
+		if got := replies[len(replies)-1].Content; got != "I know it already" {
+			t.Errorf("answer = %q, want the plain content", got)
+		}
+	})
+}
+
+func TestCorrelationIDReachesReply(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "hi"})
+	a := newTestAgent(t, fake)
+	if err := a.Configure(map[string]interface{}{"model": "fake", "metadata_context": []string{"tenant"}}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	replies, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hello", Metadata: map[string]interface{}{
+		core.MetadataCorrelationID: "corr-1",
+		"tenant":                   "acme",
+	}})
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if len(replies) != 1 || replies[0].Metadata[core.MetadataCorrelationID] != "corr-1" {
+		t.Errorf("replies = %+v, want the input's correlation ID", replies)
+	}
+	if _, ok := replies[0].Metadata["tenant"]; ok {
+		t.Errorf("reply metadata = %v, want only the propagated keys", replies[0].Metadata)
+	}
+	messages, _ := fake.Requests()[0]["messages"].([]interface{})
+	last, _ := messages[len(messages)-1].(map[string]interface{})
+	if content := messageText(last); !strings.Contains(content, `"tenant":"acme"`) || strings.Contains(content, "corr-1") {
+		t.Errorf("user message = %q, want only the context keys shown to the model", content)
+	}
+}
+
+func TestInvalidToolNameRejected(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "hi"})
+	a := newTestAgent(t, fake, newFuncTool("my tool!", func(ctx context.Context) (interface{}, error) { return "ok", nil }))
+
+	_, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hello"})
+	if !errors.Is(err, agent.ErrInvalidToolName) || !strings.Contains(err.Error(), `"my tool!"`) {
+		t.Errorf("ProcessMessage error = %v, want ErrInvalidToolName naming the tool", err)
+	}
+	if n := len(fake.Requests()); n != 0 {
+		t.Errorf("%d requests sent, want none", n)
+	}
+}
+
+func TestValidateToolName(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		valid bool
+	}{
+		{"get_weather", true},
+		{"lookup-user2", true},
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 65), false},
+		{"", false},
+		{"my tool", false},
+		{"weather.get", false},
+	} {
+		if err := agent.ValidateToolName(tt.name); (err == nil) != tt.valid {
+			t.Errorf("ValidateToolName(%q) = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestToolTraceOfTwoNodeRun(t *testing.T) {
+	toolAgent := func(tool, args string) agent.Agent {
+		fake := agenttest.NewFakeModel(
+			agenttest.FakeReply{ToolCalls: []agenttest.FakeToolCall{{ID: "call_" + tool, Name: tool, Arguments: args}}},
+			agenttest.FakeReply{Content: "done"},
+		)
+		return newTestAgent(t, fake, newFuncTool(tool, func(context.Context) (interface{}, error) {
+			return tool + " result", nil
+		}))
+	}
+	agents := map[string]agent.Agent{
+		"research": toolAgent("search", `{"q":"go"}`),
+		"write":    toolAgent("draft", `{"topic":"go"}`),
+	}
+
+	g := core.NewStateGraph[string]()
+	g.SetStreamConfig(core.StreamConfig{})
+	for name, a := range agents {
+		a := a
+		g.AddNode(name, func(ctx context.Context, s string) (string, error) {
+			replies, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: s})
+			if err != nil {
+				return s, err
+			}
+			return replies[len(replies)-1].Content, nil
+		})
+	}
+	g.SetEntryPoint("research")
+	g.AddConditionalEdges("research", func(string) ([]string, error) { return []string{"write"}, nil }, nil)
+	g.AddConditionalEdges("write", func(string) ([]string, error) { return []string{core.END}, nil }, nil)
+	r, err := g.Compile()
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	trace := core.NewToolTrace()
+	if _, err := r.InvokeWithConfig(context.Background(), "go", core.InvokeConfig{ToolTrace: trace}); err != nil {
+		t.Fatalf("InvokeWithConfig: %v", err)
+	}
+	calls := trace.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("trace has %d calls, want 2: %+v", len(calls), calls)
+	}
+	for i, want := range []core.ToolCallRecord{
+		{Node: "research", Tool: "search", Arguments: `{"q":"go"}`, Result: "search result"},
+		{Node: "write", Tool: "draft", Arguments: `{"topic":"go"}`, Result: "draft result"},
+	} {
+		got := calls[i]
+		if got.Node != want.Node || got.Tool != want.Tool || got.Arguments != want.Arguments || got.Result != want.Result || got.Error != "" {
+			t.Errorf("call %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if calls[1].Start.Before(calls[0].Start) {
+		t.Error("calls aren't in the order they were made")
+	}
+}
+
+func TestBiasesAndPenaltiesReachRequest(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "hi"})
+	a := newTestAgent(t, fake)
+	if err := a.Configure(map[string]interface{}{
+		"model":             "fake",
+		"logit_bias":        map[int]int{50256: -100, 1734: 5},
+		"presence_penalty":  0.5,
+		"frequency_penalty": -1,
+	}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hello"}); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+
+	request := fake.Requests()[0]
+	bias, _ := request["logit_bias"].(map[string]interface{})
+	if bias["50256"] != float64(-100) || bias["1734"] != float64(5) {
+		t.Errorf("logit_bias = %v, want the configured biases", request["logit_bias"])
+	}
+	if request["presence_penalty"] != 0.5 || request["frequency_penalty"] != float64(-1) {
+		t.Errorf("penalties = %v, %v, want 0.5 and -1", request["presence_penalty"], request["frequency_penalty"])
+	}
+}
+
+func TestBiasesAndPenaltiesOutOfRange(t *testing.T) {
+	a := newTestAgent(t, agenttest.NewFakeModel())
+	for _, config := range []map[string]interface{}{
+		{"logit_bias": map[string]int{"50256": 101}},
+		{"logit_bias": map[string]int{"<|endoftext|>": 1}},
+		{"logit_bias": map[string]interface{}{"50256": 1.5}},
+		{"presence_penalty": 2.5},
+		{"frequency_penalty": -3},
+		{"frequency_penalty": "high"},
+	} {
+		if err := a.Configure(config); err == nil {
+			t.Errorf("Configure(%v) accepted an invalid value", config)
+		}
+	}
+}
+
+func TestToolLoopStopsAtMaxIterations(t *testing.T) {
+	for _, tt := range []struct {
+		config map[string]interface{}
+		want   int
+	}{
+		{map[string]interface{}{"model": "fake", "max_tool_iterations": 3}, 3},
+		{map[string]interface{}{"model": "fake"}, 10},
+	} {
+		// The model asks for the tool every time
+		replies := make([]agenttest.FakeReply, 20)
+		for i := range replies {
+			replies[i] = agenttest.FakeReply{Content: "still looking", ToolCalls: []agenttest.FakeToolCall{{ID: fmt.Sprintf("call_%d", i), Name: "search", Arguments: "{}"}}}
+		}
+		fake := agenttest.NewFakeModel(replies...)
+		a := newTestAgent(t, fake, newFuncTool("search", func(context.Context) (interface{}, error) {
+			return "nothing", nil
+		}))
+		if err := a.Configure(tt.config); err != nil {
+			t.Fatalf("Configure: %v", err)
+		}
+
+		out, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "find it"})
+		if err != nil {
+			t.Fatalf("ProcessMessage: %v", err)
+		}
+		if n := len(fake.Requests()); n != tt.want {
+			t.Errorf("%d model requests, want %d", n, tt.want)
+		}
+		if len(out) != 1 || out[0].Content != "still looking" || out[0].Metadata["warning"] == nil {
+			t.Errorf("replies = %+v, want the content so far with a warning", out)
+		}
+	}
+}
+
+// blockingBody streams one chunk, then blocks until it is closed
+type blockingBody struct {
+	first  io.Reader
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (b *blockingBody) Read(p []byte) (int, error) {
+	if n, _ := b.first.Read(p); n > 0 {
+		return n, nil
+	}
+	<-b.closed
+	return 0, io.ErrClosedPipe
+}
+
+func (b *blockingBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+func TestCancelClosesModelStream(t *testing.T) {
+	body := &blockingBody{
+		first:  strings.NewReader(`data: {"id":"c1","object":"chat.completion.chunk","created":1,"model":"fake","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}` + "\n\n"),
+		closed: make(chan struct{}),
+	}
+	streaming := make(chan struct{})
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		close(streaming)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       body,
+			Request:    req,
+		}, nil
+	})}
+	a := agent.NewOpenAIAgent("test", "key", nil, agent.WithHTTPClient(client))
+	if err := a.Configure(map[string]interface{}{"model": "fake"}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "hello"})
+		done <- err
+	}()
+	<-streaming
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ProcessMessage = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessMessage didn't return after the cancel")
+	}
+	select {
+	case <-body.closed:
+	default:
+		t.Error("the model stream wasn't closed")
+	}
+}
+
+func TestInvalidResponseReprompted(t *testing.T) {
+	fake := agenttest.NewFakeModel(
+		agenttest.FakeReply{Content: "sure, here it is: 42"},
+		agenttest.FakeReply{Content: `{"answer":42}`},
+	)
+	a := newTestAgent(t, fake)
+	var validator agent.ResponseValidator = func(content string) error {
+		if !json.Valid([]byte(content)) {
+			return errors.New("it is not JSON")
+		}
+		return nil
+	}
+	if err := a.Configure(map[string]interface{}{"model": "fake", "response_validator": validator}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	replies, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "answer in JSON"})
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if replies[len(replies)-1].Content != `{"answer":42}` {
+		t.Errorf("replies = %+v, want the corrected answer", replies)
+	}
+	requests := fake.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("%d model requests, want one re-prompt", len(requests))
+	}
+	messages, _ := requests[1]["messages"].([]interface{})
+	last, _ := messages[len(messages)-1].(map[string]interface{})
+	if text := messageText(last); !strings.Contains(text, "invalid because it is not JSON") {
+		t.Errorf("re-prompt = %q, want the validation error", text)
+	}
+}
+
+func TestInvalidResponseGivesUp(t *testing.T) {
+	fake := agenttest.NewFakeModel()
+	a := newTestAgent(t, fake)
+	var validator agent.ResponseValidator = func(string) error { return errors.New("never good enough") }
+	if err := a.Configure(map[string]interface{}{"model": "fake", "response_validator": validator, "response_validation_retries": 1}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	_, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hi"})
+	if !errors.Is(err, agent.ErrInvalidResponse) || !strings.Contains(err.Error(), "never good enough") {
+		t.Errorf("ProcessMessage = %v, want ErrInvalidResponse with the validator's error", err)
+	}
+	if n := len(fake.Requests()); n != 2 {
+		t.Errorf("%d model requests, want the first and one retry", n)
+	}
+}
+
+// failingModel answers requests for the given model with the status, and
+// passes the others on to next
+func failingModel(model string, status int, next http.RoundTripper) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		var request struct {
+			Model string `json:"model"`
+		}
+		json.Unmarshal(body, &request)
+		if request.Model != model {
+			req.Body = io.NopCloser(strings.NewReader(string(body)))
+			return next.RoundTrip(req)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}, "Retry-After-Ms": []string{"1"}},
+			Body:       io.NopCloser(strings.NewReader(`{"error":{"message":"unavailable","type":"server_error"}}`)),
+			Request:    req,
+		}, nil
+	})
+}
+
+func TestFallbackModelAnswersForFailingPrimary(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "from the secondary"})
+	a := agent.NewOpenAIAgent("test", "key", nil, agent.WithHTTPClient(&http.Client{Transport: failingModel("primary", http.StatusServiceUnavailable, fake)}))
+	if err := a.Configure(map[string]interface{}{
+		"model":          "primary",
+		"model_fallback": []string{"secondary"},
+		"retry_policy":   core.RetryPolicy{MaxAttempts: 1},
+	}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	replies, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hi"})
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	reply := replies[len(replies)-1]
+	if reply.Content != "from the secondary" || reply.Metadata["model"] != "secondary" {
+		t.Errorf("reply = %+v, want the secondary's answer recording its model", reply)
+	}
+	if from, _ := reply.Metadata["fallback_from"].([]string); len(from) != 1 || from[0] != "primary" {
+		t.Errorf("fallback_from = %v, want the primary", reply.Metadata["fallback_from"])
+	}
+	if requests := fake.Requests(); len(requests) != 1 || requests[0]["model"] != "secondary" {
+		t.Errorf("requests reaching the secondary = %v", requests)
+	}
+}
+
+func TestBadRequestDoesntFallBack(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "from the secondary"})
+	a := agent.NewOpenAIAgent("test", "key", nil, agent.WithHTTPClient(&http.Client{Transport: failingModel("primary", http.StatusBadRequest, fake)}))
+	if err := a.Configure(map[string]interface{}{
+		"model":          "primary",
+		"model_fallback": []string{"secondary"},
+		"retry_policy":   core.RetryPolicy{MaxAttempts: 1},
+	}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hi"}); err == nil {
+		t.Error("a bad request succeeded")
+	}
+	if n := len(fake.Requests()); n != 0 {
+		t.Errorf("the secondary got %d requests after a bad request, want none", n)
+	}
+}
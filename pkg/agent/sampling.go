@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Ranges the OpenAI API accepts for token biases and penalties
+const (
+	maxLogitBias = 100
+	maxPenalty   = 2.0
+)
+
+// parseLogitBias converts a logit_bias config value, mapping token IDs to
+// biases, to the form the API takes. Token IDs may be strings or integers.
+func parseLogitBias(raw interface{}) (map[string]int64, error) {
+	bias := make(map[string]int64)
+	add := func(token string, v interface{}) error {
+		if _, err := strconv.ParseInt(token, 10, 64); err != nil {
+			return fmt.Errorf("logit_bias token %q must be a token ID", token)
+		}
+		b, err := toInt64(v)
+		if err != nil {
+			return fmt.Errorf("logit_bias for token %s must be an integer: %w", token, err)
+		}
+		if b < -maxLogitBias || b > maxLogitBias {
+			return fmt.Errorf("logit_bias for token %s must be between -%d and %d", token, maxLogitBias, maxLogitBias)
+		}
+		bias[token] = b
+		return nil
+	}
+
+	switch m := raw.(type) {
+	case map[string]int64:
+		for token, v := range m {
+			if err := add(token, v); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]int:
+		for token, v := range m {
+			if err := add(token, v); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for token, v := range m {
+			if err := add(token, v); err != nil {
+				return nil, err
+			}
+		}
+	case map[int]int:
+		for token, v := range m {
+			if err := add(strconv.Itoa(token), v); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("logit_bias must be a map of token IDs to integers")
+	}
+	return bias, nil
+}
+
+// parsePenalty validates a presence_penalty or frequency_penalty config value
+func parsePenalty(key string, raw interface{}) (float64, error) {
+	var p float64
+	switch v := raw.(type) {
+	case float64:
+		p = v
+	case float32:
+		p = float64(v)
+	case int:
+		p = float64(v)
+	case int64:
+		p = float64(v)
+	default:
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+	if p < -maxPenalty || p > maxPenalty {
+		return 0, fmt.Errorf("%s must be between -2 and 2", key)
+	}
+	return p, nil
+}
@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/openai/openai-go"
+)
+
+// EventStreamGuardStop is emitted when a stream guard cuts off a model's
+// output mid-stream
+const EventStreamGuardStop core.EventType = "on_stream_guard_stop"
+
+// defaultStreamGuardInterval is how many streamed tokens pass between guard
+// checks when neither the agent nor the guard sets an interval
+const defaultStreamGuardInterval = 20
+
+// StreamGuard checks a model's output while it streams, so that disallowed
+// content is cut off as soon as it appears instead of after the full reply.
+// Tokens are held back from the token stream until a check has passed them.
+type StreamGuard interface {
+	// Check is called with the text accumulated so far, every few tokens
+	// and once more when the stream ends. Returning stop aborts the
+	// stream and replaces the output with the agent's refusal.
+	Check(ctx context.Context, text string) (stop bool, reason string, err error)
+}
+
+// guardInterval is implemented by guards that choose how many tokens pass
+// between checks
+type guardInterval interface {
+	Interval() int
+}
+
+// RegexGuard stops output that matches any of its patterns
+type RegexGuard struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRegexGuard compiles the patterns into a guard
+func NewRegexGuard(patterns ...string) (*RegexGuard, error) {
+	g := &RegexGuard{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream guard pattern %q: %w", p, err)
+		}
+		g.patterns = append(g.patterns, re)
+	}
+	return g, nil
+}
+
+// Check stops the stream when the text matches a pattern
+func (g *RegexGuard) Check(ctx context.Context, text string) (bool, string, error) {
+	for _, re := range g.patterns {
+		if re.MatchString(text) {
+			return true, fmt.Sprintf("matched pattern %s", re), nil
+		}
+	}
+	return false, "", nil
+}
+
+// ModerationGuard checks streamed output with a Moderator. Calling a
+// moderation endpoint for every token would stall the stream, so the text
+// is checked in batches of tokens.
+type ModerationGuard struct {
+	moderator Moderator
+	batch     int
+}
+
+// NewModerationGuard creates a guard checking output with the moderator
+// once every batch tokens. A batch of zero or less uses 64 tokens.
+func NewModerationGuard(moderator Moderator, batch int) *ModerationGuard {
+	if batch <= 0 {
+		batch = 64
+	}
+	return &ModerationGuard{moderator: moderator, batch: batch}
+}
+
+// Interval returns the batch size
+func (g *ModerationGuard) Interval() int {
+	return g.batch
+}
+
+// Check stops the stream when the moderator flags the text
+func (g *ModerationGuard) Check(ctx context.Context, text string) (bool, string, error) {
+	flagged, categories, err := g.moderator.Check(ctx, text)
+	if err != nil || !flagged {
+		return false, "", err
+	}
+	return true, "flagged by moderation: " + strings.Join(categories, ", "), nil
+}
+
+// streamGuardRun applies a stream guard to one streamed completion
+type streamGuardRun struct {
+	guard    StreamGuard
+	interval int
+
+	text    strings.Builder
+	pending []string
+	tokens  int
+	since   int
+
+	// reason is set once the guard stopped the stream
+	reason string
+}
+
+// newStreamGuardRun returns the guard state for a completion, or nil when
+// the agent has no guard
+func (a *OpenAIAgent) newStreamGuardRun() *streamGuardRun {
+	if a.streamGuard == nil {
+		return nil
+	}
+	interval := a.streamGuardInterval
+	if interval <= 0 {
+		if g, ok := a.streamGuard.(guardInterval); ok {
+			interval = g.Interval()
+		}
+	}
+	if interval <= 0 {
+		interval = defaultStreamGuardInterval
+	}
+	return &streamGuardRun{guard: a.streamGuard, interval: interval}
+}
+
+// add takes a content token and reports whether the stream must stop. Tokens
+// that passed a check are returned for emission.
+func (r *streamGuardRun) add(ctx context.Context, token string) ([]string, bool, error) {
+	r.text.WriteString(token)
+	r.pending = append(r.pending, token)
+	r.tokens++
+	r.since++
+	if r.since < r.interval {
+		return nil, false, nil
+	}
+	return r.check(ctx)
+}
+
+// finish checks the text that arrived since the last check
+func (r *streamGuardRun) finish(ctx context.Context) ([]string, bool, error) {
+	if r.since == 0 {
+		return nil, false, nil
+	}
+	return r.check(ctx)
+}
+
+func (r *streamGuardRun) check(ctx context.Context) ([]string, bool, error) {
+	r.since = 0
+	stop, reason, err := r.guard.Check(ctx, r.text.String())
+	if err != nil {
+		return nil, false, fmt.Errorf("stream guard check failed: %w", err)
+	}
+	if stop {
+		r.reason = reason
+		r.pending = nil
+		return nil, true, nil
+	}
+	passed := r.pending
+	r.pending = nil
+	return passed, false, nil
+}
+
+// estimateUsage estimates the usage of a stream the guard stopped: the
+// prompt at about four characters per token, and a token per streamed delta
+func (r *streamGuardRun) estimateUsage(messages []openai.ChatCompletionMessageParamUnion) core.Usage {
+	prompt := 0
+	if data, err := json.Marshal(messages); err == nil {
+		prompt = (utf8.RuneCount(data) + 3) / 4
+	}
+	return core.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: r.tokens,
+		TotalTokens:      prompt + r.tokens,
+	}
+}
@@ -0,0 +1,46 @@
+package agent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func TestStreamGuardStopRecordsUsage(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "the password is hunter2"})
+	a := newTestAgent(t, fake)
+	guard, err := agent.NewRegexGuard(`password`)
+	if err != nil {
+		t.Fatalf("NewRegexGuard: %v", err)
+	}
+	if err := a.Configure(map[string]interface{}{
+		"model":                 "fake",
+		"stream_guard":          guard,
+		"stream_guard_interval": 1,
+		"stream_guard_refusal":  "I can't share that.",
+	}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	budget := core.NewTokenBudget(1000)
+	ctx := core.WithTokenBudget(context.Background(), budget)
+	replies, err := a.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: "what's the password?"})
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if len(replies) != 1 || replies[0].Content != "I can't share that." || replies[0].Metadata["stream_guard"] == nil {
+		t.Fatalf("replies = %+v, want the refusal", replies)
+	}
+
+	// The stream stopped before its usage chunk, so the usage is estimated
+	usage := a.(*agent.OpenAIAgent).Usage()
+	if usage.Requests != 1 || usage.PromptTokens == 0 || usage.CompletionTokens != 1 {
+		t.Errorf("usage = %+v, want one request with estimated prompt tokens and the streamed delta", usage)
+	}
+	if want := usage.PromptTokens + usage.CompletionTokens; budget.Used() != want {
+		t.Errorf("budget used = %d, want %d", budget.Used(), want)
+	}
+}
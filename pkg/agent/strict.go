@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrInvalidToolArguments is returned in strict mode when the model keeps
+	// calling a tool with arguments that don't match its schema
+	ErrInvalidToolArguments = errors.New("invalid tool arguments")
+)
+
+// defaultStrictToolRetries is how often the model may correct invalid
+// arguments per request when strict_tool_retries isn't configured
+const defaultStrictToolRetries = 2
+
+// StrictSchema returns a copy of a tool schema in the form OpenAI requires
+// for strict function calling, along with a description of every change:
+// objects get additionalProperties false, and optional properties become
+// required but nullable. The original schema is left untouched.
+func StrictSchema(schema map[string]interface{}) (map[string]interface{}, []string) {
+	var changes []string
+	strict := strictObject(schema, "", &changes)
+	return strict, changes
+}
+
+// strictObject adjusts an object schema and the object schemas nested in it
+func strictObject(schema map[string]interface{}, path string, changes *[]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(schema)+1)
+	for k, v := range schema {
+		out[k] = v
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		out["items"] = strictObject(items, path+"[]", changes)
+	}
+
+	properties, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		return out
+	}
+
+	if v, ok := schema["additionalProperties"].(bool); !ok || v {
+		out["additionalProperties"] = false
+		*changes = append(*changes, fmt.Sprintf("%s: set additionalProperties to false", displayPath(path)))
+	}
+
+	required := requiredSet(schema)
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	strictProps := make(map[string]interface{}, len(properties))
+	for _, name := range names {
+		prop, ok := properties[name].(map[string]interface{})
+		if !ok {
+			strictProps[name] = properties[name]
+			continue
+		}
+		prop = strictObject(prop, joinPath(path, name), changes)
+		if !required[name] {
+			prop = nullable(prop)
+			*changes = append(*changes, fmt.Sprintf("%s: optional, made required and nullable", joinPath(path, name)))
+		}
+		strictProps[name] = prop
+	}
+	out["properties"] = strictProps
+	out["required"] = names
+	return out
+}
+
+// nullable returns a copy of a property schema that also accepts null
+func nullable(prop map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(prop))
+	for k, v := range prop {
+		out[k] = v
+	}
+	switch t := prop["type"].(type) {
+	case string:
+		out["type"] = []interface{}{t, "null"}
+	case []interface{}:
+		out["type"] = append(append([]interface{}(nil), t...), "null")
+	}
+	return out
+}
+
+// relaxArgs reverses the nullable adjustment of StrictSchema on arguments,
+// dropping nulls the model sent for properties that are optional in the
+// original schema
+func relaxArgs(schema map[string]interface{}, args map[string]interface{}) map[string]interface{} {
+	properties, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		return args
+	}
+	required := requiredSet(schema)
+
+	out := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		if value == nil && !required[name] {
+			continue
+		}
+		prop, _ := properties[name].(map[string]interface{})
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if prop != nil {
+				value = relaxArgs(prop, v)
+			}
+		case []interface{}:
+			if items, ok := prop["items"].(map[string]interface{}); ok {
+				relaxed := make([]interface{}, len(v))
+				for i, item := range v {
+					if obj, ok := item.(map[string]interface{}); ok {
+						relaxed[i] = relaxArgs(items, obj)
+					} else {
+						relaxed[i] = item
+					}
+				}
+				value = relaxed
+			}
+		}
+		out[name] = value
+	}
+	return out
+}
+
+// requiredSet returns the required properties of an object schema
+func requiredSet(schema map[string]interface{}) map[string]bool {
+	required := make(map[string]bool)
+	switch req := schema["required"].(type) {
+	case []string:
+		for _, name := range req {
+			required[name] = true
+		}
+	case []interface{}:
+		for _, name := range req {
+			if s, ok := name.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+	return required
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
@@ -0,0 +1,381 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// EventToolSelection is emitted when a tool selector picked the tools sent
+// with a request
+const EventToolSelection core.EventType = "on_tool_selection"
+
+// defaultToolSelectionTimeout bounds a tool selection when no timeout is set
+// with WithToolSelectionTimeout
+const defaultToolSelectionTimeout = 2 * time.Second
+
+// toolSelectionCacheSize is the number of queries whose selection is kept
+const toolSelectionCacheSize = 256
+
+// ToolScore is a tool picked by a tool selector and how relevant it is
+type ToolScore struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// ToolSelector picks the tools relevant to a request, so agents with many
+// tools only send those with it
+type ToolSelector interface {
+	// SelectTools returns the tools relevant to query, most relevant first
+	SelectTools(ctx context.Context, query string, tools []core.Tool) ([]ToolScore, error)
+}
+
+// WithToolSelector sends only the tools sel picks for each message as
+// function definitions, along with the mandatory tools (see
+// WithMandatoryTools). When the selection fails or times out, all tools are
+// sent.
+func WithToolSelector(sel ToolSelector) Option {
+	return func(o *agentOptions) {
+		o.toolSelector = sel
+	}
+}
+
+// WithMandatoryTools names tools sent with every request, whatever the tool
+// selector picks
+func WithMandatoryTools(names ...string) Option {
+	return func(o *agentOptions) {
+		o.mandatoryTools = append(o.mandatoryTools, names...)
+	}
+}
+
+// WithToolSelectionTimeout bounds how long tool selection may take
+func WithToolSelectionTimeout(timeout time.Duration) Option {
+	return func(o *agentOptions) {
+		o.toolSelectionTimeout = timeout
+	}
+}
+
+// toolSelection holds an agent's tool selector and the selections it made
+type toolSelection struct {
+	selector  ToolSelector
+	mandatory []string
+	timeout   time.Duration
+	cache     *toolSelectionCache
+}
+
+// toolSelection sets up tool selection, if a selector is configured
+func (o agentOptions) toolSelection() *toolSelection {
+	if o.toolSelector == nil {
+		return nil
+	}
+	timeout := o.toolSelectionTimeout
+	if timeout <= 0 {
+		timeout = defaultToolSelectionTimeout
+	}
+	return &toolSelection{
+		selector:  o.toolSelector,
+		mandatory: o.mandatoryTools,
+		timeout:   timeout,
+		cache:     newToolSelectionCache(toolSelectionCacheSize),
+	}
+}
+
+// selectTools returns the tools to send for query: all of them without a
+// selector, otherwise those the selector picks and the mandatory ones
+func (a *OpenAIAgent) selectTools(ctx context.Context, query string) []core.Tool {
+	sel := a.toolSelection
+	if sel == nil || len(a.tools) == 0 {
+		return a.tools
+	}
+
+	names := make([]string, len(a.tools))
+	for i, tool := range a.tools {
+		names[i] = tool.Name()
+	}
+	key := normalizeQuery(query) + "\x00" + strings.Join(names, "\x00")
+
+	start := time.Now()
+	scores, cached := sel.cache.get(key)
+	if !cached {
+		var err error
+		scores, err = sel.run(ctx, query, a.tools)
+		if err != nil {
+			a.logger.Warn("Tool selection failed, sending all tools", "error", err)
+			core.EmitEvent(ctx, core.Event{
+				Type:      EventToolSelection,
+				Name:      a.id,
+				RunID:     core.RunIDFromContext(ctx),
+				Timestamp: time.Now(),
+				Metadata: map[string]interface{}{
+					"agent_id": a.id,
+					"tools":    names,
+					"error":    err.Error(),
+				},
+			})
+			return a.tools
+		}
+		sel.cache.put(key, scores)
+	}
+
+	keep := make(map[string]bool, len(scores)+len(sel.mandatory))
+	for _, score := range scores {
+		keep[score.Name] = true
+	}
+	for _, name := range sel.mandatory {
+		keep[name] = true
+	}
+	selected := make([]core.Tool, 0, len(keep))
+	selectedNames := make([]string, 0, len(keep))
+	for _, tool := range a.tools {
+		if keep[tool.Name()] {
+			selected = append(selected, tool)
+			selectedNames = append(selectedNames, tool.Name())
+		}
+	}
+
+	a.logger.Debug("Selected tools",
+		"tools", selectedNames,
+		"scores", scores,
+		"cached", cached,
+		"duration", time.Since(start))
+	core.EmitEvent(ctx, core.Event{
+		Type:      EventToolSelection,
+		Name:      a.id,
+		RunID:     core.RunIDFromContext(ctx),
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"agent_id":    a.id,
+			"tools":       selectedNames,
+			"scores":      scores,
+			"mandatory":   sel.mandatory,
+			"cached":      cached,
+			"duration_ms": time.Since(start).Milliseconds(),
+		},
+	})
+	return selected
+}
+
+// run calls the selector, giving up after the selection timeout even if the
+// selector ignores its context
+func (s *toolSelection) run(ctx context.Context, query string, tools []core.Tool) ([]ToolScore, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	type result struct {
+		scores []ToolScore
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		scores, err := s.selector.SelectTools(ctx, query, tools)
+		done <- result{scores, err}
+	}()
+	select {
+	case r := <-done:
+		return r.scores, r.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("tool selection: %w", ctx.Err())
+	}
+}
+
+// normalizeQuery reduces a query to its lowercased words, so queries that
+// only differ in case, punctuation or spacing share a cached selection
+func normalizeQuery(query string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// toolSelectionCache keeps the selections of the latest queries
+type toolSelectionCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string][]ToolScore
+	order   []string
+}
+
+func newToolSelectionCache(size int) *toolSelectionCache {
+	return &toolSelectionCache{size: size, entries: make(map[string][]ToolScore)}
+}
+
+func (c *toolSelectionCache) get(key string) ([]ToolScore, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	scores, ok := c.entries[key]
+	return scores, ok
+}
+
+// put caches a selection, evicting the oldest once the cache is full
+func (c *toolSelectionCache) put(key string, scores []ToolScore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		c.entries[key] = scores
+		return
+	}
+	if len(c.order) >= c.size {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[key] = scores
+	c.order = append(c.order, key)
+}
+
+// Embedder turns text into an embedding vector
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// EmbeddingSelector picks the tools whose name and description are most
+// similar to the query by cosine similarity of their embeddings. Tool
+// embeddings are computed once and reused.
+type EmbeddingSelector struct {
+	embedder Embedder
+	topK     int
+	minScore float64
+
+	mu      sync.Mutex
+	vectors map[string][]float64
+}
+
+// NewEmbeddingSelector creates a selector picking at most topK tools scoring
+// at least minScore; a topK of zero or less only applies minScore
+func NewEmbeddingSelector(embedder Embedder, topK int, minScore float64) *EmbeddingSelector {
+	return &EmbeddingSelector{
+		embedder: embedder,
+		topK:     topK,
+		minScore: minScore,
+		vectors:  make(map[string][]float64),
+	}
+}
+
+// SelectTools implements ToolSelector
+func (s *EmbeddingSelector) SelectTools(ctx context.Context, query string, tools []core.Tool) ([]ToolScore, error) {
+	queryVector, err := s.embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	scores := make([]ToolScore, 0, len(tools))
+	for _, tool := range tools {
+		vector, err := s.toolVector(ctx, tool)
+		if err != nil {
+			return nil, err
+		}
+		score := cosine(queryVector, vector)
+		if score >= s.minScore {
+			scores = append(scores, ToolScore{Name: tool.Name(), Score: score})
+		}
+	}
+	return topScores(scores, s.topK), nil
+}
+
+// toolVector returns the embedding of a tool's name and description
+func (s *EmbeddingSelector) toolVector(ctx context.Context, tool core.Tool) ([]float64, error) {
+	text := tool.Name() + ": " + tool.Description()
+	s.mu.Lock()
+	vector, ok := s.vectors[text]
+	s.mu.Unlock()
+	if ok {
+		return vector, nil
+	}
+	vector, err := s.embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed tool %s: %w", tool.Name(), err)
+	}
+	s.mu.Lock()
+	s.vectors[text] = vector
+	s.mu.Unlock()
+	return vector, nil
+}
+
+// ClassifierSelector asks a model, typically a small and cheap one, which
+// tools a request needs
+type ClassifierSelector struct {
+	classifier Agent
+	maxTools   int
+}
+
+// NewClassifierSelector creates a selector asking classifier for at most
+// maxTools tools; a maxTools of zero or less keeps all it picks
+func NewClassifierSelector(classifier Agent, maxTools int) *ClassifierSelector {
+	return &ClassifierSelector{classifier: classifier, maxTools: maxTools}
+}
+
+// SelectTools implements ToolSelector
+func (s *ClassifierSelector) SelectTools(ctx context.Context, query string, tools []core.Tool) ([]ToolScore, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Pick the tools needed to handle the request below. ")
+	prompt.WriteString(`Reply with only a JSON array of objects like {"name": "tool", "score": 0.9}, `)
+	prompt.WriteString("scoring each tool's relevance from 0 to 1, or [] if none is needed.\n\nTools:\n")
+	known := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		known[tool.Name()] = true
+		fmt.Fprintf(&prompt, "- %s: %s\n", tool.Name(), tool.Description())
+	}
+	prompt.WriteString("\nRequest:\n")
+	prompt.WriteString(query)
+
+	replies, err := s.classifier.ProcessMessage(ctx, core.Message{Role: core.RoleUser, Content: prompt.String()})
+	if err != nil {
+		return nil, fmt.Errorf("tool classifier failed: %w", err)
+	}
+	if len(replies) == 0 {
+		return nil, fmt.Errorf("tool classifier returned no reply")
+	}
+	content := replies[len(replies)-1].Content
+	start, end := strings.Index(content, "["), strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("tool classifier reply has no JSON array: %q", content)
+	}
+	var picked []ToolScore
+	if err := json.Unmarshal([]byte(content[start:end+1]), &picked); err != nil {
+		return nil, fmt.Errorf("failed to parse tool classifier reply: %w", err)
+	}
+
+	scores := make([]ToolScore, 0, len(picked))
+	for _, score := range picked {
+		if known[score.Name] {
+			scores = append(scores, score)
+		}
+	}
+	return topScores(scores, s.maxTools), nil
+}
+
+// topScores sorts scores, most relevant first, and keeps the first k when k
+// is positive
+func topScores(scores []ToolScore, k int) []ToolScore {
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	if k > 0 && len(scores) > k {
+		scores = scores[:k]
+	}
+	return scores
+}
+
+// cosine is the cosine similarity of two vectors, zero when they can't be
+// compared
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
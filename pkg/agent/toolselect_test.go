@@ -0,0 +1,108 @@
+package agent_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// keywordEmbedder embeds text by the topics it mentions
+type keywordEmbedder struct {
+	calls atomic.Int32
+}
+
+func (e *keywordEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	e.calls.Add(1)
+	var vector []float64
+	for _, topic := range []string{"weather", "stock", "email", "help"} {
+		if strings.Contains(strings.ToLower(text), topic) {
+			vector = append(vector, 1)
+		} else {
+			vector = append(vector, 0)
+		}
+	}
+	return vector, nil
+}
+
+// blockingSelector picks nothing until released, ignoring its context
+type blockingSelector struct {
+	release chan struct{}
+}
+
+func (s blockingSelector) SelectTools(ctx context.Context, query string, tools []core.Tool) ([]agent.ToolScore, error) {
+	<-s.release
+	return nil, nil
+}
+
+// requestTools returns the names of the tools sent with a request
+func requestTools(request map[string]interface{}) []string {
+	tools, _ := request["tools"].([]interface{})
+	var names []string
+	for _, tool := range tools {
+		function, _ := tool.(map[string]interface{})["function"].(map[string]interface{})
+		name, _ := function["name"].(string)
+		names = append(names, name)
+	}
+	return names
+}
+
+// newSelectingAgent creates an agent with tools on several topics
+func newSelectingAgent(t *testing.T, fake *agenttest.FakeModel, opts ...agent.Option) agent.Agent {
+	t.Helper()
+	opts = append(opts, agent.WithHTTPClient(&http.Client{Transport: fake}))
+	a := agent.NewOpenAIAgent("test", "key", nil, opts...)
+	if err := a.Configure(map[string]interface{}{"model": "fake"}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	for _, name := range []string{"weather", "stocks", "email", "help"} {
+		a.AddTool(newFuncTool(name, func(ctx context.Context) (interface{}, error) { return "ok", nil }))
+	}
+	return a
+}
+
+func TestToolSelectorSendsRelevantAndMandatoryTools(t *testing.T) {
+	fake := agenttest.NewFakeModel()
+	embedder := &keywordEmbedder{}
+	a := newSelectingAgent(t, fake,
+		agent.WithToolSelector(agent.NewEmbeddingSelector(embedder, 1, 0.5)),
+		agent.WithMandatoryTools("help"))
+
+	for _, query := range []string{"What's the weather?", "what's the WEATHER"} {
+		if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: query}); err != nil {
+			t.Fatalf("ProcessMessage: %v", err)
+		}
+	}
+	requests := fake.Requests()
+	for i, request := range requests {
+		if got := strings.Join(requestTools(request), ","); got != "weather,help" {
+			t.Errorf("request %d sent tools %s, want weather and the mandatory help", i, got)
+		}
+	}
+	// Four tool embeddings and one query; the second query is cached
+	if n := embedder.calls.Load(); n != 5 {
+		t.Errorf("embedder called %d times, want the similar query served from the cache", n)
+	}
+}
+
+func TestToolSelectionTimeoutSendsAllTools(t *testing.T) {
+	fake := agenttest.NewFakeModel()
+	selector := blockingSelector{release: make(chan struct{})}
+	t.Cleanup(func() { close(selector.release) })
+	a := newSelectingAgent(t, fake,
+		agent.WithToolSelector(selector),
+		agent.WithToolSelectionTimeout(10*time.Millisecond))
+
+	if _, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hi"}); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if got := strings.Join(requestTools(fake.Requests()[0]), ","); got != "weather,stocks,email,help" {
+		t.Errorf("sent tools %s, want all of them when selection times out", got)
+	}
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// Option configures how an agent is constructed
+type Option func(*agentOptions)
+
+// agentOptions holds construction options shared by all agent types
+type agentOptions struct {
+	// httpClient is used for all requests to the model provider
+	httpClient *http.Client
+
+	// circuitBreaker configures the agent's circuit breaker, if any
+	circuitBreaker *core.CircuitBreakerConfig
+
+	// memory holds conversation history per thread
+	memory MemoryStore
+
+	// requestHook and responseHook observe completion requests
+	requestHook  RequestHook
+	responseHook ResponseHook
+
+	// toolSelector, mandatoryTools and toolSelectionTimeout configure the
+	// selection of the tools sent with each request
+	toolSelector         ToolSelector
+	mandatoryTools       []string
+	toolSelectionTimeout time.Duration
+}
+
+// breaker creates the agent's own circuit breaker, if one is configured
+func (o agentOptions) breaker(id string) *core.CircuitBreaker {
+	if o.circuitBreaker == nil {
+		return nil
+	}
+	return core.NewCircuitBreaker(id, *o.circuitBreaker)
+}
+
+// WithCircuitBreaker gives the agent its own circuit breaker around model
+// requests. While it is open, ProcessMessage fails immediately with
+// core.ErrCircuitOpen.
+func WithCircuitBreaker(config core.CircuitBreakerConfig) Option {
+	return func(o *agentOptions) {
+		o.circuitBreaker = &config
+	}
+}
+
+// WithHTTPClient makes the agent send its requests through client
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *agentOptions) {
+		o.httpClient = client
+	}
+}
+
+// WithSharedTransport makes the agent send its requests through the
+// process-wide shared HTTP client, so that all agents using it multiplex over
+// a small pool of warm HTTP/2 connections instead of each holding their own
+func WithSharedTransport() Option {
+	return WithHTTPClient(SharedHTTPClient())
+}
+
+// TransportStats counts requests and connection reuse on the shared transport
+type TransportStats struct {
+	// Requests is the number of requests sent
+	Requests int64 `json:"requests"`
+
+	// ReusedConns is the number of requests that reused an idle connection
+	ReusedConns int64 `json:"reused_conns"`
+
+	// NewConns is the number of requests that had to dial a new connection
+	NewConns int64 `json:"new_conns"`
+}
+
+var (
+	sharedClientOnce sync.Once
+	sharedClient     *http.Client
+
+	sharedRequests    atomic.Int64
+	sharedReusedConns atomic.Int64
+	sharedNewConns    atomic.Int64
+)
+
+// SharedHTTPClient returns the process-wide HTTP client used by
+// WithSharedTransport. Its transport keeps enough idle connections per host
+// for bursts of parallel agent calls and prefers HTTP/2.
+func SharedHTTPClient() *http.Client {
+	sharedClientOnce.Do(func() {
+		transport := &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          256,
+			MaxIdleConnsPerHost:   64,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		}
+		sharedClient = &http.Client{Transport: &countingTransport{base: transport}}
+	})
+	return sharedClient
+}
+
+// SharedTransportStats returns connection reuse counters for the shared transport
+func SharedTransportStats() TransportStats {
+	return TransportStats{
+		Requests:    sharedRequests.Load(),
+		ReusedConns: sharedReusedConns.Load(),
+		NewConns:    sharedNewConns.Load(),
+	}
+}
+
+// countingTransport records whether each request reused a connection
+type countingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sharedRequests.Add(1)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				sharedReusedConns.Add(1)
+			} else {
+				sharedNewConns.Add(1)
+			}
+		},
+	}
+	return t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
@@ -0,0 +1,74 @@
+package agent_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+)
+
+// BenchmarkSharedTransport compares completion requests from parallel
+// agents sent through the shared client with agents holding a client each,
+// reporting the 99th percentile latency besides the mean
+func BenchmarkSharedTransport(b *testing.B) {
+	contentType, body := agenttest.OpenAI.Response(agenttest.FakeReply{Content: "ok"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", contentType)
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	b.Run("shared", func(b *testing.B) {
+		benchmarkClients(b, server.URL, agent.SharedHTTPClient)
+	})
+	b.Run("per-agent", func(b *testing.B) {
+		benchmarkClients(b, server.URL, func() *http.Client {
+			return &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+		})
+	})
+}
+
+// benchmarkClients sends requests to url from parallel goroutines, each
+// standing for an agent with the client newClient returns
+func benchmarkClients(b *testing.B, url string, newClient func() *http.Client) {
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+	)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		client := newClient()
+		var own []time.Duration
+		for pb.Next() {
+			started := time.Now()
+			resp, err := client.Post(url, "application/json", strings.NewReader(`{"model":"fake"}`))
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			own = append(own, time.Since(started))
+		}
+		mu.Lock()
+		latencies = append(latencies, own...)
+		mu.Unlock()
+	})
+	b.StopTimer()
+
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	// Nearest rank: the smallest latency no more than 1% of requests exceed
+	p99 := latencies[(len(latencies)*99+99)/100-1]
+	b.ReportMetric(float64(p99.Nanoseconds()), "p99-ns")
+}
@@ -0,0 +1,25 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidResponse is returned when the model's final reply still fails
+// the response validator after every re-prompt
+var ErrInvalidResponse = errors.New("model response failed validation")
+
+// ResponseValidator checks the content of a model's final reply, returning
+// an error describing what is wrong with it. Set one with the
+// response_validator config key.
+type ResponseValidator func(content string) error
+
+// defaultResponseValidationRetries bounds the re-prompts for an invalid
+// reply when no response_validation_retries is configured
+const defaultResponseValidationRetries = 2
+
+// invalidResponseMessage asks the model to correct a reply the validator
+// rejected
+func invalidResponseMessage(err error) string {
+	return fmt.Sprintf("Your response was invalid because %v. Please fix it and respond again.", err)
+}
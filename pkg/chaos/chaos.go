@@ -0,0 +1,332 @@
+// Package chaos injects failures, delays and malformed outputs into agents,
+// tools, nodes and model transports, so graphs can be checked against flaky
+// dependencies before production does it
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrInjected is the failure injected by ErrorRate
+	ErrInjected = errors.New("chaos: injected failure")
+
+	// ErrRateLimited is the failure injected by RateLimitEvery
+	ErrRateLimited = errors.New("chaos: injected rate limit")
+)
+
+// Faults configures what is injected. The zero value injects nothing.
+type Faults struct {
+	// ErrorRate is the share of calls, from 0 to 1, that fail with
+	// ErrInjected, or a 500 response from Transport
+	ErrorRate float64
+
+	// LatencyJitter delays every call by a random duration up to this
+	LatencyJitter time.Duration
+
+	// RateLimitEvery fails every Nth call with ErrRateLimited, or a 429
+	// response from Transport
+	RateLimitEvery int
+
+	// MalformedRate is the share of successful calls, from 0 to 1, whose
+	// output is corrupted: agent replies and tool call arguments are cut
+	// off mid-JSON, tool results become truncated text, node updates are
+	// lost and response bodies are truncated
+	MalformedRate float64
+
+	// Seed seeds the random decisions, so a sequence of calls gets the
+	// same faults every time
+	Seed uint64
+}
+
+// Stats counts what an injector did
+type Stats struct {
+	Calls      int
+	Errors     int
+	RateLimits int
+	Malformed  int
+	Delay      time.Duration
+}
+
+// fault is the outcome of a call
+type fault int
+
+const (
+	faultNone fault = iota
+	faultError
+	faultRateLimit
+	faultMalformed
+)
+
+// injector decides the faults of a sequence of calls
+type injector struct {
+	faults Faults
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	stats Stats
+}
+
+// newInjector creates an injector seeded from the faults
+func newInjector(faults Faults) *injector {
+	return &injector{faults: faults, rng: rand.New(rand.NewPCG(faults.Seed, faults.Seed))}
+}
+
+// next decides the delay and fault of the next call. Every call draws the
+// same random numbers, so faults only depend on the order of calls.
+func (in *injector) next() (time.Duration, fault) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	in.stats.Calls++
+	jitter, failRoll, malformedRoll := in.rng.Float64(), in.rng.Float64(), in.rng.Float64()
+
+	delay := time.Duration(jitter * float64(in.faults.LatencyJitter))
+	in.stats.Delay += delay
+
+	switch {
+	case in.faults.RateLimitEvery > 0 && in.stats.Calls%in.faults.RateLimitEvery == 0:
+		in.stats.RateLimits++
+		return delay, faultRateLimit
+	case failRoll < in.faults.ErrorRate:
+		in.stats.Errors++
+		return delay, faultError
+	case malformedRoll < in.faults.MalformedRate:
+		in.stats.Malformed++
+		return delay, faultMalformed
+	}
+	return delay, faultNone
+}
+
+// inject waits out the delay of the next call and returns its fault
+func (in *injector) inject(ctx context.Context) (fault, error) {
+	delay, f := in.next()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return faultNone, ctx.Err()
+		}
+	}
+	switch f {
+	case faultError:
+		return f, ErrInjected
+	case faultRateLimit:
+		return f, ErrRateLimited
+	}
+	return f, nil
+}
+
+// Stats returns what the injector did so far
+func (in *injector) Stats() Stats {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.stats
+}
+
+type injectorKey struct{}
+
+// WithFaults returns a context whose calls through chaos wrappers get these
+// faults instead of the wrappers' own, decided by one seeded sequence shared
+// by all wrappers. Run uses it to apply each scenario to the whole graph.
+func WithFaults(ctx context.Context, faults Faults) context.Context {
+	return context.WithValue(ctx, injectorKey{}, newInjector(faults))
+}
+
+// StatsFromContext returns what the faults attached with WithFaults did
+func StatsFromContext(ctx context.Context) (Stats, bool) {
+	in, ok := ctx.Value(injectorKey{}).(*injector)
+	if !ok {
+		return Stats{}, false
+	}
+	return in.Stats(), true
+}
+
+// wrapper holds the faults of a wrapped component
+type wrapper struct {
+	own *injector
+}
+
+// injector returns the context's injector, or the wrapper's own
+func (w wrapper) injector(ctx context.Context) *injector {
+	if in, ok := ctx.Value(injectorKey{}).(*injector); ok {
+		return in
+	}
+	return w.own
+}
+
+// garble cuts text off halfway and leaves an unterminated JSON fragment, like
+// a reply truncated by a dropped connection
+func garble(s string) string {
+	r := []rune(s)
+	return string(r[:len(r)/2]) + `{"`
+}
+
+// chaosAgent injects faults into an agent
+type chaosAgent struct {
+	agent.Agent
+	wrapper
+}
+
+// Agent wraps an agent so its ProcessMessage calls get faults. The wrapped
+// agent isn't called for failed calls.
+func Agent(a agent.Agent, faults Faults) agent.Agent {
+	return &chaosAgent{Agent: a, wrapper: wrapper{own: newInjector(faults)}}
+}
+
+// ProcessMessage processes the message, with faults
+func (a *chaosAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	f, err := a.injector(ctx).inject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out, err := a.Agent.ProcessMessage(ctx, msg)
+	if err != nil || f != faultMalformed || len(out) == 0 {
+		return out, err
+	}
+
+	out = append([]core.Message(nil), out...)
+	last := out[len(out)-1]
+	last.Content = garble(last.Content)
+	if len(last.ToolCalls) > 0 {
+		calls := append([]core.ToolCall(nil), last.ToolCalls...)
+		for i := range calls {
+			calls[i].Function.Arguments = garble(calls[i].Function.Arguments)
+		}
+		last.ToolCalls = calls
+	}
+	out[len(out)-1] = last
+	return out, nil
+}
+
+// chaosTool injects faults into a tool
+type chaosTool struct {
+	core.Tool
+	wrapper
+}
+
+// Tool wraps a tool so its executions get faults. Wrap the result with
+// core.WithToolCircuitBreaker to exercise the breaker.
+func Tool(t core.Tool, faults Faults) core.Tool {
+	return &chaosTool{Tool: t, wrapper: wrapper{own: newInjector(faults)}}
+}
+
+// Execute runs the tool, with faults
+func (t *chaosTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	f, err := t.injector(ctx).inject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := t.Tool.Execute(ctx, args)
+	if err != nil || f != faultMalformed {
+		return result, err
+	}
+	text, ok := result.(string)
+	if !ok {
+		data, _ := json.Marshal(result)
+		text = string(data)
+	}
+	return garble(text), nil
+}
+
+// Node wraps a node function so its runs get faults. A malformed run loses
+// its update and returns the state it was given. Set a retry policy on the
+// node to exercise retries.
+func Node[T any](fn func(ctx context.Context, state T) (T, error), faults Faults) func(ctx context.Context, state T) (T, error) {
+	w := wrapper{own: newInjector(faults)}
+	return func(ctx context.Context, state T) (T, error) {
+		f, err := w.injector(ctx).inject(ctx)
+		if err != nil {
+			return state, err
+		}
+		out, err := fn(ctx, state)
+		if err != nil || f != faultMalformed {
+			return out, err
+		}
+		return state, nil
+	}
+}
+
+// chaosTransport injects faults into model requests
+type chaosTransport struct {
+	next http.RoundTripper
+	wrapper
+}
+
+// Transport wraps an HTTP transport so model requests get faults, which
+// exercises an agent's own retries and circuit breaker. Failures are 500
+// and 429 responses in the OpenAI error format and malformed responses are
+// cut off halfway. A nil next uses http.DefaultTransport.
+func Transport(next http.RoundTripper, faults Faults) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &chaosTransport{next: next, wrapper: wrapper{own: newInjector(faults)}}
+}
+
+// RoundTrip sends the request, with faults
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f, err := t.injector(req.Context()).inject(req.Context())
+	switch {
+	case errors.Is(err, ErrInjected):
+		return errorResponse(req, http.StatusInternalServerError, "server_error", err), nil
+	case errors.Is(err, ErrRateLimited):
+		return errorResponse(req, http.StatusTooManyRequests, "rate_limit_exceeded", err), nil
+	case err != nil:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || f != faultMalformed {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	body = body[:len(body)/2]
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// errorResponse is a provider error response
+func errorResponse(req *http.Request, status int, code string, err error) *http.Response {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": err.Error(),
+			"type":    code,
+			"code":    code,
+		},
+	})
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
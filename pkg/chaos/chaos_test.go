@@ -0,0 +1,143 @@
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/agent/agenttest"
+	"github.com/forrestdevs/moego/pkg/chaos"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// outcomes runs the wrapped node n times and returns which calls failed
+func outcomes(fn func(ctx context.Context, n int) (int, error), n int) string {
+	var out []byte
+	for i := 0; i < n; i++ {
+		_, err := fn(context.Background(), i)
+		switch {
+		case errors.Is(err, chaos.ErrRateLimited):
+			out = append(out, 'R')
+		case errors.Is(err, chaos.ErrInjected):
+			out = append(out, 'E')
+		default:
+			out = append(out, '.')
+		}
+	}
+	return string(out)
+}
+
+func TestSeededFaultsRepeat(t *testing.T) {
+	increment := func(ctx context.Context, n int) (int, error) { return n + 1, nil }
+	faults := chaos.Faults{ErrorRate: 0.4, RateLimitEvery: 5, Seed: 7}
+
+	first := outcomes(chaos.Node(increment, faults), 30)
+	if again := outcomes(chaos.Node(increment, faults), 30); again != first {
+		t.Errorf("same seed injected %s, then %s", first, again)
+	}
+	for i, c := range first {
+		if (i+1)%5 == 0 && c != 'R' {
+			t.Errorf("call %d = %c, want every fifth call rate limited: %s", i+1, c, first)
+		}
+	}
+	faults.Seed = 8
+	if other := outcomes(chaos.Node(increment, faults), 30); other == first {
+		t.Errorf("seeds 7 and 8 injected the same faults %s", first)
+	}
+}
+
+// countGraph increments the state through a node that gets chaos, retried
+// by the graph
+func countGraph() *core.StateGraph[int] {
+	g := core.NewStateGraph[int]()
+	g.SetStreamConfig(core.StreamConfig{})
+	g.AddNode("count", chaos.Node(func(ctx context.Context, n int) (int, error) { return n + 1, nil }, chaos.Faults{}))
+	g.SetRetryPolicy("count", core.RetryPolicy{MaxAttempts: 5, InitialInterval: time.Millisecond, Jitter: core.NoJitter})
+	g.SetEntryPoint("count")
+	g.AddConditionalEdges("count", func(int) ([]string, error) { return []string{core.END}, nil }, nil)
+	return g
+}
+
+func TestRunRetriesNodeFaults(t *testing.T) {
+	chaos.Run(t, countGraph(), []chaos.Scenario[int]{
+		{
+			Name: "flaky",
+			// Seed 3 fails the first two attempts
+			Faults: chaos.Faults{ErrorRate: 0.5, Seed: 3, LatencyJitter: time.Millisecond},
+			Input:  1,
+			Check: func(final int, err error, stats chaos.Stats) error {
+				if err != nil || final != 2 || stats.Errors != 2 {
+					return fmt.Errorf("run = %d, %v after %d errors, want the retries to recover", final, err, stats.Errors)
+				}
+				return nil
+			},
+		},
+		{
+			Name:   "down",
+			Faults: chaos.Faults{ErrorRate: 1},
+			Check: func(final int, err error, stats chaos.Stats) error {
+				if !errors.Is(err, chaos.ErrInjected) || stats.Errors != 5 {
+					return fmt.Errorf("run failed with %v after %d errors, want every attempt to fail", err, stats.Errors)
+				}
+				return nil
+			},
+		},
+	})
+}
+
+func TestTransportExercisesAgentRetries(t *testing.T) {
+	fake := agenttest.NewFakeModel(agenttest.FakeReply{Content: "first"}, agenttest.FakeReply{Content: "second"})
+	transport := chaos.Transport(fake, chaos.Faults{RateLimitEvery: 2})
+	a := agent.NewOpenAIAgent("flaky", "key", nil, agent.WithHTTPClient(&http.Client{Transport: transport}))
+	if err := a.Configure(map[string]interface{}{
+		"model":        "fake",
+		"retry_policy": core.RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond, Jitter: core.NoJitter},
+	}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	for _, want := range []string{"first", "second"} {
+		replies, err := a.ProcessMessage(context.Background(), core.Message{Role: core.RoleUser, Content: "hi"})
+		if err != nil {
+			t.Fatalf("ProcessMessage: %v", err)
+		}
+		if replies[len(replies)-1].Content != want {
+			t.Errorf("reply = %q, want %q", replies[len(replies)-1].Content, want)
+		}
+	}
+	if n := len(fake.Requests()); n != 2 {
+		t.Errorf("the model got %d requests, want the rate limited one retried", n)
+	}
+}
+
+func TestToolFaultsOpenBreaker(t *testing.T) {
+	lookup := core.NewBaseTool("lookup", "Look something up", map[string]interface{}{"type": "object"})
+	tool := core.WithToolCircuitBreaker(chaos.Tool(&echoTool{BaseTool: lookup}, chaos.Faults{}),
+		core.CircuitBreakerConfig{MinRequests: 4, CoolDown: time.Minute})
+	ctx := chaos.WithFaults(context.Background(), chaos.Faults{ErrorRate: 1})
+
+	for i := 0; i < 4; i++ {
+		if _, err := tool.Execute(ctx, nil); !errors.Is(err, chaos.ErrInjected) {
+			t.Fatalf("call %d = %v, want the injected failure", i+1, err)
+		}
+	}
+	if _, err := tool.Execute(ctx, nil); !errors.Is(err, core.ErrCircuitOpen) {
+		t.Errorf("call after the failures = %v, want ErrCircuitOpen", err)
+	}
+	if stats, _ := chaos.StatsFromContext(ctx); stats.Calls != 4 {
+		t.Errorf("the tool was called %d times, want the open breaker to stop the fifth", stats.Calls)
+	}
+}
+
+// echoTool returns its arguments
+type echoTool struct {
+	*core.BaseTool
+}
+
+func (t *echoTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	return args, nil
+}
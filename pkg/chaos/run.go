@@ -0,0 +1,91 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// DefaultScenarioTimeout bounds a scenario that sets no timeout
+const DefaultScenarioTimeout = 30 * time.Second
+
+// terminationGrace is how long a run may outlive its deadline before it is
+// reported as hung
+const terminationGrace = 5 * time.Second
+
+// Scenario is a run of a graph under a set of faults
+type Scenario[T any] struct {
+	// Name names the subtest
+	Name string
+
+	// Faults apply to every chaos wrapper in the graph during the run
+	Faults Faults
+
+	// Input is the state the run starts with
+	Input T
+
+	// Timeout bounds the run. Zero means DefaultScenarioTimeout.
+	Timeout time.Duration
+
+	// Check optionally inspects the outcome, for example that a retry
+	// recovered or that a breaker failed fast. The run is allowed to fail
+	// unless Check says otherwise.
+	Check func(final T, err error, stats Stats) error
+}
+
+// Run runs the graph once per scenario, as subtests, and fails a scenario
+// when the graph doesn't terminate: when it runs into the scenario's
+// timeout or ignores cancellation. The graph's components must be wrapped
+// with Agent, Tool, Node or Transport for faults to reach them.
+func Run[T any](t *testing.T, g *core.StateGraph[T], scenarios []Scenario[T]) {
+	t.Helper()
+	runnable, err := g.Compile()
+	if err != nil {
+		t.Fatalf("failed to compile graph: %v", err)
+	}
+
+	for _, sc := range scenarios {
+		t.Run(sc.Name, func(t *testing.T) {
+			timeout := sc.Timeout
+			if timeout <= 0 {
+				timeout = DefaultScenarioTimeout
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			ctx = WithFaults(ctx, sc.Faults)
+
+			var final T
+			var runErr error
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				events, wait := runnable.InvokeStreaming(ctx, sc.Input)
+				for range events {
+				}
+				final, runErr = wait()
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(timeout + terminationGrace):
+				t.Fatalf("graph still running %s after its %s timeout, it ignores cancellation", terminationGrace, timeout)
+			}
+
+			stats, _ := StatsFromContext(ctx)
+			t.Logf("%d calls: %d errors, %d rate limits, %d malformed, %s injected delay",
+				stats.Calls, stats.Errors, stats.RateLimits, stats.Malformed, stats.Delay)
+
+			if errors.Is(runErr, context.DeadlineExceeded) && ctx.Err() != nil {
+				t.Fatalf("graph did not terminate within %s: %v", timeout, runErr)
+			}
+			if sc.Check != nil {
+				if err := sc.Check(final, runErr, stats); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+// Package client is a Go client for graphs served by pkg/server
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/server"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+var (
+	// ErrStreamEnded is returned when a run stream ends without a final frame
+	ErrStreamEnded = errors.New("stream ended before the run finished")
+)
+
+// Client calls graphs served by a run manager mounted with server.Mount
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	headers    http.Header
+	retry      core.RetryPolicy
+}
+
+// Option configures a client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithHeader adds a header to every request
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.headers.Add(key, value)
+	}
+}
+
+// WithBearerToken authenticates every request with a bearer token
+func WithBearerToken(token string) Option {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithRetryPolicy sets how idempotent requests and stream reconnects are retried
+func WithRetryPolicy(policy core.RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// NewClient creates a client for the server at baseURL
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		headers:    make(http.Header),
+		retry:      core.DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Invoke runs the graph with the given state and waits for the final state
+func Invoke[T any](ctx context.Context, c *Client, graphName string, state T) (T, error) {
+	var zero T
+	var record server.RunRecord
+	if err := c.do(ctx, http.MethodPost, c.runsURL(graphName), state, &record, false); err != nil {
+		return zero, err
+	}
+	return decodeResult[T](&record)
+}
+
+// Submit queues a run of the graph and returns its run ID without waiting
+func Submit[T any](ctx context.Context, c *Client, graphName string, state T) (string, error) {
+	var accepted struct {
+		RunID string `json:"run_id"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.runsURL(graphName)+"?async=true", state, &accepted, false); err != nil {
+		return "", err
+	}
+	return accepted.RunID, nil
+}
+
+// Resume resumes a run awaiting a human with the given state
+func Resume[T any](ctx context.Context, c *Client, graphName, runID string, state T) error {
+	return c.do(ctx, http.MethodPost, c.runURL(graphName, runID)+"/resume", state, nil, false)
+}
+
+// GetState returns the current state of a run
+func GetState[T any](ctx context.Context, c *Client, graphName, runID string) (T, error) {
+	var zero T
+	record, err := c.GetRun(ctx, graphName, runID)
+	if err != nil {
+		return zero, err
+	}
+	if len(record.State) == 0 {
+		return zero, nil
+	}
+	return core.UnmarshalState[T](record.State)
+}
+
+// GetRun returns the record of a run
+func (c *Client) GetRun(ctx context.Context, graphName, runID string) (*server.RunRecord, error) {
+	var record server.RunRecord
+	if err := c.do(ctx, http.MethodGet, c.runURL(graphName, runID), nil, &record, true); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListRuns returns the records of all runs of the graph
+func (c *Client) ListRuns(ctx context.Context, graphName string) ([]*server.RunRecord, error) {
+	var records []*server.RunRecord
+	if err := c.do(ctx, http.MethodGet, c.runsURL(graphName), nil, &records, true); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Cancel cancels a queued or running run
+func (c *Client) Cancel(ctx context.Context, graphName, runID string) error {
+	return c.do(ctx, http.MethodDelete, c.runURL(graphName, runID), nil, nil, true)
+}
+
+// SendFeedback records feedback on the output of a node of a run and
+// returns it as stored. The server attributes it to the caller.
+func (c *Client) SendFeedback(ctx context.Context, graphName, runID string, feedback core.Feedback) (core.Feedback, error) {
+	var stored core.Feedback
+	if err := c.do(ctx, http.MethodPost, c.runURL(graphName, runID)+"/feedback", feedback, &stored, false); err != nil {
+		return core.Feedback{}, err
+	}
+	return stored, nil
+}
+
+// Stream submits a run and follows it, returning channels shaped like those
+// of core.RunnableState.Stream. Values frames are decoded into T, status
+// frames are delivered as *server.RunRecord and errors end the stream with an
+// EventChainEnd event carrying the error. The stream reconnects with
+// Last-Event-ID when the connection drops.
+func Stream[T any](ctx context.Context, c *Client, graphName string, state T) (<-chan core.StreamEvent, <-chan core.Event, error) {
+	runID, err := Submit(ctx, c, graphName, state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	streamCh := make(chan core.StreamEvent, 100)
+	eventCh := make(chan core.Event, 100)
+	go func() {
+		defer close(streamCh)
+		defer close(eventCh)
+
+		err := c.follow(ctx, graphName, runID, func(frame wire.Frame) error {
+			return deliver[T](ctx, frame, streamCh, eventCh)
+		})
+		if err != nil && ctx.Err() == nil {
+			select {
+			case eventCh <- core.Event{
+				Type:      core.EventChainEnd,
+				Name:      graphName,
+				RunID:     runID,
+				Timestamp: time.Now(),
+				Metadata: map[string]interface{}{
+					"error": err.Error(),
+				},
+			}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return streamCh, eventCh, nil
+}
+
+// errStreamDone stops following a stream after its final frame
+var errStreamDone = errors.New("stream done")
+
+// deliver sends a frame to the matching channel
+func deliver[T any](ctx context.Context, frame wire.Frame, streamCh chan<- core.StreamEvent, eventCh chan<- core.Event) error {
+	var evt *core.StreamEvent
+	switch frame.Kind {
+	case wire.KindEvent:
+		graphEvent, err := frame.Event()
+		if err != nil {
+			return err
+		}
+		select {
+		case eventCh <- graphEvent:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	case wire.KindValues, wire.KindUpdates:
+		state, err := wire.DecodePayload[T](frame)
+		if err != nil {
+			return err
+		}
+		evt = &core.StreamEvent{Mode: core.StreamMode(frame.Kind), Data: state}
+	case wire.KindStatus:
+		record, err := wire.DecodePayload[*server.RunRecord](frame)
+		if err != nil {
+			return err
+		}
+		evt = &core.StreamEvent{Mode: core.StreamMode(frame.Kind), Data: record}
+	case wire.KindHeartbeat:
+		heartbeat, err := frame.Heartbeat()
+		if err != nil {
+			return err
+		}
+		evt = &core.StreamEvent{Mode: core.StreamHeartbeat, Data: heartbeat}
+	case wire.KindError:
+		payload, err := frame.Error()
+		if err != nil {
+			return err
+		}
+		return payload.Err()
+	case wire.KindEnd:
+		return errStreamDone
+	default:
+		evt = &core.StreamEvent{Mode: core.StreamMode(frame.Kind), Data: frame.Payload}
+	}
+
+	select {
+	case streamCh <- *evt:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// follow reads the run's frames until the final one, reconnecting after
+// dropped connections with the last sequence number seen
+func (c *Client) follow(ctx context.Context, graphName, runID string, handle func(wire.Frame) error) error {
+	var lastSeq uint64
+	for retry := 1; ; retry++ {
+		err := c.readStream(ctx, graphName, runID, &lastSeq, handle)
+		if errors.Is(err, errStreamDone) {
+			return nil
+		}
+		var remote *wire.RemoteError
+		if errors.As(err, &remote) || ctx.Err() != nil {
+			return err
+		}
+		if retry >= c.retry.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(c.retry.Backoff(retry))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// readStream reads frames from one connection
+func (c *Client) readStream(ctx context.Context, graphName, runID string, lastSeq *uint64, handle func(wire.Frame) error) error {
+	req, err := c.newRequest(ctx, http.MethodGet, c.runURL(graphName, runID)+"/stream", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastSeq > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(*lastSeq, 10))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		frame, err := wire.Unmarshal([]byte(data))
+		if err != nil {
+			return err
+		}
+		*lastSeq = frame.Seq
+		if err := handle(frame); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ErrStreamEnded
+}
+
+func (c *Client) runsURL(graphName string) string {
+	return c.baseURL + server.GraphPath(graphName) + "/runs"
+}
+
+func (c *Client) runURL(graphName, runID string) string {
+	return c.runsURL(graphName) + "/" + runID
+}
+
+// newRequest creates a request with the client's headers
+func (c *Client) newRequest(ctx context.Context, method, url string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do sends a JSON request and decodes the JSON response into out. Idempotent
+// requests are retried on network errors and retryable status codes.
+func (c *Client) do(ctx context.Context, method, url string, in, out interface{}, idempotent bool) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	attempt := func(ctx context.Context) error {
+		req, err := c.newRequest(ctx, method, url, body)
+		if err != nil {
+			return core.NoRetry(err)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			err := decodeError(resp)
+			if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+				return core.NoRetry(err)
+			}
+			return err
+		}
+		if out == nil || resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return core.NoRetry(fmt.Errorf("failed to decode response: %w", err))
+		}
+		return nil
+	}
+
+	policy := c.retry
+	if !idempotent {
+		policy = core.RetryPolicy{MaxAttempts: 1}
+	}
+	return core.Retry(ctx, policy, attempt)
+}
+
+// decodeError turns an error response into a *wire.RemoteError
+func decodeError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(data, &body); err != nil || body.Error == "" {
+		body.Error = fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return wire.ErrorFromCode(body.Code, body.Error)
+}
+
+// decodeResult returns the final state of a finished run, or its error
+func decodeResult[T any](record *server.RunRecord) (T, error) {
+	var zero T
+	switch record.Status {
+	case server.StatusCompleted:
+		return core.UnmarshalState[T](record.State)
+	case server.StatusFailed, server.StatusCancelled:
+		return zero, wire.ErrorFromCode(record.ErrorCode, record.Error)
+	default:
+		return zero, fmt.Errorf("run %s is %s", record.ID, record.Status)
+	}
+}
@@ -0,0 +1,363 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrInvalidPolicy is returned when an approval policy doesn't validate
+	ErrInvalidPolicy = errors.New("invalid approval policy")
+)
+
+// EventApprovalDecision is emitted for every tool call an approval policy
+// decides on
+const EventApprovalDecision EventType = "on_approval_decision"
+
+// ApprovalDecision is what an approval policy decides for a tool call
+type ApprovalDecision string
+
+const (
+	// ApprovalAllow runs the call without asking
+	ApprovalAllow ApprovalDecision = "allow"
+
+	// ApprovalDeny refuses the call, telling the model why
+	ApprovalDeny ApprovalDecision = "deny"
+
+	// ApprovalAsk pauses the run until a human decides
+	ApprovalAsk ApprovalDecision = "ask"
+)
+
+// Condition operators of approval rules
+const (
+	OpEq      = "eq"
+	OpNe      = "ne"
+	OpLt      = "lt"
+	OpLte     = "lte"
+	OpGt      = "gt"
+	OpGte     = "gte"
+	OpIn      = "in"
+	OpNotIn   = "not_in"
+	OpExists  = "exists"
+	OpMatches = "matches"
+)
+
+// ApprovalCall is a tool call submitted to an approval policy
+type ApprovalCall struct {
+	// Tool is the name of the tool
+	Tool string `json:"tool"`
+
+	// Args are the arguments of the call
+	Args map[string]interface{} `json:"args,omitempty"`
+
+	// Metadata describes the run making the call, such as its run_id,
+	// locale and variant
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ApprovalCondition is a predicate on an argument or on run metadata. Arg
+// is a dotted path into the arguments, such as payment.amount.
+type ApprovalCondition struct {
+	Arg   string      `json:"arg,omitempty" yaml:"arg,omitempty"`
+	Meta  string      `json:"meta,omitempty" yaml:"meta,omitempty"`
+	Op    string      `json:"op" yaml:"op"`
+	Value interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+
+	// pattern is the compiled Value of matches conditions
+	pattern *regexp.Regexp
+}
+
+// ApprovalRule decides calls to the tools it names when all of its
+// conditions hold
+type ApprovalRule struct {
+	// Name identifies the rule in logs and events
+	Name string `json:"name" yaml:"name"`
+
+	// Tools are the tool names the rule applies to, with path.Match
+	// patterns such as "db_*". Empty applies to every tool.
+	Tools []string `json:"tools,omitempty" yaml:"tools,omitempty"`
+
+	// When are the conditions that must all hold
+	When []ApprovalCondition `json:"when,omitempty" yaml:"when,omitempty"`
+
+	Decision ApprovalDecision `json:"decision" yaml:"decision"`
+
+	// Reason explains the decision. Denials hand it to the model.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// ApprovalResult is the decision of a policy for a call and the rule that
+// made it, empty when no rule matched
+type ApprovalResult struct {
+	Decision ApprovalDecision `json:"decision"`
+	Rule     string           `json:"rule,omitempty"`
+	Reason   string           `json:"reason,omitempty"`
+}
+
+// ApprovalPolicy decides which tool calls run without a human. Rules are
+// evaluated in order and the first one matching decides; calls no rule
+// matches get Default, which is ApprovalAsk when empty.
+type ApprovalPolicy struct {
+	Rules   []ApprovalRule   `json:"rules" yaml:"rules"`
+	Default ApprovalDecision `json:"default,omitempty" yaml:"default,omitempty"`
+}
+
+// ParseApprovalPolicy decodes and validates a policy written in YAML. JSON
+// policies parse as well, since JSON is valid YAML.
+func ParseApprovalPolicy(data []byte) (*ApprovalPolicy, error) {
+	var policy ApprovalPolicy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&policy); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("empty policy")
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// LoadApprovalPolicy reads and validates a YAML policy file
+func LoadApprovalPolicy(file string) (*ApprovalPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approval policy: %w", err)
+	}
+	return ParseApprovalPolicy(data)
+}
+
+// Validate checks the decisions, tool patterns and conditions of the policy
+// and compiles its patterns
+func (p *ApprovalPolicy) Validate() error {
+	var problems []string
+	if p.Default != "" && !validDecision(p.Default) {
+		problems = append(problems, fmt.Sprintf("default: unknown decision %q", p.Default))
+	}
+	names := make(map[string]bool)
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		label := fmt.Sprintf("rule %d", i)
+		if rule.Name != "" {
+			label = fmt.Sprintf("rule %q", rule.Name)
+			if names[rule.Name] {
+				problems = append(problems, label+": duplicate name")
+			}
+			names[rule.Name] = true
+		}
+		if !validDecision(rule.Decision) {
+			problems = append(problems, fmt.Sprintf("%s: unknown decision %q", label, rule.Decision))
+		}
+		for _, pattern := range rule.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: bad tool pattern %q", label, pattern))
+			}
+		}
+		for j := range rule.When {
+			if err := rule.When[j].compile(); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: condition %d: %v", label, j, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidPolicy, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Evaluate decides a call. The policy must have been validated, which
+// ParseApprovalPolicy and LoadApprovalPolicy do.
+func (p *ApprovalPolicy) Evaluate(call ApprovalCall) ApprovalResult {
+	for _, rule := range p.Rules {
+		if rule.matches(call) {
+			return ApprovalResult{Decision: rule.Decision, Rule: rule.Name, Reason: rule.Reason}
+		}
+	}
+	decision := p.Default
+	if decision == "" {
+		decision = ApprovalAsk
+	}
+	return ApprovalResult{Decision: decision}
+}
+
+// validDecision reports whether d is a known decision
+func validDecision(d ApprovalDecision) bool {
+	return d == ApprovalAllow || d == ApprovalDeny || d == ApprovalAsk
+}
+
+// matches reports whether the rule applies to the call
+func (r ApprovalRule) matches(call ApprovalCall) bool {
+	if len(r.Tools) > 0 {
+		matched := false
+		for _, pattern := range r.Tools {
+			if ok, _ := path.Match(pattern, call.Tool); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, cond := range r.When {
+		if !cond.holds(call) {
+			return false
+		}
+	}
+	return true
+}
+
+// compile checks the condition and compiles its pattern
+func (c *ApprovalCondition) compile() error {
+	if (c.Arg == "") == (c.Meta == "") {
+		return fmt.Errorf("exactly one of arg and meta must be set")
+	}
+	switch c.Op {
+	case OpEq, OpNe, OpExists:
+	case OpLt, OpLte, OpGt, OpGte:
+		if _, ok := toFloat(c.Value); !ok {
+			return fmt.Errorf("%s needs a number, got %v", c.Op, c.Value)
+		}
+	case OpIn, OpNotIn:
+		if _, ok := c.Value.([]interface{}); !ok {
+			return fmt.Errorf("%s needs a list, got %v", c.Op, c.Value)
+		}
+	case OpMatches:
+		s, ok := c.Value.(string)
+		if !ok {
+			return fmt.Errorf("matches needs a regular expression, got %v", c.Value)
+		}
+		pattern, err := regexp.Compile(s)
+		if err != nil {
+			return err
+		}
+		c.pattern = pattern
+	default:
+		return fmt.Errorf("unknown operator %q", c.Op)
+	}
+	return nil
+}
+
+// holds evaluates the condition against a call. Conditions on missing
+// values only hold for ne, not_in and exists false.
+func (c ApprovalCondition) holds(call ApprovalCall) bool {
+	var value interface{}
+	var found bool
+	if c.Arg != "" {
+		value, found = lookupPath(call.Args, c.Arg)
+	} else {
+		value, found = call.Metadata[c.Meta]
+	}
+
+	switch c.Op {
+	case OpExists:
+		want := true
+		if b, ok := c.Value.(bool); ok {
+			want = b
+		}
+		return found == want
+	case OpNe:
+		return !found || !sameValue(value, c.Value)
+	case OpNotIn:
+		return !found || !inList(value, c.Value)
+	}
+	if !found {
+		return false
+	}
+
+	switch c.Op {
+	case OpEq:
+		return sameValue(value, c.Value)
+	case OpIn:
+		return inList(value, c.Value)
+	case OpMatches:
+		s, ok := value.(string)
+		return ok && c.pattern != nil && c.pattern.MatchString(s)
+	}
+
+	got, ok := toFloat(value)
+	want, _ := toFloat(c.Value)
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case OpLt:
+		return got < want
+	case OpLte:
+		return got <= want
+	case OpGt:
+		return got > want
+	case OpGte:
+		return got >= want
+	}
+	return false
+}
+
+// lookupPath finds a dotted path in nested argument maps
+func lookupPath(args map[string]interface{}, p string) (interface{}, bool) {
+	var current interface{} = args
+	for _, key := range strings.Split(p, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// sameValue compares values decoded from JSON, treating numbers of any type
+// as equal when their values are
+func sameValue(a, b interface{}) bool {
+	fa, aNum := toFloat(a)
+	fb, bNum := toFloat(b)
+	if aNum && bNum {
+		return fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// inList reports whether value is one of the list's items
+func inList(value, list interface{}) bool {
+	items, _ := list.([]interface{})
+	for _, item := range items {
+		if sameValue(value, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat converts a number of any type to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
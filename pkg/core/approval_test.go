@@ -0,0 +1,124 @@
+package core_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+const paymentsPolicy = `
+default: ask
+rules:
+  - name: small-payments
+    tools: [send_payment]
+    when:
+      - arg: payment.amount
+        op: lt
+        value: 50
+      - arg: payment.recipient
+        op: in
+        value: [alice, bob]
+    decision: allow
+  - name: no-drops
+    tools: ["db_*"]
+    when:
+      - arg: query
+        op: matches
+        value: (?i)drop table
+    decision: deny
+    reason: schema changes need a migration
+  - name: reads
+    tools: [search]
+    when:
+      - meta: locale
+        op: eq
+        value: en
+    decision: allow
+`
+
+func TestApprovalPolicyFromYAML(t *testing.T) {
+	policy, err := core.ParseApprovalPolicy([]byte(paymentsPolicy))
+	if err != nil {
+		t.Fatalf("ParseApprovalPolicy: %v", err)
+	}
+	payment := func(amount interface{}, recipient string) map[string]interface{} {
+		return map[string]interface{}{"payment": map[string]interface{}{"amount": amount, "recipient": recipient}}
+	}
+
+	tests := []struct {
+		name string
+		call core.ApprovalCall
+		want core.ApprovalResult
+	}{
+		{"small payment to a friend", core.ApprovalCall{Tool: "send_payment", Args: payment(20.5, "alice")},
+			core.ApprovalResult{Decision: core.ApprovalAllow, Rule: "small-payments"}},
+		{"large payment", core.ApprovalCall{Tool: "send_payment", Args: payment(500, "alice")},
+			core.ApprovalResult{Decision: core.ApprovalAsk}},
+		{"payment to a stranger", core.ApprovalCall{Tool: "send_payment", Args: payment(5, "mallory")},
+			core.ApprovalResult{Decision: core.ApprovalAsk}},
+		{"dropping a table", core.ApprovalCall{Tool: "db_exec", Args: map[string]interface{}{"query": "DROP TABLE users"}},
+			core.ApprovalResult{Decision: core.ApprovalDeny, Rule: "no-drops", Reason: "schema changes need a migration"}},
+		{"search in english", core.ApprovalCall{Tool: "search", Metadata: map[string]interface{}{"locale": "en"}},
+			core.ApprovalResult{Decision: core.ApprovalAllow, Rule: "reads"}},
+		{"search without a locale", core.ApprovalCall{Tool: "search"},
+			core.ApprovalResult{Decision: core.ApprovalAsk}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Evaluate(tt.call); got != tt.want {
+				t.Errorf("Evaluate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApprovalPolicyValidation(t *testing.T) {
+	_, err := core.ParseApprovalPolicy([]byte(`
+default: maybe
+rules:
+  - name: a
+    decision: allow
+    when:
+      - arg: amount
+        op: lt
+        value: lots
+  - name: a
+    tools: ["[bad"]
+    decision: allow
+`))
+	if !errors.Is(err, core.ErrInvalidPolicy) {
+		t.Fatalf("ParseApprovalPolicy = %v, want ErrInvalidPolicy", err)
+	}
+	for _, problem := range []string{"default", "lt needs a number", "duplicate name", "bad tool pattern"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("error %q doesn't report %q", err, problem)
+		}
+	}
+
+	for name, policy := range map[string]string{
+		"unknown field": "rules: []\nescalate: true\n",
+		"empty":         "",
+		"not yaml":      "rules: [",
+	} {
+		if _, err := core.ParseApprovalPolicy([]byte(policy)); !errors.Is(err, core.ErrInvalidPolicy) {
+			t.Errorf("%s policy = %v, want ErrInvalidPolicy", name, err)
+		}
+	}
+}
+
+func TestLoadApprovalPolicyReadsJSONToo(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(file, []byte(`{"rules": [{"name": "all", "decision": "allow"}], "default": "deny"}`), 0o600)
+
+	policy, err := core.LoadApprovalPolicy(file)
+	if err != nil {
+		t.Fatalf("LoadApprovalPolicy: %v", err)
+	}
+	if got := policy.Evaluate(core.ApprovalCall{Tool: "anything"}); got.Decision != core.ApprovalAllow || got.Rule != "all" {
+		t.Errorf("Evaluate = %+v, want allowed by all", got)
+	}
+}
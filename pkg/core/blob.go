@@ -0,0 +1,410 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBlobNotFound is returned when a blob doesn't exist
+	ErrBlobNotFound = errors.New("blob not found")
+
+	// ErrNoBlobStore is returned when a node resolves a blob in a run
+	// without a blob store
+	ErrNoBlobStore = errors.New("no blob store")
+)
+
+// BlobRef is a reference to a blob, such as an uploaded PDF or image. States
+// carry BlobRefs instead of the bytes, so checkpoints, streams and
+// interrupts only ever see the reference. Blobs are content-addressed: the
+// ID is derived from the hash, so the same content is stored once.
+type BlobRef struct {
+	ID          string `json:"id"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+
+	// Hash is the hex SHA-256 of the content
+	Hash string `json:"sha256"`
+}
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	BlobRef
+
+	// Created is when the blob was first stored
+	Created time.Time `json:"created"`
+}
+
+// BlobStore stores blobs
+type BlobStore interface {
+	// Put stores the content read from r and returns its reference
+	Put(ctx context.Context, contentType string, r io.Reader) (BlobRef, error)
+
+	// Get opens the content of a blob. The caller closes it.
+	Get(ctx context.Context, id string) (io.ReadCloser, BlobRef, error)
+
+	// Delete removes a blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, id string) error
+
+	// List describes all stored blobs
+	List(ctx context.Context) ([]BlobInfo, error)
+}
+
+// blobID returns the ID of content with the given hash
+func blobID(hash string) string {
+	return "blob-" + hash
+}
+
+// validBlobID reports whether id is an ID a blob store could have issued,
+// which also keeps IDs from escaping a FileBlobStore's directory
+func validBlobID(id string) bool {
+	hash, ok := strings.CutPrefix(id, "blob-")
+	if !ok || len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// hashBlob reads r into memory and returns the content with its reference
+func hashBlob(contentType string, r io.Reader) ([]byte, BlobRef, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, BlobRef{}, fmt.Errorf("failed to read blob: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	return data, BlobRef{ID: blobID(hash), ContentType: contentType, Size: int64(len(data)), Hash: hash}, nil
+}
+
+// MemoryBlobStore keeps blobs in memory
+type MemoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+// memoryBlob is a blob of a MemoryBlobStore
+type memoryBlob struct {
+	info BlobInfo
+	data []byte
+}
+
+// NewMemoryBlobStore creates an empty in-memory blob store
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{blobs: make(map[string]memoryBlob)}
+}
+
+// Put stores a blob
+func (s *MemoryBlobStore) Put(ctx context.Context, contentType string, r io.Reader) (BlobRef, error) {
+	data, ref, err := hashBlob(contentType, r)
+	if err != nil {
+		return BlobRef{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.blobs[ref.ID]; ok {
+		return existing.info.BlobRef, nil
+	}
+	s.blobs[ref.ID] = memoryBlob{info: BlobInfo{BlobRef: ref, Created: time.Now()}, data: data}
+	return ref, nil
+}
+
+// Get opens a blob
+func (s *MemoryBlobStore) Get(ctx context.Context, id string) (io.ReadCloser, BlobRef, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blob, ok := s.blobs[id]
+	if !ok {
+		return nil, BlobRef{}, fmt.Errorf("%w: %s", ErrBlobNotFound, id)
+	}
+	return io.NopCloser(bytes.NewReader(blob.data)), blob.info.BlobRef, nil
+}
+
+// Delete removes a blob
+func (s *MemoryBlobStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, id)
+	return nil
+}
+
+// List describes all blobs
+func (s *MemoryBlobStore) List(ctx context.Context) ([]BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	infos := make([]BlobInfo, 0, len(s.blobs))
+	for _, blob := range s.blobs {
+		infos = append(infos, blob.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+// blobMetaExt is the extension of the files holding a blob's description
+const blobMetaExt = ".json"
+
+// FileBlobStore keeps blobs as files in a directory, each next to a JSON
+// file describing it. Files are written to a temporary name and renamed,
+// so readers never see a partial blob.
+type FileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore creates a blob store in dir, creating it if needed
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &FileBlobStore{dir: dir}, nil
+}
+
+// Put stores a blob
+func (s *FileBlobStore) Put(ctx context.Context, contentType string, r io.Reader) (BlobRef, error) {
+	data, ref, err := hashBlob(contentType, r)
+	if err != nil {
+		return BlobRef{}, err
+	}
+	if info, err := s.info(ref.ID); err == nil {
+		return info.BlobRef, nil
+	}
+
+	meta, err := json.Marshal(BlobInfo{BlobRef: ref, Created: time.Now()})
+	if err != nil {
+		return BlobRef{}, err
+	}
+	// The content goes first, so a described blob always has its content
+	if err := s.writeFile(ref.ID, data); err != nil {
+		return BlobRef{}, err
+	}
+	if err := s.writeFile(ref.ID+blobMetaExt, meta); err != nil {
+		return BlobRef{}, err
+	}
+	return ref, nil
+}
+
+// writeFile writes a file of the store atomically
+func (s *FileBlobStore) writeFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	return nil
+}
+
+// info reads the description of a blob
+func (s *FileBlobStore) info(id string) (BlobInfo, error) {
+	if !validBlobID(id) {
+		return BlobInfo{}, fmt.Errorf("%w: %s", ErrBlobNotFound, id)
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, id+blobMetaExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return BlobInfo{}, fmt.Errorf("%w: %s", ErrBlobNotFound, id)
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	var info BlobInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return BlobInfo{}, fmt.Errorf("%w: blob %s: %v", ErrCorruptValue, id, err)
+	}
+	return info, nil
+}
+
+// Get opens a blob
+func (s *FileBlobStore) Get(ctx context.Context, id string) (io.ReadCloser, BlobRef, error) {
+	info, err := s.info(id)
+	if err != nil {
+		return nil, BlobRef{}, err
+	}
+	f, err := os.Open(filepath.Join(s.dir, id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, BlobRef{}, fmt.Errorf("%w: %s", ErrBlobNotFound, id)
+	}
+	if err != nil {
+		return nil, BlobRef{}, err
+	}
+	return f, info.BlobRef, nil
+}
+
+// Delete removes a blob
+func (s *FileBlobStore) Delete(ctx context.Context, id string) error {
+	if !validBlobID(id) {
+		return nil
+	}
+	// The description goes first, so a half deleted blob is no longer listed
+	for _, name := range []string{id + blobMetaExt, id} {
+		if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete blob: %w", err)
+		}
+	}
+	return nil
+}
+
+// List describes all blobs
+func (s *FileBlobStore) List(ctx context.Context) ([]BlobInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+	var infos []BlobInfo
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), blobMetaExt)
+		if !ok || !validBlobID(id) {
+			continue
+		}
+		info, err := s.info(id)
+		if err != nil {
+			if errors.Is(err, ErrBlobNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+type blobStoreKey struct{}
+
+// WithBlobs returns a context whose nodes resolve blobs in store
+func WithBlobs(ctx context.Context, store BlobStore) context.Context {
+	return context.WithValue(ctx, blobStoreKey{}, store)
+}
+
+// BlobsFromContext returns the blob store of the run, or nil. Runs use the
+// store set with SetBlobStore unless their context already has one.
+func BlobsFromContext(ctx context.Context) BlobStore {
+	store, _ := ctx.Value(blobStoreKey{}).(BlobStore)
+	return store
+}
+
+// SetBlobStore sets the blob store nodes resolve BlobRefs in
+func (g *StateGraph[T]) SetBlobStore(store BlobStore) {
+	g.blobStore = store
+}
+
+// ReadBlob reads the content of a blob from the run's blob store
+func ReadBlob(ctx context.Context, ref BlobRef) ([]byte, error) {
+	store := BlobsFromContext(ctx)
+	if store == nil {
+		return nil, ErrNoBlobStore
+	}
+	r, _, err := store.Get(ctx, ref.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// PutBlob stores content in the run's blob store and returns its reference
+func PutBlob(ctx context.Context, contentType string, data []byte) (BlobRef, error) {
+	store := BlobsFromContext(ctx)
+	if store == nil {
+		return BlobRef{}, ErrNoBlobStore
+	}
+	return store.Put(ctx, contentType, bytes.NewReader(data))
+}
+
+var blobRefType = reflect.TypeOf(BlobRef{})
+
+// BlobRefsIn returns the BlobRefs a value holds, looking through structs,
+// pointers, slices, arrays, maps and interfaces, such as the references of a
+// state
+func BlobRefsIn(v interface{}) []BlobRef {
+	var refs []BlobRef
+	seen := make(map[uintptr]bool)
+	var walk func(rv reflect.Value)
+	walk = func(rv reflect.Value) {
+		if !rv.IsValid() {
+			return
+		}
+		if rv.Type() == blobRefType {
+			if ref := rv.Interface().(BlobRef); ref.ID != "" {
+				refs = append(refs, ref)
+			}
+			return
+		}
+		switch rv.Kind() {
+		case reflect.Pointer:
+			if rv.IsNil() || seen[rv.Pointer()] {
+				return
+			}
+			seen[rv.Pointer()] = true
+			walk(rv.Elem())
+		case reflect.Interface:
+			walk(rv.Elem())
+		case reflect.Struct:
+			for i := 0; i < rv.NumField(); i++ {
+				if rv.Type().Field(i).IsExported() {
+					walk(rv.Field(i))
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				walk(rv.Index(i))
+			}
+		case reflect.Map:
+			iter := rv.MapRange()
+			for iter.Next() {
+				walk(iter.Value())
+			}
+		}
+	}
+	walk(reflect.ValueOf(v))
+	return refs
+}
+
+// CollectBlobs deletes the blobs none of the live values reference, such as
+// the states of live threads, and returns the IDs it deleted. Blobs stored
+// less than grace ago are kept, since a blob is uploaded before the run
+// referencing it starts and nodes store blobs before their state is seen.
+func CollectBlobs(ctx context.Context, store BlobStore, grace time.Duration, live ...interface{}) ([]string, error) {
+	referenced := make(map[string]bool)
+	for _, v := range live {
+		for _, ref := range BlobRefsIn(v) {
+			referenced[ref.ID] = true
+		}
+	}
+
+	infos, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-grace)
+	var deleted []string
+	for _, info := range infos {
+		if referenced[info.ID] || info.Created.After(cutoff) {
+			continue
+		}
+		if err := store.Delete(ctx, info.ID); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, info.ID)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"context"
+	"sync"
+)
+
+// branchKey is the context key of the parallel branch a context belongs to
+type branchKey struct{}
+
+// branchRef identifies a branch in its group
+type branchRef struct {
+	group *branchGroup
+	index int
+}
+
+// branchGroup holds the contexts of parallel branches so that one of them
+// can cancel the others
+type branchGroup struct {
+	ctxs    []context.Context
+	cancels []context.CancelFunc
+
+	mu       sync.Mutex
+	finished []bool
+	dropped  []bool
+
+	// winner is the branch that cancelled its siblings, -1 while none did
+	winner int
+}
+
+// newBranchGroup creates the contexts of n branches derived from ctx
+func newBranchGroup(ctx context.Context, n int) *branchGroup {
+	g := &branchGroup{
+		ctxs:     make([]context.Context, n),
+		cancels:  make([]context.CancelFunc, n),
+		finished: make([]bool, n),
+		dropped:  make([]bool, n),
+		winner:   -1,
+	}
+	for i := 0; i < n; i++ {
+		branchCtx, cancel := context.WithCancel(ctx)
+		g.ctxs[i] = context.WithValue(branchCtx, branchKey{}, branchRef{group: g, index: i})
+		g.cancels[i] = cancel
+	}
+	return g
+}
+
+// context returns the context of branch i
+func (g *branchGroup) context(i int) context.Context {
+	return g.ctxs[i]
+}
+
+// cancelSiblings cancels and drops the branches that haven't finished,
+// except i, unless another branch already did
+func (g *branchGroup) cancelSiblings(i int) (bool, int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.winner >= 0 {
+		return g.winner == i, 0
+	}
+	g.winner = i
+	cancelled := 0
+	for j, cancel := range g.cancels {
+		if j != i && !g.finished[j] {
+			g.dropped[j] = true
+			cancel()
+			cancelled++
+		}
+	}
+	return true, cancelled
+}
+
+// finish marks branch i finished and reports whether its result is kept
+func (g *branchGroup) finish(i int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.finished[i] = true
+	return !g.dropped[i]
+}
+
+// isDropped reports whether branch i was cancelled by a sibling
+func (g *branchGroup) isDropped(i int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.dropped[i]
+}
+
+// isWinner reports whether branch i cancelled its siblings
+func (g *branchGroup) isWinner(i int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.winner == i
+}
+
+// release cancels the contexts of all branches
+func (g *branchGroup) release() {
+	for _, cancel := range g.cancels {
+		cancel()
+	}
+}
+
+// CancelSiblings tells the parallel branch running with ctx, such as a Fork
+// branch, a ParallelChannels branch or a node raced by a speculative edge,
+// that it is done and its siblings are no longer needed. The siblings still
+// running are cancelled and their results discarded, and those not started
+// yet never run. It reports whether this branch was the first to call it;
+// it returns false when a sibling already did or ctx isn't a branch's.
+func CancelSiblings(ctx context.Context) bool {
+	ref, ok := ctx.Value(branchKey{}).(branchRef)
+	if !ok {
+		return false
+	}
+	won, cancelled := ref.group.cancelSiblings(ref.index)
+	if won && cancelled > 0 {
+		LoggerFromContext(ctx).Debug("Cancelled sibling branches", "branch", ref.index, "cancelled", cancelled)
+	}
+	return won
+}
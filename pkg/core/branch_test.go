@@ -0,0 +1,118 @@
+package core_test
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func TestForkBranchCancelsSiblings(t *testing.T) {
+	var started atomic.Int32
+	var won atomic.Int32
+	run := func(ctx context.Context, p plan) (plan, error) {
+		started.Add(1)
+		if p.Name == "good enough" {
+			time.Sleep(10 * time.Millisecond)
+			if core.CancelSiblings(ctx) {
+				won.Add(1)
+			}
+			return p, nil
+		}
+		// The others would win if their results weren't discarded
+		<-ctx.Done()
+		p.Quality = 100
+		return p, nil
+	}
+	candidates := []plan{{"good enough", 1}, {"slow", 2}, {"never started", 3}}
+
+	best, err := core.Fork(context.Background(), candidates, run, quality, core.WithForkConcurrency(2))
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	if best.Name != "good enough" {
+		t.Errorf("best = %+v, want the branch that cancelled its siblings", best)
+	}
+	if n := started.Load(); n != 2 {
+		t.Errorf("%d branches started, want the third never to run", n)
+	}
+	if won.Load() != 1 {
+		t.Error("CancelSiblings didn't report the first call as winning")
+	}
+}
+
+func TestParallelChannelsBranchCancelsSiblings(t *testing.T) {
+	c, _, log := newChannels(t)
+	lateWin := make(chan bool, 1)
+	node := core.ParallelChannels(
+		func(ctx context.Context, c *core.Channels) error {
+			log.Write(c, []string{"partial"})
+			<-ctx.Done()
+			lateWin <- core.CancelSiblings(ctx)
+			return ctx.Err()
+		},
+		func(ctx context.Context, c *core.Channels) error {
+			log.Write(c, []string{"winner"})
+			core.CancelSiblings(ctx)
+			return nil
+		},
+	)
+
+	out, err := node(context.Background(), c)
+	if err != nil {
+		t.Fatalf("node: %v", err)
+	}
+	select {
+	case won := <-lateWin:
+		if won {
+			t.Error("the cancelled sibling's CancelSiblings won too")
+		}
+	default:
+		t.Error("the sibling's context wasn't cancelled")
+	}
+	if got := strings.Join(log.Get(out), ","); got != "winner" {
+		t.Errorf("log = %s, want the cancelled branch's partial write discarded", got)
+	}
+}
+
+func TestSpeculativeBranchCancelsSiblings(t *testing.T) {
+	g := newGraph[draft]()
+	g.AddNode("start", func(ctx context.Context, s draft) (draft, error) {
+		return draft{Notes: map[string]string{}}, nil
+	})
+	g.AddNode("eager", func(ctx context.Context, s draft) (draft, error) {
+		s.Notes["eager"] = "yes"
+		return s, nil
+	})
+	g.AddNode("sure", func(ctx context.Context, s draft) (draft, error) {
+		time.Sleep(10 * time.Millisecond)
+		s.Notes["sure"] = "yes"
+		core.CancelSiblings(ctx)
+		return s, nil
+	})
+	g.SetEntryPoint("start")
+	// Accept rejects everything, so without CancelSiblings the first
+	// branch to finish, eager, would be committed
+	g.AddConditionalEdges("start", func(draft) ([]string, error) {
+		return []string{"eager", "sure"}, nil
+	}, nil, core.WithSpeculative[draft](2, func(draft) bool { return false }))
+	g.AddConditionalEdges("eager", to[draft](core.END), nil)
+	g.AddConditionalEdges("sure", to[draft](core.END), nil)
+
+	out, err := compile(t, g).Invoke(context.Background(), draft{})
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if _, ok := out.Notes["sure"]; !ok || len(out.Notes) != 1 {
+		t.Errorf("notes = %v, want only the branch that cancelled its siblings", out.Notes)
+	}
+}
+
+func TestCancelSiblingsOutsideBranch(t *testing.T) {
+	if core.CancelSiblings(context.Background()) {
+		t.Error("CancelSiblings outside a branch reported winning")
+	}
+}
@@ -0,0 +1,297 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCircuitOpen is returned immediately, without making the call, while
+	// a circuit breaker is open
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// EventCircuitStateChange is emitted when a circuit breaker changes state
+const EventCircuitStateChange EventType = "on_circuit_state_change"
+
+// CircuitState is the state of a circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed lets all calls through
+	CircuitClosed CircuitState = "closed"
+
+	// CircuitOpen rejects all calls with ErrCircuitOpen
+	CircuitOpen CircuitState = "open"
+
+	// CircuitHalfOpen lets a few trial calls through to probe for recovery
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerConfig configures a circuit breaker
+type CircuitBreakerConfig struct {
+	// FailureRate is the share of failed calls within the window, from 0 to
+	// 1, that opens the circuit. Zero means 0.5.
+	FailureRate float64
+
+	// MinRequests is the number of calls the window must hold before the
+	// failure rate is considered. Zero means 10.
+	MinRequests int
+
+	// Window is the rolling window over which calls are counted. Zero means
+	// one minute.
+	Window time.Duration
+
+	// CoolDown is how long the circuit stays open before trial calls are
+	// allowed. Zero means 30 seconds.
+	CoolDown time.Duration
+
+	// HalfOpenRequests is the number of successful trial calls needed to
+	// close the circuit again. Zero means 1.
+	HalfOpenRequests int
+
+	// OnStateChange is called after every state change
+	OnStateChange func(name string, from, to CircuitState)
+}
+
+// circuitBuckets is the number of buckets the rolling window is split into
+const circuitBuckets = 10
+
+// circuitChange is a state change waiting to be reported
+type circuitChange struct {
+	from, to CircuitState
+}
+
+// circuitBucket counts the outcomes of the calls in a slice of the window
+type circuitBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// CircuitBreaker stops calling a failing dependency for a while, so callers
+// fail fast instead of each waiting for a timeout. It is safe for concurrent use.
+type CircuitBreaker struct {
+	name   string
+	config CircuitBreakerConfig
+
+	mu       sync.Mutex
+	state    CircuitState
+	changes  []circuitChange
+	buckets  [circuitBuckets]circuitBucket
+	openedAt time.Time
+
+	// trials counts trial calls in flight and trial successes while half-open
+	trials    int
+	successes int
+}
+
+// NewCircuitBreaker creates a closed circuit breaker. The name identifies it
+// in state change events.
+func NewCircuitBreaker(name string, config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureRate <= 0 {
+		config.FailureRate = 0.5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{
+		name:   name,
+		config: config,
+		state:  CircuitClosed,
+	}
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.config.CoolDown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// Do calls fn unless the circuit is open, in which case it fails with
+// ErrCircuitOpen. Errors from fn count as failures, except cancellation by
+// the caller.
+func (b *CircuitBreaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := b.allow()
+	b.notify(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(ctx)
+	b.record(err)
+	b.notify(ctx)
+	return err
+}
+
+// allow reports whether a call may proceed
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen {
+		if time.Since(b.openedAt) < b.config.CoolDown {
+			return fmt.Errorf("%w: %s", ErrCircuitOpen, b.name)
+		}
+		b.setState(CircuitHalfOpen)
+	}
+
+	if b.state == CircuitHalfOpen {
+		if b.trials+b.successes >= b.config.HalfOpenRequests {
+			return fmt.Errorf("%w: %s", ErrCircuitOpen, b.name)
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// record counts the outcome of a call and updates the state. Calls
+// cancelled by the caller say nothing about the dependency and aren't counted.
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cancelled := errors.Is(err, context.Canceled)
+	success := err == nil
+
+	switch b.state {
+	case CircuitHalfOpen:
+		b.trials--
+		if cancelled {
+			return
+		}
+		if !success {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenRequests {
+			b.buckets = [circuitBuckets]circuitBucket{}
+			b.setState(CircuitClosed)
+		}
+
+	case CircuitClosed:
+		if cancelled {
+			return
+		}
+		bucket := b.bucket(time.Now())
+		if success {
+			bucket.successes++
+			return
+		}
+		bucket.failures++
+
+		successes, failures := b.counts(time.Now())
+		total := successes + failures
+		if total >= b.config.MinRequests && float64(failures)/float64(total) >= b.config.FailureRate {
+			b.open()
+		}
+	}
+}
+
+// bucket returns the bucket for the given time, recycling expired buckets
+func (b *CircuitBreaker) bucket(now time.Time) *circuitBucket {
+	width := b.config.Window / circuitBuckets
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%circuitBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = circuitBucket{start: start}
+	}
+	return bucket
+}
+
+// counts sums the outcomes of the calls within the window
+func (b *CircuitBreaker) counts(now time.Time) (int, int) {
+	successes, failures := 0, 0
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.config.Window {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	return successes, failures
+}
+
+func (b *CircuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+// setState changes the state and queues the change to be reported.
+// Callers hold b.mu.
+func (b *CircuitBreaker) setState(state CircuitState) {
+	from := b.state
+	if from == state {
+		return
+	}
+	b.state = state
+	b.trials = 0
+	b.successes = 0
+	b.changes = append(b.changes, circuitChange{from: from, to: state})
+}
+
+// notify reports queued state changes. It is called without holding b.mu so
+// that slow event consumers don't block other callers.
+func (b *CircuitBreaker) notify(ctx context.Context) {
+	b.mu.Lock()
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	for _, change := range changes {
+		EmitEvent(ctx, Event{
+			Type:      EventCircuitStateChange,
+			Name:      b.name,
+			Timestamp: time.Now(),
+			Metadata: map[string]interface{}{
+				"from": string(change.from),
+				"to":   string(change.to),
+			},
+		})
+		if b.config.OnStateChange != nil {
+			b.config.OnStateChange(b.name, change.from, change.to)
+		}
+	}
+}
+
+// breakerTool is a tool guarded by a circuit breaker
+type breakerTool struct {
+	Tool
+	breaker *CircuitBreaker
+}
+
+// WithToolCircuitBreaker wraps a tool so that its executions go through a
+// circuit breaker of its own. While the circuit is open Execute fails with
+// ErrCircuitOpen without calling the tool.
+func WithToolCircuitBreaker(tool Tool, config CircuitBreakerConfig) Tool {
+	return &breakerTool{
+		Tool:    tool,
+		breaker: NewCircuitBreaker(tool.Name(), config),
+	}
+}
+
+func (t *breakerTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	var result interface{}
+	err := t.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = t.Tool.Execute(ctx, args)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"sync"
+)
+
+// TokenBudget tracks the model tokens a run may still spend. Agents spend
+// their usage into the budget carried by the context, so it is shared by all
+// agents of the run.
+type TokenBudget struct {
+	mu         sync.Mutex
+	limit      int
+	used       int
+	downgrades map[string]string
+}
+
+// NewTokenBudget creates a budget of limit tokens
+func NewTokenBudget(limit int) *TokenBudget {
+	return &TokenBudget{limit: limit}
+}
+
+// Limit returns the number of tokens the budget started with
+func (b *TokenBudget) Limit() int {
+	return b.limit
+}
+
+// Spend records tokens used by the run
+func (b *TokenBudget) Spend(tokens int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += tokens
+}
+
+// Used returns the number of tokens spent so far
+func (b *TokenBudget) Used() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// Remaining returns the number of tokens left, which is negative once the
+// budget is overspent
+func (b *TokenBudget) Remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limit - b.used
+}
+
+// RecordDowngrade notes that the agent switched to model for the rest of the
+// run and reports whether that is a change
+func (b *TokenBudget) RecordDowngrade(agentID, model string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.downgrades == nil {
+		b.downgrades = make(map[string]string)
+	}
+	if b.downgrades[agentID] == model {
+		return false
+	}
+	b.downgrades[agentID] = model
+	return true
+}
+
+// Downgrades returns the model each downgraded agent switched to
+func (b *TokenBudget) Downgrades() map[string]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	downgrades := make(map[string]string, len(b.downgrades))
+	for k, v := range b.downgrades {
+		downgrades[k] = v
+	}
+	return downgrades
+}
+
+type tokenBudgetKey struct{}
+
+// WithTokenBudget returns a context carrying the token budget of a run
+func WithTokenBudget(ctx context.Context, budget *TokenBudget) context.Context {
+	return context.WithValue(ctx, tokenBudgetKey{}, budget)
+}
+
+// TokenBudgetFromContext returns the token budget of the run, or nil when
+// the run has none
+func TokenBudgetFromContext(ctx context.Context) *TokenBudget {
+	budget, _ := ctx.Value(tokenBudgetKey{}).(*TokenBudget)
+	return budget
+}
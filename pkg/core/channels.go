@@ -0,0 +1,324 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrUnknownChannel is returned when writing to a channel that wasn't
+	// added to the state
+	ErrUnknownChannel = errors.New("unknown channel")
+
+	// ErrDuplicateChannel is returned when adding a channel name twice
+	ErrDuplicateChannel = errors.New("channel already exists")
+
+	// ErrChannelType is returned when a channel is used with another value
+	// type than it was added with
+	ErrChannelType = errors.New("channel type mismatch")
+)
+
+// Channels is a graph state made of named channels, each merging the values
+// written to it with its own reducer, like LangGraph state annotations.
+// Graphs use it as their state type, StateGraph[*Channels], and nodes read
+// and write single channels through typed Channel handles. It is safe for
+// concurrent use, so nodes fanning out may write from several goroutines;
+// see ParallelChannels for branches with deterministic merges.
+//
+// Channels decoded from JSON, such as trace snapshots, keep their values but
+// not their reducers: writes to them replace the value.
+type Channels struct {
+	mu    sync.Mutex
+	slots map[string]*channelSlot
+
+	// writes records the writes of a parallel branch, nil otherwise
+	writes *[]channelWrite
+}
+
+// channelSlot is a channel and its current value
+type channelSlot struct {
+	value interface{}
+
+	// raw is the JSON value of a decoded channel until it is read
+	raw json.RawMessage
+
+	// typ, reduce and decode are set for channels added with AddChannel
+	typ    reflect.Type
+	reduce func(old, new interface{}) interface{}
+	decode func(json.RawMessage) (interface{}, error)
+}
+
+// channelWrite is a value written to a channel by a parallel branch
+type channelWrite struct {
+	name  string
+	value interface{}
+}
+
+// NewChannels creates a state without channels
+func NewChannels() *Channels {
+	return &Channels{slots: make(map[string]*channelSlot)}
+}
+
+// Channel is a typed handle on a channel of a Channels state
+type Channel[V any] struct {
+	name string
+}
+
+// AddChannel adds a channel to the state and returns its handle. Values
+// written to the channel are merged into the current one with the reducer,
+// which gets the zero value on the first write. A nil reducer keeps the last
+// value written, see LastValue.
+func AddChannel[V any](c *Channels, name string, reducer func(old, new V) V) (Channel[V], error) {
+	if reducer == nil {
+		reducer = LastValue[V]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.slots == nil {
+		c.slots = make(map[string]*channelSlot)
+	}
+	if _, ok := c.slots[name]; ok {
+		return Channel[V]{}, fmt.Errorf("%w: %s", ErrDuplicateChannel, name)
+	}
+	c.slots[name] = &channelSlot{
+		typ: typeOf[V](),
+		reduce: func(old, new interface{}) interface{} {
+			o, _ := old.(V)
+			n, _ := new.(V)
+			return reducer(o, n)
+		},
+		decode: func(raw json.RawMessage) (interface{}, error) {
+			var v V
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		},
+	}
+	return Channel[V]{name: name}, nil
+}
+
+// Name returns the name of the channel
+func (ch Channel[V]) Name() string {
+	return ch.name
+}
+
+// Get returns the value of the channel, or the zero value when nothing was
+// written to it
+func (ch Channel[V]) Get(c *Channels) V {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero V
+	slot, ok := c.slots[ch.name]
+	if !ok {
+		return zero
+	}
+	if slot.raw != nil && slot.decode == nil {
+		// Decoded without the channel's type, so decode on first read
+		var v V
+		if err := json.Unmarshal(slot.raw, &v); err != nil {
+			return zero
+		}
+		slot.value, slot.raw = v, nil
+	}
+	v, ok := slot.value.(V)
+	if !ok {
+		return zero
+	}
+	return v
+}
+
+// Write merges a value into the channel with its reducer
+func (ch Channel[V]) Write(c *Channels, value V) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	slot, ok := c.slots[ch.name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownChannel, ch.name)
+	}
+	if slot.typ != nil && slot.typ != typeOf[V]() {
+		return fmt.Errorf("%w: %s holds %s, not %s", ErrChannelType, ch.name, slot.typ, typeOf[V]())
+	}
+	c.apply(ch.name, slot, value)
+	return nil
+}
+
+// apply merges a value into a slot and records it on parallel branches.
+// The caller holds the lock.
+func (c *Channels) apply(name string, slot *channelSlot, value interface{}) {
+	if slot.reduce == nil {
+		slot.value, slot.raw = value, nil
+	} else {
+		slot.value = slot.reduce(slot.value, value)
+	}
+	if c.writes != nil {
+		*c.writes = append(*c.writes, channelWrite{name: name, value: value})
+	}
+}
+
+// Names returns the names of the channels, sorted
+func (c *Channels) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.slots))
+	for name := range c.slots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns a copy of the state with the same channels and reducers.
+// Values are copied shallowly.
+func (c *Channels) Clone() *Channels {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clone := &Channels{slots: make(map[string]*channelSlot, len(c.slots))}
+	for name, slot := range c.slots {
+		copied := *slot
+		clone.slots[name] = &copied
+	}
+	return clone
+}
+
+// MarshalJSON encodes the state as an object of channel values
+func (c *Channels) MarshalJSON() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make(map[string]interface{}, len(c.slots))
+	for name, slot := range c.slots {
+		if slot.raw != nil {
+			values[name] = slot.raw
+		} else {
+			values[name] = slot.value
+		}
+	}
+	return json.Marshal(values)
+}
+
+// UnmarshalJSON decodes channel values into the state. Channels the state
+// has are decoded with their type; others are added without a reducer.
+func (c *Channels) UnmarshalJSON(data []byte) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.slots == nil {
+		c.slots = make(map[string]*channelSlot)
+	}
+	for name, raw := range values {
+		slot, ok := c.slots[name]
+		if !ok {
+			c.slots[name] = &channelSlot{raw: raw}
+			continue
+		}
+		if slot.decode == nil {
+			slot.value, slot.raw = nil, raw
+			continue
+		}
+		value, err := slot.decode(raw)
+		if err != nil {
+			return fmt.Errorf("failed to decode channel %s: %w", name, err)
+		}
+		slot.value, slot.raw = value, nil
+	}
+	return nil
+}
+
+// LastValue is the reducer keeping the last value written
+func LastValue[V any](old, new V) V {
+	return new
+}
+
+// AppendValues is the reducer appending the values written to a list. It
+// always returns a new slice, so snapshots never share appended elements.
+func AppendValues[V any](old, new []V) []V {
+	out := make([]V, 0, len(old)+len(new))
+	out = append(out, old...)
+	return append(out, new...)
+}
+
+// ParallelChannels returns a node running branches concurrently. Every
+// branch works on a snapshot of the state taken when the node starts, so it
+// sees its own writes but none of its siblings'. Once all branches finish,
+// their writes are merged into the state through the channel reducers,
+// branch by branch in the order given, so the result doesn't depend on which
+// branch finished first. When a branch fails nothing is merged and the
+// context of the others is cancelled. A branch calling CancelSiblings
+// cancels the others instead, and only the writes of the branches that
+// completed are merged.
+func ParallelChannels(branches ...func(ctx context.Context, c *Channels) error) func(ctx context.Context, c *Channels) (*Channels, error) {
+	return func(ctx context.Context, c *Channels) (*Channels, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		group := newBranchGroup(ctx, len(branches))
+		defer group.release()
+
+		writes := make([][]channelWrite, len(branches))
+		errs := make([]error, len(branches))
+		var wg sync.WaitGroup
+		for i, branch := range branches {
+			snapshot := c.Clone()
+			snapshot.writes = &writes[i]
+			wg.Add(1)
+			go func(i int, branch func(context.Context, *Channels) error) {
+				defer wg.Done()
+				err := branch(group.context(i), snapshot)
+				if !group.finish(i) {
+					return
+				}
+				if err != nil {
+					errs[i] = err
+					cancel()
+				}
+			}(i, branch)
+		}
+		wg.Wait()
+
+		if err := errors.Join(errs...); err != nil {
+			return c, fmt.Errorf("parallel branch failed: %w", err)
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, branchWrites := range writes {
+			if group.isDropped(i) {
+				continue
+			}
+			for _, w := range branchWrites {
+				if slot, ok := c.slots[w.name]; ok {
+					c.apply(w.name, slot, w.value)
+				}
+			}
+		}
+		return c, nil
+	}
+}
+
+// AdaptNode runs a node written for a struct state on the value of a channel
+// holding that struct, so existing struct-state nodes, and compiled
+// struct-state graphs through their Invoke method, can be reused in a
+// channel graph. The result is written through the channel's reducer, so
+// the channel should keep the last value.
+func AdaptNode[V any](ch Channel[V], node func(ctx context.Context, state V) (V, error)) func(ctx context.Context, c *Channels) (*Channels, error) {
+	return func(ctx context.Context, c *Channels) (*Channels, error) {
+		result, err := node(ctx, ch.Get(c))
+		if err != nil {
+			return c, err
+		}
+		if err := ch.Write(c, result); err != nil {
+			return c, err
+		}
+		return c, nil
+	}
+}
+
+// typeOf returns the type V stands for, including interface types
+func typeOf[V any]() reflect.Type {
+	return reflect.TypeOf((*V)(nil)).Elem()
+}
@@ -0,0 +1,143 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// sum is a reducer adding up the values written
+func sum(old, new int) int { return old + new }
+
+// newChannels creates a state with a summed total and an appended log
+func newChannels(t *testing.T) (*core.Channels, core.Channel[int], core.Channel[[]string]) {
+	t.Helper()
+	c := core.NewChannels()
+	total, err := core.AddChannel(c, "total", sum)
+	if err != nil {
+		t.Fatalf("AddChannel: %v", err)
+	}
+	log, err := core.AddChannel(c, "log", core.AppendValues[string])
+	if err != nil {
+		t.Fatalf("AddChannel: %v", err)
+	}
+	return c, total, log
+}
+
+func TestChannelWritesFromManyGoroutines(t *testing.T) {
+	c, total, _ := newChannels(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			total.Write(c, 1)
+		}()
+	}
+	wg.Wait()
+	if got := total.Get(c); got != 100 {
+		t.Errorf("total = %d, want every write summed (100)", got)
+	}
+}
+
+func TestParallelChannelsMergeInBranchOrder(t *testing.T) {
+	c, total, log := newChannels(t)
+	branch := func(name string, delay time.Duration) func(context.Context, *core.Channels) error {
+		return func(ctx context.Context, c *core.Channels) error {
+			time.Sleep(delay)
+			if err := log.Write(c, []string{name}); err != nil {
+				return err
+			}
+			if got := log.Get(c); strings.Join(got, ",") != "start,"+name {
+				t.Errorf("branch %s sees log %v, want only its own write", name, got)
+			}
+			return total.Write(c, len(name))
+		}
+	}
+	g := newGraph[*core.Channels]()
+	g.AddNode("start", func(ctx context.Context, c *core.Channels) (*core.Channels, error) {
+		return c, log.Write(c, []string{"start"})
+	})
+	g.AddNode("fan", core.ParallelChannels(
+		branch("slow", 20*time.Millisecond),
+		branch("quick", 0),
+		branch("medium", 10*time.Millisecond),
+	))
+	chain(g, "start", "fan")
+
+	out, err := compile(t, g).Invoke(context.Background(), c)
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if got := strings.Join(log.Get(out), ","); got != "start,slow,quick,medium" {
+		t.Errorf("log = %s, want the branches merged in the order given", got)
+	}
+	if got := total.Get(out); got != len("slow")+len("quick")+len("medium") {
+		t.Errorf("total = %d, want every branch's write summed", got)
+	}
+}
+
+func TestParallelChannelsFailedBranchMergesNothing(t *testing.T) {
+	c, total, _ := newChannels(t)
+	errBranch := errors.New("branch failed")
+	node := core.ParallelChannels(
+		func(ctx context.Context, c *core.Channels) error {
+			return total.Write(c, 1)
+		},
+		func(ctx context.Context, c *core.Channels) error {
+			total.Write(c, 2)
+			return errBranch
+		},
+	)
+
+	out, err := node(context.Background(), c)
+	if !errors.Is(err, errBranch) {
+		t.Fatalf("node = %v, want the branch's error", err)
+	}
+	if got := total.Get(out); got != 0 {
+		t.Errorf("total = %d, want no write merged", got)
+	}
+}
+
+func TestAdaptNodeRunsStructNode(t *testing.T) {
+	c := core.NewChannels()
+	tickets, err := core.AddChannel[ticket](c, "ticket", nil)
+	if err != nil {
+		t.Fatalf("AddChannel: %v", err)
+	}
+	tickets.Write(c, ticket{Title: "t"})
+
+	triage := func(ctx context.Context, s ticket) (ticket, error) {
+		s.Priority = 2
+		return s, nil
+	}
+	out, err := core.AdaptNode(tickets, triage)(context.Background(), c)
+	if err != nil {
+		t.Fatalf("node: %v", err)
+	}
+	if got := tickets.Get(out); got != (ticket{Title: "t", Priority: 2}) {
+		t.Errorf("ticket = %+v, want the struct node's result", got)
+	}
+}
+
+func TestChannelTypeAndNameChecked(t *testing.T) {
+	c, _, _ := newChannels(t)
+	if _, err := core.AddChannel(c, "total", sum); !errors.Is(err, core.ErrDuplicateChannel) {
+		t.Errorf("adding total twice = %v, want ErrDuplicateChannel", err)
+	}
+
+	other := core.NewChannels()
+	wrong, _ := core.AddChannel[string](other, "total", nil)
+	if err := wrong.Write(c, "x"); !errors.Is(err, core.ErrChannelType) {
+		t.Errorf("writing a string to total = %v, want ErrChannelType", err)
+	}
+	missing, _ := core.AddChannel[int](other, "missing", nil)
+	if err := missing.Write(c, 1); !errors.Is(err, core.ErrUnknownChannel) {
+		t.Errorf("writing to a channel the state lacks = %v, want ErrUnknownChannel", err)
+	}
+}
@@ -0,0 +1,329 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCorruptValue is returned when a stored value is incomplete or
+	// doesn't match the hash it was written with
+	ErrCorruptValue = errors.New("stored value is corrupt")
+)
+
+// StoreOp is a write or delete applied by BatchStore.Apply
+type StoreOp struct {
+	Namespace string
+	Key       string
+
+	// Value is stored under the key unless Delete is set
+	Value  []byte
+	Delete bool
+}
+
+// BatchStore is a Store that can apply several writes and deletes atomically,
+// such as a SQL backend using a transaction or Redis using MULTI. ChunkedStore
+// uses it so a value is never left half written.
+type BatchStore interface {
+	Store
+
+	// Apply applies all operations or none of them
+	Apply(ctx context.Context, ops []StoreOp) error
+}
+
+// Apply applies the operations under a single lock
+func (s *MemoryStore) Apply(ctx context.Context, ops []StoreOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, op := range ops {
+		if op.Delete {
+			delete(s.data[op.Namespace], op.Key)
+			continue
+		}
+		ns, ok := s.data[op.Namespace]
+		if !ok {
+			ns = make(map[string][]byte)
+			s.data[op.Namespace] = ns
+		}
+		ns[op.Key] = append([]byte(nil), op.Value...)
+	}
+	return nil
+}
+
+// DefaultChunkThreshold is the largest value ChunkedStore keeps in a single
+// entry by default
+const DefaultChunkThreshold = 512 * 1024
+
+// manifestPrefix marks entries written by ChunkedStore, so values written
+// before the store was wrapped are still read as they are
+var manifestPrefix = []byte("moego-chunked:")
+
+// chunkNamespaceSuffix is appended to a namespace to keep chunks out of List
+const chunkNamespaceSuffix = "#chunks"
+
+// manifest describes a value stored by ChunkedStore
+type manifest struct {
+	// Hash is the hex SHA-256 of the whole value
+	Hash string `json:"sha256"`
+
+	// Size is the length of the value
+	Size int `json:"size"`
+
+	// Inline holds values up to the chunk threshold
+	Inline []byte `json:"inline,omitempty"`
+
+	// Chunks is the number of chunks of larger values
+	Chunks int `json:"chunks,omitempty"`
+}
+
+// chunkKey is the key of a chunk of a value
+func chunkKey(key, hash string, i int) string {
+	return fmt.Sprintf("%s/%s/%d", key, hash[:16], i)
+}
+
+// ChunkedStore wraps a Store for large values such as checkpointed state.
+// Values are hashed, so writing the value a key already holds is skipped,
+// and values above the threshold are split into chunks so no single entry
+// exceeds backend limits. Reads reassemble chunks and verify the hash,
+// failing with ErrCorruptValue instead of returning a damaged value.
+//
+// When the wrapped store is a BatchStore a value is written atomically.
+// Otherwise its chunks are written before the entry that points to them, so
+// a failed write leaves the previous value readable.
+type ChunkedStore struct {
+	store     Store
+	threshold int
+}
+
+// ChunkedStoreOption configures a ChunkedStore
+type ChunkedStoreOption func(*ChunkedStore)
+
+// WithChunkThreshold sets the largest value kept in a single entry, which is
+// also the size of chunks
+func WithChunkThreshold(bytes int) ChunkedStoreOption {
+	return func(s *ChunkedStore) {
+		if bytes > 0 {
+			s.threshold = bytes
+		}
+	}
+}
+
+// NewChunkedStore wraps store
+func NewChunkedStore(store Store, opts ...ChunkedStoreOption) *ChunkedStore {
+	s := &ChunkedStore{store: store, threshold: DefaultChunkThreshold}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Get returns the value stored under key, reassembled and verified
+func (s *ChunkedStore) Get(ctx context.Context, namespace, key string) ([]byte, bool, error) {
+	data, found, err := s.store.Get(ctx, namespace, key)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	m, ok, err := parseManifest(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %s/%s: %v", ErrCorruptValue, namespace, key, err)
+	}
+	if !ok {
+		return data, true, nil
+	}
+
+	value := m.Inline
+	if m.Chunks > 0 {
+		var buf bytes.Buffer
+		buf.Grow(m.Size)
+		for i := 0; i < m.Chunks; i++ {
+			chunk, found, err := s.store.Get(ctx, namespace+chunkNamespaceSuffix, chunkKey(key, m.Hash, i))
+			if err != nil {
+				return nil, false, err
+			}
+			if !found {
+				return nil, false, fmt.Errorf("%w: %s/%s: chunk %d of %d is missing", ErrCorruptValue, namespace, key, i+1, m.Chunks)
+			}
+			buf.Write(chunk)
+		}
+		value = buf.Bytes()
+	}
+
+	if len(value) != m.Size {
+		return nil, false, fmt.Errorf("%w: %s/%s: got %d bytes, want %d", ErrCorruptValue, namespace, key, len(value), m.Size)
+	}
+	if hashValue(value) != m.Hash {
+		return nil, false, fmt.Errorf("%w: %s/%s: hash mismatch", ErrCorruptValue, namespace, key)
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return value, true, nil
+}
+
+// Put stores value under key. Writing the value the key already holds
+// doesn't write anything, unless the stored copy is damaged.
+func (s *ChunkedStore) Put(ctx context.Context, namespace, key string, value []byte) error {
+	hash := hashValue(value)
+	prev, err := s.manifest(ctx, namespace, key)
+	if err != nil && !errors.Is(err, ErrCorruptValue) {
+		return err
+	}
+	if prev != nil && prev.Hash == hash && prev.Size == len(value) {
+		// Chunks are stored apart from the manifest, so make sure they are
+		// intact before skipping the write
+		if prev.Chunks == 0 {
+			return nil
+		}
+		if _, _, err := s.Get(ctx, namespace, key); err == nil {
+			return nil
+		}
+	}
+
+	m := manifest{Hash: hash, Size: len(value)}
+	var chunks map[string][]byte
+	if len(value) <= s.threshold {
+		m.Inline = value
+	} else {
+		chunks = make(map[string][]byte)
+		for off := 0; off < len(value); off += s.threshold {
+			end := off + s.threshold
+			if end > len(value) {
+				end = len(value)
+			}
+			chunks[chunkKey(key, hash, m.Chunks)] = value[off:end]
+			m.Chunks++
+		}
+	}
+	entry, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	entry = append(append([]byte(nil), manifestPrefix...), entry...)
+
+	var stale []string
+	if prev != nil && prev.Hash != hash {
+		stale = prev.chunkKeys(key)
+	}
+	return s.write(ctx, namespace, key, entry, chunks, stale)
+}
+
+// Delete removes key and its chunks
+func (s *ChunkedStore) Delete(ctx context.Context, namespace, key string) error {
+	prev, err := s.manifest(ctx, namespace, key)
+	if err != nil && !errors.Is(err, ErrCorruptValue) {
+		return err
+	}
+	var chunks []string
+	if prev != nil {
+		chunks = prev.chunkKeys(key)
+	}
+
+	if batch, ok := s.store.(BatchStore); ok {
+		ops := []StoreOp{{Namespace: namespace, Key: key, Delete: true}}
+		for _, chunk := range chunks {
+			ops = append(ops, StoreOp{Namespace: namespace + chunkNamespaceSuffix, Key: chunk, Delete: true})
+		}
+		return batch.Apply(ctx, ops)
+	}
+
+	if err := s.store.Delete(ctx, namespace, key); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := s.store.Delete(ctx, namespace+chunkNamespaceSuffix, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the sorted keys in the namespace that start with prefix
+func (s *ChunkedStore) List(ctx context.Context, namespace, prefix string) ([]string, error) {
+	return s.store.List(ctx, namespace, prefix)
+}
+
+// write stores the chunks and the entry pointing to them, then removes the
+// chunks of the previous value
+func (s *ChunkedStore) write(ctx context.Context, namespace, key string, entry []byte, chunks map[string][]byte, stale []string) error {
+	chunkNamespace := namespace + chunkNamespaceSuffix
+
+	if batch, ok := s.store.(BatchStore); ok {
+		ops := make([]StoreOp, 0, len(chunks)+1+len(stale))
+		for chunk, data := range chunks {
+			ops = append(ops, StoreOp{Namespace: chunkNamespace, Key: chunk, Value: data})
+		}
+		ops = append(ops, StoreOp{Namespace: namespace, Key: key, Value: entry})
+		for _, chunk := range stale {
+			ops = append(ops, StoreOp{Namespace: chunkNamespace, Key: chunk, Delete: true})
+		}
+		return batch.Apply(ctx, ops)
+	}
+
+	for chunk, data := range chunks {
+		if err := s.store.Put(ctx, chunkNamespace, chunk, data); err != nil {
+			return err
+		}
+	}
+	if err := s.store.Put(ctx, namespace, key, entry); err != nil {
+		return err
+	}
+	for _, chunk := range stale {
+		if err := s.store.Delete(ctx, chunkNamespace, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manifest returns the manifest stored under key, or nil when there is none
+func (s *ChunkedStore) manifest(ctx context.Context, namespace, key string) (*manifest, error) {
+	data, found, err := s.store.Get(ctx, namespace, key)
+	if err != nil || !found {
+		return nil, err
+	}
+	m, ok, err := parseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s/%s: %v", ErrCorruptValue, namespace, key, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &m, nil
+}
+
+// chunkKeys returns the keys of the value's chunks
+func (m *manifest) chunkKeys(key string) []string {
+	keys := make([]string, m.Chunks)
+	for i := range keys {
+		keys[i] = chunkKey(key, m.Hash, i)
+	}
+	return keys
+}
+
+// parseManifest decodes an entry written by ChunkedStore. It reports false
+// for values that aren't manifests.
+func parseManifest(data []byte) (manifest, bool, error) {
+	var m manifest
+	if !bytes.HasPrefix(data, manifestPrefix) {
+		return m, false, nil
+	}
+	if err := json.Unmarshal(data[len(manifestPrefix):], &m); err != nil {
+		return m, false, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if len(m.Hash) != sha256.Size*2 {
+		return m, false, fmt.Errorf("invalid manifest hash %q", m.Hash)
+	}
+	return m, true, nil
+}
+
+// hashValue returns the hex SHA-256 of a value
+func hashValue(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,123 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// plainStore hides the batch support of the store it wraps, for the path
+// writing chunks one at a time
+type plainStore struct {
+	core.Store
+}
+
+// chunkNamespace is where ChunkedStore keeps the chunks of values in runs
+const chunkNamespace = "runs#chunks"
+
+// chunkedStores returns a chunked store splitting values above 8 bytes
+// over each kind of backend, along with the backend
+func chunkedStores() map[string]func() (*core.ChunkedStore, core.Store) {
+	return map[string]func() (*core.ChunkedStore, core.Store){
+		"batch": func() (*core.ChunkedStore, core.Store) {
+			backend := core.NewMemoryStore()
+			return core.NewChunkedStore(backend, core.WithChunkThreshold(8)), backend
+		},
+		"plain": func() (*core.ChunkedStore, core.Store) {
+			backend := plainStore{core.NewMemoryStore()}
+			return core.NewChunkedStore(backend, core.WithChunkThreshold(8)), backend
+		},
+	}
+}
+
+func TestChunkedStoreRoundTripAndCleanup(t *testing.T) {
+	ctx := context.Background()
+	for name, newStore := range chunkedStores() {
+		t.Run(name, func(t *testing.T) {
+			store, backend := newStore()
+			first := []byte(strings.Repeat("a", 20))
+			if err := store.Put(ctx, "runs", "run-1", first); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			got, found, err := store.Get(ctx, "runs", "run-1")
+			if err != nil || !found || !bytes.Equal(got, first) {
+				t.Fatalf("Get = %q, %v, %v, want the value written", got, found, err)
+			}
+			if chunks, _ := backend.List(ctx, chunkNamespace, ""); len(chunks) != 3 {
+				t.Errorf("chunks = %v, want 20 bytes split in 3", chunks)
+			}
+			if keys, _ := store.List(ctx, "runs", ""); strings.Join(keys, ",") != "run-1" {
+				t.Errorf("List = %v, want only the key, not its chunks", keys)
+			}
+
+			if err := store.Put(ctx, "runs", "run-1", []byte(strings.Repeat("b", 12))); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if chunks, _ := backend.List(ctx, chunkNamespace, ""); len(chunks) != 2 {
+				t.Errorf("chunks after replacing the value = %v, want only the new value's 2", chunks)
+			}
+
+			if err := store.Delete(ctx, "runs", "run-1"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if chunks, _ := backend.List(ctx, chunkNamespace, ""); len(chunks) != 0 {
+				t.Errorf("chunks after Delete = %v, want none", chunks)
+			}
+			if _, found, err := store.Get(ctx, "runs", "run-1"); found || err != nil {
+				t.Errorf("Get after Delete = %v, %v, want not found", found, err)
+			}
+		})
+	}
+}
+
+func TestChunkedStoreDetectsDamagedAndMissingChunks(t *testing.T) {
+	ctx := context.Background()
+	value := []byte(strings.Repeat("x", 20))
+	for name, damage := range map[string]func(backend core.Store, chunk string){
+		"damaged": func(backend core.Store, chunk string) {
+			backend.Put(ctx, chunkNamespace, chunk, []byte("yyyyyyyy"))
+		},
+		"truncated": func(backend core.Store, chunk string) {
+			backend.Put(ctx, chunkNamespace, chunk, []byte("x"))
+		},
+		"missing": func(backend core.Store, chunk string) {
+			backend.Delete(ctx, chunkNamespace, chunk)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store, backend := chunkedStores()["batch"]()
+			if err := store.Put(ctx, "runs", "run-1", value); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			chunks, _ := backend.List(ctx, chunkNamespace, "")
+			damage(backend, chunks[1])
+
+			if got, _, err := store.Get(ctx, "runs", "run-1"); !errors.Is(err, core.ErrCorruptValue) {
+				t.Fatalf("Get = %q, %v, want ErrCorruptValue", got, err)
+			}
+
+			// Writing the same value again repairs it instead of being skipped
+			if err := store.Put(ctx, "runs", "run-1", value); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if got, _, err := store.Get(ctx, "runs", "run-1"); err != nil || !bytes.Equal(got, value) {
+				t.Errorf("Get after rewriting = %q, %v, want the value", got, err)
+			}
+		})
+	}
+}
+
+func TestChunkedStoreReadsValuesWrittenBeforeWrapping(t *testing.T) {
+	ctx := context.Background()
+	backend := core.NewMemoryStore()
+	backend.Put(ctx, "runs", "old", []byte(`{"status":"done"}`))
+
+	got, found, err := core.NewChunkedStore(backend).Get(ctx, "runs", "old")
+	if err != nil || !found || string(got) != `{"status":"done"}` {
+		t.Errorf("Get = %q, %v, %v, want the value as it was written", got, found, err)
+	}
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnknownCitation is returned when an answer cites a marker that no
+	// document was given for
+	ErrUnknownCitation = errors.New("citation refers to an unknown document")
+)
+
+// CitationsMetadataKey is the message metadata key citations are attached
+// under
+const CitationsMetadataKey = "citations"
+
+// Document is a retrieved document an answer can cite
+type Document struct {
+	// ID identifies the document across retrievals, see DocumentID
+	ID string `json:"id"`
+
+	// Content is the text shown to the model
+	Content string `json:"content"`
+
+	// Source is where the document came from, such as a URL or file path
+	Source string `json:"source,omitempty"`
+
+	// Metadata holds anything else the retriever knows about the document
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// DocumentID returns a stable ID for a document from its source and
+// content, so the same document retrieved twice gets the same ID
+func DocumentID(source, content string) string {
+	hash, err := CanonicalHash([]string{source, content})
+	if err != nil {
+		return ""
+	}
+	return "doc-" + hash[:16]
+}
+
+// Citation links a claim in an answer to the document supporting it
+type Citation struct {
+	// Marker is the number the answer cited, 1 for [1]
+	Marker int `json:"marker"`
+
+	// DocumentID and Source identify the cited document
+	DocumentID string `json:"document_id"`
+	Source     string `json:"source,omitempty"`
+
+	// Paragraph is the index of the paragraph the claim is in
+	Paragraph int `json:"paragraph"`
+
+	// Claim is the sentence the marker belongs to, without markers
+	Claim string `json:"claim"`
+}
+
+var (
+	// citationMarker matches [1] as well as [1, 2]
+	citationMarker = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+	// citationStrip matches a marker with the whitespace before it
+	citationStrip = regexp.MustCompile(`\s*` + citationMarker.String())
+
+	// paragraphBreak matches the blank lines between paragraphs
+	paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+)
+
+// FormatDocuments renders documents for a prompt, numbered [1], [2] and so
+// on in order, with an instruction to cite them by number. ExtractCitations
+// maps the numbers back to the same documents.
+func FormatDocuments(docs []Document) string {
+	var b strings.Builder
+	b.WriteString("Answer using the documents below. Cite the documents supporting each claim " +
+		"by their number in square brackets, like [1] or [1, 2], right after the claim.\n")
+	for i, doc := range docs {
+		fmt.Fprintf(&b, "\n[%d]", i+1)
+		if doc.Source != "" {
+			fmt.Fprintf(&b, " (%s)", doc.Source)
+		}
+		fmt.Fprintf(&b, "\n%s\n", strings.TrimSpace(doc.Content))
+	}
+	return b.String()
+}
+
+// ExtractCitations parses the [n] markers of an answer into citations of
+// docs, numbered as FormatDocuments numbers them. Every marker must refer
+// to one of the docs, otherwise the citations found are returned with an
+// error wrapping ErrUnknownCitation that lists the unknown markers.
+func ExtractCitations(answer string, docs []Document) ([]Citation, error) {
+	var citations []Citation
+	var unknown []int
+	seen := make(map[[2]int]bool)
+
+	for p, paragraph := range paragraphs(answer) {
+		prevClaim := ""
+		for _, sentence := range sentences(paragraph) {
+			claim := strings.TrimSpace(citationStrip.ReplaceAllString(sentence, ""))
+			if claim == "" || strings.Trim(claim, ".,;:!? ") == "" {
+				// Markers set apart from their sentence belong to the one before
+				claim = prevClaim
+			}
+			for _, marker := range markers(sentence) {
+				if marker < 1 || marker > len(docs) {
+					unknown = append(unknown, marker)
+					continue
+				}
+				if seen[[2]int{marker, p}] {
+					continue
+				}
+				seen[[2]int{marker, p}] = true
+				doc := docs[marker-1]
+				citations = append(citations, Citation{
+					Marker:     marker,
+					DocumentID: doc.ID,
+					Source:     doc.Source,
+					Paragraph:  p,
+					Claim:      claim,
+				})
+			}
+			prevClaim = claim
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Ints(unknown)
+		names := make([]string, 0, len(unknown))
+		for i, marker := range unknown {
+			if i == 0 || marker != unknown[i-1] {
+				names = append(names, "["+strconv.Itoa(marker)+"]")
+			}
+		}
+		return citations, fmt.Errorf("%w: %s of %d documents", ErrUnknownCitation, strings.Join(names, ", "), len(docs))
+	}
+	return citations, nil
+}
+
+// UncitedParagraphs returns the paragraphs of an answer that cite nothing.
+// Headings aren't paragraphs and are left out.
+func UncitedParagraphs(answer string) []string {
+	var uncited []string
+	for _, paragraph := range paragraphs(answer) {
+		if !citationMarker.MatchString(paragraph) {
+			uncited = append(uncited, paragraph)
+		}
+	}
+	return uncited
+}
+
+// AttachCitations returns a copy of the message with the citations in its
+// metadata under CitationsMetadataKey
+func AttachCitations(msg Message, citations []Citation) Message {
+	metadata := make(map[string]interface{}, len(msg.Metadata)+1)
+	for k, v := range msg.Metadata {
+		metadata[k] = v
+	}
+	metadata[CitationsMetadataKey] = citations
+	msg.Metadata = metadata
+	return msg
+}
+
+// CitationsFromMessage returns the citations attached to a message
+func CitationsFromMessage(msg Message) []Citation {
+	citations, _ := msg.Metadata[CitationsMetadataKey].([]Citation)
+	return citations
+}
+
+// paragraphs splits text on blank lines, dropping empty paragraphs and
+// markdown headings
+func paragraphs(text string) []string {
+	var out []string
+	for _, block := range paragraphBreak.Split(strings.ReplaceAll(text, "\r\n", "\n"), -1) {
+		block = strings.TrimSpace(block)
+		if block == "" || (strings.HasPrefix(block, "#") && !strings.Contains(block, "\n")) {
+			continue
+		}
+		out = append(out, block)
+	}
+	return out
+}
+
+// sentences splits a paragraph after ., ! and ? followed by whitespace
+func sentences(paragraph string) []string {
+	var out []string
+	start := 0
+	for i := 0; i < len(paragraph)-1; i++ {
+		switch paragraph[i] {
+		case '.', '!', '?':
+			if next := paragraph[i+1]; next == ' ' || next == '\n' || next == '\t' {
+				out = append(out, paragraph[start:i+1])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, paragraph[start:])
+}
+
+// markers returns the numbers cited in text, in order
+func markers(text string) []int {
+	var out []int
+	for _, match := range citationMarker.FindAllStringSubmatch(text, -1) {
+		for _, part := range strings.Split(match[1], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+				out = append(out, n)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,243 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCodecMismatch is returned when stored state was written with a
+	// different codec than the graph uses
+	ErrCodecMismatch = errors.New("codec mismatch")
+)
+
+// Codec serializes graph state. The name is stored alongside persisted state
+// so state written with a different codec is detected instead of misread.
+type Codec[T any] interface {
+	// Name identifies the codec
+	Name() string
+
+	// Marshal encodes the state
+	Marshal(state T) ([]byte, error)
+
+	// Unmarshal decodes the state
+	Unmarshal(data []byte) (T, error)
+}
+
+// binaryCodec is implemented by codecs whose output isn't JSON. Their state
+// is embedded in JSON documents as a base64 string, and destinations that
+// need readable JSON, such as events and interrupts, fall back to
+// encoding/json.
+type binaryCodec interface {
+	Binary() bool
+}
+
+// isBinary reports whether the codec's output isn't JSON
+func isBinary[T any](codec Codec[T]) bool {
+	b, ok := codec.(binaryCodec)
+	return ok && b.Binary()
+}
+
+// JSONCodec encodes state with encoding/json. It is the default codec.
+type JSONCodec[T any] struct {
+	// UseNumber decodes numbers in interface values as json.Number instead
+	// of float64, so large integers and exact decimals survive a round trip
+	UseNumber bool
+
+	// DisallowUnknownFields rejects stored state with fields the state type
+	// doesn't have
+	DisallowUnknownFields bool
+}
+
+func (c JSONCodec[T]) Name() string {
+	return "json"
+}
+
+func (c JSONCodec[T]) Marshal(state T) ([]byte, error) {
+	return json.Marshal(state)
+}
+
+func (c JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	if !c.UseNumber && !c.DisallowUnknownFields {
+		return UnmarshalState[T](data)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if c.UseNumber {
+		dec.UseNumber()
+	}
+	if c.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	var state T
+	if err := dec.Decode(&state); err != nil {
+		var zero T
+		return zero, err
+	}
+	return state, nil
+}
+
+// FuncCodec adapts a pair of functions producing JSON into a codec, for
+// example to encode protobuf fields with protojson or time.Time values in
+// their original zone
+type FuncCodec[T any] struct {
+	name      string
+	marshal   func(T) ([]byte, error)
+	unmarshal func([]byte) (T, error)
+}
+
+// NewFuncCodec creates a codec with the given name from JSON marshal and
+// unmarshal functions
+func NewFuncCodec[T any](name string, marshal func(T) ([]byte, error), unmarshal func([]byte) (T, error)) *FuncCodec[T] {
+	return &FuncCodec[T]{name: name, marshal: marshal, unmarshal: unmarshal}
+}
+
+func (c *FuncCodec[T]) Name() string {
+	return c.name
+}
+
+func (c *FuncCodec[T]) Marshal(state T) ([]byte, error) {
+	return c.marshal(state)
+}
+
+func (c *FuncCodec[T]) Unmarshal(data []byte) (T, error) {
+	return c.unmarshal(data)
+}
+
+// GobCodec encodes state with encoding/gob. Gob keeps types encoding/json
+// loses, such as big.Float, but its output isn't readable, so it is meant for
+// internal persistence only. Concrete types stored in interface fields must
+// be registered with gob.Register.
+type GobCodec[T any] struct{}
+
+func (c GobCodec[T]) Name() string {
+	return "gob"
+}
+
+func (c GobCodec[T]) Binary() bool {
+	return true
+}
+
+func (c GobCodec[T]) Marshal(state T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c GobCodec[T]) Unmarshal(data []byte) (T, error) {
+	var state T
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		var zero T
+		return zero, err
+	}
+	return state, nil
+}
+
+// EncodeState encodes state with the codec for embedding in a JSON document.
+// The output of binary codecs becomes a base64 string.
+func EncodeState[T any](codec Codec[T], state T) (json.RawMessage, error) {
+	data, err := codec.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(codec) {
+		return json.Marshal(data)
+	}
+	return data, nil
+}
+
+// encodedState encodes a state with a codec at most once, so the size
+// check, trace and thread save of a step share one serialization
+type encodedState[T any] struct {
+	codec Codec[T]
+	state T
+
+	done bool
+	data []byte
+	err  error
+}
+
+func newEncodedState[T any](codec Codec[T], state T) *encodedState[T] {
+	return &encodedState[T]{codec: codec, state: state}
+}
+
+// bytes returns the codec's encoding of the state
+func (e *encodedState[T]) bytes() ([]byte, error) {
+	if !e.done {
+		e.data, e.err = e.codec.Marshal(e.state)
+		e.done = true
+	}
+	return e.data, e.err
+}
+
+// json returns the state encoded as by EncodeState
+func (e *encodedState[T]) json() (json.RawMessage, error) {
+	data, err := e.bytes()
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(e.codec) {
+		return json.Marshal(data)
+	}
+	return data, nil
+}
+
+// size returns the size of the encoded state, false when the codec can't
+// encode it
+func (e *encodedState[T]) size() (int, bool) {
+	data, err := e.bytes()
+	if err != nil {
+		return 0, false
+	}
+	return len(data), true
+}
+
+// DecodeState decodes state encoded by EncodeState. A binary codec also
+// accepts plain JSON state, such as state posted by a client.
+func DecodeState[T any](codec Codec[T], data json.RawMessage) (T, error) {
+	if !isBinary(codec) {
+		return codec.Unmarshal(data)
+	}
+
+	var encoded []byte
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return UnmarshalState[T](data)
+	}
+	return codec.Unmarshal(encoded)
+}
+
+// CheckCodec returns an ErrCodecMismatch error when state stored with the
+// named codec can't be read by codec. An empty name is state stored before
+// codecs were recorded, which was always JSON.
+func CheckCodec[T any](codec Codec[T], stored string) error {
+	if stored == "" {
+		stored = JSONCodec[T]{}.Name()
+	}
+	if stored != codec.Name() {
+		return fmt.Errorf("%w: state was written with %q but the graph uses %q", ErrCodecMismatch, stored, codec.Name())
+	}
+	return nil
+}
+
+// EncodeJSON encodes state as readable JSON for a destination outside the
+// graph, such as a client. It uses the codec unless the codec is binary, in
+// which case encoding/json is used.
+func EncodeJSON[T any](codec Codec[T], state T) ([]byte, error) {
+	if codec == nil || isBinary(codec) {
+		return json.Marshal(state)
+	}
+	return codec.Marshal(state)
+}
+
+// DecodeJSON decodes state encoded by EncodeJSON
+func DecodeJSON[T any](codec Codec[T], data []byte) (T, error) {
+	if codec == nil || isBinary(codec) {
+		return UnmarshalState[T](data)
+	}
+	return codec.Unmarshal(data)
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ConversationDriver runs a graph once per user turn for interactive chat
+// applications. It keeps the conversation state and thread ID between turns,
+// and when the graph interrupts to ask the user something, the next turn
+// resumes the run with the user's answer instead of starting a new one.
+type ConversationDriver[T any] struct {
+	graph    *StateGraph[T]
+	runnable *RunnableState[T]
+
+	// inject adds a user message to the state
+	inject func(state T, userInput string) T
+
+	// extract returns the assistant reply from the state
+	extract func(state T) string
+
+	threadID string
+	state    T
+
+	mu sync.Mutex
+
+	// run is the in-flight run paused on an interrupt, if any
+	run *conversationRun[T]
+
+	// onStream receives stream events for the current turn
+	onStream func(StreamEvent)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// conversationRun is a graph run that outlives a single turn
+type conversationRun[T any] struct {
+	state T
+	err   error
+	done  chan struct{}
+}
+
+// NewConversationDriver creates a conversation driver for the graph, starting
+// from the initial state with a new thread ID
+func NewConversationDriver[T any](graph *StateGraph[T], initial T, inject func(T, string) T, extract func(T) string) (*ConversationDriver[T], error) {
+	runnable, err := graph.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &ConversationDriver[T]{
+		graph:    graph,
+		runnable: runnable,
+		inject:   inject,
+		extract:  extract,
+		threadID: newID("thread-"),
+		state:    initial,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	go d.drainStreams()
+	return d, nil
+}
+
+// ThreadID returns the ID of the conversation thread. It is attached to the
+// run context as the store namespace.
+func (d *ConversationDriver[T]) ThreadID() string {
+	return d.threadID
+}
+
+// State returns the conversation state after the last completed turn
+func (d *ConversationDriver[T]) State() T {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state
+}
+
+// Turn sends the user input to the graph and returns the assistant reply.
+// If the graph interrupts, the reply is the interrupt's question and the
+// next turn resumes the run with the user's answer.
+func (d *ConversationDriver[T]) Turn(ctx context.Context, userInput string) (string, error) {
+	return d.TurnStream(ctx, userInput, nil)
+}
+
+// TurnStream is like Turn but also passes every stream event produced during
+// the turn to onStream
+func (d *ConversationDriver[T]) TurnStream(ctx context.Context, userInput string, onStream func(StreamEvent)) (string, error) {
+	d.mu.Lock()
+	d.onStream = onStream
+	run := d.run
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		d.onStream = nil
+		d.mu.Unlock()
+	}()
+
+	if run != nil {
+		// Answer the question the graph asked on the previous turn
+		if err := d.graph.Resume(d.inject(run.state, userInput)); err != nil {
+			return "", err
+		}
+	} else {
+		run = &conversationRun[T]{
+			state: d.inject(d.State(), userInput),
+			done:  make(chan struct{}),
+		}
+		d.mu.Lock()
+		d.run = run
+		d.mu.Unlock()
+
+		go func(input T) {
+			defer close(run.done)
+			runCtx := WithThreadID(WithNamespace(d.ctx, d.threadID), d.threadID)
+			run.state, run.err = d.runnable.Invoke(runCtx, input)
+		}(run.state)
+	}
+
+	select {
+	case <-run.done:
+		d.mu.Lock()
+		d.run = nil
+		if run.err == nil {
+			d.state = run.state
+		}
+		d.mu.Unlock()
+		if run.err != nil {
+			return "", run.err
+		}
+		return d.extract(run.state), nil
+
+	case info := <-d.graph.GetInterruptChannel():
+		// info.State is redacted, resume from the state the run paused with
+		if state, ok := d.graph.PausedState(info.RunID); ok {
+			run.state = state
+		}
+		// A string payload is the question itself, anything else leaves
+		// the question to be read from the state
+		question, err := UnmarshalState[string](info.Data)
+		if err != nil || question == "" {
+			question = d.extract(run.state)
+		}
+		return question, nil
+
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Close cancels any in-flight run and stops the driver
+func (d *ConversationDriver[T]) Close() {
+	d.cancel()
+}
+
+// drainStreams keeps the graph's stream channels flowing, forwarding events
+// to the current turn's callback
+func (d *ConversationDriver[T]) drainStreams() {
+	for {
+		var evt StreamEvent
+		select {
+		case evt = <-d.graph.GetStreamChannel():
+		case e := <-d.graph.GetEventChannel():
+			evt = StreamEvent{Mode: StreamDebug, Data: e}
+		case <-d.ctx.Done():
+			return
+		}
+
+		d.mu.Lock()
+		onStream := d.onStream
+		d.mu.Unlock()
+		if onStream != nil {
+			onStream(evt)
+		}
+	}
+}
+
+// newID returns a random ID with the given prefix
+func newID(prefix string) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return prefix + time.Now().Format("20060102150405.000000000")
+	}
+	return prefix + hex.EncodeToString(b)
+}
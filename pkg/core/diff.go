@@ -0,0 +1,189 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// ErrDiffMismatch is returned when diff ops don't apply to the given text
+	ErrDiffMismatch = errors.New("diff does not match text")
+)
+
+// Diff operation kinds
+const (
+	DiffKeep   = "keep"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffOp is a single operation of a word-level diff
+type DiffOp struct {
+	// Op is DiffKeep, DiffInsert or DiffDelete
+	Op string `json:"op"`
+
+	// Text is the text kept, inserted or deleted
+	Text string `json:"text"`
+}
+
+// DraftDiff is sent on the custom stream when a node changes a draft.
+// Clients rebuild the draft by applying Ops to their previous copy with
+// ApplyDiff, or replace it with Full when Resync is set.
+type DraftDiff struct {
+	// Field is the name of the draft field
+	Field string `json:"field"`
+
+	// Node is the node that changed the draft
+	Node string `json:"node"`
+
+	// Iteration counts the changes to the draft during the run, from 1
+	Iteration int `json:"iteration"`
+
+	// Ops transform the previous draft into the new one
+	Ops []DiffOp `json:"ops,omitempty"`
+
+	// Resync is set on full-text frames
+	Resync bool `json:"resync,omitempty"`
+
+	// Full is the complete draft on resync frames
+	Full string `json:"full,omitempty"`
+}
+
+// DraftDiffConfig configures streaming of draft diffs
+type DraftDiffConfig[T any] struct {
+	// Field is the name reported in each frame
+	Field string
+
+	// Get returns the draft from the state
+	Get func(T) string
+
+	// ResyncEvery sends a full-text frame every N changes. Zero only sends
+	// full text on the first change and on request.
+	ResyncEvery int
+
+	// resync is set when a client asks for full text
+	resync atomic.Bool
+}
+
+// RequestResync makes the next frame carry the full draft, for example when a
+// client reconnects or detects drift
+func (c *DraftDiffConfig[T]) RequestResync() {
+	c.resync.Store(true)
+}
+
+// draftTracker follows a draft across the nodes of a single run
+type draftTracker[T any] struct {
+	config    *DraftDiffConfig[T]
+	previous  string
+	iteration int
+}
+
+// frame returns the frame for the draft after node ran, if it changed
+func (t *draftTracker[T]) frame(node string, state T) (DraftDiff, bool) {
+	current := t.config.Get(state)
+	if current == t.previous {
+		return DraftDiff{}, false
+	}
+
+	t.iteration++
+	frame := DraftDiff{Field: t.config.Field, Node: node, Iteration: t.iteration}
+
+	resync := t.config.resync.Swap(false)
+	if t.iteration == 1 || resync || (t.config.ResyncEvery > 0 && t.iteration%t.config.ResyncEvery == 0) {
+		frame.Resync = true
+		frame.Full = current
+	} else {
+		frame.Ops = WordDiff(t.previous, current)
+	}
+
+	t.previous = current
+	return frame, true
+}
+
+// wordPattern splits text into words and the whitespace between them
+var wordPattern = regexp.MustCompile(`\s+|\S+`)
+
+// WordDiff returns the word-level operations that turn old into new.
+// Adjacent operations of the same kind are merged.
+func WordDiff(old, new string) []DiffOp {
+	a := wordPattern.FindAllString(old, -1)
+	b := wordPattern.FindAllString(new, -1)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []DiffOp
+	add := func(op, text string) {
+		if n := len(ops); n > 0 && ops[n-1].Op == op {
+			ops[n-1].Text += text
+			return
+		}
+		ops = append(ops, DiffOp{Op: op, Text: text})
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add(DiffKeep, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(DiffDelete, a[i])
+			i++
+		default:
+			add(DiffInsert, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(DiffDelete, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(DiffInsert, b[j])
+	}
+	return ops
+}
+
+// ApplyDiff applies diff operations to old and returns the new text. It fails
+// with ErrDiffMismatch when the kept or deleted text doesn't match old, which
+// means the client is out of sync and should request a resync.
+func ApplyDiff(old string, ops []DiffOp) (string, error) {
+	var b strings.Builder
+	pos := 0
+	for _, op := range ops {
+		switch op.Op {
+		case DiffKeep, DiffDelete:
+			if !strings.HasPrefix(old[pos:], op.Text) {
+				return "", fmt.Errorf("%w: expected %q at offset %d", ErrDiffMismatch, op.Text, pos)
+			}
+			if op.Op == DiffKeep {
+				b.WriteString(op.Text)
+			}
+			pos += len(op.Text)
+		case DiffInsert:
+			b.WriteString(op.Text)
+		default:
+			return "", fmt.Errorf("unknown diff op: %s", op.Op)
+		}
+	}
+	if pos != len(old) {
+		return "", fmt.Errorf("%w: %d bytes left unaccounted for", ErrDiffMismatch, len(old)-pos)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,380 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnknownDocFormat is returned by GenerateDocs for an unsupported format
+	ErrUnknownDocFormat = errors.New("unknown doc format")
+)
+
+// DocFormat is the output format of generated graph docs
+type DocFormat string
+
+const (
+	// DocMarkdown renders docs as Markdown with a mermaid code block
+	DocMarkdown DocFormat = "markdown"
+
+	// DocHTML renders docs as a standalone HTML page that draws the
+	// diagram with mermaid.js
+	DocHTML DocFormat = "html"
+)
+
+// NodeOptions describe a node for generated docs
+type NodeOptions struct {
+	// Description says what the node does
+	Description string
+
+	// Agent is the agent the node calls, if any. Its tools are listed when
+	// it implements ToolLister, and its description is used when the node
+	// has none and it implements Describer.
+	Agent interface{}
+
+	// Tools are tools the node uses besides those of Agent
+	Tools []Tool
+
+	// Reads and Writes restrict the node to the state fields they name by
+	// JSON name. The node is handed a copy of the state with the other
+	// fields zeroed, and changes to fields it doesn't write are rejected or
+	// dropped depending on the graph's ScopeMode. Nil leaves all fields
+	// readable or writable. The state must be a struct or a pointer to one.
+	Reads  []string
+	Writes []string
+}
+
+// ToolLister is implemented by agents and nodes that can report their tools
+type ToolLister interface {
+	Tools() []Tool
+}
+
+// Describer is implemented by agents and tools that can describe themselves
+type Describer interface {
+	Description() string
+}
+
+// AddNodeWithOptions adds a node together with its description
+func (g *StateGraph[T]) AddNodeWithOptions(name string, fn func(ctx context.Context, state T) (T, error), opts NodeOptions) {
+	g.AddNode(name, fn)
+	g.SetNodeOptions(name, opts)
+}
+
+// SetNodeOptions sets the description of a node
+func (g *StateGraph[T]) SetNodeOptions(nodeName string, opts NodeOptions) {
+	if g.nodeOptions == nil {
+		g.nodeOptions = make(map[string]NodeOptions)
+	}
+	g.nodeOptions[nodeName] = opts
+}
+
+// funcDescriptions are the default descriptions of node functions built by
+// prebuilt constructors, keyed by code pointer
+var funcDescriptions sync.Map
+
+// DescribeNodeFunc sets the default description of nodes running fn, used
+// when the node was added without one. Node constructors call it so their
+// nodes are documented out of the box. Closures made by the same function
+// literal share a description.
+func DescribeNodeFunc(fn interface{}, description string) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return
+	}
+	funcDescriptions.Store(v.Pointer(), description)
+}
+
+// nodeFuncDescription returns the default description of a node function
+func nodeFuncDescription(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	if d, ok := funcDescriptions.Load(v.Pointer()); ok {
+		return d.(string)
+	}
+	return ""
+}
+
+// NodeDoc is the documentation of a node
+type NodeDoc struct {
+	Name        string
+	Description string
+	Tools       []ToolDoc
+	Breakpoint  bool
+
+	// Reads and Writes are the state fields the node declared
+	Reads  []string
+	Writes []string
+}
+
+// ToolDoc is the documentation of a tool used by a node
+type ToolDoc struct {
+	Name        string
+	Description string
+}
+
+// GraphDoc is the documentation of a graph, built from its structure and the
+// descriptions of its nodes
+type GraphDoc struct {
+	Structure   GraphStructure
+	Nodes       []NodeDoc
+	Breakpoints []string
+}
+
+// Doc collects the documentation of the graph
+func (g *StateGraph[T]) Doc() GraphDoc {
+	doc := GraphDoc{
+		Structure:   g.Structure(),
+		Breakpoints: g.interruptManager.Breakpoints(),
+	}
+	breakpoints := make(map[string]bool, len(doc.Breakpoints))
+	for _, name := range doc.Breakpoints {
+		breakpoints[name] = true
+	}
+
+	for _, name := range doc.Structure.Nodes {
+		opts := g.nodeOptions[name]
+		node := NodeDoc{
+			Name:        name,
+			Description: opts.Description,
+			Breakpoint:  breakpoints[name],
+			Reads:       opts.Reads,
+			Writes:      opts.Writes,
+		}
+		if node.Description == "" {
+			if d, ok := opts.Agent.(Describer); ok {
+				node.Description = d.Description()
+			}
+		}
+		if node.Description == "" {
+			node.Description = nodeFuncDescription(g.nodes[name].Function)
+		}
+
+		var tools []Tool
+		if l, ok := opts.Agent.(ToolLister); ok {
+			tools = append(tools, l.Tools()...)
+		}
+		tools = append(tools, opts.Tools...)
+		for _, tool := range tools {
+			node.Tools = append(node.Tools, ToolDoc{Name: tool.Name(), Description: tool.Description()})
+		}
+		doc.Nodes = append(doc.Nodes, node)
+	}
+	return doc
+}
+
+// GenerateDocs renders the documentation of a graph: its nodes with their
+// descriptions and tools, its edges, its breakpoints and a Mermaid diagram
+func GenerateDocs[T any](g *StateGraph[T], format DocFormat) (string, error) {
+	doc := g.Doc()
+	switch format {
+	case DocMarkdown:
+		return doc.Markdown(), nil
+	case DocHTML:
+		return doc.HTML()
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownDocFormat, format)
+	}
+}
+
+// title returns the heading of the docs
+func (d GraphDoc) title() string {
+	if d.Structure.Name == "" {
+		return "Graph"
+	}
+	return d.Structure.Name
+}
+
+// Markdown renders the docs as Markdown
+func (d GraphDoc) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", d.title())
+	if d.Structure.EntryPoint != "" {
+		fmt.Fprintf(&b, "Runs start at `%s`.\n\n", d.Structure.EntryPoint)
+	}
+
+	b.WriteString("## Diagram\n\n```mermaid\n")
+	b.WriteString(d.Structure.Mermaid())
+	b.WriteString("```\n\n")
+
+	b.WriteString("## Nodes\n\n")
+	b.WriteString("| Node | Description | Tools | Breakpoint |\n|---|---|---|---|\n")
+	for _, n := range d.Nodes {
+		names := make([]string, len(n.Tools))
+		for i, t := range n.Tools {
+			names[i] = "`" + t.Name + "`"
+		}
+		breakpoint := ""
+		if n.Breakpoint {
+			breakpoint = "yes"
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", n.Name, markdownCell(n.Description), strings.Join(names, ", "), breakpoint)
+	}
+	b.WriteString("\n")
+
+	if len(d.Structure.Edges) > 0 {
+		b.WriteString("## Edges\n\n")
+		b.WriteString("| From | Route | To |\n|---|---|---|\n")
+		for _, e := range d.Structure.Edges {
+			to := "any node"
+			if e.To != "" {
+				to = "`" + e.To + "`"
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", e.From, markdownCell(e.Label), to)
+		}
+		b.WriteString("\n")
+	}
+
+	if d.hasScopes() {
+		b.WriteString("## State access\n\n")
+		b.WriteString("| Node | Reads | Writes |\n|---|---|---|\n")
+		for _, n := range d.Nodes {
+			if !n.scoped() {
+				continue
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", n.Name, fieldList(n.Reads, "`"), fieldList(n.Writes, "`"))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(d.Structure.DataFlow) > 0 {
+		b.WriteString("## Data flow\n\n")
+		b.WriteString("| From | Fields | To |\n|---|---|---|\n")
+		for _, f := range d.Structure.DataFlow {
+			fmt.Fprintf(&b, "| `%s` | %s | `%s` |\n", f.From, fieldList(f.Fields, "`"), f.To)
+		}
+		b.WriteString("\n")
+	}
+
+	for _, n := range d.Nodes {
+		if len(n.Tools) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "## Tools of `%s`\n\n", n.Name)
+		for _, t := range n.Tools {
+			fmt.Fprintf(&b, "- `%s`: %s\n", t.Name, t.Description)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(d.Breakpoints) > 0 {
+		b.WriteString("## Breakpoints\n\n")
+		for _, name := range d.Breakpoints {
+			fmt.Fprintf(&b, "- `%s`\n", name)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// scoped reports whether the node declared the state fields it accesses
+func (n NodeDoc) scoped() bool {
+	return n.Reads != nil || n.Writes != nil
+}
+
+// hasScopes reports whether any node declared the state fields it accesses
+func (d GraphDoc) hasScopes() bool {
+	for _, n := range d.Nodes {
+		if n.scoped() {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldList lists state fields, each between quote. Nil means every field.
+func fieldList(fields []string, quote string) string {
+	if fields == nil {
+		return "all"
+	}
+	if len(fields) == 0 {
+		return "none"
+	}
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = quote + f + quote
+	}
+	return strings.Join(names, ", ")
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// docTemplate is the HTML page of GraphDoc.HTML
+var docTemplate = template.Must(template.New("doc").Funcs(template.FuncMap{
+	"scoped": func(n NodeDoc) bool { return n.scoped() },
+	"fields": func(fields []string) string { return fieldList(fields, "") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{with .Doc.Structure.EntryPoint}}<p>Runs start at <code>{{.}}</code>.</p>{{end}}
+<h2>Diagram</h2>
+<pre class="mermaid">
+{{.Mermaid}}</pre>
+<h2>Nodes</h2>
+<table>
+<tr><th>Node</th><th>Description</th><th>Tools</th><th>Breakpoint</th></tr>
+{{range .Doc.Nodes}}<tr><td><code>{{.Name}}</code></td><td>{{.Description}}</td><td>{{range $i, $t := .Tools}}{{if $i}}, {{end}}<code title="{{$t.Description}}">{{$t.Name}}</code>{{end}}</td><td>{{if .Breakpoint}}yes{{end}}</td></tr>
+{{end}}</table>
+{{if .Doc.Structure.Edges}}<h2>Edges</h2>
+<table>
+<tr><th>From</th><th>Route</th><th>To</th></tr>
+{{range .Doc.Structure.Edges}}<tr><td><code>{{.From}}</code></td><td>{{.Label}}</td><td>{{if .To}}<code>{{.To}}</code>{{else}}any node{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Scoped}}<h2>State access</h2>
+<table>
+<tr><th>Node</th><th>Reads</th><th>Writes</th></tr>
+{{range .Doc.Nodes}}{{if scoped .}}<tr><td><code>{{.Name}}</code></td><td>{{fields .Reads}}</td><td>{{fields .Writes}}</td></tr>
+{{end}}{{end}}</table>
+{{end}}{{if .Doc.Structure.DataFlow}}<h2>Data flow</h2>
+<table>
+<tr><th>From</th><th>Fields</th><th>To</th></tr>
+{{range .Doc.Structure.DataFlow}}<tr><td><code>{{.From}}</code></td><td>{{fields .Fields}}</td><td><code>{{.To}}</code></td></tr>
+{{end}}</table>
+{{end}}{{range .Doc.Nodes}}{{if .Tools}}<h2>Tools of <code>{{.Name}}</code></h2>
+<ul>
+{{range .Tools}}<li><code>{{.Name}}</code>: {{.Description}}</li>
+{{end}}</ul>
+{{end}}{{end}}<script type="module">
+import mermaid from "https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.esm.min.mjs";
+mermaid.initialize({ startOnLoad: true });
+</script>
+</body>
+</html>
+`))
+
+// HTML renders the docs as a standalone HTML page
+func (d GraphDoc) HTML() (string, error) {
+	var b strings.Builder
+	err := docTemplate.Execute(&b, struct {
+		Title   string
+		Doc     GraphDoc
+		Mermaid string
+		Scoped  bool
+	}{d.title(), d, d.Structure.Mermaid(), d.hasScopes()})
+	if err != nil {
+		return "", fmt.Errorf("failed to render docs: %w", err)
+	}
+	return b.String(), nil
+}
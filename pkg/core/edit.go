@@ -0,0 +1,152 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventStateEdit is emitted when a paused run is resumed with a state that
+// differs from the one it paused with, with the StateEdit as data
+const EventStateEdit EventType = "on_state_edit"
+
+// SourceHumanEdit is the source in the metadata of the values frame carrying
+// a state edited while the run was paused
+const SourceHumanEdit = "human_edit"
+
+// FieldChange is a top-level state field changed by an edit. Before or After
+// is empty when the field was added or removed.
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// StateEdit records a change made to the state of a paused run before it
+// was resumed
+type StateEdit struct {
+	// Editor identifies who resumed the run, if known
+	Editor string `json:"editor,omitempty"`
+
+	// Node is the node the run paused at
+	Node string `json:"node"`
+
+	// Step is the step the run paused at
+	Step int `json:"step"`
+
+	// Changes are the fields that differ, by name
+	Changes []FieldChange `json:"changes"`
+
+	// Time is when the run was resumed
+	Time time.Time `json:"time"`
+}
+
+// DiffState compares two JSON encoded states field by field. States that
+// aren't JSON objects are compared as a whole, reported as the field "".
+func DiffState(before, after json.RawMessage) ([]FieldChange, error) {
+	var a, b map[string]json.RawMessage
+	if json.Unmarshal(before, &a) != nil || json.Unmarshal(after, &b) != nil {
+		same, err := sameJSON(before, after)
+		if err != nil || same {
+			return nil, err
+		}
+		return []FieldChange{{Before: before, After: after}}, nil
+	}
+
+	var changes []FieldChange
+	for _, field := range unionKeys(a, b) {
+		same, err := sameJSON(a[field], b[field])
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare field %s: %w", field, err)
+		}
+		if !same {
+			changes = append(changes, FieldChange{Field: field, Before: a[field], After: b[field]})
+		}
+	}
+	return changes, nil
+}
+
+// sameJSON reports whether two JSON values are equal regardless of key
+// order and formatting
+func sameJSON(a, b json.RawMessage) (bool, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b), nil
+	}
+	if bytes.Equal(a, b) {
+		return true, nil
+	}
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return false, err
+	}
+	ha, err := CanonicalHash(va)
+	if err != nil {
+		return false, err
+	}
+	hb, err := CanonicalHash(vb)
+	if err != nil {
+		return false, err
+	}
+	return ha == hb, nil
+}
+
+// recordEdit publishes the edit of a state while the run was paused: a
+// values frame carrying the edited state, flagged as a human edit, and an
+// EventStateEdit with the changed fields. Both go out before execution
+// resumes, so clients never see output computed from a state they weren't
+// shown. It returns nil when the state wasn't changed.
+func (r *RunnableState[T]) recordEdit(ctx context.Context, node string, step int, editor string, paused, resumed T) *StateEdit {
+	logger := LoggerFromContext(ctx)
+	before, err := r.graph.RedactState(paused)
+	if err != nil {
+		logger.Warn("Failed to record state edit", "node", node, "error", err)
+		return nil
+	}
+	after, err := r.graph.RedactState(resumed)
+	if err != nil {
+		logger.Warn("Failed to record state edit", "node", node, "error", err)
+		return nil
+	}
+	changes, err := DiffState(before, after)
+	if err != nil {
+		logger.Warn("Failed to record state edit", "node", node, "error", err)
+		return nil
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	edit := StateEdit{Editor: editor, Node: node, Step: step, Changes: changes, Time: time.Now()}
+	fields := make([]string, len(changes))
+	for i, change := range changes {
+		fields[i] = change.Field
+	}
+	logger.Info("State edited while paused", "node", node, "editor", editor, "fields", fields)
+
+	r.graph.streamer.emitEditedValue(ctx, resumed, map[string]interface{}{
+		"source": SourceHumanEdit,
+		"node":   node,
+		"editor": editor,
+	})
+	data, _ := json.Marshal(edit)
+	EmitEvent(ctx, Event{
+		Type:      EventStateEdit,
+		Name:      node,
+		RunID:     RunIDFromContext(ctx),
+		Timestamp: edit.Time,
+		Metadata: map[string]interface{}{
+			"source":         SourceHumanEdit,
+			"editor":         editor,
+			"fields":         fields,
+			"langgraph_step": step,
+			"langgraph_node": node,
+		},
+		Data: data,
+	})
+	return &edit
+}
@@ -0,0 +1,264 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrNoWaiter is returned when an external event is delivered that no
+	// run is waiting for
+	ErrNoWaiter = errors.New("no run is waiting for the event")
+
+	// ErrNoEventBus is returned when a node waits for an external event but
+	// the run has no event bus
+	ErrNoEventBus = errors.New("no event bus in context")
+)
+
+// maxDeliveredIDs is how many delivery IDs and answered waits an event bus
+// remembers to ignore duplicate deliveries
+const maxDeliveredIDs = 4096
+
+// ExternalEvent is a callback from an outside system, such as a payment
+// confirmation or a signed document, that a waiting run resumes on
+type ExternalEvent struct {
+	// Name is the kind of event, such as "payment_confirmed"
+	Name string `json:"name"`
+
+	// ThreadID is the thread of the run the event is for
+	ThreadID string `json:"thread_id"`
+
+	// ID identifies the delivery. Deliveries with an ID that was already
+	// delivered are ignored, so senders can safely retry.
+	ID string `json:"id,omitempty"`
+
+	// Payload is the data of the event
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// eventWaiter is a run waiting for an external event
+type eventWaiter struct {
+	match func(ExternalEvent) bool
+	ch    chan ExternalEvent
+}
+
+// eventKey identifies the waiters an event may be for
+type eventKey struct {
+	threadID string
+	name     string
+}
+
+// EventBus hands external events to the runs waiting for them
+type EventBus struct {
+	mu      sync.Mutex
+	waiters map[eventKey][]*eventWaiter
+
+	// held are events kept for runs that will wait for them, such as the
+	// suspended run of a thread that is being resumed
+	held map[eventKey][]ExternalEvent
+
+	// delivered remembers recent delivery IDs, oldest first
+	delivered      map[string]struct{}
+	deliveredOrder []string
+
+	// answered remembers the recent waits that got their event, oldest
+	// first, so late duplicates without an ID are ignored too
+	answered      map[eventKey]struct{}
+	answeredOrder []eventKey
+}
+
+// NewEventBus creates an event bus with no waiters
+func NewEventBus() *EventBus {
+	return &EventBus{
+		waiters:   make(map[eventKey][]*eventWaiter),
+		held:      make(map[eventKey][]ExternalEvent),
+		delivered: make(map[string]struct{}),
+		answered:  make(map[eventKey]struct{}),
+	}
+}
+
+// Wait blocks until an event with the name is delivered for the thread and
+// accepted by match, or ctx is done. A nil match accepts any such event.
+// An event held for the thread is taken right away.
+func (b *EventBus) Wait(ctx context.Context, threadID, name string, match func(ExternalEvent) bool) (ExternalEvent, error) {
+	key := eventKey{threadID: threadID, name: name}
+	w := &eventWaiter{match: match, ch: make(chan ExternalEvent, 1)}
+
+	b.mu.Lock()
+	if evt, ok := b.take(key, match); ok {
+		b.mu.Unlock()
+		return evt, nil
+	}
+	b.waiters[key] = append(b.waiters[key], w)
+	b.mu.Unlock()
+
+	select {
+	case evt := <-w.ch:
+		return evt, nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.remove(key, w)
+		b.mu.Unlock()
+		// The event may have arrived while giving up
+		select {
+		case evt := <-w.ch:
+			return evt, nil
+		default:
+		}
+		return ExternalEvent{}, ctx.Err()
+	}
+}
+
+// Deliver hands the event to the first run waiting for it. Deliveries whose
+// ID was already delivered are ignored, and so are deliveries nobody waits
+// for anymore after a run got an event with the same name on the thread. It
+// returns ErrNoWaiter when no run waits for the event.
+func (b *EventBus) Deliver(ctx context.Context, evt ExternalEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if evt.ID != "" {
+		if _, seen := b.delivered[evt.ID]; seen {
+			return nil
+		}
+	}
+
+	key := eventKey{threadID: evt.ThreadID, name: evt.Name}
+	for _, w := range b.waiters[key] {
+		if w.match != nil && !w.match(evt) {
+			continue
+		}
+		b.remove(key, w)
+		w.ch <- evt
+		b.remember(evt)
+		return nil
+	}
+	if _, ok := b.answered[key]; ok {
+		return nil
+	}
+	return ErrNoWaiter
+}
+
+// Hold keeps the event for the next run that waits for it or takes it with
+// Take, for delivering events to runs that aren't waiting yet
+func (b *EventBus) Hold(evt ExternalEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := eventKey{threadID: evt.ThreadID, name: evt.Name}
+	b.held[key] = append(b.held[key], evt)
+}
+
+// Take returns an event held for the thread with the name that match
+// accepts, without waiting. A nil match accepts any such event. When none
+// is held the thread waits for a new event, so one delivered next is no
+// longer ignored as a duplicate.
+func (b *EventBus) Take(threadID, name string, match func(ExternalEvent) bool) (ExternalEvent, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := eventKey{threadID: threadID, name: name}
+	evt, ok := b.take(key, match)
+	if !ok {
+		delete(b.answered, key)
+	}
+	return evt, ok
+}
+
+// Holding reports whether an event with the name is held for the thread
+func (b *EventBus) Holding(threadID, name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.held[eventKey{threadID: threadID, name: name}]) > 0
+}
+
+// Release drops the events held for the thread
+func (b *EventBus) Release(threadID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key := range b.held {
+		if key.threadID == threadID {
+			delete(b.held, key)
+		}
+	}
+}
+
+// take removes and returns the first held event match accepts. The caller
+// must hold mu.
+func (b *EventBus) take(key eventKey, match func(ExternalEvent) bool) (ExternalEvent, bool) {
+	held := b.held[key]
+	for i, evt := range held {
+		if match != nil && !match(evt) {
+			continue
+		}
+		held = append(held[:i:i], held[i+1:]...)
+		if len(held) == 0 {
+			delete(b.held, key)
+		} else {
+			b.held[key] = held
+		}
+		b.remember(evt)
+		return evt, true
+	}
+	return ExternalEvent{}, false
+}
+
+// Waiting reports whether a run on the thread waits for an event with the name
+func (b *EventBus) Waiting(threadID, name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.waiters[eventKey{threadID: threadID, name: name}]) > 0
+}
+
+// remove unregisters a waiter. The caller must hold mu.
+func (b *EventBus) remove(key eventKey, w *eventWaiter) {
+	waiters := b.waiters[key]
+	for i, other := range waiters {
+		if other == w {
+			waiters = append(waiters[:i:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(b.waiters, key)
+	} else {
+		b.waiters[key] = waiters
+	}
+}
+
+// remember records a delivered event's ID and wait, forgetting the oldest
+// past the limit. The caller must hold mu.
+func (b *EventBus) remember(evt ExternalEvent) {
+	key := eventKey{threadID: evt.ThreadID, name: evt.Name}
+	if _, ok := b.answered[key]; !ok {
+		b.answered[key] = struct{}{}
+		b.answeredOrder = append(b.answeredOrder, key)
+		if len(b.answeredOrder) > maxDeliveredIDs {
+			delete(b.answered, b.answeredOrder[0])
+			b.answeredOrder = b.answeredOrder[1:]
+		}
+	}
+
+	if evt.ID == "" {
+		return
+	}
+	b.delivered[evt.ID] = struct{}{}
+	b.deliveredOrder = append(b.deliveredOrder, evt.ID)
+	if len(b.deliveredOrder) > maxDeliveredIDs {
+		delete(b.delivered, b.deliveredOrder[0])
+		b.deliveredOrder = b.deliveredOrder[1:]
+	}
+}
+
+type eventBusKey struct{}
+
+// WithEventBus returns a context carrying the event bus runs wait on
+func WithEventBus(ctx context.Context, bus *EventBus) context.Context {
+	return context.WithValue(ctx, eventBusKey{}, bus)
+}
+
+// EventBusFromContext returns the event bus of the run, or nil
+func EventBusFromContext(ctx context.Context) *EventBus {
+	bus, _ := ctx.Value(eventBusKey{}).(*EventBus)
+	return bus
+}
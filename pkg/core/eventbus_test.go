@@ -0,0 +1,83 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// deliverTo delivers the event to a run waiting for it
+func deliverTo(t *testing.T, bus *core.EventBus, evt core.ExternalEvent) {
+	t.Helper()
+	got := make(chan core.ExternalEvent, 1)
+	go func() {
+		received, err := bus.Wait(context.Background(), evt.ThreadID, evt.Name, nil)
+		if err != nil {
+			t.Errorf("Wait: %v", err)
+		}
+		got <- received
+	}()
+	for !bus.Waiting(evt.ThreadID, evt.Name) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := bus.Deliver(context.Background(), evt); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	<-got
+}
+
+func TestEventBusIgnoresLateDuplicates(t *testing.T) {
+	bus := core.NewEventBus()
+	ctx := context.Background()
+	deliverTo(t, bus, core.ExternalEvent{Name: "approved", ThreadID: "t1", ID: "evt-1"})
+	deliverTo(t, bus, core.ExternalEvent{Name: "signed", ThreadID: "t1"})
+
+	for _, evt := range []core.ExternalEvent{
+		{Name: "approved", ThreadID: "t1", ID: "evt-1"},
+		{Name: "signed", ThreadID: "t1"},
+	} {
+		if err := bus.Deliver(ctx, evt); err != nil {
+			t.Errorf("late duplicate %+v = %v, want it ignored", evt, err)
+		}
+	}
+	if err := bus.Deliver(ctx, core.ExternalEvent{Name: "approved", ThreadID: "t2"}); !errors.Is(err, core.ErrNoWaiter) {
+		t.Errorf("event nobody waited for = %v, want ErrNoWaiter", err)
+	}
+}
+
+func TestEventBusHeldEvents(t *testing.T) {
+	bus := core.NewEventBus()
+	bus.Hold(core.ExternalEvent{Name: "approved", ThreadID: "t1", Payload: []byte(`"no"`)})
+	bus.Hold(core.ExternalEvent{Name: "approved", ThreadID: "t1", Payload: []byte(`"yes"`)})
+	if !bus.Holding("t1", "approved") {
+		t.Fatal("held event not reported")
+	}
+
+	evt, ok := bus.Take("t1", "approved", func(evt core.ExternalEvent) bool {
+		return string(evt.Payload) == `"yes"`
+	})
+	if !ok || string(evt.Payload) != `"yes"` {
+		t.Fatalf("Take = %s, %v, want the accepted event", evt.Payload, ok)
+	}
+	evt, err := bus.Wait(context.Background(), "t1", "approved", nil)
+	if err != nil || string(evt.Payload) != `"no"` {
+		t.Fatalf("Wait = %s, %v, want the other held event", evt.Payload, err)
+	}
+
+	// A thread waiting again takes new events, not ignored duplicates
+	if _, ok := bus.Take("t1", "approved", nil); ok {
+		t.Fatal("Take returned an event that was already taken")
+	}
+	if err := bus.Deliver(context.Background(), core.ExternalEvent{Name: "approved", ThreadID: "t1"}); !errors.Is(err, core.ErrNoWaiter) {
+		t.Errorf("new event after a wait = %v, want ErrNoWaiter", err)
+	}
+
+	bus.Hold(core.ExternalEvent{Name: "approved", ThreadID: "t1"})
+	bus.Release("t1")
+	if bus.Holding("t1", "approved") {
+		t.Error("released event still held")
+	}
+}
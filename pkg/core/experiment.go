@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// Variant is one arm of an experiment
+type Variant[T any] struct {
+	// Name identifies the variant in events and metrics
+	Name string
+
+	// Weight is the variant's relative share of threads. Zero counts as 1.
+	Weight int
+
+	// Nodes replace the functions of the named nodes for threads in this variant
+	Nodes map[string]func(ctx context.Context, state T) (T, error)
+
+	// AgentConfig overrides agent configuration, such as model or
+	// system_message, keyed by agent ID
+	AgentConfig map[string]map[string]interface{}
+}
+
+// Experiment splits a graph's threads between variants, for example to
+// compare two prompts against live traffic. Every event emitted during a run
+// is tagged with the experiment and variant names.
+type Experiment[T any] struct {
+	// Name identifies the experiment
+	Name string
+
+	// Variants are the arms of the experiment. The first one is used for
+	// runs without a thread ID.
+	Variants []Variant[T]
+
+	// Assign optionally picks the variant name for a thread. By default
+	// threads are split by a hash of the experiment name and thread ID.
+	Assign func(threadID string) string
+}
+
+// Variant returns the variant assigned to the thread. The assignment only
+// depends on the thread ID, so it is the same for every run and resume of a
+// thread.
+func (e *Experiment[T]) Variant(threadID string) *Variant[T] {
+	if len(e.Variants) == 0 {
+		return nil
+	}
+	if threadID == "" {
+		return &e.Variants[0]
+	}
+
+	if e.Assign != nil {
+		return e.variantNamed(e.Assign(threadID))
+	}
+
+	total := 0
+	for _, v := range e.Variants {
+		total += variantWeight(v.Weight)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(e.Name + ":" + threadID))
+	bucket := int(h.Sum64() % uint64(total))
+	for i := range e.Variants {
+		bucket -= variantWeight(e.Variants[i].Weight)
+		if bucket < 0 {
+			return &e.Variants[i]
+		}
+	}
+	return &e.Variants[len(e.Variants)-1]
+}
+
+// variantNamed returns the variant with the given name, or the first variant
+func (e *Experiment[T]) variantNamed(name string) *Variant[T] {
+	for i := range e.Variants {
+		if e.Variants[i].Name == name {
+			return &e.Variants[i]
+		}
+	}
+	return &e.Variants[0]
+}
+
+func variantWeight(weight int) int {
+	if weight <= 0 {
+		return 1
+	}
+	return weight
+}
+
+type threadIDKey struct{}
+type variantNameKey struct{}
+type agentConfigKey struct{}
+
+// WithThreadID returns a context carrying the ID of the conversation thread a
+// run belongs to
+func WithThreadID(ctx context.Context, threadID string) context.Context {
+	return context.WithValue(ctx, threadIDKey{}, threadID)
+}
+
+// ThreadIDFromContext returns the thread ID attached to the context, if any
+func ThreadIDFromContext(ctx context.Context) string {
+	threadID, _ := ctx.Value(threadIDKey{}).(string)
+	return threadID
+}
+
+// WithVariant pins the experiment variant for runs started with the context.
+// Forks of a thread should pass the parent's variant so they stay in the same
+// arm of the experiment.
+func WithVariant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, variantNameKey{}, name)
+}
+
+// VariantFromContext returns the experiment variant of the running graph, if any
+func VariantFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(variantNameKey{}).(string)
+	return name
+}
+
+// WithAgentConfig returns a context carrying agent configuration overrides
+// keyed by agent ID
+func WithAgentConfig(ctx context.Context, overrides map[string]map[string]interface{}) context.Context {
+	return context.WithValue(ctx, agentConfigKey{}, overrides)
+}
+
+// WithAgentOverride returns a context that adds configuration overrides for
+// one agent on top of those ctx already carries
+func WithAgentOverride(ctx context.Context, agentID string, config map[string]interface{}) context.Context {
+	existing, _ := ctx.Value(agentConfigKey{}).(map[string]map[string]interface{})
+	overrides := make(map[string]map[string]interface{}, len(existing)+1)
+	for id, c := range existing {
+		overrides[id] = c
+	}
+	merged := make(map[string]interface{}, len(existing[agentID])+len(config))
+	for k, v := range existing[agentID] {
+		merged[k] = v
+	}
+	for k, v := range config {
+		merged[k] = v
+	}
+	overrides[agentID] = merged
+	return WithAgentConfig(ctx, overrides)
+}
+
+// AgentConfigFromContext returns the configuration overrides for the agent
+func AgentConfigFromContext(ctx context.Context, agentID string) map[string]interface{} {
+	overrides, _ := ctx.Value(agentConfigKey{}).(map[string]map[string]interface{})
+	return overrides[agentID]
+}
+
+// variantFor returns the variant a run should use
+func (e *Experiment[T]) variantFor(ctx context.Context) *Variant[T] {
+	if name := VariantFromContext(ctx); name != "" {
+		return e.variantNamed(name)
+	}
+	return e.Variant(ThreadIDFromContext(ctx))
+}
+
+// taggedWriter adds the experiment and variant to every event
+type taggedWriter struct {
+	streamWriter
+	experiment string
+	variant    string
+}
+
+func (w *taggedWriter) EmitEvent(evt Event) {
+	metadata := make(map[string]interface{}, len(evt.Metadata)+2)
+	for k, v := range evt.Metadata {
+		metadata[k] = v
+	}
+	metadata["experiment"] = w.experiment
+	metadata["variant"] = w.variant
+	evt.Metadata = metadata
+	w.streamWriter.EmitEvent(evt)
+}
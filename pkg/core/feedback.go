@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidFeedback is returned when recording feedback that is
+	// missing its run or node, or has neither a valid score nor a comment
+	ErrInvalidFeedback = errors.New("invalid feedback")
+)
+
+// Feedback scores
+const (
+	FeedbackDown    = -1
+	FeedbackNeutral = 0
+	FeedbackUp      = 1
+)
+
+// Feedback is a human's rating of the output of a node in a run
+type Feedback struct {
+	ID       string `json:"id"`
+	RunID    string `json:"run_id"`
+	ThreadID string `json:"thread_id,omitempty"`
+	Node     string `json:"node"`
+
+	// Seq is the sequence number of the stream frame being rated, for
+	// nodes that streamed several revisions of their output. Zero rates
+	// the node's final output.
+	Seq uint64 `json:"seq,omitempty"`
+
+	// Score is FeedbackUp, FeedbackDown or FeedbackNeutral for comments
+	// without a rating
+	Score   int    `json:"score"`
+	Comment string `json:"comment,omitempty"`
+
+	// Principal is the ID of the human who gave the feedback
+	Principal string `json:"principal,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks that the feedback names its run and node and carries a
+// rating or a comment
+func (f Feedback) Validate() error {
+	if f.RunID == "" {
+		return fmt.Errorf("%w: missing run ID", ErrInvalidFeedback)
+	}
+	if f.Node == "" {
+		return fmt.Errorf("%w: missing node", ErrInvalidFeedback)
+	}
+	if f.Score < FeedbackDown || f.Score > FeedbackUp {
+		return fmt.Errorf("%w: score %d is not -1, 0 or 1", ErrInvalidFeedback, f.Score)
+	}
+	if f.Score == FeedbackNeutral && f.Comment == "" {
+		return fmt.Errorf("%w: neither score nor comment", ErrInvalidFeedback)
+	}
+	return nil
+}
+
+// FeedbackFilter selects recorded feedback. Empty fields match everything.
+type FeedbackFilter struct {
+	RunID    string
+	ThreadID string
+	Node     string
+}
+
+// matches reports whether the filter selects f
+func (q FeedbackFilter) matches(f Feedback) bool {
+	return (q.RunID == "" || f.RunID == q.RunID) &&
+		(q.ThreadID == "" || f.ThreadID == q.ThreadID) &&
+		(q.Node == "" || f.Node == q.Node)
+}
+
+// FeedbackStore stores human feedback on node outputs
+type FeedbackStore interface {
+	// Record validates and stores feedback, assigning its ID and creation
+	// time when they are empty
+	Record(ctx context.Context, feedback Feedback) (Feedback, error)
+
+	// List returns the feedback the filter selects, oldest first
+	List(ctx context.Context, filter FeedbackFilter) ([]Feedback, error)
+}
+
+// PrepareFeedback validates feedback and fills in its ID and creation time,
+// for FeedbackStore implementations to call from Record
+func PrepareFeedback(feedback Feedback) (Feedback, error) {
+	if err := feedback.Validate(); err != nil {
+		return Feedback{}, err
+	}
+	if feedback.ID == "" {
+		feedback.ID = newID("fb_")
+	}
+	if feedback.CreatedAt.IsZero() {
+		feedback.CreatedAt = time.Now()
+	}
+	return feedback, nil
+}
+
+// MemoryFeedbackStore is an in-memory FeedbackStore
+type MemoryFeedbackStore struct {
+	mu       sync.RWMutex
+	feedback []Feedback
+}
+
+// NewMemoryFeedbackStore creates an empty in-memory feedback store
+func NewMemoryFeedbackStore() *MemoryFeedbackStore {
+	return &MemoryFeedbackStore{}
+}
+
+// Record validates and stores feedback
+func (s *MemoryFeedbackStore) Record(ctx context.Context, feedback Feedback) (Feedback, error) {
+	feedback, err := PrepareFeedback(feedback)
+	if err != nil {
+		return Feedback{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feedback = append(s.feedback, feedback)
+	return feedback, nil
+}
+
+// List returns the feedback the filter selects, oldest first
+func (s *MemoryFeedbackStore) List(ctx context.Context, filter FeedbackFilter) ([]Feedback, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Feedback, 0)
+	for _, f := range s.feedback {
+		if filter.matches(f) {
+			out = append(out, f)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
@@ -0,0 +1,155 @@
+package feedbacksql_test
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// cliDriver is a database/sql driver running statements with the sqlite3
+// command line shell, so the store is tested against a real SQLite engine
+// without a Go driver among the module's dependencies. The data source name
+// is the database file.
+type cliDriver struct{}
+
+func init() {
+	sql.Register("sqlite3-cli", cliDriver{})
+}
+
+func (cliDriver) Open(name string) (driver.Conn, error) {
+	return &cliConn{path: name}, nil
+}
+
+type cliConn struct {
+	path string
+}
+
+func (c *cliConn) Prepare(query string) (driver.Stmt, error) {
+	return &cliStmt{conn: c, query: query}, nil
+}
+
+func (c *cliConn) Close() error {
+	return nil
+}
+
+func (c *cliConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("sqlite3-cli: transactions not supported")
+}
+
+// run executes the query with its arguments bound as SQL literals and
+// returns the CSV output with a header row
+func (c *cliConn) run(query string, args []driver.Value) ([]byte, error) {
+	var bound strings.Builder
+	for _, r := range query {
+		if r != '?' {
+			bound.WriteRune(r)
+			continue
+		}
+		if len(args) == 0 {
+			return nil, errors.New("sqlite3-cli: too few arguments")
+		}
+		literal, err := sqlLiteral(args[0])
+		if err != nil {
+			return nil, err
+		}
+		bound.WriteString(literal)
+		args = args[1:]
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("sqlite3", "-batch", "-bail", "-csv", "-header", c.path)
+	cmd.Stdin = strings.NewReader(bound.String())
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3-cli: %v: %s", err, stderr.String())
+	}
+	return out, nil
+}
+
+// sqlLiteral formats an argument as a SQL literal
+func sqlLiteral(v driver.Value) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	default:
+		return "", fmt.Errorf("sqlite3-cli: unsupported argument type %T", v)
+	}
+}
+
+type cliStmt struct {
+	conn  *cliConn
+	query string
+}
+
+func (s *cliStmt) Close() error {
+	return nil
+}
+
+func (s *cliStmt) NumInput() int {
+	return -1
+}
+
+func (s *cliStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if _, err := s.conn.run(s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (s *cliStmt) Query(args []driver.Value) (driver.Rows, error) {
+	out, err := s.conn.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3-cli: %w", err)
+	}
+	rows := &cliRows{}
+	if len(records) > 0 {
+		rows.columns, rows.records = records[0], records[1:]
+	}
+	return rows, nil
+}
+
+type cliRows struct {
+	columns []string
+	records [][]string
+}
+
+func (r *cliRows) Columns() []string {
+	return r.columns
+}
+
+func (r *cliRows) Close() error {
+	return nil
+}
+
+func (r *cliRows) Next(dest []driver.Value) error {
+	if len(r.records) == 0 {
+		return io.EOF
+	}
+	for i, field := range r.records[0] {
+		dest[i] = field
+	}
+	r.records = r.records[1:]
+	return nil
+}
+
+// sqliteInstalled reports whether the sqlite3 shell is available
+func sqliteInstalled() bool {
+	_, err := exec.LookPath("sqlite3")
+	return err == nil
+}
@@ -0,0 +1,105 @@
+// Package feedbacksql keeps human feedback in a SQLite table, so that core
+// stays free of database/sql and driver concerns
+package feedbacksql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// Store is a core.FeedbackStore keeping feedback in a SQLite table. It
+// works on a *sql.DB opened by the caller, who imports the SQLite driver of
+// their choice, such as modernc.org/sqlite or github.com/mattn/go-sqlite3.
+type Store struct {
+	db *sql.DB
+}
+
+// schema creates the feedback table and its lookup indexes
+const schema = `
+CREATE TABLE IF NOT EXISTS feedback (
+	id         TEXT PRIMARY KEY,
+	run_id     TEXT NOT NULL,
+	thread_id  TEXT NOT NULL DEFAULT '',
+	node       TEXT NOT NULL,
+	seq        INTEGER NOT NULL DEFAULT 0,
+	score      INTEGER NOT NULL,
+	comment    TEXT NOT NULL DEFAULT '',
+	principal  TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS feedback_run ON feedback (run_id);
+CREATE INDEX IF NOT EXISTS feedback_thread ON feedback (thread_id);
+`
+
+// NewStore creates the feedback table in db unless it exists
+func NewStore(ctx context.Context, db *sql.DB) (*Store, error) {
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("failed to create feedback table: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Record validates and stores feedback
+func (s *Store) Record(ctx context.Context, feedback core.Feedback) (core.Feedback, error) {
+	feedback, err := core.PrepareFeedback(feedback)
+	if err != nil {
+		return core.Feedback{}, err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO feedback (id, run_id, thread_id, node, seq, score, comment, principal, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		feedback.ID, feedback.RunID, feedback.ThreadID, feedback.Node, int64(feedback.Seq),
+		feedback.Score, feedback.Comment, feedback.Principal, feedback.CreatedAt.UnixNano())
+	if err != nil {
+		return core.Feedback{}, fmt.Errorf("failed to record feedback: %w", err)
+	}
+	return feedback, nil
+}
+
+// List returns the feedback the filter selects, oldest first
+func (s *Store) List(ctx context.Context, filter core.FeedbackFilter) ([]core.Feedback, error) {
+	var where []string
+	var args []interface{}
+	for _, cond := range []struct{ column, value string }{
+		{"run_id", filter.RunID},
+		{"thread_id", filter.ThreadID},
+		{"node", filter.Node},
+	} {
+		if cond.value != "" {
+			where = append(where, cond.column+" = ?")
+			args = append(args, cond.value)
+		}
+	}
+	query := `SELECT id, run_id, thread_id, node, seq, score, comment, principal, created_at FROM feedback`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feedback: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]core.Feedback, 0)
+	for rows.Next() {
+		var f core.Feedback
+		var seq, created int64
+		if err := rows.Scan(&f.ID, &f.RunID, &f.ThreadID, &f.Node, &seq, &f.Score, &f.Comment, &f.Principal, &created); err != nil {
+			return nil, fmt.Errorf("failed to read feedback: %w", err)
+		}
+		f.Seq = uint64(seq)
+		f.CreatedAt = time.Unix(0, created)
+		out = append(out, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list feedback: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,106 @@
+package feedbacksql_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/core/feedbacksql"
+)
+
+// newStore creates a store in a fresh database, skipping the test when
+// there is no SQLite engine
+func newStore(t *testing.T) (*feedbacksql.Store, *sql.DB) {
+	t.Helper()
+	if !sqliteInstalled() {
+		t.Skip("sqlite3 not installed")
+	}
+	db, err := sql.Open("sqlite3-cli", filepath.Join(t.TempDir(), "feedback.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := feedbacksql.NewStore(context.Background(), db)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	return store, db
+}
+
+func TestStoreRecordAndList(t *testing.T) {
+	store, db := newStore(t)
+	ctx := context.Background()
+	start := time.Now()
+
+	entries := []core.Feedback{
+		{RunID: "run-1", ThreadID: "t1", Node: "draft", Score: core.FeedbackUp, Principal: "ada"},
+		{RunID: "run-1", ThreadID: "t1", Node: "review", Seq: 3, Score: core.FeedbackDown, Comment: "it's wrong,\nsee line 2"},
+		{RunID: "run-2", Node: "draft", Comment: "no rating"},
+	}
+	var recorded []core.Feedback
+	for i, f := range entries {
+		f.CreatedAt = start.Add(time.Duration(len(entries)-i) * time.Second)
+		got, err := store.Record(ctx, f)
+		if err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+		if got.ID == "" {
+			t.Errorf("recorded feedback %d has no ID", i)
+		}
+		recorded = append(recorded, got)
+	}
+
+	all, err := store.List(ctx, core.FeedbackFilter{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(all) != 3 || all[0].ID != recorded[2].ID || all[2].ID != recorded[0].ID {
+		t.Fatalf("List = %+v, want all feedback oldest first", all)
+	}
+	if got := all[1]; got.Seq != 3 || got.Comment != entries[1].Comment || !got.CreatedAt.Equal(recorded[1].CreatedAt) {
+		t.Errorf("feedback read back as %+v, want %+v", got, recorded[1])
+	}
+
+	for _, tt := range []struct {
+		filter core.FeedbackFilter
+		want   int
+	}{
+		{core.FeedbackFilter{RunID: "run-1"}, 2},
+		{core.FeedbackFilter{ThreadID: "t1", Node: "draft"}, 1},
+		{core.FeedbackFilter{Node: "draft"}, 2},
+		{core.FeedbackFilter{RunID: "run-3"}, 0},
+	} {
+		got, err := store.List(ctx, tt.filter)
+		if err != nil {
+			t.Fatalf("List(%+v): %v", tt.filter, err)
+		}
+		if len(got) != tt.want {
+			t.Errorf("List(%+v) = %d entries, want %d", tt.filter, len(got), tt.want)
+		}
+	}
+
+	// Reopening the table keeps what was recorded
+	reopened, err := feedbacksql.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("NewStore on an existing table: %v", err)
+	}
+	if got, _ := reopened.List(ctx, core.FeedbackFilter{}); len(got) != 3 {
+		t.Errorf("reopened store lists %d entries, want 3", len(got))
+	}
+}
+
+func TestStoreRejectsInvalidFeedback(t *testing.T) {
+	store, _ := newStore(t)
+	ctx := context.Background()
+
+	if _, err := store.Record(ctx, core.Feedback{RunID: "run-1", Node: "draft"}); !errors.Is(err, core.ErrInvalidFeedback) {
+		t.Fatalf("Record without score or comment = %v, want ErrInvalidFeedback", err)
+	}
+	if got, _ := store.List(ctx, core.FeedbackFilter{}); len(got) != 0 {
+		t.Errorf("invalid feedback was stored: %+v", got)
+	}
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+var (
+	// ErrNoCandidates is returned by Fork when it is given no candidates
+	ErrNoCandidates = errors.New("no candidates to fork")
+
+	// ErrAllBranchesFailed is returned by Fork when every branch failed
+	ErrAllBranchesFailed = errors.New("all fork branches failed")
+)
+
+// ForkConfig configures Fork
+type ForkConfig struct {
+	// Concurrency bounds how many branches run at once. Zero or less runs
+	// all branches at once.
+	Concurrency int
+}
+
+// ForkOption configures Fork
+type ForkOption func(*ForkConfig)
+
+// WithForkConcurrency bounds how many branches run at once
+func WithForkConcurrency(n int) ForkOption {
+	return func(c *ForkConfig) {
+		c.Concurrency = n
+	}
+}
+
+// Fork runs the same work from several candidate states in parallel and
+// returns the result with the highest score, for tree-of-thought style
+// search inside a node. run is typically a compiled subgraph's Invoke.
+//
+// A failed branch is left out of the choice; Fork only fails when every
+// branch did, with ErrAllBranchesFailed and the errors of the branches.
+// Ties go to the earliest candidate and NaN scores never win. Candidates
+// that share maps or slices must not be modified by run, since branches
+// run concurrently.
+//
+// A branch that produced a good enough answer can call CancelSiblings with
+// its context to cancel the branches still running; their results are
+// discarded and the best of the completed branches is returned.
+func Fork[T any](ctx context.Context, candidates []T, run func(ctx context.Context, candidate T) (T, error), score func(T) float64, opts ...ForkOption) (T, error) {
+	var zero T
+	if len(candidates) == 0 {
+		return zero, ErrNoCandidates
+	}
+
+	var config ForkConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	workers := config.Concurrency
+	if workers <= 0 || workers > len(candidates) {
+		workers = len(candidates)
+	}
+
+	results := make([]T, len(candidates))
+	errs := make([]error, len(candidates))
+	indexes := make(chan int)
+
+	branches := newBranchGroup(ctx, len(candidates))
+	defer branches.release()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if branches.isDropped(i) {
+					continue
+				}
+				result, err := run(branches.context(i), candidates[i])
+				if !branches.finish(i) {
+					continue
+				}
+				if err != nil {
+					errs[i] = fmt.Errorf("fork branch %d: %w", i, err)
+					continue
+				}
+				results[i] = result
+			}
+		}()
+	}
+
+feed:
+	for i := range candidates {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	best := -1
+	bestScore := math.Inf(-1)
+	for i, result := range results {
+		if errs[i] != nil || branches.isDropped(i) {
+			continue
+		}
+		s := score(result)
+		if math.IsNaN(s) {
+			s = math.Inf(-1)
+		}
+		if best < 0 || s > bestScore {
+			best, bestScore = i, s
+		}
+	}
+	if best < 0 {
+		return zero, fmt.Errorf("%w: %w", ErrAllBranchesFailed, errors.Join(errs...))
+	}
+	return results[best], nil
+}
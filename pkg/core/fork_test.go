@@ -0,0 +1,94 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// plan is a candidate of a search, scored by its quality
+type plan struct {
+	Name    string
+	Quality float64
+}
+
+func quality(p plan) float64 {
+	return p.Quality
+}
+
+func TestForkReturnsHighestScoring(t *testing.T) {
+	var running, peak atomic.Int32
+	refine := func(ctx context.Context, p plan) (plan, error) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		p.Quality *= 2
+		return p, nil
+	}
+	candidates := []plan{{"a", 1}, {"b", 4}, {"c", 3}, {"d", math.NaN()}, {"e", 4}}
+
+	best, err := core.Fork(context.Background(), candidates, refine, quality, core.WithForkConcurrency(2))
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	if best.Name != "b" || best.Quality != 8 {
+		t.Errorf("best = %+v, want b refined, ahead of its tie e", best)
+	}
+	if peak.Load() > 2 {
+		t.Errorf("%d branches ran at once, want at most 2", peak.Load())
+	}
+}
+
+func TestForkLeavesOutFailedBranches(t *testing.T) {
+	boom := errors.New("dead end")
+	run := func(ctx context.Context, p plan) (plan, error) {
+		if p.Name != "c" {
+			return p, boom
+		}
+		return p, nil
+	}
+
+	best, err := core.Fork(context.Background(), []plan{{"a", 9}, {"b", 8}, {"c", 1}}, run, quality)
+	if err != nil || best.Name != "c" {
+		t.Errorf("Fork = %+v, %v, want the only branch that succeeded", best, err)
+	}
+
+	_, err = core.Fork(context.Background(), []plan{{"a", 9}, {"b", 8}}, run, quality)
+	if !errors.Is(err, core.ErrAllBranchesFailed) || !errors.Is(err, boom) || !strings.Contains(err.Error(), "branch 1") {
+		t.Errorf("all branches failing = %v, want ErrAllBranchesFailed with each branch's error", err)
+	}
+	if _, err := core.Fork(context.Background(), nil, run, quality); !errors.Is(err, core.ErrNoCandidates) {
+		t.Errorf("no candidates = %v, want ErrNoCandidates", err)
+	}
+}
+
+func TestForkStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var started atomic.Int32
+	run := func(ctx context.Context, p plan) (plan, error) {
+		started.Add(1)
+		<-ctx.Done()
+		return p, ctx.Err()
+	}
+
+	_, err := core.Fork(ctx, []plan{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}}, run, quality, core.WithForkConcurrency(1))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Fork = %v, want the context's error", err)
+	}
+	if n := started.Load(); n != 1 {
+		t.Errorf("%d branches started, want only the one running when the fork was cancelled", n)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // END is a special constant used to represent the end node in the graph.
@@ -21,6 +22,9 @@ var (
 
 	// ErrNoOutgoingEdge is returned when no outgoing edge is found for a node.
 	ErrNoOutgoingEdge = errors.New("no outgoing edge found for node")
+
+	// ErrStaticCycle is returned when static edges form a cycle that can never reach END.
+	ErrStaticCycle = errors.New("static edge cycle never reaches END")
 )
 
 // Node represents a node in the message graph.
@@ -89,17 +93,59 @@ type Runnable struct {
 }
 
 // Compile compiles the message graph and returns a Runnable instance.
-// It returns an error if the entry point is not set.
+// It returns an error if the entry point is not set or if the static edges
+// contain a cycle that can never terminate.
 func (g *MessageGraph) Compile() (*Runnable, error) {
 	if g.entryPoint == "" {
 		return nil, ErrEntryPointNotSet
 	}
 
+	if cycle := g.findStaticCycle(); cycle != nil {
+		return nil, fmt.Errorf("%w: %s", ErrStaticCycle, strings.Join(cycle, " -> "))
+	}
+
 	return &Runnable{
 		graph: g,
 	}, nil
 }
 
+// findStaticCycle returns the nodes of a cycle formed by static edges, or nil
+// if there is none. Execution always follows a node's first outgoing edge,
+// so once a run enters such a cycle it has no way out.
+func (g *MessageGraph) findStaticCycle() []string {
+	next := make(map[string]string)
+	for _, edge := range g.edges {
+		if _, ok := next[edge.From]; !ok {
+			next[edge.From] = edge.To
+		}
+	}
+
+	// Visit nodes in edge order so the reported cycle is deterministic
+	checked := make(map[string]bool)
+	for _, edge := range g.edges {
+		path := make([]string, 0)
+		onPath := make(map[string]int)
+		current := edge.From
+		for current != END && !checked[current] {
+			if i, ok := onPath[current]; ok {
+				return append(path[i:], current)
+			}
+			onPath[current] = len(path)
+			path = append(path, current)
+
+			to, ok := next[current]
+			if !ok {
+				break
+			}
+			current = to
+		}
+		for _, node := range path {
+			checked[node] = true
+		}
+	}
+	return nil
+}
+
 // Invoke executes the compiled message graph with the given input messages.
 // It returns the resulting messages and an error if any occurs during the execution.
 func (r *Runnable) Invoke(ctx context.Context, messages []Message) ([]Message, error) {
@@ -0,0 +1,46 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func passMessages(ctx context.Context, msgs []core.Message) ([]core.Message, error) {
+	return msgs, nil
+}
+
+func TestCompileRejectsStaticCycle(t *testing.T) {
+	g := core.NewMessageGraph()
+	g.AddNode("a", passMessages)
+	g.AddNode("b", passMessages)
+	g.AddEdge("a", "b")
+	g.AddEdge("b", "a")
+	g.SetEntryPoint("a")
+
+	_, err := g.Compile()
+	if !errors.Is(err, core.ErrStaticCycle) {
+		t.Fatalf("Compile = %v, want ErrStaticCycle", err)
+	}
+	if !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Errorf("error %q doesn't name the cycle", err)
+	}
+}
+
+func TestCompileAcceptsChainToEnd(t *testing.T) {
+	g := core.NewMessageGraph()
+	g.AddNode("a", passMessages)
+	g.AddNode("b", passMessages)
+	g.AddEdge("a", "b")
+	g.AddEdge("b", core.END)
+	// Later edges from a node are never taken, so this is no cycle
+	g.AddEdge("b", "a")
+	g.SetEntryPoint("a")
+
+	if _, err := g.Compile(); err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GraphsEqual compares the topology of two graphs, for regression tests on
+// graph building code. It compares the entry point, the node set, the edges
+// leaving each node with their mappings, breakpoints and limits, and returns
+// a readable description of every difference, with a being the first graph.
+// Node functions and routers can't be compared by value, so only the
+// presence of routers and the mapping of their outputs are compared.
+func GraphsEqual[T any](a, b *StateGraph[T]) (bool, []string) {
+	var diffs []string
+	add := func(format string, args ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+
+	if a.entryPoint != b.entryPoint {
+		add("entry point is %q in a, %q in b", a.entryPoint, b.entryPoint)
+	}
+
+	for _, name := range unionKeys(a.nodes, b.nodes) {
+		_, inA := a.nodes[name]
+		_, inB := b.nodes[name]
+		switch {
+		case !inA:
+			add("node %q is only in b", name)
+		case !inB:
+			add("node %q is only in a", name)
+		}
+	}
+
+	edgesA, edgesB := edgesByNode(a.edges), edgesByNode(b.edges)
+	for _, from := range unionKeys(edgesA, edgesB) {
+		ea, eb := edgesA[from], edgesB[from]
+		if len(ea) != len(eb) {
+			add("node %q has %d outgoing edges in a, %d in b", from, len(ea), len(eb))
+			continue
+		}
+		for i := range ea {
+			diffEdge(from, i, len(ea) > 1, ea[i], eb[i], add)
+		}
+	}
+
+	breakpointsA, breakpointsB := setOf(a.interruptManager.Breakpoints()), setOf(b.interruptManager.Breakpoints())
+	for _, name := range unionKeys(breakpointsA, breakpointsB) {
+		switch inA, inB := breakpointsA[name], breakpointsB[name]; {
+		case !inA:
+			add("breakpoint on %q is only in b", name)
+		case !inB:
+			add("breakpoint on %q is only in a", name)
+		}
+	}
+
+	if a.recursionLimit != b.recursionLimit {
+		add("recursion limit is %d in a, %d in b", a.recursionLimit, b.recursionLimit)
+	}
+	if a.limits.MaxStateBytes != b.limits.MaxStateBytes {
+		add("max state bytes is %d in a, %d in b", a.limits.MaxStateBytes, b.limits.MaxStateBytes)
+	}
+	if a.limits.MaxMessages != b.limits.MaxMessages {
+		add("max messages is %d in a, %d in b", a.limits.MaxMessages, b.limits.MaxMessages)
+	}
+
+	return len(diffs) == 0, diffs
+}
+
+// diffEdge compares the i-th edges leaving a node
+func diffEdge[T any](from string, i int, numbered bool, a, b ConditionalEdge[T], add func(string, ...interface{})) {
+	edge := fmt.Sprintf("edge from %q", from)
+	if numbered {
+		edge = fmt.Sprintf("edge %d from %q", i+1, from)
+	}
+
+	if kindA, kindB := routerKind(a), routerKind(b); kindA != kindB {
+		add("%s has %s in a, %s in b", edge, kindA, kindB)
+	}
+	switch {
+	case a.Speculative != nil && b.Speculative == nil:
+		add("%s is speculative only in a", edge)
+	case a.Speculative == nil && b.Speculative != nil:
+		add("%s is speculative only in b", edge)
+	}
+
+	for _, key := range unionKeys(a.Mapping, b.Mapping) {
+		toA, inA := a.Mapping[key]
+		toB, inB := b.Mapping[key]
+		switch {
+		case !inA:
+			add("%s maps %q to %q only in b", edge, key, toB)
+		case !inB:
+			add("%s maps %q to %q only in a", edge, key, toA)
+		case toA != toB:
+			add("%s maps %q to %q in a, %q in b", edge, key, toA, toB)
+		}
+	}
+}
+
+// routerKind describes the router of an edge
+func routerKind[T any](edge ConditionalEdge[T]) string {
+	switch {
+	case edge.RouterCtx != nil:
+		return "a context router"
+	case edge.Router != nil:
+		return "a router"
+	default:
+		return "no router"
+	}
+}
+
+// edgesByNode groups edges by the node they leave, in the order they were added
+func edgesByNode[T any](edges []ConditionalEdge[T]) map[string][]ConditionalEdge[T] {
+	byNode := make(map[string][]ConditionalEdge[T])
+	for _, edge := range edges {
+		byNode[edge.From] = append(byNode[edge.From], edge)
+	}
+	return byNode
+}
+
+// setOf returns the names as a set
+func setOf(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// unionKeys returns the sorted keys of both maps
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,85 @@
+package core_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// reviewFlow builds the same draft and review graph every time
+func reviewFlow() *core.StateGraph[int] {
+	g := newGraph[int]()
+	noop := func(ctx context.Context, n int) (int, error) { return n, nil }
+	g.AddNode("draft", noop)
+	g.AddNode("review", noop)
+	g.SetEntryPoint("draft")
+	g.AddConditionalEdges("draft", to[int]("review"), nil)
+	g.AddConditionalEdges("review", func(int) ([]string, error) { return []string{"ok"}, nil },
+		map[string]string{"ok": core.END, "redo": "draft"})
+	return g
+}
+
+func TestGraphsEqual(t *testing.T) {
+	if equal, diffs := core.GraphsEqual(reviewFlow(), reviewFlow()); !equal {
+		t.Errorf("identical builds differ: %v", diffs)
+	}
+
+	b := reviewFlow()
+	b.AddNode("publish", func(ctx context.Context, n int) (int, error) { return n, nil })
+	b.AddConditionalEdges("publish", to[int](core.END), nil)
+	b.SetRecursionLimit(7)
+	equal, diffs := core.GraphsEqual(reviewFlow(), b)
+	if equal {
+		t.Fatal("graphs with an extra edge compare equal")
+	}
+	for _, want := range []string{
+		`node "publish" is only in b`,
+		`node "publish" has 0 outgoing edges in a, 1 in b`,
+		"recursion limit is",
+	} {
+		if !containsLine(diffs, want) {
+			t.Errorf("diffs %q lack %q", diffs, want)
+		}
+	}
+
+	c := reviewFlow()
+	c.AddConditionalEdges("draft", to[int]("review"), map[string]string{"review": "review"})
+	_, diffs = core.GraphsEqual(reviewFlow(), c)
+	if !containsLine(diffs, `node "draft" has 1 outgoing edges in a, 2 in b`) {
+		t.Errorf("diffs = %q, want the added edge of draft", diffs)
+	}
+}
+
+func TestGraphsEqualComparesMappings(t *testing.T) {
+	b := newGraph[int]()
+	noop := func(ctx context.Context, n int) (int, error) { return n, nil }
+	b.AddNode("draft", noop)
+	b.AddNode("review", noop)
+	b.SetEntryPoint("draft")
+	b.AddConditionalEdges("draft", to[int]("review"), nil)
+	b.AddConditionalEdges("review", func(int) ([]string, error) { return []string{"ok"}, nil },
+		map[string]string{"ok": "draft", "escalate": core.END})
+
+	_, diffs := core.GraphsEqual(reviewFlow(), b)
+	for _, want := range []string{
+		`edge from "review" maps "ok" to "END" in a, "draft" in b`,
+		`edge from "review" maps "redo" to "draft" only in a`,
+		`edge from "review" maps "escalate" to "END" only in b`,
+	} {
+		if !containsLine(diffs, want) {
+			t.Errorf("diffs %q lack %q", diffs, want)
+		}
+	}
+}
+
+// containsLine reports whether a line of the diff starts with prefix
+func containsLine(diffs []string, prefix string) bool {
+	for _, d := range diffs {
+		if strings.HasPrefix(d, prefix) {
+			return true
+		}
+	}
+	return false
+}
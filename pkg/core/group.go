@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"strings"
+)
+
+// GroupSeparator separates a group name from the names of its nodes
+const GroupSeparator = "."
+
+// Group adds the nodes and edges defined by build under a namespace, so a
+// node "fetch" added in group "ingest" is named "ingest.fetch". Within the
+// group, routers and edge mappings may name sibling nodes without the prefix,
+// while names that aren't in the group, such as nodes of other groups or END,
+// are used as they are. Groups can be nested.
+func (g *StateGraph[T]) Group(name string, build func(sub *StateGraph[T])) {
+	sub := NewStateGraph[T]()
+	build(sub)
+
+	prefix := name + GroupSeparator
+	for nodeName, node := range sub.nodes {
+		node.Name = prefix + nodeName
+		g.nodes[node.Name] = node
+	}
+
+	for nodeName, policy := range sub.retryPolicies {
+		g.SetRetryPolicy(prefix+nodeName, policy)
+	}
+	for nodeName, timeout := range sub.nodeTimeouts {
+		g.SetNodeTimeout(prefix+nodeName, timeout)
+	}
+	for nodeName, adaptive := range sub.adaptiveTimeouts {
+		g.SetAdaptiveTimeout(prefix+nodeName, adaptive.multiplier)
+	}
+	for nodeName, init := range sub.inits {
+		if g.inits == nil {
+			g.inits = make(map[string]*nodeInit)
+		}
+		g.inits[prefix+nodeName] = init
+	}
+	for nodeName, opts := range sub.nodeOptions {
+		g.SetNodeOptions(prefix+nodeName, opts)
+	}
+
+	for _, edge := range sub.edges {
+		mapping := edge.Mapping
+		g.edges = append(g.edges, ConditionalEdge[T]{
+			From: prefix + edge.From,
+			RouterCtx: func(ctx context.Context, state T, meta RouterMeta) ([]string, error) {
+				nextNodes, err := edge.call(ctx, state, meta)
+				if err != nil {
+					return nil, err
+				}
+				resolved := make([]string, len(nextNodes))
+				for i, next := range nextNodes {
+					if mapped, ok := mapping[next]; ok {
+						next = mapped
+					}
+					resolved[i] = resolveGroupNode(sub, prefix, next)
+				}
+				return resolved, nil
+			},
+			Speculative: edge.Speculative,
+		})
+	}
+}
+
+// resolveGroupNode returns the full name of a node named by a router in a group
+func resolveGroupNode[T any](sub *StateGraph[T], prefix, name string) string {
+	if _, ok := sub.nodes[name]; ok {
+		return prefix + name
+	}
+	return name
+}
+
+// nodeGroup returns the group a node belongs to, or an empty string
+func nodeGroup(name string) string {
+	if i := strings.LastIndex(name, GroupSeparator); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package core_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func visit(name string) func(ctx context.Context, s []string) ([]string, error) {
+	return func(ctx context.Context, s []string) ([]string, error) {
+		return append(s, name), nil
+	}
+}
+
+func TestGroupedNodesAreNamespacedAndReachable(t *testing.T) {
+	g := debugGraph[[]string]()
+	g.Group("ingest", func(sub *core.StateGraph[[]string]) {
+		sub.AddNode("fetch", visit("fetch"))
+		sub.AddNode("parse", visit("parse"))
+		// Siblings are named without the prefix, other nodes as they are
+		sub.AddConditionalEdges("fetch", to[[]string]("parse"), nil)
+		sub.AddConditionalEdges("parse", to[[]string]("report"), nil)
+	})
+	g.AddNode("report", visit("report"))
+	g.AddConditionalEdges("report", to[[]string](core.END), nil)
+	g.SetEntryPoint("ingest.fetch")
+	r := compile(t, g)
+
+	events, out := runEvents(t, r, nil)
+	if got := strings.Join(out, ","); got != "fetch,parse,report" {
+		t.Errorf("visited %s, want fetch,parse,report", got)
+	}
+	var started []string
+	for _, evt := range events {
+		if evt.Type == core.EventChainStart && evt.Name != "LangGraph" {
+			started = append(started, evt.Name)
+		}
+	}
+	if got := strings.Join(started, ","); !strings.Contains(got, "ingest.fetch,ingest.parse,report") {
+		t.Errorf("node start events %s, want the grouped nodes namespaced", got)
+	}
+
+	names := make(map[string]bool)
+	for _, node := range g.Structure().Nodes {
+		names[node] = true
+	}
+	if !names["ingest.fetch"] || !names["ingest.parse"] || names["fetch"] {
+		t.Errorf("graph nodes %v, want the grouped nodes namespaced", names)
+	}
+}
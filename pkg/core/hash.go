@@ -0,0 +1,51 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// CanonicalHash returns a stable hex-encoded SHA-256 hash of v, for cache and
+// idempotency keys. The hash covers v's JSON encoding: exported fields under
+// their JSON names, with json tags honoured, while unexported fields and
+// fields tagged "-" are left out. Object keys are sorted at every level, so
+// map insertion order, struct field order and the key order of embedded raw
+// JSON don't change the hash. Numbers are hashed as they are encoded, so 1
+// and 1.5 differ but an int 1 and a float64 1 don't. Values JSON can't encode,
+// such as channels and functions, return an error.
+func CanonicalHash(v interface{}) (string, error) {
+	data, err := canonicalJSON(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalJSON encodes v as JSON with sorted object keys
+func canonicalJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode value for hashing: %w", err)
+	}
+
+	// Decoding into generic values turns every object into a map, which
+	// encodes with sorted keys, and keeps numbers as written
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, fmt.Errorf("failed to decode value for hashing: %w", err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(generic); err != nil {
+		return nil, fmt.Errorf("failed to encode value for hashing: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,67 @@
+package core_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// hash returns the canonical hash of v, failing the test when it can't
+func hash(t *testing.T, v interface{}) string {
+	t.Helper()
+	h, err := core.CanonicalHash(v)
+	if err != nil {
+		t.Fatalf("CanonicalHash(%v): %v", v, err)
+	}
+	return h
+}
+
+func TestCanonicalHashIgnoresInsertionOrder(t *testing.T) {
+	a := map[string]interface{}{}
+	a["city"] = "Oslo"
+	a["units"] = "metric"
+	a["days"] = []int{1, 2}
+	a["filters"] = map[string]interface{}{"rain": true, "wind": false}
+
+	b := map[string]interface{}{}
+	b["filters"] = map[string]interface{}{"wind": false, "rain": true}
+	b["days"] = []int{1, 2}
+	b["units"] = "metric"
+	b["city"] = "Oslo"
+
+	if hash(t, a) != hash(t, b) {
+		t.Error("equal maps built in different orders hash differently")
+	}
+	b["days"] = []int{2, 1}
+	if hash(t, a) == hash(t, b) {
+		t.Error("maps with differently ordered lists hash the same")
+	}
+
+	raw := struct {
+		Args json.RawMessage `json:"args"`
+	}{json.RawMessage(`{"b":1,"a":2}`)}
+	reordered := raw
+	reordered.Args = json.RawMessage(`{"a":2, "b":1}`)
+	if hash(t, raw) != hash(t, reordered) {
+		t.Error("embedded raw JSON with reordered keys hashes differently")
+	}
+}
+
+func TestCanonicalHashLeavesOutUnexportedFields(t *testing.T) {
+	type query struct {
+		Text    string `json:"text"`
+		Debug   bool   `json:"-"`
+		attempt int
+	}
+	if hash(t, query{Text: "go", Debug: true, attempt: 1}) != hash(t, query{Text: "go", attempt: 2}) {
+		t.Error("unexported and ignored fields change the hash")
+	}
+	if hash(t, query{Text: "go"}) == hash(t, query{Text: "rust"}) {
+		t.Error("different exported fields hash the same")
+	}
+	if _, err := core.CanonicalHash(math.Inf(1)); err == nil {
+		t.Error("a value JSON can't encode was hashed")
+	}
+}
@@ -0,0 +1,77 @@
+package core_test
+
+import (
+	"context"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// newGraph creates a graph that doesn't stream, so runs don't block on
+// channels nobody reads
+func newGraph[T any]() *core.StateGraph[T] {
+	g := core.NewStateGraph[T]()
+	g.SetStreamConfig(core.StreamConfig{})
+	return g
+}
+
+// to routes to next unconditionally
+func to[T any](next string) core.Router[T] {
+	return func(T) ([]string, error) {
+		return []string{next}, nil
+	}
+}
+
+// chain wires the nodes to run one after another, starting with the first
+// and ending the run after the last
+func chain[T any](g *core.StateGraph[T], nodes ...string) {
+	g.SetEntryPoint(nodes[0])
+	for i, node := range nodes {
+		next := core.END
+		if i+1 < len(nodes) {
+			next = nodes[i+1]
+		}
+		g.AddConditionalEdges(node, to[T](next), nil)
+	}
+}
+
+// compile compiles the graph, failing the test when it doesn't
+func compile[T any](t testingT, g *core.StateGraph[T]) *core.RunnableState[T] {
+	t.Helper()
+	r, err := g.Compile()
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return r
+}
+
+// testingT is the part of testing.TB the helpers use
+type testingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// debugGraph creates a graph streaming only debug events, with room for
+// all events of a short run
+func debugGraph[T any]() *core.StateGraph[T] {
+	g := core.NewStateGraph[T]()
+	g.SetStreamConfig(core.StreamConfig{Modes: []core.StreamMode{core.StreamDebug}, BufferSize: 256})
+	return g
+}
+
+// runEvents runs the graph with InvokeStreaming and returns the graph
+// events it streamed
+func runEvents[T any](t testingT, r *core.RunnableState[T], input T) ([]core.Event, T) {
+	t.Helper()
+	stream, wait := r.InvokeStreaming(context.Background(), input)
+	var events []core.Event
+	for evt := range stream {
+		if graphEvent, ok := evt.Data.(core.Event); ok {
+			events = append(events, graphEvent)
+		}
+	}
+	out, err := wait()
+	if err != nil {
+		t.Fatalf("InvokeStreaming: %v", err)
+	}
+	return events, out
+}
@@ -0,0 +1,277 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	// ErrPromptNotFound is returned when no locale in the fallback chain has
+	// the requested prompt
+	ErrPromptNotFound = errors.New("prompt not found")
+)
+
+// EventMissingTranslation is emitted when a prompt is served in another
+// language than the one requested
+const EventMissingTranslation EventType = "on_missing_translation"
+
+// DefaultLocale ends every locale fallback chain unless the catalog sets
+// another
+const DefaultLocale = "en"
+
+// promptExt is the extension of prompt template files
+const promptExt = ".tmpl"
+
+type localeKey struct{}
+
+// WithLocale returns a context carrying the locale of a run, such as de-AT.
+// InvokeConfig.Locale sets it for a whole run.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, NormalizeLocale(locale))
+}
+
+// LocaleFromContext returns the locale of the run, or an empty string
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey{}).(string)
+	return locale
+}
+
+// NormalizeLocale writes a locale as language-REGION, so de_at becomes de-AT
+func NormalizeLocale(locale string) string {
+	parts := strings.FieldsFunc(locale, func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 {
+		return ""
+	}
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// LocaleChain returns the locales tried for a locale, most specific first
+// and ending with fallback: de-AT gives de-AT, de, en
+func LocaleChain(locale, fallback string) []string {
+	var chain []string
+	parts := strings.Split(NormalizeLocale(locale), "-")
+	for i := len(parts); i > 0; i-- {
+		if l := strings.Join(parts[:i], "-"); l != "" {
+			chain = append(chain, l)
+		}
+	}
+	if fallback = NormalizeLocale(fallback); fallback != "" && (len(chain) == 0 || chain[len(chain)-1] != fallback) {
+		chain = append(chain, fallback)
+	}
+	return chain
+}
+
+// localeLanguage returns the language of a locale, de for de-AT
+func localeLanguage(locale string) string {
+	language, _, _ := strings.Cut(NormalizeLocale(locale), "-")
+	return language
+}
+
+// PromptCatalog holds prompt templates per locale. Templates are files
+// named <locale>/<name>.tmpl in a file system, such as an embed.FS or a
+// directory, and use text/template syntax.
+type PromptCatalog struct {
+	fsys     fs.FS
+	fallback string
+
+	mu        sync.RWMutex
+	templates map[string]map[string]*template.Template
+	stamp     string
+}
+
+// CatalogOption configures a PromptCatalog
+type CatalogOption func(*PromptCatalog)
+
+// WithFallbackLocale sets the locale that ends every fallback chain,
+// DefaultLocale by default
+func WithFallbackLocale(locale string) CatalogOption {
+	return func(c *PromptCatalog) {
+		c.fallback = NormalizeLocale(locale)
+	}
+}
+
+// NewPromptCatalog loads the prompt templates of a file system
+func NewPromptCatalog(fsys fs.FS, opts ...CatalogOption) (*PromptCatalog, error) {
+	c := &PromptCatalog{fsys: fsys, fallback: DefaultLocale}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadPromptCatalog loads the prompt templates of a directory
+func LoadPromptCatalog(dir string, opts ...CatalogOption) (*PromptCatalog, error) {
+	return NewPromptCatalog(os.DirFS(dir), opts...)
+}
+
+// Reload loads the templates again. On error the catalog keeps serving the
+// templates it had.
+func (c *PromptCatalog) Reload() error {
+	templates := make(map[string]map[string]*template.Template)
+	err := fs.WalkDir(c.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != promptExt {
+			return nil
+		}
+		locale, file := path.Split(p)
+		locale = NormalizeLocale(path.Base(path.Clean(locale)))
+		if locale == "" || locale == "." {
+			return nil
+		}
+		data, err := fs.ReadFile(c.fsys, p)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(file, promptExt)
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return fmt.Errorf("failed to parse prompt %s: %w", p, err)
+		}
+		if templates[locale] == nil {
+			templates[locale] = make(map[string]*template.Template)
+		}
+		templates[locale][name] = tmpl
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load prompt catalog: %w", err)
+	}
+	stamp, err := c.fingerprint()
+	if err != nil {
+		return fmt.Errorf("failed to load prompt catalog: %w", err)
+	}
+
+	c.mu.Lock()
+	c.templates = templates
+	c.stamp = stamp
+	c.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the catalog whenever its files change, checking every
+// interval until ctx is done. It is meant for development, where prompts
+// are edited while the program runs.
+func (c *PromptCatalog) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stamp, err := c.fingerprint()
+		c.mu.RLock()
+		changed := err == nil && stamp != c.stamp
+		c.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := c.Reload(); err != nil {
+			LoggerFromContext(ctx).Warn("Failed to reload prompt catalog", "error", err)
+			continue
+		}
+		LoggerFromContext(ctx).Info("Reloaded prompt catalog")
+	}
+}
+
+// fingerprint summarizes the names, sizes and modification times of the
+// template files
+func (c *PromptCatalog) fingerprint() (string, error) {
+	var b strings.Builder
+	err := fs.WalkDir(c.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != promptExt {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", p, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return b.String(), err
+}
+
+// Locales returns the locales of the catalog
+func (c *PromptCatalog) Locales() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	locales := make([]string, 0, len(c.templates))
+	for locale := range c.templates {
+		locales = append(locales, locale)
+	}
+	return locales
+}
+
+// Render renders the named prompt in the locale of the context, walking its
+// fallback chain. A prompt served in another language than the one
+// requested logs a warning and emits EventMissingTranslation rather than
+// quietly serving the fallback.
+func (c *PromptCatalog) Render(ctx context.Context, name string, data interface{}) (string, error) {
+	return c.RenderLocale(ctx, LocaleFromContext(ctx), name, data)
+}
+
+// RenderLocale renders the named prompt in the given locale, walking its
+// fallback chain
+func (c *PromptCatalog) RenderLocale(ctx context.Context, locale, name string, data interface{}) (string, error) {
+	chain := LocaleChain(locale, c.fallback)
+
+	c.mu.RLock()
+	var tmpl *template.Template
+	var served string
+	for _, l := range chain {
+		if t, ok := c.templates[l][name]; ok {
+			tmpl, served = t, l
+			break
+		}
+	}
+	c.mu.RUnlock()
+	if tmpl == nil {
+		return "", fmt.Errorf("%w: %s for locale %s", ErrPromptNotFound, name, strings.Join(chain, ", "))
+	}
+
+	if requested := chain[0]; locale != "" && localeLanguage(served) != localeLanguage(requested) {
+		LoggerFromContext(ctx).Warn("Prompt missing translation, serving fallback",
+			"prompt", name,
+			"locale", requested,
+			"served", served)
+		EmitEvent(ctx, Event{
+			Type:      EventMissingTranslation,
+			Name:      name,
+			RunID:     RunIDFromContext(ctx),
+			Timestamp: time.Now(),
+			Metadata: map[string]interface{}{
+				"prompt": name,
+				"locale": requested,
+				"served": served,
+			},
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s (%s): %w", name, served, err)
+	}
+	return buf.String(), nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -13,10 +15,20 @@ var (
 
 	// ErrInvalidResume is returned when trying to resume with invalid data
 	ErrInvalidResume = errors.New("invalid resume data")
+
+	// ErrNotInterrupted is returned when resuming a run that isn't paused
+	ErrNotInterrupted = errors.New("not interrupted")
+
+	// ErrAmbiguousResume is returned by Resume and ResumeAs when several
+	// runs are paused, which have to be resumed with ResumeRun
+	ErrAmbiguousResume = errors.New("several runs are interrupted")
 )
 
 // InterruptInfo contains information about an interrupt
 type InterruptInfo struct {
+	// RunID identifies the paused run, for resuming it with ResumeRun
+	RunID string `json:"run_id,omitempty"`
+
 	// NodeName is the name of the node that triggered the interrupt
 	NodeName string `json:"node_name"`
 
@@ -31,28 +43,48 @@ type InterruptInfo struct {
 type InterruptManager[T any] struct {
 	mu sync.Mutex
 
-	// interrupted indicates if execution is currently interrupted
-	interrupted bool
+	// paused holds the runs waiting to be resumed, by run ID
+	paused map[string]*pausedRun[T]
 
-	// interruptCh is used to send interrupt info to clients
+	// interruptCh is used to send interrupt info to clients.
+	// It is buffered so a client that isn't reading at the moment of the
+	// interrupt doesn't block the run.
 	interruptCh chan InterruptInfo
 
-	// resumeCh is used to receive resume data from clients
-	resumeCh chan T
-
 	// breakpoints is a set of node names where execution should pause
 	breakpoints map[string]struct{}
+
+	// redaction hides sensitive state fields from interrupt info sent to clients
+	redaction *RedactionPolicy
+
+	// codec serializes the state in interrupt info
+	codec Codec[T]
 }
 
 // NewInterruptManager creates a new interrupt manager
 func NewInterruptManager[T any]() *InterruptManager[T] {
 	return &InterruptManager[T]{
-		interruptCh: make(chan InterruptInfo),
-		resumeCh:    make(chan T),
+		interruptCh: make(chan InterruptInfo, 1),
+		paused:      make(map[string]*pausedRun[T]),
 		breakpoints: make(map[string]struct{}),
 	}
 }
 
+// SetRedactionPolicy sets the policy applied to the state in interrupt info
+func (m *InterruptManager[T]) SetRedactionPolicy(policy *RedactionPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.redaction = policy
+}
+
+// SetCodec sets the codec used to serialize the state in interrupt info.
+// Binary codecs fall back to encoding/json so clients can read the state.
+func (m *InterruptManager[T]) SetCodec(codec Codec[T]) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codec = codec
+}
+
 // AddBreakpoint adds a breakpoint at the specified node
 func (m *InterruptManager[T]) AddBreakpoint(nodeName string) {
 	m.mu.Lock()
@@ -75,58 +107,175 @@ func (m *InterruptManager[T]) HasBreakpoint(nodeName string) bool {
 	return ok
 }
 
-// Interrupt pauses graph execution and sends interrupt info to clients
-func (m *InterruptManager[T]) Interrupt(nodeName string, data interface{}, state T) error {
+// Breakpoints returns the nodes with a breakpoint in alphabetical order
+func (m *InterruptManager[T]) Breakpoints() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.breakpoints))
+	for name := range m.breakpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pausedRun is a run waiting to be resumed
+type pausedRun[T any] struct {
+	node  string
+	state T
+
+	// resume receives the resumption, it is buffered so resuming never
+	// waits for the run
+	resume chan resumption[T]
+}
+
+// Interrupt pauses the run of ctx and sends interrupt info to clients. The
+// state in the info is redacted, the paused state itself stays available
+// through PausedState. If the info can't be delivered before ctx is done
+// the interrupt is abandoned and the context error is returned.
+func (m *InterruptManager[T]) Interrupt(ctx context.Context, nodeName string, data interface{}, state T) error {
+	runID := RunIDFromContext(ctx)
 	m.mu.Lock()
-	if m.interrupted {
+	if _, ok := m.paused[runID]; ok {
 		m.mu.Unlock()
-		return errors.New("already interrupted")
+		return fmt.Errorf("run %s already interrupted", runID)
 	}
-	m.interrupted = true
+	m.paused[runID] = &pausedRun[T]{node: nodeName, state: state, resume: make(chan resumption[T], 1)}
+	redaction := m.redaction
+	codec := m.codec
 	m.mu.Unlock()
 
 	dataBytes, err := json.Marshal(data)
 	if err != nil {
+		m.clearPaused(runID)
 		return err
 	}
 
-	stateBytes, err := json.Marshal(state)
+	stateBytes, err := EncodeJSON(codec, state)
+	if err == nil {
+		stateBytes, err = redactData(state, stateBytes, redaction)
+	}
 	if err != nil {
+		m.clearPaused(runID)
 		return err
 	}
 
 	info := InterruptInfo{
+		RunID:    runID,
 		NodeName: nodeName,
 		Data:     dataBytes,
 		State:    stateBytes,
 	}
 
-	m.interruptCh <- info
-	return nil
+	logger := LoggerFromContext(ctx)
+	select {
+	case m.interruptCh <- info:
+		logger.Info("Run interrupted", "node", nodeName)
+		return nil
+	case <-ctx.Done():
+		m.clearPaused(runID)
+		logger.Warn("Interrupt abandoned", "node", nodeName, "error", ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// clearPaused forgets a paused run after a failed interrupt or once it
+// stopped waiting
+func (m *InterruptManager[T]) clearPaused(runID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.paused, runID)
+}
+
+// PausedState returns the unredacted state a run paused with, for storing
+// it on the server side. It reports false when the run isn't paused.
+func (m *InterruptManager[T]) PausedState(runID string) (T, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if run, ok := m.paused[runID]; ok {
+		return run.state, true
+	}
+	var zero T
+	return zero, false
+}
+
+// resumption is the state a paused run is resumed with and who resumed it
+type resumption[T any] struct {
+	state  T
+	editor string
 }
 
-// Resume resumes graph execution with the provided state
+// Resume resumes the paused run with the provided state
 func (m *InterruptManager[T]) Resume(state T) error {
+	return m.ResumeAs(state, "")
+}
+
+// ResumeAs resumes the paused run with the provided state on behalf of an
+// editor, who is recorded when the state differs from the paused one. It
+// fails with ErrAmbiguousResume when several runs are paused.
+func (m *InterruptManager[T]) ResumeAs(state T, editor string) error {
 	m.mu.Lock()
-	if !m.interrupted {
-		m.mu.Unlock()
-		return errors.New("not interrupted")
+	defer m.mu.Unlock()
+	switch len(m.paused) {
+	case 0:
+		return ErrNotInterrupted
+	case 1:
+		for runID := range m.paused {
+			return m.resumeLocked(runID, state, editor)
+		}
 	}
-	m.interrupted = false
-	m.mu.Unlock()
+	return ErrAmbiguousResume
+}
+
+// ResumeRun resumes the paused run with the given ID with the provided
+// state on behalf of an editor
+func (m *InterruptManager[T]) ResumeRun(runID string, state T, editor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.resumeLocked(runID, state, editor)
+}
 
-	m.resumeCh <- state
+// resumeLocked hands the resumption to a paused run, with m.mu held
+func (m *InterruptManager[T]) resumeLocked(runID string, state T, editor string) error {
+	run, ok := m.paused[runID]
+	if !ok {
+		return fmt.Errorf("%w: run %s", ErrNotInterrupted, runID)
+	}
+	delete(m.paused, runID)
+	run.resume <- resumption[T]{state: state, editor: editor}
 	return nil
 }
 
 // WaitForResume waits for the client to resume execution
 func (m *InterruptManager[T]) WaitForResume(ctx context.Context) (T, error) {
+	state, _, err := m.waitForResume(ctx)
+	return state, err
+}
+
+// waitForResume waits for the client to resume execution and returns the
+// state along with who resumed it
+func (m *InterruptManager[T]) waitForResume(ctx context.Context) (T, string, error) {
+	var zero T
+	runID := RunIDFromContext(ctx)
+	m.mu.Lock()
+	run, ok := m.paused[runID]
+	m.mu.Unlock()
+	if !ok {
+		return zero, "", fmt.Errorf("%w: run %s", ErrNotInterrupted, runID)
+	}
+
 	select {
-	case state := <-m.resumeCh:
-		return state, nil
+	case res := <-run.resume:
+		LoggerFromContext(ctx).Info("Run resumed")
+		return res.state, res.editor, nil
 	case <-ctx.Done():
-		var zero T
-		return zero, ctx.Err()
+		m.mu.Lock()
+		if m.paused[runID] == run {
+			delete(m.paused, runID)
+		}
+		m.mu.Unlock()
+		LoggerFromContext(ctx).Warn("Gave up waiting for resume", "error", ctx.Err())
+		return zero, "", ctx.Err()
 	}
 }
 
@@ -141,6 +290,23 @@ func Interrupt[T any](ctx context.Context, data interface{}) (T, error) {
 	return zero, &InterruptError{Data: data}
 }
 
+// InterruptTyped is a type-safe variant of Interrupt for use in node functions.
+// The returned error should be returned from the node to trigger the interrupt,
+// and clients can recover the data with DecodeInterruptData.
+func InterruptTyped[D any](ctx context.Context, data D) error {
+	return &InterruptError{Data: data}
+}
+
+// DecodeInterruptData decodes the data of an interrupt into D
+func DecodeInterruptData[D any](info InterruptInfo) (D, error) {
+	var data D
+	if err := json.Unmarshal(info.Data, &data); err != nil {
+		var zero D
+		return zero, fmt.Errorf("failed to decode interrupt data: %w", err)
+	}
+	return data, nil
+}
+
 // InterruptError is returned when a node triggers an interrupt
 type InterruptError struct {
 	Data interface{} `json:"data"`
@@ -150,15 +316,17 @@ func (e *InterruptError) Error() string {
 	return "interrupt requested"
 }
 
-// IsInterruptError checks if an error is an InterruptError
+// IsInterruptError checks if an error is or wraps an InterruptError, so
+// tools can interrupt the run through the agent calling them
 func IsInterruptError(err error) bool {
-	_, ok := err.(*InterruptError)
-	return ok
+	var ierr *InterruptError
+	return errors.As(err, &ierr)
 }
 
-// GetInterruptData extracts data from an InterruptError
+// GetInterruptData extracts data from an InterruptError, which may be wrapped
 func GetInterruptData(err error) (interface{}, bool) {
-	if ierr, ok := err.(*InterruptError); ok {
+	var ierr *InterruptError
+	if errors.As(err, &ierr) {
 		return ierr.Data, true
 	}
 	return nil, false
@@ -0,0 +1,298 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+type approval struct {
+	Approved bool
+	By       string
+}
+
+// pausedRuns starts a run per ID on a graph with a breakpoint on "review"
+// and waits until they are all paused
+func pausedRuns(t *testing.T, ids ...string) (*core.StateGraph[approval], map[string]chan approval) {
+	t.Helper()
+	g := newGraph[approval]()
+	g.AddNode("review", func(ctx context.Context, s approval) (approval, error) {
+		return s, nil
+	})
+	chain(g, "review")
+	g.AddBreakpoint("review")
+	r := compile(t, g)
+
+	results := make(map[string]chan approval)
+	for _, id := range ids {
+		results[id] = make(chan approval, 1)
+		go func(id string) {
+			out, err := r.InvokeWithConfig(context.Background(), approval{}, core.InvokeConfig{RunID: id})
+			if err != nil {
+				t.Errorf("run %s: %v", id, err)
+			}
+			results[id] <- out
+		}(id)
+	}
+
+	paused := make(map[string]bool)
+	for len(paused) < len(ids) {
+		select {
+		case info := <-g.GetInterruptChannel():
+			paused[info.RunID] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("paused runs = %v, want %v", paused, ids)
+		}
+	}
+	return g, results
+}
+
+func TestConcurrentInterruptsResumedByRunID(t *testing.T) {
+	g, results := pausedRuns(t, "run-a", "run-b")
+
+	if err := g.ResumeAs(approval{}, ""); !errors.Is(err, core.ErrAmbiguousResume) {
+		t.Fatalf("ResumeAs with two paused runs = %v, want ErrAmbiguousResume", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"run-a", "run-b"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if err := g.ResumeRun(id, approval{Approved: true, By: id}, ""); err != nil {
+				t.Errorf("ResumeRun(%s): %v", id, err)
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	for id, ch := range results {
+		select {
+		case out := <-ch:
+			if !out.Approved || out.By != id {
+				t.Errorf("run %s finished with %+v, resumed with another run's state", id, out)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("run %s did not finish", id)
+		}
+	}
+}
+
+func TestResumeUnknownRun(t *testing.T) {
+	g, results := pausedRuns(t, "run-a")
+
+	if err := g.ResumeRun("run-b", approval{}, ""); !errors.Is(err, core.ErrNotInterrupted) {
+		t.Fatalf("ResumeRun of a run that isn't paused = %v, want ErrNotInterrupted", err)
+	}
+	if _, ok := g.PausedState("run-a"); !ok {
+		t.Fatal("run-a is no longer paused after resuming another run")
+	}
+	if err := g.Resume(approval{Approved: true}); err != nil {
+		t.Fatalf("Resume with a single paused run: %v", err)
+	}
+	if out := <-results["run-a"]; !out.Approved {
+		t.Errorf("run-a finished with %+v", out)
+	}
+}
+
+type reviewRequest struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	Urgent   bool     `json:"urgent"`
+}
+
+func TestInterruptDataRoundTrips(t *testing.T) {
+	want := reviewRequest{Question: "ship it?", Options: []string{"yes", "no"}, Urgent: true}
+	g := newGraph[approval]()
+	g.AddNode("ask", func(ctx context.Context, s approval) (approval, error) {
+		if s.By == "" {
+			return s, core.InterruptTyped(ctx, want)
+		}
+		return s, nil
+	})
+	chain(g, "ask")
+	r := compile(t, g)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Invoke(context.Background(), approval{})
+		done <- err
+	}()
+
+	var info core.InterruptInfo
+	select {
+	case info = <-g.GetInterruptChannel():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no interrupt")
+	}
+	got, err := core.DecodeInterruptData[reviewRequest](info)
+	if err != nil {
+		t.Fatalf("DecodeInterruptData: %v", err)
+	}
+	if got.Question != want.Question || !got.Urgent || len(got.Options) != 2 || got.Options[1] != "no" {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+	if _, err := core.DecodeInterruptData[int](info); err == nil {
+		t.Error("decoding the data as the wrong type succeeded")
+	}
+
+	if err := g.ResumeRun(info.RunID, approval{Approved: true, By: "ada"}, "ada"); err != nil {
+		t.Fatalf("ResumeRun: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
+
+func TestInterruptWithoutReaderDoesNotHang(t *testing.T) {
+	g := newGraph[approval]()
+	g.AddNode("review", func(ctx context.Context, s approval) (approval, error) {
+		return s, nil
+	})
+	chain(g, "review")
+	g.AddBreakpoint("review")
+	r := compile(t, g)
+
+	// Nobody reads the interrupt channel or resumes the runs
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		done := make(chan error, 1)
+		go func() {
+			_, err := r.Invoke(ctx, approval{})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("run %d = %v, want context.DeadlineExceeded", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("run %d hangs on an interrupt nobody reads", i)
+		}
+		cancel()
+	}
+}
+
+func TestInterruptReadLate(t *testing.T) {
+	g := newGraph[approval]()
+	g.AddNode("review", func(ctx context.Context, s approval) (approval, error) {
+		return s, nil
+	})
+	chain(g, "review")
+	g.AddBreakpoint("review")
+	r := compile(t, g)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Invoke(context.Background(), approval{})
+		done <- err
+	}()
+
+	// The client is busy when the run interrupts
+	time.Sleep(50 * time.Millisecond)
+	info := <-g.GetInterruptChannel()
+	if err := g.ResumeRun(info.RunID, approval{Approved: true}, ""); err != nil {
+		t.Fatalf("ResumeRun: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run didn't finish after a late resume")
+	}
+}
+
+func TestEditedStateStreamedBeforeResuming(t *testing.T) {
+	g := core.NewStateGraph[approval]()
+	g.SetStreamConfig(core.StreamConfig{Modes: []core.StreamMode{core.StreamValues, core.StreamDebug}, BufferSize: 256})
+	g.AddNode("review", func(ctx context.Context, s approval) (approval, error) {
+		s.By += " (reviewed)"
+		return s, nil
+	})
+	chain(g, "review")
+	g.AddBreakpoint("review")
+	r := compile(t, g)
+
+	stream, wait := r.InvokeStreaming(context.Background(), approval{})
+	var info core.InterruptInfo
+	select {
+	case info = <-g.GetInterruptChannel():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no interrupt")
+	}
+	if err := g.ResumeRun(info.RunID, approval{Approved: true, By: "ada"}, "ada"); err != nil {
+		t.Fatalf("ResumeRun: %v", err)
+	}
+
+	var values []core.StreamEvent
+	var edit core.StateEdit
+	for evt := range stream {
+		switch data := evt.Data.(type) {
+		case approval:
+			values = append(values, evt)
+		case core.Event:
+			if data.Type == core.EventStateEdit {
+				if err := json.Unmarshal(data.Data, &edit); err != nil {
+					t.Fatalf("decoding the edit: %v", err)
+				}
+			}
+		}
+	}
+	if _, err := wait(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	edited := -1
+	for i, evt := range values {
+		if evt.Metadata["source"] == core.SourceHumanEdit {
+			edited = i
+		}
+	}
+	if edited < 0 {
+		t.Fatalf("values frames = %+v, none flagged as a human edit", values)
+	}
+	if got := values[edited].Data.(approval); got != (approval{Approved: true, By: "ada"}) {
+		t.Errorf("edited frame = %+v, want the state the run was resumed with", got)
+	}
+	for _, evt := range values[:edited] {
+		if evt.Data.(approval).By != "" {
+			t.Errorf("frame %+v computed from the edited state came before the edit", evt.Data)
+		}
+	}
+	if last := values[len(values)-1].Data.(approval); last.By != "ada (reviewed)" {
+		t.Errorf("last frame = %+v, want the node's output", last)
+	}
+
+	var fields []string
+	for _, change := range edit.Changes {
+		fields = append(fields, change.Field)
+	}
+	if edit.Editor != "ada" || edit.Node != "review" || strings.Join(fields, ",") != "Approved,By" {
+		t.Errorf("edit = %+v, want ada changing Approved and By at review", edit)
+	}
+}
+
+func TestDiffStateByField(t *testing.T) {
+	changes, err := core.DiffState(
+		json.RawMessage(`{"title":"t","tags":["a","b"],"owner":"bo"}`),
+		json.RawMessage(`{"tags": ["a", "b"], "title":"t", "priority":2}`),
+	)
+	if err != nil {
+		t.Fatalf("DiffState: %v", err)
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.Field+":"+string(change.Before)+"->"+string(change.After))
+	}
+	if want := `owner:"bo"->,priority:->2`; strings.Join(got, ",") != want {
+		t.Errorf("changes = %v, want %s", got, want)
+	}
+}
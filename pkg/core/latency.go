@@ -0,0 +1,119 @@
+package core
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyAlpha is the smoothing factor of the latency averages
+	latencyAlpha = 0.2
+
+	// adaptiveMinSamples is the number of observed executions needed before
+	// an adaptive timeout replaces the static one
+	adaptiveMinSamples = 3
+
+	// adaptiveMinMultiple is the smallest adaptive timeout as a multiple of
+	// the average latency, so a node with steady latency isn't cut off by
+	// the first execution that is a little slower
+	adaptiveMinMultiple = 1.5
+)
+
+// latencyStats is an exponentially weighted moving average and variance of
+// a node's execution time. It is safe for concurrent use.
+type latencyStats struct {
+	mu       sync.Mutex
+	mean     float64
+	variance float64
+	count    int
+}
+
+// observe adds an execution time to the averages
+func (s *latencyStats) observe(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	x := float64(d)
+	s.count++
+	if s.count == 1 {
+		s.mean = x
+		s.variance = 0
+		return
+	}
+	diff := x - s.mean
+	incr := latencyAlpha * diff
+	s.mean += incr
+	s.variance = (1 - latencyAlpha) * (s.variance + diff*incr)
+}
+
+// stats returns the average, standard deviation and number of observations
+func (s *latencyStats) stats() (time.Duration, time.Duration, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.mean), time.Duration(math.Sqrt(s.variance)), s.count
+}
+
+// adaptiveTimeout configures a node timeout derived from observed latency
+type adaptiveTimeout struct {
+	multiplier float64
+	stats      latencyStats
+}
+
+// SetNodeTimeout bounds every execution of the node with a fixed timeout
+func (g *StateGraph[T]) SetNodeTimeout(nodeName string, timeout time.Duration) {
+	if g.nodeTimeouts == nil {
+		g.nodeTimeouts = make(map[string]time.Duration)
+	}
+	g.nodeTimeouts[nodeName] = timeout
+}
+
+// SetAdaptiveTimeout bounds executions of the node with a timeout of the
+// average latency plus multiplier standard deviations, both tracked as
+// moving averages over the graph's runs. Until enough executions have been
+// observed the static timeout set with SetNodeTimeout applies, if any, and
+// afterwards it is the smallest timeout used. Executions that time out are
+// counted at the timeout, so the timeout widens when the node slows down.
+func (g *StateGraph[T]) SetAdaptiveTimeout(nodeName string, multiplier float64) {
+	if g.adaptiveTimeouts == nil {
+		g.adaptiveTimeouts = make(map[string]*adaptiveTimeout)
+	}
+	g.adaptiveTimeouts[nodeName] = &adaptiveTimeout{multiplier: multiplier}
+}
+
+// NodeLatency returns the average and standard deviation of the node's
+// execution time and the number of executions observed. Latency is only
+// tracked for nodes with an adaptive timeout.
+func (g *StateGraph[T]) NodeLatency(nodeName string) (time.Duration, time.Duration, int) {
+	adaptive, ok := g.adaptiveTimeouts[nodeName]
+	if !ok {
+		return 0, 0, 0
+	}
+	return adaptive.stats.stats()
+}
+
+// nodeTimeout returns the timeout for the next execution of the node, if any
+func (g *StateGraph[T]) nodeTimeout(nodeName string) (time.Duration, bool) {
+	if adaptive, ok := g.adaptiveTimeouts[nodeName]; ok {
+		mean, stddev, count := adaptive.stats.stats()
+		if count >= adaptiveMinSamples {
+			timeout := mean + time.Duration(adaptive.multiplier*float64(stddev))
+			if floor := time.Duration(adaptiveMinMultiple * float64(mean)); timeout < floor {
+				timeout = floor
+			}
+			if static := g.nodeTimeouts[nodeName]; timeout < static {
+				timeout = static
+			}
+			return timeout, true
+		}
+	}
+	timeout, ok := g.nodeTimeouts[nodeName]
+	return timeout, ok && timeout > 0
+}
+
+// observeLatency records an execution of the node that succeeded or timed out
+func (g *StateGraph[T]) observeLatency(nodeName string, d time.Duration) {
+	if adaptive, ok := g.adaptiveTimeouts[nodeName]; ok {
+		adaptive.stats.observe(d)
+	}
+}
@@ -0,0 +1,86 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// sleeper builds a graph whose "work" node takes as long as the returned
+// duration says, unless its context ends first
+func sleeper(t *testing.T, configure func(g *core.StateGraph[int])) (*core.StateGraph[int], *core.RunnableState[int], *atomic.Int64) {
+	t.Helper()
+	var delay atomic.Int64
+	g := newGraph[int]()
+	g.AddNode("work", func(ctx context.Context, s int) (int, error) {
+		select {
+		case <-time.After(time.Duration(delay.Load())):
+			return s + 1, nil
+		case <-ctx.Done():
+			return s, ctx.Err()
+		}
+	})
+	chain(g, "work")
+	configure(g)
+	return g, compile(t, g), &delay
+}
+
+func TestAdaptiveTimeoutWidensAfterSlowRuns(t *testing.T) {
+	g, r, delay := sleeper(t, func(g *core.StateGraph[int]) {
+		g.SetAdaptiveTimeout("work", 2)
+	})
+	ctx := context.Background()
+
+	delay.Store(int64(5 * time.Millisecond))
+	for i := 0; i < 3; i++ {
+		if _, err := r.Invoke(ctx, 0); err != nil {
+			t.Fatalf("fast run %d: %v", i, err)
+		}
+	}
+	fast, _, _ := g.NodeLatency("work")
+
+	delay.Store(int64(30 * time.Millisecond))
+	timeouts := 0
+	for {
+		_, err := r.Invoke(ctx, 0)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("slow run: %v", err)
+		}
+		timeouts++
+		if timeouts == 40 {
+			mean, stddev, _ := g.NodeLatency("work")
+			t.Fatalf("still timing out after %d slow runs, latency %v ± %v", timeouts, mean, stddev)
+		}
+	}
+	if timeouts == 0 {
+		t.Fatal("first slow run didn't time out, the timeout wasn't adapted to the fast runs")
+	}
+	if slow, _, _ := g.NodeLatency("work"); slow <= fast {
+		t.Errorf("average latency %v after slow runs, want more than %v", slow, fast)
+	}
+}
+
+func TestAdaptiveTimeoutNotBelowStaticTimeout(t *testing.T) {
+	_, r, delay := sleeper(t, func(g *core.StateGraph[int]) {
+		g.SetNodeTimeout("work", time.Second)
+		g.SetAdaptiveTimeout("work", 1)
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := r.Invoke(ctx, 0); err != nil {
+			t.Fatalf("instant run %d: %v", i, err)
+		}
+	}
+	delay.Store(int64(20 * time.Millisecond))
+	if _, err := r.Invoke(ctx, 0); err != nil {
+		t.Fatalf("run well within the static timeout: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LifecycleEventType is the kind of a LifecycleEvent
+type LifecycleEventType string
+
+const (
+	// LifecycleRunStarted is published when a run starts
+	LifecycleRunStarted LifecycleEventType = "run_started"
+
+	// LifecycleNodeCompleted is published when a node finishes successfully
+	LifecycleNodeCompleted LifecycleEventType = "node_completed"
+
+	// LifecycleInterruptRaised is published when a run pauses at a
+	// breakpoint or an interrupt
+	LifecycleInterruptRaised LifecycleEventType = "interrupt_raised"
+
+	// LifecycleStateEdited is published when a paused run is resumed with a
+	// state that differs from the one it paused with
+	LifecycleStateEdited LifecycleEventType = "state_edited"
+
+	// LifecycleRunCompleted is published when a run finishes successfully
+	LifecycleRunCompleted LifecycleEventType = "run_completed"
+
+	// LifecycleRunFailed is published when a run ends with an error
+	LifecycleRunFailed LifecycleEventType = "run_failed"
+)
+
+// LifecycleEvent is a milestone of a run, published to applications that
+// embed graphs so they can react without serving runs over HTTP
+type LifecycleEvent struct {
+	Type     LifecycleEventType `json:"type"`
+	RunID    string             `json:"run_id"`
+	ThreadID string             `json:"thread_id,omitempty"`
+	Graph    string             `json:"graph"`
+
+	// Node is the node that completed or was interrupted, or the entry
+	// point of a started run
+	Node string `json:"node,omitempty"`
+
+	// Step is the step of the node, or the number of steps of a finished run
+	Step int `json:"step"`
+
+	// Duration is how long the node or the run took
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// Error is the error a failed run ended with
+	Error string `json:"error,omitempty"`
+
+	// Cached is set on the run_completed event of a run served from a run
+	// cache without executing
+	Cached bool `json:"cached,omitempty"`
+
+	// Edit is the change of a state_edited event
+	Edit *StateEdit `json:"edit,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// EventFilter selects the lifecycle events a subscription receives. Empty
+// fields match everything.
+type EventFilter struct {
+	Types    []LifecycleEventType
+	Graph    string
+	RunID    string
+	ThreadID string
+}
+
+// matches reports whether the event passes the filter
+func (f EventFilter) matches(evt LifecycleEvent) bool {
+	if f.Graph != "" && f.Graph != evt.Graph {
+		return false
+	}
+	if f.RunID != "" && f.RunID != evt.RunID {
+		return false
+	}
+	if f.ThreadID != "" && f.ThreadID != evt.ThreadID {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == evt.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultLifecycleBuffer is the number of events a subscription holds
+// before newer events are dropped
+const DefaultLifecycleBuffer = 256
+
+// subscription is a subscriber of a LifecycleBus
+type subscription struct {
+	filter EventFilter
+	ch     chan LifecycleEvent
+}
+
+// LifecycleBus delivers lifecycle events to subscribers. Publishing never
+// blocks a run: every subscription has a bounded buffer, and events that
+// don't fit are dropped and counted. The events of a run arrive in the
+// order they were published.
+type LifecycleBus struct {
+	buffer int
+
+	mu   sync.RWMutex
+	subs map[*subscription]struct{}
+
+	dropped atomic.Int64
+}
+
+// NewLifecycleBus creates a bus whose subscriptions hold buffer events. A
+// buffer of zero or less uses DefaultLifecycleBuffer.
+func NewLifecycleBus(buffer int) *LifecycleBus {
+	if buffer <= 0 {
+		buffer = DefaultLifecycleBuffer
+	}
+	return &LifecycleBus{buffer: buffer, subs: make(map[*subscription]struct{})}
+}
+
+// defaultLifecycleBus is the process-wide bus returned by Events
+var defaultLifecycleBus = NewLifecycleBus(0)
+
+// Events returns the process-wide lifecycle bus every run publishes to
+func Events() *LifecycleBus {
+	return defaultLifecycleBus
+}
+
+// Subscribe returns a channel of the events matching filter and a function
+// that ends the subscription and closes the channel. The function may be
+// called more than once.
+func (b *LifecycleBus) Subscribe(filter EventFilter) (<-chan LifecycleEvent, func()) {
+	sub := &subscription{filter: filter, ch: make(chan LifecycleEvent, b.buffer)}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			close(sub.ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Publish hands the event to every matching subscription without blocking
+func (b *LifecycleBus) Publish(evt LifecycleEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if !sub.filter.matches(evt) {
+			continue
+		}
+		select {
+		case sub.ch <- evt:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns the number of events dropped because a subscription's
+// buffer was full
+func (b *LifecycleBus) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+type lifecycleBusKey struct{}
+
+// WithLifecycleBus returns a context whose runs also publish to bus, besides
+// the process-wide bus
+func WithLifecycleBus(ctx context.Context, bus *LifecycleBus) context.Context {
+	return context.WithValue(ctx, lifecycleBusKey{}, bus)
+}
+
+// LifecycleBusFromContext returns the bus attached to the context, or nil
+func LifecycleBusFromContext(ctx context.Context) *LifecycleBus {
+	bus, _ := ctx.Value(lifecycleBusKey{}).(*LifecycleBus)
+	return bus
+}
+
+// runLifecycle publishes the lifecycle events of one run
+type runLifecycle struct {
+	buses []*LifecycleBus
+	base  LifecycleEvent
+
+	// steps is the number of steps of a finished run
+	steps int
+
+	// interrupted is set once the run raised an interrupt
+	interrupted bool
+}
+
+type runLifecycleKey struct{}
+
+// newRunLifecycle returns the publisher for a run
+func newRunLifecycle(ctx context.Context, graph, runID string) *runLifecycle {
+	buses := []*LifecycleBus{Events()}
+	if bus := LifecycleBusFromContext(ctx); bus != nil && bus != Events() {
+		buses = append(buses, bus)
+	}
+	return &runLifecycle{
+		buses: buses,
+		base:  LifecycleEvent{RunID: runID, ThreadID: ThreadIDFromContext(ctx), Graph: graph},
+	}
+}
+
+// publish fills in the run's fields and publishes the event. It is a no-op
+// on a nil lifecycle.
+func (l *runLifecycle) publish(evt LifecycleEvent) {
+	if l == nil {
+		return
+	}
+	if evt.Type == LifecycleInterruptRaised {
+		l.interrupted = true
+	}
+	evt.RunID = l.base.RunID
+	evt.ThreadID = l.base.ThreadID
+	evt.Graph = l.base.Graph
+	evt.Time = time.Now()
+	for _, bus := range l.buses {
+		bus.Publish(evt)
+	}
+}
+
+// runLifecycleFromContext returns the lifecycle publisher of the run
+func runLifecycleFromContext(ctx context.Context) *runLifecycle {
+	l, _ := ctx.Value(runLifecycleKey{}).(*runLifecycle)
+	return l
+}
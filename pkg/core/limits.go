@@ -0,0 +1,128 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrStateTooLarge is returned when the serialized state exceeds the run's MaxStateBytes
+	ErrStateTooLarge = errors.New("state too large")
+
+	// ErrTooManyMessages is returned when the state holds more than the run's MaxMessages
+	ErrTooManyMessages = errors.New("too many messages")
+)
+
+// Default run resource limits. They are generous enough for normal runs but
+// stop a runaway loop long before it exhausts memory.
+const (
+	DefaultMaxStateBytes = 64 << 20
+	DefaultMaxMessages   = 10000
+)
+
+// ResourceLimits bounds the resources a single run may use.
+// They are checked after every node. A zero value uses the default and a
+// negative value disables the limit.
+type ResourceLimits struct {
+	// MaxStateBytes is the largest allowed size of the state encoded with
+	// the graph codec. The default limit is only checked in steps that
+	// encode the state anyway, such as runs saving their thread, so runs
+	// that don't pay for serialization; a limit that is set explicitly is
+	// checked after every node. States the codec can't encode aren't
+	// measured.
+	MaxStateBytes int
+
+	// MaxMessages is the largest allowed number of messages in the state
+	MaxMessages int
+
+	// defaultStateBytes is set when MaxStateBytes is the default
+	defaultStateBytes bool
+}
+
+// MessageState is implemented by states that hold a conversation, so the
+// number of messages can be checked against MaxMessages
+type MessageState interface {
+	GetMessages() []Message
+}
+
+// LimitError is returned when a node leaves the state over a resource limit.
+// It wraps ErrStateTooLarge or ErrTooManyMessages.
+type LimitError struct {
+	// Node is the node after which the limit was exceeded
+	Node string
+
+	// Measured is the measured size, in bytes or messages
+	Measured int
+
+	// Limit is the limit that was exceeded
+	Limit int
+
+	err error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s after node %s: %d exceeds limit of %d", e.err, e.Node, e.Measured, e.Limit)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.err
+}
+
+// withDefaults fills in the default for every unset limit
+func (l ResourceLimits) withDefaults() ResourceLimits {
+	if l.MaxStateBytes == 0 {
+		l.MaxStateBytes = DefaultMaxStateBytes
+		l.defaultStateBytes = true
+	}
+	if l.MaxMessages == 0 {
+		l.MaxMessages = DefaultMaxMessages
+	}
+	return l
+}
+
+// merge overrides the limits with any set in override
+func (l ResourceLimits) merge(override ResourceLimits) ResourceLimits {
+	if override.MaxStateBytes != 0 {
+		l.MaxStateBytes = override.MaxStateBytes
+	}
+	if override.MaxMessages != 0 {
+		l.MaxMessages = override.MaxMessages
+	}
+	return l
+}
+
+// measuresState reports whether a step checks MaxStateBytes, given whether
+// it encodes the state anyway
+func (l ResourceLimits) measuresState(encoded bool) bool {
+	return l.MaxStateBytes > 0 && (encoded || !l.defaultStateBytes)
+}
+
+// check returns a *LimitError if the state produced by node is over a
+// limit. size measures the encoded state, reporting false when it can't;
+// a nil size skips MaxStateBytes.
+func (l ResourceLimits) check(node string, state interface{}, size func() (int, bool)) error {
+	if l.MaxMessages > 0 {
+		if count, ok := messageCount(state); ok && count > l.MaxMessages {
+			return &LimitError{Node: node, Measured: count, Limit: l.MaxMessages, err: ErrTooManyMessages}
+		}
+	}
+
+	if l.MaxStateBytes > 0 && size != nil {
+		if measured, ok := size(); ok && measured > l.MaxStateBytes {
+			return &LimitError{Node: node, Measured: measured, Limit: l.MaxStateBytes, err: ErrStateTooLarge}
+		}
+	}
+
+	return nil
+}
+
+// messageCount returns the number of messages in the state, if it exposes them
+func messageCount(state interface{}) (int, bool) {
+	switch s := state.(type) {
+	case []Message:
+		return len(s), true
+	case MessageState:
+		return len(s.GetMessages()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,96 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+type textState struct {
+	Text string
+}
+
+type chanState struct {
+	Text string
+	Done chan struct{}
+}
+
+func TestStateTooLarge(t *testing.T) {
+	g := newGraph[textState]()
+	g.AddNode("grow", func(ctx context.Context, s textState) (textState, error) {
+		s.Text = strings.Repeat("x", 100)
+		return s, nil
+	})
+	chain(g, "grow")
+	g.SetResourceLimits(core.ResourceLimits{MaxStateBytes: 50})
+
+	_, err := compile(t, g).Invoke(context.Background(), textState{})
+	if !errors.Is(err, core.ErrStateTooLarge) {
+		t.Fatalf("err = %v, want ErrStateTooLarge", err)
+	}
+	var limitErr *core.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Node != "grow" || limitErr.Limit != 50 {
+		t.Errorf("err = %#v, want a LimitError for node grow with limit 50", err)
+	}
+}
+
+func TestStateSizeMeasuredWithCodec(t *testing.T) {
+	g := newGraph[textState]()
+	g.AddNode("grow", func(ctx context.Context, s textState) (textState, error) {
+		s.Text = strings.Repeat("x", 100)
+		return s, nil
+	})
+	chain(g, "grow")
+	g.SetResourceLimits(core.ResourceLimits{MaxStateBytes: 50})
+	// Encodes just the length of the text
+	g.SetCodec(core.NewFuncCodec("length",
+		func(s textState) ([]byte, error) { return []byte{byte(len(s.Text))}, nil },
+		func(data []byte) (textState, error) { return textState{}, nil }))
+
+	if _, err := compile(t, g).Invoke(context.Background(), textState{}); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+}
+
+func TestUnencodableStateIsNotMeasured(t *testing.T) {
+	for name, limits := range map[string]core.ResourceLimits{
+		"default":  {},
+		"explicit": {MaxStateBytes: 50},
+	} {
+		t.Run(name, func(t *testing.T) {
+			g := newGraph[chanState]()
+			g.AddNode("work", func(ctx context.Context, s chanState) (chanState, error) {
+				s.Text = "done"
+				return s, nil
+			})
+			chain(g, "work")
+			g.SetResourceLimits(limits)
+
+			out, err := compile(t, g).Invoke(context.Background(), chanState{Done: make(chan struct{})})
+			if err != nil {
+				t.Fatalf("Invoke: %v", err)
+			}
+			if out.Text != "done" {
+				t.Errorf("Text = %q, want done", out.Text)
+			}
+		})
+	}
+}
+
+func TestDefaultLimitCheckedWhenSavingThread(t *testing.T) {
+	g := newGraph[textState]()
+	g.AddNode("grow", func(ctx context.Context, s textState) (textState, error) {
+		s.Text = strings.Repeat("x", core.DefaultMaxStateBytes)
+		return s, nil
+	})
+	chain(g, "grow")
+	g.SetThreadStore(core.NewThreadStore(nil))
+
+	ctx := core.WithThreadID(context.Background(), "thread-1")
+	if _, err := compile(t, g).Invoke(ctx, textState{}); !errors.Is(err, core.ErrStateTooLarge) {
+		t.Fatalf("err = %v, want ErrStateTooLarge", err)
+	}
+}
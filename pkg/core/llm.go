@@ -33,8 +33,49 @@ const (
 type Message struct {
 	Role      Role       `json:"role"`
 	Content   string     `json:"content"`
+	Reasoning string     `json:"reasoning,omitempty"`
 	Name      string     `json:"name,omitempty"`
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
+	// ToolCallID is the tool call a tool message answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+
+	// Metadata carries application data such as correlation IDs alongside
+	// the message. It is never sent to the model unless an agent is
+	// configured to include some of it as context.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Metadata keys that agents carry forward from a request to its replies
+const (
+	MetadataCorrelationID = "correlation_id"
+	MetadataTraceID       = "trace_id"
+	MetadataRequestID     = "request_id"
+
+	// MetadataThreadID names the conversation a message belongs to, for
+	// transports that carry no context such as the NATS router
+	MetadataThreadID = "thread_id"
+)
+
+// DefaultPropagatedMetadata are the metadata keys copied from a request
+// message to the replies an agent produces for it
+var DefaultPropagatedMetadata = []string{MetadataCorrelationID, MetadataTraceID, MetadataRequestID}
+
+// PropagateMetadata returns the subset of the message's metadata with the
+// given keys, or nil when none of them are set
+func PropagateMetadata(msg Message, keys []string) map[string]interface{} {
+	var out map[string]interface{}
+	for _, key := range keys {
+		value, ok := msg.Metadata[key]
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]interface{}, len(keys))
+		}
+		out[key] = value
+	}
+	return out
 }
 
 // ChatCompletionRequest represents a generic request for chat completion
@@ -72,6 +113,38 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+
+	// CachedTokens are the prompt tokens read from the provider's prompt cache
+	CachedTokens int `json:"cached_tokens,omitempty"`
+
+	// CacheWriteTokens are the prompt tokens written to the provider's prompt cache
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+}
+
+// UsageStats accumulates token usage over many requests
+type UsageStats struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	CachedTokens     int `json:"cached_tokens"`
+	CacheWriteTokens int `json:"cache_write_tokens"`
+}
+
+// Add adds the usage of one request
+func (s *UsageStats) Add(u Usage) {
+	s.Requests++
+	s.PromptTokens += u.PromptTokens
+	s.CompletionTokens += u.CompletionTokens
+	s.CachedTokens += u.CachedTokens
+	s.CacheWriteTokens += u.CacheWriteTokens
+}
+
+// CacheHitRatio returns the share of prompt tokens served from the prompt cache
+func (s UsageStats) CacheHitRatio() float64 {
+	if s.PromptTokens == 0 {
+		return 0
+	}
+	return float64(s.CachedTokens) / float64(s.PromptTokens)
 }
 
 // LLM defines the interface that all LLM providers must implement
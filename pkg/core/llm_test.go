@@ -0,0 +1,38 @@
+package core_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func TestPropagateMetadata(t *testing.T) {
+	msg := core.Message{Content: "hi", Metadata: map[string]interface{}{
+		core.MetadataCorrelationID: "corr-1",
+		core.MetadataTraceID:       "trace-1",
+		"tenant":                   "acme",
+	}}
+	tests := []struct {
+		name string
+		msg  core.Message
+		keys []string
+		want map[string]interface{}
+	}{
+		{"defaults", msg, core.DefaultPropagatedMetadata, map[string]interface{}{
+			core.MetadataCorrelationID: "corr-1",
+			core.MetadataTraceID:       "trace-1",
+		}},
+		{"custom key", msg, []string{"tenant"}, map[string]interface{}{"tenant": "acme"}},
+		{"unset keys", msg, []string{core.MetadataRequestID}, nil},
+		{"no keys", msg, nil, nil},
+		{"no metadata", core.Message{Content: "hi"}, core.DefaultPropagatedMetadata, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := core.PropagateMetadata(tt.msg, tt.keys); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PropagateMetadata = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
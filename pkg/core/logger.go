@@ -0,0 +1,49 @@
+package core
+
+import "context"
+
+// Logger is the structured logger used by graphs. Fields are given as
+// alternating keys and values.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+
+	// With returns a logger that adds the fields to every entry
+	With(keysAndValues ...interface{}) Logger
+}
+
+// nopLogger discards everything
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+func (l nopLogger) With(...interface{}) Logger {
+	return l
+}
+
+// NopLogger returns a Logger that discards everything
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a context carrying the logger
+func WithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger attached to the context. Inside a node
+// it carries the run ID, node name and step. Outside of a graph run it
+// returns a logger that discards everything.
+func LoggerFromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return logger
+	}
+	return NopLogger()
+}
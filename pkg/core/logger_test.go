@@ -0,0 +1,100 @@
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// logEntry is a line written to a recordingLogger
+type logEntry struct {
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger keeps every entry with the fields it was written with
+type recordingLogger struct {
+	mu      *sync.Mutex
+	entries *[]logEntry
+	fields  []interface{}
+}
+
+func newRecordingLogger() *recordingLogger {
+	return &recordingLogger{mu: &sync.Mutex{}, entries: &[]logEntry{}}
+}
+
+func (l *recordingLogger) Debug(msg string, kv ...interface{}) { l.add(msg, kv) }
+func (l *recordingLogger) Info(msg string, kv ...interface{})  { l.add(msg, kv) }
+func (l *recordingLogger) Warn(msg string, kv ...interface{})  { l.add(msg, kv) }
+func (l *recordingLogger) Error(msg string, kv ...interface{}) { l.add(msg, kv) }
+
+func (l *recordingLogger) With(kv ...interface{}) core.Logger {
+	fields := append(append([]interface{}(nil), l.fields...), kv...)
+	return &recordingLogger{mu: l.mu, entries: l.entries, fields: fields}
+}
+
+func (l *recordingLogger) add(msg string, kv []interface{}) {
+	all := append(append([]interface{}(nil), l.fields...), kv...)
+	fields := make(map[string]interface{}, len(all)/2)
+	for i := 0; i+1 < len(all); i += 2 {
+		fields[fmt.Sprint(all[i])] = all[i+1]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.entries = append(*l.entries, logEntry{msg: msg, fields: fields})
+}
+
+// find returns the first entry with the message
+func (l *recordingLogger) find(msg string) (logEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, entry := range *l.entries {
+		if entry.msg == msg {
+			return entry, true
+		}
+	}
+	return logEntry{}, false
+}
+
+func TestNodeLogsCarryRunFields(t *testing.T) {
+	logger := newRecordingLogger()
+	g := newGraph[int]()
+	g.SetLogger(logger)
+	var runID string
+	g.AddNode("first", func(ctx context.Context, n int) (int, error) { return n + 1, nil })
+	g.AddNode("second", func(ctx context.Context, n int) (int, error) {
+		runID = core.RunIDFromContext(ctx)
+		core.LoggerFromContext(ctx).Info("counting", "n", n)
+		return n + 1, nil
+	})
+	chain(g, "first", "second")
+
+	if _, err := compile(t, g).Invoke(context.Background(), 0); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	entry, ok := logger.find("counting")
+	if !ok {
+		t.Fatal("the node's log line wasn't written to the graph's logger")
+	}
+	if runID == "" || entry.fields["run_id"] != runID {
+		t.Errorf("run_id = %v, want the run's ID %q", entry.fields["run_id"], runID)
+	}
+	if entry.fields["node"] != "second" || entry.fields["step"] != 1 || entry.fields["n"] != 1 {
+		t.Errorf("fields = %v, want the node, step and the node's own fields", entry.fields)
+	}
+}
+
+func TestLoggerFromContextOutsideRun(t *testing.T) {
+	// Logging outside of a run must not panic
+	core.LoggerFromContext(context.Background()).Info("nothing to see", "k", "v")
+
+	logger := newRecordingLogger()
+	ctx := core.WithLogger(context.Background(), logger.With("request_id", "req-1"))
+	core.LoggerFromContext(ctx).Warn("attached")
+	if entry, ok := logger.find("attached"); !ok || entry.fields["request_id"] != "req-1" {
+		t.Errorf("entry = %+v, want the attached logger's fields", entry)
+	}
+}
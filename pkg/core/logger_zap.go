@@ -0,0 +1,36 @@
+//go:build !nozap
+
+package core
+
+import "go.uber.org/zap"
+
+// zapLogger adapts a zap logger to Logger
+type zapLogger struct {
+	sugar *zap.SugaredLogger
+}
+
+// NewZapLogger creates a Logger that writes to a zap logger. Entries report
+// the caller of the Logger method, not the adapter.
+func NewZapLogger(logger *zap.Logger) Logger {
+	return &zapLogger{sugar: logger.WithOptions(zap.AddCallerSkip(1)).Sugar()}
+}
+
+func (l *zapLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.sugar.Debugw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.sugar.Infow(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.sugar.Warnw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.sugar.Errorw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) With(keysAndValues ...interface{}) Logger {
+	return &zapLogger{sugar: l.sugar.With(keysAndValues...)}
+}
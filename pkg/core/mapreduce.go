@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MapReduceConfig configures a map-reduce node
+type MapReduceConfig struct {
+	// Concurrency bounds how many items are mapped at once. Zero or less
+	// maps all items at once.
+	Concurrency int
+
+	// OnItemError decides what a failed item does to the node. Returning nil
+	// skips the item, so its partial is left out of the reduce; returning an
+	// error fails the node with it. Nil fails the node on the first error.
+	OnItemError func(index int, err error) error
+}
+
+// MapReduceOption configures a map-reduce node
+type MapReduceOption func(*MapReduceConfig)
+
+// WithMapConcurrency bounds how many items are mapped at once
+func WithMapConcurrency(n int) MapReduceOption {
+	return func(c *MapReduceConfig) {
+		c.Concurrency = n
+	}
+}
+
+// WithItemErrorHandler sets how failed items are handled
+func WithItemErrorHandler(handler func(index int, err error) error) MapReduceOption {
+	return func(c *MapReduceConfig) {
+		c.OnItemError = handler
+	}
+}
+
+// SkipFailedItems leaves failed items out of the reduce
+func SkipFailedItems(index int, err error) error {
+	return nil
+}
+
+// MapReduce returns a node function for the "process each item, then
+// combine" pattern. The node maps every item of the state in parallel and
+// passes the partials, in item order, to reduceFn along with the state.
+//
+// The engine runs one node per step, so the fan-out happens inside the node
+// rather than as Send branches. Once an item fails the node, items that
+// haven't started are not mapped and the context of running ones is
+// cancelled.
+func MapReduce[T, Item, Partial any](
+	items func(T) []Item,
+	mapFn func(ctx context.Context, item Item) (Partial, error),
+	reduceFn func(T, []Partial) T,
+	opts ...MapReduceOption,
+) func(ctx context.Context, state T) (T, error) {
+	var config MapReduceConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	node := func(ctx context.Context, state T) (T, error) {
+		list := items(state)
+		workers := config.Concurrency
+		if workers <= 0 || workers > len(list) {
+			workers = len(list)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		partials := make([]Partial, len(list))
+		ok := make([]bool, len(list))
+		indexes := make(chan int)
+
+		var mu sync.Mutex
+		var failure error
+		fail := func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if failure == nil {
+				failure = err
+				cancel()
+			}
+		}
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexes {
+					partial, err := mapFn(ctx, list[i])
+					if err != nil {
+						err = fmt.Errorf("map item %d: %w", i, err)
+						if config.OnItemError != nil {
+							err = config.OnItemError(i, err)
+						}
+						if err != nil {
+							fail(err)
+						}
+						continue
+					}
+					partials[i] = partial
+					ok[i] = true
+				}
+			}()
+		}
+
+	feed:
+		for i := range list {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		close(indexes)
+		wg.Wait()
+
+		if failure != nil {
+			var zero T
+			return zero, failure
+		}
+		if err := ctx.Err(); err != nil {
+			var zero T
+			return zero, err
+		}
+
+		results := make([]Partial, 0, len(list))
+		for i, partial := range partials {
+			if ok[i] {
+				results = append(results, partial)
+			}
+		}
+		return reduceFn(state, results), nil
+	}
+	DescribeNodeFunc(node, "Processes every item in parallel, then combines the results")
+	return node
+}
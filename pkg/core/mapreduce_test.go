@@ -0,0 +1,91 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+type numbers struct {
+	Items []int
+	Sum   int
+}
+
+// sumOfSquares maps numbers to their squares and reduces them to their sum
+func sumOfSquares(square func(ctx context.Context, n int) (int, error), opts ...core.MapReduceOption) func(ctx context.Context, s numbers) (numbers, error) {
+	return core.MapReduce(
+		func(s numbers) []int { return s.Items },
+		square,
+		func(s numbers, squares []int) numbers {
+			s.Sum = 0
+			for _, sq := range squares {
+				s.Sum += sq
+			}
+			return s
+		},
+		opts...,
+	)
+}
+
+func TestMapReduceSumsSquares(t *testing.T) {
+	var running, peak atomic.Int32
+	square := func(ctx context.Context, n int) (int, error) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return n * n, nil
+	}
+
+	g := newGraph[numbers]()
+	g.AddNode("squares", sumOfSquares(square, core.WithMapConcurrency(2)))
+	chain(g, "squares")
+	out, err := compile(t, g).Invoke(context.Background(), numbers{Items: []int{1, 2, 3, 4, 5}})
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if out.Sum != 55 {
+		t.Errorf("sum = %d, want 55", out.Sum)
+	}
+	if peak.Load() > 2 {
+		t.Errorf("%d items mapped at once, want at most 2", peak.Load())
+	}
+}
+
+func TestMapReduceItemErrors(t *testing.T) {
+	boom := errors.New("boom")
+	square := func(ctx context.Context, n int) (int, error) {
+		if n == 3 {
+			return 0, boom
+		}
+		return n * n, nil
+	}
+	input := numbers{Items: []int{1, 2, 3, 4}}
+
+	skipped, err := sumOfSquares(square, core.WithItemErrorHandler(core.SkipFailedItems))(context.Background(), input)
+	if err != nil || skipped.Sum != 21 {
+		t.Errorf("skipping failed items = %d, %v, want 21", skipped.Sum, err)
+	}
+
+	if _, err := sumOfSquares(square)(context.Background(), input); !errors.Is(err, boom) {
+		t.Errorf("failing fast = %v, want boom", err)
+	}
+
+	var failed []int
+	_, err = sumOfSquares(square, core.WithItemErrorHandler(func(index int, err error) error {
+		failed = append(failed, index)
+		return err
+	}))(context.Background(), input)
+	if !errors.Is(err, boom) || len(failed) != 1 || failed[0] != 2 {
+		t.Errorf("handler saw items %v and failed with %v, want item 2 and boom", failed, err)
+	}
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StepProfile records the resources used by a single node execution
+type StepProfile struct {
+	// Step is the step number of the execution
+	Step int `json:"step"`
+
+	// Node is the name of the node
+	Node string `json:"node"`
+
+	// Wall is the elapsed time of the node
+	Wall time.Duration `json:"wall"`
+
+	// CPU is the process CPU time used while the node ran. Nodes running
+	// concurrently, such as speculative branches, are charged for each other.
+	CPU time.Duration `json:"cpu"`
+
+	// AllocBytes is the number of heap bytes allocated while the node ran,
+	// only recorded when allocation sampling is enabled
+	AllocBytes uint64 `json:"alloc_bytes,omitempty"`
+
+	// AllocObjects is the number of heap objects allocated while the node ran,
+	// only recorded when allocation sampling is enabled
+	AllocObjects uint64 `json:"alloc_objects,omitempty"`
+}
+
+// Profiler records per-node resource usage for a run.
+// Pass one in InvokeConfig.Profiler and read the steps once the run finishes.
+type Profiler struct {
+	sampleAllocs bool
+
+	mu    sync.Mutex
+	steps []StepProfile
+}
+
+// NewProfiler creates a profiler. Allocation sampling reads runtime metrics
+// before and after every node, which adds some overhead to each step.
+func NewProfiler(sampleAllocs bool) *Profiler {
+	return &Profiler{sampleAllocs: sampleAllocs}
+}
+
+// Steps returns the recorded step profiles in the order the nodes finished
+func (p *Profiler) Steps() []StepProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]StepProfile(nil), p.steps...)
+}
+
+func (p *Profiler) record(step StepProfile) {
+	p.mu.Lock()
+	p.steps = append(p.steps, step)
+	p.mu.Unlock()
+}
+
+// allocMetrics are the runtime metrics sampled for allocations
+var allocMetrics = []string{"/gc/heap/allocs:bytes", "/gc/heap/allocs:objects"}
+
+// readAllocs returns the cumulative heap allocation counters
+func readAllocs() (uint64, uint64) {
+	samples := []metrics.Sample{{Name: allocMetrics[0]}, {Name: allocMetrics[1]}}
+	metrics.Read(samples)
+
+	var bytes, objects uint64
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		bytes = samples[0].Value.Uint64()
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		objects = samples[1].Value.Uint64()
+	}
+	return bytes, objects
+}
+
+// runNode runs a node function under pprof labels naming the node and graph,
+// so CPU profiles can be broken down per node, and records its resource
+// usage when the run has a profiler
+func (r *RunnableState[T]) runNode(ctx context.Context, profiler *Profiler, step int, node StateNode[T], state T) (T, error) {
+	var result T
+	var err error
+	if err := r.graph.initNode(ctx, node.Name); err != nil {
+		return result, err
+	}
+	fn := node.Function
+	if scope, ok := r.scopes[node.Name]; ok {
+		fn = wrapScope(scope, r.graph.scopeMode, fn)
+	}
+	ctx = withNode(ctx, node.Name, step)
+	ctx = WithLogger(ctx, LoggerFromContext(ctx).With("node", node.Name, "step", step))
+	run := func(ctx context.Context) {
+		parent := ctx
+		timeout, hasTimeout := r.graph.nodeTimeout(node.Name)
+		if hasTimeout {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		start := time.Now()
+		defer func() {
+			switch {
+			case err == nil:
+				r.graph.observeLatency(node.Name, time.Since(start))
+			case hasTimeout && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+				// The execution would have taken at least the timeout
+				r.graph.observeLatency(node.Name, timeout)
+			}
+		}()
+
+		policy, ok := r.graph.retryPolicies[node.Name]
+		if !ok {
+			result, err = fn(ctx, state)
+			return
+		}
+		err = Retry(ctx, policy, func(ctx context.Context) error {
+			var attemptErr error
+			result, attemptErr = fn(ctx, state)
+			return attemptErr
+		})
+	}
+	labels := pprof.Labels("moego_node", node.Name, "moego_graph", r.graph.name)
+
+	var tokens atomic.Int64
+	if w, ok := ctx.Value(streamWriterKey{}).(streamWriter); ok {
+		ctx = withStreamWriter(ctx, &tokenCounter{streamWriter: w, tokens: &tokens})
+	}
+	stopHeartbeat := r.graph.streamer.startHeartbeat(ctx, node.Name, r.graph.streamConfig, &tokens)
+	defer stopHeartbeat()
+
+	if profiler == nil {
+		pprof.Do(ctx, labels, run)
+		return result, err
+	}
+
+	var allocBytes, allocObjects uint64
+	if profiler.sampleAllocs {
+		allocBytes, allocObjects = readAllocs()
+	}
+	cpu := processCPUTime()
+	start := time.Now()
+
+	pprof.Do(ctx, labels, run)
+
+	profile := StepProfile{
+		Step: step,
+		Node: node.Name,
+		Wall: time.Since(start),
+		CPU:  processCPUTime() - cpu,
+	}
+	if profiler.sampleAllocs {
+		bytes, objects := readAllocs()
+		profile.AllocBytes = bytes - allocBytes
+		profile.AllocObjects = objects - allocObjects
+	}
+	profiler.record(profile)
+
+	return result, err
+}
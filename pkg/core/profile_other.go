@@ -0,0 +1,10 @@
+//go:build !unix
+
+package core
+
+import "time"
+
+// processCPUTime is not supported on this platform and always returns zero
+func processCPUTime() time.Duration {
+	return 0
+}
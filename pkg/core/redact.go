@@ -0,0 +1,191 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// RedactedValue replaces redacted fields when the policy mode is RedactReplace
+const RedactedValue = "[REDACTED]"
+
+// RedactionMode controls what a redacted field is replaced with
+type RedactionMode int
+
+const (
+	// RedactReplace replaces the value with RedactedValue
+	RedactReplace RedactionMode = iota
+
+	// RedactHash replaces the value with a SHA-256 hash of its JSON encoding,
+	// so equal values can still be correlated
+	RedactHash
+)
+
+// RedactionPolicy controls which state fields are hidden whenever state is
+// serialized for a destination outside the graph, such as debug events,
+// interrupts delivered to clients or run state served over HTTP.
+// Struct fields tagged `moego:"redact"` are always redacted. Fields adds
+// more names, matched against JSON object keys at any depth, which is how
+// map based states are redacted.
+type RedactionPolicy struct {
+	// Mode controls what redacted fields are replaced with
+	Mode RedactionMode
+
+	// Fields are additional JSON field names to redact
+	Fields []string
+}
+
+// RedactJSON serializes v to JSON with the fields selected by the policy
+// redacted. A nil policy serializes v unchanged.
+func RedactJSON(v interface{}, policy *RedactionPolicy) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return redactData(v, data, policy)
+}
+
+// redactData redacts data, the JSON encoding of v
+func redactData(v interface{}, data []byte, policy *RedactionPolicy) ([]byte, error) {
+	if policy == nil {
+		return data, nil
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]struct{}, len(policy.Fields))
+	for _, f := range policy.Fields {
+		fields[f] = struct{}{}
+	}
+	r := redactor{policy: policy, fields: fields}
+	return json.Marshal(r.redact(reflect.ValueOf(v), generic))
+}
+
+// redactor walks a Go value alongside its decoded JSON form, so that struct
+// tags can be honored while rewriting the JSON
+type redactor struct {
+	policy *RedactionPolicy
+	fields map[string]struct{}
+}
+
+func (r *redactor) redact(rv reflect.Value, generic interface{}) interface{} {
+	for rv.IsValid() && (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) {
+		if rv.IsNil() {
+			return generic
+		}
+		rv = rv.Elem()
+	}
+
+	switch g := generic.(type) {
+	case map[string]interface{}:
+		if rv.IsValid() && rv.Kind() == reflect.Struct {
+			r.redactStruct(rv, g)
+			return g
+		}
+		for key, value := range g {
+			if _, ok := r.fields[key]; ok {
+				g[key] = r.replacement(value)
+				continue
+			}
+			var child reflect.Value
+			if rv.IsValid() && rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+				child = rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+			}
+			g[key] = r.redact(child, value)
+		}
+		return g
+
+	case []interface{}:
+		for i, value := range g {
+			var child reflect.Value
+			if rv.IsValid() && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && i < rv.Len() {
+				child = rv.Index(i)
+			}
+			g[i] = r.redact(child, value)
+		}
+		return g
+
+	default:
+		return generic
+	}
+}
+
+// redactStruct rewrites the JSON object of a struct value in place
+func (r *redactor) redactStruct(rv reflect.Value, g map[string]interface{}) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		// Untagged embedded structs are flattened into the parent object
+		if field.Anonymous && name == "" {
+			fv := rv.Field(i)
+			for fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				r.redactStruct(fv, g)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		value, ok := g[name]
+		if !ok {
+			continue
+		}
+		_, listed := r.fields[name]
+		if listed || hasRedactTag(field) {
+			g[name] = r.replacement(value)
+			continue
+		}
+		g[name] = r.redact(rv.Field(i), value)
+	}
+}
+
+// replacement returns what a redacted value is replaced with
+func (r *redactor) replacement(value interface{}) interface{} {
+	if r.policy.Mode != RedactHash {
+		return RedactedValue
+	}
+	data, _ := json.Marshal(value)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// jsonFieldName returns the JSON name of a struct field, empty if it uses the
+// Go field name, and whether the field is omitted from JSON
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+// hasRedactTag reports whether a struct field is tagged `moego:"redact"`
+func hasRedactTag(field reflect.StructField) bool {
+	for _, opt := range strings.Split(field.Tag.Get("moego"), ",") {
+		if strings.TrimSpace(opt) == "redact" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventNodeRestart is emitted when a running node is cancelled and restarted
+const EventNodeRestart EventType = "on_node_restart"
+
+// ErrRunNotRunning is returned when restarting a node of a run that isn't
+// in flight
+var ErrRunNotRunning = errors.New("run is not running")
+
+// RestartNode cancels the node the run with the given ID is currently
+// executing and runs it again from the given state, without ending the run.
+// It blocks until the run's node accepts the command or ctx is done. It is
+// meant for interactive UIs, for example when the user edits their question
+// while an answer is being generated.
+func (g *StateGraph[T]) RestartNode(ctx context.Context, runID string, state T) error {
+	restarts, ok := g.restarts.channel(runID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRunNotRunning, runID)
+	}
+	select {
+	case restarts <- state:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// restartRegistry holds the restart channel of every run in flight
+type restartRegistry[T any] struct {
+	mu   sync.Mutex
+	runs map[string]chan T
+}
+
+// register creates the restart channel of a run and returns the function
+// removing it once the run ends. A run that is already registered, such as
+// a graph invoking itself, keeps its channel.
+func (r *restartRegistry[T]) register(runID string) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.runs[runID]; ok {
+		return func() {}
+	}
+	if r.runs == nil {
+		r.runs = make(map[string]chan T)
+	}
+	r.runs[runID] = make(chan T)
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.runs, runID)
+	}
+}
+
+// channel returns the restart channel of a run
+func (r *restartRegistry[T]) channel(runID string) (chan T, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	restarts, ok := r.runs[runID]
+	return restarts, ok
+}
+
+// nodeResult is the outcome of a node execution
+type nodeResult[T any] struct {
+	state T
+	err   error
+}
+
+// runRestartable runs a node, restarting it whenever RestartNode is called
+// while it executes
+func (r *RunnableState[T]) runRestartable(ctx context.Context, profiler *Profiler, step int, node StateNode[T], state T) (T, error) {
+	commands, _ := r.graph.restarts.channel(RunIDFromContext(ctx))
+	for restarts := 0; ; restarts++ {
+		nodeCtx, cancel := context.WithCancel(ctx)
+		done := make(chan nodeResult[T], 1)
+		go func(input T) {
+			result, err := r.runNode(nodeCtx, profiler, step, node, input)
+			done <- nodeResult[T]{state: result, err: err}
+		}(state)
+
+		select {
+		case res := <-done:
+			cancel()
+			return res.state, res.err
+
+		case state = <-commands:
+			cancel()
+			<-done
+
+			EmitEvent(ctx, Event{
+				Type:      EventNodeRestart,
+				Name:      node.Name,
+				RunID:     RunIDFromContext(ctx),
+				Timestamp: time.Now(),
+				Metadata: map[string]interface{}{
+					"langgraph_step": step,
+					"langgraph_node": node.Name,
+					"restart":        restarts + 1,
+				},
+				Data: r.debugPayload(ctx, state),
+			})
+		}
+	}
+}
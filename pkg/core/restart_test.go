@@ -0,0 +1,67 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func TestRestartNodeOnlyRestartsItsRun(t *testing.T) {
+	started := make(chan string, 4)
+	g := newGraph[string]()
+	g.AddNode("answer", func(ctx context.Context, question string) (string, error) {
+		started <- question
+		if question == "edited" {
+			return "answer to " + question, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+			return "answer to " + question, nil
+		}
+	})
+	chain(g, "answer")
+	r := compile(t, g)
+
+	results := make(map[string]chan string)
+	for _, id := range []string{"run-a", "run-b"} {
+		results[id] = make(chan string, 1)
+		go func(id string) {
+			out, err := r.InvokeWithConfig(context.Background(), "original "+id, core.InvokeConfig{RunID: id})
+			if err != nil {
+				t.Errorf("run %s: %v", id, err)
+			}
+			results[id] <- out
+		}(id)
+	}
+	<-started
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := g.RestartNode(ctx, "run-b", "edited"); err != nil {
+		t.Fatalf("RestartNode: %v", err)
+	}
+
+	if out := <-results["run-b"]; out != "answer to edited" {
+		t.Errorf("restarted run answered %q", out)
+	}
+	if out := <-results["run-a"]; out != "answer to original run-a" {
+		t.Errorf("other run answered %q, it was restarted too", out)
+	}
+}
+
+func TestRestartNodeOfUnknownRun(t *testing.T) {
+	g := newGraph[string]()
+	g.AddNode("answer", func(ctx context.Context, s string) (string, error) { return s, nil })
+	chain(g, "answer")
+	compile(t, g)
+
+	if err := g.RestartNode(context.Background(), "run-x", "edited"); !errors.Is(err, core.ErrRunNotRunning) {
+		t.Fatalf("RestartNode of a run that isn't running = %v, want ErrRunNotRunning", err)
+	}
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Jitter randomizes a computed backoff delay so that many callers failing at
+// the same moment don't all retry at the same moment
+type Jitter func(backoff time.Duration) time.Duration
+
+// Built-in jitter strategies
+var (
+	// FullJitter picks a delay uniformly between zero and the backoff
+	FullJitter Jitter = func(backoff time.Duration) time.Duration {
+		if backoff <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int64N(int64(backoff) + 1))
+	}
+
+	// EqualJitter keeps half the backoff and randomizes the other half
+	EqualJitter Jitter = func(backoff time.Duration) time.Duration {
+		if backoff <= 0 {
+			return 0
+		}
+		half := backoff / 2
+		return half + time.Duration(rand.Int64N(int64(backoff-half)+1))
+	}
+
+	// NoJitter uses the backoff unchanged
+	NoJitter Jitter = func(backoff time.Duration) time.Duration {
+		return backoff
+	}
+)
+
+// RetryPolicy controls how failed node executions and model calls are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 1 mean a single attempt.
+	MaxAttempts int
+
+	// InitialInterval is the backoff before the first retry
+	InitialInterval time.Duration
+
+	// MaxInterval caps the backoff. Zero means no cap.
+	MaxInterval time.Duration
+
+	// Multiplier grows the backoff after every retry. Values below 1 mean 2.
+	Multiplier float64
+
+	// Jitter randomizes each backoff. Nil means FullJitter.
+	Jitter Jitter
+
+	// RetryOn reports whether an error should be retried. Nil retries every
+	// error except context cancellation, interrupts and errors marked NoRetry.
+	RetryOn func(error) bool
+}
+
+// DefaultRetryPolicy returns a policy with three attempts and full jitter
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+		Jitter:          FullJitter,
+	}
+}
+
+// Backoff returns the delay before the given retry, counting from 1
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	backoff := float64(p.InitialInterval)
+	for i := 1; i < retry; i++ {
+		backoff *= multiplier
+		if p.MaxInterval > 0 && backoff >= float64(p.MaxInterval) {
+			break
+		}
+	}
+	delay := time.Duration(backoff)
+	if p.MaxInterval > 0 && delay > p.MaxInterval {
+		delay = p.MaxInterval
+	}
+
+	jitter := p.Jitter
+	if jitter == nil {
+		jitter = FullJitter
+	}
+	return jitter(delay)
+}
+
+// noRetryError marks an error that must not be retried
+type noRetryError struct {
+	err error
+}
+
+func (e *noRetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *noRetryError) Unwrap() error {
+	return e.err
+}
+
+// NoRetry marks err so that Retry returns it without further attempts
+func NoRetry(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &noRetryError{err: err}
+}
+
+// shouldRetry reports whether the policy retries err
+func (p RetryPolicy) shouldRetry(err error) bool {
+	var noRetry *noRetryError
+	if errors.As(err, &noRetry) || IsInterruptError(err) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if p.RetryOn != nil {
+		return p.RetryOn(err)
+	}
+	return true
+}
+
+// Retry calls fn until it succeeds, the policy gives up or ctx is done.
+// The last error is returned.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= policy.MaxAttempts || !policy.shouldRetry(err) {
+			if noRetry, ok := err.(*noRetryError); ok {
+				return noRetry.err
+			}
+			return err
+		}
+
+		timer := time.NewTimer(policy.Backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
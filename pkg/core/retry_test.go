@@ -0,0 +1,59 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func TestJitterSpreadsDelaysWithinBounds(t *testing.T) {
+	const samples = 1000
+	policy := core.RetryPolicy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}
+	// The third retry backs off 400ms before jitter
+	const retry, backoff = 3, 400 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		jitter   core.Jitter
+		min, max time.Duration
+	}{
+		{"full", core.FullJitter, 0, backoff},
+		{"equal", core.EqualJitter, backoff / 2, backoff},
+		{"default", nil, 0, backoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy.Jitter = tt.jitter
+			distinct := make(map[time.Duration]bool)
+			var lowHalf int
+			for i := 0; i < samples; i++ {
+				d := policy.Backoff(retry)
+				if d < tt.min || d > tt.max {
+					t.Fatalf("delay %s outside [%s, %s]", d, tt.min, tt.max)
+				}
+				distinct[d] = true
+				if d < tt.min+(tt.max-tt.min)/2 {
+					lowHalf++
+				}
+			}
+			if len(distinct) < samples/2 {
+				t.Errorf("%d distinct delays in %d samples, want them spread out", len(distinct), samples)
+			}
+			// Uniform delays fall in the lower half of the range about half
+			// of the time
+			if lowHalf < samples/4 || lowHalf > samples*3/4 {
+				t.Errorf("%d of %d delays in the lower half of the range, want about half", lowHalf, samples)
+			}
+		})
+	}
+}
+
+func TestNoJitterKeepsBackoff(t *testing.T) {
+	policy := core.RetryPolicy{InitialInterval: 100 * time.Millisecond, MaxInterval: 300 * time.Millisecond, Multiplier: 2, Jitter: core.NoJitter}
+	for retry, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 4: 300 * time.Millisecond} {
+		if got := policy.Backoff(retry); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", retry, got, want)
+		}
+	}
+}
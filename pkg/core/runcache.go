@@ -0,0 +1,182 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Cache stores values that expire
+type Cache interface {
+	// Get returns the value stored under key and whether it exists and
+	// hasn't expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set stores value under key for ttl. A ttl of zero or less never
+	// expires.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// cacheEntry is a value of a MemoryCache
+type cacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// MemoryCache is an in-process Cache. Expired entries are removed when they
+// are read.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewMemoryCache creates an empty in-memory cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]cacheEntry)}
+}
+
+// Get returns the value stored under key
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+// Set stores value under key for ttl
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := cacheEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+	return nil
+}
+
+// runCache memoizes the final states of whole runs
+type runCache[T any] struct {
+	cache Cache
+	key   func(T) (string, error)
+	ttl   time.Duration
+
+	// namespace prefixes the keys of the graph's runs
+	namespace string
+}
+
+// cachedRun is the cache entry of a run
+type cachedRun struct {
+	Codec string          `json:"codec"`
+	State json.RawMessage `json:"state"`
+}
+
+// WithRunCache returns a copy of the runnable that memoizes the final states
+// of runs in cache for ttl, keyed by keyFunc applied to the input state. A
+// hit returns the cached state without running the graph and publishes a
+// run_completed lifecycle event flagged Cached. Only successful runs that
+// were never interrupted are cached, and input failing the graph's input
+// schema is never looked up. A nil keyFunc hashes the whole input; use
+// HashFields to leave out volatile fields such as timestamps.
+//
+// Keys are namespaced by the graph's name and a hash of its nodes and
+// edges, so graphs sharing a cache don't answer each other's runs. Graphs
+// with the same name and structure but different node functions do share
+// entries; give them distinct names with SetName.
+func (r *RunnableState[T]) WithRunCache(cache Cache, keyFunc func(T) (string, error), ttl time.Duration) *RunnableState[T] {
+	if keyFunc == nil {
+		keyFunc = HashFields[T]()
+	}
+	c := *r
+	c.runCache = &runCache[T]{cache: cache, key: keyFunc, ttl: ttl, namespace: r.graph.runCacheNamespace()}
+	return &c
+}
+
+// runCacheNamespace returns the prefix of the graph's run cache keys. The
+// name alone defaults to the same value for every graph, so the structure
+// is hashed in too; it is stable across processes sharing a cache.
+func (g *StateGraph[T]) runCacheNamespace() string {
+	// The structure holds only strings, which always encode
+	hash, _ := CanonicalHash(g.Structure())
+	return "run:" + g.name + ":" + hash + ":"
+}
+
+// HashFields returns a run cache key function that hashes the fields of the
+// state with the given JSON names with CanonicalHash. Without names the
+// whole state is hashed.
+func HashFields[T any](fields ...string) func(T) (string, error) {
+	return func(state T) (string, error) {
+		if len(fields) == 0 {
+			return CanonicalHash(state)
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			return "", err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return "", err
+		}
+		selected := make(map[string]json.RawMessage, len(fields))
+		for _, name := range fields {
+			selected[name] = all[name]
+		}
+		return CanonicalHash(selected)
+	}
+}
+
+// cacheKey returns the cache key of a run, or false when the state can't be
+// keyed
+func (r *RunnableState[T]) cacheKey(ctx context.Context, state T) (string, bool) {
+	key, err := r.runCache.key(state)
+	if err != nil {
+		LoggerFromContext(ctx).Warn("Failed to compute run cache key, running uncached", "error", err)
+		return "", false
+	}
+	return r.runCache.namespace + key, true
+}
+
+// cachedResult returns the cached final state of a run
+func (r *RunnableState[T]) cachedResult(ctx context.Context, key string) (T, bool) {
+	var zero T
+	data, found, err := r.runCache.cache.Get(ctx, key)
+	if err != nil {
+		LoggerFromContext(ctx).Warn("Failed to read run cache", "key", key, "error", err)
+		return zero, false
+	}
+	if !found {
+		return zero, false
+	}
+	var entry cachedRun
+	if err := json.Unmarshal(data, &entry); err != nil || CheckCodec(r.graph.codec, entry.Codec) != nil {
+		return zero, false
+	}
+	result, err := DecodeState(r.graph.codec, entry.State)
+	if err != nil {
+		return zero, false
+	}
+	return result, true
+}
+
+// cacheResult stores the final state of a run
+func (r *RunnableState[T]) cacheResult(ctx context.Context, key string, result T) {
+	state, err := EncodeState(r.graph.codec, result)
+	if err == nil {
+		var data []byte
+		data, err = json.Marshal(cachedRun{Codec: r.graph.codec.Name(), State: state})
+		if err == nil {
+			err = r.runCache.cache.Set(ctx, key, data, r.runCache.ttl)
+		}
+	}
+	if err != nil {
+		LoggerFromContext(ctx).Warn("Failed to write run cache", "key", key, "error", err)
+	}
+}
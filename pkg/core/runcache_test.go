@@ -0,0 +1,166 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// countingGraph compiles a graph of one node that sets the ticket's status
+// and counts its runs. The node fails while fail is set.
+func countingGraph(t *testing.T, runs *int, fail *bool) *core.RunnableState[ticket] {
+	t.Helper()
+	g := newGraph[ticket]()
+	g.AddNode("triage", func(ctx context.Context, s ticket) (ticket, error) {
+		*runs++
+		if fail != nil && *fail {
+			return s, errors.New("triage failed")
+		}
+		s.Status = "open"
+		return s, nil
+	})
+	chain(g, "triage")
+	return compile(t, g)
+}
+
+// completions subscribes to the run_completed events of a fresh bus
+func completions(t *testing.T) (context.Context, <-chan core.LifecycleEvent) {
+	t.Helper()
+	bus := core.NewLifecycleBus(0)
+	events, cancel := bus.Subscribe(core.EventFilter{Types: []core.LifecycleEventType{core.LifecycleRunCompleted}})
+	t.Cleanup(cancel)
+	return core.WithLifecycleBus(context.Background(), bus), events
+}
+
+func TestRunCacheHitAndMiss(t *testing.T) {
+	runs := 0
+	r := countingGraph(t, &runs, nil).WithRunCache(core.NewMemoryCache(), nil, time.Minute)
+	ctx, events := completions(t)
+
+	for i, input := range []ticket{{Title: "a"}, {Title: "a"}, {Title: "b"}} {
+		out, err := r.Invoke(ctx, input)
+		if err != nil {
+			t.Fatalf("Invoke %d: %v", i, err)
+		}
+		if out.Title != input.Title || out.Status != "open" {
+			t.Errorf("Invoke %d = %+v, want %s opened", i, out, input.Title)
+		}
+	}
+	if runs != 2 {
+		t.Errorf("node runs = %d, want 2 with the repeated input served from the cache", runs)
+	}
+
+	var cached []bool
+	for len(cached) < 3 {
+		cached = append(cached, (<-events).Cached)
+	}
+	if cached[0] || !cached[1] || cached[2] {
+		t.Errorf("run_completed cached flags = %v, want only the repeated run flagged", cached)
+	}
+}
+
+func TestRunCacheSkipsFailedRuns(t *testing.T) {
+	runs, fail := 0, true
+	r := countingGraph(t, &runs, &fail).WithRunCache(core.NewMemoryCache(), nil, time.Minute)
+
+	if _, err := r.Invoke(context.Background(), ticket{Title: "a"}); err == nil {
+		t.Fatal("Invoke with a failing node succeeded")
+	}
+	fail = false
+	out, err := r.Invoke(context.Background(), ticket{Title: "a"})
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if runs != 2 || out.Status != "open" {
+		t.Errorf("node runs = %d and result %+v, want the failed run not cached", runs, out)
+	}
+}
+
+func TestRunCacheSkipsInterruptedRuns(t *testing.T) {
+	runs := 0
+	g := newGraph[ticket]()
+	g.AddNode("review", func(ctx context.Context, s ticket) (ticket, error) {
+		runs++
+		return s, nil
+	})
+	chain(g, "review")
+	g.AddBreakpoint("review")
+	r := compile(t, g).WithRunCache(core.NewMemoryCache(), nil, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		done := make(chan error, 1)
+		go func() {
+			_, err := r.Invoke(context.Background(), ticket{Title: "a"})
+			done <- err
+		}()
+		select {
+		case <-g.GetInterruptChannel():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("run %d didn't pause at the breakpoint, served from the cache", i)
+		}
+		if err := g.Resume(ticket{Title: "a", Status: "approved"}); err != nil {
+			t.Fatalf("Resume: %v", err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("Invoke %d: %v", i, err)
+		}
+	}
+	if runs != 2 {
+		t.Errorf("node runs = %d, want 2", runs)
+	}
+}
+
+func TestRunCacheKeepsGraphsApart(t *testing.T) {
+	cache := core.NewMemoryCache()
+	build := func(node, status string) *core.RunnableState[ticket] {
+		g := newGraph[ticket]()
+		g.AddNode(node, func(ctx context.Context, s ticket) (ticket, error) {
+			s.Status = status
+			return s, nil
+		})
+		chain(g, node)
+		return compile(t, g).WithRunCache(cache, nil, time.Minute)
+	}
+	triage, review := build("triage", "open"), build("review", "approved")
+
+	// Both graphs have the default name
+	for _, run := range []struct {
+		r    *core.RunnableState[ticket]
+		want string
+	}{{triage, "open"}, {review, "approved"}} {
+		out, err := run.r.Invoke(context.Background(), ticket{Title: "a"})
+		if err != nil {
+			t.Fatalf("Invoke: %v", err)
+		}
+		if out.Status != run.want {
+			t.Errorf("status = %q, want %q from the graph's own run", out.Status, run.want)
+		}
+	}
+}
+
+func TestRunCacheValidatesInputFirst(t *testing.T) {
+	runs := 0
+	g := newGraph[map[string]interface{}]()
+	g.SetInputSchema(ticketSchema)
+	g.AddNode("triage", func(ctx context.Context, s map[string]interface{}) (map[string]interface{}, error) {
+		runs++
+		return s, nil
+	})
+	chain(g, "triage")
+	r := compile(t, g).WithRunCache(core.NewMemoryCache(), core.HashFields[map[string]interface{}]("title"), time.Minute)
+
+	if _, err := r.Invoke(context.Background(), map[string]interface{}{"title": "a"}); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	// The key only covers the title, the invalid priority must still fail
+	_, err := r.Invoke(context.Background(), map[string]interface{}{"title": "a", "priority": "high"})
+	if !errors.Is(err, core.ErrInvalidInput) {
+		t.Errorf("Invoke with an invalid priority = %v, want ErrInvalidInput", err)
+	}
+	if runs != 1 {
+		t.Errorf("node runs = %d, want 1", runs)
+	}
+}
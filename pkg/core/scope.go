@@ -0,0 +1,231 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrInvalidScope is returned by Compile when a node declares state
+	// fields that don't exist or the state isn't a struct
+	ErrInvalidScope = errors.New("invalid state scope")
+
+	// ErrUndeclaredWrite is returned when a node changes state fields it
+	// didn't declare in NodeOptions.Writes
+	ErrUndeclaredWrite = errors.New("node wrote undeclared state fields")
+)
+
+// ScopeMode is how writes to undeclared state fields are handled
+type ScopeMode string
+
+const (
+	// ScopeEnforce fails the node with ErrUndeclaredWrite
+	ScopeEnforce ScopeMode = "enforce"
+
+	// ScopeWarn logs the write and drops it
+	ScopeWarn ScopeMode = "warn"
+)
+
+// SetScopeMode sets how writes to undeclared state fields are handled. The
+// default is ScopeEnforce.
+func (g *StateGraph[T]) SetScopeMode(mode ScopeMode) {
+	g.scopeMode = mode
+}
+
+// stateScope restricts a node to the state fields it declared
+type stateScope struct {
+	node string
+
+	// fields are the exported fields of the state struct
+	fields []scopeField
+
+	// reads and writes report whether the node declared them at all
+	reads, writes bool
+}
+
+// scopeField is a state field and what the node may do with it
+type scopeField struct {
+	name  string
+	index int
+	read  bool
+	write bool
+}
+
+// stateFields returns the exported fields of a struct state, or of the
+// struct a pointer state points to, by JSON name
+func stateFields(t reflect.Type) (map[string]int, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: state %s is not a struct", ErrInvalidScope, t)
+	}
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		fields[name] = i
+	}
+	return fields, nil
+}
+
+// stateScopes builds the scopes of the nodes that declare reads or writes
+func (g *StateGraph[T]) stateScopes() (map[string]*stateScope, error) {
+	var scopes map[string]*stateScope
+	var fields map[string]int
+
+	names := make([]string, 0, len(g.nodeOptions))
+	for name := range g.nodeOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		opts := g.nodeOptions[name]
+		if opts.Reads == nil && opts.Writes == nil {
+			continue
+		}
+		if fields == nil {
+			var err error
+			if fields, err = stateFields(reflect.TypeOf((*T)(nil)).Elem()); err != nil {
+				return nil, err
+			}
+		}
+
+		scope := &stateScope{
+			node:   name,
+			fields: make([]scopeField, 0, len(fields)),
+			reads:  opts.Reads != nil,
+			writes: opts.Writes != nil,
+		}
+		byIndex := make(map[int]*scopeField, len(fields))
+		for fieldName, index := range fields {
+			f := scopeField{name: fieldName, index: index, read: !scope.reads, write: !scope.writes}
+			scope.fields = append(scope.fields, f)
+			byIndex[index] = &scope.fields[len(scope.fields)-1]
+		}
+		for _, fieldName := range opts.Reads {
+			index, ok := fields[fieldName]
+			if !ok {
+				return nil, fmt.Errorf("%w: node %s reads unknown field %q", ErrInvalidScope, name, fieldName)
+			}
+			byIndex[index].read = true
+		}
+		for _, fieldName := range opts.Writes {
+			index, ok := fields[fieldName]
+			if !ok {
+				return nil, fmt.Errorf("%w: node %s writes unknown field %q", ErrInvalidScope, name, fieldName)
+			}
+			byIndex[index].write = true
+		}
+		sort.Slice(scope.fields, func(i, j int) bool { return scope.fields[i].index < scope.fields[j].index })
+
+		if scopes == nil {
+			scopes = make(map[string]*stateScope)
+		}
+		scopes[name] = scope
+	}
+	return scopes, nil
+}
+
+// copyState returns a shallow copy of a struct state, or a pointer to a
+// shallow copy of the struct a pointer state points to. It reports false
+// for nil pointers.
+func copyState[T any](state T) (T, bool) {
+	v := reflect.ValueOf(&state).Elem()
+	if v.Kind() != reflect.Pointer {
+		return state, true
+	}
+	if v.IsNil() {
+		return state, false
+	}
+	p := reflect.New(v.Type().Elem())
+	p.Elem().Set(v.Elem())
+	return p.Interface().(T), true
+}
+
+// wrapScope returns fn restricted to the scope: the node sees only the
+// fields it reads, and only changes to the fields it writes are kept. Fields
+// are compared by value, so changes made in place to maps and slices the
+// state shares with its copy aren't seen.
+func wrapScope[T any](scope *stateScope, mode ScopeMode, fn func(ctx context.Context, state T) (T, error)) func(ctx context.Context, state T) (T, error) {
+	return func(ctx context.Context, state T) (T, error) {
+		view, ok := copyState(state)
+		if !ok {
+			return fn(ctx, state)
+		}
+		if scope.reads {
+			viewValue := structValue(&view)
+			for _, f := range scope.fields {
+				if !f.read {
+					field := viewValue.Field(f.index)
+					field.Set(reflect.Zero(field.Type()))
+				}
+			}
+		}
+		// Keep what the node was given, since it may change a pointer
+		// state in place
+		given, _ := copyState(view)
+
+		out, err := fn(ctx, view)
+		if err != nil {
+			return out, err
+		}
+		result, ok := copyState(out)
+		if !ok {
+			return out, nil
+		}
+
+		resultValue := structValue(&result)
+		givenValue := structValue(&given)
+		stateValue := structValue(&state)
+		var undeclared []string
+		for _, f := range scope.fields {
+			changed := !reflect.DeepEqual(resultValue.Field(f.index).Interface(), givenValue.Field(f.index).Interface())
+			if changed && f.write {
+				continue
+			}
+			if changed {
+				undeclared = append(undeclared, f.name)
+			}
+			resultValue.Field(f.index).Set(stateValue.Field(f.index))
+		}
+		if len(undeclared) == 0 {
+			return result, nil
+		}
+
+		if mode == ScopeWarn {
+			LoggerFromContext(ctx).Warn("Node wrote undeclared state fields, dropping the writes",
+				"node", scope.node,
+				"fields", undeclared)
+			return result, nil
+		}
+		var zero T
+		return zero, NoRetry(fmt.Errorf("%w: %s", ErrUndeclaredWrite, strings.Join(undeclared, ", ")))
+	}
+}
+
+// structValue returns the addressable struct of a struct or pointer state
+func structValue[T any](state *T) reflect.Value {
+	v := reflect.ValueOf(state).Elem()
+	if v.Kind() == reflect.Pointer {
+		return v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrSetup is returned when a graph's setup function fails
+	ErrSetup = errors.New("graph setup failed")
+)
+
+// SetupConfig configures the setup value of a graph
+type SetupConfig struct {
+	// TTL is how long a setup value is used before it is computed again.
+	// Zero keeps it for the lifetime of the compiled graph.
+	TTL time.Duration
+}
+
+// SetupOption configures the setup value of a graph
+type SetupOption func(*SetupConfig)
+
+// WithSetupTTL refreshes the setup value once it is older than ttl
+func WithSetupTTL(ttl time.Duration) SetupOption {
+	return func(c *SetupConfig) {
+		c.TTL = ttl
+	}
+}
+
+// graphSetup is the setup function of a graph
+type graphSetup struct {
+	fn     func(ctx context.Context) (interface{}, error)
+	config SetupConfig
+}
+
+// setupKey is the context key of a run's setup value
+type setupKey struct{}
+
+// SetSetup gives the graph a setup function producing a value shared by all
+// of its runs, such as embeddings of a static knowledge base or fetched
+// configuration. Each compiled graph computes it once, during Warmup or
+// before its first run, and nodes read it with SetupFromContext. A failed
+// setup fails the run with ErrSetup and is tried again by the next one.
+//
+// The value is shared between concurrent runs, so nodes must treat it as
+// read-only. It lives in the run's context rather than its state, so it is
+// never serialized, traced or checkpointed.
+//
+// With WithSetupTTL the value is refreshed in the background once it
+// expires: runs keep using the previous value until the new one is swapped
+// in, and a failed refresh keeps the previous value.
+func SetSetup[T, S any](g *StateGraph[T], fn func(ctx context.Context) (S, error), opts ...SetupOption) {
+	setup := &graphSetup{
+		fn: func(ctx context.Context) (interface{}, error) {
+			return fn(ctx)
+		},
+	}
+	for _, opt := range opts {
+		opt(&setup.config)
+	}
+	g.setup = setup
+}
+
+// SetupFromContext returns the setup value of the run, if the graph has one
+// of type S
+func SetupFromContext[S any](ctx context.Context) (S, bool) {
+	value, ok := ctx.Value(setupKey{}).(S)
+	return value, ok
+}
+
+// setupValue is a computed setup value
+type setupValue struct {
+	value    interface{}
+	computed time.Time
+}
+
+// setupCache holds the setup value of a compiled graph
+type setupCache struct {
+	setup *graphSetup
+
+	// mu serializes the first computation
+	mu      sync.Mutex
+	current atomic.Pointer[setupValue]
+
+	// refreshing is set while a background refresh runs
+	refreshing atomic.Bool
+}
+
+// get returns the setup value, computing it on first use and starting a
+// background refresh when it expired
+func (c *setupCache) get(ctx context.Context) (interface{}, error) {
+	if v := c.current.Load(); v != nil {
+		c.refreshIfExpired(ctx, v)
+		return v.value, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v := c.current.Load(); v != nil {
+		return v.value, nil
+	}
+	v, err := c.compute(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.current.Store(v)
+	return v.value, nil
+}
+
+// refreshIfExpired starts a background refresh of an expired value unless
+// one is already running
+func (c *setupCache) refreshIfExpired(ctx context.Context, v *setupValue) {
+	ttl := c.setup.config.TTL
+	if ttl <= 0 || time.Since(v.computed) < ttl || !c.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer c.refreshing.Store(false)
+		fresh, err := c.compute(ctx)
+		if err != nil {
+			LoggerFromContext(ctx).Warn("Setup refresh failed, keeping previous value", "error", err)
+			return
+		}
+		c.current.Store(fresh)
+		LoggerFromContext(ctx).Debug("Setup refreshed", "age", time.Since(v.computed))
+	}()
+}
+
+// compute calls the setup function
+func (c *setupCache) compute(ctx context.Context) (*setupValue, error) {
+	value, err := c.setup.fn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSetup, err)
+	}
+	return &setupValue{value: value, computed: time.Now()}, nil
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SpeculativeConfig configures speculative execution of routed branches
+type SpeculativeConfig[T any] struct {
+	// N is the number of top routed branches to run concurrently
+	N int
+
+	// Accept reports whether a branch's resulting state is acceptable.
+	// A nil Accept accepts every branch.
+	Accept func(T) bool
+}
+
+// WithSpeculative makes a conditional edge run its top n routed branches
+// concurrently instead of only the first. Each branch runs the routed node on
+// its own copy of the state. The first branch whose result satisfies accept is
+// committed and the others are cancelled. When no branch is acceptable the
+// first one to complete is committed. A branch's node can also call
+// CancelSiblings to win outright, cancelling and discarding the others.
+//
+// Each branch gets a deep copy of the state made with the graph's codec, so
+// the state must be encodable. The step ends once every branch has
+// returned, and the branches that lost get an end event marking them
+// cancelled when they didn't complete. Cancelled branches run under the
+// run's context, so any model usage they report through events is still
+// attributed to the run.
+func WithSpeculative[T any](n int, accept func(T) bool) EdgeOption[T] {
+	return func(e *ConditionalEdge[T]) {
+		e.Speculative = &SpeculativeConfig[T]{
+			N:      n,
+			Accept: accept,
+		}
+	}
+}
+
+// candidates returns the routed nodes that should be raced
+func (c *SpeculativeConfig[T]) candidates(nextNodes []string) []string {
+	candidates := make([]string, 0, c.N)
+	for _, node := range nextNodes {
+		if len(candidates) == c.N {
+			break
+		}
+		if node == END {
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+	return candidates
+}
+
+// branchResult is the outcome of a single speculative branch
+type branchResult[T any] struct {
+	index int
+	node  string
+	state T
+	err   error
+
+	// dropped is set when a sibling cancelled the branch
+	dropped bool
+}
+
+// runSpeculative runs the candidate nodes concurrently and returns the
+// winning node and its state
+func (r *RunnableState[T]) runSpeculative(ctx context.Context, candidates []string, state T, config *SpeculativeConfig[T], step int, profiler *Profiler) (string, T, error) {
+	for _, name := range candidates {
+		if _, ok := r.node(ctx, name); !ok {
+			var zero T
+			return "", zero, fmt.Errorf("%w: %s", ErrNodeNotFound, name)
+		}
+	}
+
+	// Every branch decodes its own copy, so none shares maps, slices or
+	// pointers with another
+	data, err := r.graph.codec.Marshal(state)
+	if err != nil {
+		var zero T
+		return "", zero, fmt.Errorf("failed to copy state for speculative branches: %w", err)
+	}
+	copies := make([]T, len(candidates))
+	for i := range candidates {
+		if copies[i], err = r.graph.codec.Unmarshal(data); err != nil {
+			var zero T
+			return "", zero, fmt.Errorf("failed to copy state for speculative branches: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	branches := newBranchGroup(ctx, len(candidates))
+	defer branches.release()
+
+	results := make(chan branchResult[T], len(candidates))
+	for i, name := range candidates {
+		node, _ := r.node(ctx, name)
+
+		EmitEvent(ctx, Event{
+			Type:      EventChainStart,
+			Name:      name,
+			RunID:     RunIDFromContext(ctx),
+			Timestamp: time.Now(),
+			Metadata: map[string]interface{}{
+				"langgraph_step":     step,
+				"langgraph_node":     name,
+				"speculative_branch": i,
+			},
+			Data: r.debugPayload(ctx, state),
+		})
+
+		go func(i int, name string, branchState T) {
+			branchState, err := r.runNode(branches.context(i), profiler, step, node, branchState)
+			kept := branches.finish(i)
+			results <- branchResult[T]{index: i, node: name, state: branchState, err: err, dropped: !kept}
+		}(i, name, copies[i])
+	}
+
+	var winner, first *branchResult[T]
+	var firstErr error
+	accepted := false
+	finished := make([]branchResult[T], 0, len(candidates))
+	for len(finished) < len(candidates) {
+		res := <-results
+		finished = append(finished, res)
+		if winner != nil || res.dropped {
+			continue
+		}
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error in node %s: %w", res.node, res.err)
+			}
+			continue
+		}
+		if first == nil {
+			first = &finished[len(finished)-1]
+		}
+		if branches.isWinner(res.index) || config.Accept == nil || config.Accept(res.state) {
+			winner = &finished[len(finished)-1]
+			accepted = true
+			// Cancel the others and wait for them to return
+			cancel()
+		}
+	}
+	cancel()
+
+	if winner == nil {
+		winner = first
+	}
+	for _, res := range finished {
+		if winner == nil || res.index != winner.index {
+			r.emitLosingBranch(ctx, res, step)
+		}
+	}
+	if winner == nil {
+		var zero T
+		return "", zero, firstErr
+	}
+
+	r.graph.streamer.EmitUpdate(ctx, winner.state)
+	EmitEvent(ctx, Event{
+		Type:      EventChainEnd,
+		Name:      winner.node,
+		RunID:     RunIDFromContext(ctx),
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"langgraph_step":       step,
+			"langgraph_node":       winner.node,
+			"speculative_branch":   winner.index,
+			"speculative_winner":   true,
+			"speculative_accepted": accepted,
+			"speculative_branches": candidates,
+		},
+		Data: r.debugPayload(ctx, winner.state),
+	})
+
+	return winner.node, winner.state, nil
+}
+
+// emitLosingBranch emits the end event of a branch that wasn't committed
+func (r *RunnableState[T]) emitLosingBranch(ctx context.Context, res branchResult[T], step int) {
+	metadata := map[string]interface{}{
+		"langgraph_step":        step,
+		"langgraph_node":        res.node,
+		"speculative_branch":    res.index,
+		"speculative_winner":    false,
+		"speculative_cancelled": res.dropped || errors.Is(res.err, context.Canceled),
+	}
+	if res.err != nil {
+		metadata["error"] = res.err.Error()
+	}
+	EmitEvent(ctx, Event{
+		Type:      EventChainEnd,
+		Name:      res.node,
+		RunID:     RunIDFromContext(ctx),
+		Timestamp: time.Now(),
+		Metadata:  metadata,
+	})
+}
@@ -0,0 +1,112 @@
+package core_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+type draft struct {
+	Notes map[string]string
+	Tags  []string
+}
+
+// raceGraph routes "start" to the fast and slow nodes, raced speculatively
+func raceGraph(slow func(ctx context.Context, s draft) (draft, error)) *core.StateGraph[draft] {
+	g := newGraph[draft]()
+	g.AddNode("start", func(ctx context.Context, s draft) (draft, error) {
+		return draft{Notes: map[string]string{"start": "yes"}, Tags: make([]string, 0, 4)}, nil
+	})
+	g.AddNode("fast", func(ctx context.Context, s draft) (draft, error) {
+		s.Notes["fast"] = "yes"
+		s.Tags = append(s.Tags, "fast")
+		return s, nil
+	})
+	g.AddNode("slow", slow)
+	g.SetEntryPoint("start")
+	g.AddConditionalEdges("start", func(draft) ([]string, error) {
+		return []string{"fast", "slow"}, nil
+	}, nil, core.WithSpeculative[draft](2, nil))
+	g.AddConditionalEdges("fast", to[draft](core.END), nil)
+	g.AddConditionalEdges("slow", to[draft](core.END), nil)
+	return g
+}
+
+func TestSpeculativeBranchesGetTheirOwnState(t *testing.T) {
+	g := raceGraph(func(ctx context.Context, s draft) (draft, error) {
+		s.Notes["slow"] = "yes"
+		s.Tags = append(s.Tags, "slow")
+		<-ctx.Done()
+		return s, ctx.Err()
+	})
+	r := compile(t, g)
+
+	out, err := r.Invoke(context.Background(), draft{})
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if _, ok := out.Notes["slow"]; ok {
+		t.Errorf("notes = %v, the losing branch wrote to the winner's map", out.Notes)
+	}
+	if len(out.Tags) != 1 || out.Tags[0] != "fast" {
+		t.Errorf("tags = %v, want [fast]", out.Tags)
+	}
+}
+
+func TestSpeculativeWaitsForLosingBranches(t *testing.T) {
+	var returned atomic.Bool
+	g := raceGraph(func(ctx context.Context, s draft) (draft, error) {
+		<-ctx.Done()
+		// A branch that takes a moment to notice it was cancelled
+		time.Sleep(20 * time.Millisecond)
+		returned.Store(true)
+		return s, ctx.Err()
+	})
+	g.SetStreamConfig(core.StreamConfig{Modes: []core.StreamMode{core.StreamDebug}})
+	r := compile(t, g)
+
+	var ends []core.Event
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case evt := <-g.GetEventChannel():
+				if evt.Type == core.EventChainEnd && evt.Metadata["speculative_branch"] != nil {
+					ends = append(ends, evt)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	_, err := r.Invoke(context.Background(), draft{})
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if !returned.Load() {
+		t.Fatal("run ended before the losing branch returned")
+	}
+
+	var loser *core.Event
+	for i, evt := range ends {
+		if evt.Name == "slow" {
+			loser = &ends[i]
+		}
+	}
+	if loser == nil {
+		t.Fatalf("no end event for the losing branch in %v", ends)
+	}
+	if loser.Metadata["speculative_winner"] != false || loser.Metadata["speculative_cancelled"] != true {
+		t.Errorf("losing branch end metadata = %v, want a cancelled loser", loser.Metadata)
+	}
+}
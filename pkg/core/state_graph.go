@@ -14,6 +14,15 @@ var (
 
 	// ErrInvalidRouterOutput is returned when a router function returns an invalid output
 	ErrInvalidRouterOutput = errors.New("invalid router output")
+
+	// ErrInvalidInput is returned when the input state doesn't match the graph's input schema
+	ErrInvalidInput = errors.New("invalid graph input")
+
+	// ErrInvalidOutput is returned when the final state doesn't match the graph's output schema
+	ErrInvalidOutput = errors.New("invalid graph output")
+
+	// ErrRunTimeout is returned when the remaining run budget is too small to start a node
+	ErrRunTimeout = errors.New("run timeout")
 )
 
 // StateNode represents a node in the state graph
@@ -29,6 +38,47 @@ type StateNode[T any] struct {
 // Router is a function that determines which node(s) to execute next
 type Router[T any] func(state T) ([]string, error)
 
+// RouterCtx is a router that also gets the run context and metadata about
+// the run, for decisions such as stopping a loop after a number of visits
+// without keeping a counter in the state
+type RouterCtx[T any] func(ctx context.Context, state T, meta RouterMeta) ([]string, error)
+
+// RouterMeta describes the run at the time a router is called
+type RouterMeta struct {
+	// From is the node the edge leaves
+	From string
+
+	// Step is the step number of the node that just ran
+	Step int
+
+	// Visits is how often the node has completed in this run, including
+	// the run that just finished
+	Visits int
+
+	// Elapsed is the time since the run started
+	Elapsed time.Duration
+
+	// RunID identifies the run
+	RunID string
+}
+
+// RoutingDecision describes how a router's output was turned into the next
+// node, for debugging graphs that go the wrong way
+type RoutingDecision struct {
+	// From is the node the edge leaves
+	From string `json:"from"`
+
+	// RouterOutput is what the router returned
+	RouterOutput []string `json:"router_output"`
+
+	// Targets are the router output after applying the edge mapping
+	Targets []string `json:"targets"`
+
+	// Next is the node that runs next. It is empty when the targets are
+	// raced speculatively, and the winner's routing decision follows.
+	Next string `json:"next,omitempty"`
+}
+
 // ConditionalEdge represents a conditional edge in the state graph
 type ConditionalEdge[T any] struct {
 	// From is the name of the node from which the edge originates
@@ -37,12 +87,24 @@ type ConditionalEdge[T any] struct {
 	// Router is the function that determines which nodes to execute next
 	Router Router[T]
 
+	// RouterCtx is used instead of Router when set
+	RouterCtx RouterCtx[T]
+
 	// Mapping optionally maps router output values to node names
 	Mapping map[string]string
+
+	// Speculative races the top routed branches instead of taking the first
+	Speculative *SpeculativeConfig[T]
 }
 
+// EdgeOption configures a conditional edge
+type EdgeOption[T any] func(*ConditionalEdge[T])
+
 // StateGraph represents a graph with typed state
 type StateGraph[T any] struct {
+	// name identifies the graph in profiles
+	name string
+
 	// nodes is a map of node names to their corresponding StateNode objects
 	nodes map[string]StateNode[T]
 
@@ -63,24 +125,179 @@ type StateGraph[T any] struct {
 
 	// streamConfig contains streaming configuration
 	streamConfig StreamConfig
+
+	// deadLetter optionally receives the stream events dropped because a
+	// consumer fell behind
+	deadLetter func(Event)
+
+	// redaction hides sensitive state fields from external serializations
+	redaction *RedactionPolicy
+
+	// codec serializes state
+	codec Codec[T]
+
+	// draftDiffs optionally streams diffs of a draft field
+	draftDiffs *DraftDiffConfig[T]
+
+	// experiment optionally splits runs between variants
+	experiment *Experiment[T]
+
+	// limits bounds the resources used by each run
+	limits ResourceLimits
+
+	// logger is the base logger handed to node functions
+	logger Logger
+
+	// restarts delivers RestartNode commands to the node running in each run
+	restarts restartRegistry[T]
+
+	// retryPolicies are the retry policies of individual nodes
+	retryPolicies map[string]RetryPolicy
+
+	// nodeTimeouts are fixed timeouts of individual nodes
+	nodeTimeouts map[string]time.Duration
+
+	// adaptiveTimeouts derive node timeouts from observed latency
+	adaptiveTimeouts map[string]*adaptiveTimeout
+
+	// inputSchema optionally validates the state a run starts with
+	inputSchema map[string]interface{}
+
+	// outputSchema optionally validates the state a run ends with
+	outputSchema map[string]interface{}
+
+	// preprocessor optionally rewrites the state a run starts with
+	preprocessor func(context.Context, T) (T, error)
+
+	// postprocessor optionally rewrites the state a run ends with
+	postprocessor func(context.Context, T) (T, error)
+
+	// inits are the one-time setup functions of individual nodes
+	inits map[string]*nodeInit
+
+	// setup optionally produces a value shared by all runs
+	setup *graphSetup
+
+	// threads optionally saves the runs of conversation threads
+	threads *ThreadStore
+
+	// nodeOptions describe individual nodes for generated docs and scope
+	// the state they access
+	nodeOptions map[string]NodeOptions
+
+	// scopeMode is how writes to undeclared state fields are handled
+	scopeMode ScopeMode
+
+	// blobStore is the blob store nodes resolve BlobRefs in
+	blobStore BlobStore
 }
 
 // NewStateGraph creates a new instance of StateGraph
 func NewStateGraph[T any]() *StateGraph[T] {
 	config := DefaultStreamConfig()
 	return &StateGraph[T]{
+		name:             "LangGraph",
 		nodes:            make(map[string]StateNode[T]),
 		recursionLimit:   25, // Default recursion limit
 		interruptManager: NewInterruptManager[T](),
 		streamer:         NewStreamer[T](config.Modes),
 		streamConfig:     config,
+		codec:            JSONCodec[T]{},
 	}
 }
 
+// SetName sets the name that identifies the graph in profiles
+func (g *StateGraph[T]) SetName(name string) {
+	g.name = name
+}
+
+// SetLogger sets the logger node functions get from LoggerFromContext
+func (g *StateGraph[T]) SetLogger(logger Logger) {
+	g.logger = logger
+	g.streamer.SetLogger(logger)
+}
+
 // SetStreamConfig sets the streaming configuration
 func (g *StateGraph[T]) SetStreamConfig(config StreamConfig) {
 	g.streamConfig = config
 	g.streamer = NewStreamer[T](config.Modes)
+	if g.logger != nil {
+		g.streamer.SetLogger(g.logger)
+	}
+}
+
+// SetDeadLetterSink sets a function receiving the events InvokeStreaming
+// drops because its consumer fell behind, so they can be counted or
+// inspected rather than lost. Stream data that isn't a graph event is passed
+// as an EventChainStream named after its mode, with the data as JSON. The
+// sink is called from the run's forwarding goroutine and must not block.
+func (g *StateGraph[T]) SetDeadLetterSink(sink func(Event)) {
+	g.deadLetter = sink
+}
+
+// SetResourceLimits sets the resource limits for every run of the graph.
+// InvokeConfig.Limits overrides them for a single run.
+func (g *StateGraph[T]) SetResourceLimits(limits ResourceLimits) {
+	g.limits = limits
+}
+
+// SetInputSchema sets the JSON schema the initial state of every run must
+// match, using the same rules as tool arguments
+func (g *StateGraph[T]) SetInputSchema(schema map[string]interface{}) {
+	g.inputSchema = schema
+}
+
+// SetOutputSchema sets the JSON schema the final state of every run must match
+func (g *StateGraph[T]) SetOutputSchema(schema map[string]interface{}) {
+	g.outputSchema = schema
+}
+
+// SetPreprocessor sets a function run once on the initial state of every run,
+// after input validation and before the entry node. Unlike a node it has no
+// routing and emits no node events.
+func (g *StateGraph[T]) SetPreprocessor(fn func(ctx context.Context, state T) (T, error)) {
+	g.preprocessor = fn
+}
+
+// SetPostprocessor sets a function run once on the final state of every run,
+// before output validation
+func (g *StateGraph[T]) SetPostprocessor(fn func(ctx context.Context, state T) (T, error)) {
+	g.postprocessor = fn
+}
+
+// SetRedactionPolicy sets the policy used to hide state fields whenever state
+// leaves the graph through events, interrupts or served run state
+func (g *StateGraph[T]) SetRedactionPolicy(policy *RedactionPolicy) {
+	g.redaction = policy
+	g.interruptManager.SetRedactionPolicy(policy)
+}
+
+// RedactionPolicy returns the graph's redaction policy, nil when it has none
+func (g *StateGraph[T]) RedactionPolicy() *RedactionPolicy {
+	return g.redaction
+}
+
+// SetCodec sets the codec used to serialize state in events, interrupts and
+// served or persisted runs. The default is JSONCodec.
+func (g *StateGraph[T]) SetCodec(codec Codec[T]) {
+	g.codec = codec
+	g.interruptManager.SetCodec(codec)
+}
+
+// Codec returns the codec used to serialize state
+func (g *StateGraph[T]) Codec() Codec[T] {
+	return g.codec
+}
+
+// RedactState serializes state as JSON for an external destination with the
+// graph's codec, applying the graph's redaction policy. Binary codecs fall
+// back to encoding/json.
+func (g *StateGraph[T]) RedactState(state T) ([]byte, error) {
+	data, err := EncodeJSON(g.codec, state)
+	if err != nil {
+		return nil, err
+	}
+	return redactData(state, data, g.redaction)
 }
 
 // GetEventChannel returns the channel for receiving events
@@ -102,12 +319,59 @@ func (g *StateGraph[T]) AddNode(name string, fn func(ctx context.Context, state
 }
 
 // AddConditionalEdges adds conditional edges from a node using a router function
-func (g *StateGraph[T]) AddConditionalEdges(from string, router Router[T], mapping map[string]string) {
-	g.edges = append(g.edges, ConditionalEdge[T]{
+func (g *StateGraph[T]) AddConditionalEdges(from string, router Router[T], mapping map[string]string, opts ...EdgeOption[T]) {
+	edge := ConditionalEdge[T]{
 		From:    from,
 		Router:  router,
 		Mapping: mapping,
-	})
+	}
+	for _, opt := range opts {
+		opt(&edge)
+	}
+	g.edges = append(g.edges, edge)
+}
+
+// AddConditionalEdgesCtx adds conditional edges from a node using a router
+// that also receives the run context and RouterMeta
+func (g *StateGraph[T]) AddConditionalEdgesCtx(from string, router RouterCtx[T], mapping map[string]string, opts ...EdgeOption[T]) {
+	edge := ConditionalEdge[T]{
+		From:      from,
+		RouterCtx: router,
+		Mapping:   mapping,
+	}
+	for _, opt := range opts {
+		opt(&edge)
+	}
+	g.edges = append(g.edges, edge)
+}
+
+// call runs the edge's router
+func (e *ConditionalEdge[T]) call(ctx context.Context, state T, meta RouterMeta) ([]string, error) {
+	if e.RouterCtx != nil {
+		return e.RouterCtx(ctx, state, meta)
+	}
+	return e.Router(state)
+}
+
+// StreamDraftDiffs streams a word-level diff on the custom stream whenever a
+// node changes the draft returned by config.Get, so UIs can show revisions
+// without receiving the full text every time
+func (g *StateGraph[T]) StreamDraftDiffs(config *DraftDiffConfig[T]) {
+	g.draftDiffs = config
+}
+
+// SetExperiment splits the graph's threads between the experiment's variants
+func (g *StateGraph[T]) SetExperiment(experiment *Experiment[T]) {
+	g.experiment = experiment
+}
+
+// SetRetryPolicy makes a failed execution of the node be retried according to
+// the policy. Each attempt starts from the state the node was first given.
+func (g *StateGraph[T]) SetRetryPolicy(nodeName string, policy RetryPolicy) {
+	if g.retryPolicies == nil {
+		g.retryPolicies = make(map[string]RetryPolicy)
+	}
+	g.retryPolicies[nodeName] = policy
 }
 
 // SetEntryPoint sets the entry point node
@@ -140,9 +404,39 @@ func (g *StateGraph[T]) Resume(state T) error {
 	return g.interruptManager.Resume(state)
 }
 
+// ResumeAs resumes graph execution with the provided state on behalf of an
+// editor. When the state differs from the one the run paused with, a values
+// frame carrying it and an EventStateEdit naming the editor and the changed
+// fields are emitted before execution continues. Graphs with several runs
+// paused at once resume them with ResumeRun.
+func (g *StateGraph[T]) ResumeAs(state T, editor string) error {
+	return g.interruptManager.ResumeAs(state, editor)
+}
+
+// ResumeRun resumes the paused run with the given ID (see
+// InterruptInfo.RunID) like ResumeAs
+func (g *StateGraph[T]) ResumeRun(runID string, state T, editor string) error {
+	return g.interruptManager.ResumeRun(runID, state, editor)
+}
+
+// PausedState returns the unredacted state the run with the given ID paused
+// with, reporting false when it isn't paused
+func (g *StateGraph[T]) PausedState(runID string) (T, bool) {
+	return g.interruptManager.PausedState(runID)
+}
+
 // RunnableState represents a compiled state graph that can be invoked
 type RunnableState[T any] struct {
 	graph *StateGraph[T]
+
+	// scopes restrict nodes to the state fields they declared
+	scopes map[string]*stateScope
+
+	// runCache optionally memoizes the final states of runs
+	runCache *runCache[T]
+
+	// setup holds the graph's setup value, nil without a setup function
+	setup *setupCache
 }
 
 // Compile compiles the state graph and returns a RunnableState instance
@@ -150,10 +444,30 @@ func (g *StateGraph[T]) Compile() (*RunnableState[T], error) {
 	if g.entryPoint == "" {
 		return nil, ErrEntryPointNotSet
 	}
+	scopes, err := g.stateScopes()
+	if err != nil {
+		return nil, err
+	}
+
+	runnable := &RunnableState[T]{
+		graph:  g,
+		scopes: scopes,
+	}
+	if g.setup != nil {
+		runnable.setup = &setupCache{setup: g.setup}
+	}
+	return runnable, nil
+}
 
-	return &RunnableState[T]{
-		graph: g,
-	}, nil
+// Codec returns the codec of the compiled graph
+func (r *RunnableState[T]) Codec() Codec[T] {
+	return r.graph.codec
+}
+
+// RedactState encodes a state as JSON with the graph's redaction policy
+// applied
+func (r *RunnableState[T]) RedactState(state T) ([]byte, error) {
+	return r.graph.RedactState(state)
 }
 
 // Send represents a message to be sent to a specific node with custom state
@@ -168,17 +482,254 @@ type Command[T any] struct {
 	Goto   string
 }
 
+// InvokeConfig contains per-run configuration
+type InvokeConfig struct {
+	// Deadline is the time by which the whole run must finish.
+	// Each node gets whatever time earlier nodes left over.
+	Deadline time.Time
+
+	// MinNodeBudget is the least remaining time a node needs to be started.
+	// When less is left the run fails fast with ErrRunTimeout.
+	MinNodeBudget time.Duration
+
+	// Limits overrides the graph's resource limits for this run
+	Limits ResourceLimits
+
+	// Profiler optionally records the resources used by each node
+	Profiler *Profiler
+
+	// RunID identifies the run in events and logs. A random ID is used when empty.
+	RunID string
+
+	// TokenBudget is the number of model tokens the run may spend. Zero
+	// means no budget unless ctx already carries one.
+	TokenBudget int
+
+	// ToolTrace optionally records every tool call agents make during the run
+	ToolTrace *ToolTrace
+
+	// Locale is the locale of the run, such as de-AT, used to resolve
+	// prompts from a PromptCatalog and by agents responding in it
+	Locale string
+
+	// from is where a resumed thread continues, nil to start at the entry
+	// point
+	from *threadPosition
+}
+
+type runIDKey struct{}
+
+// RunIDFromContext returns the ID of the graph run the context belongs to
+func RunIDFromContext(ctx context.Context) string {
+	runID, _ := ctx.Value(runIDKey{}).(string)
+	return runID
+}
+
+// RemainingBudget returns the time left before the run deadline carried by ctx
+// and whether a deadline is set
+func RemainingBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
 // Invoke executes the compiled state graph with the given input state
 func (r *RunnableState[T]) Invoke(ctx context.Context, state T) (T, error) {
+	return r.InvokeWithConfig(ctx, state, InvokeConfig{})
+}
+
+// InvokeWithConfig executes the compiled state graph with the given input state and run configuration.
+// The run's lifecycle is published to Events and to the bus attached with
+// WithLifecycleBus, if any.
+func (r *RunnableState[T]) InvokeWithConfig(ctx context.Context, state T, config InvokeConfig) (T, error) {
+	if config.RunID == "" {
+		config.RunID = newID("run-")
+	}
+	life := newRunLifecycle(ctx, r.graph.name, config.RunID)
+	ctx = context.WithValue(ctx, runLifecycleKey{}, life)
+
+	// Invalid input skips the cache and fails validation in invoke, so a
+	// key that leaves out the invalid field can't serve it a cached success
+	var cacheKey string
+	if r.runCache != nil && validateState(r.graph.inputSchema, state) == nil {
+		var ok bool
+		if cacheKey, ok = r.cacheKey(ctx, state); ok {
+			if result, hit := r.cachedResult(ctx, cacheKey); hit {
+				life.publish(LifecycleEvent{Type: LifecycleRunCompleted, Cached: true})
+				return result, nil
+			}
+		}
+	}
+
+	started := time.Now()
+	startNode := r.graph.entryPoint
+	if config.from != nil {
+		startNode = config.from.node
+	}
+	life.publish(LifecycleEvent{Type: LifecycleRunStarted, Node: startNode})
+	result, err := r.invoke(ctx, state, config)
+	if err != nil {
+		life.publish(LifecycleEvent{Type: LifecycleRunFailed, Step: life.steps, Duration: time.Since(started), Error: err.Error()})
+	} else {
+		life.publish(LifecycleEvent{Type: LifecycleRunCompleted, Step: life.steps, Duration: time.Since(started)})
+	}
+
+	// A resumed interrupt means the result depends on more than the input
+	if err == nil && cacheKey != "" && !life.interrupted {
+		r.cacheResult(ctx, cacheKey, result)
+	}
+	return result, err
+}
+
+// InvokeTrace runs the graph like Invoke and also returns the state after
+// each node, in order, without wiring up streaming. Whatever the run emits
+// to the graph's streams is dropped. The states are copies made with the
+// graph's codec, so later nodes can't change them through shared maps or
+// slices. On error the states up to the failure are returned.
+func (r *RunnableState[T]) InvokeTrace(ctx context.Context, state T) (T, []T, error) {
+	done := make(chan struct{})
+	defer close(done)
+	go r.graph.streamer.discard(done)
+
+	trace := &stateTrace[T]{runID: newID("run-")}
+	ctx = context.WithValue(ctx, stateTraceKey{}, trace)
+	result, err := r.InvokeWithConfig(ctx, state, InvokeConfig{RunID: trace.runID})
+	return result, trace.states, err
+}
+
+type stateTraceKey struct{}
+
+// stateTrace collects the states of a run for InvokeTrace. It is keyed by
+// run so subgraphs invoked from nodes don't add to it.
+type stateTrace[T any] struct {
+	runID  string
+	states []T
+}
+
+// add appends a copy of the encoded state
+func (t *stateTrace[T]) add(state *encodedState[T]) error {
+	data, err := state.json()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot state: %w", err)
+	}
+	snapshot, err := DecodeState(state.codec, data)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot state: %w", err)
+	}
+	t.states = append(t.states, snapshot)
+	return nil
+}
+
+// invoke runs the graph
+func (r *RunnableState[T]) invoke(ctx context.Context, state T, config InvokeConfig) (T, error) {
+	life := runLifecycleFromContext(ctx)
 	currentNode := r.graph.entryPoint
 	steps := 0
+	if config.from != nil {
+		currentNode, steps = config.from.node, config.from.step
+	}
+	started := time.Now()
+	visits := make(map[string]int)
+	limits := r.graph.limits.merge(config.Limits).withDefaults()
+
+	if err := validateState(r.graph.inputSchema, state); err != nil {
+		var zero T
+		return zero, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	if !config.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, config.Deadline)
+		defer cancel()
+	}
+
+	if config.TokenBudget > 0 {
+		ctx = WithTokenBudget(ctx, NewTokenBudget(config.TokenBudget))
+	}
+
+	if config.ToolTrace != nil {
+		ctx = WithToolTrace(ctx, config.ToolTrace)
+	}
+
+	if config.Locale != "" {
+		ctx = WithLocale(ctx, config.Locale)
+	}
+
+	if r.graph.blobStore != nil && BlobsFromContext(ctx) == nil {
+		ctx = WithBlobs(ctx, r.graph.blobStore)
+	}
+
+	var drafts *draftTracker[T]
+	if r.graph.draftDiffs != nil {
+		drafts = &draftTracker[T]{config: r.graph.draftDiffs, previous: r.graph.draftDiffs.Get(state)}
+	}
+
+	// Assign the run to an experiment variant, tagging all of its events
+	var writer streamWriter = r.graph.streamer
+	if exp := r.graph.experiment; exp != nil {
+		if variant := exp.variantFor(ctx); variant != nil {
+			ctx = WithVariant(ctx, variant.Name)
+			if variant.AgentConfig != nil {
+				ctx = WithAgentConfig(ctx, variant.AgentConfig)
+			}
+			writer = &taggedWriter{streamWriter: writer, experiment: exp.Name, variant: variant.Name}
+		}
+	}
+
+	// Let node functions write to the graph's streams
+	ctx = withStreamWriter(ctx, writer)
+
+	runID := config.RunID
+	ctx = context.WithValue(ctx, runIDKey{}, runID)
+	defer r.graph.restarts.register(runID)()
+
+	logger := r.graph.logger
+	if logger == nil {
+		logger = LoggerFromContext(ctx)
+	}
+	logger = logger.With("run_id", runID)
+	ctx = WithLogger(ctx, logger)
+	logger.Info("Run started", "graph", r.graph.name, "entry", currentNode)
+
+	if r.setup != nil {
+		value, err := r.setup.get(ctx)
+		if err != nil {
+			logger.Error("Setup failed", "error", err)
+			var zero T
+			return zero, err
+		}
+		ctx = context.WithValue(ctx, setupKey{}, value)
+	}
+
+	if r.graph.preprocessor != nil && config.from == nil {
+		var err error
+		if state, err = r.graph.preprocessor(ctx, state); err != nil {
+			var zero T
+			return zero, fmt.Errorf("preprocessor failed: %w", err)
+		}
+		if drafts != nil {
+			drafts.previous = r.graph.draftDiffs.Get(state)
+		}
+	}
+
+	// Runs that save their thread can be suspended by their nodes, and the
+	// node a thread was suspended at learns about its wait when it resumes
+	if r.savesThread(ctx) {
+		ctx = context.WithValue(ctx, suspendableKey{}, true)
+	}
+	var resumedWait *EventWait
+	if config.from != nil {
+		resumedWait = config.from.wait
+	}
 
 	// Emit initial state
-	r.graph.streamer.EmitValue(state)
-	r.graph.streamer.EmitEvent(Event{
+	r.graph.streamer.EmitValue(ctx, state)
+	EmitEvent(ctx, Event{
 		Type:      EventChainStart,
 		Name:      "LangGraph",
-		RunID:     "run-" + time.Now().Format("20060102150405"),
+		RunID:     RunIDFromContext(ctx),
 		Timestamp: time.Now(),
 	})
 
@@ -194,49 +745,87 @@ func (r *RunnableState[T]) Invoke(ctx context.Context, state T) (T, error) {
 
 		// Check for breakpoints
 		if r.graph.interruptManager.HasBreakpoint(currentNode) {
-			if err := r.graph.interruptManager.Interrupt(currentNode, nil, state); err != nil {
+			if err := r.graph.interruptManager.Interrupt(ctx, currentNode, nil, state); err != nil {
 				var zero T
 				return zero, fmt.Errorf("error triggering breakpoint: %w", err)
 			}
+			life.publish(LifecycleEvent{Type: LifecycleInterruptRaised, Node: currentNode, Step: steps})
 
 			var err error
-			state, err = r.graph.interruptManager.WaitForResume(ctx)
+			state, err = r.resume(ctx, currentNode, steps, state, runID)
 			if err != nil {
 				var zero T
 				return zero, fmt.Errorf("error waiting for resume: %w", err)
 			}
 		}
 
-		node, ok := r.graph.nodes[currentNode]
+		node, ok := r.node(ctx, currentNode)
 		if !ok {
 			var zero T
 			return zero, fmt.Errorf("%w: %s", ErrNodeNotFound, currentNode)
 		}
 
+		startMetadata := map[string]interface{}{
+			"langgraph_step": steps,
+			"langgraph_node": currentNode,
+		}
+		if group := nodeGroup(currentNode); group != "" {
+			startMetadata["group"] = group
+		}
+
+		// Don't start a node that can't finish within the remaining budget
+		if budget, ok := RemainingBudget(ctx); ok {
+			if budget <= 0 || budget < config.MinNodeBudget {
+				var zero T
+				return zero, fmt.Errorf("%w: %s remaining before node %s", ErrRunTimeout, budget, currentNode)
+			}
+			startMetadata["budget_remaining_ms"] = budget.Milliseconds()
+		}
+
 		// Emit node start event
-		r.graph.streamer.EmitEvent(Event{
+		logger.Debug("Node started", "node", currentNode, "step", steps)
+		nodeStart := time.Now()
+		EmitEvent(ctx, Event{
 			Type:      EventChainStart,
 			Name:      currentNode,
-			RunID:     "run-" + time.Now().Format("20060102150405"),
+			RunID:     RunIDFromContext(ctx),
 			Timestamp: time.Now(),
-			Metadata: map[string]interface{}{
-				"langgraph_step": steps,
-				"langgraph_node": currentNode,
-			},
+			Metadata:  startMetadata,
+			Data:      r.debugPayload(ctx, state),
 		})
 
+		nodeCtx := ctx
+		if resumedWait != nil {
+			nodeCtx = context.WithValue(ctx, resumedWaitKey{}, *resumedWait)
+			resumedWait = nil
+		}
+
+		input := state
 		var err error
-		state, err = node.Function(ctx, state)
+		state, err = r.runRestartable(nodeCtx, config.Profiler, steps, node, state)
 		if err != nil {
+			// Save the thread to run the node again once its event arrives
+			var suspend *SuspendError
+			if errors.As(err, &suspend) && r.savesThread(ctx) {
+				if err := r.saveThread(ctx, currentNode, steps, newEncodedState(r.graph.codec, input), &suspend.Wait); err != nil {
+					var zero T
+					return zero, err
+				}
+				logger.Info("Run suspended", "node", currentNode, "step", steps, "event", suspend.Wait.Event)
+				var zero T
+				return zero, suspend
+			}
+
 			// Check for interrupt requests
 			if IsInterruptError(err) {
 				data, _ := GetInterruptData(err)
-				if err := r.graph.interruptManager.Interrupt(currentNode, data, state); err != nil {
+				if err := r.graph.interruptManager.Interrupt(ctx, currentNode, data, state); err != nil {
 					var zero T
 					return zero, fmt.Errorf("error triggering interrupt: %w", err)
 				}
+				life.publish(LifecycleEvent{Type: LifecycleInterruptRaised, Node: currentNode, Step: steps})
 
-				state, err = r.graph.interruptManager.WaitForResume(ctx)
+				state, err = r.resume(ctx, currentNode, steps, state, runID)
 				if err != nil {
 					var zero T
 					return zero, fmt.Errorf("error waiting for resume: %w", err)
@@ -244,95 +833,331 @@ func (r *RunnableState[T]) Invoke(ctx context.Context, state T) (T, error) {
 				continue
 			}
 
+			logger.Error("Node failed", "node", currentNode, "step", steps, "error", err)
 			var zero T
 			return zero, fmt.Errorf("error in node %s: %w", currentNode, err)
 		}
+		logger.Debug("Node finished", "node", currentNode, "step", steps, "duration", time.Since(nodeStart))
+		life.publish(LifecycleEvent{Type: LifecycleNodeCompleted, Node: currentNode, Step: steps, Duration: time.Since(nodeStart)})
+		visits[currentNode]++
+
+		encoded := newEncodedState(r.graph.codec, state)
+		trace, tracing := ctx.Value(stateTraceKey{}).(*stateTrace[T])
+		tracing = tracing && trace.runID == config.RunID
+		if tracing {
+			if err := trace.add(encoded); err != nil {
+				var zero T
+				return zero, err
+			}
+		}
 
-		// Emit node end event and state update
-		r.graph.streamer.EmitEvent(Event{
+		measuresState := limits.measuresState(tracing || r.savesThread(ctx))
+		if err := limits.check(currentNode, state, r.stateSize(ctx, encoded, measuresState)); err != nil {
+			var zero T
+			return zero, err
+		}
+
+		// Emit the state update before the node end event, see Streamer
+		r.graph.streamer.EmitUpdate(ctx, state)
+		if drafts != nil {
+			if frame, ok := drafts.frame(currentNode, state); ok {
+				EmitCustom(ctx, frame)
+			}
+		}
+		EmitEvent(ctx, Event{
 			Type:      EventChainEnd,
 			Name:      currentNode,
-			RunID:     "run-" + time.Now().Format("20060102150405"),
+			RunID:     RunIDFromContext(ctx),
 			Timestamp: time.Now(),
 			Metadata: map[string]interface{}{
 				"langgraph_step": steps,
 				"langgraph_node": currentNode,
 			},
+			Data: r.debugPayload(ctx, state),
 		})
-		r.graph.streamer.EmitUpdate(state)
 
 		// Find and execute the router for the current node
-		foundNext := false
-		for _, edge := range r.graph.edges {
-			if edge.From == currentNode {
-				nextNodes, err := edge.Router(state)
-				if err != nil {
-					var zero T
-					return zero, fmt.Errorf("error in router for node %s: %w", currentNode, err)
-				}
+		meta := RouterMeta{From: currentNode, Step: steps, Visits: visits[currentNode], Elapsed: time.Since(started), RunID: runID}
+		nextNodes, edge, err := r.route(ctx, currentNode, state, meta)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
 
-				if len(nextNodes) == 0 {
-					var zero T
-					return zero, fmt.Errorf("%w: router returned no nodes", ErrInvalidRouterOutput)
-				}
+		// Race the top candidates when the edge is speculative, then keep
+		// routing from whichever branch won
+		for edge.Speculative != nil {
+			candidates := edge.Speculative.candidates(nextNodes)
+			if len(candidates) < 2 {
+				break
+			}
 
-				// If mapping exists, translate the router output
-				if edge.Mapping != nil {
-					mappedNodes := make([]string, 0, len(nextNodes))
-					for _, node := range nextNodes {
-						if mapped, ok := edge.Mapping[node]; ok {
-							mappedNodes = append(mappedNodes, mapped)
-						} else {
-							mappedNodes = append(mappedNodes, node)
-						}
-					}
-					nextNodes = mappedNodes
+			steps++
+			if steps >= r.graph.recursionLimit {
+				var zero T
+				return zero, fmt.Errorf("recursion limit (%d) exceeded", r.graph.recursionLimit)
+			}
+
+			var winner string
+			winner, state, err = r.runSpeculative(ctx, candidates, state, edge.Speculative, steps, config.Profiler)
+			if err != nil {
+				var zero T
+				return zero, err
+			}
+			encoded = newEncodedState(r.graph.codec, state)
+			if tracing {
+				if err := trace.add(encoded); err != nil {
+					var zero T
+					return zero, err
 				}
+			}
+			if err := limits.check(winner, state, r.stateSize(ctx, encoded, measuresState)); err != nil {
+				var zero T
+				return zero, err
+			}
 
-				// For now, just take the first node. In future we could support parallel execution
-				currentNode = nextNodes[0]
-				foundNext = true
-				break
+			visits[winner]++
+			meta := RouterMeta{From: winner, Step: steps, Visits: visits[winner], Elapsed: time.Since(started), RunID: runID}
+			nextNodes, edge, err = r.route(ctx, winner, state, meta)
+			if err != nil {
+				var zero T
+				return zero, err
 			}
 		}
 
-		if !foundNext {
+		// For now, just take the first node. In future we could support parallel execution
+		currentNode = nextNodes[0]
+
+		steps++
+
+		if err := r.saveThread(ctx, currentNode, steps, encoded, nil); err != nil {
 			var zero T
-			return zero, fmt.Errorf("%w: %s", ErrNoOutgoingEdge, currentNode)
+			return zero, err
 		}
+	}
 
-		steps++
+	if r.graph.postprocessor != nil {
+		var err error
+		if state, err = r.graph.postprocessor(ctx, state); err != nil {
+			var zero T
+			return zero, fmt.Errorf("postprocessor failed: %w", err)
+		}
 	}
 
+	if err := validateState(r.graph.outputSchema, state); err != nil {
+		var zero T
+		return zero, fmt.Errorf("%w: %v", ErrInvalidOutput, err)
+	}
+
+	logger.Info("Run finished", "steps", steps)
+	life.steps = steps
+
 	// Emit final state and end event
-	r.graph.streamer.EmitValue(state)
-	r.graph.streamer.EmitEvent(Event{
+	r.graph.streamer.EmitValue(ctx, state)
+	EmitEvent(ctx, Event{
 		Type:      EventChainEnd,
 		Name:      "LangGraph",
-		RunID:     "run-" + time.Now().Format("20060102150405"),
+		RunID:     RunIDFromContext(ctx),
 		Timestamp: time.Now(),
 	})
 
 	return state, nil
 }
 
-// Stream executes the graph and returns channels for streaming results
-func (r *RunnableState[T]) Stream(ctx context.Context, state T) (<-chan StreamEvent, <-chan Event, error) {
+// resume waits for a paused run to be resumed and records any edit made to
+// its state, publishing it to the run's lifecycle and adding the edited
+// state to the run's trace
+func (r *RunnableState[T]) resume(ctx context.Context, node string, step int, paused T, runID string) (T, error) {
+	state, editor, err := r.graph.interruptManager.waitForResume(ctx)
+	if err != nil {
+		return state, err
+	}
+	edit := r.recordEdit(ctx, node, step, editor, paused, state)
+	if edit == nil {
+		return state, nil
+	}
+	runLifecycleFromContext(ctx).publish(LifecycleEvent{Type: LifecycleStateEdited, Node: node, Step: step, Edit: edit})
+	if trace, ok := ctx.Value(stateTraceKey{}).(*stateTrace[T]); ok && trace.runID == runID {
+		if err := trace.add(newEncodedState(r.graph.codec, state)); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+// node returns the named node, with its function replaced when the run's
+// experiment variant overrides it
+func (r *RunnableState[T]) node(ctx context.Context, name string) (StateNode[T], bool) {
+	node, ok := r.graph.nodes[name]
+	if !ok || r.graph.experiment == nil || len(r.graph.experiment.Variants) == 0 {
+		return node, ok
+	}
+	variant := r.graph.experiment.variantNamed(VariantFromContext(ctx))
+	if fn := variant.Nodes[name]; fn != nil {
+		node.Function = fn
+	}
+	return node, true
+}
+
+// route runs the router for the given node and returns the candidate next
+// nodes, after applying the edge mapping, along with the edge that was used.
+// The decision is logged with the run's logger and, in debug mode, emitted
+// as an EventRoutingDecision.
+func (r *RunnableState[T]) route(ctx context.Context, from string, state T, meta RouterMeta) ([]string, *ConditionalEdge[T], error) {
+	for i := range r.graph.edges {
+		edge := &r.graph.edges[i]
+		if edge.From != from {
+			continue
+		}
+
+		nextNodes, err := edge.call(ctx, state, meta)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error in router for node %s: %w", from, err)
+		}
+
+		if len(nextNodes) == 0 {
+			return nil, nil, fmt.Errorf("%w: router returned no nodes", ErrInvalidRouterOutput)
+		}
+
+		// If mapping exists, translate the router output
+		targets := nextNodes
+		if edge.Mapping != nil {
+			targets = make([]string, 0, len(nextNodes))
+			for _, node := range nextNodes {
+				if mapped, ok := edge.Mapping[node]; ok {
+					targets = append(targets, mapped)
+				} else {
+					targets = append(targets, node)
+				}
+			}
+			LoggerFromContext(ctx).Debug("Routing decision", "from", from, "router_output", nextNodes, "to", targets)
+		} else {
+			LoggerFromContext(ctx).Debug("Routing decision", "from", from, "to", targets)
+		}
+		r.emitRoutingDecision(ctx, edge, nextNodes, targets, meta)
+		return targets, edge, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: %s", ErrNoOutgoingEdge, from)
+}
+
+// emitRoutingDecision emits an EventRoutingDecision when debug streaming is
+// active
+func (r *RunnableState[T]) emitRoutingDecision(ctx context.Context, edge *ConditionalEdge[T], output, targets []string, meta RouterMeta) {
+	if !r.graph.streamer.hasMode(StreamDebug) {
+		return
+	}
+	decision := RoutingDecision{
+		From:         meta.From,
+		RouterOutput: output,
+		Targets:      targets,
+	}
+	if edge.Speculative == nil || len(edge.Speculative.candidates(targets)) < 2 {
+		decision.Next = targets[0]
+	}
+	data, err := json.Marshal(decision)
+	if err != nil {
+		return
+	}
+	EmitEvent(ctx, Event{
+		Type:      EventRoutingDecision,
+		Name:      meta.From,
+		RunID:     RunIDFromContext(ctx),
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"langgraph_step": meta.Step,
+			"langgraph_node": meta.From,
+		},
+		Data: data,
+	})
+}
+
+// validateState checks the JSON form of the state against a schema.
+// A nil schema accepts any state.
+func validateState(schema map[string]interface{}, state interface{}) error {
+	if schema == nil {
+		return nil
+	}
+
+	data, err := MarshalState(state)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("state is not an object: %w", err)
+	}
+	return ValidateSchema(schema, fields)
+}
+
+// stateSize returns the size function of a step's limit check, nil when
+// the step doesn't measure the state
+func (r *RunnableState[T]) stateSize(ctx context.Context, state *encodedState[T], measure bool) func() (int, bool) {
+	if !measure {
+		return nil
+	}
+	return func() (int, bool) {
+		size, ok := state.size()
+		if !ok {
+			LoggerFromContext(ctx).Debug("State size not measured, the codec can't encode it", "error", state.err)
+		}
+		return size, ok
+	}
+}
+
+// debugPayload serializes state for attaching to node events.
+// It returns nil unless debug streaming is active so that regular runs
+// don't pay for serialization. A state that can't be serialized is logged
+// and replaced with an error marker, so a debugger can tell it apart from
+// a missing payload.
+func (r *RunnableState[T]) debugPayload(ctx context.Context, state T) json.RawMessage {
+	if !r.graph.streamer.hasMode(StreamDebug) {
+		return nil
+	}
+	data, err := r.graph.RedactState(state)
+	if err != nil {
+		LoggerFromContext(ctx).Warn("Failed to serialize state for a debug event", "error", err)
+		marker, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return marker
+	}
+	return data
+}
+
+// RunResult is the outcome of a streamed run
+type RunResult[T any] struct {
+	State T
+	Err   error
+}
+
+// Stream executes the graph and returns channels for streaming results, and
+// a channel delivering the final state and error once the run ends,
+// whichever stream modes are active. The result channel is buffered, so it
+// can be read after the stream channels are closed.
+func (r *RunnableState[T]) Stream(ctx context.Context, state T) (<-chan StreamEvent, <-chan Event, <-chan RunResult[T], error) {
 	// Create channels for streaming
 	streamCh := make(chan StreamEvent, r.graph.streamConfig.BufferSize)
 	eventCh := make(chan Event, r.graph.streamConfig.BufferSize)
+	resultCh := make(chan RunResult[T], 1)
 
 	// Run the graph in a goroutine
+	var result RunResult[T]
 	go func() {
+		defer func() {
+			resultCh <- result
+			close(resultCh)
+		}()
 		defer close(streamCh)
 		defer close(eventCh)
 
 		// Create a new context with cancellation
-		ctx, cancel := context.WithCancel(ctx)
+		runCtx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
-		// Create a goroutine to forward events and stream data
+		// Create a goroutine to forward events and stream data, stopped
+		// before the channels are closed
+		stopped := make(chan struct{})
 		go func() {
+			defer close(stopped)
 			for {
 				select {
 				case evt, ok := <-r.graph.GetEventChannel():
@@ -341,7 +1166,7 @@ func (r *RunnableState[T]) Stream(ctx context.Context, state T) (<-chan StreamEv
 					}
 					select {
 					case eventCh <- evt:
-					case <-ctx.Done():
+					case <-runCtx.Done():
 						return
 					}
 				case stream, ok := <-r.graph.GetStreamChannel():
@@ -350,24 +1175,28 @@ func (r *RunnableState[T]) Stream(ctx context.Context, state T) (<-chan StreamEv
 					}
 					select {
 					case streamCh <- stream:
-					case <-ctx.Done():
+					case <-runCtx.Done():
 						return
 					}
-				case <-ctx.Done():
+				case <-runCtx.Done():
 					return
 				}
 			}
 		}()
 
 		// Run the graph
-		_, err := r.Invoke(ctx, state)
+		runID := newID("run-")
+		final, err := r.InvokeWithConfig(runCtx, state, InvokeConfig{RunID: runID})
+		result = RunResult[T]{State: final, Err: err}
+		cancel()
+		<-stopped
 		if err != nil {
 			// Handle error
 			select {
 			case eventCh <- Event{
 				Type:      EventChainEnd,
 				Name:      "LangGraph",
-				RunID:     "run-" + time.Now().Format("20060102150405"),
+				RunID:     runID,
 				Timestamp: time.Now(),
 				Metadata: map[string]interface{}{
 					"error": err.Error(),
@@ -378,7 +1207,95 @@ func (r *RunnableState[T]) Stream(ctx context.Context, state T) (<-chan StreamEv
 		}
 	}()
 
-	return streamCh, eventCh, nil
+	return streamCh, eventCh, resultCh, nil
+}
+
+// InvokeStreaming executes the graph in the background and returns a channel
+// of intermediate stream events along with a function that blocks until the
+// run completes and returns the final state. Graph events are delivered on the
+// channel in StreamDebug mode. The channel is closed when the run ends.
+//
+// Reading the channel is optional. When the consumer falls behind and the
+// buffer is full, intermediate events are dropped rather than stalling the
+// run, and passed to the dead-letter sink if one is set.
+func (r *RunnableState[T]) InvokeStreaming(ctx context.Context, state T) (<-chan StreamEvent, func() (T, error)) {
+	return r.streaming(ctx, func(ctx context.Context) (T, error) {
+		return r.Invoke(ctx, state)
+	})
+}
+
+// ResumeThreadStreaming is ResumeThread streaming like InvokeStreaming
+func (r *RunnableState[T]) ResumeThreadStreaming(ctx context.Context, threadID string) (<-chan StreamEvent, func() (T, error)) {
+	return r.streaming(ctx, func(ctx context.Context) (T, error) {
+		return r.ResumeThread(ctx, threadID)
+	})
+}
+
+// streaming executes run, forwarding the graph's stream and graph events
+// to the returned channel
+func (r *RunnableState[T]) streaming(ctx context.Context, run func(ctx context.Context) (T, error)) (<-chan StreamEvent, func() (T, error)) {
+	streamCh := make(chan StreamEvent, r.graph.streamConfig.BufferSize)
+	done := make(chan struct{})
+
+	var result T
+	var runErr error
+
+	forward := func(evt StreamEvent) {
+		select {
+		case streamCh <- evt:
+		default:
+			r.graph.deadLetterEvent(evt)
+		}
+	}
+
+	go func() {
+		defer close(done)
+		defer close(streamCh)
+
+		runCtx, cancel := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			for {
+				select {
+				case evt := <-r.graph.GetStreamChannel():
+					forward(evt)
+				case evt := <-r.graph.GetEventChannel():
+					forward(StreamEvent{Mode: StreamDebug, Data: evt})
+				case <-runCtx.Done():
+					return
+				}
+			}
+		}()
+
+		result, runErr = run(runCtx)
+		cancel()
+		<-stopped
+	}()
+
+	return streamCh, func() (T, error) {
+		<-done
+		return result, runErr
+	}
+}
+
+// deadLetterEvent passes a dropped stream event to the dead-letter sink
+func (g *StateGraph[T]) deadLetterEvent(evt StreamEvent) {
+	if g.deadLetter == nil {
+		return
+	}
+	if graphEvent, ok := evt.Data.(Event); ok {
+		g.deadLetter(graphEvent)
+		return
+	}
+	data, _ := json.Marshal(evt.Data)
+	g.deadLetter(Event{
+		Type:      EventChainStream,
+		Name:      string(evt.Mode),
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{"stream_mode": string(evt.Mode)},
+		Data:      data,
+	})
 }
 
 // MarshalState marshals a state object to JSON
@@ -0,0 +1,218 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+type ticket struct {
+	Title    string `json:"title"`
+	Priority int    `json:"priority"`
+	Status   string `json:"status,omitempty"`
+}
+
+var ticketSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"title":    map[string]interface{}{"type": "string"},
+		"priority": map[string]interface{}{"type": "integer"},
+		"status":   map[string]interface{}{"type": "string"},
+	},
+	"required": []string{"title"},
+}
+
+func TestInputSchemaRejectsBeforeAnyNode(t *testing.T) {
+	ran := false
+	g := newGraph[map[string]interface{}]()
+	g.SetInputSchema(ticketSchema)
+	g.AddNode("triage", func(ctx context.Context, s map[string]interface{}) (map[string]interface{}, error) {
+		ran = true
+		return s, nil
+	})
+	chain(g, "triage")
+	r := compile(t, g)
+
+	_, err := r.Invoke(context.Background(), map[string]interface{}{"priority": 1})
+	if !errors.Is(err, core.ErrInvalidInput) || !strings.Contains(err.Error(), "title") {
+		t.Fatalf("Invoke with a missing title = %v, want ErrInvalidInput naming the field", err)
+	}
+	if ran {
+		t.Error("a node ran on invalid input")
+	}
+
+	if _, err := r.Invoke(context.Background(), map[string]interface{}{"title": "broken", "priority": 1}); err != nil {
+		t.Fatalf("Invoke with valid input: %v", err)
+	}
+	if !ran {
+		t.Error("node didn't run on valid input")
+	}
+}
+
+func TestOutputSchemaChecksFinalState(t *testing.T) {
+	g := newGraph[ticket]()
+	g.SetOutputSchema(map[string]interface{}{
+		"type":       "object",
+		"properties": ticketSchema["properties"],
+		"required":   []string{"title", "status"},
+	})
+	g.AddNode("triage", func(ctx context.Context, s ticket) (ticket, error) {
+		if s.Priority > 0 {
+			s.Status = "open"
+		}
+		return s, nil
+	})
+	chain(g, "triage")
+	r := compile(t, g)
+
+	if _, err := r.Invoke(context.Background(), ticket{Title: "t", Priority: 1}); err != nil {
+		t.Fatalf("Invoke with a valid result: %v", err)
+	}
+	if _, err := r.Invoke(context.Background(), ticket{Title: "t"}); !errors.Is(err, core.ErrInvalidOutput) {
+		t.Fatalf("Invoke with a result missing its status = %v, want ErrInvalidOutput", err)
+	}
+}
+
+func TestInvokeTraceRecordsEveryNode(t *testing.T) {
+	// The default graph streams values, which nobody reads here
+	g := core.NewStateGraph[ticket]()
+	for _, node := range []string{"open", "triage", "close"} {
+		g.AddNode(node, func(ctx context.Context, s ticket) (ticket, error) {
+			s.Priority++
+			s.Status = node
+			return s, nil
+		})
+	}
+	chain(g, "open", "triage", "close")
+	r := compile(t, g)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, states, err := r.InvokeTrace(ctx, ticket{Title: "t"})
+	if err != nil {
+		t.Fatalf("InvokeTrace: %v", err)
+	}
+	want := []ticket{
+		{Title: "t", Priority: 1, Status: "open"},
+		{Title: "t", Priority: 2, Status: "triage"},
+		{Title: "t", Priority: 3, Status: "close"},
+	}
+	if len(states) != len(want) {
+		t.Fatalf("got %d states, want one per node: %v", len(states), states)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("state %d = %+v, want %+v", i, states[i], want[i])
+		}
+	}
+	if out != want[len(want)-1] {
+		t.Errorf("result = %+v, want %+v", out, want[len(want)-1])
+	}
+}
+
+func TestInvokeTraceRecordsSpeculativeWinner(t *testing.T) {
+	g := raceGraph(func(ctx context.Context, s draft) (draft, error) {
+		<-ctx.Done()
+		return s, ctx.Err()
+	})
+	r := compile(t, g)
+
+	_, states, err := r.InvokeTrace(context.Background(), draft{})
+	if err != nil {
+		t.Fatalf("InvokeTrace: %v", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("got %d states, want start and the winner: %v", len(states), states)
+	}
+	if _, ok := states[1].Notes["fast"]; !ok {
+		t.Errorf("second state = %v, want the fast branch's", states[1])
+	}
+	if _, ok := states[0].Notes["fast"]; ok {
+		t.Errorf("first state = %v, the winner changed the snapshot of start", states[0])
+	}
+}
+
+func TestRouterStopsAfterVisits(t *testing.T) {
+	g := newGraph[int]()
+	g.AddNode("loop", func(ctx context.Context, n int) (int, error) { return n + 1, nil })
+	g.SetEntryPoint("loop")
+	var metas []core.RouterMeta
+	var runID string
+	g.AddConditionalEdgesCtx("loop", func(ctx context.Context, n int, meta core.RouterMeta) ([]string, error) {
+		metas = append(metas, meta)
+		runID = core.RunIDFromContext(ctx)
+		if meta.Visits >= 3 {
+			return []string{core.END}, nil
+		}
+		return []string{"loop"}, nil
+	}, nil)
+
+	out, err := compile(t, g).Invoke(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if out != 3 || len(metas) != 3 {
+		t.Fatalf("the node ran %d times and routed %d times, want 3", out, len(metas))
+	}
+	for i, meta := range metas {
+		if meta.From != "loop" || meta.Visits != i+1 || meta.Step != i || meta.RunID != runID || meta.Elapsed <= 0 {
+			t.Errorf("meta %d = %+v, want visit %d at step %d of the run", i, meta, i+1, i)
+		}
+	}
+}
+
+func TestPreprocessorStateReachesEntryNode(t *testing.T) {
+	g := newGraph[ticket]()
+	g.SetPreprocessor(func(ctx context.Context, s ticket) (ticket, error) {
+		s.Status = "new"
+		return s, nil
+	})
+	var seen string
+	g.AddNode("triage", func(ctx context.Context, s ticket) (ticket, error) {
+		seen = s.Status
+		s.Priority++
+		return s, nil
+	})
+	g.SetPostprocessor(func(ctx context.Context, s ticket) (ticket, error) {
+		s.Title = strings.ToUpper(s.Title)
+		return s, nil
+	})
+	chain(g, "triage")
+	r := compile(t, g)
+
+	out, err := r.Invoke(context.Background(), ticket{Title: "t"})
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if seen != "new" {
+		t.Errorf("entry node saw status %q, want the preprocessor's %q", seen, "new")
+	}
+	if want := (ticket{Title: "T", Priority: 1, Status: "new"}); out != want {
+		t.Errorf("result = %+v, want %+v", out, want)
+	}
+}
+
+func TestPreprocessorErrorStopsRun(t *testing.T) {
+	errProfile := errors.New("profile not found")
+	ran := false
+	g := newGraph[ticket]()
+	g.SetPreprocessor(func(ctx context.Context, s ticket) (ticket, error) {
+		return s, errProfile
+	})
+	g.AddNode("triage", func(ctx context.Context, s ticket) (ticket, error) {
+		ran = true
+		return s, nil
+	})
+	chain(g, "triage")
+
+	if _, err := compile(t, g).Invoke(context.Background(), ticket{Title: "t"}); !errors.Is(err, errProfile) {
+		t.Errorf("Invoke = %v, want the preprocessor's error", err)
+	}
+	if ran {
+		t.Error("the entry node ran after the preprocessor failed")
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store is a namespaced key-value store used for persistent memory
+type Store interface {
+	// Get returns the value stored under key and whether it exists
+	Get(ctx context.Context, namespace, key string) ([]byte, bool, error)
+
+	// Put stores value under key, replacing any existing value
+	Put(ctx context.Context, namespace, key string, value []byte) error
+
+	// Delete removes key from the namespace
+	Delete(ctx context.Context, namespace, key string) error
+
+	// List returns the sorted keys in the namespace that start with prefix
+	List(ctx context.Context, namespace, prefix string) ([]string, error)
+}
+
+// DefaultNamespace is used when no namespace is attached to the context
+const DefaultNamespace = "default"
+
+type namespaceKey struct{}
+
+// WithNamespace returns a context carrying the store namespace, typically a
+// thread or user ID, that tools should read and write under
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// NamespaceFromContext returns the store namespace attached to the context
+func NamespaceFromContext(ctx context.Context) string {
+	if ns, ok := ctx.Value(namespaceKey{}).(string); ok && ns != "" {
+		return ns
+	}
+	return DefaultNamespace
+}
+
+// MemoryStore is an in-memory Store implementation
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string]map[string][]byte
+}
+
+// NewMemoryStore creates a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		data: make(map[string]map[string][]byte),
+	}
+}
+
+// Get returns the value stored under key
+func (s *MemoryStore) Get(ctx context.Context, namespace, key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.data[namespace][key]
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]byte(nil), value...), true, nil
+}
+
+// Put stores value under key
+func (s *MemoryStore) Put(ctx context.Context, namespace, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns, ok := s.data[namespace]
+	if !ok {
+		ns = make(map[string][]byte)
+		s.data[namespace] = ns
+	}
+	ns[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete removes key from the namespace
+func (s *MemoryStore) Delete(ctx context.Context, namespace, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data[namespace], key)
+	return nil
+}
+
+// List returns the sorted keys in the namespace that start with prefix
+func (s *MemoryStore) List(ctx context.Context, namespace, prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0)
+	for key := range s.data[namespace] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
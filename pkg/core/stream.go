@@ -1,7 +1,9 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,6 +25,10 @@ const (
 
 	// StreamDebug streams all possible information
 	StreamDebug StreamMode = "debug"
+
+	// StreamHeartbeat marks keepalive events sent while a node runs. They are
+	// sent whenever StreamConfig.HeartbeatInterval is set, whatever the modes.
+	StreamHeartbeat StreamMode = "heartbeat"
 )
 
 // EventType represents different types of events that can be emitted
@@ -49,6 +55,17 @@ const (
 
 	// EventChannelWrite emitted when writing to a state channel
 	EventChannelWrite EventType = "on_channel_write"
+
+	// EventHeartbeat emitted periodically while a node runs
+	EventHeartbeat EventType = "on_heartbeat"
+
+	// EventRoutingDecision emitted in debug mode after a router ran, with a
+	// RoutingDecision as data
+	EventRoutingDecision EventType = "on_routing_decision"
+
+	// EventRunMetadata emitted when a node records a value about the whole
+	// run, see SetRunMetadata
+	EventRunMetadata EventType = "on_run_metadata"
 )
 
 // Event represents a streaming event
@@ -68,7 +85,10 @@ type Event struct {
 	// Metadata contains additional information about the event
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 
-	// Data contains the event payload
+	// Data contains the event payload.
+	// In debug mode, node start and end events carry the node's serialized
+	// input and output state respectively, or {"error": ...} when the state
+	// couldn't be serialized.
 	Data json.RawMessage `json:"data,omitempty"`
 
 	// ParentIDs contains IDs of parent events
@@ -82,9 +102,27 @@ type Event struct {
 type StreamEvent struct {
 	Mode StreamMode
 	Data interface{}
+
+	// Metadata optionally describes where the data came from, such as the
+	// source of values frames carrying a human edit
+	Metadata map[string]interface{}
 }
 
-// Streamer manages streaming for a graph
+// Streamer manages streaming for a graph.
+//
+// The graph's event and stream channels are unbuffered and written from the
+// goroutine running the graph, so a consumer that receives from both in one
+// select loop sees everything in the order it was emitted. That order is:
+//
+//   - the initial value, then the graph's chain start event
+//   - for every step, the node's chain start event, anything the node emits
+//     while running, then its state update and draft frame, and only then
+//     the node's chain end event, followed by its routing decision
+//   - the final value, then the graph's chain end event
+//
+// InvokeStreaming merges both channels into one and keeps this order.
+// Stream delivers events and stream data on separate buffered channels, so
+// the order only holds within each channel.
 type Streamer[T any] struct {
 	// modes are the active streaming modes
 	modes []StreamMode
@@ -94,6 +132,9 @@ type Streamer[T any] struct {
 
 	// streamCh is the channel for streaming data
 	streamCh chan StreamEvent
+
+	// logger traces emitted events
+	logger Logger
 }
 
 // NewStreamer creates a new streamer with the specified modes
@@ -102,33 +143,61 @@ func NewStreamer[T any](modes []StreamMode) *Streamer[T] {
 		modes:    modes,
 		eventCh:  make(chan Event),
 		streamCh: make(chan StreamEvent),
+		logger:   NopLogger(),
 	}
 }
 
+// SetLogger sets the logger emitted events are traced to
+func (s *Streamer[T]) SetLogger(logger Logger) {
+	s.logger = logger
+}
+
 // EmitEvent emits an event to the event stream
 func (s *Streamer[T]) EmitEvent(evt Event) {
 	if s.hasMode(StreamDebug) {
+		s.logger.Debug("Emitting event", "event", evt.Type, "name", evt.Name, "run_id", evt.RunID)
 		s.eventCh <- evt
 	}
 }
 
-// EmitValue emits a state value to the stream
-func (s *Streamer[T]) EmitValue(state T) {
+// EmitValue emits a state value to the stream. It gives up when ctx is
+// done before the value is received.
+func (s *Streamer[T]) EmitValue(ctx context.Context, state T) {
 	if s.hasMode(StreamValues) {
-		s.streamCh <- StreamEvent{
+		s.send(ctx, StreamEvent{
 			Mode: StreamValues,
 			Data: state,
-		}
+		})
+	}
+}
+
+// emitEditedValue emits a state edited while the run was paused to the stream
+func (s *Streamer[T]) emitEditedValue(ctx context.Context, state T, metadata map[string]interface{}) {
+	if s.hasMode(StreamValues) {
+		s.send(ctx, StreamEvent{
+			Mode:     StreamValues,
+			Data:     state,
+			Metadata: metadata,
+		})
 	}
 }
 
-// EmitUpdate emits a state update to the stream
-func (s *Streamer[T]) EmitUpdate(update T) {
+// EmitUpdate emits a state update to the stream. It gives up when ctx is
+// done before the update is received.
+func (s *Streamer[T]) EmitUpdate(ctx context.Context, update T) {
 	if s.hasMode(StreamUpdates) {
-		s.streamCh <- StreamEvent{
+		s.send(ctx, StreamEvent{
 			Mode: StreamUpdates,
 			Data: update,
-		}
+		})
+	}
+}
+
+// send sends to the stream channel unless ctx is done first
+func (s *Streamer[T]) send(ctx context.Context, evt StreamEvent) {
+	select {
+	case s.streamCh <- evt:
+	case <-ctx.Done():
 	}
 }
 
@@ -142,6 +211,26 @@ func (s *Streamer[T]) EmitCustom(data T) {
 	}
 }
 
+// emitCustomValue emits arbitrary custom data to the stream
+func (s *Streamer[T]) emitCustomValue(data interface{}) {
+	if s.hasMode(StreamCustom) {
+		s.streamCh <- StreamEvent{
+			Mode: StreamCustom,
+			Data: data,
+		}
+	}
+}
+
+// emitMessageValue emits an arbitrary LLM message or chunk to the stream
+func (s *Streamer[T]) emitMessageValue(msg interface{}) {
+	if s.hasMode(StreamMessages) {
+		s.streamCh <- StreamEvent{
+			Mode: StreamMessages,
+			Data: msg,
+		}
+	}
+}
+
 // EmitMessage emits an LLM message to the stream
 func (s *Streamer[T]) EmitMessage(msg T) {
 	if s.hasMode(StreamMessages) {
@@ -162,6 +251,19 @@ func (s *Streamer[T]) GetStreamChannel() <-chan StreamEvent {
 	return s.streamCh
 }
 
+// discard receives and drops everything emitted to the streamer until done
+// is closed, for runs nobody is streaming
+func (s *Streamer[T]) discard(done <-chan struct{}) {
+	for {
+		select {
+		case <-s.eventCh:
+		case <-s.streamCh:
+		case <-done:
+			return
+		}
+	}
+}
+
 // hasMode checks if a mode is active
 func (s *Streamer[T]) hasMode(mode StreamMode) bool {
 	for _, m := range s.modes {
@@ -174,10 +276,86 @@ func (s *Streamer[T]) hasMode(mode StreamMode) bool {
 
 // Close closes all channels
 func (s *Streamer[T]) Close() {
+	s.logger.Debug("Closing streamer")
 	close(s.eventCh)
 	close(s.streamCh)
 }
 
+// streamWriter is the state type independent view of a Streamer that is
+// made available to node functions through their context
+type streamWriter interface {
+	EmitEvent(evt Event)
+	emitCustomValue(data interface{})
+	emitMessageValue(msg interface{})
+}
+
+type streamWriterKey struct{}
+
+// withStreamWriter returns a context carrying the graph's streamer
+func withStreamWriter(ctx context.Context, w streamWriter) context.Context {
+	return context.WithValue(ctx, streamWriterKey{}, w)
+}
+
+// EmitCustom emits custom data to the stream of the graph running the node.
+// It is a no-op when called outside of a graph run.
+func EmitCustom(ctx context.Context, data interface{}) {
+	if w, ok := ctx.Value(streamWriterKey{}).(streamWriter); ok {
+		w.emitCustomValue(data)
+	}
+}
+
+// EmitEvent emits an event to the event stream of the graph running the node.
+// It is a no-op when called outside of a graph run.
+func EmitEvent(ctx context.Context, evt Event) {
+	if w, ok := ctx.Value(streamWriterKey{}).(streamWriter); ok {
+		w.EmitEvent(evt)
+	}
+}
+
+// SetRunMetadata records a value about the run as a whole, such as a final
+// score, by emitting an EventRunMetadata named after the key. Recorders of
+// the run keep the last value of every key.
+func SetRunMetadata(ctx context.Context, key string, value interface{}) {
+	EmitEvent(ctx, Event{
+		Type:      EventRunMetadata,
+		Name:      key,
+		RunID:     RunIDFromContext(ctx),
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{key: value},
+	})
+}
+
+// EmitMessage emits an LLM message or MessageChunk to the messages stream of
+// the graph running the node. It is a no-op when called outside of a graph run.
+func EmitMessage(ctx context.Context, msg interface{}) {
+	if w, ok := ctx.Value(streamWriterKey{}).(streamWriter); ok {
+		w.emitMessageValue(msg)
+	}
+}
+
+// MessageChunkType distinguishes the parts of a streamed model response
+type MessageChunkType string
+
+const (
+	// ChunkContent is a piece of the final answer
+	ChunkContent MessageChunkType = "content"
+
+	// ChunkReasoning is a piece of the model's reasoning
+	ChunkReasoning MessageChunkType = "reasoning"
+)
+
+// MessageChunk is an incremental piece of a model response
+type MessageChunk struct {
+	// Type tells whether the chunk is answer content or reasoning
+	Type MessageChunkType `json:"type"`
+
+	// Name is the name of the agent producing the response
+	Name string `json:"name,omitempty"`
+
+	// Content is the text of the chunk
+	Content string `json:"content"`
+}
+
 // StreamConfig contains configuration for streaming
 type StreamConfig struct {
 	// Modes are the active streaming modes
@@ -185,12 +363,154 @@ type StreamConfig struct {
 
 	// BufferSize is the size of the stream channels
 	BufferSize int
+
+	// HeartbeatInterval is how often a heartbeat is sent on the stream while
+	// a node runs, to keep idle connections such as SSE open. Zero disables it.
+	HeartbeatInterval time.Duration
+
+	// EventHeartbeatInterval is how often an EventHeartbeat is sent on the
+	// event channel while a node runs, so clients can tell a slow node from a
+	// hung one. It only applies in debug mode. Zero disables it.
+	EventHeartbeatInterval time.Duration
+}
+
+// Heartbeat is the data of a StreamHeartbeat event
+type Heartbeat struct {
+	// Node is the node that is running
+	Node string `json:"node"`
+
+	// Elapsed is how long the node has been running
+	Elapsed time.Duration `json:"elapsed"`
+
+	// Tokens is the number of message chunks the node has streamed so far
+	Tokens int64 `json:"tokens,omitempty"`
+}
+
+// startHeartbeat sends heartbeats while a node runs until the returned
+// function is called. Stream heartbeats follow HeartbeatInterval and
+// heartbeat events on the event channel follow EventHeartbeatInterval.
+func (s *Streamer[T]) startHeartbeat(ctx context.Context, node string, config StreamConfig, tokens *atomic.Int64) func() {
+	streamTick := newHeartbeatTicker(config.HeartbeatInterval)
+	eventTick := newHeartbeatTicker(config.EventHeartbeatInterval)
+	if streamTick == nil && !(eventTick != nil && s.hasMode(StreamDebug)) {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer streamTick.stop()
+		defer eventTick.stop()
+
+		start := time.Now()
+		heartbeat := func() Heartbeat {
+			return Heartbeat{Node: node, Elapsed: time.Since(start), Tokens: tokens.Load()}
+		}
+
+		for {
+			var send func() bool
+			select {
+			case <-streamTick.c():
+				send = func() bool {
+					select {
+					case s.streamCh <- StreamEvent{Mode: StreamHeartbeat, Data: heartbeat()}:
+						return true
+					case <-stop:
+					case <-ctx.Done():
+					}
+					return false
+				}
+			case <-eventTick.c():
+				if !s.hasMode(StreamDebug) {
+					continue
+				}
+				send = func() bool {
+					hb := heartbeat()
+					metadata := map[string]interface{}{
+						"node":       hb.Node,
+						"elapsed_ms": hb.Elapsed.Milliseconds(),
+						"tokens":     hb.Tokens,
+					}
+					if variant := VariantFromContext(ctx); variant != "" {
+						metadata["variant"] = variant
+					}
+					select {
+					case s.eventCh <- Event{
+						Type:      EventHeartbeat,
+						Name:      node,
+						RunID:     RunIDFromContext(ctx),
+						Timestamp: time.Now(),
+						Metadata:  metadata,
+					}:
+						return true
+					case <-stop:
+					case <-ctx.Done():
+					}
+					return false
+				}
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+			if !send() {
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// heartbeatTicker is a ticker that may be disabled
+type heartbeatTicker struct {
+	ticker *time.Ticker
+}
+
+// newHeartbeatTicker returns a ticker for the interval, or nil when it is disabled
+func newHeartbeatTicker(interval time.Duration) *heartbeatTicker {
+	if interval <= 0 {
+		return nil
+	}
+	return &heartbeatTicker{ticker: time.NewTicker(interval)}
+}
+
+// c returns the tick channel, nil for a disabled ticker so it never fires
+func (t *heartbeatTicker) c() <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.ticker.C
+}
+
+func (t *heartbeatTicker) stop() {
+	if t != nil {
+		t.ticker.Stop()
+	}
+}
+
+// tokenCounter counts the message chunks a node streams
+type tokenCounter struct {
+	streamWriter
+	tokens *atomic.Int64
+}
+
+func (w *tokenCounter) emitMessageValue(msg interface{}) {
+	if _, ok := msg.(MessageChunk); ok {
+		w.tokens.Add(1)
+	}
+	w.streamWriter.emitMessageValue(msg)
 }
 
 // DefaultStreamConfig returns the default streaming configuration
 func DefaultStreamConfig() StreamConfig {
 	return StreamConfig{
-		Modes:      []StreamMode{StreamValues},
-		BufferSize: 100,
+		Modes:                  []StreamMode{StreamValues},
+		BufferSize:             100,
+		EventHeartbeatInterval: 10 * time.Second,
 	}
 }
@@ -0,0 +1,340 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func TestStreamDeliversFinalResult(t *testing.T) {
+	g := newGraph[int]()
+	g.AddNode("double", func(ctx context.Context, n int) (int, error) { return n * 2, nil })
+	chain(g, "double")
+	r := compile(t, g)
+
+	streamCh, eventCh, resultCh, err := r.Stream(context.Background(), 21)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	for range streamCh {
+	}
+	for range eventCh {
+	}
+	result := <-resultCh
+	if result.Err != nil || result.State != 42 {
+		t.Fatalf("result = %d, %v, want 42", result.State, result.Err)
+	}
+}
+
+func TestStreamErrorEventHasRunID(t *testing.T) {
+	boom := errors.New("boom")
+	g := newGraph[int]()
+	g.SetStreamConfig(core.StreamConfig{Modes: []core.StreamMode{core.StreamDebug}, BufferSize: 64})
+	g.AddNode("fail", func(ctx context.Context, n int) (int, error) { return n, boom })
+	chain(g, "fail")
+	r := compile(t, g)
+
+	streamCh, eventCh, resultCh, err := r.Stream(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	go func() {
+		for range streamCh {
+		}
+	}()
+	var events []core.Event
+	for evt := range eventCh {
+		events = append(events, evt)
+	}
+	if result := <-resultCh; !errors.Is(result.Err, boom) {
+		t.Fatalf("result error = %v, want boom", result.Err)
+	}
+
+	if len(events) < 2 {
+		t.Fatalf("events = %v, want the run's events and its error", events)
+	}
+	runID := events[0].RunID
+	last := events[len(events)-1]
+	if last.Metadata["error"] == nil {
+		t.Fatalf("last event %+v is not the error", last)
+	}
+	if runID == "" || last.RunID != runID {
+		t.Errorf("error event run ID = %q, want the run's %q", last.RunID, runID)
+	}
+}
+
+func TestDebugEventsCarryNodeInputAndOutput(t *testing.T) {
+	g := debugGraph[int]()
+	g.AddNode("double", func(ctx context.Context, n int) (int, error) { return n * 2, nil })
+	chain(g, "double")
+	r := compile(t, g)
+
+	events, _ := runEvents(t, r, 21)
+	payloads := make(map[core.EventType]string)
+	for _, evt := range events {
+		if evt.Name == "double" {
+			payloads[evt.Type] = string(evt.Data)
+		}
+	}
+	if payloads[core.EventChainStart] != "21" {
+		t.Errorf("start event data = %q, want the input 21", payloads[core.EventChainStart])
+	}
+	if payloads[core.EventChainEnd] != "42" {
+		t.Errorf("end event data = %q, want the output 42", payloads[core.EventChainEnd])
+	}
+}
+
+func TestInvokeStreamingReturnsTerminalState(t *testing.T) {
+	g := core.NewStateGraph[int]()
+	g.SetStreamConfig(core.StreamConfig{Modes: []core.StreamMode{core.StreamValues}, BufferSize: 64})
+	g.AddNode("inc", func(ctx context.Context, n int) (int, error) { return n + 1, nil })
+	g.AddNode("double", func(ctx context.Context, n int) (int, error) { return n * 2, nil })
+	chain(g, "inc", "double")
+	r := compile(t, g)
+
+	// Nobody reads the intermediate events
+	_, wait := r.InvokeStreaming(context.Background(), 1)
+	out, err := wait()
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if out != 4 {
+		t.Errorf("result = %d, want 4", out)
+	}
+}
+
+func TestInvokeStreamingReturnsError(t *testing.T) {
+	boom := errors.New("boom")
+	g := newGraph[int]()
+	g.AddNode("fail", func(ctx context.Context, n int) (int, error) { return n, boom })
+	chain(g, "fail")
+	r := compile(t, g)
+
+	events, wait := r.InvokeStreaming(context.Background(), 1)
+	for range events {
+	}
+	if _, err := wait(); !errors.Is(err, boom) {
+		t.Errorf("wait = %v, want boom", err)
+	}
+}
+
+func TestHeartbeatsOnlyWhileNodeRuns(t *testing.T) {
+	g := core.NewStateGraph[int]()
+	g.SetStreamConfig(core.StreamConfig{BufferSize: 256, HeartbeatInterval: 10 * time.Millisecond})
+	g.AddNode("slow", func(ctx context.Context, n int) (int, error) {
+		time.Sleep(100 * time.Millisecond)
+		return n, nil
+	})
+	g.AddNode("fast", func(ctx context.Context, n int) (int, error) { return n, nil })
+	chain(g, "slow", "fast")
+	r := compile(t, g)
+
+	events, wait := r.InvokeStreaming(context.Background(), 1)
+	beats := make(map[string]int)
+	for evt := range events {
+		if evt.Mode == core.StreamHeartbeat {
+			beats[evt.Data.(core.Heartbeat).Node]++
+		}
+	}
+	if _, err := wait(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if beats["slow"] < 3 {
+		t.Errorf("%d heartbeats during the slow node, want several", beats["slow"])
+	}
+	if beats["fast"] > 1 {
+		t.Errorf("%d heartbeats during the fast node", beats["fast"])
+	}
+
+	// Nothing keeps beating once the run is over
+	select {
+	case evt := <-g.GetStreamChannel():
+		t.Errorf("stream event %+v after the run ended", evt)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestUnreadValuesDontOutliveTheContext(t *testing.T) {
+	// The default graph streams values, which nobody reads here
+	g := core.NewStateGraph[int]()
+	g.AddNode("double", func(ctx context.Context, n int) (int, error) { return n * 2, nil })
+	chain(g, "double")
+	r := compile(t, g)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Invoke(ctx, 21)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Invoke still blocked on the stream after its context was done")
+	}
+}
+
+func TestStreamOrderOfTwoNodeRun(t *testing.T) {
+	g := core.NewStateGraph[int]()
+	g.SetStreamConfig(core.StreamConfig{Modes: []core.StreamMode{core.StreamValues, core.StreamUpdates, core.StreamDebug}, BufferSize: 256})
+	g.AddNode("a", func(ctx context.Context, n int) (int, error) { return n + 1, nil })
+	g.AddNode("b", func(ctx context.Context, n int) (int, error) { return n * 10, nil })
+	chain(g, "a", "b")
+	r := compile(t, g)
+
+	want := "value 1, start LangGraph, start a, update 2, end a, start b, update 20, end b, value 20, end LangGraph"
+	// The order must hold on every run, not just most of them
+	for i := 0; i < 20; i++ {
+		stream, wait := r.InvokeStreaming(context.Background(), 1)
+		var got []string
+		for evt := range stream {
+			switch data := evt.Data.(type) {
+			case core.Event:
+				switch data.Type {
+				case core.EventChainStart:
+					got = append(got, "start "+data.Name)
+				case core.EventChainEnd:
+					got = append(got, "end "+data.Name)
+				}
+			case int:
+				got = append(got, fmt.Sprintf("%s %d", map[core.StreamMode]string{core.StreamValues: "value", core.StreamUpdates: "update"}[evt.Mode], data))
+			}
+		}
+		if _, err := wait(); err != nil {
+			t.Fatalf("InvokeStreaming: %v", err)
+		}
+		if strings.Join(got, ", ") != want {
+			t.Fatalf("run %d streamed %s, want %s", i, strings.Join(got, ", "), want)
+		}
+	}
+}
+
+func TestRoutingDecisionShowsMapping(t *testing.T) {
+	route := func(g *core.StateGraph[int]) {
+		g.AddNode("a", func(ctx context.Context, n int) (int, error) { return n, nil })
+		g.AddNode("b", func(ctx context.Context, n int) (int, error) { return n, nil })
+		g.SetEntryPoint("a")
+		g.AddConditionalEdges("a", func(int) ([]string, error) { return []string{"go"}, nil }, map[string]string{"go": "b"})
+		g.AddConditionalEdges("b", to[int](core.END), nil)
+	}
+
+	g := debugGraph[int]()
+	route(g)
+	events, _ := runEvents(t, compile(t, g), 1)
+	var decisions []core.RoutingDecision
+	for _, evt := range events {
+		if evt.Type != core.EventRoutingDecision {
+			continue
+		}
+		var decision core.RoutingDecision
+		if err := json.Unmarshal(evt.Data, &decision); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		decisions = append(decisions, decision)
+	}
+	if len(decisions) != 2 {
+		t.Fatalf("got %d routing decisions, want one per node", len(decisions))
+	}
+	if d := decisions[0]; d.From != "a" || strings.Join(d.RouterOutput, ",") != "go" || strings.Join(d.Targets, ",") != "b" || d.Next != "b" {
+		t.Errorf("decision = %+v, want go translated to b", d)
+	}
+
+	// Without StreamDebug routing stays out of the stream
+	g = core.NewStateGraph[int]()
+	g.SetStreamConfig(core.StreamConfig{Modes: []core.StreamMode{core.StreamValues}, BufferSize: 64})
+	route(g)
+	stream, wait := compile(t, g).InvokeStreaming(context.Background(), 1)
+	for evt := range stream {
+		if _, ok := evt.Data.(core.Event); ok {
+			t.Errorf("event %+v streamed without StreamDebug", evt.Data)
+		}
+	}
+	if _, err := wait(); err != nil {
+		t.Fatalf("InvokeStreaming: %v", err)
+	}
+}
+
+func TestDroppedEventsReachDeadLetterSink(t *testing.T) {
+	g := core.NewStateGraph[int]()
+	g.SetStreamConfig(core.StreamConfig{Modes: []core.StreamMode{core.StreamDebug}, BufferSize: 2})
+	var dropped []core.Event
+	g.SetDeadLetterSink(func(evt core.Event) {
+		dropped = append(dropped, evt)
+	})
+	for _, node := range []string{"a", "b", "c"} {
+		g.AddNode(node, func(ctx context.Context, n int) (int, error) { return n + 1, nil })
+	}
+	chain(g, "a", "b", "c")
+	r := compile(t, g)
+
+	// Nothing reads the stream until the run is over, so everything beyond
+	// the first two events finds the buffer full
+	stream, wait := r.InvokeStreaming(context.Background(), 0)
+	if _, err := wait(); err != nil {
+		t.Fatalf("InvokeStreaming: %v", err)
+	}
+	var delivered []core.Event
+	for evt := range stream {
+		delivered = append(delivered, evt.Data.(core.Event))
+	}
+
+	if len(delivered) != 2 {
+		t.Fatalf("delivered %d events, want a full buffer of 2", len(delivered))
+	}
+	if len(dropped) == 0 {
+		t.Fatal("no dropped event reached the dead-letter sink")
+	}
+	if last := dropped[len(dropped)-1]; last.Type != core.EventChainEnd {
+		t.Errorf("last dropped event = %s %s, want the run's end, the newest events are dropped", last.Type, last.Name)
+	}
+	seen := make(map[string]bool)
+	for _, evt := range append(delivered, dropped...) {
+		key := fmt.Sprintf("%s/%s/%v", evt.Type, evt.Name, evt.Timestamp)
+		if seen[key] {
+			t.Errorf("event %s both delivered and dropped", key)
+		}
+		seen[key] = true
+	}
+}
+
+// unencodable is a state the JSON codec can't serialize
+type unencodable struct {
+	N    int
+	Done func()
+}
+
+func TestDebugEventsMarkUnserializableState(t *testing.T) {
+	logger := newRecordingLogger()
+	g := debugGraph[unencodable]()
+	g.SetLogger(logger)
+	g.AddNode("bump", func(ctx context.Context, s unencodable) (unencodable, error) { s.N++; return s, nil })
+	chain(g, "bump")
+	r := compile(t, g)
+
+	events, _ := runEvents(t, r, unencodable{})
+	var marked int
+	for _, evt := range events {
+		if evt.Name != "bump" || evt.Type != core.EventChainStart && evt.Type != core.EventChainEnd {
+			continue
+		}
+		var marker struct{ Error string }
+		if err := json.Unmarshal(evt.Data, &marker); err != nil || marker.Error == "" {
+			t.Errorf("%s event data = %s, want an error marker", evt.Type, evt.Data)
+			continue
+		}
+		marked++
+	}
+	if marked != 2 {
+		t.Errorf("%d events marked, want the node's start and end", marked)
+	}
+	if _, ok := logger.find("Failed to serialize state for a debug event"); !ok {
+		t.Error("the serialization error wasn't logged")
+	}
+}
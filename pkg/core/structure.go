@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GraphStructure describes the nodes and edges of a graph, for documentation
+// and visualization
+type GraphStructure struct {
+	// Name is the name of the graph
+	Name string `json:"name"`
+
+	// EntryPoint is the node runs start at
+	EntryPoint string `json:"entry_point"`
+
+	// Nodes are the node names in alphabetical order
+	Nodes []string `json:"nodes"`
+
+	// Edges are the possible transitions between nodes
+	Edges []StructureEdge `json:"edges"`
+
+	// DataFlow are the state fields nodes hand to each other, derived from
+	// the fields they declare to read and write
+	DataFlow []DataFlowEdge `json:"data_flow,omitempty"`
+}
+
+// DataFlowEdge is a set of state fields one node writes and another reads
+type DataFlowEdge struct {
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Fields []string `json:"fields"`
+}
+
+// StructureEdge is a possible transition between nodes
+type StructureEdge struct {
+	// From is the node the edge leaves
+	From string `json:"from"`
+
+	// To is the node the edge leads to. It is empty when the router has no
+	// mapping, so any node may follow.
+	To string `json:"to,omitempty"`
+
+	// Label is the router output mapped to To
+	Label string `json:"label,omitempty"`
+}
+
+// Structure returns the nodes and edges of the graph. Only routes listed in
+// an edge mapping are known; routers without a mapping are shown as leading
+// to any node.
+func (g *StateGraph[T]) Structure() GraphStructure {
+	s := GraphStructure{
+		Name:       g.name,
+		EntryPoint: g.entryPoint,
+		Nodes:      make([]string, 0, len(g.nodes)),
+	}
+	for name := range g.nodes {
+		s.Nodes = append(s.Nodes, name)
+	}
+	sort.Strings(s.Nodes)
+
+	for _, edge := range g.edges {
+		if len(edge.Mapping) == 0 {
+			s.Edges = append(s.Edges, StructureEdge{From: edge.From})
+			continue
+		}
+		labels := make([]string, 0, len(edge.Mapping))
+		for label := range edge.Mapping {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			s.Edges = append(s.Edges, StructureEdge{From: edge.From, To: edge.Mapping[label], Label: label})
+		}
+	}
+	s.DataFlow = g.dataFlow(s.Nodes)
+	return s
+}
+
+// dataFlow pairs the nodes that declare writing a field with the nodes that
+// declare reading it
+func (g *StateGraph[T]) dataFlow(nodes []string) []DataFlowEdge {
+	var flow []DataFlowEdge
+	for _, from := range nodes {
+		writes := g.nodeOptions[from].Writes
+		if len(writes) == 0 {
+			continue
+		}
+		for _, to := range nodes {
+			if to == from {
+				continue
+			}
+			reads := make(map[string]bool)
+			for _, field := range g.nodeOptions[to].Reads {
+				reads[field] = true
+			}
+			var fields []string
+			for _, field := range writes {
+				if reads[field] {
+					fields = append(fields, field)
+				}
+			}
+			if len(fields) > 0 {
+				sort.Strings(fields)
+				flow = append(flow, DataFlowEdge{From: from, To: to, Fields: fields})
+			}
+		}
+	}
+	return flow
+}
+
+// Mermaid renders the structure as a Mermaid flowchart
+func (s GraphStructure) Mermaid() string {
+	// "end" is a Mermaid keyword, so the terminals get other IDs
+	ids := map[string]string{START: "startNode", END: "endNode"}
+	for i, name := range s.Nodes {
+		ids[name] = fmt.Sprintf("n%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	b.WriteString("    startNode([START])\n")
+	for _, name := range s.Nodes {
+		fmt.Fprintf(&b, "    %s[%q]\n", ids[name], name)
+	}
+	b.WriteString("    endNode([END])\n")
+
+	if id, ok := ids[s.EntryPoint]; ok {
+		fmt.Fprintf(&b, "    startNode --> %s\n", id)
+	}
+
+	anyNode := false
+	for _, edge := range s.Edges {
+		from, ok := ids[edge.From]
+		if !ok {
+			continue
+		}
+		if edge.To == "" {
+			fmt.Fprintf(&b, "    %s -.-> any\n", from)
+			anyNode = true
+			continue
+		}
+		to, ok := ids[edge.To]
+		if !ok {
+			continue
+		}
+		if edge.Label != "" && edge.Label != edge.To {
+			fmt.Fprintf(&b, "    %s -->|%q| %s\n", from, edge.Label, to)
+		} else {
+			fmt.Fprintf(&b, "    %s --> %s\n", from, to)
+		}
+	}
+	if anyNode {
+		b.WriteString("    any{{\"any node\"}}\n")
+	}
+
+	for _, flow := range s.DataFlow {
+		from, okFrom := ids[flow.From]
+		to, okTo := ids[flow.To]
+		if okFrom && okTo {
+			fmt.Fprintf(&b, "    %s -.->|%q| %s\n", from, strings.Join(flow.Fields, ", "), to)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSuspended is returned by a run that a node suspended until an external
+// event resumes its thread
+var ErrSuspended = errors.New("run suspended")
+
+// EventWait is the wait for an external event a suspended thread is saved
+// with
+type EventWait struct {
+	// Event is the name of the awaited event
+	Event string `json:"event"`
+
+	// Deadline is when the wait expires, zero when it never does
+	Deadline time.Time `json:"deadline,omitempty"`
+}
+
+// SuspendError is returned by a node to suspend its run until an external
+// event arrives. The thread is saved with the wait and continues at the
+// node, which runs again from the same state, when it is resumed with
+// ResumeThread. Only runs that save their thread can be suspended, see
+// CanSuspend.
+type SuspendError struct {
+	Wait EventWait
+}
+
+func (e *SuspendError) Error() string {
+	return fmt.Sprintf("%s waiting for event %s", ErrSuspended, e.Wait.Event)
+}
+
+func (e *SuspendError) Unwrap() error {
+	return ErrSuspended
+}
+
+type suspendableKey struct{}
+
+type resumedWaitKey struct{}
+
+// CanSuspend reports whether the run of ctx saves its thread, so a node can
+// suspend it by returning a SuspendError
+func CanSuspend(ctx context.Context) bool {
+	suspendable, _ := ctx.Value(suspendableKey{}).(bool)
+	return suspendable
+}
+
+// ResumedWait returns the wait the thread was suspended on, when the node
+// runs again because its thread was resumed
+func ResumedWait(ctx context.Context) (EventWait, bool) {
+	wait, ok := ctx.Value(resumedWaitKey{}).(EventWait)
+	return wait, ok
+}
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrThreadNotFound is returned when loading a thread that was never saved
+	ErrThreadNotFound = errors.New("thread not found")
+
+	// ErrNoThreadStore is returned when resuming a thread of a graph without
+	// a thread store
+	ErrNoThreadStore = errors.New("graph has no thread store")
+)
+
+// threadNamespace is the store namespace threads are saved under
+const threadNamespace = "threads"
+
+// Thread is everything saved for a conversation thread: where its graph run
+// stands and the conversation history of its agents
+type Thread struct {
+	ID string `json:"id"`
+
+	// Node is the node the run continues with, empty once the run finished
+	Node string `json:"node,omitempty"`
+
+	// Step is the number of steps the run took so far
+	Step int `json:"step"`
+
+	// State is the graph state after the last step, encoded with Codec
+	State json.RawMessage `json:"state,omitempty"`
+	Codec string          `json:"codec,omitempty"`
+
+	// Messages is the conversation history agents keep for the thread
+	Messages []Message `json:"messages,omitempty"`
+
+	// Wait is the event a suspended run waits for, nil unless a node
+	// suspended the run (see SuspendError)
+	Wait *EventWait `json:"wait,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ThreadStore keeps the graph checkpoint and the conversation history of
+// each thread in a single record, so the two can't get out of sync. Graphs
+// use it through SetThreadStore and agents as their memory store (see
+// agent.WithMemoryStore), both keyed by the thread ID of the run context.
+//
+// Consistency: agents stage the history they save in the ThreadStore, and
+// the graph commits it together with its state and position with a single
+// Put after every step. A thread is therefore always restored as it was
+// after a completed step; history staged by a step that didn't complete is
+// dropped when the thread is loaded, and the step runs again on resume.
+// Agents used outside a graph run must commit their history with
+// SaveThread themselves.
+type ThreadStore struct {
+	store Store
+
+	// mu serializes saves and guards staged
+	mu     sync.Mutex
+	staged map[string][]Message
+}
+
+// NewThreadStore creates a thread store saving threads in store, or in
+// memory when store is nil
+func NewThreadStore(store Store) *ThreadStore {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &ThreadStore{store: store, staged: make(map[string][]Message)}
+}
+
+// LoadThread returns the thread as it was last saved, dropping history
+// agents staged since
+func (s *ThreadStore) LoadThread(ctx context.Context, threadID string) (*Thread, error) {
+	s.mu.Lock()
+	delete(s.staged, threadID)
+	s.mu.Unlock()
+	return s.load(ctx, threadID)
+}
+
+// SavedThread returns the thread as it was last saved, leaving history
+// agents staged since in place, for inspecting threads that may be running
+func (s *ThreadStore) SavedThread(ctx context.Context, threadID string) (*Thread, error) {
+	return s.load(ctx, threadID)
+}
+
+// SaveThread saves the thread in one write. History agents staged for the
+// thread is saved with it unless the thread sets Messages; without either
+// the history saved before is kept.
+func (s *ThreadStore) SaveThread(ctx context.Context, thread *Thread) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := *thread
+	staged, hasStaged := s.staged[thread.ID]
+	if record.Messages == nil {
+		if hasStaged {
+			record.Messages = staged
+		} else if saved, err := s.load(ctx, thread.ID); err == nil {
+			record.Messages = saved.Messages
+		} else if !errors.Is(err, ErrThreadNotFound) {
+			return err
+		}
+	}
+	record.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode thread %s: %w", thread.ID, err)
+	}
+	if err := s.store.Put(ctx, threadNamespace, thread.ID, data); err != nil {
+		return fmt.Errorf("failed to save thread %s: %w", thread.ID, err)
+	}
+	if hasStaged {
+		delete(s.staged, thread.ID)
+	}
+	return nil
+}
+
+// Load returns the history of the thread, including history staged since
+// it was last saved, for agents using the store as their memory store
+func (s *ThreadStore) Load(threadID string) []Message {
+	s.mu.Lock()
+	staged, ok := s.staged[threadID]
+	s.mu.Unlock()
+	if ok {
+		return append([]Message(nil), staged...)
+	}
+	thread, err := s.load(context.Background(), threadID)
+	if err != nil {
+		return nil
+	}
+	return thread.Messages
+}
+
+// Save stages the history of the thread until the thread is next saved
+func (s *ThreadStore) Save(threadID string, msgs []Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.staged[threadID] = append([]Message(nil), msgs...)
+}
+
+// load reads a saved thread
+func (s *ThreadStore) load(ctx context.Context, threadID string) (*Thread, error) {
+	data, ok, err := s.store.Get(ctx, threadNamespace, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load thread %s: %w", threadID, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrThreadNotFound, threadID)
+	}
+	var thread Thread
+	if err := json.Unmarshal(data, &thread); err != nil {
+		return nil, fmt.Errorf("failed to decode thread %s: %w", threadID, err)
+	}
+	return &thread, nil
+}
+
+// SetThreadStore makes runs whose context carries a thread ID (see
+// WithThreadID) save their thread after every step, so they can be
+// continued with ResumeThread
+func (g *StateGraph[T]) SetThreadStore(store *ThreadStore) {
+	g.threads = store
+}
+
+// ResumeThread continues the saved run of a thread from the node it stopped
+// at, with the state and conversation history saved after its last
+// completed step. A thread whose run finished returns its final state.
+func (r *RunnableState[T]) ResumeThread(ctx context.Context, threadID string) (T, error) {
+	var zero T
+	if r.graph.threads == nil {
+		return zero, ErrNoThreadStore
+	}
+	thread, err := r.graph.threads.LoadThread(ctx, threadID)
+	if err != nil {
+		return zero, err
+	}
+	if err := CheckCodec(r.graph.codec, thread.Codec); err != nil {
+		return zero, err
+	}
+	state, err := DecodeState(r.graph.codec, thread.State)
+	if err != nil {
+		return zero, fmt.Errorf("failed to decode state of thread %s: %w", threadID, err)
+	}
+	if thread.Node == "" {
+		return state, nil
+	}
+	return r.InvokeWithConfig(WithThreadID(ctx, threadID), state, InvokeConfig{
+		from: &threadPosition{node: thread.Node, step: thread.Step, wait: thread.Wait},
+	})
+}
+
+// threadPosition is where a resumed thread continues
+type threadPosition struct {
+	node string
+	step int
+
+	// wait is the wait the thread was suspended on, if any
+	wait *EventWait
+}
+
+// savesThread reports whether the run saves its thread after every step
+func (r *RunnableState[T]) savesThread(ctx context.Context) bool {
+	return r.graph.threads != nil && ThreadIDFromContext(ctx) != ""
+}
+
+// ThreadStore returns the graph's thread store, nil when it has none
+func (g *StateGraph[T]) ThreadStore() *ThreadStore {
+	return g.threads
+}
+
+// saveThread saves the run's thread after a step, if the graph has a thread
+// store and the run belongs to a thread. A run suspended at next is saved
+// with its wait.
+func (r *RunnableState[T]) saveThread(ctx context.Context, next string, step int, state *encodedState[T], wait *EventWait) error {
+	if !r.savesThread(ctx) {
+		return nil
+	}
+	threadID := ThreadIDFromContext(ctx)
+	if next == END {
+		next = ""
+	}
+	encoded, err := state.json()
+	if err != nil {
+		return fmt.Errorf("failed to encode state of thread %s: %w", threadID, err)
+	}
+	return r.graph.threads.SaveThread(ctx, &Thread{
+		ID:    threadID,
+		Node:  next,
+		Step:  step,
+		State: encoded,
+		Codec: r.graph.codec.Name(),
+		Wait:  wait,
+	})
+}
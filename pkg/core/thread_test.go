@@ -0,0 +1,97 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// say appends a message to the thread's history the way an agent using the
+// thread store as its memory does
+func say(ctx context.Context, store *core.ThreadStore, content string) {
+	threadID := core.ThreadIDFromContext(ctx)
+	history := store.Load(threadID)
+	store.Save(threadID, append(history, core.Message{Role: core.RoleAssistant, Content: content}))
+}
+
+func TestResumeThreadRestoresStateAndHistory(t *testing.T) {
+	store := core.NewThreadStore(nil)
+	errDown := errors.New("model down")
+	down := true
+	var greeted int
+	var history []core.Message
+
+	g := newGraph[ticket]()
+	g.SetThreadStore(store)
+	g.AddNode("greet", func(ctx context.Context, s ticket) (ticket, error) {
+		greeted++
+		say(ctx, store, "hello")
+		s.Status = "greeted"
+		return s, nil
+	})
+	g.AddNode("answer", func(ctx context.Context, s ticket) (ticket, error) {
+		say(ctx, store, "half an answer")
+		if down {
+			return s, errDown
+		}
+		history = store.Load(core.ThreadIDFromContext(ctx))
+		s.Priority = 1
+		return s, nil
+	})
+	chain(g, "greet", "answer")
+	r := compile(t, g)
+
+	ctx := core.WithThreadID(context.Background(), "thread-1")
+	if _, err := r.Invoke(ctx, ticket{Title: "t"}); !errors.Is(err, errDown) {
+		t.Fatalf("Invoke = %v, want the answer node's error", err)
+	}
+	thread, err := store.LoadThread(context.Background(), "thread-1")
+	if err != nil {
+		t.Fatalf("LoadThread: %v", err)
+	}
+	if thread.Node != "answer" || len(thread.Messages) != 1 || thread.Messages[0].Content != "hello" {
+		t.Fatalf("thread = %+v, want it at answer with greet's history only", thread)
+	}
+
+	down = false
+	out, err := r.ResumeThread(context.Background(), "thread-1")
+	if err != nil {
+		t.Fatalf("ResumeThread: %v", err)
+	}
+	if greeted != 1 {
+		t.Errorf("greet ran %d times, want the resumed run to start at answer", greeted)
+	}
+	if want := (ticket{Title: "t", Priority: 1, Status: "greeted"}); out != want {
+		t.Errorf("result = %+v, want %+v", out, want)
+	}
+	if len(history) != 2 || history[0].Content != "hello" || history[1].Content != "half an answer" {
+		t.Errorf("answer saw history %+v, want greet's and its own message once", history)
+	}
+
+	thread, err = store.LoadThread(context.Background(), "thread-1")
+	if err != nil {
+		t.Fatalf("LoadThread: %v", err)
+	}
+	if thread.Node != "" || len(thread.Messages) != 2 {
+		t.Errorf("finished thread = %+v, want no next node and both messages", thread)
+	}
+	if out, err := r.ResumeThread(context.Background(), "thread-1"); err != nil || out.Priority != 1 {
+		t.Errorf("resuming a finished thread = %+v, %v, want its final state", out, err)
+	}
+}
+
+func TestResumeUnknownThread(t *testing.T) {
+	g := newGraph[ticket]()
+	g.AddNode("greet", func(ctx context.Context, s ticket) (ticket, error) { return s, nil })
+	chain(g, "greet")
+	if _, err := compile(t, g).ResumeThread(context.Background(), "thread-1"); !errors.Is(err, core.ErrNoThreadStore) {
+		t.Errorf("ResumeThread without a store = %v, want ErrNoThreadStore", err)
+	}
+
+	g.SetThreadStore(core.NewThreadStore(nil))
+	if _, err := compile(t, g).ResumeThread(context.Background(), "thread-1"); !errors.Is(err, core.ErrThreadNotFound) {
+		t.Errorf("ResumeThread of an unsaved thread = %v, want ErrThreadNotFound", err)
+	}
+}
@@ -24,6 +24,30 @@ type Tool interface {
 	Validate(args map[string]interface{}) error
 }
 
+// ResultTransformer rewrites a tool result before it is added to an agent's
+// history, for example to truncate or summarize very large outputs
+type ResultTransformer func(toolName string, result interface{}) (interface{}, error)
+
+// TruncateResult returns a ResultTransformer that caps the string form of a
+// result at maxChars characters, replacing the remainder with an elision marker.
+// A negative maxChars truncates everything.
+func TruncateResult(maxChars int) ResultTransformer {
+	if maxChars < 0 {
+		maxChars = 0
+	}
+	return func(toolName string, result interface{}) (interface{}, error) {
+		s, ok := result.(string)
+		if !ok {
+			s = fmt.Sprintf("%v", result)
+		}
+		runes := []rune(s)
+		if len(runes) <= maxChars {
+			return result, nil
+		}
+		return fmt.Sprintf("%s... [truncated %d characters]", string(runes[:maxChars]), len(runes)-maxChars), nil
+	}
+}
+
 // BaseTool provides common functionality for tools
 type BaseTool struct {
 	name        string
@@ -62,8 +86,14 @@ func validateType(value interface{}, expectedType string) bool {
 		_, ok := value.(float64)
 		return ok
 	case "integer":
-		_, ok := value.(int)
-		return ok
+		switch v := value.(type) {
+		case int:
+			return true
+		case float64:
+			// Numbers decoded from JSON are always float64
+			return v == float64(int64(v))
+		}
+		return false
 	case "boolean":
 		_, ok := value.(bool)
 		return ok
@@ -79,13 +109,19 @@ func validateType(value interface{}, expectedType string) bool {
 
 // Validate checks if the arguments match the tool's schema
 func (t *BaseTool) Validate(args map[string]interface{}) error {
-	properties, ok := t.schema["properties"].(map[string]interface{})
+	return ValidateSchema(t.schema, args)
+}
+
+// ValidateSchema checks if the values match an object schema with properties,
+// required fields, types and enums
+func ValidateSchema(schema map[string]interface{}, args map[string]interface{}) error {
+	properties, ok := schema["properties"].(map[string]interface{})
 	if !ok {
 		return fmt.Errorf("invalid schema: missing or invalid properties")
 	}
 
 	required := make(map[string]bool)
-	if req, ok := t.schema["required"].([]string); ok {
+	if req, ok := schema["required"].([]string); ok {
 		for _, field := range req {
 			required[field] = true
 		}
@@ -0,0 +1,33 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func TestTruncateResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxChars int
+		result   interface{}
+		want     interface{}
+	}{
+		{"short", 10, "hello", "hello"},
+		{"long", 3, "héllo", "hél... [truncated 2 characters]"},
+		{"not a string", 2, 12345, "12... [truncated 3 characters]"},
+		{"zero", 0, "hello", "... [truncated 5 characters]"},
+		{"negative", -1, "hello", "... [truncated 5 characters]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := core.TruncateResult(tt.maxChars)("tool", tt.result)
+			if err != nil {
+				t.Fatalf("TruncateResult: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("TruncateResult(%d)(%v) = %v, want %v", tt.maxChars, tt.result, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ToolCallRecord is a tool call an agent made during a run
+type ToolCallRecord struct {
+	// Node is the node the call was made in
+	Node string `json:"node"`
+
+	// Tool is the name of the tool
+	Tool string `json:"tool"`
+
+	// Arguments are the raw JSON arguments the model passed
+	Arguments string `json:"arguments"`
+
+	// Result is the result handed back to the model
+	Result string `json:"result,omitempty"`
+
+	// Error is set when the call failed
+	Error string `json:"error,omitempty"`
+
+	// Start is when the call started
+	Start time.Time `json:"start"`
+
+	// Duration is how long the call took
+	Duration time.Duration `json:"duration"`
+}
+
+// ToolTrace records every tool call made by any agent during a run, in the
+// order the calls started. Pass one in InvokeConfig.ToolTrace and read the
+// calls once the run finishes. Runs without one record nothing.
+type ToolTrace struct {
+	mu    sync.Mutex
+	calls []ToolCallRecord
+}
+
+// NewToolTrace creates an empty tool trace
+func NewToolTrace() *ToolTrace {
+	return &ToolTrace{}
+}
+
+// Calls returns the recorded tool calls ordered by start time
+func (t *ToolTrace) Calls() []ToolCallRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]ToolCallRecord(nil), t.calls...)
+}
+
+// record inserts a call, keeping calls ordered by start time even when
+// concurrent calls finish out of order
+func (t *ToolTrace) record(call ToolCallRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := len(t.calls)
+	for i > 0 && t.calls[i-1].Start.After(call.Start) {
+		i--
+	}
+	t.calls = append(t.calls, ToolCallRecord{})
+	copy(t.calls[i+1:], t.calls[i:])
+	t.calls[i] = call
+}
+
+type toolTraceKey struct{}
+
+// WithToolTrace returns a context carrying the tool trace of a run
+func WithToolTrace(ctx context.Context, trace *ToolTrace) context.Context {
+	return context.WithValue(ctx, toolTraceKey{}, trace)
+}
+
+// ToolTraceFromContext returns the tool trace of the run, or nil
+func ToolTraceFromContext(ctx context.Context) *ToolTrace {
+	trace, _ := ctx.Value(toolTraceKey{}).(*ToolTrace)
+	return trace
+}
+
+// RecordToolCall adds a tool call to the trace of the run, filling in the
+// node it was made in. It does nothing when the run has no trace.
+func RecordToolCall(ctx context.Context, call ToolCallRecord) {
+	trace := ToolTraceFromContext(ctx)
+	if trace == nil {
+		return
+	}
+	if call.Node == "" {
+		call.Node = NodeFromContext(ctx)
+	}
+	trace.record(call)
+}
+
+type nodeKey struct{}
+
+type stepKey struct{}
+
+// withNode returns a context carrying the name and step of the running node
+func withNode(ctx context.Context, name string, step int) context.Context {
+	ctx = context.WithValue(ctx, nodeKey{}, name)
+	return context.WithValue(ctx, stepKey{}, step)
+}
+
+// NodeFromContext returns the name of the node the context runs in, or ""
+func NodeFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(nodeKey{}).(string)
+	return name
+}
+
+// StepFromContext returns the step of the node the context runs in. It
+// reports false outside of a node.
+func StepFromContext(ctx context.Context) (int, bool) {
+	step, ok := ctx.Value(stepKey{}).(int)
+	return step, ok
+}
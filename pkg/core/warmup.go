@@ -0,0 +1,86 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrNodeInit is returned when a node's init function fails
+	ErrNodeInit = errors.New("node init failed")
+)
+
+// nodeInit is the one-time setup of a node
+type nodeInit struct {
+	fn func(ctx context.Context) error
+
+	mu   sync.Mutex
+	done bool
+}
+
+// run calls the init function unless it already succeeded
+func (i *nodeInit) run(ctx context.Context, name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.done {
+		return nil
+	}
+	if err := i.fn(ctx); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrNodeInit, name, err)
+	}
+	i.done = true
+	return nil
+}
+
+// AddNodeWithInit adds a node with a one-time setup function, such as loading
+// a model or opening a connection. Init runs during Warmup, or before the
+// node first runs when the graph wasn't warmed up. A failed init is tried
+// again the next time.
+func (g *StateGraph[T]) AddNodeWithInit(name string, init func(ctx context.Context) error, fn func(ctx context.Context, state T) (T, error)) {
+	g.AddNode(name, fn)
+	if g.inits == nil {
+		g.inits = make(map[string]*nodeInit)
+	}
+	g.inits[name] = &nodeInit{fn: init}
+}
+
+// initNode runs the node's init function if it has one
+func (g *StateGraph[T]) initNode(ctx context.Context, name string) error {
+	init, ok := g.inits[name]
+	if !ok {
+		return nil
+	}
+	return init.run(ctx, name)
+}
+
+// Warmup computes the graph's setup value and runs the init functions of all
+// nodes in parallel, so that setup failures surface before the first run and
+// its latency isn't paid by the first request. The errors of the setup and
+// of all failed inits are joined.
+func (r *RunnableState[T]) Warmup(ctx context.Context) error {
+	var setupErr error
+	if r.setup != nil {
+		_, setupErr = r.setup.get(ctx)
+	}
+
+	names := make([]string, 0, len(r.graph.inits))
+	for name := range r.graph.inits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.graph.initNode(ctx, name)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(append([]error{setupErr}, errs...)...)
+}
@@ -0,0 +1,68 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+func TestFailingInitSurfacesAtWarmup(t *testing.T) {
+	unreachable := errors.New("model server unreachable")
+	var ran, inits atomic.Int32
+	g := newGraph[int]()
+	g.AddNodeWithInit("load", func(ctx context.Context) error {
+		inits.Add(1)
+		return nil
+	}, func(ctx context.Context, n int) (int, error) { return n + 1, nil })
+	g.AddNodeWithInit("classify", func(ctx context.Context) error {
+		return unreachable
+	}, func(ctx context.Context, n int) (int, error) {
+		ran.Add(1)
+		return n, nil
+	})
+	chain(g, "load", "classify")
+	r := compile(t, g)
+
+	err := r.Warmup(context.Background())
+	if !errors.Is(err, core.ErrNodeInit) || !errors.Is(err, unreachable) || !strings.Contains(err.Error(), "classify") {
+		t.Fatalf("Warmup = %v, want ErrNodeInit naming classify", err)
+	}
+	if inits.Load() != 1 {
+		t.Errorf("load initialized %d times by Warmup, want once", inits.Load())
+	}
+
+	// A run doesn't get past the node whose init failed
+	if _, err := r.Invoke(context.Background(), 1); !errors.Is(err, unreachable) {
+		t.Errorf("Invoke = %v, want the init error", err)
+	}
+	if ran.Load() != 0 {
+		t.Error("a node ran although its init failed")
+	}
+	if inits.Load() != 1 {
+		t.Errorf("load initialized %d times, want its successful init kept", inits.Load())
+	}
+}
+
+func TestInitRunsBeforeFirstRunWithoutWarmup(t *testing.T) {
+	var inits atomic.Int32
+	g := newGraph[int]()
+	g.AddNodeWithInit("load", func(ctx context.Context) error {
+		inits.Add(1)
+		return nil
+	}, func(ctx context.Context, n int) (int, error) { return n + 1, nil })
+	chain(g, "load")
+	r := compile(t, g)
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Invoke(context.Background(), 1); err != nil {
+			t.Fatalf("Invoke: %v", err)
+		}
+	}
+	if inits.Load() != 1 {
+		t.Errorf("init ran %d times, want once before the first run", inits.Load())
+	}
+}
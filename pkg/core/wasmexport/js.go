@@ -0,0 +1,44 @@
+//go:build js && wasm
+
+package wasmexport
+
+import (
+	"context"
+	"syscall/js"
+)
+
+// Register installs the simulation API on the JavaScript global object:
+//
+//	moegoSimulate(definitionJSON, stubsJSON) -> Promise<string>
+//
+// The promise resolves to the simulation as JSON. The run happens off the
+// event loop, since blocking a wrapped function would stall the page.
+func Register() {
+	js.Global().Set("moegoSimulate", js.FuncOf(simulate))
+}
+
+func simulate(this js.Value, args []js.Value) interface{} {
+	var definition, stubs string
+	if len(args) > 0 {
+		definition = args[0].String()
+	}
+	if len(args) > 1 && args[1].Type() == js.TypeString {
+		stubs = args[1].String()
+	}
+
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, promise []js.Value) interface{} {
+		resolve, reject := promise[0], promise[1]
+		go func() {
+			defer executor.Release()
+			result, err := SimulateJSON(context.Background(), []byte(definition), []byte(stubs))
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New("moegoSimulate: " + err.Error()))
+				return
+			}
+			resolve.Invoke(string(result))
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
@@ -0,0 +1,60 @@
+//go:build js && wasm
+
+package wasmexport_test
+
+import (
+	"encoding/json"
+	"strings"
+	"syscall/js"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core/wasmexport"
+)
+
+// await waits for a JavaScript promise and returns its value or the
+// message of the error it rejected with
+func await(promise js.Value) (js.Value, string) {
+	type outcome struct {
+		value js.Value
+		err   string
+	}
+	done := make(chan outcome, 1)
+	resolve := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		done <- outcome{value: args[0]}
+		return nil
+	})
+	defer resolve.Release()
+	reject := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		done <- outcome{err: args[0].Get("message").String()}
+		return nil
+	})
+	defer reject.Release()
+	promise.Call("then", resolve, reject)
+	o := <-done
+	return o.value, o.err
+}
+
+func TestRegisteredSimulate(t *testing.T) {
+	wasmexport.Register()
+	definition, err := json.Marshal(reviewLoop())
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	simulate := js.Global().Get("moegoSimulate")
+
+	value, rejected := await(simulate.Invoke(string(definition), `{"review":["revise","approve"]}`))
+	if rejected != "" {
+		t.Fatalf("moegoSimulate rejected: %s", rejected)
+	}
+	var sim wasmexport.Simulation
+	if err := json.Unmarshal([]byte(value.String()), &sim); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if strings.Join(sim.Visits, ",") != "draft,review,draft,review" {
+		t.Errorf("visits = %v, want one revision before approval", sim.Visits)
+	}
+
+	if _, rejected := await(simulate.Invoke("{")); !strings.Contains(rejected, "invalid graph definition") {
+		t.Errorf("malformed definition rejected with %q, want invalid graph definition", rejected)
+	}
+}
@@ -0,0 +1,190 @@
+// Package wasmexport simulates graph routing without running real nodes, so
+// that flows can be previewed in the browser. Built for GOOS=js it exposes
+// the simulation to JavaScript (see Register).
+package wasmexport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrNoStubOutput is returned when a node with several routes is reached
+	// without a stub output saying which one to take
+	ErrNoStubOutput = errors.New("no stub output for node")
+)
+
+// GraphDefinition describes the graph to simulate. It has the form of
+// core.GraphStructure, as served by a graph server's /graph endpoint.
+type GraphDefinition = core.GraphStructure
+
+// Stubs are the router outputs of each node on its successive visits. For
+// mapped edges an output is a mapping label, otherwise a node name. A node
+// visited more often than it has outputs repeats its last one, and a node
+// with a single route needs none.
+type Stubs map[string][]string
+
+// SimulatedEvent is an event the graph would emit
+type SimulatedEvent struct {
+	// Type is the event type, such as on_chain_start
+	Type string `json:"type"`
+
+	// Node is the node the event belongs to, empty for the graph itself
+	Node string `json:"node,omitempty"`
+
+	// Step is the step the node ran at
+	Step int `json:"step"`
+}
+
+// Simulation is the result of a simulated run
+type Simulation struct {
+	// Visits are the nodes in the order they ran
+	Visits []string `json:"visits"`
+
+	// Events are the events the run would emit, in order
+	Events []SimulatedEvent `json:"events"`
+
+	// Error is the error the run would fail with, if any
+	Error string `json:"error,omitempty"`
+}
+
+// simState is the state of a simulated run
+type simState struct {
+	Visits []string `json:"visits"`
+}
+
+// visits returns how often node has run
+func (s simState) visits(node string) int {
+	n := 0
+	for _, v := range s.Visits {
+		if v == node {
+			n++
+		}
+	}
+	return n
+}
+
+// Simulate runs the graph's routing with stub nodes that do nothing but
+// record their visit. Routers return the stub outputs, which go through the
+// same mapping and recursion limit as a real run. An error is only returned
+// for a graph that doesn't compile; a run that fails is reported in the
+// result.
+func Simulate(ctx context.Context, def GraphDefinition, stubs Stubs) (Simulation, error) {
+	runnable, err := build(def, stubs).Compile()
+	if err != nil {
+		return Simulation{}, err
+	}
+
+	var sim Simulation
+	events, wait := runnable.InvokeStreaming(ctx, simState{})
+	for evt := range events {
+		e, ok := evt.Data.(core.Event)
+		if !ok || e.Type == core.EventHeartbeat {
+			continue
+		}
+		node, _ := e.Metadata["langgraph_node"].(string)
+		step, _ := e.Metadata["langgraph_step"].(int)
+		sim.Events = append(sim.Events, SimulatedEvent{Type: string(e.Type), Node: node, Step: step})
+		// Visits are taken from the events so a failed run still has them
+		if e.Type == core.EventChainEnd && node != "" {
+			sim.Visits = append(sim.Visits, node)
+		}
+	}
+
+	if _, err := wait(); err != nil {
+		sim.Error = err.Error()
+	}
+	return sim, nil
+}
+
+// SimulateJSON simulates a graph given as JSON with stubs given as JSON and
+// returns the simulation as JSON
+func SimulateJSON(ctx context.Context, definition, stubs []byte) ([]byte, error) {
+	var def GraphDefinition
+	if err := json.Unmarshal(definition, &def); err != nil {
+		return nil, fmt.Errorf("invalid graph definition: %w", err)
+	}
+	var s Stubs
+	if len(stubs) > 0 {
+		if err := json.Unmarshal(stubs, &s); err != nil {
+			return nil, fmt.Errorf("invalid stubs: %w", err)
+		}
+	}
+
+	sim, err := Simulate(ctx, def, s)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sim)
+}
+
+// build creates a graph of stub nodes with the definition's routing
+func build(def GraphDefinition, stubs Stubs) *core.StateGraph[simState] {
+	graph := core.NewStateGraph[simState]()
+	graph.SetName(def.Name)
+	graph.SetStreamConfig(core.StreamConfig{
+		Modes:      []core.StreamMode{core.StreamDebug},
+		BufferSize: 1024,
+	})
+
+	for _, name := range def.Nodes {
+		name := name
+		graph.AddNode(name, func(ctx context.Context, s simState) (simState, error) {
+			s.Visits = append(append([]string(nil), s.Visits...), name)
+			return s, nil
+		})
+	}
+	graph.SetEntryPoint(def.EntryPoint)
+
+	// Edges leaving the same node make up one router
+	var order []string
+	mappings := make(map[string]map[string]string)
+	unmapped := make(map[string]bool)
+	for _, edge := range def.Edges {
+		if _, seen := mappings[edge.From]; !seen {
+			order = append(order, edge.From)
+			mappings[edge.From] = make(map[string]string)
+		}
+		if edge.To == "" {
+			unmapped[edge.From] = true
+			continue
+		}
+		label := edge.Label
+		if label == "" {
+			label = edge.To
+		}
+		mappings[edge.From][label] = edge.To
+	}
+
+	for _, from := range order {
+		mapping := mappings[from]
+		if unmapped[from] {
+			mapping = nil
+		}
+		graph.AddConditionalEdges(from, stubRouter(from, stubs[from], mapping), mapping)
+	}
+	return graph
+}
+
+// stubRouter returns a router that replays the node's stub outputs
+func stubRouter(node string, outputs []string, mapping map[string]string) core.Router[simState] {
+	return func(s simState) ([]string, error) {
+		if len(outputs) == 0 {
+			if len(mapping) == 1 {
+				for label := range mapping {
+					return []string{label}, nil
+				}
+			}
+			return nil, fmt.Errorf("%w: %s", ErrNoStubOutput, node)
+		}
+		i := s.visits(node) - 1
+		if i >= len(outputs) {
+			i = len(outputs) - 1
+		}
+		return []string{outputs[i]}, nil
+	}
+}
@@ -0,0 +1,95 @@
+package wasmexport_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/core/wasmexport"
+)
+
+// reviewLoop drafts and reviews until the review approves
+func reviewLoop() wasmexport.GraphDefinition {
+	return wasmexport.GraphDefinition{
+		Name:       "review-loop",
+		EntryPoint: "draft",
+		Nodes:      []string{"draft", "review"},
+		Edges: []core.StructureEdge{
+			{From: "draft", To: "review"},
+			{From: "review", To: "draft", Label: "revise"},
+			{From: "review", To: core.END, Label: "approve"},
+		},
+	}
+}
+
+func TestSimulateReplaysStubs(t *testing.T) {
+	sim, err := wasmexport.Simulate(context.Background(), reviewLoop(), wasmexport.Stubs{"review": {"revise", "approve"}})
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if sim.Error != "" {
+		t.Fatalf("simulated run failed: %s", sim.Error)
+	}
+	if got := strings.Join(sim.Visits, ","); got != "draft,review,draft,review" {
+		t.Errorf("visits = %s, want one revision before approval", got)
+	}
+
+	var starts []string
+	for _, evt := range sim.Events {
+		if evt.Type == string(core.EventChainStart) && evt.Node != "" {
+			starts = append(starts, evt.Node)
+		}
+	}
+	if strings.Join(starts, ",") != strings.Join(sim.Visits, ",") {
+		t.Errorf("node start events = %v, want one per visit", starts)
+	}
+	if last := sim.Events[len(sim.Events)-1]; last.Type != string(core.EventChainEnd) || last.Node != "" {
+		t.Errorf("last event = %+v, want the graph's chain end", last)
+	}
+}
+
+func TestSimulateReportsFailedRuns(t *testing.T) {
+	sim, err := wasmexport.Simulate(context.Background(), reviewLoop(), nil)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if !strings.Contains(sim.Error, wasmexport.ErrNoStubOutput.Error()) || !strings.Contains(sim.Error, "review") {
+		t.Errorf("error = %q, want no stub output for review", sim.Error)
+	}
+	if strings.Join(sim.Visits, ",") != "draft,review" {
+		t.Errorf("visits = %v, want those before the failure", sim.Visits)
+	}
+
+	// A label the mapping doesn't have fails the run like it would in production
+	sim, _ = wasmexport.Simulate(context.Background(), reviewLoop(), wasmexport.Stubs{"review": {"escalate"}})
+	if sim.Error == "" {
+		t.Error("an unmapped stub output didn't fail the run")
+	}
+}
+
+func TestSimulateJSON(t *testing.T) {
+	definition, err := json.Marshal(reviewLoop())
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	out, err := wasmexport.SimulateJSON(context.Background(), definition, []byte(`{"review":["approve"]}`))
+	if err != nil {
+		t.Fatalf("SimulateJSON: %v", err)
+	}
+	var sim wasmexport.Simulation
+	if err := json.Unmarshal(out, &sim); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if strings.Join(sim.Visits, ",") != "draft,review" {
+		t.Errorf("visits = %v, want draft then review", sim.Visits)
+	}
+
+	if _, err := wasmexport.SimulateJSON(context.Background(), []byte("{"), nil); err == nil || !strings.Contains(err.Error(), "invalid graph definition") {
+		t.Errorf("malformed definition = %v, want invalid graph definition", err)
+	}
+	if _, err := wasmexport.SimulateJSON(context.Background(), definition, []byte("[")); err == nil || !strings.Contains(err.Error(), "invalid stubs") {
+		t.Errorf("malformed stubs = %v, want invalid stubs", err)
+	}
+}
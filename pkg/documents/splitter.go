@@ -0,0 +1,106 @@
+// Package documents contains helpers for preparing documents for models
+package documents
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Splitter splits text into chunks
+type Splitter interface {
+	Split(text string) []string
+}
+
+// TextSplitter splits text into chunks of at most ChunkSize characters,
+// preferring to break between paragraphs, then lines, then sentences, then
+// words. Consecutive chunks share up to Overlap characters.
+type TextSplitter struct {
+	// ChunkSize is the maximum number of characters in a chunk
+	ChunkSize int
+
+	// Overlap is the number of characters repeated at the start of the next chunk
+	Overlap int
+
+	// Separators are the boundaries tried in order of preference
+	Separators []string
+}
+
+// NewTextSplitter creates a text splitter with the default separators
+func NewTextSplitter(chunkSize, overlap int) *TextSplitter {
+	return &TextSplitter{
+		ChunkSize:  chunkSize,
+		Overlap:    overlap,
+		Separators: []string{"\n\n", "\n", ". ", " "},
+	}
+}
+
+// Split splits text into chunks
+func (s *TextSplitter) Split(text string) []string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	pieces := s.pieces(text, s.Separators)
+
+	var chunks []string
+	var current strings.Builder
+	for _, piece := range pieces {
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+utf8.RuneCountInString(piece) > s.ChunkSize {
+			chunk := current.String()
+			chunks = append(chunks, strings.TrimSpace(chunk))
+			current.Reset()
+			current.WriteString(s.overlapOf(chunk))
+		}
+		current.WriteString(piece)
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		chunks = append(chunks, strings.TrimSpace(current.String()))
+	}
+	return chunks
+}
+
+// pieces breaks text into pieces no longer than the chunk size, keeping the
+// separators attached so the chunks can be joined back together
+func (s *TextSplitter) pieces(text string, separators []string) []string {
+	if utf8.RuneCountInString(text) <= s.ChunkSize {
+		return []string{text}
+	}
+	if len(separators) == 0 {
+		// No boundary left, cut at the chunk size
+		runes := []rune(text)
+		var pieces []string
+		for len(runes) > 0 {
+			n := min(s.ChunkSize, len(runes))
+			pieces = append(pieces, string(runes[:n]))
+			runes = runes[n:]
+		}
+		return pieces
+	}
+
+	var pieces []string
+	parts := strings.SplitAfter(text, separators[0])
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		pieces = append(pieces, s.pieces(part, separators[1:])...)
+	}
+	return pieces
+}
+
+// overlapOf returns the tail of a chunk repeated at the start of the next one
+func (s *TextSplitter) overlapOf(chunk string) string {
+	if s.Overlap <= 0 {
+		return ""
+	}
+	runes := []rune(chunk)
+	if len(runes) <= s.Overlap {
+		return chunk
+	}
+	return string(runes[len(runes)-s.Overlap:])
+}
+
+// EstimateTokens roughly estimates the number of model tokens in text,
+// assuming about four characters per token
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
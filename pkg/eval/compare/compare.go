@@ -0,0 +1,519 @@
+// Package compare compares recorded runs against baselines, for example to
+// catch regressions after a prompt change
+package compare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/eval"
+)
+
+// Node statuses in a report
+const (
+	NodeMatched = "matched"
+	NodeAdded   = "added"
+	NodeRemoved = "removed"
+)
+
+// Regression kinds in a report
+const (
+	RegressionSequence   = "sequence"
+	RegressionSimilarity = "similarity"
+	RegressionLatency    = "latency"
+	RegressionTokens     = "tokens"
+	RegressionError      = "error"
+	RegressionFeedback   = "feedback"
+)
+
+// Embedder turns text into an embedding vector
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// Options controls what counts as a regression
+type Options struct {
+	// MinSimilarity flags matched nodes whose outputs are less similar
+	MinSimilarity float64
+
+	// LatencyThreshold flags durations that grew by more than this fraction
+	LatencyThreshold float64
+
+	// MinLatencyDelta ignores latency growth below this duration, so fast
+	// nodes don't trip the threshold on noise
+	MinLatencyDelta time.Duration
+
+	// TokenThreshold flags token usage that grew by more than this fraction
+	TokenThreshold float64
+
+	// Embedder, when set, scores output similarity by the cosine similarity
+	// of embeddings instead of token overlap
+	Embedder Embedder
+}
+
+// DefaultOptions returns the default comparison options
+func DefaultOptions() Options {
+	return Options{
+		MinSimilarity:    0.8,
+		LatencyThreshold: 0.25,
+		MinLatencyDelta:  100 * time.Millisecond,
+		TokenThreshold:   0.1,
+	}
+}
+
+// NodeDiff compares one node execution of the two runs
+type NodeDiff struct {
+	// Node is the name of the node
+	Node string `json:"node"`
+
+	// Status is NodeMatched, NodeAdded or NodeRemoved
+	Status string `json:"status"`
+
+	// Similarity scores the outputs of matched nodes from 0 to 1
+	Similarity float64 `json:"similarity,omitempty"`
+
+	BaselineDuration  time.Duration `json:"baseline_duration,omitempty"`
+	CandidateDuration time.Duration `json:"candidate_duration,omitempty"`
+	BaselineTokens    int           `json:"baseline_tokens,omitempty"`
+	CandidateTokens   int           `json:"candidate_tokens,omitempty"`
+
+	// BaselineFeedback and CandidateFeedback summarize the human feedback
+	// on the node's output, when the runs carry any
+	BaselineFeedback  *FeedbackSummary `json:"baseline_feedback,omitempty"`
+	CandidateFeedback *FeedbackSummary `json:"candidate_feedback,omitempty"`
+}
+
+// FieldDiff is a final state field that differs between the runs
+type FieldDiff struct {
+	// Path locates the field, such as messages[2].content
+	Path string `json:"path"`
+
+	// Baseline is the baseline value, absent when the field was added
+	Baseline json.RawMessage `json:"baseline,omitempty"`
+
+	// Candidate is the candidate value, absent when the field was removed
+	Candidate json.RawMessage `json:"candidate,omitempty"`
+}
+
+// Regression is a difference beyond the configured thresholds
+type Regression struct {
+	// Kind is one of the Regression kinds
+	Kind string `json:"kind"`
+
+	// Node is the node the regression was found in, empty for the whole run
+	Node string `json:"node,omitempty"`
+
+	// Message describes the regression
+	Message string `json:"message"`
+}
+
+// Report is the result of comparing a candidate run against a baseline
+type Report struct {
+	Baseline  string `json:"baseline"`
+	Candidate string `json:"candidate"`
+
+	// SameSequence is true when both runs executed the same nodes in order
+	SameSequence bool `json:"same_sequence"`
+
+	Nodes       []NodeDiff   `json:"nodes"`
+	Fields      []FieldDiff  `json:"fields,omitempty"`
+	Regressions []Regression `json:"regressions,omitempty"`
+
+	BaselineDuration  time.Duration `json:"baseline_duration"`
+	CandidateDuration time.Duration `json:"candidate_duration"`
+	BaselineTokens    int           `json:"baseline_tokens"`
+	CandidateTokens   int           `json:"candidate_tokens"`
+
+	// BaselineFeedback and CandidateFeedback summarize the human feedback
+	// on the runs (see eval.AttachFeedback), when they carry any
+	BaselineFeedback  *FeedbackSummary `json:"baseline_feedback,omitempty"`
+	CandidateFeedback *FeedbackSummary `json:"candidate_feedback,omitempty"`
+}
+
+// Regressed reports whether any regression was found
+func (r Report) Regressed() bool {
+	return len(r.Regressions) > 0
+}
+
+// JSON returns the machine-readable report
+func (r Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Compare aligns the node executions of both runs by node name, diffs their
+// outputs and final states, and flags regressions beyond the thresholds
+func Compare(baseline, candidate eval.RecordedRun, opts Options) Report {
+	report := Report{
+		Baseline:          baseline.RunID,
+		Candidate:         candidate.RunID,
+		SameSequence:      sameSequence(baseline.Steps, candidate.Steps),
+		BaselineDuration:  baseline.Duration,
+		CandidateDuration: candidate.Duration,
+		BaselineTokens:    baseline.Tokens,
+		CandidateTokens:   candidate.Tokens,
+		BaselineFeedback:  feedbackSummary(baseline.Feedback, ""),
+		CandidateFeedback: feedbackSummary(candidate.Feedback, ""),
+	}
+
+	if !report.SameSequence {
+		report.Regressions = append(report.Regressions, Regression{
+			Kind:    RegressionSequence,
+			Message: fmt.Sprintf("node sequence changed from %s to %s", sequence(baseline.Steps), sequence(candidate.Steps)),
+		})
+	}
+	if candidate.Error != "" && baseline.Error == "" {
+		report.Regressions = append(report.Regressions, Regression{
+			Kind:    RegressionError,
+			Message: "candidate failed: " + candidate.Error,
+		})
+	}
+
+	for _, pair := range align(baseline.Steps, candidate.Steps) {
+		switch {
+		case pair.baseline == nil:
+			report.Nodes = append(report.Nodes, NodeDiff{
+				Node:              pair.candidate.Node,
+				Status:            NodeAdded,
+				CandidateDuration: pair.candidate.Duration,
+				CandidateTokens:   pair.candidate.Tokens,
+			})
+		case pair.candidate == nil:
+			report.Nodes = append(report.Nodes, NodeDiff{
+				Node:             pair.baseline.Node,
+				Status:           NodeRemoved,
+				BaselineDuration: pair.baseline.Duration,
+				BaselineTokens:   pair.baseline.Tokens,
+			})
+		default:
+			diff := NodeDiff{
+				Node:              pair.baseline.Node,
+				Status:            NodeMatched,
+				Similarity:        similarity(pair.baseline.Output, pair.candidate.Output, opts.Embedder),
+				BaselineDuration:  pair.baseline.Duration,
+				CandidateDuration: pair.candidate.Duration,
+				BaselineTokens:    pair.baseline.Tokens,
+				CandidateTokens:   pair.candidate.Tokens,
+				BaselineFeedback:  feedbackSummary(baseline.Feedback, pair.baseline.Node),
+				CandidateFeedback: feedbackSummary(candidate.Feedback, pair.candidate.Node),
+			}
+			report.Nodes = append(report.Nodes, diff)
+			report.Regressions = append(report.Regressions, nodeRegressions(diff, opts)...)
+		}
+	}
+
+	if reason, ok := latencyRegressed(baseline.Duration, candidate.Duration, opts); ok {
+		report.Regressions = append(report.Regressions, Regression{Kind: RegressionLatency, Message: "run " + reason})
+	}
+	if reason, ok := tokensRegressed(baseline.Tokens, candidate.Tokens, opts); ok {
+		report.Regressions = append(report.Regressions, Regression{Kind: RegressionTokens, Message: "run " + reason})
+	}
+	if reason, ok := feedbackRegressed(report.BaselineFeedback, report.CandidateFeedback); ok {
+		report.Regressions = append(report.Regressions, Regression{Kind: RegressionFeedback, Message: "run " + reason})
+	}
+
+	report.Fields = DiffStates(baseline.FinalState, candidate.FinalState)
+	return report
+}
+
+// nodeRegressions flags the regressions of a matched node
+func nodeRegressions(diff NodeDiff, opts Options) []Regression {
+	var regressions []Regression
+	if diff.Similarity < opts.MinSimilarity {
+		regressions = append(regressions, Regression{
+			Kind:    RegressionSimilarity,
+			Node:    diff.Node,
+			Message: fmt.Sprintf("output similarity %.2f is below %.2f", diff.Similarity, opts.MinSimilarity),
+		})
+	}
+	if reason, ok := latencyRegressed(diff.BaselineDuration, diff.CandidateDuration, opts); ok {
+		regressions = append(regressions, Regression{Kind: RegressionLatency, Node: diff.Node, Message: reason})
+	}
+	if reason, ok := tokensRegressed(diff.BaselineTokens, diff.CandidateTokens, opts); ok {
+		regressions = append(regressions, Regression{Kind: RegressionTokens, Node: diff.Node, Message: reason})
+	}
+	if reason, ok := feedbackRegressed(diff.BaselineFeedback, diff.CandidateFeedback); ok {
+		regressions = append(regressions, Regression{Kind: RegressionFeedback, Node: diff.Node, Message: reason})
+	}
+	return regressions
+}
+
+func latencyRegressed(baseline, candidate time.Duration, opts Options) (string, bool) {
+	if baseline <= 0 || candidate-baseline < opts.MinLatencyDelta {
+		return "", false
+	}
+	growth := float64(candidate-baseline) / float64(baseline)
+	if growth <= opts.LatencyThreshold {
+		return "", false
+	}
+	return fmt.Sprintf("took %s instead of %s (+%.0f%%)", candidate, baseline, growth*100), true
+}
+
+func tokensRegressed(baseline, candidate int, opts Options) (string, bool) {
+	if baseline <= 0 {
+		return "", false
+	}
+	growth := float64(candidate-baseline) / float64(baseline)
+	if growth <= opts.TokenThreshold {
+		return "", false
+	}
+	return fmt.Sprintf("used %d tokens instead of %d (+%.0f%%)", candidate, baseline, growth*100), true
+}
+
+// stepPair is an aligned pair of steps, either of which may be missing
+type stepPair struct {
+	baseline  *eval.RecordedStep
+	candidate *eval.RecordedStep
+}
+
+// align matches the steps of both runs by node name along their longest
+// common subsequence
+func align(a, b []eval.RecordedStep) []stepPair {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i].Node == b[j].Node {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var pairs []stepPair
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].Node == b[j].Node:
+			pairs = append(pairs, stepPair{baseline: &a[i], candidate: &b[j]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			pairs = append(pairs, stepPair{baseline: &a[i]})
+			i++
+		default:
+			pairs = append(pairs, stepPair{candidate: &b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		pairs = append(pairs, stepPair{baseline: &a[i]})
+	}
+	for ; j < len(b); j++ {
+		pairs = append(pairs, stepPair{candidate: &b[j]})
+	}
+	return pairs
+}
+
+func sameSequence(a, b []eval.RecordedStep) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Node != b[i].Node {
+			return false
+		}
+	}
+	return true
+}
+
+// sequence formats the node sequence of a run
+func sequence(steps []eval.RecordedStep) string {
+	nodes := make([]string, len(steps))
+	for i, step := range steps {
+		nodes[i] = step.Node
+	}
+	return "[" + strings.Join(nodes, " → ") + "]"
+}
+
+// similarity scores two node outputs from 0 to 1, by embedding distance when
+// an embedder is given and by token overlap otherwise
+func similarity(a, b json.RawMessage, embedder Embedder) float64 {
+	if bytes.Equal(a, b) {
+		return 1
+	}
+	textA, textB := outputText(a), outputText(b)
+
+	if embedder != nil {
+		ctx := context.Background()
+		va, errA := embedder.Embed(ctx, textA)
+		vb, errB := embedder.Embed(ctx, textB)
+		if errA == nil && errB == nil {
+			return cosine(va, vb)
+		}
+	}
+	return tokenOverlap(textA, textB)
+}
+
+// outputText collects the strings of a JSON output, which is where model
+// text ends up, falling back to the raw JSON
+func outputText(data json.RawMessage) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	var parts []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			parts = append(parts, v)
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(v[k])
+			}
+		}
+	}
+	walk(v)
+	if len(parts) == 0 {
+		return string(data)
+	}
+	return strings.Join(parts, " ")
+}
+
+// tokenOverlap is the Dice coefficient of the word multisets of a and b
+func tokenOverlap(a, b string) float64 {
+	wordsA, wordsB := strings.Fields(strings.ToLower(a)), strings.Fields(strings.ToLower(b))
+	if len(wordsA) == 0 && len(wordsB) == 0 {
+		return 1
+	}
+
+	counts := make(map[string]int, len(wordsA))
+	for _, w := range wordsA {
+		counts[w]++
+	}
+	shared := 0
+	for _, w := range wordsB {
+		if counts[w] > 0 {
+			counts[w]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(wordsA)+len(wordsB))
+}
+
+// cosine returns the cosine similarity of two vectors, clamped to [0, 1]
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return math.Max(0, dot/(math.Sqrt(normA)*math.Sqrt(normB)))
+}
+
+// DiffStates lists the fields that differ between two JSON states
+func DiffStates(a, b json.RawMessage) []FieldDiff {
+	var va, vb interface{}
+	if len(a) > 0 {
+		if err := json.Unmarshal(a, &va); err != nil {
+			va = string(a)
+		}
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &vb); err != nil {
+			vb = string(b)
+		}
+	}
+
+	var diffs []FieldDiff
+	diffValues("", va, vb, &diffs)
+	return diffs
+}
+
+func diffValues(path string, a, b interface{}, diffs *[]FieldDiff) {
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+
+	switch ta := a.(type) {
+	case map[string]interface{}:
+		if tb, ok := b.(map[string]interface{}); ok {
+			keys := make(map[string]struct{}, len(ta)+len(tb))
+			for k := range ta {
+				keys[k] = struct{}{}
+			}
+			for k := range tb {
+				keys[k] = struct{}{}
+			}
+			sorted := make([]string, 0, len(keys))
+			for k := range keys {
+				sorted = append(sorted, k)
+			}
+			sort.Strings(sorted)
+
+			for _, k := range sorted {
+				child := k
+				if path != "" {
+					child = path + "." + k
+				}
+				va, inA := ta[k]
+				vb, inB := tb[k]
+				switch {
+				case !inA:
+					*diffs = append(*diffs, FieldDiff{Path: child, Candidate: rawJSON(vb)})
+				case !inB:
+					*diffs = append(*diffs, FieldDiff{Path: child, Baseline: rawJSON(va)})
+				default:
+					diffValues(child, va, vb, diffs)
+				}
+			}
+			return
+		}
+
+	case []interface{}:
+		if tb, ok := b.([]interface{}); ok {
+			for i := 0; i < max(len(ta), len(tb)); i++ {
+				child := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(ta):
+					*diffs = append(*diffs, FieldDiff{Path: child, Candidate: rawJSON(tb[i])})
+				case i >= len(tb):
+					*diffs = append(*diffs, FieldDiff{Path: child, Baseline: rawJSON(ta[i])})
+				default:
+					diffValues(child, ta[i], tb[i], diffs)
+				}
+			}
+			return
+		}
+	}
+
+	if path == "" {
+		path = "."
+	}
+	*diffs = append(*diffs, FieldDiff{Path: path, Baseline: rawJSON(a), Candidate: rawJSON(b)})
+}
+
+// rawJSON encodes a decoded JSON value, keeping absent values absent
+func rawJSON(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
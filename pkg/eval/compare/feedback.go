@@ -0,0 +1,123 @@
+package compare
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/eval"
+)
+
+// FeedbackSummary aggregates human feedback used as labels
+type FeedbackSummary struct {
+	// Count is the number of feedback entries, including comments
+	// without a rating
+	Count int `json:"count"`
+	Up    int `json:"up"`
+	Down  int `json:"down"`
+
+	// Score is the share of ratings that are thumbs up, from 0 to 1
+	Score float64 `json:"score"`
+}
+
+// Rated reports whether the summary holds any thumbs up or down
+func (s FeedbackSummary) Rated() bool {
+	return s.Up+s.Down > 0
+}
+
+// SummarizeFeedback aggregates feedback, all of it when node is empty and
+// that on the node otherwise
+func SummarizeFeedback(feedback []core.Feedback, node string) FeedbackSummary {
+	var s FeedbackSummary
+	for _, f := range feedback {
+		if node != "" && f.Node != node {
+			continue
+		}
+		s.Count++
+		switch f.Score {
+		case core.FeedbackUp:
+			s.Up++
+		case core.FeedbackDown:
+			s.Down++
+		}
+	}
+	if s.Rated() {
+		s.Score = float64(s.Up) / float64(s.Up+s.Down)
+	}
+	return s
+}
+
+// feedbackRegressed reports whether the candidate was rated worse than the
+// baseline, when both were rated
+func feedbackRegressed(baseline, candidate *FeedbackSummary) (string, bool) {
+	if baseline == nil || candidate == nil || !baseline.Rated() || !candidate.Rated() {
+		return "", false
+	}
+	if candidate.Score >= baseline.Score {
+		return "", false
+	}
+	return fmt.Sprintf("rated up %.0f%% of the time instead of %.0f%%", candidate.Score*100, baseline.Score*100), true
+}
+
+// feedbackSummary summarizes a run's feedback, nil when it has none
+func feedbackSummary(feedback []core.Feedback, node string) *FeedbackSummary {
+	s := SummarizeFeedback(feedback, node)
+	if s.Count == 0 {
+		return nil
+	}
+	return &s
+}
+
+// VariantFeedback is the human feedback received by the runs of an
+// experiment variant
+type VariantFeedback struct {
+	Variant string `json:"variant"`
+	Runs    int    `json:"runs"`
+
+	FeedbackSummary
+
+	// Nodes summarizes the feedback by node
+	Nodes map[string]FeedbackSummary `json:"nodes,omitempty"`
+}
+
+// CompareVariants labels the runs of each experiment variant with their
+// human feedback, for example to pick the better of two prompts. Variants
+// are sorted by score, best first; runs without a variant are grouped
+// under "".
+func CompareVariants(runs []eval.RecordedRun) []VariantFeedback {
+	feedback := make(map[string][]core.Feedback)
+	counts := make(map[string]int)
+	var order []string
+	for _, run := range runs {
+		if _, ok := counts[run.Variant]; !ok {
+			order = append(order, run.Variant)
+		}
+		counts[run.Variant]++
+		feedback[run.Variant] = append(feedback[run.Variant], run.Feedback...)
+	}
+
+	out := make([]VariantFeedback, 0, len(order))
+	for _, variant := range order {
+		v := VariantFeedback{
+			Variant:         variant,
+			Runs:            counts[variant],
+			FeedbackSummary: SummarizeFeedback(feedback[variant], ""),
+		}
+		for _, f := range feedback[variant] {
+			if v.Nodes == nil {
+				v.Nodes = make(map[string]FeedbackSummary)
+			}
+			if _, ok := v.Nodes[f.Node]; !ok {
+				v.Nodes[f.Node] = SummarizeFeedback(feedback[variant], f.Node)
+			}
+		}
+		out = append(out, v)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Rated() != out[j].Rated() {
+			return out[i].Rated()
+		}
+		return out[i].Score > out[j].Score
+	})
+	return out
+}
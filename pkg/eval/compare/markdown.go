@@ -0,0 +1,83 @@
+package compare
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markdown returns a human-readable summary of the report
+func (r Report) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Run comparison\n\n")
+	fmt.Fprintf(&b, "Baseline `%s`, candidate `%s`\n\n", r.Baseline, r.Candidate)
+
+	if r.Regressed() {
+		fmt.Fprintf(&b, "**%d regression(s) found**\n\n", len(r.Regressions))
+		for _, reg := range r.Regressions {
+			if reg.Node != "" {
+				fmt.Fprintf(&b, "- %s in `%s`: %s\n", reg.Kind, reg.Node, reg.Message)
+			} else {
+				fmt.Fprintf(&b, "- %s: %s\n", reg.Kind, reg.Message)
+			}
+		}
+		b.WriteString("\n")
+	} else {
+		b.WriteString("No regressions found.\n\n")
+	}
+
+	b.WriteString("## Totals\n\n")
+	b.WriteString("| | Baseline | Candidate |\n|---|---|---|\n")
+	fmt.Fprintf(&b, "| Duration | %s | %s |\n", r.BaselineDuration, r.CandidateDuration)
+	fmt.Fprintf(&b, "| Tokens | %d | %d |\n", r.BaselineTokens, r.CandidateTokens)
+	if r.BaselineFeedback != nil || r.CandidateFeedback != nil {
+		fmt.Fprintf(&b, "| Feedback | %s | %s |\n", feedbackCell(r.BaselineFeedback), feedbackCell(r.CandidateFeedback))
+	}
+	b.WriteString("\n")
+
+	b.WriteString("## Nodes\n\n")
+	b.WriteString("| Node | Status | Similarity | Duration | Tokens |\n|---|---|---|---|---|\n")
+	for _, n := range r.Nodes {
+		similarity := "-"
+		if n.Status == NodeMatched {
+			similarity = fmt.Sprintf("%.2f", n.Similarity)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s → %s | %d → %d |\n",
+			n.Node, n.Status, similarity,
+			n.BaselineDuration, n.CandidateDuration,
+			n.BaselineTokens, n.CandidateTokens)
+	}
+	b.WriteString("\n")
+
+	if len(r.Fields) > 0 {
+		b.WriteString("## Final state\n\n")
+		b.WriteString("| Field | Baseline | Candidate |\n|---|---|---|\n")
+		for _, f := range r.Fields {
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", f.Path, cell(f.Baseline), cell(f.Candidate))
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// feedbackCell formats a feedback summary for a markdown table cell
+func feedbackCell(s *FeedbackSummary) string {
+	if s == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d up, %d down, %d total", s.Up, s.Down, s.Count)
+}
+
+// cell formats a JSON value for a markdown table cell
+func cell(raw []byte) string {
+	if len(raw) == 0 {
+		return "-"
+	}
+	s := string(raw)
+	if runes := []rune(s); len(runes) > 80 {
+		s = string(runes[:77]) + "..."
+	}
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return "`" + strings.ReplaceAll(s, "`", "'") + "`"
+}
@@ -0,0 +1,19 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// AttachFeedback loads the human feedback recorded for the run from store
+// into run.Feedback, so comparisons can use it as labels
+func AttachFeedback(ctx context.Context, store core.FeedbackStore, run *RecordedRun) error {
+	feedback, err := store.List(ctx, core.FeedbackFilter{RunID: run.RunID})
+	if err != nil {
+		return fmt.Errorf("failed to load feedback of run %s: %w", run.RunID, err)
+	}
+	run.Feedback = feedback
+	return nil
+}
@@ -0,0 +1,292 @@
+// Package eval records graph runs so they can be replayed and compared
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrNoRun is returned when a recording has no run line
+	ErrNoRun = errors.New("recording has no run")
+)
+
+// RecordedStep is a node execution of a recorded run
+type RecordedStep struct {
+	// Node is the name of the node
+	Node string `json:"node"`
+
+	// Step is the step number of the execution
+	Step int `json:"step"`
+
+	// Output is the state after the node, as serialized in debug events
+	Output json.RawMessage `json:"output,omitempty"`
+
+	// Duration is how long the node ran
+	Duration time.Duration `json:"duration"`
+
+	// Tokens is the number of model tokens used by the node
+	Tokens int `json:"tokens,omitempty"`
+}
+
+// RecordedRun is a graph run recorded from its debug events
+type RecordedRun struct {
+	// RunID is the ID of the run
+	RunID string `json:"run_id"`
+
+	// Steps are the node executions in order
+	Steps []RecordedStep `json:"steps,omitempty"`
+
+	// Edits are the changes made to the state while the run was paused
+	Edits []core.StateEdit `json:"edits,omitempty"`
+
+	// Metadata holds the values nodes recorded about the run with
+	// core.SetRunMetadata
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+
+	// FinalState is the state the run ended with
+	FinalState json.RawMessage `json:"final_state,omitempty"`
+
+	// Duration is how long the run took
+	Duration time.Duration `json:"duration"`
+
+	// Tokens is the number of model tokens used by the run
+	Tokens int `json:"tokens,omitempty"`
+
+	// Error is the error the run failed with, if any
+	Error string `json:"error,omitempty"`
+
+	// Variant is the experiment variant the run was assigned to, if any
+	Variant string `json:"variant,omitempty"`
+
+	// Feedback is the human feedback recorded on the run's node outputs,
+	// attached with AttachFeedback
+	Feedback []core.Feedback `json:"feedback,omitempty"`
+}
+
+// Recorder builds a RecordedRun from the events of a graph running in
+// StreamDebug mode
+type Recorder struct {
+	mu      sync.Mutex
+	run     RecordedRun
+	start   time.Time
+	started map[string]time.Time
+	current int
+}
+
+// NewRecorder creates an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{
+		started: make(map[string]time.Time),
+		current: -1,
+	}
+}
+
+// Record adds a graph event to the recording
+func (r *Recorder) Record(evt core.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.start.IsZero() {
+		r.start = evt.Timestamp
+		r.run.RunID = evt.RunID
+	}
+	if d := evt.Timestamp.Sub(r.start); d > r.run.Duration {
+		r.run.Duration = d
+	}
+	if variant, ok := evt.Metadata["variant"].(string); ok && r.run.Variant == "" {
+		r.run.Variant = variant
+	}
+
+	node, isNode := evt.Metadata["langgraph_node"].(string)
+	switch evt.Type {
+	case core.EventChainStart:
+		if isNode {
+			r.started[node] = evt.Timestamp
+		}
+
+	case core.EventChainEnd:
+		if msg, ok := evt.Metadata["error"].(string); ok {
+			r.run.Error = msg
+		}
+		if !isNode {
+			return
+		}
+		stepNum, _ := evt.Metadata["langgraph_step"].(int)
+		step := RecordedStep{
+			Node:     node,
+			Step:     stepNum,
+			Output:   evt.Data,
+			Duration: evt.Timestamp.Sub(r.started[node]),
+		}
+		delete(r.started, node)
+		if r.current >= 0 {
+			step.Tokens = r.run.Steps[r.current].Tokens
+			r.run.Steps[r.current] = step
+			r.current = -1
+		} else {
+			r.run.Steps = append(r.run.Steps, step)
+		}
+		if len(evt.Data) > 0 {
+			r.run.FinalState = evt.Data
+		}
+
+	case core.EventRunMetadata:
+		if r.run.Metadata == nil {
+			r.run.Metadata = make(map[string]interface{})
+		}
+		for k, v := range evt.Metadata {
+			r.run.Metadata[k] = v
+		}
+
+	case core.EventStateEdit:
+		var edit core.StateEdit
+		if err := json.Unmarshal(evt.Data, &edit); err == nil {
+			r.run.Edits = append(r.run.Edits, edit)
+		}
+
+	case core.EventChatModelEnd:
+		usage, ok := evt.Metadata["usage"].(core.Usage)
+		if !ok {
+			return
+		}
+		r.run.Tokens += usage.TotalTokens
+		// Tokens count towards the node running when the model finished
+		if len(r.started) > 0 {
+			r.pending(usage.TotalTokens)
+		}
+	}
+}
+
+// pending adds tokens to the node that is currently running. They are kept
+// on a placeholder step that the node end event fills in.
+func (r *Recorder) pending(tokens int) {
+	if r.current < 0 {
+		r.run.Steps = append(r.run.Steps, RecordedStep{})
+		r.current = len(r.run.Steps) - 1
+	}
+	r.run.Steps[r.current].Tokens += tokens
+}
+
+// Run returns the recording so far
+func (r *Recorder) Run() RecordedRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run := r.run
+	run.Edits = append([]core.StateEdit(nil), r.run.Edits...)
+	if r.run.Metadata != nil {
+		run.Metadata = make(map[string]interface{}, len(r.run.Metadata))
+		for k, v := range r.run.Metadata {
+			run.Metadata[k] = v
+		}
+	}
+	run.Steps = make([]RecordedStep, 0, len(r.run.Steps))
+	for _, step := range r.run.Steps {
+		if step.Node != "" {
+			run.Steps = append(run.Steps, step)
+		}
+	}
+	return run
+}
+
+// RecordRun runs the graph and records it. The graph must stream in
+// StreamDebug mode for node executions to be recorded. Recorded states are
+// redacted with the graph's redaction policy like any debug payload.
+func RecordRun[T any](ctx context.Context, runnable *core.RunnableState[T], state T) (RecordedRun, T, error) {
+	recorder := NewRecorder()
+	events, wait := runnable.InvokeStreaming(ctx, state)
+	for evt := range events {
+		if e, ok := evt.Data.(core.Event); ok {
+			recorder.Record(e)
+		}
+	}
+
+	final, err := wait()
+	run := recorder.Run()
+	if err != nil {
+		run.Error = err.Error()
+	}
+	return run, final, err
+}
+
+// recordLine is a line of a JSONL recording
+type recordLine struct {
+	Kind string        `json:"kind"`
+	Step *RecordedStep `json:"step,omitempty"`
+	Run  *RecordedRun  `json:"run,omitempty"`
+}
+
+// WriteRun writes a run as JSONL, one line per step followed by a line with
+// the rest of the run
+func WriteRun(w io.Writer, run RecordedRun) error {
+	enc := json.NewEncoder(w)
+	for i := range run.Steps {
+		if err := enc.Encode(recordLine{Kind: "step", Step: &run.Steps[i]}); err != nil {
+			return err
+		}
+	}
+	summary := run
+	summary.Steps = nil
+	return enc.Encode(recordLine{Kind: "run", Run: &summary})
+}
+
+// ReadRun reads a run written by WriteRun
+func ReadRun(r io.Reader) (RecordedRun, error) {
+	var run RecordedRun
+	var steps []RecordedStep
+	found := false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line recordLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return RecordedRun{}, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch {
+		case line.Kind == "step" && line.Step != nil:
+			steps = append(steps, *line.Step)
+		case line.Kind == "run" && line.Run != nil:
+			run = *line.Run
+			found = true
+		default:
+			return RecordedRun{}, fmt.Errorf("line %d: unknown record %q", n, line.Kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return RecordedRun{}, err
+	}
+	if !found {
+		return RecordedRun{}, ErrNoRun
+	}
+	run.Steps = steps
+	return run, nil
+}
+
+// LoadRun reads a run from a JSONL file
+func LoadRun(path string) (RecordedRun, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return RecordedRun{}, err
+	}
+	defer f.Close()
+
+	run, err := ReadRun(f)
+	if err != nil {
+		return RecordedRun{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return run, nil
+}
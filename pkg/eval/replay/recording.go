@@ -0,0 +1,245 @@
+// Package replay re-runs recorded graph runs deterministically, serving
+// agent responses and tool results from a recording instead of calling
+// models and external services
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/eval"
+)
+
+// AgentTurn is a message an agent processed during a recorded run
+type AgentTurn struct {
+	// Agent is the ID of the agent
+	Agent string `json:"agent"`
+
+	// Node and Step locate the node the agent ran in
+	Node string `json:"node,omitempty"`
+	Step int    `json:"step"`
+
+	// Input is the message the agent was given
+	Input core.Message `json:"input"`
+
+	// Output is the messages the agent returned
+	Output []core.Message `json:"output,omitempty"`
+
+	// Error is the error the agent returned, if any
+	Error string `json:"error,omitempty"`
+}
+
+// ToolCall is a tool execution of a recorded run
+type ToolCall struct {
+	// Tool is the name of the tool
+	Tool string `json:"tool"`
+
+	// Node and Step locate the node the tool ran in
+	Node string `json:"node,omitempty"`
+	Step int    `json:"step"`
+
+	// Arguments are the arguments the tool was called with
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+
+	// Result is the JSON encoded result of the tool
+	Result json.RawMessage `json:"result,omitempty"`
+
+	// Error is the error the tool returned, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Recording is everything needed to replay a run without a model: its input,
+// the node executions and final state, and every agent turn and tool call
+type Recording struct {
+	// Input is the JSON encoded input state
+	Input json.RawMessage `json:"input"`
+
+	// Run is the recorded run
+	Run eval.RecordedRun `json:"run"`
+
+	// Turns are the agent turns in the order they happened
+	Turns []AgentTurn `json:"turns,omitempty"`
+
+	// ToolCalls are the tool calls in the order they happened
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
+	// mu guards the replay cursors, which count the turns served per agent
+	// and the calls served per tool
+	mu     sync.Mutex
+	agents map[string]int
+	tools  map[string]int
+}
+
+// WriteRecording writes a recording as JSON
+func WriteRecording(w io.Writer, rec *Recording) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rec)
+}
+
+// ReadRecording reads a recording written by WriteRecording
+func ReadRecording(r io.Reader) (*Recording, error) {
+	var rec Recording
+	if err := json.NewDecoder(r).Decode(&rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// LoadRecording reads a recording from a file
+func LoadRecording(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecording(f)
+}
+
+// Recorder captures the agent turns and tool calls of a live run. Wrap the
+// agents and tools of the graph with Agent and Tool before running it with
+// Record.
+type Recorder struct {
+	mu    sync.Mutex
+	turns []AgentTurn
+	calls []ToolCall
+}
+
+// NewRecorder creates an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Agent wraps an agent so its turns are recorded
+func (r *Recorder) Agent(a agent.Agent) agent.Agent {
+	return &recordingAgent{Agent: a, recorder: r}
+}
+
+// Tool wraps a tool so its calls are recorded
+func (r *Recorder) Tool(t core.Tool) core.Tool {
+	return &recordingTool{Tool: t, recorder: r}
+}
+
+// Record runs the graph and returns the recording of the run together with
+// the final state. Node outputs are recorded when the graph streams in
+// StreamDebug mode; the node sequence and final state are recorded either way.
+func Record[T any](ctx context.Context, g *core.StateGraph[T], recorder *Recorder, state T) (*Recording, T, error) {
+	var zero T
+	input, err := core.EncodeJSON(g.Codec(), state)
+	if err != nil {
+		return nil, zero, err
+	}
+	runnable, err := g.Compile()
+	if err != nil {
+		return nil, zero, err
+	}
+
+	var run eval.RecordedRun
+	var final T
+	steps, err := collectSteps(ctx, func(ctx context.Context) error {
+		var runErr error
+		run, final, runErr = eval.RecordRun(ctx, runnable, state)
+		return runErr
+	})
+	if len(run.Steps) == 0 {
+		run.Steps = steps
+	}
+	if len(run.FinalState) == 0 && err == nil {
+		if data, redactErr := g.RedactState(final); redactErr == nil {
+			run.FinalState = data
+		}
+	}
+
+	recorder.mu.Lock()
+	rec := &Recording{
+		Input:     input,
+		Run:       run,
+		Turns:     append([]AgentTurn(nil), recorder.turns...),
+		ToolCalls: append([]ToolCall(nil), recorder.calls...),
+	}
+	recorder.mu.Unlock()
+	return rec, final, err
+}
+
+// collectSteps calls run with a context whose graph runs publish to a private
+// lifecycle bus, and returns the node executions published
+func collectSteps(ctx context.Context, run func(ctx context.Context) error) ([]eval.RecordedStep, error) {
+	bus := core.NewLifecycleBus(0)
+	events, unsubscribe := bus.Subscribe(core.EventFilter{Types: []core.LifecycleEventType{core.LifecycleNodeCompleted}})
+
+	var steps []eval.RecordedStep
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for evt := range events {
+			steps = append(steps, eval.RecordedStep{Node: evt.Node, Step: evt.Step, Duration: evt.Duration})
+		}
+	}()
+
+	err := run(core.WithLifecycleBus(ctx, bus))
+	unsubscribe()
+	<-done
+	return steps, err
+}
+
+// recordingAgent records the turns of an agent
+type recordingAgent struct {
+	agent.Agent
+	recorder *Recorder
+}
+
+// ProcessMessage processes the message and records the turn
+func (a *recordingAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	out, err := a.Agent.ProcessMessage(ctx, msg)
+
+	step, _ := core.StepFromContext(ctx)
+	turn := AgentTurn{
+		Agent:  a.ID(),
+		Node:   core.NodeFromContext(ctx),
+		Step:   step,
+		Input:  msg,
+		Output: out,
+	}
+	if err != nil {
+		turn.Error = err.Error()
+	}
+
+	a.recorder.mu.Lock()
+	a.recorder.turns = append(a.recorder.turns, turn)
+	a.recorder.mu.Unlock()
+	return out, err
+}
+
+// recordingTool records the calls of a tool
+type recordingTool struct {
+	core.Tool
+	recorder *Recorder
+}
+
+// Execute runs the tool and records the call
+func (t *recordingTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	result, err := t.Tool.Execute(ctx, args)
+
+	step, _ := core.StepFromContext(ctx)
+	call := ToolCall{
+		Tool:      t.Name(),
+		Node:      core.NodeFromContext(ctx),
+		Step:      step,
+		Arguments: args,
+	}
+	if err != nil {
+		call.Error = err.Error()
+	} else if data, marshalErr := json.Marshal(result); marshalErr == nil {
+		call.Result = data
+	}
+
+	t.recorder.mu.Lock()
+	t.recorder.calls = append(t.recorder.calls, call)
+	t.recorder.mu.Unlock()
+	return result, err
+}
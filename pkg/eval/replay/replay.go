@@ -0,0 +1,457 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/eval/compare"
+)
+
+var (
+	// ErrDivergence is returned when a replayed run departs from its recording
+	ErrDivergence = errors.New("replay diverged from recording")
+)
+
+// Divergence kinds
+const (
+	DivergenceAgent = "agent"
+	DivergenceTool  = "tool"
+	DivergenceNode  = "node"
+	DivergenceState = "state"
+)
+
+// Divergence describes where a replayed run departed from its recording
+type Divergence struct {
+	// Kind is DivergenceAgent, DivergenceTool, DivergenceNode or
+	// DivergenceState
+	Kind string
+
+	// Name is the ID of the agent or the name of the tool
+	Name string
+
+	// Node and Step locate the node that diverged. Step is -1 for the
+	// final state.
+	Node string
+	Step int
+
+	// Turn counts the turns of the agent or the calls of the tool, from 1
+	Turn int
+
+	// Field is the message field, argument or state path that differs. It
+	// is empty when a whole turn or call is missing from one side.
+	Field string
+
+	// Unrecorded is set when the replay made a turn or call the recording
+	// doesn't have, rather than skipping a recorded one
+	Unrecorded bool
+
+	// Recorded and Got are the recorded and replayed values
+	Recorded string
+	Got      string
+}
+
+// Error describes the divergence and shows a word diff of the values
+func (d *Divergence) Error() string {
+	var b strings.Builder
+	b.WriteString(ErrDivergence.Error())
+	if d.Step >= 0 {
+		fmt.Fprintf(&b, " at step %d", d.Step)
+		if d.Node != "" {
+			fmt.Fprintf(&b, " (node %q)", d.Node)
+		}
+	} else {
+		b.WriteString(" in final state")
+	}
+	b.WriteString(": ")
+
+	switch d.Kind {
+	case DivergenceAgent, DivergenceTool:
+		unit := "turn"
+		if d.Kind == DivergenceTool {
+			unit = "call"
+		}
+		fmt.Fprintf(&b, "%s %q %s %d", d.Kind, d.Name, unit, d.Turn)
+		switch {
+		case d.Unrecorded:
+			b.WriteString(" was not recorded")
+		case d.Field == "":
+			b.WriteString(" was recorded but never made")
+		default:
+			fmt.Fprintf(&b, ": %s differs: %s", d.Field, d.Diff())
+		}
+	case DivergenceNode:
+		switch {
+		case d.Recorded == "":
+			fmt.Fprintf(&b, "ran node %q after the recorded run ended", d.Got)
+		case d.Got == "":
+			fmt.Fprintf(&b, "recorded node %q never ran", d.Recorded)
+		default:
+			fmt.Fprintf(&b, "ran node %q, recorded %q", d.Got, d.Recorded)
+		}
+	case DivergenceState:
+		fmt.Fprintf(&b, "%s differs: %s", d.Field, d.Diff())
+	}
+	return b.String()
+}
+
+// Unwrap returns ErrDivergence
+func (d *Divergence) Unwrap() error {
+	return ErrDivergence
+}
+
+// Diff renders a word diff from the recorded to the replayed value, marking
+// removed words as [-word-] and added words as {+word+}
+func (d *Divergence) Diff() string {
+	var b strings.Builder
+	for _, op := range core.WordDiff(d.Recorded, d.Got) {
+		switch op.Op {
+		case core.DiffDelete:
+			b.WriteString("[-" + op.Text + "-]")
+		case core.DiffInsert:
+			b.WriteString("{+" + op.Text + "+}")
+		default:
+			b.WriteString(op.Text)
+		}
+	}
+	return b.String()
+}
+
+// nextTurn returns the next recorded turn of the agent and its number
+func (r *Recording) nextTurn(id string) (AgentTurn, int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.agents[id]
+	r.agents[id] = n + 1
+	for _, turn := range r.Turns {
+		if turn.Agent != id {
+			continue
+		}
+		if n == 0 {
+			return turn, r.agents[id], true
+		}
+		n--
+	}
+	return AgentTurn{}, r.agents[id], false
+}
+
+// nextCall returns the next recorded call of the tool and its number
+func (r *Recording) nextCall(name string) (ToolCall, int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.tools[name]
+	r.tools[name] = n + 1
+	for _, call := range r.ToolCalls {
+		if call.Tool != name {
+			continue
+		}
+		if n == 0 {
+			return call, r.tools[name], true
+		}
+		n--
+	}
+	return ToolCall{}, r.tools[name], false
+}
+
+// register starts serving an agent or tool
+func (r *Recording) register(agentID, toolName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.agents == nil {
+		r.agents = make(map[string]int)
+		r.tools = make(map[string]int)
+	}
+	if agentID != "" {
+		r.agents[agentID] = 0
+	}
+	if toolName != "" {
+		r.tools[toolName] = 0
+	}
+}
+
+// rewind resets the cursors of the served agents and tools
+func (r *Recording) rewind() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range r.agents {
+		r.agents[id] = 0
+	}
+	for name := range r.tools {
+		r.tools[name] = 0
+	}
+}
+
+// unused reports the first recorded turn or call that a served agent or tool
+// didn't make
+func (r *Recording) unused() *Divergence {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]int)
+	for _, turn := range r.Turns {
+		served, ok := r.agents[turn.Agent]
+		if !ok {
+			continue
+		}
+		seen[turn.Agent]++
+		if seen[turn.Agent] > served {
+			return &Divergence{Kind: DivergenceAgent, Name: turn.Agent, Node: turn.Node, Step: turn.Step, Turn: seen[turn.Agent], Recorded: turn.Input.Content}
+		}
+	}
+	seen = make(map[string]int)
+	for _, call := range r.ToolCalls {
+		served, ok := r.tools[call.Tool]
+		if !ok {
+			continue
+		}
+		seen[call.Tool]++
+		if seen[call.Tool] > served {
+			return &Divergence{Kind: DivergenceTool, Name: call.Tool, Node: call.Node, Step: call.Step, Turn: seen[call.Tool], Recorded: jsonString(call.Arguments)}
+		}
+	}
+	return nil
+}
+
+// replayAgent serves the recorded turns of an agent
+type replayAgent struct {
+	id        string
+	recording *Recording
+	tools     []core.Tool
+}
+
+// NewReplayAgent returns an agent that answers with the recorded turns of
+// the agent with the given ID, in order. A message that differs from the
+// recorded one, or a turn that wasn't recorded, fails with a *Divergence
+// naming the turn, node, step and differing field.
+func NewReplayAgent(recording *Recording, id string) agent.Agent {
+	recording.register(id, "")
+	return &replayAgent{id: id, recording: recording}
+}
+
+// ID returns the ID of the recorded agent
+func (a *replayAgent) ID() string {
+	return a.id
+}
+
+// Configure accepts any configuration, since no model is called
+func (a *replayAgent) Configure(config map[string]interface{}) error {
+	return nil
+}
+
+// AddTool keeps the tool for docs; recorded turns already hold tool results
+func (a *replayAgent) AddTool(tool core.Tool) {
+	a.tools = append(a.tools, tool)
+}
+
+// Tools returns the tools added to the agent
+func (a *replayAgent) Tools() []core.Tool {
+	return a.tools
+}
+
+// ProcessMessage returns the recorded response to the message
+func (a *replayAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	node := core.NodeFromContext(ctx)
+	step, _ := core.StepFromContext(ctx)
+
+	turn, n, ok := a.recording.nextTurn(a.id)
+	if !ok {
+		return nil, &Divergence{Kind: DivergenceAgent, Name: a.id, Node: node, Step: step, Turn: n, Unrecorded: true, Got: msg.Content}
+	}
+	d := &Divergence{Kind: DivergenceAgent, Name: a.id, Node: node, Step: step, Turn: n}
+	if diffMessage(d, turn, node, msg) {
+		return nil, d
+	}
+
+	if turn.Error != "" {
+		return nil, errors.New(turn.Error)
+	}
+	return append([]core.Message(nil), turn.Output...), nil
+}
+
+// diffMessage fills in the first field where the message departs from the
+// recorded turn and reports whether there was one
+func diffMessage(d *Divergence, turn AgentTurn, node string, msg core.Message) bool {
+	fields := []struct {
+		name          string
+		recorded, got string
+	}{
+		{"node", turn.Node, node},
+		{"role", string(turn.Input.Role), string(msg.Role)},
+		{"name", turn.Input.Name, msg.Name},
+		{"tool_call_id", turn.Input.ToolCallID, msg.ToolCallID},
+		{"content", turn.Input.Content, msg.Content},
+		{"tool_calls", jsonString(turn.Input.ToolCalls), jsonString(msg.ToolCalls)},
+	}
+	for _, f := range fields {
+		if f.recorded != f.got {
+			d.Field, d.Recorded, d.Got = f.name, f.recorded, f.got
+			return true
+		}
+	}
+	return false
+}
+
+// replayTool serves the recorded calls of a tool
+type replayTool struct {
+	core.Tool
+	recording *Recording
+}
+
+// NewReplayTool returns a tool with the name and schema of tool that answers
+// with its recorded results, in order, without running it. Arguments that
+// differ from the recorded ones, or a call that wasn't recorded, fail with
+// a *Divergence.
+func NewReplayTool(recording *Recording, tool core.Tool) core.Tool {
+	recording.register("", tool.Name())
+	return &replayTool{Tool: tool, recording: recording}
+}
+
+// Execute returns the recorded result of the call
+func (t *replayTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	node := core.NodeFromContext(ctx)
+	step, _ := core.StepFromContext(ctx)
+
+	call, n, ok := t.recording.nextCall(t.Name())
+	if !ok {
+		return nil, &Divergence{Kind: DivergenceTool, Name: t.Name(), Node: node, Step: step, Turn: n, Unrecorded: true, Got: jsonString(args)}
+	}
+	if field, recorded, got, differs := diffArguments(call.Arguments, args); differs {
+		return nil, &Divergence{Kind: DivergenceTool, Name: t.Name(), Node: node, Step: step, Turn: n, Field: field, Recorded: recorded, Got: got}
+	}
+
+	if call.Error != "" {
+		return nil, errors.New(call.Error)
+	}
+	if len(call.Result) == 0 {
+		return nil, nil
+	}
+	var result interface{}
+	if err := json.Unmarshal(call.Result, &result); err != nil {
+		return nil, fmt.Errorf("invalid recorded result of %s: %w", t.Name(), err)
+	}
+	return result, nil
+}
+
+// diffArguments returns the first argument that differs, comparing values
+// as JSON so recorded numbers match replayed ones
+func diffArguments(recorded, got map[string]interface{}) (string, string, string, bool) {
+	var a, b map[string]interface{}
+	json.Unmarshal([]byte(jsonString(recorded)), &a)
+	json.Unmarshal([]byte(jsonString(got)), &b)
+
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		va, inA := a[k]
+		vb, inB := b[k]
+		if inA != inB || !reflect.DeepEqual(va, vb) {
+			ra, rb := "", ""
+			if inA {
+				ra = jsonString(va)
+			}
+			if inB {
+				rb = jsonString(vb)
+			}
+			return "argument " + k, ra, rb, true
+		}
+	}
+	return "", "", "", false
+}
+
+// jsonString encodes a value as a JSON string
+func jsonString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// Run replays the recording on the graph and checks that the same nodes ran
+// in the same order and that the final state matches. The graph's agents
+// and tools should be NewReplayAgent and NewReplayTool serving the same
+// recording. The first departure is returned as a *Divergence, including
+// errors raised by replay agents and tools inside nodes.
+func Run[T any](ctx context.Context, g *core.StateGraph[T], recording *Recording) (T, error) {
+	var final T
+	state, err := core.DecodeJSON(g.Codec(), recording.Input)
+	if err != nil {
+		return final, fmt.Errorf("invalid recorded input: %w", err)
+	}
+	runnable, err := g.Compile()
+	if err != nil {
+		return final, err
+	}
+
+	recording.rewind()
+	steps, runErr := collectSteps(ctx, func(ctx context.Context) error {
+		events, wait := runnable.InvokeStreaming(ctx, state)
+		for range events {
+		}
+		var err error
+		final, err = wait()
+		return err
+	})
+
+	var d *Divergence
+	if errors.As(runErr, &d) {
+		return final, runErr
+	}
+
+	recorded := recording.Run.Steps
+	for i := 0; i < max(len(steps), len(recorded)); i++ {
+		nd := &Divergence{Kind: DivergenceNode}
+		if i < len(recorded) {
+			nd.Recorded, nd.Node, nd.Step = recorded[i].Node, recorded[i].Node, recorded[i].Step
+		}
+		if i < len(steps) {
+			nd.Got, nd.Node, nd.Step = steps[i].Node, steps[i].Node, steps[i].Step
+		}
+		if nd.Recorded != nd.Got {
+			return final, nd
+		}
+	}
+
+	if runErr != nil || recording.Run.Error != "" {
+		got := ""
+		if runErr != nil {
+			got = runErr.Error()
+		}
+		if got != recording.Run.Error {
+			return final, &Divergence{Kind: DivergenceState, Step: -1, Field: "error", Recorded: recording.Run.Error, Got: got}
+		}
+		return final, runErr
+	}
+
+	if d := recording.unused(); d != nil {
+		return final, d
+	}
+
+	if len(recording.Run.FinalState) > 0 {
+		data, err := g.RedactState(final)
+		if err != nil {
+			return final, err
+		}
+		if diffs := compare.DiffStates(recording.Run.FinalState, data); len(diffs) > 0 {
+			return final, &Divergence{
+				Kind:     DivergenceState,
+				Step:     -1,
+				Field:    diffs[0].Path,
+				Recorded: string(diffs[0].Baseline),
+				Got:      string(diffs[0].Candidate),
+			}
+		}
+	}
+	return final, nil
+}
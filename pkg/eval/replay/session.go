@@ -0,0 +1,553 @@
+package replay
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/openai/openai-go"
+)
+
+var (
+	// ErrInvalidBundle is returned when importing something that isn't a
+	// session bundle
+	ErrInvalidBundle = errors.New("invalid session bundle")
+)
+
+// Store namespaces of the content a session manager keeps per thread
+const (
+	recordingsNamespace = "session_recordings"
+	payloadsNamespace   = "session_payloads"
+)
+
+// Files of a session bundle
+const (
+	bundleIndex    = "index.json"
+	bundleThread   = "thread.json"
+	bundleMessages = "messages.json"
+	bundlePayloads = "payloads.jsonl"
+	bundleRecorded = "recordings/"
+)
+
+// BundleVersion is the version of the bundle layout Export writes
+const BundleVersion = 1
+
+// PayloadLog is a request sent to or a response received from a model
+// provider on a thread
+type PayloadLog struct {
+	Time  time.Time `json:"time"`
+	Agent string    `json:"agent"`
+
+	// Kind is "request" or "response"
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// savedRecording is a recording kept for a thread
+type savedRecording struct {
+	Time      time.Time  `json:"time"`
+	Recording *Recording `json:"recording"`
+}
+
+// SessionManager keeps what support needs to investigate a conversation,
+// the thread's checkpoint and history, the recordings of its runs and the
+// payloads its agents exchanged with the model provider, and bundles it
+// for export
+type SessionManager[T any] struct {
+	graph   *core.StateGraph[T]
+	threads *core.ThreadStore
+	store   core.Store
+
+	seq atomic.Int64
+}
+
+// NewSessionManager creates a session manager for threads of the graph.
+// Recordings and payload logs are kept in store. Nil stores are replaced by
+// in-memory ones, which is what Import is typically used with.
+func NewSessionManager[T any](graph *core.StateGraph[T], threads *core.ThreadStore, store core.Store) *SessionManager[T] {
+	if threads == nil {
+		threads = core.NewThreadStore(nil)
+	}
+	if store == nil {
+		store = core.NewMemoryStore()
+	}
+	return &SessionManager[T]{graph: graph, threads: threads, store: store}
+}
+
+// Threads returns the thread store of the manager
+func (m *SessionManager[T]) Threads() *core.ThreadStore {
+	return m.threads
+}
+
+// SaveRecording keeps the recording of a run of the thread
+func (m *SessionManager[T]) SaveRecording(ctx context.Context, threadID string, recording *Recording) error {
+	return m.put(ctx, recordingsNamespace, threadID, savedRecording{Time: time.Now(), Recording: recording})
+}
+
+// LogPayload keeps a payload an agent exchanged on the thread
+func (m *SessionManager[T]) LogPayload(ctx context.Context, threadID, agentID, kind string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	return m.put(ctx, payloadsNamespace, threadID, PayloadLog{Time: time.Now(), Agent: agentID, Kind: kind, Payload: data})
+}
+
+// PayloadOptions returns agent options logging every request and response
+// of the agent made on a thread (see core.WithThreadID)
+func (m *SessionManager[T]) PayloadOptions(agentID string) []agent.Option {
+	log := func(ctx context.Context, kind string, payload interface{}) {
+		threadID := core.ThreadIDFromContext(ctx)
+		if threadID == "" {
+			return
+		}
+		if err := m.LogPayload(ctx, threadID, agentID, kind, payload); err != nil {
+			core.LoggerFromContext(ctx).Warn("Failed to log payload", "agent", agentID, "kind", kind, "error", err)
+		}
+	}
+	return []agent.Option{
+		agent.WithRequestHook(func(ctx context.Context, params openai.ChatCompletionNewParams) {
+			log(ctx, "request", params)
+		}),
+		agent.WithResponseHook(func(ctx context.Context, completion openai.ChatCompletion) {
+			log(ctx, "response", completion)
+		}),
+	}
+}
+
+// put stores a value under a key ordering the thread's entries by time
+func (m *SessionManager[T]) put(ctx context.Context, namespace, threadID string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s/%020d-%06d", threadID, time.Now().UnixNano(), m.seq.Add(1))
+	return m.store.Put(ctx, namespace, key, data)
+}
+
+// list returns the entries kept for a thread, oldest first
+func (m *SessionManager[T]) list(ctx context.Context, namespace, threadID string) ([][]byte, error) {
+	keys, err := m.store.List(ctx, namespace, threadID+"/")
+	if err != nil {
+		return nil, err
+	}
+	entries := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		data, ok, err := m.store.Get(ctx, namespace, key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries = append(entries, data)
+		}
+	}
+	return entries, nil
+}
+
+// ExportOptions configures Export
+type ExportOptions struct {
+	// Cutoff leaves out everything recorded after it. Zero uses the time the
+	// thread was last saved while its run is in progress, so the bundle
+	// describes its last completed step, and the time of the export once
+	// the run finished.
+	Cutoff time.Time
+
+	// MaxBytes bounds the uncompressed size of the bundle's files. Files
+	// that don't fit are left out with a warning. Zero means no limit.
+	MaxBytes int64
+}
+
+// ExportIndex describes a session bundle. It is written as index.json.
+type ExportIndex struct {
+	Version  int       `json:"version"`
+	ThreadID string    `json:"thread_id"`
+	Cutoff   time.Time `json:"cutoff"`
+	Exported time.Time `json:"exported"`
+
+	// Node and Step are where the thread's run stood at the cutoff
+	Node string `json:"node,omitempty"`
+	Step int    `json:"step"`
+
+	// Redacted is set when the graph's redaction policy was applied
+	Redacted bool `json:"redacted"`
+
+	Files []ExportFile `json:"files"`
+
+	// Warnings list what is missing from the bundle and why
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ExportFile is a file of a session bundle
+type ExportFile struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+
+	// Items is the number of messages, payloads or recordings in the file
+	Items int `json:"items"`
+}
+
+// Session is the content of an imported bundle
+type Session struct {
+	Index      ExportIndex
+	Thread     *core.Thread
+	Recordings []*Recording
+	Payloads   []PayloadLog
+}
+
+// bundleFile is a file about to be written to a bundle
+type bundleFile struct {
+	name  string
+	data  []byte
+	items int
+}
+
+// Export writes everything kept for the thread up to a common cutoff as a
+// zip bundle: index.json describing the bundle, thread.json with the
+// checkpoint, messages.json with the conversation history, payloads.jsonl
+// with the payload logs and recordings/ with the run recordings. State,
+// messages and payloads are redacted with the graph's redaction policy.
+// Content that is missing or doesn't fit MaxBytes is listed as a warning in
+// the index, which is also returned.
+func (m *SessionManager[T]) Export(ctx context.Context, threadID string, w io.Writer, opts ExportOptions) (*ExportIndex, error) {
+	index := &ExportIndex{
+		Version:  BundleVersion,
+		ThreadID: threadID,
+		Cutoff:   opts.Cutoff,
+		Exported: time.Now(),
+		Redacted: m.graph.RedactionPolicy() != nil,
+	}
+	warn := func(format string, args ...interface{}) {
+		index.Warnings = append(index.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	thread, err := m.threads.SavedThread(ctx, threadID)
+	if err != nil && !errors.Is(err, core.ErrThreadNotFound) {
+		return nil, err
+	}
+	if index.Cutoff.IsZero() {
+		index.Cutoff = index.Exported
+		if thread != nil && thread.Node != "" {
+			index.Cutoff = thread.UpdatedAt
+		}
+	}
+
+	var files []bundleFile
+	switch {
+	case thread == nil:
+		warn("thread %s has no checkpoint", threadID)
+	case thread.UpdatedAt.After(index.Cutoff):
+		warn("checkpoint saved at %s is after the cutoff and was left out", thread.UpdatedAt.Format(time.RFC3339Nano))
+	default:
+		index.Node, index.Step = thread.Node, thread.Step
+		checkpoint, messages, err := m.redactThread(thread)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files,
+			bundleFile{name: bundleThread, data: checkpoint, items: 1},
+			bundleFile{name: bundleMessages, data: messages, items: len(thread.Messages)})
+	}
+
+	payloads, err := m.exportPayloads(ctx, threadID, index.Cutoff)
+	if err != nil {
+		return nil, err
+	}
+	if payloads.items == 0 {
+		warn("no payload logs were kept for the thread; enable them with PayloadOptions")
+	}
+	files = append(files, payloads)
+
+	recordings, err := m.exportRecordings(ctx, threadID, index.Cutoff)
+	if err != nil {
+		return nil, err
+	}
+	if len(recordings) == 0 {
+		warn("no run recordings were kept for the thread")
+	}
+	files = append(files, recordings...)
+
+	var total int64
+	for _, f := range files {
+		if opts.MaxBytes > 0 && total+int64(len(f.data)) > opts.MaxBytes {
+			warn("%s (%d bytes) was left out to stay within %d bytes", f.name, len(f.data), opts.MaxBytes)
+			continue
+		}
+		total += int64(len(f.data))
+		index.Files = append(index.Files, ExportFile{Name: f.name, Bytes: int64(len(f.data)), Items: f.items})
+	}
+
+	zw := zip.NewWriter(w)
+	indexData, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeZipFile(zw, bundleIndex, indexData); err != nil {
+		return nil, err
+	}
+	included := make(map[string]bool, len(index.Files))
+	for _, f := range index.Files {
+		included[f.Name] = true
+	}
+	for _, f := range files {
+		if !included[f.name] {
+			continue
+		}
+		if err := writeZipFile(zw, f.name, f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return index, nil
+}
+
+// redactThread encodes the checkpoint, without messages, and the messages
+// of a thread with the graph's redaction policy applied
+func (m *SessionManager[T]) redactThread(thread *core.Thread) ([]byte, []byte, error) {
+	checkpoint := *thread
+	checkpoint.Messages = nil
+	if len(thread.State) > 0 {
+		if err := core.CheckCodec(m.graph.Codec(), thread.Codec); err != nil {
+			return nil, nil, err
+		}
+		state, err := core.DecodeState(m.graph.Codec(), thread.State)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode state of thread %s: %w", thread.ID, err)
+		}
+		if checkpoint.State, err = m.graph.RedactState(state); err != nil {
+			return nil, nil, err
+		}
+		// The redacted state is plain JSON whatever the graph's codec
+		checkpoint.Codec = ""
+	}
+	checkpointData, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	messages := thread.Messages
+	if messages == nil {
+		messages = []core.Message{}
+	}
+	messagesData, err := core.RedactJSON(messages, m.graph.RedactionPolicy())
+	if err != nil {
+		return nil, nil, err
+	}
+	return checkpointData, messagesData, nil
+}
+
+// exportPayloads encodes the thread's payload logs up to the cutoff as JSONL
+func (m *SessionManager[T]) exportPayloads(ctx context.Context, threadID string, cutoff time.Time) (bundleFile, error) {
+	file := bundleFile{name: bundlePayloads}
+	entries, err := m.list(ctx, payloadsNamespace, threadID)
+	if err != nil {
+		return file, err
+	}
+	var b bytes.Buffer
+	for _, data := range entries {
+		var log PayloadLog
+		if err := json.Unmarshal(data, &log); err != nil {
+			return file, fmt.Errorf("failed to decode payload log: %w", err)
+		}
+		if log.Time.After(cutoff) {
+			continue
+		}
+		line, err := core.RedactJSON(log, m.graph.RedactionPolicy())
+		if err != nil {
+			return file, err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+		file.items++
+	}
+	file.data = b.Bytes()
+	return file, nil
+}
+
+// exportRecordings encodes the thread's recordings up to the cutoff, with
+// their input and final state redacted
+func (m *SessionManager[T]) exportRecordings(ctx context.Context, threadID string, cutoff time.Time) ([]bundleFile, error) {
+	entries, err := m.list(ctx, recordingsNamespace, threadID)
+	if err != nil {
+		return nil, err
+	}
+	var files []bundleFile
+	for _, data := range entries {
+		var saved savedRecording
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to decode recording: %w", err)
+		}
+		if saved.Time.After(cutoff) || saved.Recording == nil {
+			continue
+		}
+		rec := saved.Recording
+		for _, raw := range []*json.RawMessage{&rec.Input, &rec.Run.FinalState} {
+			if len(*raw) == 0 {
+				continue
+			}
+			state, err := core.DecodeJSON(m.graph.Codec(), *raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode recorded state: %w", err)
+			}
+			if *raw, err = m.graph.RedactState(state); err != nil {
+				return nil, err
+			}
+		}
+		var b bytes.Buffer
+		if err := WriteRecording(&b, rec); err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("%s%03d.json", bundleRecorded, len(files)+1)
+		if rec.Run.RunID != "" {
+			name = fmt.Sprintf("%s%03d-%s.json", bundleRecorded, len(files)+1, rec.Run.RunID)
+		}
+		files = append(files, bundleFile{name: name, data: b.Bytes(), items: 1})
+	}
+	return files, nil
+}
+
+// writeZipFile adds a file to a zip archive
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Import reads a bundle written by Export and restores its thread,
+// recordings and payload logs into the manager's stores, so the thread can
+// be resumed and its runs replayed locally. State and messages are restored
+// as exported, with redacted fields replaced.
+func (m *SessionManager[T]) Import(ctx context.Context, r io.Reader) (*Session, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	session := &Session{}
+	if err := readZipJSON(files, bundleIndex, &session.Index); err != nil {
+		return nil, err
+	}
+	if session.Index.Version != BundleVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBundle, session.Index.Version)
+	}
+	threadID := session.Index.ThreadID
+
+	if _, ok := files[bundleThread]; ok {
+		var thread core.Thread
+		if err := readZipJSON(files, bundleThread, &thread); err != nil {
+			return nil, err
+		}
+		if _, ok := files[bundleMessages]; ok {
+			if err := readZipJSON(files, bundleMessages, &thread.Messages); err != nil {
+				return nil, err
+			}
+		}
+		// The exported state is plain JSON, stored with the graph's codec
+		if len(thread.State) > 0 {
+			state, err := core.DecodeJSON(m.graph.Codec(), thread.State)
+			if err != nil {
+				return nil, fmt.Errorf("%w: thread state: %v", ErrInvalidBundle, err)
+			}
+			if thread.State, err = core.EncodeState(m.graph.Codec(), state); err != nil {
+				return nil, err
+			}
+			thread.Codec = m.graph.Codec().Name()
+		}
+		if err := m.threads.SaveThread(ctx, &thread); err != nil {
+			return nil, err
+		}
+		session.Thread = &thread
+	}
+
+	if f, ok := files[bundlePayloads]; ok {
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			if line == "" {
+				continue
+			}
+			var log PayloadLog
+			if err := json.Unmarshal([]byte(line), &log); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, bundlePayloads, err)
+			}
+			if err := m.put(ctx, payloadsNamespace, threadID, log); err != nil {
+				return nil, err
+			}
+			session.Payloads = append(session.Payloads, log)
+		}
+	}
+
+	var names []string
+	for name := range files {
+		if strings.HasPrefix(name, bundleRecorded) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content, err := readZipFile(files[name])
+		if err != nil {
+			return nil, err
+		}
+		rec, err := ReadRecording(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, name, err)
+		}
+		if err := m.SaveRecording(ctx, threadID, rec); err != nil {
+			return nil, err
+		}
+		session.Recordings = append(session.Recordings, rec)
+	}
+	return session, nil
+}
+
+// readZipJSON decodes a JSON file of a bundle
+func readZipJSON(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%w: missing %s", ErrInvalidBundle, name)
+	}
+	content, err := readZipFile(f)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidBundle, name, err)
+	}
+	return nil
+}
+
+// readZipFile reads a file of a bundle
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, f.Name, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,87 @@
+package prebuilt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// CitationOptions configures RequireCitations
+type CitationOptions struct {
+	// PerParagraph requires every paragraph to cite at least one document,
+	// rather than the answer as a whole
+	PerParagraph bool
+
+	// Checker optionally asks an agent for claims that aren't cited, see
+	// FlagUncitedClaims
+	Checker agent.Agent
+}
+
+// RequireCitations returns a guard validator checking that the answer in
+// the state cites the documents in the state: every [n] marker must refer
+// to a document, and the answer, or every paragraph with PerParagraph,
+// must cite at least one. Uncited claims the checker flags are violations
+// too.
+func RequireCitations[T any](answer func(T) string, docs func(T) []core.Document, opts CitationOptions) Validator[T] {
+	return func(ctx context.Context, state T) []Violation {
+		text := answer(state)
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+
+		var violations []Violation
+		citations, err := core.ExtractCitations(text, docs(state))
+		if err != nil {
+			violations = append(violations, Violation{Message: err.Error()})
+		}
+
+		if opts.PerParagraph {
+			for _, paragraph := range core.UncitedParagraphs(text) {
+				violations = append(violations, Violation{
+					Message: fmt.Sprintf("paragraph cites no document: %q", truncate(paragraph, 80)),
+				})
+			}
+		} else if len(citations) == 0 && err == nil {
+			violations = append(violations, Violation{Message: "answer cites no document"})
+		}
+
+		if opts.Checker != nil {
+			claims, err := FlagUncitedClaims(ctx, opts.Checker, text)
+			if err != nil {
+				core.LoggerFromContext(ctx).Warn("Citation check failed, skipping it", "error", err)
+			}
+			for _, claim := range claims {
+				violations = append(violations, Violation{
+					Message: fmt.Sprintf("claim is not cited: %q", truncate(claim, 80)),
+				})
+			}
+		}
+		return violations
+	}
+}
+
+// FlagUncitedClaims asks the checker agent for the sentences of an answer
+// that state facts without a citation marker
+func FlagUncitedClaims(ctx context.Context, checker agent.Agent, answer string) ([]string, error) {
+	prompt := "List every sentence of the answer below that states a fact but has no citation " +
+		"marker like [1]. Reply with one sentence per line, exactly as written, or with NONE.\n\n" +
+		"Answer:\n" + answer
+
+	reply, err := ask(ctx, checker, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("citation checker error: %w", err)
+	}
+
+	var claims []string
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•"))
+		if line == "" || strings.EqualFold(line, "NONE") {
+			continue
+		}
+		claims = append(claims, line)
+	}
+	return claims, nil
+}
@@ -0,0 +1,167 @@
+package prebuilt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrGuardFailed is returned when the state still violates the guard's
+	// validators after all repair attempts
+	ErrGuardFailed = errors.New("guard validation failed")
+)
+
+// EventGuardRepair is emitted for every repair attempt made by a guard node
+const EventGuardRepair core.EventType = "on_guard_repair"
+
+// Violation describes a single validation failure
+type Violation struct {
+	// Field is the state field that failed validation, if any
+	Field string `json:"field,omitempty"`
+
+	// Message describes what is wrong
+	Message string `json:"message"`
+}
+
+// Validator checks a state and returns any violations found
+type Validator[T any] func(ctx context.Context, state T) []Violation
+
+// GuardError is returned by a guard node that could not repair the state.
+// It wraps ErrGuardFailed.
+type GuardError struct {
+	// Violations are the violations that remained after the last attempt
+	Violations []Violation
+
+	// Attempts is the number of repair attempts made
+	Attempts int
+}
+
+func (e *GuardError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		if v.Field != "" {
+			messages = append(messages, v.Field+": "+v.Message)
+		} else {
+			messages = append(messages, v.Message)
+		}
+	}
+	return fmt.Sprintf("%s after %d repair attempts: %s", ErrGuardFailed, e.Attempts, strings.Join(messages, "; "))
+}
+
+func (e *GuardError) Unwrap() error {
+	return ErrGuardFailed
+}
+
+// GuardNode returns a node function that validates the state against all
+// validators. When there are violations the state and the violations are sent
+// to the repair agent as JSON, and the agent's reply is decoded as the
+// repaired state and validated again. After maxRepairs failed attempts the
+// node fails with a *GuardError.
+func GuardNode[T any](validators []Validator[T], repairAgent agent.Agent, maxRepairs int) func(ctx context.Context, state T) (T, error) {
+	node := func(ctx context.Context, state T) (T, error) {
+		violations := validate(ctx, validators, state)
+
+		for attempt := 1; len(violations) > 0; attempt++ {
+			if attempt > maxRepairs || repairAgent == nil {
+				return state, &GuardError{Violations: violations, Attempts: attempt - 1}
+			}
+
+			repaired, err := repairState(ctx, repairAgent, state, violations)
+
+			metadata := map[string]interface{}{
+				"attempt":    attempt,
+				"violations": violations,
+			}
+			if err != nil {
+				metadata["error"] = err.Error()
+			}
+			core.EmitEvent(ctx, core.Event{
+				Type:      EventGuardRepair,
+				Name:      repairAgent.ID(),
+				Timestamp: time.Now(),
+				Metadata:  metadata,
+			})
+
+			if err != nil {
+				// A reply that can't be decoded counts as a failed attempt
+				if errors.Is(err, errInvalidRepair) {
+					continue
+				}
+				return state, err
+			}
+
+			state = repaired
+			violations = validate(ctx, validators, state)
+		}
+
+		return state, nil
+	}
+	core.DescribeNodeFunc(node, "Validates the state and asks an agent to repair any violations")
+	return node
+}
+
+// errInvalidRepair is returned when the repair agent's reply is not a valid state
+var errInvalidRepair = errors.New("invalid repair")
+
+// validate runs every validator and collects their violations
+func validate[T any](ctx context.Context, validators []Validator[T], state T) []Violation {
+	var violations []Violation
+	for _, validator := range validators {
+		violations = append(violations, validator(ctx, state)...)
+	}
+	return violations
+}
+
+// repairState asks the repair agent to fix the state
+func repairState[T any](ctx context.Context, repairAgent agent.Agent, state T, violations []Violation) (T, error) {
+	var zero T
+
+	stateJSON, err := core.MarshalState(state)
+	if err != nil {
+		return zero, fmt.Errorf("failed to marshal state for repair: %w", err)
+	}
+	violationsJSON, err := json.Marshal(violations)
+	if err != nil {
+		return zero, fmt.Errorf("failed to marshal violations: %w", err)
+	}
+
+	prompt := "The following JSON state failed validation.\n\n" +
+		"State:\n" + string(stateJSON) + "\n\n" +
+		"Violations:\n" + string(violationsJSON) + "\n\n" +
+		"Fix only the offending fields and reply with the complete corrected state as a single JSON object and nothing else."
+
+	responses, err := repairAgent.ProcessMessage(ctx, core.Message{
+		Role:    core.RoleUser,
+		Content: prompt,
+	})
+	if err != nil {
+		return zero, fmt.Errorf("repair agent error: %w", err)
+	}
+	if len(responses) == 0 {
+		return zero, fmt.Errorf("%w: empty response", errInvalidRepair)
+	}
+
+	repaired, err := core.UnmarshalState[T]([]byte(extractJSON(responses[len(responses)-1].Content)))
+	if err != nil {
+		return zero, fmt.Errorf("%w: %v", errInvalidRepair, err)
+	}
+	return repaired, nil
+}
+
+// extractJSON returns the JSON object in a model reply, stripping any
+// surrounding prose or markdown code fences
+func extractJSON(content string) string {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return strings.TrimSpace(content)
+	}
+	return content[start : end+1]
+}
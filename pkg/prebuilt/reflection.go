@@ -0,0 +1,278 @@
+package prebuilt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrInvalidCritique is returned when a critic reply isn't a score with
+	// feedback
+	ErrInvalidCritique = errors.New("invalid critique")
+)
+
+// EventReflection is emitted every time the critic scores a draft
+const EventReflection core.EventType = "on_reflection"
+
+const (
+	// DefaultReflectionThreshold is the score, out of 10, a draft needs to
+	// pass when the options set none
+	DefaultReflectionThreshold = 8
+
+	// DefaultMaxIterations bounds the drafts of a reflection loop that sets
+	// no limit
+	DefaultMaxIterations = 3
+)
+
+// Run metadata keys recorded when a reflection loop ends
+const (
+	ReflectionIterationsKey = "reflection_iterations"
+	ReflectionScoreKey      = "reflection_score"
+)
+
+// Nodes of a reflection loop
+const (
+	draftNode    = "draft"
+	critiqueNode = "critique"
+)
+
+// Critique is the critic's assessment of a draft
+type Critique struct {
+	// Score is the score of the draft, from 0 to 10
+	Score float64 `json:"score"`
+
+	// Feedback lists what the author should change
+	Feedback []string `json:"feedback,omitempty"`
+}
+
+// Reflection records the work of a reflection loop. Drafts[i] was assessed
+// by Critiques[i].
+type Reflection struct {
+	Drafts    []string   `json:"drafts,omitempty"`
+	Critiques []Critique `json:"critiques,omitempty"`
+
+	// Score is the score of the last draft
+	Score float64 `json:"score,omitempty"`
+
+	// Passed is set when the last draft reached the threshold
+	Passed bool `json:"passed,omitempty"`
+}
+
+// Final returns the last draft
+func (r Reflection) Final() string {
+	if len(r.Drafts) == 0 {
+		return ""
+	}
+	return r.Drafts[len(r.Drafts)-1]
+}
+
+// ReflectionOptions configures ReflectionLoop
+type ReflectionOptions[T any] struct {
+	// Task returns what the author is asked to write
+	Task func(T) string
+
+	// Get and Set read and write the loop's record in the state
+	Get func(T) Reflection
+	Set func(T, Reflection) T
+
+	// Rubric is what the critic scores drafts against
+	Rubric string
+
+	// Threshold is the score a draft needs to pass, DefaultReflectionThreshold
+	// when zero
+	Threshold float64
+
+	// MaxIterations bounds the number of drafts, DefaultMaxIterations when
+	// zero. The loop ends with the last draft when it is reached.
+	MaxIterations int
+
+	// ShowPriorCritiques lets the critic see its critiques of earlier drafts,
+	// rather than scoring every draft afresh
+	ShowPriorCritiques bool
+}
+
+// ReflectionLoop returns a graph in which the author drafts from the state,
+// the critic scores the draft against the rubric, and the author revises
+// until a draft reaches the threshold or the iterations run out. Every draft
+// and critique is recorded in the state. When the loop ends, the iteration
+// count and final score are recorded as run metadata under
+// ReflectionIterationsKey and ReflectionScoreKey.
+func ReflectionLoop[T any](author, critic agent.Agent, opts ReflectionOptions[T]) (*core.StateGraph[T], error) {
+	if author == nil || critic == nil {
+		return nil, fmt.Errorf("reflection loop needs an author and a critic")
+	}
+	if opts.Task == nil || opts.Get == nil || opts.Set == nil {
+		return nil, fmt.Errorf("reflection loop needs Task, Get and Set")
+	}
+	if opts.Threshold == 0 {
+		opts.Threshold = DefaultReflectionThreshold
+	}
+	if opts.MaxIterations <= 0 {
+		opts.MaxIterations = DefaultMaxIterations
+	}
+
+	g := core.NewStateGraph[T]()
+	g.AddNode(draftNode, func(ctx context.Context, state T) (T, error) {
+		record := opts.Get(state)
+		draft, err := ask(ctx, author, draftPrompt(opts.Task(state), record))
+		if err != nil {
+			return state, fmt.Errorf("author error: %w", err)
+		}
+		record.Drafts = append(record.Drafts, strings.TrimSpace(draft))
+		return opts.Set(state, record), nil
+	})
+	g.AddNode(critiqueNode, func(ctx context.Context, state T) (T, error) {
+		record := opts.Get(state)
+		critique, err := critiqueDraft(ctx, critic, opts.Rubric, opts.Task(state), record, opts.ShowPriorCritiques)
+		if err != nil {
+			return state, err
+		}
+		record.Critiques = append(record.Critiques, critique)
+		record.Score = critique.Score
+		record.Passed = critique.Score >= opts.Threshold
+
+		iteration := len(record.Drafts)
+		core.EmitEvent(ctx, core.Event{
+			Type:      EventReflection,
+			Name:      critiqueNode,
+			RunID:     core.RunIDFromContext(ctx),
+			Timestamp: time.Now(),
+			Metadata: map[string]interface{}{
+				"iteration": iteration,
+				"score":     critique.Score,
+				"passed":    record.Passed,
+			},
+		})
+		if record.Passed || iteration >= opts.MaxIterations {
+			core.SetRunMetadata(ctx, ReflectionIterationsKey, iteration)
+			core.SetRunMetadata(ctx, ReflectionScoreKey, critique.Score)
+		}
+		return opts.Set(state, record), nil
+	})
+
+	g.SetEntryPoint(draftNode)
+	g.AddConditionalEdges(draftNode, func(state T) ([]string, error) {
+		return []string{critiqueNode}, nil
+	}, nil)
+	g.AddConditionalEdges(critiqueNode, func(state T) ([]string, error) {
+		record := opts.Get(state)
+		if record.Passed || len(record.Drafts) >= opts.MaxIterations {
+			return []string{core.END}, nil
+		}
+		return []string{draftNode}, nil
+	}, nil)
+	return g, nil
+}
+
+// ReflectionState is the state of a graph built by NewReflectionGraph
+type ReflectionState struct {
+	// Task is what the generator is asked to write
+	Task string `json:"task"`
+
+	// Reflection records the drafts and the critic's verdicts on them
+	Reflection Reflection `json:"reflection"`
+}
+
+// NewReflectionGraph returns a generate, critique and regenerate loop over
+// ReflectionState. The critic's verdict on each draft, a score with
+// feedback, ends the loop once the score reaches DefaultReflectionThreshold
+// and otherwise sends the feedback back to the generator, for at most
+// maxIterations drafts. Use ReflectionLoop to embed the loop in another
+// state or to change the rubric or threshold.
+func NewReflectionGraph(generator, critic agent.Agent, maxIterations int) (*core.StateGraph[ReflectionState], error) {
+	return ReflectionLoop(generator, critic, ReflectionOptions[ReflectionState]{
+		Task: func(s ReflectionState) string { return s.Task },
+		Get:  func(s ReflectionState) Reflection { return s.Reflection },
+		Set: func(s ReflectionState, r Reflection) ReflectionState {
+			s.Reflection = r
+			return s
+		},
+		MaxIterations: maxIterations,
+	})
+}
+
+// draftPrompt asks for a first draft, or for a revision of the last draft
+// addressing its critique
+func draftPrompt(task string, record Reflection) string {
+	if len(record.Drafts) == 0 || len(record.Critiques) < len(record.Drafts) {
+		return "Task:\n" + task + "\n\nReply with your draft only."
+	}
+	critique := record.Critiques[len(record.Critiques)-1]
+	return fmt.Sprintf("Task:\n%s\n\nYour previous draft:\n%s\n\nIt scored %g out of 10. Feedback:\n%s\n\n"+
+		"Revise the draft to address the feedback. Reply with the revised draft only.",
+		task, record.Final(), critique.Score, feedbackList(critique.Feedback))
+}
+
+// critiqueDraft asks the critic to score the last draft. A reply that isn't
+// a critique is asked for once more before giving up.
+func critiqueDraft(ctx context.Context, critic agent.Agent, rubric, task string, record Reflection, showPrior bool) (Critique, error) {
+	var b strings.Builder
+	b.WriteString("Score the draft below from 0 to 10 against the rubric, and list what should change. " +
+		`Reply with JSON only, like {"score": 7, "feedback": ["..."]}.` + "\n\n")
+	if rubric != "" {
+		b.WriteString("Rubric:\n" + rubric + "\n\n")
+	}
+	b.WriteString("Task:\n" + task + "\n\n")
+	if showPrior && len(record.Critiques) > 0 {
+		b.WriteString("Your critiques of earlier drafts:\n")
+		for i, c := range record.Critiques {
+			fmt.Fprintf(&b, "Draft %d scored %g:\n%s\n", i+1, c.Score, feedbackList(c.Feedback))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Draft:\n" + record.Final())
+
+	prompt := b.String()
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		reply, err := ask(ctx, critic, prompt)
+		if err != nil {
+			return Critique{}, fmt.Errorf("critic error: %w", err)
+		}
+		critique, err := parseCritique(reply)
+		if err == nil {
+			return critique, nil
+		}
+		lastErr = err
+		prompt = fmt.Sprintf("Your reply could not be read: %v. "+
+			`Reply with JSON only, like {"score": 7, "feedback": ["..."]}.`, err)
+	}
+	return Critique{}, lastErr
+}
+
+// parseCritique reads a critique from a critic reply
+func parseCritique(reply string) (Critique, error) {
+	var raw struct {
+		Score    *float64 `json:"score"`
+		Feedback []string `json:"feedback"`
+	}
+	if err := json.Unmarshal([]byte(extractJSON(reply)), &raw); err != nil {
+		return Critique{}, fmt.Errorf("%w: %v", ErrInvalidCritique, err)
+	}
+	if raw.Score == nil {
+		return Critique{}, fmt.Errorf("%w: no score", ErrInvalidCritique)
+	}
+	if *raw.Score < 0 || *raw.Score > 10 {
+		return Critique{}, fmt.Errorf("%w: score %g is not between 0 and 10", ErrInvalidCritique, *raw.Score)
+	}
+	return Critique{Score: *raw.Score, Feedback: raw.Feedback}, nil
+}
+
+// feedbackList formats feedback items as a bulleted list
+func feedbackList(feedback []string) string {
+	if len(feedback) == 0 {
+		return "- (none)"
+	}
+	lines := make([]string, len(feedback))
+	for i, item := range feedback {
+		lines[i] = "- " + item
+	}
+	return strings.Join(lines, "\n")
+}
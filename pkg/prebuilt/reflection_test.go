@@ -0,0 +1,82 @@
+package prebuilt_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/prebuilt"
+)
+
+// scriptedAgent answers with its replies in order and remembers the prompts
+type scriptedAgent struct {
+	id      string
+	replies []string
+	prompts []string
+}
+
+func (a *scriptedAgent) ID() string                                    { return a.id }
+func (a *scriptedAgent) Configure(config map[string]interface{}) error { return nil }
+func (a *scriptedAgent) AddTool(tool core.Tool)                        {}
+
+func (a *scriptedAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	a.prompts = append(a.prompts, msg.Content)
+	reply := a.replies[0]
+	a.replies = a.replies[1:]
+	return []core.Message{{Role: core.RoleAssistant, Name: a.id, Content: reply}}, nil
+}
+
+func TestReflectionGraphCriticApprovesSecondPass(t *testing.T) {
+	generator := &scriptedAgent{id: "generator", replies: []string{"roses are red", "roses are red, violets are blue"}}
+	critic := &scriptedAgent{id: "critic", replies: []string{
+		`{"score": 4, "feedback": ["it doesn't rhyme"]}`,
+		"```json\n{\"score\": 9}\n```",
+	}}
+	g, err := prebuilt.NewReflectionGraph(generator, critic, 3)
+	if err != nil {
+		t.Fatalf("NewReflectionGraph: %v", err)
+	}
+	g.SetStreamConfig(core.StreamConfig{})
+	r, err := g.Compile()
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	out, err := r.Invoke(context.Background(), prebuilt.ReflectionState{Task: "write a poem"})
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	record := out.Reflection
+	if len(record.Drafts) != 2 || len(record.Critiques) != 2 {
+		t.Fatalf("record = %+v, want two drafts, each critiqued", record)
+	}
+	if !record.Passed || record.Score != 9 || record.Final() != "roses are red, violets are blue" {
+		t.Errorf("record = %+v, want the second draft passing with 9", record)
+	}
+	if revision := generator.prompts[1]; !strings.Contains(revision, "it doesn't rhyme") || !strings.Contains(revision, "roses are red") {
+		t.Errorf("revision prompt = %q, want the first draft and its feedback", revision)
+	}
+}
+
+func TestReflectionGraphStopsAtMaxIterations(t *testing.T) {
+	generator := &scriptedAgent{id: "generator", replies: []string{"one", "two"}}
+	critic := &scriptedAgent{id: "critic", replies: []string{`{"score": 2}`, `{"score": 3}`}}
+	g, err := prebuilt.NewReflectionGraph(generator, critic, 2)
+	if err != nil {
+		t.Fatalf("NewReflectionGraph: %v", err)
+	}
+	g.SetStreamConfig(core.StreamConfig{})
+	r, err := g.Compile()
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	out, err := r.Invoke(context.Background(), prebuilt.ReflectionState{Task: "write a poem"})
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if out.Reflection.Passed || out.Reflection.Final() != "two" || len(critic.prompts) != 2 {
+		t.Errorf("record = %+v, want the loop to end with the second draft failing", out.Reflection)
+	}
+}
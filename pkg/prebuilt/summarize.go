@@ -0,0 +1,288 @@
+package prebuilt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/documents"
+)
+
+var (
+	// ErrNoText is returned when the state has no text to summarize
+	ErrNoText = errors.New("no text to summarize")
+)
+
+// SummaryResult is the output of a map-reduce summarization
+type SummaryResult struct {
+	// Summary is the final summary
+	Summary string `json:"summary"`
+
+	// Chunks is the number of chunks the input was split into
+	Chunks int `json:"chunks"`
+
+	// Levels is the number of summarization levels, one for the map step
+	// plus one for every reduce step
+	Levels int `json:"levels"`
+}
+
+// SummaryProgress is emitted on the custom stream for every summarized chunk
+// or group of partial summaries
+type SummaryProgress struct {
+	// Level is the summarization level, 1 for the map step
+	Level int `json:"level"`
+
+	// Index is the position of the chunk or group within its level
+	Index int `json:"index"`
+
+	// Done is the number of items of the level summarized so far
+	Done int `json:"done"`
+
+	// Total is the number of items in the level
+	Total int `json:"total"`
+}
+
+// MapReduceConfig contains configuration for a map-reduce summarization node
+type MapReduceConfig struct {
+	// Concurrency is the maximum number of summarization requests in flight
+	Concurrency int
+
+	// TargetTokens is the token budget the final summary must fit
+	TargetTokens int
+
+	// FanIn is the number of partial summaries combined per reduce request
+	FanIn int
+
+	// MaxLevels bounds the number of summarization levels
+	MaxLevels int
+
+	// MapPrompt is the instruction sent with every chunk
+	MapPrompt string
+
+	// ReducePrompt is the instruction sent with every group of partial summaries
+	ReducePrompt string
+}
+
+// MapReduceOption configures a map-reduce summarization node
+type MapReduceOption func(*MapReduceConfig)
+
+// WithConcurrency sets the maximum number of summarization requests in flight
+func WithConcurrency(n int) MapReduceOption {
+	return func(c *MapReduceConfig) {
+		c.Concurrency = n
+	}
+}
+
+// WithTargetTokens sets the token budget the final summary must fit
+func WithTargetTokens(tokens int) MapReduceOption {
+	return func(c *MapReduceConfig) {
+		c.TargetTokens = tokens
+	}
+}
+
+// WithFanIn sets the number of partial summaries combined per reduce request
+func WithFanIn(n int) MapReduceOption {
+	return func(c *MapReduceConfig) {
+		c.FanIn = n
+	}
+}
+
+// WithMaxLevels bounds the number of summarization levels
+func WithMaxLevels(n int) MapReduceOption {
+	return func(c *MapReduceConfig) {
+		c.MaxLevels = n
+	}
+}
+
+// WithSummaryPrompts sets the instructions used for the map and reduce steps
+func WithSummaryPrompts(mapPrompt, reducePrompt string) MapReduceOption {
+	return func(c *MapReduceConfig) {
+		c.MapPrompt = mapPrompt
+		c.ReducePrompt = reducePrompt
+	}
+}
+
+// MapReduceSummarize returns a node function that summarizes text too large
+// for a single request. The text is split into chunks, every chunk is
+// summarized with at most Concurrency requests in flight, and the partial
+// summaries are then combined FanIn at a time, level by level, until a single
+// summary within TargetTokens remains. Progress is emitted on the custom
+// stream as SummaryProgress values.
+//
+// Agents that can be cloned, such as the OpenAI agent, get a fresh clone per
+// request so requests don't share history. Other agents are called one
+// request at a time.
+func MapReduceSummarize[T any](
+	a agent.Agent,
+	splitter documents.Splitter,
+	getText func(T) string,
+	setResult func(T, SummaryResult) T,
+	opts ...MapReduceOption,
+) func(ctx context.Context, state T) (T, error) {
+	config := MapReduceConfig{
+		Concurrency:  4,
+		TargetTokens: 1000,
+		FanIn:        4,
+		MaxLevels:    5,
+		MapPrompt:    "Summarize the following part of a longer document. Keep every important fact, name and number.",
+		ReducePrompt: "Combine the following partial summaries of one document into a single coherent summary.",
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+	if config.FanIn < 2 {
+		config.FanIn = 2
+	}
+
+	s := &summarizer{agent: a, config: config}
+	if _, ok := a.(cloner); !ok {
+		s.serial = &sync.Mutex{}
+	}
+
+	node := func(ctx context.Context, state T) (T, error) {
+		chunks := splitter.Split(getText(state))
+		if len(chunks) == 0 {
+			return state, ErrNoText
+		}
+
+		summaries, err := s.level(ctx, 1, config.MapPrompt, chunks)
+		if err != nil {
+			return state, err
+		}
+
+		levels := 1
+		for levels < config.MaxLevels {
+			if len(summaries) == 1 && documents.EstimateTokens(summaries[0]) <= config.TargetTokens {
+				break
+			}
+
+			var groups []string
+			for i := 0; i < len(summaries); i += config.FanIn {
+				end := min(i+config.FanIn, len(summaries))
+				groups = append(groups, strings.Join(summaries[i:end], "\n\n"))
+			}
+
+			levels++
+			summaries, err = s.level(ctx, levels, config.ReducePrompt, groups)
+			if err != nil {
+				return state, err
+			}
+		}
+
+		return setResult(state, SummaryResult{
+			Summary: strings.Join(summaries, "\n\n"),
+			Chunks:  len(chunks),
+			Levels:  levels,
+		}), nil
+	}
+	core.DescribeNodeFunc(node, "Summarizes long text with an agent by splitting it into chunks and combining the partial summaries")
+	return node
+}
+
+// cloner is implemented by agents that can be copied with an empty history
+type cloner interface {
+	Clone() agent.Agent
+}
+
+// summarizer sends summarization requests to an agent
+type summarizer struct {
+	agent  agent.Agent
+	config MapReduceConfig
+
+	// serial serializes requests to agents that can't be cloned
+	serial *sync.Mutex
+}
+
+// level summarizes every item with a bounded worker pool, keeping the order
+// of the items
+func (s *summarizer) level(ctx context.Context, level int, prompt string, items []string) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]string, len(items))
+	jobs := make(chan int)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		done     int
+		firstErr error
+	)
+
+	for w := 0; w < min(s.config.Concurrency, len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				summary, err := s.summarize(ctx, prompt, items[i])
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("failed to summarize level %d item %d: %w", level, i, err)
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+				results[i] = summary
+				done++
+				progress := SummaryProgress{Level: level, Index: i, Done: done, Total: len(items)}
+				mu.Unlock()
+
+				core.EmitCustom(ctx, progress)
+			}
+		}()
+	}
+
+feed:
+	for i := range items {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// summarize sends one item to the agent and returns its reply
+func (s *summarizer) summarize(ctx context.Context, prompt, text string) (string, error) {
+	a := s.agent
+	if c, ok := a.(cloner); ok {
+		a = c.Clone()
+	} else {
+		s.serial.Lock()
+		defer s.serial.Unlock()
+	}
+
+	responses, err := a.ProcessMessage(ctx, core.Message{
+		Role:    core.RoleUser,
+		Content: prompt + "\n\n" + text,
+	})
+	if err != nil {
+		return "", err
+	}
+	for i := len(responses) - 1; i >= 0; i-- {
+		if content := strings.TrimSpace(responses[i].Content); content != "" {
+			return content, nil
+		}
+	}
+	return "", agent.ErrEmptyReply
+}
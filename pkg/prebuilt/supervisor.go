@@ -0,0 +1,390 @@
+package prebuilt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrInvalidDecision is returned when a supervisor reply names no
+	// worker, team or final answer
+	ErrInvalidDecision = errors.New("invalid supervisor decision")
+
+	// ErrInvalidTeam is returned when a supervisor or team hierarchy can't
+	// be built
+	ErrInvalidTeam = errors.New("invalid team")
+)
+
+const (
+	// EventTeamStep is emitted when a worker takes a turn
+	EventTeamStep core.EventType = "on_team_step"
+
+	// EventTeamDecision is emitted when a supervisor routes work
+	EventTeamDecision core.EventType = "on_team_decision"
+)
+
+// DefaultMaxTurns bounds the worker turns of a supervisor that sets no limit
+const DefaultMaxTurns = 10
+
+// supervisorNode is the name of the node a supervisor decides in
+const supervisorNode = "supervisor"
+
+// TeamState is the state of supervisor and hierarchical team graphs. The
+// task goes down in Task, and results come up in Results and Answer.
+type TeamState struct {
+	// Request is the original request of the run
+	Request string `json:"request"`
+
+	// Task is the task of the team at work. A supervisor run on its own
+	// falls back to Request.
+	Task string `json:"task,omitempty"`
+
+	// Messages holds the outputs of the workers, named team.worker
+	Messages []core.Message `json:"messages,omitempty"`
+
+	// Results are the results teams handed back, by team
+	Results map[string]string `json:"results,omitempty"`
+
+	// Team and Worker are handling the current step
+	Team   string `json:"team,omitempty"`
+	Worker string `json:"worker,omitempty"`
+
+	// Turns counts the worker turns of the current task, by team
+	Turns map[string]int `json:"turns,omitempty"`
+
+	// Delegations counts the tasks handed to teams
+	Delegations int `json:"delegations,omitempty"`
+
+	// Next is where the last supervisor routed the work
+	Next string `json:"next,omitempty"`
+
+	// Answer is the final answer
+	Answer string `json:"answer,omitempty"`
+}
+
+// Supervisor routes a task between workers until it decides the task is done
+type Supervisor struct {
+	agent    agent.Agent
+	workers  map[string]agent.Agent
+	maxTurns int
+}
+
+// SupervisorOption configures a Supervisor
+type SupervisorOption func(*Supervisor)
+
+// WithMaxTurns bounds the worker turns per task. When the limit is reached
+// the task finishes with the last worker output.
+func WithMaxTurns(n int) SupervisorOption {
+	return func(s *Supervisor) {
+		s.maxTurns = n
+	}
+}
+
+// NewSupervisor creates a supervisor that asks its agent which worker acts
+// next. The agent replies "NEXT: <worker>" or "FINISH: <result>".
+func NewSupervisor(supervisor agent.Agent, workers map[string]agent.Agent, opts ...SupervisorOption) *Supervisor {
+	s := &Supervisor{
+		agent:    supervisor,
+		workers:  workers,
+		maxTurns: DefaultMaxTurns,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Workers returns the names of the workers, sorted
+func (s *Supervisor) Workers() []string {
+	names := make([]string, 0, len(s.workers))
+	for name := range s.workers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Graph returns a graph running the supervisor on its own. The result ends
+// up in Answer.
+func (s *Supervisor) Graph() (*core.StateGraph[TeamState], error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	g := core.NewStateGraph[TeamState]()
+	s.build(g, "", s.maxTurns, core.END)
+	return g, nil
+}
+
+// validate checks the worker names
+func (s *Supervisor) validate() error {
+	if len(s.workers) == 0 {
+		return fmt.Errorf("%w: supervisor has no workers", ErrInvalidTeam)
+	}
+	for name := range s.workers {
+		if name == "" || name == supervisorNode || name == core.END || strings.Contains(name, core.GroupSeparator) {
+			return fmt.Errorf("%w: invalid worker name %q", ErrInvalidTeam, name)
+		}
+	}
+	return nil
+}
+
+// build adds the supervisor and worker nodes to g, with the supervisor as
+// entry point. A finished task routes to done.
+func (s *Supervisor) build(g *core.StateGraph[TeamState], team string, maxTurns int, done string) {
+	g.AddNode(supervisorNode, s.decide(team, maxTurns))
+	g.SetEntryPoint(supervisorNode)
+
+	workers := make(map[string]string, len(s.workers)+1)
+	for name, worker := range s.workers {
+		g.AddNode(name, s.work(team, name, worker))
+		g.AddConditionalEdges(name, func(state TeamState) ([]string, error) {
+			return []string{supervisorNode}, nil
+		}, nil)
+		workers[name] = name
+	}
+	workers[done] = done
+
+	g.AddConditionalEdges(supervisorNode, func(state TeamState) ([]string, error) {
+		if state.Next == "" {
+			return []string{done}, nil
+		}
+		return []string{state.Next}, nil
+	}, workers)
+}
+
+// decide asks the supervisor agent who acts next
+func (s *Supervisor) decide(team string, maxTurns int) func(ctx context.Context, state TeamState) (TeamState, error) {
+	return func(ctx context.Context, state TeamState) (TeamState, error) {
+		state.Team, state.Worker = team, ""
+		work := teamWork(state, team)
+
+		if maxTurns > 0 && state.Turns[team] >= maxTurns {
+			core.LoggerFromContext(ctx).Warn("Team reached its turn limit, finishing with the last worker output",
+				"team", team,
+				"turns", state.Turns[team])
+			emitDecision(ctx, memberName(team, supervisorNode), team, "", "turn_limit")
+			return finishTask(state, team, lastContent(work)), nil
+		}
+
+		prompt := "You supervise these workers: " + strings.Join(s.Workers(), ", ") + ".\n\n" +
+			"Task:\n" + taskOf(state) + "\n\n" +
+			"Work so far:\n" + transcript(work) + "\n\n" +
+			"Reply with \"NEXT: <worker>\" to hand the task to a worker, or with " +
+			"\"FINISH: <result>\" once the task is done, giving the complete result."
+
+		reply, err := ask(ctx, s.agent, prompt)
+		if err != nil {
+			return state, fmt.Errorf("supervisor %s: %w", teamLabel(team), err)
+		}
+		verb, arg, ok := parseDecision(reply, "NEXT", "FINISH")
+		if !ok {
+			return state, fmt.Errorf("%w: %s", ErrInvalidDecision, truncate(reply, 200))
+		}
+
+		if verb == "FINISH" {
+			if arg == "" {
+				arg = lastContent(work)
+			}
+			emitDecision(ctx, memberName(team, supervisorNode), team, "", "finish")
+			return finishTask(state, team, arg), nil
+		}
+		worker := strings.Trim(arg, " \t\"'`*")
+		if _, ok := s.workers[worker]; !ok {
+			return state, fmt.Errorf("%w: unknown worker %q", ErrInvalidDecision, worker)
+		}
+		state.Next = worker
+		emitDecision(ctx, memberName(team, supervisorNode), team, worker, "next")
+		return state, nil
+	}
+}
+
+// work runs a worker on the task
+func (s *Supervisor) work(team, name string, worker agent.Agent) func(ctx context.Context, state TeamState) (TeamState, error) {
+	member := memberName(team, name)
+	return func(ctx context.Context, state TeamState) (TeamState, error) {
+		state.Team, state.Worker = team, name
+		state.Turns = increment(state.Turns, team)
+
+		core.EmitEvent(ctx, core.Event{
+			Type:      EventTeamStep,
+			Name:      member,
+			RunID:     core.RunIDFromContext(ctx),
+			Timestamp: time.Now(),
+			Metadata: map[string]interface{}{
+				"team":   team,
+				"worker": name,
+				"turn":   state.Turns[team],
+			},
+		})
+
+		prompt := "Task:\n" + taskOf(state) + "\n\n" +
+			"Work so far:\n" + transcript(teamWork(state, team)) + "\n\n" +
+			"Do your part of the task."
+		reply, err := ask(ctx, worker, prompt)
+		if err != nil {
+			return state, fmt.Errorf("worker %s: %w", member, err)
+		}
+
+		state.Messages = append(state.Messages[:len(state.Messages):len(state.Messages)], core.Message{
+			Role:    core.RoleAssistant,
+			Name:    member,
+			Content: reply,
+		})
+		state.Next = ""
+		return state, nil
+	}
+}
+
+// finishTask hands the result of a task up: to Results for a team, or to
+// Answer for a supervisor run on its own
+func finishTask(state TeamState, team, result string) TeamState {
+	state.Next = ""
+	if team == "" {
+		state.Answer = result
+		return state
+	}
+	results := make(map[string]string, len(state.Results)+1)
+	for k, v := range state.Results {
+		results[k] = v
+	}
+	results[team] = result
+	state.Results = results
+	return state
+}
+
+// ask sends a prompt to an agent and returns its last reply
+func ask(ctx context.Context, a agent.Agent, prompt string) (string, error) {
+	responses, err := a.ProcessMessage(ctx, core.Message{
+		Role:    core.RoleUser,
+		Content: prompt,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(responses) == 0 {
+		return "", fmt.Errorf("%w: empty response", ErrInvalidDecision)
+	}
+	return responses[len(responses)-1].Content, nil
+}
+
+// parseDecision finds the first line of a reply starting with one of the
+// verbs, and returns the verb and the rest of the reply after it
+func parseDecision(reply string, verbs ...string) (string, string, bool) {
+	lines := strings.Split(reply, "\n")
+	for i, line := range lines {
+		line = strings.TrimLeft(strings.TrimSpace(line), "*# ")
+		for _, verb := range verbs {
+			if len(line) < len(verb) || !strings.EqualFold(line[:len(verb)], verb) {
+				continue
+			}
+			rest := strings.TrimPrefix(strings.TrimLeft(line[len(verb):], "* "), ":")
+			rest = strings.Join(append([]string{rest}, lines[i+1:]...), "\n")
+			return verb, strings.TrimSpace(rest), true
+		}
+	}
+	return "", "", false
+}
+
+// teamWork returns the worker outputs of a team
+func teamWork(state TeamState, team string) []core.Message {
+	var work []core.Message
+	for _, msg := range state.Messages {
+		if msg.Name != "" && nodeTeam(msg.Name) == team {
+			work = append(work, msg)
+		}
+	}
+	return work
+}
+
+// transcript renders worker outputs for a prompt
+func transcript(work []core.Message) string {
+	if len(work) == 0 {
+		return "(none yet)"
+	}
+	var b strings.Builder
+	for _, msg := range work {
+		fmt.Fprintf(&b, "[%s]\n%s\n\n", msg.Name, msg.Content)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// lastContent returns the last worker output
+func lastContent(work []core.Message) string {
+	if len(work) == 0 {
+		return ""
+	}
+	return work[len(work)-1].Content
+}
+
+// taskOf returns the task of the team at work
+func taskOf(state TeamState) string {
+	if state.Task != "" {
+		return state.Task
+	}
+	return state.Request
+}
+
+// memberName names a worker within its team
+func memberName(team, worker string) string {
+	if team == "" {
+		return worker
+	}
+	return team + core.GroupSeparator + worker
+}
+
+// nodeTeam returns the team of a member name
+func nodeTeam(member string) string {
+	if i := strings.LastIndex(member, core.GroupSeparator); i >= 0 {
+		return member[:i]
+	}
+	return ""
+}
+
+// teamLabel names a team in errors
+func teamLabel(team string) string {
+	if team == "" {
+		return "(top)"
+	}
+	return team
+}
+
+// increment returns a copy of counts with key incremented
+func increment(counts map[string]int, key string) map[string]int {
+	out := make(map[string]int, len(counts)+1)
+	for k, v := range counts {
+		out[k] = v
+	}
+	out[key]++
+	return out
+}
+
+// truncate cuts s to at most n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
+
+// emitDecision emits an EventTeamDecision from the named node
+func emitDecision(ctx context.Context, node, team, next, reason string) {
+	core.EmitEvent(ctx, core.Event{
+		Type:      EventTeamDecision,
+		Name:      node,
+		RunID:     core.RunIDFromContext(ctx),
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"team":   team,
+			"next":   next,
+			"reason": reason,
+		},
+	})
+}
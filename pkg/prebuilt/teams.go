@@ -0,0 +1,162 @@
+package prebuilt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// DefaultMaxDelegations bounds the tasks a hierarchy hands to its teams
+// when HierarchicalOptions sets no limit
+const DefaultMaxDelegations = 10
+
+// leadNode is the node the top supervisor of a hierarchy decides in
+const leadNode = "lead"
+
+// HierarchicalOptions configures a team hierarchy
+type HierarchicalOptions struct {
+	// MaxDelegations bounds the tasks handed to teams. When the limit is
+	// reached the run finishes with the results collected so far. Zero
+	// means DefaultMaxDelegations.
+	MaxDelegations int
+
+	// TeamTurns overrides the per-task turn limits of team supervisors
+	TeamTurns map[string]int
+}
+
+// NewHierarchicalTeams builds a supervisor of supervisors: the top agent
+// hands tasks to teams, and each team's supervisor routes its task between
+// its workers. Every team is mounted as a group, so its nodes are named
+// team.supervisor and team.worker.
+//
+// The request goes in Request. The top agent replies "DELEGATE <team>:
+// <task>" to pass a task down in Task, and the team's result comes back
+// up in Results[team]. The top agent replies "FINISH: <answer>" to end the
+// run with Answer. Worker outputs are kept in Messages, named team.worker,
+// and EventTeamStep and EventTeamDecision events carry the team and worker
+// of every step.
+func NewHierarchicalTeams(top agent.Agent, teams map[string]*Supervisor, opts HierarchicalOptions) (*core.StateGraph[TeamState], error) {
+	if len(teams) == 0 {
+		return nil, fmt.Errorf("%w: hierarchy has no teams", ErrInvalidTeam)
+	}
+	names := make([]string, 0, len(teams))
+	for name, team := range teams {
+		if name == "" || name == leadNode || name == core.END || strings.Contains(name, core.GroupSeparator) {
+			return nil, fmt.Errorf("%w: invalid team name %q", ErrInvalidTeam, name)
+		}
+		if err := team.validate(); err != nil {
+			return nil, fmt.Errorf("team %s: %w", name, err)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	maxDelegations := opts.MaxDelegations
+	if maxDelegations <= 0 {
+		maxDelegations = DefaultMaxDelegations
+	}
+
+	g := core.NewStateGraph[TeamState]()
+	g.AddNode(leadNode, lead(top, teams, names, maxDelegations))
+	g.SetEntryPoint(leadNode)
+
+	entries := make(map[string]string, len(teams)+1)
+	for _, name := range names {
+		team := teams[name]
+		maxTurns := team.maxTurns
+		if turns, ok := opts.TeamTurns[name]; ok {
+			maxTurns = turns
+		}
+		g.Group(name, func(sub *core.StateGraph[TeamState]) {
+			team.build(sub, name, maxTurns, leadNode)
+		})
+		entries[name] = name + core.GroupSeparator + supervisorNode
+	}
+	entries[core.END] = core.END
+
+	g.AddConditionalEdges(leadNode, func(state TeamState) ([]string, error) {
+		if state.Next == "" {
+			return []string{core.END}, nil
+		}
+		return []string{state.Next}, nil
+	}, entries)
+
+	return g, nil
+}
+
+// lead asks the top agent which team gets the next task
+func lead(top agent.Agent, teams map[string]*Supervisor, names []string, maxDelegations int) func(ctx context.Context, state TeamState) (TeamState, error) {
+	return func(ctx context.Context, state TeamState) (TeamState, error) {
+		state.Team, state.Worker = "", ""
+
+		if state.Delegations >= maxDelegations {
+			core.LoggerFromContext(ctx).Warn("Hierarchy reached its delegation limit, finishing with the team results",
+				"delegations", state.Delegations)
+			emitDecision(ctx, leadNode, "", "", "delegation_limit")
+			state.Next = ""
+			state.Answer = resultsText(state.Results, names)
+			return state, nil
+		}
+
+		var roster strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&roster, "- %s: workers %s\n", name, strings.Join(teams[name].Workers(), ", "))
+		}
+		prompt := "You lead these teams:\n" + roster.String() + "\n" +
+			"Request:\n" + state.Request + "\n\n" +
+			"Team results so far:\n" + resultsText(state.Results, names) + "\n\n" +
+			"Reply with \"DELEGATE <team>: <task>\" to hand a task to a team, describing the task " +
+			"completely, or with \"FINISH: <answer>\" once the request is done, giving the complete answer."
+
+		reply, err := ask(ctx, top, prompt)
+		if err != nil {
+			return state, fmt.Errorf("lead agent: %w", err)
+		}
+		verb, arg, ok := parseDecision(reply, "DELEGATE", "FINISH")
+		if !ok {
+			return state, fmt.Errorf("%w: %s", ErrInvalidDecision, truncate(reply, 200))
+		}
+
+		if verb == "FINISH" {
+			emitDecision(ctx, leadNode, "", "", "finish")
+			state.Next = ""
+			state.Answer = arg
+			return state, nil
+		}
+		team, task, _ := strings.Cut(arg, ":")
+		team = strings.Trim(team, " \t\"'`*")
+		if _, ok := teams[team]; !ok {
+			return state, fmt.Errorf("%w: unknown team %q", ErrInvalidDecision, team)
+		}
+
+		state.Next = team
+		state.Task = strings.TrimSpace(task)
+		state.Delegations++
+		turns := make(map[string]int, len(state.Turns))
+		for k, v := range state.Turns {
+			turns[k] = v
+		}
+		turns[team] = 0
+		state.Turns = turns
+		emitDecision(ctx, leadNode, "", team, "delegate")
+		return state, nil
+	}
+}
+
+// resultsText renders team results for a prompt or a fallback answer
+func resultsText(results map[string]string, names []string) string {
+	var b strings.Builder
+	for _, name := range names {
+		if result, ok := results[name]; ok {
+			fmt.Fprintf(&b, "[%s]\n%s\n\n", name, result)
+		}
+	}
+	if b.Len() == 0 {
+		return "(none yet)"
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,284 @@
+package prebuilt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrNoAudioSource is returned when the state does not provide an audio source
+	ErrNoAudioSource = errors.New("no audio source")
+)
+
+// EventAudioOverrun is emitted when the audio queue is full and reading from
+// the source has to wait for the transcriber to catch up
+const EventAudioOverrun core.EventType = "on_audio_overrun"
+
+// AudioSource provides a stream of audio chunks
+type AudioSource interface {
+	// ReadChunk returns the next chunk of audio, or io.EOF when the stream ends
+	ReadChunk(ctx context.Context) ([]byte, error)
+}
+
+// Segment is a piece of transcript
+type Segment struct {
+	// Text is the transcribed text
+	Text string `json:"text"`
+
+	// Start is the offset of the segment from the beginning of the audio
+	Start time.Duration `json:"start"`
+
+	// End is the offset of the end of the segment
+	End time.Duration `json:"end"`
+
+	// Final is true when the segment is complete and will not change
+	Final bool `json:"final"`
+}
+
+// Transcriber converts a stream of audio chunks into transcript segments.
+// Partial segments may be sent repeatedly for the same utterance, and a
+// final segment is sent when voice activity detection finds a boundary.
+// The returned channel must be closed once the audio channel is closed
+// and all audio has been transcribed.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio <-chan []byte) (<-chan Segment, error)
+}
+
+// TranscriptionConfig contains configuration for a transcription node
+type TranscriptionConfig struct {
+	// QueueSize is the number of audio chunks buffered for the transcriber
+	QueueSize int
+
+	// SilenceTimeout commits the pending partial segment when no new
+	// transcript arrives for this long. Later segments of the committed
+	// utterance, its final segment included, are dropped. Zero disables
+	// the timeout.
+	SilenceTimeout time.Duration
+}
+
+// TranscriptionOption configures a transcription node
+type TranscriptionOption func(*TranscriptionConfig)
+
+// WithQueueSize sets the number of audio chunks buffered for the transcriber
+func WithQueueSize(size int) TranscriptionOption {
+	return func(c *TranscriptionConfig) {
+		c.QueueSize = size
+	}
+}
+
+// WithSilenceTimeout sets how long the speaker may be silent before the
+// pending partial segment is committed
+func WithSilenceTimeout(timeout time.Duration) TranscriptionOption {
+	return func(c *TranscriptionConfig) {
+		c.SilenceTimeout = timeout
+	}
+}
+
+// TranscriptionNode returns a node function that streams audio from the state
+// through the transcriber. Partial segments are emitted on the custom stream
+// as they arrive, and finalized segments are committed to the state with
+// appendSegment and emitted on the custom stream as well.
+//
+// Audio is never dropped. When the transcriber falls behind the queue fills
+// up, an EventAudioOverrun event is emitted, and reading from the source
+// pauses until there is room again.
+func TranscriptionNode[T any](
+	transcriber Transcriber,
+	getAudio func(T) AudioSource,
+	appendSegment func(T, Segment) T,
+	opts ...TranscriptionOption,
+) func(ctx context.Context, state T) (T, error) {
+	config := TranscriptionConfig{
+		QueueSize:      64,
+		SilenceTimeout: 2 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	node := func(ctx context.Context, state T) (T, error) {
+		source := getAudio(state)
+		if source == nil {
+			return state, ErrNoAudioSource
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		queue := make(chan []byte, config.QueueSize)
+		segments, err := transcriber.Transcribe(ctx, queue)
+		if err != nil {
+			return state, fmt.Errorf("failed to start transcription: %w", err)
+		}
+
+		readErr := make(chan error, 1)
+		go func() {
+			readErr <- pumpAudio(ctx, source, queue)
+		}()
+
+		var silence <-chan time.Time
+		var timer *time.Timer
+		if config.SilenceTimeout > 0 {
+			timer = time.NewTimer(config.SilenceTimeout)
+			defer timer.Stop()
+			silence = timer.C
+		}
+
+		var pending *Segment
+
+		// committed is the utterance committed after silence, whose later
+		// segments the transcriber may still send
+		var committed *Segment
+		commit := func(seg Segment) {
+			seg.Final = true
+			state = appendSegment(state, seg)
+			core.EmitCustom(ctx, seg)
+			pending = nil
+		}
+
+		for {
+			select {
+			case seg, ok := <-segments:
+				if !ok {
+					if pending != nil {
+						commit(*pending)
+					}
+					cancel()
+					if err := <-readErr; err != nil && !errors.Is(err, context.Canceled) {
+						return state, fmt.Errorf("failed to read audio: %w", err)
+					}
+					return state, nil
+				}
+
+				if committed != nil && seg.Start == committed.Start {
+					// The utterance is in the state already, and ends with
+					// its final segment
+					if seg.Final {
+						committed = nil
+					}
+					continue
+				}
+				committed = nil
+
+				if seg.Final {
+					commit(seg)
+					continue
+				}
+
+				pending = &seg
+				core.EmitCustom(ctx, seg)
+				if timer != nil {
+					timer.Reset(config.SilenceTimeout)
+				}
+
+			case <-silence:
+				if pending != nil {
+					seg := *pending
+					commit(seg)
+					committed = &seg
+				}
+				timer.Reset(config.SilenceTimeout)
+
+			case <-ctx.Done():
+				return state, ctx.Err()
+			}
+		}
+	}
+	core.DescribeNodeFunc(node, "Transcribes streamed audio into segments")
+	return node
+}
+
+// pumpAudio copies chunks from the source into the queue until the source
+// ends, closing the queue when done
+func pumpAudio(ctx context.Context, source AudioSource, queue chan<- []byte) error {
+	defer close(queue)
+
+	for {
+		chunk, err := source.ReadChunk(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case queue <- chunk:
+			continue
+		default:
+		}
+
+		// The queue is full, report the overrun and wait for room
+		core.EmitEvent(ctx, core.Event{
+			Type:      EventAudioOverrun,
+			Name:      "transcription",
+			Timestamp: time.Now(),
+			Metadata: map[string]interface{}{
+				"queue_size": cap(queue),
+			},
+		})
+
+		select {
+		case queue <- chunk:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// readerAudioSource reads fixed size chunks from an io.Reader
+type readerAudioSource struct {
+	r         io.Reader
+	chunkSize int
+}
+
+// NewReaderAudioSource creates an audio source that reads chunks of up to
+// chunkSize bytes from r, such as an audio file
+func NewReaderAudioSource(r io.Reader, chunkSize int) AudioSource {
+	return &readerAudioSource{r: r, chunkSize: chunkSize}
+}
+
+func (s *readerAudioSource) ReadChunk(ctx context.Context) ([]byte, error) {
+	buf := make([]byte, s.chunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := s.r.Read(buf)
+		if n > 0 {
+			return buf[:n], nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// channelAudioSource reads chunks from a channel
+type channelAudioSource struct {
+	ch <-chan []byte
+}
+
+// NewChannelAudioSource creates an audio source that reads chunks from ch,
+// such as audio forwarded from a realtime session. The source ends when ch
+// is closed.
+func NewChannelAudioSource(ch <-chan []byte) AudioSource {
+	return &channelAudioSource{ch: ch}
+}
+
+func (s *channelAudioSource) ReadChunk(ctx context.Context) ([]byte, error) {
+	select {
+	case chunk, ok := <-s.ch:
+		if !ok {
+			return nil, io.EOF
+		}
+		return chunk, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,66 @@
+package prebuilt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/prebuilt"
+)
+
+// scriptedTranscriber sends its segments, pausing before those with a delay,
+// regardless of the audio
+type scriptedTranscriber struct {
+	segments []scriptedSegment
+}
+
+type scriptedSegment struct {
+	delay time.Duration
+	seg   prebuilt.Segment
+}
+
+func (s *scriptedTranscriber) Transcribe(ctx context.Context, audio <-chan []byte) (<-chan prebuilt.Segment, error) {
+	out := make(chan prebuilt.Segment)
+	go func() {
+		defer close(out)
+		for _, scripted := range s.segments {
+			time.Sleep(scripted.delay)
+			out <- scripted.seg
+		}
+		for range audio {
+		}
+	}()
+	return out, nil
+}
+
+func TestTranscriptionSilenceCommitsUtteranceOnce(t *testing.T) {
+	transcriber := &scriptedTranscriber{segments: []scriptedSegment{
+		{seg: prebuilt.Segment{Text: "hel", Start: 0}},
+		// The speaker pauses past the silence timeout
+		{delay: 60 * time.Millisecond, seg: prebuilt.Segment{Text: "hello", Start: 0, Final: true}},
+		{seg: prebuilt.Segment{Text: "bye", Start: time.Second}},
+		{seg: prebuilt.Segment{Text: "bye now", Start: time.Second, Final: true}},
+	}}
+	audio := make(chan []byte)
+	close(audio)
+
+	node := prebuilt.TranscriptionNode(transcriber,
+		func([]prebuilt.Segment) prebuilt.AudioSource { return prebuilt.NewChannelAudioSource(audio) },
+		func(s []prebuilt.Segment, seg prebuilt.Segment) []prebuilt.Segment { return append(s, seg) },
+		prebuilt.WithSilenceTimeout(20*time.Millisecond))
+
+	transcript, err := node(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("node: %v", err)
+	}
+	var texts []string
+	for _, seg := range transcript {
+		if !seg.Final {
+			t.Errorf("segment %q committed without Final", seg.Text)
+		}
+		texts = append(texts, seg.Text)
+	}
+	if len(texts) != 2 || texts[0] != "hel" || texts[1] != "bye now" {
+		t.Errorf("transcript = %q, want the first utterance once and the second", texts)
+	}
+}
@@ -0,0 +1,145 @@
+package prebuilt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+var (
+	// ErrEventTimeout is returned by a wait node whose event didn't arrive
+	// in time and that has no expiry configured
+	ErrEventTimeout = errors.New("timed out waiting for event")
+)
+
+// EventWaitConfig configures a node that waits for an external event
+type EventWaitConfig[T any] struct {
+	// Merge folds the delivered event into the state. Nil leaves the state
+	// unchanged.
+	Merge func(T, core.ExternalEvent) (T, error)
+
+	// Expire marks the state of a run whose wait timed out, so that a router
+	// such as ExpiryRouter sends it to an expiry node. Nil fails the node
+	// with ErrEventTimeout instead.
+	Expire func(T) T
+}
+
+// EventWaitOption configures a node that waits for an external event
+type EventWaitOption[T any] func(*EventWaitConfig[T])
+
+// WithEventMerge sets how a delivered event is merged into the state
+func WithEventMerge[T any](merge func(T, core.ExternalEvent) (T, error)) EventWaitOption[T] {
+	return func(c *EventWaitConfig[T]) {
+		c.Merge = merge
+	}
+}
+
+// WithEventExpiry sets how the state of a timed out wait is marked
+func WithEventExpiry[T any](expire func(T) T) EventWaitOption[T] {
+	return func(c *EventWaitConfig[T]) {
+		c.Expire = expire
+	}
+}
+
+// WaitForEvent returns a node that suspends the run until an external event
+// with the name is delivered for the run's thread (see core.WithThreadID)
+// through the event bus in the run context, and match accepts it. The
+// event is then merged into the state and the run continues. A zero timeout
+// waits as long as the run context allows.
+//
+// Runs of graphs with a thread store are suspended with a core.SuspendError
+// and their thread is saved with the wait, so the wait survives a restart
+// of the process. Resuming the thread runs the node again, which takes the
+// event held for it on the event bus (see core.EventBus.Hold), expires the
+// wait once its deadline passed, or suspends the run again. Other runs wait
+// in memory and are abandoned by a restart.
+func WaitForEvent[T any](eventName string, match func(T, core.ExternalEvent) bool, timeout time.Duration, opts ...EventWaitOption[T]) func(ctx context.Context, state T) (T, error) {
+	var config EventWaitConfig[T]
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	node := func(ctx context.Context, state T) (T, error) {
+		bus := core.EventBusFromContext(ctx)
+		if bus == nil {
+			return state, core.ErrNoEventBus
+		}
+		threadID := core.ThreadIDFromContext(ctx)
+		logger := core.LoggerFromContext(ctx)
+
+		var accept func(core.ExternalEvent) bool
+		if match != nil {
+			accept = func(evt core.ExternalEvent) bool {
+				return match(state, evt)
+			}
+		}
+
+		// A resumed wait keeps the deadline it was suspended with
+		var deadline time.Time
+		if wait, ok := core.ResumedWait(ctx); ok && wait.Event == eventName {
+			deadline = wait.Deadline
+		} else if timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+		expire := func() (T, error) {
+			logger.Info("Wait for event expired", "event", eventName, "thread_id", threadID)
+			if config.Expire != nil {
+				return config.Expire(state), nil
+			}
+			return state, fmt.Errorf("%w: %s after %s", ErrEventTimeout, eventName, timeout)
+		}
+
+		var evt core.ExternalEvent
+		if core.CanSuspend(ctx) {
+			held, ok := bus.Take(threadID, eventName, accept)
+			if !ok {
+				if !deadline.IsZero() && !time.Now().Before(deadline) {
+					return expire()
+				}
+				logger.Info("Suspending until event", "event", eventName, "thread_id", threadID)
+				return state, &core.SuspendError{Wait: core.EventWait{Event: eventName, Deadline: deadline}}
+			}
+			evt = held
+		} else {
+			waitCtx := ctx
+			if !deadline.IsZero() {
+				var cancel context.CancelFunc
+				waitCtx, cancel = context.WithDeadline(ctx, deadline)
+				defer cancel()
+			}
+
+			logger.Info("Waiting for event", "event", eventName, "thread_id", threadID)
+			var err error
+			evt, err = bus.Wait(waitCtx, threadID, eventName, accept)
+			if err != nil {
+				// Only the wait's own timeout expires it, not the run ending
+				if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+					return expire()
+				}
+				return state, err
+			}
+		}
+
+		logger.Info("Event received", "event", eventName, "thread_id", threadID, "id", evt.ID)
+		if config.Merge == nil {
+			return state, nil
+		}
+		return config.Merge(state, evt)
+	}
+	core.DescribeNodeFunc(node, "Waits for an external event before the run continues")
+	return node
+}
+
+// ExpiryRouter routes to expiryNode when expired reports that the state was
+// marked by a wait's Expire function, and to next otherwise
+func ExpiryRouter[T any](expired func(T) bool, next, expiryNode string) core.Router[T] {
+	return func(state T) ([]string, error) {
+		if expired(state) {
+			return []string{expiryNode}, nil
+		}
+		return []string{next}, nil
+	}
+}
@@ -0,0 +1,107 @@
+package prebuilt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/prebuilt"
+)
+
+type order struct {
+	Status string `json:"status"`
+	Note   string `json:"note,omitempty"`
+}
+
+// approvalGraph waits for an "approved" event before shipping the order
+func approvalGraph(store *core.ThreadStore, timeout time.Duration) *core.RunnableState[order] {
+	g := core.NewStateGraph[order]()
+	g.SetStreamConfig(core.StreamConfig{})
+	g.SetThreadStore(store)
+	g.AddNode("approve", prebuilt.WaitForEvent("approved", nil, timeout,
+		prebuilt.WithEventMerge(func(s order, evt core.ExternalEvent) (order, error) {
+			s.Note = string(evt.Payload)
+			return s, nil
+		})))
+	g.AddNode("ship", func(ctx context.Context, s order) (order, error) {
+		s.Status = "shipped"
+		return s, nil
+	})
+	g.SetEntryPoint("approve")
+	g.AddConditionalEdges("approve", func(order) ([]string, error) { return []string{"ship"}, nil }, nil)
+	g.AddConditionalEdges("ship", func(order) ([]string, error) { return []string{core.END}, nil }, nil)
+	r, err := g.Compile()
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func TestWaitForEventSuspendsWithTheThread(t *testing.T) {
+	store := core.NewThreadStore(nil)
+	bus := core.NewEventBus()
+	ctx := core.WithEventBus(core.WithThreadID(context.Background(), "t1"), bus)
+
+	_, err := approvalGraph(store, time.Hour).Invoke(ctx, order{Status: "new"})
+	var suspended *core.SuspendError
+	if !errors.As(err, &suspended) || suspended.Wait.Event != "approved" {
+		t.Fatalf("Invoke = %v, want a run suspended until approved", err)
+	}
+	thread, err := store.LoadThread(ctx, "t1")
+	if err != nil {
+		t.Fatalf("LoadThread: %v", err)
+	}
+	if thread.Node != "approve" || thread.Wait == nil || thread.Wait.Event != "approved" {
+		t.Fatalf("thread saved at %q with wait %+v", thread.Node, thread.Wait)
+	}
+
+	// A new process resumes the thread with the delivered event
+	bus = core.NewEventBus()
+	bus.Hold(core.ExternalEvent{Name: "approved", ThreadID: "t1", Payload: []byte("ok")})
+	ctx = core.WithEventBus(context.Background(), bus)
+	out, err := approvalGraph(store, time.Hour).ResumeThread(ctx, "t1")
+	if err != nil {
+		t.Fatalf("ResumeThread: %v", err)
+	}
+	if out.Status != "shipped" || out.Note != "ok" {
+		t.Errorf("resumed run ended with %+v", out)
+	}
+	if err := bus.Deliver(ctx, core.ExternalEvent{Name: "approved", ThreadID: "t1"}); err != nil {
+		t.Errorf("late duplicate = %v, want it ignored", err)
+	}
+}
+
+func TestWaitForEventExpiresWhenResumedLate(t *testing.T) {
+	store := core.NewThreadStore(nil)
+	ctx := core.WithEventBus(core.WithThreadID(context.Background(), "t1"), core.NewEventBus())
+	r := approvalGraph(store, 10*time.Millisecond)
+
+	if _, err := r.Invoke(ctx, order{Status: "new"}); !errors.Is(err, core.ErrSuspended) {
+		t.Fatalf("Invoke = %v, want ErrSuspended", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := r.ResumeThread(ctx, "t1"); !errors.Is(err, prebuilt.ErrEventTimeout) {
+		t.Fatalf("ResumeThread after the deadline = %v, want ErrEventTimeout", err)
+	}
+}
+
+func TestWaitForEventWaitsInMemoryWithoutThreadStore(t *testing.T) {
+	bus := core.NewEventBus()
+	ctx := core.WithEventBus(core.WithThreadID(context.Background(), "t1"), bus)
+	go func() {
+		for !bus.Waiting("t1", "approved") {
+			time.Sleep(time.Millisecond)
+		}
+		bus.Deliver(ctx, core.ExternalEvent{Name: "approved", ThreadID: "t1", Payload: []byte("ok")})
+	}()
+
+	out, err := approvalGraph(nil, time.Minute).Invoke(ctx, order{Status: "new"})
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if out.Status != "shipped" || out.Note != "ok" {
+		t.Errorf("run ended with %+v", out)
+	}
+}
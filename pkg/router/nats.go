@@ -0,0 +1,408 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+// NATSRouter is a Router that delivers messages over NATS, so agents
+// registered in one process can be reached from any other connected to the
+// same NATS server. Every agent ID is a subject under the router's prefix,
+// subscribed in a queue group, so each message is handled by one of the
+// processes that registered the agent, which handles its messages one at a
+// time. Topics are subjects as well, and every subscriber of a topic gets
+// each message published to it.
+//
+// Messages and replies are sent as wire frames. A message routed without
+// waiting is lost when no process has registered the agent.
+type NATSRouter struct {
+	nc      *nats.Conn
+	logger  core.Logger
+	prefix  string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	agents map[string]*nats.Subscription
+	topics map[*nats.Subscription]struct{}
+	closed bool
+
+	// handling counts the messages being handled, which Close waits for
+	handling sync.WaitGroup
+}
+
+// NATSOption configures a NATS router
+type NATSOption func(*NATSRouter)
+
+// WithSubjectPrefix sets the prefix of the subjects of agents and topics.
+// Routers sharing a NATS server only reach each other with the same prefix.
+// The default is "moego".
+func WithSubjectPrefix(prefix string) NATSOption {
+	return func(r *NATSRouter) {
+		r.prefix = prefix
+	}
+}
+
+// WithRequestTimeout bounds RouteAndWait when its context has no deadline.
+// Zero waits as long as the context allows. The default is 30 seconds.
+func WithRequestTimeout(timeout time.Duration) NATSOption {
+	return func(r *NATSRouter) {
+		r.timeout = timeout
+	}
+}
+
+// NewNATSRouter creates a router delivering messages over the NATS
+// connection. The connection stays open when the router is closed. A nil
+// logger discards everything.
+func NewNATSRouter(nc *nats.Conn, logger core.Logger, opts ...NATSOption) *NATSRouter {
+	if logger == nil {
+		logger = core.NopLogger()
+	}
+	r := &NATSRouter{
+		nc:      nc,
+		logger:  logger,
+		prefix:  "moego",
+		timeout: 30 * time.Second,
+		agents:  make(map[string]*nats.Subscription),
+		topics:  make(map[*nats.Subscription]struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// RegisterAgent subscribes the agent to its subject. The agent is reachable
+// from every connected process once it returns.
+func (r *NATSRouter) RegisterAgent(a agent.Agent) error {
+	id := a.ID()
+	subject, err := r.subject("agents", id)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrRouterClosed
+	}
+	if _, exists := r.agents[id]; exists {
+		return fmt.Errorf("%w: %s", ErrAgentExists, id)
+	}
+	// NATS calls a subscription's handler with one message at a time, so
+	// the agent, whose history isn't safe for concurrent use, processes its
+	// messages in turn. Messages piling up beyond the subscription's pending
+	// limits are dropped by the client as a slow consumer.
+	sub, err := r.nc.QueueSubscribe(subject, subject, func(m *nats.Msg) {
+		if r.track() {
+			r.handleAgent(a, m)
+		}
+	})
+	if err == nil {
+		// Make sure the server knows the subscription before returning
+		if err = r.nc.Flush(); err != nil {
+			sub.Unsubscribe()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to subscribe agent %s: %w", id, err)
+	}
+	r.agents[id] = sub
+	r.logger.Debug("Agent registered", "agent", id, "subject", subject)
+	return nil
+}
+
+// Route publishes the message to the agent's subject
+func (r *NATSRouter) Route(ctx context.Context, to string, msg core.Message) error {
+	out, err := r.message(ctx, "agents", to, msg)
+	if err != nil {
+		return err
+	}
+	return r.publish(out)
+}
+
+// RouteAndWait sends the message to the agent's subject as a NATS request
+// and decodes the reply. It fails with ErrNoResponders when no process has
+// registered the agent.
+func (r *NATSRouter) RouteAndWait(ctx context.Context, to string, msg core.Message) ([]core.Message, error) {
+	if _, ok := ctx.Deadline(); !ok && r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	out, err := r.message(ctx, "agents", to, msg)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := r.nc.RequestMsgWithContext(ctx, out)
+	switch {
+	case errors.Is(err, nats.ErrNoResponders):
+		return nil, fmt.Errorf("%w: %s", ErrNoResponders, to)
+	case errors.Is(err, nats.ErrMaxPayload):
+		return nil, fmt.Errorf("%w: %v", ErrMessageTooLarge, err)
+	case err != nil:
+		return nil, fmt.Errorf("request to agent %s failed: %w", to, err)
+	}
+
+	frame, err := wire.Unmarshal(reply.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: reply of agent %s: %v", ErrInvalidMessage, to, err)
+	}
+	if frame.Kind == wire.KindError {
+		payload, err := frame.Error()
+		if err != nil {
+			return nil, fmt.Errorf("%w: reply of agent %s: %v", ErrInvalidMessage, to, err)
+		}
+		return nil, fmt.Errorf("agent %s failed: %w", to, payload.Err())
+	}
+	if frame.Kind != wire.KindMessages {
+		return nil, fmt.Errorf("%w: reply of agent %s is a %s frame", ErrInvalidMessage, to, frame.Kind)
+	}
+	replies, err := wire.DecodePayload[[]core.Message](frame)
+	if err != nil {
+		return nil, fmt.Errorf("%w: reply of agent %s: %v", ErrInvalidMessage, to, err)
+	}
+	return replies, nil
+}
+
+// Publish publishes the message to the topic's subject
+func (r *NATSRouter) Publish(ctx context.Context, topic string, msg core.Message) error {
+	out, err := r.message(ctx, "topics", topic, msg)
+	if err != nil {
+		return err
+	}
+	return r.publish(out)
+}
+
+// Subscribe subscribes the handler to the topic's subject. Messages that
+// can't be decoded are logged and dropped.
+func (r *NATSRouter) Subscribe(topic string, handler Handler) (func(), error) {
+	subject, err := r.subject("topics", topic)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, ErrRouterClosed
+	}
+	sub, err := r.nc.Subscribe(subject, func(m *nats.Msg) {
+		if r.track() {
+			go r.handleTopic(topic, handler, m)
+		}
+	})
+	if err == nil {
+		if err = r.nc.Flush(); err != nil {
+			sub.Unsubscribe()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to topic %s: %w", topic, err)
+	}
+	r.topics[sub] = struct{}{}
+
+	return func() {
+		r.mu.Lock()
+		delete(r.topics, sub)
+		r.mu.Unlock()
+		sub.Unsubscribe()
+	}, nil
+}
+
+// Close unsubscribes the agents and topic subscribers of the router and
+// waits for the messages they are handling
+func (r *NATSRouter) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	subs := make([]*nats.Subscription, 0, len(r.agents)+len(r.topics))
+	for _, sub := range r.agents {
+		subs = append(subs, sub)
+	}
+	for sub := range r.topics {
+		subs = append(subs, sub)
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for _, sub := range subs {
+		if err := sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrBadSubscription) {
+			errs = append(errs, err)
+		}
+	}
+	r.handling.Wait()
+	return errors.Join(errs...)
+}
+
+// track counts a received message as being handled, unless the router is
+// closed
+func (r *NATSRouter) track() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.handling.Add(1)
+	return true
+}
+
+// handleAgent processes a message with the agent and responds to requests
+// with its replies or its error. A message carrying a thread ID in its
+// metadata is processed on that thread, so separate conversations don't
+// share the agent's history.
+func (r *NATSRouter) handleAgent(a agent.Agent, m *nats.Msg) {
+	defer r.handling.Done()
+	logger := r.logger.With("agent", a.ID())
+
+	ctx, cancel := requestContext(m)
+	defer cancel()
+
+	encoder := wire.NewEncoder(nuid.Next())
+	msg, err := decodeMessage(m.Data)
+	var replies []core.Message
+	if err == nil {
+		if threadID, _ := msg.Metadata[core.MetadataThreadID].(string); threadID != "" {
+			ctx = core.WithThreadID(ctx, threadID)
+		}
+		replies, err = a.ProcessMessage(ctx, msg)
+	}
+	if m.Reply == "" {
+		if err != nil {
+			logger.Error("Routed message failed", "error", err)
+		}
+		return
+	}
+
+	var frame wire.Frame
+	if err != nil {
+		frame, err = encoder.Error(err)
+	} else if frame, err = encoder.Frame(wire.KindMessages, replies); err != nil {
+		frame, err = encoder.Error(fmt.Errorf("%w: %v", ErrInvalidMessage, err))
+	}
+	if err != nil {
+		logger.Error("Failed to encode reply", "error", err)
+		return
+	}
+	data, err := wire.Marshal(frame)
+	if err == nil && int64(len(data)) > r.nc.MaxPayload() {
+		frame, _ = encoder.Error(fmt.Errorf("%w: reply of %d bytes", ErrMessageTooLarge, len(data)))
+		data, err = wire.Marshal(frame)
+	}
+	if err != nil {
+		logger.Error("Failed to encode reply", "error", err)
+		return
+	}
+	if err := m.Respond(data); err != nil {
+		logger.Error("Failed to send reply", "error", err)
+	}
+}
+
+// handleTopic passes a message published to a topic to the handler
+func (r *NATSRouter) handleTopic(topic string, handler Handler, m *nats.Msg) {
+	defer r.handling.Done()
+
+	msg, err := decodeMessage(m.Data)
+	if err != nil {
+		r.logger.Error("Dropped topic message", "topic", topic, "error", err)
+		return
+	}
+	ctx, cancel := requestContext(m)
+	defer cancel()
+	handler(ctx, msg)
+}
+
+// message encodes msg as a NATS message to the subject of the agent or
+// topic, carrying the deadline of ctx
+func (r *NATSRouter) message(ctx context.Context, kind, name string, msg core.Message) (*nats.Msg, error) {
+	subject, err := r.subject(kind, name)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		return nil, ErrRouterClosed
+	}
+
+	frame, err := wire.NewEncoder(nuid.Next()).Frame(wire.KindMessages, msg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	data, err := wire.Marshal(frame)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if max := r.nc.MaxPayload(); max > 0 && int64(len(data)) > max {
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d", ErrMessageTooLarge, len(data), max)
+	}
+
+	out := nats.NewMsg(subject)
+	out.Data = data
+	if deadline, ok := ctx.Deadline(); ok && r.nc.HeadersSupported() {
+		out.Header.Set(wire.DeadlineHeader, deadline.Format(time.RFC3339Nano))
+	}
+	return out, nil
+}
+
+// publish publishes a message without waiting for it to be handled
+func (r *NATSRouter) publish(m *nats.Msg) error {
+	if err := r.nc.PublishMsg(m); err != nil {
+		if errors.Is(err, nats.ErrMaxPayload) {
+			return fmt.Errorf("%w: %v", ErrMessageTooLarge, err)
+		}
+		return fmt.Errorf("failed to publish to %s: %w", m.Subject, err)
+	}
+	return nil
+}
+
+// subject returns the subject of an agent or topic, rejecting names that
+// aren't a valid part of a subject
+func (r *NATSRouter) subject(kind, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, " \t\r\n*>") {
+		return "", fmt.Errorf("invalid %s name %q", strings.TrimSuffix(kind, "s"), name)
+	}
+	return r.prefix + "." + kind + "." + name, nil
+}
+
+// decodeMessage decodes the message carried by a wire frame
+func decodeMessage(data []byte) (core.Message, error) {
+	frame, err := wire.Unmarshal(data)
+	if err != nil {
+		return core.Message{}, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if frame.Kind != wire.KindMessages {
+		return core.Message{}, fmt.Errorf("%w: %s frame", ErrInvalidMessage, frame.Kind)
+	}
+	msg, err := wire.DecodePayload[core.Message](frame)
+	if err != nil {
+		return core.Message{}, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	return msg, nil
+}
+
+// requestContext returns a context bounded by the deadline the sender sent
+// along, if any
+func requestContext(m *nats.Msg) (context.Context, context.CancelFunc) {
+	if header := m.Header.Get(wire.DeadlineHeader); header != "" {
+		if deadline, err := time.Parse(time.RFC3339Nano, header); err == nil {
+			return context.WithDeadline(context.Background(), deadline)
+		}
+	}
+	return context.WithCancel(context.Background())
+}
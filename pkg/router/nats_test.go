@@ -0,0 +1,291 @@
+package router_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/router"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+// funcAgent answers messages with a function
+type funcAgent struct {
+	id     string
+	handle func(ctx context.Context, msg core.Message) ([]core.Message, error)
+}
+
+func (a *funcAgent) ID() string                                    { return a.id }
+func (a *funcAgent) Configure(config map[string]interface{}) error { return nil }
+func (a *funcAgent) AddTool(tool core.Tool)                        {}
+
+func (a *funcAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	return a.handle(ctx, msg)
+}
+
+// echoAgent replies with the content of every message, upper-cased
+func echoAgent(id string) *funcAgent {
+	return &funcAgent{id: id, handle: func(ctx context.Context, msg core.Message) ([]core.Message, error) {
+		return []core.Message{{Role: core.RoleAssistant, Name: id, Content: strings.ToUpper(msg.Content)}}, nil
+	}}
+}
+
+// newRouter creates a router on the connection, closed when the test ends
+func newRouter(t *testing.T, s *natsServer) *router.NATSRouter {
+	t.Helper()
+	r := router.NewNATSRouter(s.connect(t), nil, router.WithRequestTimeout(5*time.Second))
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestNATSRouterRouteAndWaitAcrossProcesses(t *testing.T) {
+	s := startNATS(t, 1<<20)
+	host, caller := newRouter(t, s), newRouter(t, s)
+	if err := host.RegisterAgent(echoAgent("shouter")); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	replies, err := caller.RouteAndWait(context.Background(), "shouter", core.Message{Role: core.RoleUser, Content: "hello"})
+	if err != nil {
+		t.Fatalf("RouteAndWait: %v", err)
+	}
+	if len(replies) != 1 || replies[0].Content != "HELLO" || replies[0].Name != "shouter" {
+		t.Errorf("replies = %+v, want HELLO from shouter", replies)
+	}
+}
+
+func TestNATSRouterKeepsAgentErrors(t *testing.T) {
+	s := startNATS(t, 1<<20)
+	host, caller := newRouter(t, s), newRouter(t, s)
+	host.RegisterAgent(&funcAgent{id: "flaky", handle: func(ctx context.Context, msg core.Message) ([]core.Message, error) {
+		return nil, fmt.Errorf("model unavailable: %w", core.ErrCircuitOpen)
+	}})
+
+	_, err := caller.RouteAndWait(context.Background(), "flaky", core.Message{Content: "hi"})
+	if !errors.Is(err, core.ErrCircuitOpen) {
+		t.Errorf("RouteAndWait error = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestNATSRouterNoResponders(t *testing.T) {
+	s := startNATS(t, 1<<20)
+	caller := newRouter(t, s)
+
+	_, err := caller.RouteAndWait(context.Background(), "nobody", core.Message{Content: "hi"})
+	if !errors.Is(err, router.ErrNoResponders) {
+		t.Errorf("RouteAndWait error = %v, want ErrNoResponders", err)
+	}
+}
+
+func TestNATSRouterMessageTooLarge(t *testing.T) {
+	s := startNATS(t, 512)
+	host, caller := newRouter(t, s), newRouter(t, s)
+	host.RegisterAgent(echoAgent("shouter"))
+	big := core.Message{Content: strings.Repeat("x", 1024)}
+
+	if err := caller.Route(context.Background(), "shouter", big); !errors.Is(err, router.ErrMessageTooLarge) {
+		t.Errorf("Route error = %v, want ErrMessageTooLarge", err)
+	}
+	if _, err := caller.RouteAndWait(context.Background(), "shouter", big); !errors.Is(err, router.ErrMessageTooLarge) {
+		t.Errorf("RouteAndWait error = %v, want ErrMessageTooLarge", err)
+	}
+
+	// The request fits but the agent's reply doesn't
+	host.RegisterAgent(&funcAgent{id: "verbose", handle: func(ctx context.Context, msg core.Message) ([]core.Message, error) {
+		return []core.Message{{Content: strings.Repeat("y", 1024)}}, nil
+	}})
+	if _, err := caller.RouteAndWait(context.Background(), "verbose", core.Message{Content: "hi"}); !errors.Is(err, router.ErrMessageTooLarge) {
+		t.Errorf("RouteAndWait with a large reply error = %v, want ErrMessageTooLarge", err)
+	}
+}
+
+func TestNATSRouterRejectsUndecodableMessages(t *testing.T) {
+	s := startNATS(t, 1<<20)
+	host := newRouter(t, s)
+	host.RegisterAgent(echoAgent("shouter"))
+
+	reply, err := s.connect(t).Request("moego.agents.shouter", []byte("not a frame"), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	frame, err := wire.Unmarshal(reply.Data)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	payload, err := frame.Error()
+	if err != nil {
+		t.Fatalf("reply is not an error frame: %v", err)
+	}
+	if err := payload.Err(); !errors.Is(err, router.ErrInvalidMessage) {
+		t.Errorf("reply error = %v, want ErrInvalidMessage", err)
+	}
+}
+
+func TestNATSRouterRouteDeliversWithDeadline(t *testing.T) {
+	s := startNATS(t, 1<<20)
+	host, caller := newRouter(t, s), newRouter(t, s)
+	received := make(chan bool, 1)
+	host.RegisterAgent(&funcAgent{id: "sink", handle: func(ctx context.Context, msg core.Message) ([]core.Message, error) {
+		_, hasDeadline := ctx.Deadline()
+		received <- hasDeadline
+		return nil, nil
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := caller.Route(ctx, "sink", core.Message{Content: "fire and forget"}); err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	select {
+	case hasDeadline := <-received:
+		if !hasDeadline {
+			t.Error("the agent's context lacks the caller's deadline")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the routed message never arrived")
+	}
+}
+
+func TestNATSRouterSpreadsAgentOverProcesses(t *testing.T) {
+	s := startNATS(t, 1<<20)
+	caller := newRouter(t, s)
+	var handled [2]atomic.Int32
+	for i := range handled {
+		newRouter(t, s).RegisterAgent(&funcAgent{id: "worker", handle: func(ctx context.Context, msg core.Message) ([]core.Message, error) {
+			handled[i].Add(1)
+			return []core.Message{{Content: "done"}}, nil
+		}})
+	}
+
+	const requests = 10
+	for i := 0; i < requests; i++ {
+		if _, err := caller.RouteAndWait(context.Background(), "worker", core.Message{Content: "job"}); err != nil {
+			t.Fatalf("RouteAndWait %d: %v", i, err)
+		}
+	}
+	if total := handled[0].Load() + handled[1].Load(); total != requests {
+		t.Errorf("requests handled %d times, want each once (%d)", total, requests)
+	}
+}
+
+func TestNATSRouterTopics(t *testing.T) {
+	s := startNATS(t, 1<<20)
+	publisher := newRouter(t, s)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	got := make(map[string][]string)
+	unsubscribes := make(map[string]func())
+	for _, name := range []string{"audit", "metrics"} {
+		unsubscribe, err := newRouter(t, s).Subscribe("alerts", func(ctx context.Context, msg core.Message) {
+			mu.Lock()
+			got[name] = append(got[name], msg.Content)
+			mu.Unlock()
+			wg.Done()
+		})
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+		unsubscribes[name] = unsubscribe
+	}
+
+	wg.Add(2)
+	if err := publisher.Publish(context.Background(), "alerts", core.Message{Content: "disk full"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	wg.Wait()
+
+	unsubscribes["metrics"]()
+	wg.Add(1)
+	publisher.Publish(context.Background(), "alerts", core.Message{Content: "disk ok"})
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(got["audit"], ",") != "disk full,disk ok" {
+		t.Errorf("audit got %v, want both alerts", got["audit"])
+	}
+	if strings.Join(got["metrics"], ",") != "disk full" {
+		t.Errorf("metrics got %v, want only the alert before unsubscribing", got["metrics"])
+	}
+}
+
+func TestNATSRouterRejectsDuplicateAgents(t *testing.T) {
+	r := newRouter(t, startNATS(t, 1<<20))
+	if err := r.RegisterAgent(echoAgent("shouter")); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	if err := r.RegisterAgent(echoAgent("shouter")); !errors.Is(err, router.ErrAgentExists) {
+		t.Errorf("second RegisterAgent = %v, want ErrAgentExists", err)
+	}
+	r.Close()
+	if err := r.Route(context.Background(), "shouter", core.Message{}); !errors.Is(err, router.ErrRouterClosed) {
+		t.Errorf("Route after Close = %v, want ErrRouterClosed", err)
+	}
+}
+
+// transcriptAgent keeps the messages of every thread in a map that isn't
+// safe for concurrent use, like an agent's history
+type transcriptAgent struct {
+	funcAgent
+	inFlight    atomic.Int32
+	overlapped  atomic.Bool
+	transcripts map[string][]string
+}
+
+func newTranscriptAgent(id string) *transcriptAgent {
+	a := &transcriptAgent{transcripts: make(map[string][]string)}
+	a.funcAgent = funcAgent{id: id, handle: func(ctx context.Context, msg core.Message) ([]core.Message, error) {
+		if a.inFlight.Add(1) > 1 {
+			a.overlapped.Store(true)
+		}
+		defer a.inFlight.Add(-1)
+		thread := core.ThreadIDFromContext(ctx)
+		time.Sleep(time.Millisecond)
+		a.transcripts[thread] = append(a.transcripts[thread], msg.Content)
+		return []core.Message{{Content: strings.Join(a.transcripts[thread], ",")}}, nil
+	}}
+	return a
+}
+
+func TestNATSRouterSerializesAgentAndSeparatesThreads(t *testing.T) {
+	s := startNATS(t, 1<<20)
+	host, caller := newRouter(t, s), newRouter(t, s)
+	a := newTranscriptAgent("scribe")
+	if err := host.RegisterAgent(a); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	const perThread = 5
+	threads := []string{"alpha", "beta"}
+	var wg sync.WaitGroup
+	for _, thread := range threads {
+		for i := 0; i < perThread; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				msg := core.Message{Content: thread, Metadata: map[string]interface{}{core.MetadataThreadID: thread}}
+				if _, err := caller.RouteAndWait(context.Background(), "scribe", msg); err != nil {
+					t.Errorf("RouteAndWait: %v", err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if a.overlapped.Load() {
+		t.Error("the agent processed messages concurrently")
+	}
+	for _, thread := range threads {
+		want := strings.TrimSuffix(strings.Repeat(thread+",", perThread), ",")
+		if got := strings.Join(a.transcripts[thread], ","); got != want {
+			t.Errorf("thread %s transcript = %s, want only its own %d messages", thread, got, perThread)
+		}
+	}
+}
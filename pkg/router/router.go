@@ -0,0 +1,68 @@
+// Package router delivers messages to agents by ID and to topic subscribers,
+// so agents can be reached wherever they run
+package router
+
+import (
+	"context"
+	"errors"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+var (
+	// ErrNoResponders is returned when waiting for a reply from an agent
+	// that no process has registered
+	ErrNoResponders = errors.New("no agent registered to respond")
+
+	// ErrMessageTooLarge is returned when an encoded message exceeds the
+	// transport's size limit
+	ErrMessageTooLarge = errors.New("message too large")
+
+	// ErrInvalidMessage is returned when a message can't be encoded or a
+	// received message can't be decoded
+	ErrInvalidMessage = errors.New("invalid message")
+
+	// ErrAgentExists is returned when registering an agent whose ID is
+	// already registered with the router
+	ErrAgentExists = errors.New("agent already registered")
+
+	// ErrRouterClosed is returned when using a closed router
+	ErrRouterClosed = errors.New("router closed")
+)
+
+func init() {
+	wire.RegisterErrorCode("no_responders", ErrNoResponders)
+	wire.RegisterErrorCode("message_too_large", ErrMessageTooLarge)
+	wire.RegisterErrorCode("invalid_message", ErrInvalidMessage)
+}
+
+// Handler receives the messages published to a topic
+type Handler func(ctx context.Context, msg core.Message)
+
+// Router delivers messages to registered agents and topic subscribers
+type Router interface {
+	// RegisterAgent makes the agent reachable by its ID
+	RegisterAgent(a agent.Agent) error
+
+	// Route delivers the message to the agent without waiting for it to be
+	// processed
+	Route(ctx context.Context, to string, msg core.Message) error
+
+	// RouteAndWait delivers the message to the agent and returns its
+	// replies. Errors of the agent keep their registered wire error code,
+	// so errors.Is works wherever the agent runs.
+	RouteAndWait(ctx context.Context, to string, msg core.Message) ([]core.Message, error)
+
+	// Publish delivers the message to every subscriber of the topic
+	Publish(ctx context.Context, topic string, msg core.Message) error
+
+	// Subscribe calls handler with every message published to the topic
+	// until the returned function is called
+	Subscribe(topic string, handler Handler) (func(), error)
+
+	// Close stops delivering to the agents and subscribers of the router
+	// and waits for the messages they are handling
+	Close() error
+}
@@ -0,0 +1,243 @@
+package router_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsServer is an in-process NATS server speaking enough of the client
+// protocol for the router: subscriptions with wildcards and queue groups,
+// headers, request replies and no-responder statuses. Every connection to it
+// stands in for a separate process.
+type natsServer struct {
+	ln         net.Listener
+	maxPayload int
+
+	mu   sync.Mutex
+	subs []*natsSub
+}
+
+// natsSub is a subscription of a client
+type natsSub struct {
+	client    *natsClient
+	sid       string
+	subject   string
+	queue     string
+	max       int
+	delivered int
+}
+
+// natsClient is a connection to the server
+type natsClient struct {
+	conn         net.Conn
+	mu           sync.Mutex
+	noResponders bool
+}
+
+// startNATS starts a server stopped when the test ends
+func startNATS(t *testing.T, maxPayload int) *natsServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	s := &natsServer{ln: ln, maxPayload: maxPayload}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// connect opens a client connection closed when the test ends
+func (s *natsServer) connect(t *testing.T) *nats.Conn {
+	t.Helper()
+	nc, err := nats.Connect("nats://"+s.ln.Addr().String(), nats.NoReconnect())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func (s *natsServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(&natsClient{conn: conn})
+	}
+}
+
+func (s *natsServer) handle(c *natsClient) {
+	defer func() {
+		c.conn.Close()
+		s.mu.Lock()
+		subs := s.subs[:0]
+		for _, sub := range s.subs {
+			if sub.client != c {
+				subs = append(subs, sub)
+			}
+		}
+		s.subs = subs
+		s.mu.Unlock()
+	}()
+
+	info, _ := json.Marshal(map[string]interface{}{
+		"server_id":   "test",
+		"version":     "2.10.0",
+		"proto":       1,
+		"headers":     true,
+		"max_payload": s.maxPayload,
+	})
+	c.write([]byte("INFO " + string(info) + "\r\n"))
+
+	r := bufio.NewReader(c.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch strings.ToUpper(args[0]) {
+		case "CONNECT":
+			var opts struct {
+				NoResponders bool `json:"no_responders"`
+			}
+			json.Unmarshal([]byte(strings.TrimSpace(line[len(args[0]):])), &opts)
+			c.noResponders = opts.NoResponders
+		case "PING":
+			c.write([]byte("PONG\r\n"))
+		case "SUB":
+			sub := &natsSub{client: c, subject: args[1], sid: args[len(args)-1]}
+			if len(args) == 4 {
+				sub.queue = args[2]
+			}
+			s.mu.Lock()
+			s.subs = append(s.subs, sub)
+			s.mu.Unlock()
+		case "UNSUB":
+			s.unsubscribe(c, args[1:])
+		case "PUB", "HPUB":
+			headers := strings.ToUpper(args[0]) == "HPUB"
+			subject, reply := args[1], ""
+			sizes := args[2:]
+			if want := map[bool]int{false: 1, true: 2}[headers]; len(sizes) > want {
+				reply, sizes = sizes[0], sizes[1:]
+			}
+			hdrSize := 0
+			total, _ := strconv.Atoi(sizes[len(sizes)-1])
+			if headers {
+				hdrSize, _ = strconv.Atoi(sizes[0])
+			}
+			body := make([]byte, total+2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			body = body[:total]
+			s.publish(c, subject, reply, body[:hdrSize], body[hdrSize:])
+		}
+	}
+}
+
+// unsubscribe removes a subscription of the client, or limits how many
+// more messages it gets
+func (s *natsServer) unsubscribe(c *natsClient, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sub := range s.subs {
+		if sub.client != c || sub.sid != args[0] {
+			continue
+		}
+		if len(args) > 1 {
+			sub.max, _ = strconv.Atoi(args[1])
+			if sub.delivered < sub.max {
+				return
+			}
+		}
+		s.subs = append(s.subs[:i], s.subs[i+1:]...)
+		return
+	}
+}
+
+// publish delivers a message to every matching subscription, and to one
+// member of every matching queue group
+func (s *natsServer) publish(from *natsClient, subject, reply string, hdr, payload []byte) {
+	s.mu.Lock()
+	var targets []*natsSub
+	queues := make(map[string]bool)
+	for _, sub := range s.subs {
+		if !subjectMatches(sub.subject, subject) || sub.max > 0 && sub.delivered >= sub.max {
+			continue
+		}
+		if sub.queue != "" {
+			if queues[sub.queue] {
+				continue
+			}
+			queues[sub.queue] = true
+		}
+		sub.delivered++
+		targets = append(targets, sub)
+	}
+	s.mu.Unlock()
+
+	if len(targets) == 0 && reply != "" && from.noResponders {
+		s.publish(from, reply, "", []byte("NATS/1.0 503\r\n\r\n"), nil)
+		return
+	}
+	for _, sub := range targets {
+		sub.client.deliver(sub.sid, subject, reply, hdr, payload)
+	}
+}
+
+// deliver sends a message to the client
+func (c *natsClient) deliver(sid, subject, reply string, hdr, payload []byte) {
+	op := fmt.Sprintf("MSG %s %s ", subject, sid)
+	if len(hdr) > 0 {
+		op = fmt.Sprintf("HMSG %s %s ", subject, sid)
+	}
+	if reply != "" {
+		op += reply + " "
+	}
+	if len(hdr) > 0 {
+		op += fmt.Sprintf("%d ", len(hdr))
+	}
+	op += fmt.Sprintf("%d\r\n", len(hdr)+len(payload))
+
+	msg := append([]byte(op), hdr...)
+	msg = append(msg, payload...)
+	c.write(append(msg, "\r\n"...))
+}
+
+func (c *natsClient) write(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.Write(data)
+}
+
+// subjectMatches reports whether a subject matches a subscription, which
+// may use the * and > wildcards
+func subjectMatches(pattern, subject string) bool {
+	want := strings.Split(pattern, ".")
+	got := strings.Split(subject, ".")
+	for i, token := range want {
+		if token == ">" {
+			return len(got) > i
+		}
+		if i >= len(got) || token != "*" && token != got[i] {
+			return false
+		}
+	}
+	return len(want) == len(got)
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+var (
+	// ErrForbidden is returned when a principal isn't allowed an operation
+	ErrForbidden = errors.New("forbidden")
+)
+
+func init() {
+	wire.RegisterErrorCode("forbidden", ErrForbidden)
+}
+
+// Action is an operation on a served graph that is authorized
+type Action string
+
+const (
+	ActionStart       Action = "start"
+	ActionStream      Action = "stream"
+	ActionGetState    Action = "get_state"
+	ActionUpdateState Action = "update_state"
+	ActionResume      Action = "resume"
+	ActionAbort       Action = "abort"
+	ActionUploadBlob  Action = "upload_blob"
+	ActionGetBlob     Action = "get_blob"
+	ActionFeedback    Action = "feedback"
+)
+
+// Principal is the caller of a served graph
+type Principal struct {
+	// ID identifies the caller. Runs record it as their owner.
+	ID string `json:"id"`
+
+	// Role decides what the caller may do
+	Role string `json:"role,omitempty"`
+}
+
+// Anonymous reports whether the principal is unidentified
+func (p Principal) Anonymous() bool {
+	return p.ID == ""
+}
+
+// Authorizer decides whether a principal may perform an action on a thread
+// of a graph. The thread is empty for actions that don't target an existing
+// run, such as starting one. The owner of the thread, when known, is in ctx
+// (see ThreadOwnerFromContext). A non-nil error denies the action.
+type Authorizer interface {
+	Authorize(ctx context.Context, principal Principal, action Action, graphName, threadID string) error
+}
+
+// AuthorizerFunc adapts a function to the Authorizer interface
+type AuthorizerFunc func(ctx context.Context, principal Principal, action Action, graphName, threadID string) error
+
+// Authorize calls f
+func (f AuthorizerFunc) Authorize(ctx context.Context, principal Principal, action Action, graphName, threadID string) error {
+	return f(ctx, principal, action, graphName, threadID)
+}
+
+// PrincipalFunc extracts the principal of a request. An error rejects the
+// request as unauthorized.
+type PrincipalFunc func(r *http.Request) (Principal, error)
+
+// Denial describes an operation that was denied, for auditing
+type Denial struct {
+	Principal Principal `json:"principal"`
+	Action    Action    `json:"action"`
+	GraphName string    `json:"graph_name,omitempty"`
+	ThreadID  string    `json:"thread_id,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	Reason    string    `json:"reason"`
+	Time      time.Time `json:"time"`
+}
+
+// Auth configures authorization of a served graph. A server without one
+// allows everything.
+type Auth struct {
+	// GraphName is passed to the authorizer. Empty uses the name set with
+	// StateGraph.SetName.
+	GraphName string
+
+	// Authorizer decides on each operation
+	Authorizer Authorizer
+
+	// Principal extracts the caller of a request. Nil treats every caller
+	// as anonymous.
+	Principal PrincipalFunc
+
+	// OnDenied is called for every denied operation
+	OnDenied func(ctx context.Context, denial Denial)
+}
+
+// forGraph returns the auth with the graph's name filled in
+func (a *Auth) forGraph(name string) *Auth {
+	if a == nil || a.GraphName != "" {
+		return a
+	}
+	named := *a
+	named.GraphName = name
+	return &named
+}
+
+// principal extracts the principal of a request
+func (a *Auth) principal(r *http.Request) (Principal, error) {
+	if a == nil || a.Principal == nil {
+		return Principal{}, nil
+	}
+	return a.Principal(r)
+}
+
+// authorize checks an action of a principal on a thread owned by owner and
+// audits denials
+func (a *Auth) authorize(ctx context.Context, principal Principal, action Action, threadID, owner string) error {
+	if a == nil || a.Authorizer == nil {
+		return nil
+	}
+	err := a.Authorizer.Authorize(WithThreadOwner(ctx, owner), principal, action, a.GraphName, threadID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrForbidden) {
+		err = fmt.Errorf("%w: %w", ErrForbidden, err)
+	}
+	if a.OnDenied != nil {
+		a.OnDenied(ctx, Denial{
+			Principal: principal,
+			Action:    action,
+			GraphName: a.GraphName,
+			ThreadID:  threadID,
+			Owner:     owner,
+			Reason:    err.Error(),
+			Time:      time.Now(),
+		})
+	}
+	return err
+}
+
+// check extracts the principal of a request and authorizes the action,
+// writing an error response when either fails
+func (a *Auth) check(w http.ResponseWriter, r *http.Request, action Action, threadID, owner string) (Principal, bool) {
+	principal, err := a.principal(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return principal, false
+	}
+	if err := a.authorize(r.Context(), principal, action, threadID, owner); err != nil {
+		writeForbidden(w, action, threadID, err)
+		return principal, false
+	}
+	return principal, true
+}
+
+// writeForbidden writes a denial as a 403 response
+func writeForbidden(w http.ResponseWriter, action Action, threadID string, err error) {
+	body := map[string]string{
+		"error":  err.Error(),
+		"code":   wire.ErrorCode(ErrForbidden),
+		"action": string(action),
+	}
+	if threadID != "" {
+		body["thread_id"] = threadID
+	}
+	writeJSON(w, http.StatusForbidden, body)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the caller of an operation. Runs
+// started with it record the principal as their owner.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the caller of an operation, or the anonymous
+// principal
+func PrincipalFromContext(ctx context.Context) Principal {
+	principal, _ := ctx.Value(principalKey{}).(Principal)
+	return principal
+}
+
+type threadOwnerKey struct{}
+
+// WithThreadOwner returns a context carrying the ID of the principal that
+// started the thread being authorized
+func WithThreadOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, threadOwnerKey{}, owner)
+}
+
+// ThreadOwnerFromContext returns the ID of the principal that started the
+// thread being authorized, or "" when the thread has no recorded owner
+func ThreadOwnerFromContext(ctx context.Context) string {
+	owner, _ := ctx.Value(threadOwnerKey{}).(string)
+	return owner
+}
+
+// StaticTokenAuth authorizes callers by a fixed set of bearer tokens, each
+// mapped to a principal whose role grants a set of actions. Principals may
+// only act on threads they own unless their role is listed in AnyThread.
+type StaticTokenAuth struct {
+	// Tokens maps bearer tokens to principals
+	Tokens map[string]Principal
+
+	// Roles maps roles to the actions they allow
+	Roles map[string][]Action
+
+	// AnyThread lists roles that may act on threads owned by others
+	AnyThread []string
+}
+
+// Principal returns the principal of the bearer token in the Authorization
+// header. Requests without a known token are anonymous.
+func (a *StaticTokenAuth) Principal(r *http.Request) (Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Principal{}, nil
+	}
+	return a.Tokens[strings.TrimSpace(token)], nil
+}
+
+// Authorize allows the action when the principal's role grants it and the
+// principal owns the thread or its role may act on any thread
+func (a *StaticTokenAuth) Authorize(ctx context.Context, principal Principal, action Action, graphName, threadID string) error {
+	if principal.Anonymous() {
+		return fmt.Errorf("%w: anonymous caller", ErrForbidden)
+	}
+	if !a.allows(principal.Role, action) {
+		return fmt.Errorf("%w: role %q may not %s", ErrForbidden, principal.Role, action)
+	}
+	owner := ThreadOwnerFromContext(ctx)
+	if owner != "" && owner != principal.ID && !a.anyThread(principal.Role) {
+		return fmt.Errorf("%w: thread %s is owned by another principal", ErrForbidden, threadID)
+	}
+	return nil
+}
+
+func (a *StaticTokenAuth) allows(role string, action Action) bool {
+	for _, allowed := range a.Roles[role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *StaticTokenAuth) anyThread(role string) bool {
+	for _, r := range a.AnyThread {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
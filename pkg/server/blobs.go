@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// handleUploadBlob stores the request body as a blob with the request's
+// content type
+func (s *GraphServer[T]) handleUploadBlob(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.config.Auth.check(w, r, ActionUploadBlob, "", ""); !ok {
+		return
+	}
+
+	limit := s.config.MaxBlobBytes
+	if limit <= 0 {
+		limit = DefaultMaxBlobBytes
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	ref, err := s.config.Blobs.Put(r.Context(), contentType, http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("blob exceeds %d bytes", limit))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, ref)
+}
+
+// handleGetBlob writes the content of a blob
+func (s *GraphServer[T]) handleGetBlob(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.config.Auth.check(w, r, ActionGetBlob, "", ""); !ok {
+		return
+	}
+
+	content, ref, err := s.config.Blobs.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, core.ErrBlobNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+	defer content.Close()
+
+	if ref.ContentType != "" {
+		w.Header().Set("Content-Type", ref.ContentType)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(ref.Size, 10))
+	w.Header().Set("ETag", strconv.Quote(ref.Hash))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, content)
+}
+
+// CollectBlobs deletes the blobs no live thread references and returns
+// their IDs. Threads reference the blobs in the states they were started
+// and resumed with. Blobs stored less than grace ago are kept, which covers
+// uploads whose run hasn't started yet and blobs nodes stored while running.
+func (s *GraphServer[T]) CollectBlobs(ctx context.Context, grace time.Duration) ([]string, error) {
+	if s.config.Blobs == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	live := make([]interface{}, 0, len(s.threads))
+	for _, run := range s.threads {
+		live = append(live, run.blobs)
+	}
+	s.mu.Unlock()
+	return core.CollectBlobs(ctx, s.config.Blobs, grace, live...)
+}
@@ -0,0 +1,105 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/prebuilt"
+	"github.com/forrestdevs/moego/pkg/server"
+)
+
+// approvalGraph counts a step, waits for an "approved" event and counts
+// another
+func approvalGraph(store *core.ThreadStore) *core.StateGraph[account] {
+	g := core.NewStateGraph[account]()
+	g.SetStreamConfig(core.StreamConfig{})
+	g.SetThreadStore(store)
+	step := func(ctx context.Context, s account) (account, error) {
+		s.Steps++
+		return s, nil
+	}
+	g.AddNode("a", step)
+	g.AddNode("approve", prebuilt.WaitForEvent[account]("approved", nil, time.Hour))
+	g.AddNode("b", step)
+	g.SetEntryPoint("a")
+	g.AddConditionalEdges("a", func(account) ([]string, error) { return []string{"approve"}, nil }, nil)
+	g.AddConditionalEdges("approve", func(account) ([]string, error) { return []string{"b"}, nil }, nil)
+	g.AddConditionalEdges("b", func(account) ([]string, error) { return []string{core.END}, nil }, nil)
+	return g
+}
+
+// postEvent delivers the event and returns the response status
+func postEvent(t *testing.T, url string, evt core.ExternalEvent) int {
+	t.Helper()
+	body, err := json.Marshal(evt)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	resp, err := http.Post(url+"/events", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("POST /events: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestEventResumesSuspendedThread(t *testing.T) {
+	store := core.NewThreadStore(nil)
+	s, err := server.NewGraphServer(approvalGraph(store), server.DefaultGraphServerConfig())
+	if err != nil {
+		t.Fatalf("NewGraphServer: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+
+	var resp server.ThreadResponse
+	if err := json.Unmarshal([]byte(post(t, ts.URL+"/invoke", "", account{Name: "ada"})), &resp); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if resp.Status != server.ThreadWaiting || resp.Wait == nil || resp.Wait.Event != "approved" {
+		t.Fatalf("invoke responded %+v, want a run waiting for approved", resp)
+	}
+
+	// The suspended run doesn't hold the graph
+	if status := post(t, ts.URL+"/invoke", "", account{Name: "bob"}); !strings.Contains(status, server.ThreadWaiting) {
+		t.Fatalf("second run responded %s", status)
+	}
+
+	evt := core.ExternalEvent{Name: "approved", ThreadID: resp.ThreadID}
+	if status := postEvent(t, ts.URL, evt); status != http.StatusAccepted {
+		t.Fatalf("event for the suspended thread = %d, want 202", status)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		thread, err := store.SavedThread(context.Background(), resp.ThreadID)
+		if err != nil {
+			t.Fatalf("SavedThread: %v", err)
+		}
+		if thread.Node == "" {
+			if !strings.Contains(string(thread.State), `"steps":2`) {
+				t.Errorf("resumed thread ended with %s, want both steps", thread.State)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("thread still at %q after the event", thread.Node)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if status := postEvent(t, ts.URL, evt); status != http.StatusAccepted {
+		t.Errorf("late duplicate = %d, want 202", status)
+	}
+	if status := postEvent(t, ts.URL, core.ExternalEvent{Name: "approved", ThreadID: "thread-unknown"}); status != http.StatusNotFound {
+		t.Errorf("event for an unknown thread = %d, want 404", status)
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+// GraphHandler returns an HTTP handler that invokes the graph synchronously,
+// without a run manager, so graphs can call each other across processes.
+// A POST request carries the input state as JSON and the response is the
+// final state. When the request accepts text/event-stream the run is
+// streamed as server-sent wire frames instead, ending with a values frame
+// holding the final state and an end frame, or an error frame.
+//
+// A wire.DeadlineHeader on the request bounds the run. Failed runs respond
+// with an error code so callers can match registered sentinels. States are
+// redacted with the graph's redaction policy. The graph's streams are shared
+// by all of its runs, so runs are executed one at a time.
+func GraphHandler[T any](runnable *core.RunnableState[T]) http.Handler {
+	// slot is held by the run in flight
+	slot := make(chan struct{}, 1)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+
+		input, err := decodeBody(r, runnable.Codec())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx := r.Context()
+		if header := r.Header.Get(wire.DeadlineHeader); header != "" {
+			deadline, err := time.Parse(time.RFC3339Nano, header)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s header: %w", wire.DeadlineHeader, err))
+				return
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+
+		select {
+		case slot <- struct{}{}:
+			defer func() { <-slot }()
+		case <-ctx.Done():
+			writeError(w, invokeStatusFor(ctx.Err()), ctx.Err())
+			return
+		}
+
+		events, wait := runnable.InvokeStreaming(ctx, input)
+
+		if r.Header.Get("Accept") != "text/event-stream" {
+			for range events {
+			}
+			state, err := wait()
+			if err == nil {
+				var output []byte
+				if output, err = runnable.RedactState(state); err == nil {
+					writeJSON(w, http.StatusOK, json.RawMessage(output))
+					return
+				}
+			}
+			writeError(w, invokeStatusFor(err), err)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			for range events {
+			}
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		encoder := wire.NewEncoder(newRunID())
+		var lastValues json.RawMessage
+		send := func(frame wire.Frame, err error) {
+			if err != nil {
+				return
+			}
+			if frame.Kind == wire.KindValues {
+				lastValues = frame.Payload
+			}
+			if wire.WriteSSE(w, frame) == nil {
+				flusher.Flush()
+			}
+		}
+
+		for evt := range events {
+			send(encodeRedacted(runnable, encoder, evt))
+		}
+
+		state, err := wait()
+		if err != nil {
+			send(encoder.Error(err))
+			return
+		}
+		// The graph already streamed the final state unless values aren't
+		// among its stream modes
+		if final, err := runnable.RedactState(state); err == nil && !bytes.Equal(final, lastValues) {
+			send(encoder.Frame(wire.KindValues, json.RawMessage(final)))
+		}
+		send(encoder.End())
+	})
+}
+
+// encodeRedacted encodes a stream event as a wire frame, redacting the state
+// carried by values, updates and custom events
+func encodeRedacted[T any](runnable *core.RunnableState[T], encoder *wire.Encoder, evt core.StreamEvent) (wire.Frame, error) {
+	if _, ok := evt.Data.(core.Event); !ok {
+		if state, ok := evt.Data.(T); ok {
+			data, err := runnable.RedactState(state)
+			if err != nil {
+				return wire.Frame{}, err
+			}
+			evt.Data = json.RawMessage(data)
+		}
+	}
+	return encoder.Stream(evt)
+}
+
+// invokeStatusFor maps graph errors to HTTP status codes
+func invokeStatusFor(err error) int {
+	switch {
+	case errors.Is(err, core.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, core.ErrRunTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
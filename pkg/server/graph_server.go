@@ -0,0 +1,644 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+var (
+	// ErrServerClosed is returned when starting a run on a closed graph server
+	ErrServerClosed = errors.New("graph server closed")
+
+	// ErrThreadBusy is returned when starting a run on a thread that already
+	// has one in flight
+	ErrThreadBusy = errors.New("thread has a run in flight")
+)
+
+func init() {
+	wire.RegisterErrorCode("server_closed", ErrServerClosed)
+	wire.RegisterErrorCode("thread_busy", ErrThreadBusy)
+	wire.RegisterErrorCode("no_waiter", core.ErrNoWaiter)
+	wire.RegisterErrorCode("run_suspended", core.ErrSuspended)
+}
+
+// Thread statuses reported by a graph server
+const (
+	ThreadCompleted   = "completed"
+	ThreadInterrupted = "interrupted"
+	ThreadWaiting     = "waiting"
+)
+
+// ThreadResponse is the response of the invoke and resume endpoints of a
+// graph server
+type ThreadResponse struct {
+	// ThreadID identifies the run for resumption
+	ThreadID string `json:"thread_id"`
+
+	// Status is ThreadCompleted, ThreadInterrupted or ThreadWaiting
+	Status string `json:"status"`
+
+	// State is the final state of a completed run
+	State json.RawMessage `json:"state,omitempty"`
+
+	// Interrupt describes why an interrupted run is paused
+	Interrupt *core.InterruptInfo `json:"interrupt,omitempty"`
+
+	// Wait is the event a waiting run was suspended until
+	Wait *core.EventWait `json:"wait,omitempty"`
+}
+
+// GraphServerConfig contains configuration for a graph server
+type GraphServerConfig struct {
+	// InterruptTimeout cancels a run that stays interrupted this long
+	// without being resumed. Zero waits forever.
+	InterruptTimeout time.Duration
+
+	// Auth authorizes the operations of the server. Nil allows all.
+	Auth *Auth
+
+	// Blobs stores uploaded blobs, which runs resolve their BlobRefs in.
+	// Nil disables the blob endpoints.
+	Blobs core.BlobStore
+
+	// MaxBlobBytes bounds the size of an uploaded blob. Zero means
+	// DefaultMaxBlobBytes.
+	MaxBlobBytes int64
+}
+
+// DefaultMaxBlobBytes bounds uploaded blobs when no MaxBlobBytes is configured
+const DefaultMaxBlobBytes = 32 << 20
+
+// DefaultGraphServerConfig returns the default graph server configuration
+func DefaultGraphServerConfig() GraphServerConfig {
+	return GraphServerConfig{
+		InterruptTimeout: 10 * time.Minute,
+	}
+}
+
+// GraphServer serves a graph as an HTTP service:
+//
+//	POST /invoke               run the posted state and respond with the result
+//	POST /stream               run the posted state, streaming server-sent wire frames
+//	POST /resume?thread_id=id  resume an interrupted run with the posted state
+//	POST /events               deliver a posted core.ExternalEvent to the run waiting for it
+//	GET  /graph                the graph structure as JSON, or Mermaid with ?format=mermaid
+//	POST /blobs                store the posted body as a blob and respond with its core.BlobRef
+//	GET  /blobs/{id}           the content of a blob
+//
+// States are decoded and encoded with the graph's codec. A run that
+// interrupts responds with its thread ID, which the client resumes it with.
+// The graph's streams and interrupts are shared by all of its runs, so runs
+// are executed one at a time, and an interrupted run holds the graph until
+// it is resumed or InterruptTimeout passes. Runs of graphs with a thread
+// store that wait for an external event are suspended instead of holding
+// the graph, and resumed from their thread when the event is delivered or
+// their wait expires. With GraphServerConfig.Auth set,
+// every operation is authorized and runs are owned by the principal that
+// started them.
+type GraphServer[T any] struct {
+	graph    *core.StateGraph[T]
+	runnable *core.RunnableState[T]
+	config   GraphServerConfig
+
+	// slot is held by the run in flight
+	slot chan struct{}
+
+	mu      sync.Mutex
+	threads map[string]*threadRun[T]
+	active  *threadRun[T]
+
+	// events delivers external events to runs waiting in prebuilt.WaitForEvent
+	events *core.EventBus
+
+	// suspended are the owners of the threads suspended until an event,
+	// with the timers resuming them when their wait expires
+	suspended map[string]suspendedThread
+
+	stop chan struct{}
+}
+
+// threadRun is a run of a graph server
+type threadRun[T any] struct {
+	id     string
+	owner  string
+	cancel context.CancelFunc
+	events <-chan core.StreamEvent
+	done   chan struct{}
+	state  T
+	err    error
+
+	// interrupts delivers the interrupt the run is paused on
+	interrupts chan core.InterruptInfo
+
+	// paused is set while the run waits to be resumed
+	paused bool
+	timer  *time.Timer
+
+	// blobs are the blobs referenced by the states the run was given
+	blobs []core.BlobRef
+}
+
+// suspendedThread is a thread whose run a node suspended until an event
+type suspendedThread struct {
+	owner string
+	timer *time.Timer
+}
+
+// NewGraphServer compiles the graph and creates a server for it
+func NewGraphServer[T any](graph *core.StateGraph[T], config GraphServerConfig) (*GraphServer[T], error) {
+	runnable, err := graph.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	config.Auth = config.Auth.forGraph(graph.Structure().Name)
+
+	s := &GraphServer[T]{
+		graph:    graph,
+		runnable: runnable,
+		config:   config,
+		slot:     make(chan struct{}, 1),
+		threads:  make(map[string]*threadRun[T]),
+		events:   core.NewEventBus(),
+		stop:     make(chan struct{}),
+
+		suspended: make(map[string]suspendedThread),
+	}
+	go s.routeInterrupts()
+	return s, nil
+}
+
+// Close cancels all runs and stops the server
+func (s *GraphServer[T]) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+	close(s.stop)
+	for _, run := range s.threads {
+		run.cancel()
+	}
+	for _, thread := range s.suspended {
+		if thread.timer != nil {
+			thread.timer.Stop()
+		}
+	}
+}
+
+// Handler returns the HTTP handler of the server
+func (s *GraphServer[T]) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /invoke", s.handleInvoke)
+	mux.HandleFunc("POST /stream", s.handleStream)
+	mux.HandleFunc("POST /resume", s.handleResume)
+	mux.HandleFunc("POST /events", s.handleEvent)
+	mux.HandleFunc("GET /graph", s.handleGraph)
+	if s.config.Blobs != nil {
+		mux.HandleFunc("POST /blobs", s.handleUploadBlob)
+		mux.HandleFunc("GET /blobs/{id}", s.handleGetBlob)
+	}
+	return mux
+}
+
+func (s *GraphServer[T]) handleInvoke(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.startFromRequest(w, r, ActionStart)
+	if ok {
+		s.respond(w, r, run)
+	}
+}
+
+func (s *GraphServer[T]) handleStream(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.startFromRequest(w, r, ActionStart, ActionStream)
+	if ok {
+		s.stream(w, r, run)
+	}
+}
+
+// handleResume resumes an interrupted run, recording the caller as the
+// editor of the state. The response streams when the request accepts
+// text/event-stream.
+func (s *GraphServer[T]) handleResume(w http.ResponseWriter, r *http.Request) {
+	state, err := decodeBody(r, s.graph.Codec())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id := r.URL.Query().Get("thread_id")
+	streaming := r.Header.Get("Accept") == "text/event-stream"
+	s.mu.Lock()
+	run, found := s.threads[id]
+	if !found {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: thread %s", ErrRunNotFound, id))
+		return
+	}
+	s.mu.Unlock()
+
+	principal, ok := s.config.Auth.check(w, r, ActionResume, id, run.owner)
+	if !ok {
+		return
+	}
+	if streaming {
+		if _, ok := s.config.Auth.check(w, r, ActionStream, id, run.owner); !ok {
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if !run.paused {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Errorf("%w: thread %s", ErrRunNotAwaiting, id))
+		return
+	}
+	run.paused = false
+	if run.timer != nil {
+		run.timer.Stop()
+	}
+	run.blobs = append(run.blobs, core.BlobRefsIn(state)...)
+	s.mu.Unlock()
+
+	if err := s.graph.ResumeAs(state, principal.ID); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	if streaming {
+		s.stream(w, r, run)
+		return
+	}
+	s.respond(w, r, run)
+}
+
+// Events returns the event bus the server's runs wait on, for delivering
+// events in process
+func (s *GraphServer[T]) Events() *core.EventBus {
+	return s.events
+}
+
+// handleEvent delivers an external event. An event for a thread suspended
+// until it resumes the thread. Repeated deliveries of the same event ID, and
+// events for threads that no longer wait for them, are accepted and ignored.
+func (s *GraphServer[T]) handleEvent(w http.ResponseWriter, r *http.Request) {
+	var evt core.ExternalEvent
+	if err := json.NewDecoder(r.Body).Decode(&evt); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid event: %w", err))
+		return
+	}
+	if evt.Name == "" || evt.ThreadID == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid event: name and thread_id are required"))
+		return
+	}
+
+	// Delivering an event resumes the waiting run
+	var owner string
+	s.mu.Lock()
+	if run, found := s.threads[evt.ThreadID]; found {
+		owner = run.owner
+	} else if thread, found := s.suspended[evt.ThreadID]; found {
+		owner = thread.owner
+	}
+	s.mu.Unlock()
+	if _, ok := s.config.Auth.check(w, r, ActionResume, evt.ThreadID, owner); !ok {
+		return
+	}
+
+	err := s.events.Deliver(r.Context(), evt)
+	if errors.Is(err, core.ErrNoWaiter) {
+		err = s.deliverSuspended(r.Context(), evt)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deliverSuspended delivers an event nobody waits for in memory. The event
+// is held for a run of its thread that is in flight, which may be about to
+// suspend until it, and resumes a thread saved waiting for it. Events for a
+// saved thread that waits for something else are late duplicates and
+// ignored.
+func (s *GraphServer[T]) deliverSuspended(ctx context.Context, evt core.ExternalEvent) error {
+	s.mu.Lock()
+	if _, found := s.threads[evt.ThreadID]; found {
+		s.events.Hold(evt)
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	store := s.graph.ThreadStore()
+	if store == nil {
+		return fmt.Errorf("%w: %s on thread %s", core.ErrNoWaiter, evt.Name, evt.ThreadID)
+	}
+	thread, err := store.SavedThread(ctx, evt.ThreadID)
+	if errors.Is(err, core.ErrThreadNotFound) {
+		return fmt.Errorf("%w: %s on thread %s", core.ErrNoWaiter, evt.Name, evt.ThreadID)
+	}
+	if err != nil {
+		return err
+	}
+	if thread.Wait == nil || thread.Wait.Event != evt.Name {
+		return nil
+	}
+	s.events.Hold(evt)
+	go s.resume(evt.ThreadID)
+	return nil
+}
+
+// resume continues a suspended thread in the background
+func (s *GraphServer[T]) resume(threadID string) {
+	s.mu.Lock()
+	thread := s.suspended[threadID]
+	s.mu.Unlock()
+
+	ctx := WithPrincipal(context.Background(), Principal{ID: thread.owner})
+	run, err := s.start(ctx, threadID, nil, func(ctx context.Context) (<-chan core.StreamEvent, func() (T, error)) {
+		return s.runnable.ResumeThreadStreaming(ctx, threadID)
+	})
+	if err != nil {
+		// The thread is busy with a run that takes the held event itself,
+		// or the server closed
+		return
+	}
+	for range run.events {
+	}
+}
+
+// handleGraph describes the graph
+func (s *GraphServer[T]) handleGraph(w http.ResponseWriter, r *http.Request) {
+	structure := s.graph.Structure()
+	if r.URL.Query().Get("format") == "mermaid" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(structure.Mermaid()))
+		return
+	}
+	writeJSON(w, http.StatusOK, structure)
+}
+
+// startFromRequest authorizes the actions, decodes the input state and
+// starts a run, writing an error response when that fails
+func (s *GraphServer[T]) startFromRequest(w http.ResponseWriter, r *http.Request, actions ...Action) (*threadRun[T], bool) {
+	var principal Principal
+	for _, action := range actions {
+		var ok bool
+		if principal, ok = s.config.Auth.check(w, r, action, "", ""); !ok {
+			return nil, false
+		}
+	}
+
+	input, err := decodeBody(r, s.graph.Codec())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	threadID := r.URL.Query().Get("thread_id")
+	if threadID == "" {
+		threadID = strings.Replace(newRunID(), "run-", "thread-", 1)
+	}
+
+	run, err := s.start(WithPrincipal(r.Context(), principal), threadID, core.BlobRefsIn(input),
+		func(ctx context.Context) (<-chan core.StreamEvent, func() (T, error)) {
+			return s.runnable.InvokeStreaming(ctx, input)
+		})
+	if err != nil {
+		status := http.StatusServiceUnavailable
+		switch {
+		case errors.Is(err, ErrThreadBusy):
+			status = http.StatusConflict
+		case r.Context().Err() != nil:
+			status = http.StatusRequestTimeout
+		}
+		writeError(w, status, err)
+		return nil, false
+	}
+	return run, true
+}
+
+// start waits for the graph to be free and starts a run on it with invoke.
+// The principal in ctx, if any, is recorded as the owner of the run.
+func (s *GraphServer[T]) start(ctx context.Context, threadID string, blobs []core.BlobRef, invoke func(ctx context.Context) (<-chan core.StreamEvent, func() (T, error))) (*threadRun[T], error) {
+	select {
+	case s.slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.stop:
+		return nil, ErrServerClosed
+	}
+
+	s.mu.Lock()
+	if _, exists := s.threads[threadID]; exists {
+		s.mu.Unlock()
+		<-s.slot
+		return nil, fmt.Errorf("%w: %s", ErrThreadBusy, threadID)
+	}
+
+	runCtx := core.WithThreadID(core.WithNamespace(context.Background(), threadID), threadID)
+	if s.config.Blobs != nil {
+		runCtx = core.WithBlobs(runCtx, s.config.Blobs)
+	}
+	runCtx, cancel := context.WithCancel(core.WithEventBus(runCtx, s.events))
+	run := &threadRun[T]{
+		id:         threadID,
+		owner:      PrincipalFromContext(ctx).ID,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		interrupts: make(chan core.InterruptInfo, 1),
+		blobs:      blobs,
+	}
+	s.threads[threadID] = run
+	s.active = run
+	if thread, found := s.suspended[threadID]; found {
+		if thread.timer != nil {
+			thread.timer.Stop()
+		}
+		delete(s.suspended, threadID)
+	}
+	s.mu.Unlock()
+
+	events, wait := invoke(runCtx)
+	run.events = events
+	go func() {
+		run.state, run.err = wait()
+		cancel()
+
+		s.mu.Lock()
+		delete(s.threads, threadID)
+		if s.active == run {
+			s.active = nil
+		}
+		if run.timer != nil {
+			run.timer.Stop()
+		}
+		resume := s.suspend(run)
+		s.mu.Unlock()
+
+		close(run.done)
+		<-s.slot
+		if resume {
+			go s.resume(threadID)
+		}
+	}()
+	return run, nil
+}
+
+// suspend records a run that ended suspended until an event, and reports
+// whether the event already arrived while the run was in flight. Events held
+// for runs that ended otherwise are dropped. The caller must hold mu.
+func (s *GraphServer[T]) suspend(run *threadRun[T]) bool {
+	var suspended *core.SuspendError
+	if !errors.As(run.err, &suspended) {
+		s.events.Release(run.id)
+		return false
+	}
+
+	thread := suspendedThread{owner: run.owner}
+	if deadline := suspended.Wait.Deadline; !deadline.IsZero() {
+		// Resuming after the deadline expires the wait
+		thread.timer = time.AfterFunc(time.Until(deadline), func() { s.resume(run.id) })
+	}
+	s.suspended[run.id] = thread
+	return s.events.Holding(run.id, suspended.Wait.Event)
+}
+
+// routeInterrupts hands the graph's interrupts to the run in flight
+func (s *GraphServer[T]) routeInterrupts() {
+	for {
+		select {
+		case info := <-s.graph.GetInterruptChannel():
+			s.mu.Lock()
+			run := s.active
+			if run != nil {
+				run.paused = true
+				if s.config.InterruptTimeout > 0 {
+					run.timer = time.AfterFunc(s.config.InterruptTimeout, run.cancel)
+				}
+			}
+			s.mu.Unlock()
+			if run != nil {
+				run.interrupts <- info
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// respond waits for the run to complete, interrupt or suspend and writes the
+// result
+func (s *GraphServer[T]) respond(w http.ResponseWriter, r *http.Request, run *threadRun[T]) {
+	select {
+	case <-run.done:
+		var suspended *core.SuspendError
+		if errors.As(run.err, &suspended) {
+			writeJSON(w, http.StatusOK, ThreadResponse{ThreadID: run.id, Status: ThreadWaiting, Wait: &suspended.Wait})
+			return
+		}
+		if run.err != nil {
+			writeError(w, invokeStatusFor(run.err), run.err)
+			return
+		}
+		state, err := s.graph.RedactState(run.state)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ThreadResponse{ThreadID: run.id, Status: ThreadCompleted, State: state})
+
+	case info := <-run.interrupts:
+		writeJSON(w, http.StatusOK, ThreadResponse{ThreadID: run.id, Status: ThreadInterrupted, Interrupt: &info})
+
+	case <-r.Context().Done():
+		// Nobody is waiting for the result anymore
+		run.cancel()
+	}
+}
+
+// encodeStream encodes a stream event as a wire frame, redacting the state
+// carried by values, updates and custom events
+func (s *GraphServer[T]) encodeStream(encoder *wire.Encoder, evt core.StreamEvent) (wire.Frame, error) {
+	return encodeRedacted(s.runnable, encoder, evt)
+}
+
+// stream follows the run as server-sent wire frames until it completes or
+// interrupts
+func (s *GraphServer[T]) stream(w http.ResponseWriter, r *http.Request, run *threadRun[T]) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Moego-Thread-ID", run.id)
+	w.WriteHeader(http.StatusOK)
+
+	encoder := wire.NewEncoder(run.id)
+	var lastValues json.RawMessage
+	send := func(frame wire.Frame, err error) {
+		if err != nil {
+			return
+		}
+		if frame.Kind == wire.KindValues {
+			lastValues = frame.Payload
+		}
+		if wire.WriteSSE(w, frame) == nil {
+			flusher.Flush()
+		}
+	}
+
+	events := run.events
+	for {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				// The run ended, wait for its result below
+				events = nil
+				continue
+			}
+			send(s.encodeStream(encoder, evt))
+
+		case <-run.done:
+			if events != nil {
+				for evt := range events {
+					send(s.encodeStream(encoder, evt))
+				}
+			}
+			if run.err != nil {
+				send(encoder.Error(run.err))
+				return
+			}
+			// The graph already streamed the final state unless values
+			// aren't among its stream modes
+			if state, err := s.graph.RedactState(run.state); err == nil && !bytes.Equal(state, lastValues) {
+				send(encoder.Frame(wire.KindValues, json.RawMessage(state)))
+			}
+			send(encoder.End())
+			return
+
+		case info := <-run.interrupts:
+			send(encoder.Frame(wire.KindInterrupt, info))
+			return
+
+		case <-r.Context().Done():
+			run.cancel()
+			return
+		}
+	}
+}
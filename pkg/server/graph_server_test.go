@@ -0,0 +1,143 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/server"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+// threadResponse decodes the response of the invoke and resume endpoints
+func threadResponse(t *testing.T, body string) server.ThreadResponse {
+	t.Helper()
+	var resp server.ThreadResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", body, err)
+	}
+	return resp
+}
+
+// get fetches the URL and returns the status and body
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s: %v", url, err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestGraphServerInvoke(t *testing.T) {
+	ts := newGraphServer(t, accountGraph([]core.StreamMode{core.StreamValues}, false))
+
+	resp := threadResponse(t, post(t, ts.URL+"/invoke?thread_id=thread-ada", "", account{Name: "ada"}))
+	if resp.ThreadID != "thread-ada" || resp.Status != server.ThreadCompleted {
+		t.Fatalf("response = %+v, want thread-ada completed", resp)
+	}
+	var state map[string]interface{}
+	if err := json.Unmarshal(resp.State, &state); err != nil {
+		t.Fatalf("Unmarshal state: %v", err)
+	}
+	if state["name"] != "ada" || state["steps"] != float64(2) {
+		t.Errorf("state = %v, want ada after two steps", state)
+	}
+
+	// Thread IDs are generated when the client doesn't pick one
+	if resp := threadResponse(t, post(t, ts.URL+"/invoke", "", account{Name: "bob"})); !strings.HasPrefix(resp.ThreadID, "thread-") {
+		t.Errorf("generated thread ID = %q", resp.ThreadID)
+	}
+}
+
+func TestGraphServerStream(t *testing.T) {
+	ts := newGraphServer(t, accountGraph([]core.StreamMode{core.StreamValues, core.StreamDebug}, false))
+
+	frames := sseFrames(t, post(t, ts.URL+"/stream", "text/event-stream", account{Name: "ada"}))
+	var nodes []string
+	var last map[string]interface{}
+	for _, frame := range frames {
+		switch frame.Kind {
+		case wire.KindEvent:
+			if evt, err := frame.Event(); err == nil && evt.Type == core.EventChainStart && evt.Name != "LangGraph" {
+				nodes = append(nodes, evt.Name)
+			}
+		case wire.KindValues:
+			if err := json.Unmarshal(frame.Payload, &last); err != nil {
+				t.Fatalf("Unmarshal values: %v", err)
+			}
+		}
+	}
+	if strings.Join(nodes, ",") != "a,b" {
+		t.Errorf("nodes started = %v, want a then b", nodes)
+	}
+	if last["steps"] != float64(2) {
+		t.Errorf("last values = %v, want two steps", last)
+	}
+	if frames[len(frames)-1].Kind != wire.KindEnd || frames[0].RunID != frames[len(frames)-1].RunID {
+		t.Errorf("frames = %+v, want one run ending with an end frame", frames)
+	}
+}
+
+func TestGraphServerResume(t *testing.T) {
+	s, err := server.NewGraphServer(reviewGraph(), server.DefaultGraphServerConfig())
+	if err != nil {
+		t.Fatalf("NewGraphServer: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+
+	resp := threadResponse(t, post(t, ts.URL+"/invoke", "", ticket{ID: "T-1"}))
+	if resp.Status != server.ThreadInterrupted || resp.Interrupt == nil || resp.Interrupt.NodeName != "review" {
+		t.Fatalf("response = %+v, want interrupted before review", resp)
+	}
+
+	resumed := threadResponse(t, post(t, ts.URL+"/resume?thread_id="+resp.ThreadID, "", ticket{ID: "T-1", Approved: true}))
+	if resumed.ThreadID != resp.ThreadID || resumed.Status != server.ThreadCompleted {
+		t.Fatalf("resumed = %+v, want the same thread completed", resumed)
+	}
+	var state ticket
+	if err := json.Unmarshal(resumed.State, &state); err != nil || !state.Approved {
+		t.Errorf("state = %s, %v, want the edited state", resumed.State, err)
+	}
+
+	// The thread is gone once it completes
+	r, err := http.Post(ts.URL+"/resume?thread_id="+resp.ThreadID, "application/json", strings.NewReader(`{"ID":"T-1"}`))
+	if err != nil {
+		t.Fatalf("POST /resume: %v", err)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusNotFound {
+		t.Errorf("resuming a completed thread = %s, want 404", r.Status)
+	}
+}
+
+func TestGraphServerStructure(t *testing.T) {
+	ts := newGraphServer(t, accountGraph([]core.StreamMode{core.StreamValues}, false))
+
+	status, body := get(t, ts.URL+"/graph")
+	var structure core.GraphStructure
+	if err := json.Unmarshal([]byte(body), &structure); status != http.StatusOK || err != nil {
+		t.Fatalf("GET /graph = %d, %v: %s", status, err, body)
+	}
+	if structure.EntryPoint != "a" || strings.Join(structure.Nodes, ",") != "a,b" {
+		t.Errorf("structure = %+v, want a and b starting at a", structure)
+	}
+
+	status, body = get(t, ts.URL+"/graph?format=mermaid")
+	if status != http.StatusOK || !strings.HasPrefix(body, "flowchart TD") || !strings.Contains(body, `"b"`) {
+		t.Errorf("GET /graph?format=mermaid = %d: %s", status, body)
+	}
+}
@@ -0,0 +1,167 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/server"
+	"github.com/forrestdevs/moego/pkg/tools"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+// newGraphHandler serves the compiled graph with GraphHandler on a test
+// server closed when the test ends
+func newGraphHandler(t *testing.T, g *core.StateGraph[account]) *httptest.Server {
+	t.Helper()
+	runnable, err := g.Compile()
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	ts := httptest.NewServer(server.GraphHandler(runnable))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestRemoteGraphToolInvokes(t *testing.T) {
+	ts := newGraphHandler(t, accountGraph([]core.StreamMode{core.StreamValues}, false))
+	tool := tools.NewRemoteGraphTool(ts.URL)
+
+	result, err := tool.Execute(context.Background(), map[string]interface{}{
+		"state": map[string]interface{}{"name": "ada", "pin": secretPIN},
+	})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	state, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("result = %T, want a JSON object", result)
+	}
+	if state["steps"] != float64(2) {
+		t.Errorf("steps = %v, want 2", state["steps"])
+	}
+	if state["pin"] != core.RedactedValue {
+		t.Errorf("pin = %v, want %s", state["pin"], core.RedactedValue)
+	}
+}
+
+func TestGraphHandlerStreams(t *testing.T) {
+	ts := newGraphHandler(t, accountGraph([]core.StreamMode{core.StreamValues, core.StreamUpdates}, false))
+
+	body := post(t, ts.URL, "text/event-stream", account{Name: "ada", PIN: secretPIN})
+	assertRedacted(t, "GraphHandler stream", body)
+
+	frames := sseFrames(t, body)
+	if len(frames) < 2 {
+		t.Fatalf("got %d frames, want values and an end", len(frames))
+	}
+	if last := frames[len(frames)-1]; last.Kind != wire.KindEnd {
+		t.Errorf("last frame is %s, want %s", last.Kind, wire.KindEnd)
+	}
+	final := frames[len(frames)-2]
+	if final.Kind != wire.KindValues {
+		t.Fatalf("frame before the end is %s, want %s", final.Kind, wire.KindValues)
+	}
+	var state map[string]interface{}
+	if err := json.Unmarshal(final.Payload, &state); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if state["steps"] != float64(2) {
+		t.Errorf("final steps = %v, want 2", state["steps"])
+	}
+}
+
+// failingGraph fails in its only node with an error wrapping ErrInvalidOutput
+func failingGraph() *core.StateGraph[account] {
+	g := core.NewStateGraph[account]()
+	g.AddNode("a", func(ctx context.Context, s account) (account, error) {
+		return s, fmt.Errorf("bad answer: %w", core.ErrInvalidOutput)
+	})
+	g.SetEntryPoint("a")
+	g.AddConditionalEdges("a", func(account) ([]string, error) { return []string{core.END}, nil }, nil)
+	return g
+}
+
+func TestGraphHandlerErrors(t *testing.T) {
+	ts := newGraphHandler(t, failingGraph())
+
+	t.Run("stream", func(t *testing.T) {
+		frames := sseFrames(t, post(t, ts.URL, "text/event-stream", account{Name: "ada"}))
+		if len(frames) == 0 {
+			t.Fatal("no frames streamed")
+		}
+		last := frames[len(frames)-1]
+		if last.Kind != wire.KindError {
+			t.Fatalf("last frame is %s, want %s", last.Kind, wire.KindError)
+		}
+		payload, err := last.Error()
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if err := payload.Err(); !errors.Is(err, core.ErrInvalidOutput) {
+			t.Errorf("error frame = %v, want ErrInvalidOutput", err)
+		}
+	})
+
+	t.Run("tool", func(t *testing.T) {
+		tool := tools.NewRemoteGraphTool(ts.URL)
+		_, err := tool.Execute(context.Background(), map[string]interface{}{
+			"state": map[string]interface{}{"name": "ada"},
+		})
+		if !errors.Is(err, core.ErrInvalidOutput) {
+			t.Errorf("Execute error = %v, want ErrInvalidOutput", err)
+		}
+	})
+}
+
+func TestGraphHandlerKeepsConcurrentRunsApart(t *testing.T) {
+	ts := newGraphHandler(t, accountGraph([]core.StreamMode{core.StreamValues, core.StreamUpdates}, false))
+
+	names := []string{"ada", "grace", "linus", "barbara"}
+	bodies := make([]string, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{"name":"`+name+`"}`))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			req.Header.Set("Accept", "text/event-stream")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			bodies[i], errs[i] = string(body), err
+		}()
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		if errs[i] != nil {
+			t.Fatalf("run of %s: %v", name, errs[i])
+		}
+		for _, frame := range sseFrames(t, bodies[i]) {
+			if frame.Kind != wire.KindValues && frame.Kind != wire.KindUpdates {
+				continue
+			}
+			if !strings.Contains(string(frame.Payload), `"`+name+`"`) {
+				t.Errorf("run of %s got the frame of another run: %s", name, frame.Payload)
+			}
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+// Handler returns an HTTP handler exposing the run manager:
+//
+//	POST   /runs               submit a run, with ?async=true respond 202 immediately
+//	GET    /runs               list all runs
+//	GET    /runs/{id}          get the status and, when done, the final state
+//	POST   /runs/{id}/resume   resume a run awaiting a human with the posted state
+//	GET    /runs/{id}/stream   follow a run as server-sent wire frames
+//	DELETE /runs/{id}          cancel a run
+//	POST   /runs/{id}/feedback record feedback on a node's output, with a
+//	                           feedback store configured
+func (m *RunManager[T]) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", m.handleSubmit)
+	mux.HandleFunc("GET /runs", m.handleList)
+	mux.HandleFunc("GET /runs/{id}", m.handleGet)
+	mux.HandleFunc("POST /runs/{id}/resume", m.handleResume)
+	mux.HandleFunc("GET /runs/{id}/stream", m.handleStream)
+	mux.HandleFunc("DELETE /runs/{id}", m.handleCancel)
+	if m.config.Feedback != nil {
+		mux.HandleFunc("POST /runs/{id}/feedback", m.handleFeedback)
+	}
+	return mux
+}
+
+// GraphPath returns the path prefix a graph's handler is mounted under
+func GraphPath(graphName string) string {
+	return "/graphs/" + graphName
+}
+
+// Mount serves a run manager's handler for the named graph under
+// GraphPath(graphName), which is where clients look for it
+func Mount(mux *http.ServeMux, graphName string, handler http.Handler) {
+	prefix := GraphPath(graphName)
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, handler))
+}
+
+// handleSubmit queues a run. Synchronous submissions wait for the run to
+// finish and respond with its final record.
+func (m *RunManager[T]) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	principal, ok := m.config.Auth.check(w, r, ActionStart, "", "")
+	if !ok {
+		return
+	}
+
+	input, err := decodeBody(r, m.graph.Codec())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	record, err := m.Submit(WithPrincipal(r.Context(), principal), input)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrQueueFull) || errors.Is(err, ErrManagerClosed) {
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	if r.URL.Query().Get("async") == "true" {
+		w.Header().Set("Location", "/runs/"+record.ID)
+		writeJSON(w, http.StatusAccepted, map[string]string{
+			"run_id": record.ID,
+			"status": string(record.Status),
+		})
+		return
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			record, err = m.Get(r.Context(), record.ID)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if record.Status.Finished() {
+				if err := m.redact(record); err != nil {
+					writeError(w, http.StatusInternalServerError, err)
+					return
+				}
+				writeJSON(w, http.StatusOK, record)
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleGet responds with the record of a run
+func (m *RunManager[T]) handleGet(w http.ResponseWriter, r *http.Request) {
+	record, _, ok := m.authorizeRun(w, r, ActionGetState)
+	if !ok {
+		return
+	}
+	if err := m.redact(record); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+// handleList responds with the records of all runs the caller may get the
+// state of. Runs left out aren't audited as denials.
+func (m *RunManager[T]) handleList(w http.ResponseWriter, r *http.Request) {
+	principal, err := m.config.Auth.principal(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	records, err := m.List(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	visible := records[:0]
+	for _, record := range records {
+		if auth := m.config.Auth; auth != nil && auth.Authorizer != nil {
+			ctx := WithThreadOwner(r.Context(), record.Owner)
+			if auth.Authorizer.Authorize(ctx, principal, ActionGetState, auth.GraphName, record.ID) != nil {
+				continue
+			}
+		}
+		if err := m.redact(record); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		visible = append(visible, record)
+	}
+	writeJSON(w, http.StatusOK, visible)
+}
+
+// handleResume resumes a run awaiting a human, recording the caller as the
+// editor of the state
+func (m *RunManager[T]) handleResume(w http.ResponseWriter, r *http.Request) {
+	_, principal, ok := m.authorizeRun(w, r, ActionResume)
+	if !ok {
+		return
+	}
+
+	state, err := decodeBody(r, m.graph.Codec())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := m.Resume(WithPrincipal(r.Context(), principal), r.PathValue("id"), state); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleStream follows a run as server-sent events. A status frame is sent
+// for every status change, then a values frame with the final state and an
+// end frame, or an error frame. Reconnecting clients send Last-Event-ID and
+// numbering continues from there.
+func (m *RunManager[T]) handleStream(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, _, ok := m.authorizeRun(w, r, ActionStream); !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	lastSeq, _ := strconv.ParseUint(strings.TrimSpace(r.Header.Get("Last-Event-ID")), 10, 64)
+	encoder := wire.NewEncoderAfter(id, lastSeq)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	lastSent := time.Now()
+	send := func(kind wire.Kind, payload interface{}) bool {
+		frame, err := encoder.Frame(kind, payload)
+		if err != nil {
+			return false
+		}
+		if err := wire.WriteSSE(w, frame); err != nil {
+			return false
+		}
+		flusher.Flush()
+		lastSent = time.Now()
+		return true
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var lastStatus RunStatus
+	for {
+		record, err := m.Get(r.Context(), id)
+		if err != nil {
+			send(wire.KindError, wire.ErrorPayload{Message: err.Error(), Code: wire.ErrorCode(err)})
+			return
+		}
+		if err := m.redact(record); err != nil {
+			send(wire.KindError, wire.ErrorPayload{Message: err.Error()})
+			return
+		}
+
+		if record.Status != lastStatus {
+			lastStatus = record.Status
+			if !send(wire.KindStatus, record) {
+				return
+			}
+		} else if time.Since(lastSent) >= streamHeartbeatInterval {
+			// Keep idle connections open and show the run is still alive
+			if !send(wire.KindHeartbeat, core.Heartbeat{Elapsed: time.Since(record.UpdatedAt)}) {
+				return
+			}
+		}
+
+		switch record.Status {
+		case StatusCompleted:
+			if send(wire.KindValues, record.State) {
+				send(wire.KindEnd, nil)
+			}
+			return
+		case StatusFailed, StatusCancelled:
+			send(wire.KindError, wire.ErrorPayload{Message: record.Error, Code: record.ErrorCode})
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// streamHeartbeatInterval is how long a run stream may stay silent before a
+// heartbeat frame is sent
+const streamHeartbeatInterval = 10 * time.Second
+
+// handleCancel cancels a run
+func (m *RunManager[T]) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := m.authorizeRun(w, r, ActionAbort); !ok {
+		return
+	}
+	if err := m.Cancel(r.Context(), r.PathValue("id")); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleFeedback records feedback on the output of a node of an existing
+// run, attributed to the caller
+func (m *RunManager[T]) handleFeedback(w http.ResponseWriter, r *http.Request) {
+	record, principal, ok := m.authorizeRun(w, r, ActionFeedback)
+	if !ok {
+		return
+	}
+
+	var feedback core.Feedback
+	if err := json.NewDecoder(r.Body).Decode(&feedback); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid feedback: %w", err))
+		return
+	}
+	feedback.ID = ""
+	feedback.RunID = record.ID
+	feedback.Principal = principal.ID
+	feedback.CreatedAt = time.Time{}
+
+	feedback, err := m.config.Feedback.Record(r.Context(), feedback)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, core.ErrInvalidFeedback) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, feedback)
+}
+
+// authorizeRun loads the run of a request and authorizes the action on it,
+// returning the run and the caller, and writing an error response when
+// either fails
+func (m *RunManager[T]) authorizeRun(w http.ResponseWriter, r *http.Request, action Action) (*RunRecord, Principal, bool) {
+	record, err := m.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return nil, Principal{}, false
+	}
+	principal, ok := m.config.Auth.check(w, r, action, record.ID, record.Owner)
+	if !ok {
+		return nil, Principal{}, false
+	}
+	return record, principal, true
+}
+
+// redact applies the graph's redaction policy to the input and state of a
+// record before it is sent to a client. Stored records keep the real values.
+func (m *RunManager[T]) redact(record *RunRecord) error {
+	for _, raw := range []*json.RawMessage{&record.Input, &record.State} {
+		if len(*raw) == 0 {
+			continue
+		}
+		state, err := core.DecodeState(m.graph.Codec(), *raw)
+		if err != nil {
+			return err
+		}
+		if *raw, err = m.graph.RedactState(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeBody decodes the state posted in a request with the graph's codec
+func decodeBody[T any](r *http.Request, codec core.Codec[T]) (T, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return core.DecodeJSON(codec, data)
+}
+
+// statusFor maps run manager errors to HTTP status codes
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrRunNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrRunFinished), errors.Is(err, ErrRunNotAwaiting), errors.Is(err, core.ErrNotInterrupted):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error as a JSON response. The code lets clients
+// rebuild registered sentinel errors.
+func writeError(w http.ResponseWriter, status int, err error) {
+	body := map[string]string{
+		"error": err.Error(),
+	}
+	if code := wire.ErrorCode(err); code != "" {
+		body["code"] = code
+	}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,233 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/server"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+// account has a redacted field that isn't a string, so a redacted state
+// can't be decoded back
+type account struct {
+	Name  string `json:"name"`
+	PIN   int    `json:"pin" moego:"redact"`
+	Steps int    `json:"steps"`
+}
+
+// secretPIN must never leave the server
+const secretPIN = 48213
+
+// accountGraph counts steps through "a" and "b", optionally pausing before "b"
+func accountGraph(modes []core.StreamMode, breakpoint bool) *core.StateGraph[account] {
+	g := core.NewStateGraph[account]()
+	config := core.DefaultStreamConfig()
+	config.Modes = modes
+	g.SetStreamConfig(config)
+	g.SetRedactionPolicy(&core.RedactionPolicy{})
+	step := func(ctx context.Context, s account) (account, error) {
+		s.Steps++
+		return s, nil
+	}
+	g.AddNode("a", step)
+	g.AddNode("b", step)
+	g.SetEntryPoint("a")
+	g.AddConditionalEdges("a", func(account) ([]string, error) { return []string{"b"}, nil }, nil)
+	g.AddConditionalEdges("b", func(account) ([]string, error) { return []string{core.END}, nil }, nil)
+	if breakpoint {
+		g.AddBreakpoint("b")
+	}
+	return g
+}
+
+// newGraphServer serves the graph on a test server closed when the test ends
+func newGraphServer(t *testing.T, g *core.StateGraph[account]) *httptest.Server {
+	t.Helper()
+	s, err := server.NewGraphServer(g, server.DefaultGraphServerConfig())
+	if err != nil {
+		t.Fatalf("NewGraphServer: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return ts
+}
+
+// post posts the state as JSON and returns the response body
+func post(t *testing.T, url, accept string, state interface{}) string {
+	t.Helper()
+	body, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	var out strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		out.WriteString(scanner.Text())
+		out.WriteString("\n")
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s: %s: %s", url, resp.Status, out.String())
+	}
+	return out.String()
+}
+
+// sseFrames parses the wire frames of a server-sent event stream
+func sseFrames(t *testing.T, body string) []wire.Frame {
+	t.Helper()
+	var frames []wire.Frame
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		frame, err := wire.Unmarshal([]byte(data))
+		if err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// assertRedacted fails when the secret shows up in what was sent
+func assertRedacted(t *testing.T, path, body string) {
+	t.Helper()
+	if strings.Contains(body, "48213") {
+		t.Errorf("%s leaks the redacted PIN: %s", path, body)
+	}
+}
+
+func TestRedactionOnStream(t *testing.T) {
+	g := accountGraph([]core.StreamMode{core.StreamValues, core.StreamUpdates, core.StreamDebug}, false)
+	ts := newGraphServer(t, g)
+
+	body := post(t, ts.URL+"/stream", "text/event-stream", account{Name: "ada", PIN: secretPIN})
+	assertRedacted(t, "/stream", body)
+
+	frames := sseFrames(t, body)
+	var values []json.RawMessage
+	for _, frame := range frames {
+		if frame.Kind == wire.KindValues {
+			values = append(values, frame.Payload)
+		}
+	}
+	if len(values) == 0 {
+		t.Fatal("no values frames streamed")
+	}
+	for i, v := range values[:len(values)-1] {
+		if string(v) == string(values[len(values)-1]) {
+			t.Errorf("final state sent twice, as values frames %d and %d", i+1, len(values))
+		}
+	}
+	if last := frames[len(frames)-1]; last.Kind != wire.KindEnd {
+		t.Errorf("last frame is %s, want %s", last.Kind, wire.KindEnd)
+	}
+}
+
+func TestRedactionOnInvoke(t *testing.T) {
+	g := accountGraph([]core.StreamMode{core.StreamValues}, false)
+	ts := newGraphServer(t, g)
+
+	body := post(t, ts.URL+"/invoke", "", account{Name: "ada", PIN: secretPIN})
+	assertRedacted(t, "/invoke", body)
+	var resp server.ThreadResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !strings.Contains(string(resp.State), core.RedactedValue) {
+		t.Errorf("state = %s, want the PIN replaced by %s", resp.State, core.RedactedValue)
+	}
+}
+
+func TestRedactionOnInterrupt(t *testing.T) {
+	g := accountGraph([]core.StreamMode{core.StreamValues}, true)
+	ts := newGraphServer(t, g)
+
+	body := post(t, ts.URL+"/invoke", "", account{Name: "ada", PIN: secretPIN})
+	assertRedacted(t, "/invoke interrupt", body)
+	var resp server.ThreadResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if resp.Status != server.ThreadInterrupted {
+		t.Fatalf("status = %s, want %s", resp.Status, server.ThreadInterrupted)
+	}
+
+	body = post(t, ts.URL+"/resume?thread_id="+resp.ThreadID, "text/event-stream", account{Name: "ada", PIN: secretPIN, Steps: 1})
+	assertRedacted(t, "/resume", body)
+}
+
+func TestRedactionOnRunRecord(t *testing.T) {
+	g := accountGraph([]core.StreamMode{core.StreamValues}, true)
+	m := newRunManager(t, g, server.DefaultRunManagerConfig())
+	ts := httptest.NewServer(m.Handler())
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	record, err := m.Submit(ctx, account{Name: "ada", PIN: secretPIN})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	waitForStatus(t, m, record.ID, server.StatusAwaitingHuman)
+
+	get := func() string {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/runs/" + record.ID)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		defer resp.Body.Close()
+		var body strings.Builder
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			body.WriteString(scanner.Text())
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /runs/%s: %s: %s", record.ID, resp.Status, body.String())
+		}
+		return body.String()
+	}
+	assertRedacted(t, "GET /runs/{id} while paused", get())
+
+	// The record keeps the paused state, so the run resumes with the PIN
+	paused, err := m.Get(ctx, record.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	state, err := core.DecodeState(g.Codec(), paused.State)
+	if err != nil {
+		t.Fatalf("DecodeState of the paused state: %v", err)
+	}
+	if state.PIN != secretPIN {
+		t.Errorf("stored paused PIN = %d, want %d", state.PIN, secretPIN)
+	}
+
+	if err := m.Resume(ctx, record.ID, state); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	waitForStatus(t, m, record.ID, server.StatusCompleted)
+	assertRedacted(t, "GET /runs/{id} when completed", get())
+}
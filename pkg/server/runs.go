@@ -0,0 +1,569 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+var (
+	// ErrQueueFull is returned when a run is submitted while the queue is full
+	ErrQueueFull = errors.New("run queue full")
+
+	// ErrRunNotFound is returned when a run ID is unknown
+	ErrRunNotFound = errors.New("run not found")
+
+	// ErrRunFinished is returned when cancelling a run that already finished
+	ErrRunFinished = errors.New("run already finished")
+
+	// ErrRunNotAwaiting is returned when resuming a run that isn't awaiting a human
+	ErrRunNotAwaiting = errors.New("run is not awaiting a human")
+
+	// ErrManagerClosed is returned when submitting to a closed run manager
+	ErrManagerClosed = errors.New("run manager closed")
+)
+
+func init() {
+	wire.RegisterErrorCode("queue_full", ErrQueueFull)
+	wire.RegisterErrorCode("run_not_found", ErrRunNotFound)
+	wire.RegisterErrorCode("run_finished", ErrRunFinished)
+	wire.RegisterErrorCode("run_not_awaiting", ErrRunNotAwaiting)
+	wire.RegisterErrorCode("manager_closed", ErrManagerClosed)
+}
+
+// RunStatus is the lifecycle status of a run
+type RunStatus string
+
+const (
+	StatusQueued        RunStatus = "queued"
+	StatusRunning       RunStatus = "running"
+	StatusAwaitingHuman RunStatus = "awaiting_human"
+	StatusFailed        RunStatus = "failed"
+	StatusCompleted     RunStatus = "completed"
+	StatusCancelled     RunStatus = "cancelled"
+)
+
+// Finished reports whether the status is terminal
+func (s RunStatus) Finished() bool {
+	return s == StatusFailed || s == StatusCompleted || s == StatusCancelled
+}
+
+// RunRecord is the persisted record of a run
+type RunRecord struct {
+	ID        string           `json:"id"`
+	Status    RunStatus        `json:"status"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	State     json.RawMessage  `json:"state,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	ErrorCode string           `json:"error_code,omitempty"`
+	Owner     string           `json:"owner,omitempty"`
+	Codec     string           `json:"codec,omitempty"`
+	Edits     []core.StateEdit `json:"edits,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// runNamespace is the store namespace run records are kept under
+const runNamespace = "runs"
+
+// RunManagerConfig contains configuration for a run manager
+type RunManagerConfig struct {
+	// Workers is the number of runs executed concurrently
+	Workers int
+
+	// QueueSize is the number of runs that can wait for a worker
+	QueueSize int
+
+	// Retention is how long finished runs are kept. Zero keeps them forever.
+	Retention time.Duration
+
+	// CleanupInterval is how often expired runs are removed
+	CleanupInterval time.Duration
+
+	// Auth authorizes the operations of the HTTP handler. Nil allows all.
+	Auth *Auth
+
+	// Feedback stores human feedback on the output of runs. Nil disables
+	// the feedback endpoint.
+	Feedback core.FeedbackStore
+}
+
+// DefaultRunManagerConfig returns the default run manager configuration
+func DefaultRunManagerConfig() RunManagerConfig {
+	return RunManagerConfig{
+		Workers:         4,
+		QueueSize:       100,
+		Retention:       24 * time.Hour,
+		CleanupInterval: time.Hour,
+	}
+}
+
+// RunManager executes graph runs asynchronously on a bounded worker pool and
+// persists their records in a core.Store so status survives restarts
+type RunManager[T any] struct {
+	graph    *core.StateGraph[T]
+	runnable *core.RunnableState[T]
+	store    core.Store
+	config   RunManagerConfig
+	logger   core.Logger
+
+	// events carries the lifecycle of this manager's runs
+	events *core.LifecycleBus
+
+	queue chan string
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	closed  bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// drainStop stops draining the graph once all workers have exited
+	drainStop chan struct{}
+	drainWg   sync.WaitGroup
+}
+
+// NewRunManager compiles the graph and starts the worker pool. Runs that were
+// queued when a previous manager stopped are queued again, and runs that were
+// in flight are marked failed. A nil logger discards everything.
+//
+// Wrap the store with core.NewChunkedStore when run state can be large, so
+// records are chunked, deduplicated and verified when they are loaded.
+func NewRunManager[T any](graph *core.StateGraph[T], store core.Store, config RunManagerConfig, logger core.Logger) (*RunManager[T], error) {
+	runnable, err := graph.Compile()
+	if err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = core.NopLogger()
+	}
+
+	config.Auth = config.Auth.forGraph(graph.Structure().Name)
+
+	m := &RunManager[T]{
+		graph:    graph,
+		runnable: runnable,
+		store:    store,
+		config:   config,
+		logger:   logger,
+		events:   core.NewLifecycleBus(0),
+		queue:    make(chan string, config.QueueSize),
+		cancels:  make(map[string]context.CancelFunc),
+		done:     make(chan struct{}),
+
+		drainStop: make(chan struct{}),
+	}
+
+	if err := m.recover(context.Background()); err != nil {
+		return nil, err
+	}
+
+	m.drainWg.Add(1)
+	go m.drainGraph()
+
+	edits, unsubscribe := m.events.Subscribe(core.EventFilter{Types: []core.LifecycleEventType{core.LifecycleStateEdited}})
+	m.wg.Add(1)
+	go m.recordEdits(edits, unsubscribe)
+
+	for i := 0; i < config.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+
+	if config.Retention > 0 && config.CleanupInterval > 0 {
+		m.wg.Add(1)
+		go m.cleanup()
+	}
+
+	return m, nil
+}
+
+// Events returns the bus carrying the lifecycle of the manager's runs, which
+// use the run record ID as run ID. Runs are also published to core.Events.
+func (m *RunManager[T]) Events() *core.LifecycleBus {
+	return m.events
+}
+
+// Submit queues a run with the given input and returns its record. The
+// principal in ctx, if any, is recorded as the owner of the run.
+func (m *RunManager[T]) Submit(ctx context.Context, input T) (*RunRecord, error) {
+	inputJSON, err := core.EncodeState(m.graph.Codec(), input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	now := time.Now()
+	record := &RunRecord{
+		ID:        newRunID(),
+		Status:    StatusQueued,
+		Input:     inputJSON,
+		Owner:     PrincipalFromContext(ctx).ID,
+		Codec:     m.graph.Codec().Name(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrManagerClosed
+	}
+	if err := m.save(ctx, record); err != nil {
+		return nil, err
+	}
+
+	select {
+	case m.queue <- record.ID:
+		return record, nil
+	default:
+		_ = m.store.Delete(ctx, runNamespace, record.ID)
+		return nil, ErrQueueFull
+	}
+}
+
+// Get returns the record of a run
+func (m *RunManager[T]) Get(ctx context.Context, id string) (*RunRecord, error) {
+	data, found, err := m.store.Get(ctx, runNamespace, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load run: %w", err)
+	}
+	if !found {
+		return nil, ErrRunNotFound
+	}
+	var record RunRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run: %w", err)
+	}
+	return &record, nil
+}
+
+// Resume resumes a run that is awaiting a human with the provided state. The
+// principal in ctx, if any, is recorded as the editor when the state differs
+// from the one the run paused with.
+func (m *RunManager[T]) Resume(ctx context.Context, id string, state T) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, err := m.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if record.Status != StatusAwaitingHuman {
+		return fmt.Errorf("%w: run %s is %s", ErrRunNotAwaiting, id, record.Status)
+	}
+	if err := m.graph.ResumeRun(id, state, PrincipalFromContext(ctx).ID); err != nil {
+		return err
+	}
+	return m.update(ctx, record, StatusRunning, nil, nil)
+}
+
+// Cancel cancels a queued or running run
+func (m *RunManager[T]) Cancel(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, err := m.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if record.Status.Finished() {
+		return ErrRunFinished
+	}
+
+	if cancel, ok := m.cancels[id]; ok {
+		cancel()
+	}
+	return m.update(ctx, record, StatusCancelled, nil, context.Canceled)
+}
+
+// Close stops accepting runs, cancels in-flight runs and waits for the
+// workers to exit
+func (m *RunManager[T]) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	for _, cancel := range m.cancels {
+		cancel()
+	}
+	close(m.done)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	close(m.drainStop)
+	m.drainWg.Wait()
+}
+
+// worker executes queued runs until the manager is closed
+func (m *RunManager[T]) worker() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case id := <-m.queue:
+			m.execute(id)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// execute runs a single queued run
+func (m *RunManager[T]) execute(id string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m.mu.Lock()
+	record, err := m.Get(ctx, id)
+	if err != nil || record.Status != StatusQueued {
+		m.mu.Unlock()
+		return
+	}
+	if err := m.update(ctx, record, StatusRunning, nil, nil); err != nil {
+		m.mu.Unlock()
+		m.logger.Error("Failed to start run", "run_id", id, "error", err)
+		return
+	}
+	m.cancels[id] = cancel
+	m.mu.Unlock()
+
+	// Input queued by a manager with a different codec can't be read
+	err = core.CheckCodec(m.graph.Codec(), record.Codec)
+	var input, state T
+	if err == nil {
+		input, err = core.DecodeState(m.graph.Codec(), record.Input)
+	}
+	if err == nil {
+		state, err = m.runnable.InvokeWithConfig(core.WithLifecycleBus(ctx, m.events), input, core.InvokeConfig{RunID: id})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.cancels, id)
+
+	// Reload so a cancellation recorded while running isn't overwritten
+	record, loadErr := m.Get(context.Background(), id)
+	if loadErr != nil || record.Status.Finished() {
+		return
+	}
+
+	status := StatusCompleted
+	var stateJSON json.RawMessage
+	if err != nil {
+		status = StatusFailed
+	} else if stateJSON, err = core.EncodeState(m.graph.Codec(), state); err != nil {
+		status = StatusFailed
+	}
+	if err := m.update(context.Background(), record, status, stateJSON, err); err != nil {
+		m.logger.Error("Failed to record run result", "run_id", id, "error", err)
+	}
+}
+
+// drainGraph consumes the graph's event, stream and interrupt channels so runs
+// never block on them, and marks a run as awaiting a human when it interrupts
+func (m *RunManager[T]) drainGraph() {
+	defer m.drainWg.Done()
+
+	for {
+		select {
+		case <-m.graph.GetEventChannel():
+		case <-m.graph.GetStreamChannel():
+		case info := <-m.graph.GetInterruptChannel():
+			m.markAwaitingHuman(info)
+		case <-m.drainStop:
+			return
+		}
+	}
+}
+
+// recordEdits adds the edits made to paused runs to their records, so the
+// history of a run shows where a human intervened
+func (m *RunManager[T]) recordEdits(edits <-chan core.LifecycleEvent, unsubscribe func()) {
+	defer m.wg.Done()
+	defer unsubscribe()
+
+	for {
+		select {
+		case evt := <-edits:
+			if evt.Edit == nil {
+				continue
+			}
+			m.mu.Lock()
+			ctx := context.Background()
+			record, err := m.Get(ctx, evt.RunID)
+			if err == nil {
+				record.Edits = append(record.Edits, *evt.Edit)
+				err = m.save(ctx, record)
+			}
+			m.mu.Unlock()
+			if err != nil {
+				m.logger.Error("Failed to record state edit", "run_id", evt.RunID, "error", err)
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// markAwaitingHuman records an interrupt against the run that paused
+func (m *RunManager[T]) markAwaitingHuman(info core.InterruptInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cancels[info.RunID]; !ok {
+		m.logger.Warn("Interrupt could not be attributed to a run", "run_id", info.RunID, "node", info.NodeName)
+		return
+	}
+	ctx := context.Background()
+	record, err := m.Get(ctx, info.RunID)
+	if err != nil {
+		return
+	}
+	// info.State is redacted for clients, the record keeps the paused state
+	// so it can be decoded and is redacted when it is read
+	var state json.RawMessage
+	if paused, ok := m.graph.PausedState(info.RunID); ok {
+		if state, err = core.EncodeState(m.graph.Codec(), paused); err != nil {
+			m.logger.Error("Failed to encode paused state", "run_id", info.RunID, "error", err)
+		}
+	}
+	if err := m.update(ctx, record, StatusAwaitingHuman, state, nil); err != nil {
+		m.logger.Error("Failed to record interrupt", "run_id", info.RunID, "error", err)
+	}
+}
+
+// cleanup periodically removes finished runs older than the retention period
+func (m *RunManager[T]) cleanup() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.removeExpired(context.Background()); err != nil {
+				m.logger.Error("Failed to clean up runs", "error", err)
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// removeExpired deletes finished runs older than the retention period
+func (m *RunManager[T]) removeExpired(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records, err := m.list(ctx)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-m.config.Retention)
+	for _, record := range records {
+		if record.Status.Finished() && record.UpdatedAt.Before(cutoff) {
+			if err := m.store.Delete(ctx, runNamespace, record.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recover restores runs left behind by a previous manager
+func (m *RunManager[T]) recover(ctx context.Context) error {
+	records, err := m.list(ctx)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		switch record.Status {
+		case StatusQueued:
+			select {
+			case m.queue <- record.ID:
+			default:
+				if err := m.update(ctx, record, StatusFailed, nil, ErrQueueFull); err != nil {
+					return err
+				}
+			}
+		case StatusRunning, StatusAwaitingHuman:
+			if err := m.update(ctx, record, StatusFailed, nil, errors.New("run interrupted by restart")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the records of all runs
+func (m *RunManager[T]) List(ctx context.Context) ([]*RunRecord, error) {
+	return m.list(ctx)
+}
+
+// list loads every run record
+func (m *RunManager[T]) list(ctx context.Context) ([]*RunRecord, error) {
+	ids, err := m.store.List(ctx, runNamespace, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	records := make([]*RunRecord, 0, len(ids))
+	for _, id := range ids {
+		record, err := m.Get(ctx, id)
+		if errors.Is(err, ErrRunNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// update sets the status of a run and persists it
+func (m *RunManager[T]) update(ctx context.Context, record *RunRecord, status RunStatus, state json.RawMessage, runErr error) error {
+	record.Status = status
+	record.UpdatedAt = time.Now()
+	if state != nil {
+		record.State = state
+	}
+	if runErr != nil {
+		record.Error = runErr.Error()
+		record.ErrorCode = wire.ErrorCode(runErr)
+	}
+	return m.save(ctx, record)
+}
+
+// save persists a run record
+func (m *RunManager[T]) save(ctx context.Context, record *RunRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	if err := m.store.Put(ctx, runNamespace, record.ID, data); err != nil {
+		return fmt.Errorf("failed to save run: %w", err)
+	}
+	return nil
+}
+
+// newRunID returns a random run ID
+func newRunID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "run-" + time.Now().Format("20060102150405.000000000")
+	}
+	return "run-" + hex.EncodeToString(b)
+}
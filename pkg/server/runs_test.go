@@ -0,0 +1,131 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/server"
+)
+
+type ticket struct {
+	ID       string
+	Approved bool
+}
+
+// reviewGraph pauses every run before its "review" node
+func reviewGraph() *core.StateGraph[ticket] {
+	g := core.NewStateGraph[ticket]()
+	g.AddNode("review", func(ctx context.Context, s ticket) (ticket, error) {
+		return s, nil
+	})
+	g.SetEntryPoint("review")
+	g.AddConditionalEdges("review", func(ticket) ([]string, error) {
+		return []string{core.END}, nil
+	}, nil)
+	g.AddBreakpoint("review")
+	return g
+}
+
+// newRunManager starts a run manager on an in-memory store, closed when the
+// test ends
+func newRunManager[T any](t *testing.T, g *core.StateGraph[T], config server.RunManagerConfig) *server.RunManager[T] {
+	t.Helper()
+	m, err := server.NewRunManager(g, core.NewMemoryStore(), config, nil)
+	if err != nil {
+		t.Fatalf("NewRunManager: %v", err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+// waitForStatus polls the run until it has the status
+func waitForStatus[T any](t *testing.T, m *server.RunManager[T], id string, status server.RunStatus) *server.RunRecord {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		record, err := m.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", id, err)
+		}
+		if record.Status == status {
+			return record
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %s is %s, want %s", id, record.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConcurrentRunsAwaitingHuman(t *testing.T) {
+	g := reviewGraph()
+	m := newRunManager(t, g, server.DefaultRunManagerConfig())
+	ctx := context.Background()
+
+	ids := make(map[string]string)
+	for _, name := range []string{"a", "b", "c"} {
+		record, err := m.Submit(ctx, ticket{ID: name})
+		if err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+		ids[name] = record.ID
+	}
+	for _, id := range ids {
+		waitForStatus(t, m, id, server.StatusAwaitingHuman)
+	}
+
+	for name, id := range ids {
+		if err := m.Resume(ctx, id, ticket{ID: name, Approved: true}); err != nil {
+			t.Fatalf("Resume(%s): %v", id, err)
+		}
+	}
+	for name, id := range ids {
+		record := waitForStatus(t, m, id, server.StatusCompleted)
+		out, err := core.DecodeState(g.Codec(), record.State)
+		if err != nil {
+			t.Fatalf("DecodeState: %v", err)
+		}
+		if out.ID != name || !out.Approved {
+			t.Errorf("run %s finished with %+v, want ticket %s approved", id, out, name)
+		}
+	}
+}
+
+func TestFailedResumeKeepsRunAwaiting(t *testing.T) {
+	release := make(chan struct{})
+	g := reviewGraph()
+	g.AddNode("review", func(ctx context.Context, s ticket) (ticket, error) {
+		<-release
+		return s, nil
+	})
+	m := newRunManager(t, g, server.DefaultRunManagerConfig())
+	ctx := context.Background()
+
+	record, err := m.Submit(ctx, ticket{ID: "a"})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	waitForStatus(t, m, record.ID, server.StatusAwaitingHuman)
+
+	// Resume the graph behind the manager's back, so the manager's own
+	// resume finds nothing paused
+	if err := g.ResumeRun(record.ID, ticket{ID: "a"}, ""); err != nil {
+		t.Fatalf("ResumeRun: %v", err)
+	}
+	if err := m.Resume(ctx, record.ID, ticket{}); !errors.Is(err, core.ErrNotInterrupted) {
+		t.Fatalf("Resume = %v, want ErrNotInterrupted", err)
+	}
+	got, err := m.Get(ctx, record.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Status != server.StatusAwaitingHuman {
+		t.Errorf("status after failed resume = %s, want %s", got.Status, server.StatusAwaitingHuman)
+	}
+
+	close(release)
+	waitForStatus(t, m, record.ID, server.StatusCompleted)
+}
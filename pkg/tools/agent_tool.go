@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/forrestdevs/moego/pkg/agent"
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// AgentTool is a tool that delegates to another agent, so agents can be
+// arranged hierarchically using the regular tool mechanism
+type AgentTool struct {
+	core.BaseTool
+	agent agent.Agent
+}
+
+// NewAgentTool creates a tool with the given name and description that sends
+// its input to the agent and returns the agent's reply
+func NewAgentTool(name, description string, a agent.Agent) *AgentTool {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"input": map[string]interface{}{
+				"type":        "string",
+				"description": "The request to send to the agent",
+			},
+		},
+		"required": []string{"input"},
+	}
+
+	return &AgentTool{
+		BaseTool: *core.NewBaseTool(name, description, schema),
+		agent:    a,
+	}
+}
+
+// Execute sends the input to the wrapped agent and returns its last reply
+func (t *AgentTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	input, err := getString(args, "input", true)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := t.agent.ProcessMessage(ctx, core.Message{
+		Role:    core.RoleUser,
+		Content: input,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: %w", t.agent.ID(), err)
+	}
+
+	for i := len(responses) - 1; i >= 0; i-- {
+		if strings.TrimSpace(responses[i].Content) != "" {
+			return responses[i].Content, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", agent.ErrEmptyReply, t.agent.ID())
+}
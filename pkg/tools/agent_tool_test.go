@@ -0,0 +1,45 @@
+package tools_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/tools"
+)
+
+// expertAgent answers every question and remembers what it was asked
+type expertAgent struct {
+	asked []core.Message
+}
+
+func (a *expertAgent) ID() string                                    { return "math_expert" }
+func (a *expertAgent) Configure(config map[string]interface{}) error { return nil }
+func (a *expertAgent) AddTool(tool core.Tool)                        {}
+
+func (a *expertAgent) ProcessMessage(ctx context.Context, msg core.Message) ([]core.Message, error) {
+	a.asked = append(a.asked, msg)
+	return []core.Message{
+		{Role: core.RoleAssistant, Content: "let me think"},
+		{Role: core.RoleAssistant, Content: "it is 4"},
+	}, nil
+}
+
+func TestAgentToolRoutesThroughAgent(t *testing.T) {
+	expert := &expertAgent{}
+	tool := tools.NewAgentTool("ask_math_expert", "Ask the math expert", expert)
+
+	if err := tool.Validate(map[string]interface{}{}); err == nil {
+		t.Error("schema accepted arguments without input")
+	}
+	result, err := tool.Execute(context.Background(), map[string]interface{}{"input": "what is 2+2?"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result != "it is 4" {
+		t.Errorf("result = %v, want the agent's last reply", result)
+	}
+	if len(expert.asked) != 1 || expert.asked[0].Role != core.RoleUser || expert.asked[0].Content != "what is 2+2?" {
+		t.Errorf("agent was asked %+v, want the input as a user message", expert.asked)
+	}
+}
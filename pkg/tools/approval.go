@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// ApprovalRequest is the interrupt data of a tool call waiting for a human.
+// Approve or deny it by Key, then resume the run: the node runs again and
+// the repeated call gets the human's decision.
+type ApprovalRequest struct {
+	// Key identifies the call by tool and arguments
+	Key string `json:"key"`
+
+	Tool string                 `json:"tool"`
+	Args map[string]interface{} `json:"args,omitempty"`
+
+	// Rule is the policy rule that asked, empty for the policy default
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// humanDecision is a human's answer to an approval request
+type humanDecision struct {
+	approved bool
+	reason   string
+}
+
+// ApprovalTool wraps a tool so calls need approval. A policy lets low-risk
+// calls run and refuses forbidden ones without pausing; only calls the
+// policy asks about interrupt the run. Without a policy every call asks.
+type ApprovalTool struct {
+	tool   core.Tool
+	policy *core.ApprovalPolicy
+
+	mu        sync.Mutex
+	decisions map[string]humanDecision
+}
+
+// ApprovalOption configures an ApprovalTool
+type ApprovalOption func(*ApprovalTool)
+
+// WithApprovalPolicy sets the policy deciding calls before a human is asked
+func WithApprovalPolicy(policy *core.ApprovalPolicy) ApprovalOption {
+	return func(t *ApprovalTool) {
+		t.policy = policy
+	}
+}
+
+// NewApprovalTool wraps a tool so its calls need approval
+func NewApprovalTool(tool core.Tool, opts ...ApprovalOption) *ApprovalTool {
+	t := &ApprovalTool{tool: tool, decisions: make(map[string]humanDecision)}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Name returns the name of the wrapped tool
+func (t *ApprovalTool) Name() string {
+	return t.tool.Name()
+}
+
+// Description returns the description of the wrapped tool
+func (t *ApprovalTool) Description() string {
+	return t.tool.Description()
+}
+
+// JSONSchema returns the parameters of the wrapped tool
+func (t *ApprovalTool) JSONSchema() map[string]interface{} {
+	return t.tool.JSONSchema()
+}
+
+// Validate validates arguments with the wrapped tool
+func (t *ApprovalTool) Validate(args map[string]interface{}) error {
+	return t.tool.Validate(args)
+}
+
+// Approve lets the call of an approval request run when it is repeated
+func (t *ApprovalTool) Approve(key string) {
+	t.decide(key, humanDecision{approved: true})
+}
+
+// Deny refuses the call of an approval request when it is repeated, telling
+// the model the reason
+func (t *ApprovalTool) Deny(key, reason string) {
+	t.decide(key, humanDecision{reason: reason})
+}
+
+// decide records a human decision
+func (t *ApprovalTool) decide(key string, decision humanDecision) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.decisions[key] = decision
+}
+
+// take returns and forgets the human decision on a call, if any
+func (t *ApprovalTool) take(key string) (humanDecision, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	decision, ok := t.decisions[key]
+	delete(t.decisions, key)
+	return decision, ok
+}
+
+// Execute runs the call when it is allowed, returns a refusal to the model
+// when it is denied, and otherwise interrupts the run with an
+// ApprovalRequest. Every decision is logged and emitted as an
+// EventApprovalDecision with the rule that made it.
+func (t *ApprovalTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	key, err := core.CanonicalHash(map[string]interface{}{"tool": t.Name(), "args": args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to identify call: %w", err)
+	}
+
+	var result core.ApprovalResult
+	if human, ok := t.take(key); ok {
+		result = core.ApprovalResult{Decision: core.ApprovalAllow, Rule: "human", Reason: human.reason}
+		if !human.approved {
+			result.Decision = core.ApprovalDeny
+		}
+	} else if t.policy != nil {
+		result = t.policy.Evaluate(core.ApprovalCall{
+			Tool:     t.Name(),
+			Args:     args,
+			Metadata: runMetadata(ctx),
+		})
+	} else {
+		result = core.ApprovalResult{Decision: core.ApprovalAsk}
+	}
+	t.record(ctx, key, result)
+
+	switch result.Decision {
+	case core.ApprovalAllow:
+		return t.tool.Execute(ctx, args)
+	case core.ApprovalDeny:
+		reason := result.Reason
+		if reason == "" {
+			reason = "not allowed by policy"
+		}
+		return fmt.Sprintf("The call to %s was denied: %s. Do not retry it.", t.Name(), reason), nil
+	}
+	return nil, core.InterruptTyped(ctx, ApprovalRequest{
+		Key:    key,
+		Tool:   t.Name(),
+		Args:   args,
+		Rule:   result.Rule,
+		Reason: result.Reason,
+	})
+}
+
+// record logs a decision and emits it as an event
+func (t *ApprovalTool) record(ctx context.Context, key string, result core.ApprovalResult) {
+	core.LoggerFromContext(ctx).Info("Tool call approval decided",
+		"tool", t.Name(),
+		"decision", result.Decision,
+		"rule", result.Rule,
+		"key", key)
+	core.EmitEvent(ctx, core.Event{
+		Type:      core.EventApprovalDecision,
+		Name:      t.Name(),
+		RunID:     core.RunIDFromContext(ctx),
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"decision": string(result.Decision),
+			"rule":     result.Rule,
+			"reason":   result.Reason,
+			"key":      key,
+		},
+	})
+}
+
+// runMetadata describes the run of ctx for policy conditions
+func runMetadata(ctx context.Context) map[string]interface{} {
+	metadata := make(map[string]interface{})
+	if runID := core.RunIDFromContext(ctx); runID != "" {
+		metadata["run_id"] = runID
+	}
+	if locale := core.LocaleFromContext(ctx); locale != "" {
+		metadata["locale"] = locale
+	}
+	if variant := core.VariantFromContext(ctx); variant != "" {
+		metadata["variant"] = variant
+	}
+	return metadata
+}
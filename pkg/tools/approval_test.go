@@ -0,0 +1,76 @@
+package tools_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/tools"
+)
+
+// paymentTool counts the payments it sends
+type paymentTool struct {
+	sent int
+}
+
+func (p *paymentTool) Name() string        { return "send_payment" }
+func (p *paymentTool) Description() string { return "Send a payment" }
+func (p *paymentTool) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (p *paymentTool) Validate(args map[string]interface{}) error { return nil }
+func (p *paymentTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	p.sent++
+	return "sent", nil
+}
+
+func TestApprovalToolFollowsPolicy(t *testing.T) {
+	policy, err := core.ParseApprovalPolicy([]byte(`
+rules:
+  - name: small
+    when: [{arg: amount, op: lt, value: 50}]
+    decision: allow
+  - name: huge
+    when: [{arg: amount, op: gte, value: 10000}]
+    decision: deny
+    reason: over the limit
+`))
+	if err != nil {
+		t.Fatalf("ParseApprovalPolicy: %v", err)
+	}
+	payments := &paymentTool{}
+	tool := tools.NewApprovalTool(payments, tools.WithApprovalPolicy(policy))
+	ctx := context.Background()
+
+	if result, err := tool.Execute(ctx, map[string]interface{}{"amount": 20}); err != nil || result != "sent" || payments.sent != 1 {
+		t.Errorf("small payment = %v, %v, want it sent without asking", result, err)
+	}
+
+	result, err := tool.Execute(ctx, map[string]interface{}{"amount": 20000})
+	if err != nil || !strings.Contains(result.(string), "over the limit") {
+		t.Errorf("huge payment = %v, %v, want a refusal with the rule's reason", result, err)
+	}
+	if payments.sent != 1 {
+		t.Error("a denied payment was sent")
+	}
+
+	medium := map[string]interface{}{"amount": 500}
+	_, err = tool.Execute(ctx, medium)
+	data, ok := core.GetInterruptData(err)
+	if !ok {
+		t.Fatalf("medium payment = %v, want an interrupt asking a human", err)
+	}
+	request := data.(tools.ApprovalRequest)
+	if request.Tool != "send_payment" || request.Key == "" || payments.sent != 1 {
+		t.Errorf("approval request = %+v, want one for send_payment", request)
+	}
+
+	tool.Approve(request.Key)
+	if result, err := tool.Execute(ctx, medium); err != nil || result != "sent" || payments.sent != 2 {
+		t.Errorf("approved payment = %v, %v, want it sent", result, err)
+	}
+	if _, err := tool.Execute(ctx, medium); !core.IsInterruptError(err) {
+		t.Errorf("repeating the approved payment = %v, want to ask again", err)
+	}
+}
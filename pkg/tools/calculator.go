@@ -3,12 +3,15 @@ package tools
 import (
 	"context"
 	"fmt"
+	"math"
 	"strconv"
 
 	"github.com/forrestdevs/moego/pkg/core"
 )
 
-// Calculator is a tool for performing basic math operations
+// Calculator is a tool for performing basic math operations. Numbers are
+// float64, so results are exact only up to about 15 significant digits, and
+// results too large to represent are reported as errors instead of Inf.
 type Calculator struct {
 	core.BaseTool
 }
@@ -46,14 +49,29 @@ func NewCalculator() *Calculator {
 
 // Execute runs the calculator with the given arguments
 func (c *Calculator) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	result, err := c.calculate(args)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(result) {
+		return nil, fmt.Errorf("result is not a number")
+	}
+	if math.IsInf(result, 0) {
+		return nil, fmt.Errorf("result overflows float64 (%v)", result)
+	}
+	return result, nil
+}
+
+// calculate performs the operation without checking the result
+func (c *Calculator) calculate(args map[string]interface{}) (float64, error) {
 	operation, ok := args["operation"].(string)
 	if !ok {
-		return nil, fmt.Errorf("operation must be a string")
+		return 0, fmt.Errorf("operation must be a string")
 	}
 
 	a, err := getNumber(args["a"])
 	if err != nil {
-		return nil, fmt.Errorf("invalid first number: %w", err)
+		return 0, fmt.Errorf("invalid first number: %w", err)
 	}
 
 	switch operation {
@@ -63,7 +81,7 @@ func (c *Calculator) Execute(ctx context.Context, args map[string]interface{}) (
 
 	b, err := getNumber(args["b"])
 	if err != nil {
-		return nil, fmt.Errorf("invalid second number: %w", err)
+		return 0, fmt.Errorf("invalid second number: %w", err)
 	}
 
 	switch operation {
@@ -75,16 +93,28 @@ func (c *Calculator) Execute(ctx context.Context, args map[string]interface{}) (
 		return a * b, nil
 	case "divide":
 		if b == 0 {
-			return nil, fmt.Errorf("division by zero")
+			return 0, fmt.Errorf("division by zero")
 		}
 		return a / b, nil
 	default:
-		return nil, fmt.Errorf("unknown operation: %s", operation)
+		return 0, fmt.Errorf("unknown operation: %s", operation)
 	}
 }
 
-// getNumber converts an interface{} to a float64
+// getNumber converts an interface{} to a finite float64
 func getNumber(v interface{}) (float64, error) {
+	n, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("number must be finite, got %v", n)
+	}
+	return n, nil
+}
+
+// toFloat converts an interface{} to a float64
+func toFloat(v interface{}) (float64, error) {
 	switch v := v.(type) {
 	case float64:
 		return v, nil
@@ -0,0 +1,38 @@
+package tools_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/forrestdevs/moego/pkg/tools"
+)
+
+func TestCalculatorRejectsNonFiniteResults(t *testing.T) {
+	calc := tools.NewCalculator()
+	for _, tt := range []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"division to Inf", map[string]interface{}{"operation": "divide", "a": math.MaxFloat64, "b": 1e-300}, "overflows"},
+		{"multiply to Inf", map[string]interface{}{"operation": "multiply", "a": 1e200, "b": 1e200}, "overflows"},
+		{"negative overflow", map[string]interface{}{"operation": "multiply", "a": -1e200, "b": 1e200}, "overflows"},
+		{"division by zero", map[string]interface{}{"operation": "divide", "a": 1.0, "b": 0.0}, "division by zero"},
+		{"NaN input", map[string]interface{}{"operation": "add", "a": "NaN", "b": 1.0}, "finite"},
+		{"Inf input", map[string]interface{}{"operation": "square", "a": "Inf"}, "finite"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calc.Execute(context.Background(), tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Execute = %v, %v, want an error about %q", result, err, tt.want)
+			}
+		})
+	}
+
+	result, err := calc.Execute(context.Background(), map[string]interface{}{"operation": "divide", "a": 1.0, "b": 4.0})
+	if err != nil || result != 0.25 {
+		t.Errorf("1 / 4 = %v, %v, want 0.25", result, err)
+	}
+}
@@ -0,0 +1,572 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// Supported code runner languages
+const (
+	LanguagePython = "python"
+	LanguageGo     = "go"
+)
+
+// Kill reasons reported when a run is stopped by a resource limit
+const (
+	KillReasonTimeout     = "timeout"
+	KillReasonCPULimit    = "cpu_limit"
+	KillReasonMemoryLimit = "memory_limit"
+)
+
+// CodeRequest is a request to execute a code snippet
+type CodeRequest struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+	Stdin    string `json:"stdin,omitempty"`
+}
+
+// CodeFile is a file produced by a code run
+type CodeFile struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// CodeResult is the outcome of a code run
+type CodeResult struct {
+	Stdout   string     `json:"stdout"`
+	Stderr   string     `json:"stderr"`
+	ExitCode int        `json:"exit_code"`
+	Files    []CodeFile `json:"files,omitempty"`
+
+	// Killed is true when the run was stopped by a resource limit rather
+	// than exiting on its own
+	Killed bool `json:"killed"`
+
+	// KillReason is one of the KillReason constants when Killed is true
+	KillReason string `json:"kill_reason,omitempty"`
+
+	// OutputTruncated is true when stdout or stderr exceeded the output cap
+	OutputTruncated bool `json:"output_truncated,omitempty"`
+}
+
+// CodeRunner executes code snippets
+type CodeRunner interface {
+	Run(ctx context.Context, req CodeRequest) (*CodeResult, error)
+}
+
+// CodeRunnerTool is a tool that executes generated code through a CodeRunner
+type CodeRunnerTool struct {
+	core.BaseTool
+	runner CodeRunner
+}
+
+// NewCodeRunnerTool creates a new code runner tool backed by the given runner
+func NewCodeRunnerTool(runner CodeRunner) *CodeRunnerTool {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"language": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{LanguagePython, LanguageGo},
+				"description": "The language of the code snippet",
+			},
+			"code": map[string]interface{}{
+				"type":        "string",
+				"description": "The source code to execute. Go code must be a complete main package",
+			},
+			"stdin": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional input passed to the program on stdin",
+			},
+		},
+		"required": []string{"language", "code"},
+	}
+
+	return &CodeRunnerTool{
+		BaseTool: *core.NewBaseTool(
+			"code_runner",
+			"Executes a Python or Go snippet in a sandbox and returns stdout, stderr, exit code and produced files",
+			schema,
+		),
+		runner: runner,
+	}
+}
+
+// Execute runs the code snippet with the given arguments
+func (t *CodeRunnerTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	language, ok := args["language"].(string)
+	if !ok {
+		return nil, fmt.Errorf("language must be a string")
+	}
+	if language != LanguagePython && language != LanguageGo {
+		return nil, fmt.Errorf("unsupported language: %s", language)
+	}
+
+	code, ok := args["code"].(string)
+	if !ok {
+		return nil, fmt.Errorf("code must be a string")
+	}
+
+	var stdin string
+	if v, exists := args["stdin"]; exists && v != nil {
+		if stdin, ok = v.(string); !ok {
+			return nil, fmt.Errorf("stdin must be a string")
+		}
+	}
+
+	return t.runner.Run(ctx, CodeRequest{
+		Language: language,
+		Code:     code,
+		Stdin:    stdin,
+	})
+}
+
+// SubprocessRunnerConfig contains resource limits for the subprocess runner
+type SubprocessRunnerConfig struct {
+	// Timeout is the wall clock limit for a run
+	Timeout time.Duration
+
+	// CPUSeconds is the CPU time limit for a run
+	CPUSeconds int
+
+	// MemoryBytes is the address space limit for a run
+	MemoryBytes int64
+
+	// MaxOutputBytes caps stdout and stderr individually
+	MaxOutputBytes int
+
+	// MaxFileBytes caps the content returned for each produced file
+	MaxFileBytes int64
+
+	// MaxFiles caps the number of produced files returned
+	MaxFiles int
+
+	// PythonPath is the python interpreter to use
+	PythonPath string
+
+	// GoPath is the go toolchain binary to use
+	GoPath string
+
+	// GoCacheDir is the build cache shared by Go compiles, so the standard
+	// library isn't rebuilt for every run
+	GoCacheDir string
+}
+
+// DefaultSubprocessRunnerConfig returns conservative default limits
+func DefaultSubprocessRunnerConfig() SubprocessRunnerConfig {
+	return SubprocessRunnerConfig{
+		Timeout:        10 * time.Second,
+		CPUSeconds:     5,
+		MemoryBytes:    256 << 20,
+		MaxOutputBytes: 64 << 10,
+		MaxFileBytes:   64 << 10,
+		MaxFiles:       16,
+		PythonPath:     "python3",
+		GoPath:         "go",
+		GoCacheDir:     defaultGoCacheDir(),
+	}
+}
+
+// defaultGoCacheDir returns the Go build cache of the runner under the
+// user's cache directory
+func defaultGoCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "moego", "go-build")
+}
+
+// SubprocessRunner executes code as a local subprocess in a temporary directory.
+// CPU and memory limits are applied with ulimit and networking is disabled
+// with a private network namespace where the platform supports it.
+type SubprocessRunner struct {
+	config SubprocessRunnerConfig
+}
+
+// NewSubprocessRunner creates a new subprocess runner. Zero fields of the
+// config take their DefaultSubprocessRunnerConfig values.
+func NewSubprocessRunner(config SubprocessRunnerConfig) *SubprocessRunner {
+	return &SubprocessRunner{config: config.withDefaults()}
+}
+
+// withDefaults fills the zero fields with the default configuration
+func (c SubprocessRunnerConfig) withDefaults() SubprocessRunnerConfig {
+	defaults := DefaultSubprocessRunnerConfig()
+	if c.Timeout <= 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.CPUSeconds <= 0 {
+		c.CPUSeconds = defaults.CPUSeconds
+	}
+	if c.MemoryBytes <= 0 {
+		c.MemoryBytes = defaults.MemoryBytes
+	}
+	if c.MaxOutputBytes <= 0 {
+		c.MaxOutputBytes = defaults.MaxOutputBytes
+	}
+	if c.MaxFileBytes <= 0 {
+		c.MaxFileBytes = defaults.MaxFileBytes
+	}
+	if c.MaxFiles <= 0 {
+		c.MaxFiles = defaults.MaxFiles
+	}
+	if c.PythonPath == "" {
+		c.PythonPath = defaults.PythonPath
+	}
+	if c.GoPath == "" {
+		c.GoPath = defaults.GoPath
+	}
+	if c.GoCacheDir == "" {
+		c.GoCacheDir = defaults.GoCacheDir
+	}
+	return c
+}
+
+// Run executes the request in a fresh temporary directory
+func (r *SubprocessRunner) Run(ctx context.Context, req CodeRequest) (*CodeResult, error) {
+	dir, err := os.MkdirTemp("", "moego-code-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	var argv []string
+	skip := make(map[string]struct{})
+
+	switch req.Language {
+	case LanguagePython:
+		src := filepath.Join(dir, "main.py")
+		if err := os.WriteFile(src, []byte(req.Code), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write source: %w", err)
+		}
+		skip["main.py"] = struct{}{}
+		argv = []string{r.config.PythonPath, src}
+
+	case LanguageGo:
+		// The compiler runs in the sandbox with the program's environment,
+		// but not under the memory limit since the Go toolchain reserves far
+		// more address space than it uses
+		src := filepath.Join(dir, "main.go")
+		if err := os.WriteFile(src, []byte(req.Code), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write source: %w", err)
+		}
+		bin := filepath.Join(dir, "main")
+		buildArgs := r.sandboxArgs([]string{r.config.GoPath, "build", "-o", bin, src})
+		build := exec.CommandContext(ctx, buildArgs[0], buildArgs[1:]...)
+		build.Dir = dir
+		// The toolchain keeps its telemetry under HOME, so it gets one
+		// next to the cache instead of the work dir
+		build.Env = []string{
+			"PATH=" + os.Getenv("PATH"),
+			"HOME=" + filepath.Join(r.config.GoCacheDir, "home"),
+			"TMPDIR=" + dir,
+			"GOCACHE=" + r.config.GoCacheDir,
+			"GOPATH=" + filepath.Join(r.config.GoCacheDir, "gopath"),
+			"GOFLAGS=",
+			"GOPROXY=off",
+			"GOTOOLCHAIN=local",
+			"CGO_ENABLED=0",
+		}
+		stderr := &limitedBuffer{limit: r.config.MaxOutputBytes}
+		build.Stderr = stderr
+		if err := build.Run(); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return &CodeResult{Stderr: stderr.String(), ExitCode: -1, Killed: true, KillReason: KillReasonTimeout}, nil
+			}
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return &CodeResult{Stderr: stderr.String(), ExitCode: exitErr.ExitCode()}, nil
+			}
+			return nil, fmt.Errorf("failed to build go code: %w", err)
+		}
+		skip["main.go"] = struct{}{}
+		skip["main"] = struct{}{}
+		argv = []string{bin}
+
+	default:
+		return nil, fmt.Errorf("unsupported language: %s", req.Language)
+	}
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", r.limitScript(), "sandbox"}, r.sandboxArgs(argv)...)...)
+	cmd.Dir = dir
+	cmd.Env = sandboxEnv(dir)
+	cmd.Stdin = bytes.NewBufferString(req.Stdin)
+
+	stdout := &limitedBuffer{limit: r.config.MaxOutputBytes}
+	stderr := &limitedBuffer{limit: r.config.MaxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	result := &CodeResult{}
+	runErr := cmd.Run()
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) && ctx.Err() == nil {
+			return nil, fmt.Errorf("failed to run code: %w", runErr)
+		}
+		if exitErr != nil {
+			result.ExitCode = exitErr.ExitCode()
+		} else {
+			result.ExitCode = -1
+		}
+
+		if ctx.Err() == context.DeadlineExceeded {
+			result.Killed = true
+			result.KillReason = KillReasonTimeout
+		} else if reason := limitKillReason(exitErr, result.Stderr, time.Duration(r.config.CPUSeconds)*time.Second); reason != "" {
+			result.Killed = true
+			result.KillReason = reason
+		}
+	}
+
+	result.OutputTruncated = stdout.truncated || stderr.truncated
+
+	files, err := r.collectFiles(dir, skip)
+	if err != nil {
+		return nil, err
+	}
+	result.Files = files
+
+	return result, nil
+}
+
+// limitScript returns the shell prelude that applies resource limits before
+// exec'ing the program passed as positional arguments
+func (r *SubprocessRunner) limitScript() string {
+	script := ""
+	if r.config.CPUSeconds > 0 {
+		// The soft limit delivers SIGXCPU, the hard limit is a SIGKILL
+		// backstop. The soft limit goes first since a hard limit below the
+		// current soft one is rejected.
+		script += fmt.Sprintf("ulimit -S -t %d 2>/dev/null; ulimit -H -t %d 2>/dev/null; ", r.config.CPUSeconds, r.config.CPUSeconds+1)
+	}
+	if r.config.MemoryBytes > 0 {
+		// The data segment limit is used rather than address space since the
+		// Go runtime reserves large address ranges up front
+		script += fmt.Sprintf("ulimit -d %d 2>/dev/null; ", r.config.MemoryBytes/1024)
+	}
+	return script + `exec "$@"`
+}
+
+// sandboxEnv returns the environment of sandboxed processes, which only
+// keeps the runner's PATH and uses the work dir as home and temporary dir
+func sandboxEnv(dir string) []string {
+	return []string{"PATH=" + os.Getenv("PATH"), "HOME=" + dir, "TMPDIR=" + dir}
+}
+
+// sandboxArgs wraps argv so that it runs without network access when the
+// platform provides a way to do so
+func (r *SubprocessRunner) sandboxArgs(argv []string) []string {
+	if runtime.GOOS != "linux" {
+		return argv
+	}
+	unshare, err := exec.LookPath("unshare")
+	if err != nil {
+		return argv
+	}
+	// Probe that an unprivileged network namespace can be created
+	if err := exec.Command(unshare, "-rn", "true").Run(); err != nil {
+		return argv
+	}
+	return append([]string{unshare, "-rn"}, argv...)
+}
+
+// collectFiles returns the files the program left in dir, size capped
+func (r *SubprocessRunner) collectFiles(dir string, skip map[string]struct{}) ([]CodeFile, error) {
+	var files []CodeFile
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := skip[rel]; ok {
+			return nil
+		}
+		if r.config.MaxFiles > 0 && len(files) >= r.config.MaxFiles {
+			return filepath.SkipAll
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		content, err := io.ReadAll(io.LimitReader(f, r.config.MaxFileBytes))
+		if err != nil {
+			return err
+		}
+		files = append(files, CodeFile{
+			Name:      rel,
+			Size:      info.Size(),
+			Content:   string(content),
+			Truncated: info.Size() > int64(len(content)),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect produced files: %w", err)
+	}
+	return files, nil
+}
+
+// outOfMemoryMarkers are stderr fragments printed by the supported runtimes
+// when an allocation fails under the memory limit
+var outOfMemoryMarkers = []string{
+	"MemoryError",
+	"fatal error: runtime: out of memory",
+	"fatal error: out of memory",
+}
+
+// isOutOfMemory reports whether stderr shows the program ran out of memory
+func isOutOfMemory(stderr string) bool {
+	for _, marker := range outOfMemoryMarkers {
+		if strings.Contains(stderr, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBuffer is a writer that keeps at most limit bytes
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit > 0 {
+		remaining := b.limit - b.buf.Len()
+		if remaining <= 0 {
+			b.truncated = true
+			return n, nil
+		}
+		if len(p) > remaining {
+			p = p[:remaining]
+			b.truncated = true
+		}
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// RemoteRunner executes code by posting it to a user-provided execution service.
+// The service receives a CodeRequest as JSON and must respond with a CodeResult.
+// The content of returned files is capped like that of the subprocess runner.
+type RemoteRunner struct {
+	url          string
+	headers      map[string]string
+	client       *http.Client
+	maxFileBytes int64
+}
+
+// RemoteRunnerOption configures a RemoteRunner
+type RemoteRunnerOption func(*RemoteRunner)
+
+// WithRemoteMaxFileBytes caps the content returned for each produced file
+func WithRemoteMaxFileBytes(n int64) RemoteRunnerOption {
+	return func(r *RemoteRunner) {
+		if n > 0 {
+			r.maxFileBytes = n
+		}
+	}
+}
+
+// NewRemoteRunner creates a new remote runner for the given endpoint
+func NewRemoteRunner(url string, headers map[string]string, opts ...RemoteRunnerOption) *RemoteRunner {
+	r := &RemoteRunner{
+		url:          url,
+		headers:      headers,
+		client:       &http.Client{},
+		maxFileBytes: DefaultSubprocessRunnerConfig().MaxFileBytes,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run posts the request to the execution service
+func (r *RemoteRunner) Run(ctx context.Context, req CodeRequest) (*CodeResult, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal code request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range r.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("execution service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("execution service error: %s", string(respBody))
+	}
+
+	var result CodeResult
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode execution result: %w", err)
+	}
+	for i := range result.Files {
+		file := &result.Files[i]
+		if size := int64(len(file.Content)); size > r.maxFileBytes {
+			if file.Size < size {
+				file.Size = size
+			}
+			file.Content = file.Content[:r.maxFileBytes]
+			file.Truncated = true
+		}
+	}
+	return &result, nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package tools
+
+import (
+	"os/exec"
+	"time"
+)
+
+// limitKillReason classifies a failed run as a resource limit kill, returning
+// an empty string when the failure was the program's own
+func limitKillReason(exitErr *exec.ExitError, stderr string, cpuLimit time.Duration) string {
+	if exitErr != nil && isOutOfMemory(stderr) {
+		return KillReasonMemoryLimit
+	}
+	return ""
+}
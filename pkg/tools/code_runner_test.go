@@ -0,0 +1,132 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/tools"
+)
+
+// runPython runs the code with a runner built from config, skipping the
+// test when there is no python interpreter
+func runPython(t *testing.T, config tools.SubprocessRunnerConfig, code string) *tools.CodeResult {
+	t.Helper()
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not installed")
+	}
+	result, err := tools.NewSubprocessRunner(config).Run(context.Background(), tools.CodeRequest{
+		Language: tools.LanguagePython,
+		Code:     code,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return result
+}
+
+func TestSubprocessRunnerZeroConfigUsesDefaults(t *testing.T) {
+	result := runPython(t, tools.SubprocessRunnerConfig{}, `print("hello")`)
+	if result.Killed {
+		t.Fatalf("run killed (%s) under a zero config", result.KillReason)
+	}
+	if strings.TrimSpace(result.Stdout) != "hello" {
+		t.Errorf("stdout = %q, want hello", result.Stdout)
+	}
+}
+
+func TestSubprocessRunnerKillReasons(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no signals on windows")
+	}
+	tests := []struct {
+		signal string
+		want   string
+	}{
+		{"SIGXCPU", tools.KillReasonCPULimit},
+		{"SIGKILL", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signal, func(t *testing.T) {
+			result := runPython(t, tools.DefaultSubprocessRunnerConfig(),
+				"import os, signal\nos.kill(os.getpid(), signal."+tt.signal+")\n")
+			if result.KillReason != tt.want {
+				t.Errorf("kill reason = %q, want %q", result.KillReason, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubprocessRunnerCPULimitKillAfterIgnoredSIGXCPU(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no signals on windows")
+	}
+	config := tools.DefaultSubprocessRunnerConfig()
+	config.CPUSeconds = 1
+	result := runPython(t, config,
+		"import signal\nsignal.signal(signal.SIGXCPU, signal.SIG_IGN)\nwhile True:\n    pass\n")
+	if !result.Killed || result.KillReason != tools.KillReasonCPULimit {
+		t.Errorf("killed = %v (%q), want a CPU limit kill", result.Killed, result.KillReason)
+	}
+}
+
+func TestSubprocessRunnerGo(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not installed")
+	}
+	t.Setenv("MOEGO_SECRET", "hunter2")
+	config := tools.DefaultSubprocessRunnerConfig()
+	config.Timeout = 2 * time.Minute
+	result, err := tools.NewSubprocessRunner(config).Run(context.Background(), tools.CodeRequest{
+		Language: tools.LanguageGo,
+		Code: `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Print("secret=" + os.Getenv("MOEGO_SECRET"))
+}
+`,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.ExitCode != 0 || result.Stdout != "secret=" {
+		t.Errorf("run = %q (exit %d, stderr %q), want no secret", result.Stdout, result.ExitCode, result.Stderr)
+	}
+	if len(result.Files) != 0 {
+		t.Errorf("files = %+v, want the build to leave none", result.Files)
+	}
+}
+
+func TestRemoteRunnerCapsFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(tools.CodeResult{Files: []tools.CodeFile{
+			{Name: "small.txt", Content: "ok", Size: 2},
+			{Name: "big.txt", Content: strings.Repeat("x", 100)},
+		}})
+	}))
+	defer server.Close()
+
+	runner := tools.NewRemoteRunner(server.URL, nil, tools.WithRemoteMaxFileBytes(10))
+	result, err := runner.Run(context.Background(), tools.CodeRequest{Language: tools.LanguagePython, Code: "pass"})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	small, big := result.Files[0], result.Files[1]
+	if small.Content != "ok" || small.Truncated {
+		t.Errorf("small file = %+v, want it untouched", small)
+	}
+	if len(big.Content) != 10 || !big.Truncated || big.Size != 100 {
+		t.Errorf("big file = %d bytes of %d (truncated %v), want 10 of 100", len(big.Content), big.Size, big.Truncated)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package tools
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// limitKillReason classifies a failed run as a resource limit kill, returning
+// an empty string when the failure was the program's own
+func limitKillReason(exitErr *exec.ExitError, stderr string, cpuLimit time.Duration) string {
+	if exitErr == nil {
+		return ""
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		switch status.Signal() {
+		case syscall.SIGXCPU:
+			return KillReasonCPULimit
+		case syscall.SIGKILL:
+			// The hard CPU limit kills a program that ignores SIGXCPU. A
+			// SIGKILL can also come from elsewhere, such as the OOM killer,
+			// so it only counts once the program used up its CPU time.
+			used := exitErr.UserTime() + exitErr.SystemTime()
+			if cpuLimit > 0 && used >= cpuLimit {
+				return KillReasonCPULimit
+			}
+		}
+	}
+	if isOutOfMemory(stderr) {
+		return KillReasonMemoryLimit
+	}
+	return ""
+}
@@ -0,0 +1,387 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+const (
+	entityKeyPrefix   = "entity/"
+	relationKeyPrefix = "relation/"
+)
+
+// Entity is a named node in the entity memory graph
+type Entity struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Relation is a directed, labelled edge between two entities
+type Relation struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"`
+}
+
+// EntityGraph is an export of all entities and relations in a namespace
+type EntityGraph struct {
+	Entities  []Entity   `json:"entities"`
+	Relations []Relation `json:"relations"`
+}
+
+// EntityMemoryTool is a tool for storing structured memory of entities and
+// the relations between them. Data is kept in a core.Store under the
+// namespace attached to the context with core.WithNamespace.
+type EntityMemoryTool struct {
+	core.BaseTool
+	store core.Store
+}
+
+// NewEntityMemoryTool creates a new entity memory tool backed by the given store
+func NewEntityMemoryTool(store core.Store) *EntityMemoryTool {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"operation": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"upsert_entity", "add_relation", "get_entity", "query_relations"},
+				"description": "The memory operation to perform",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "The entity name (upsert_entity, get_entity, query_relations)",
+			},
+			"type": map[string]interface{}{
+				"type":        "string",
+				"description": "The entity type, e.g. person or project (upsert_entity)",
+			},
+			"attributes": map[string]interface{}{
+				"type":        "object",
+				"description": "Attributes to merge into the entity (upsert_entity)",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "The source entity name (add_relation)",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "The target entity name (add_relation)",
+			},
+			"relation": map[string]interface{}{
+				"type":        "string",
+				"description": "The relation label (add_relation), or a filter (query_relations)",
+			},
+		},
+		"required": []string{"operation"},
+	}
+
+	return &EntityMemoryTool{
+		BaseTool: *core.NewBaseTool(
+			"entity_memory",
+			"Stores and recalls structured memory about entities and the relations between them",
+			schema,
+		),
+		store: store,
+	}
+}
+
+// Execute runs the memory operation with the given arguments
+func (t *EntityMemoryTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	operation, ok := args["operation"].(string)
+	if !ok {
+		return nil, fmt.Errorf("operation must be a string")
+	}
+	namespace := core.NamespaceFromContext(ctx)
+
+	switch operation {
+	case "upsert_entity":
+		name, err := getString(args, "name", true)
+		if err != nil {
+			return nil, err
+		}
+		entityType, err := getString(args, "type", false)
+		if err != nil {
+			return nil, err
+		}
+		var attributes map[string]interface{}
+		if v, exists := args["attributes"]; exists && v != nil {
+			if attributes, ok = v.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("attributes must be an object")
+			}
+		}
+		return t.UpsertEntity(ctx, namespace, name, entityType, attributes)
+
+	case "add_relation":
+		from, err := getString(args, "from", true)
+		if err != nil {
+			return nil, err
+		}
+		to, err := getString(args, "to", true)
+		if err != nil {
+			return nil, err
+		}
+		relation, err := getString(args, "relation", true)
+		if err != nil {
+			return nil, err
+		}
+		return t.AddRelation(ctx, namespace, from, to, relation)
+
+	case "get_entity":
+		name, err := getString(args, "name", true)
+		if err != nil {
+			return nil, err
+		}
+		entity, found, err := t.GetEntity(ctx, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("entity not found: %s", name)
+		}
+		return entity, nil
+
+	case "query_relations":
+		name, err := getString(args, "name", true)
+		if err != nil {
+			return nil, err
+		}
+		relation, err := getString(args, "relation", false)
+		if err != nil {
+			return nil, err
+		}
+		return t.QueryRelations(ctx, namespace, name, relation)
+
+	default:
+		return nil, fmt.Errorf("unknown operation: %s", operation)
+	}
+}
+
+// UpsertEntity creates an entity or deep merges attributes into an existing one
+func (t *EntityMemoryTool) UpsertEntity(ctx context.Context, namespace, name, entityType string, attributes map[string]interface{}) (*Entity, error) {
+	entity, found, err := t.GetEntity(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		entity = &Entity{Name: name}
+	}
+	if entityType != "" {
+		entity.Type = entityType
+	}
+	if len(attributes) > 0 {
+		if entity.Attributes == nil {
+			entity.Attributes = make(map[string]interface{})
+		}
+		deepMerge(entity.Attributes, attributes)
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal entity: %w", err)
+	}
+	if err := t.store.Put(ctx, namespace, entityKey(name), data); err != nil {
+		return nil, fmt.Errorf("failed to store entity: %w", err)
+	}
+	return entity, nil
+}
+
+// AddRelation records a relation between two entities. Relations are
+// idempotent, adding the same relation twice stores it once.
+func (t *EntityMemoryTool) AddRelation(ctx context.Context, namespace, from, to, relation string) (*Relation, error) {
+	rel := &Relation{From: from, To: to, Relation: relation}
+	data, err := json.Marshal(rel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal relation: %w", err)
+	}
+	if err := t.store.Put(ctx, namespace, relationKey(rel), data); err != nil {
+		return nil, fmt.Errorf("failed to store relation: %w", err)
+	}
+	return rel, nil
+}
+
+// GetEntity returns the named entity and whether it exists
+func (t *EntityMemoryTool) GetEntity(ctx context.Context, namespace, name string) (*Entity, bool, error) {
+	data, found, err := t.store.Get(ctx, namespace, entityKey(name))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load entity: %w", err)
+	}
+	if !found {
+		return nil, false, nil
+	}
+	var entity Entity
+	if err := json.Unmarshal(data, &entity); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal entity: %w", err)
+	}
+	return &entity, true, nil
+}
+
+// RelationQueryResult contains the relations touching an entity and the
+// entities one hop away from it
+type RelationQueryResult struct {
+	Entity    string     `json:"entity"`
+	Relations []Relation `json:"relations"`
+	Neighbors []Entity   `json:"neighbors"`
+}
+
+// QueryRelations returns the relations in either direction that touch the
+// named entity, optionally filtered by relation label, along with the
+// neighboring entities they lead to
+func (t *EntityMemoryTool) QueryRelations(ctx context.Context, namespace, name, relation string) (*RelationQueryResult, error) {
+	relations, err := t.relations(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RelationQueryResult{
+		Entity:    name,
+		Relations: make([]Relation, 0),
+		Neighbors: make([]Entity, 0),
+	}
+	seen := make(map[string]struct{})
+	for _, rel := range relations {
+		if rel.From != name && rel.To != name {
+			continue
+		}
+		if relation != "" && rel.Relation != relation {
+			continue
+		}
+		result.Relations = append(result.Relations, rel)
+
+		neighbor := rel.To
+		if rel.To == name {
+			neighbor = rel.From
+		}
+		if _, ok := seen[neighbor]; ok {
+			continue
+		}
+		seen[neighbor] = struct{}{}
+
+		entity, found, err := t.GetEntity(ctx, namespace, neighbor)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			entity = &Entity{Name: neighbor}
+		}
+		result.Neighbors = append(result.Neighbors, *entity)
+	}
+	return result, nil
+}
+
+// Dump exports every entity and relation in the namespace as indented JSON
+// for debugging and inspection
+func (t *EntityMemoryTool) Dump(ctx context.Context, namespace string) ([]byte, error) {
+	graph := EntityGraph{
+		Entities:  make([]Entity, 0),
+		Relations: make([]Relation, 0),
+	}
+
+	keys, err := t.store.List(ctx, namespace, entityKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entities: %w", err)
+	}
+	for _, key := range keys {
+		data, found, err := t.store.Get(ctx, namespace, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load entity: %w", err)
+		}
+		if !found {
+			continue
+		}
+		var entity Entity
+		if err := json.Unmarshal(data, &entity); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal entity: %w", err)
+		}
+		graph.Entities = append(graph.Entities, entity)
+	}
+
+	graph.Relations, err = t.relations(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(graph, "", "  ")
+}
+
+// relations loads every relation in the namespace in key order
+func (t *EntityMemoryTool) relations(ctx context.Context, namespace string) ([]Relation, error) {
+	keys, err := t.store.List(ctx, namespace, relationKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relations: %w", err)
+	}
+
+	relations := make([]Relation, 0, len(keys))
+	for _, key := range keys {
+		data, found, err := t.store.Get(ctx, namespace, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load relation: %w", err)
+		}
+		if !found {
+			continue
+		}
+		var rel Relation
+		if err := json.Unmarshal(data, &rel); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal relation: %w", err)
+		}
+		relations = append(relations, rel)
+	}
+	return relations, nil
+}
+
+func entityKey(name string) string {
+	return entityKeyPrefix + url.PathEscape(name)
+}
+
+func relationKey(rel *Relation) string {
+	return relationKeyPrefix + strings.Join([]string{
+		url.PathEscape(rel.From),
+		url.PathEscape(rel.Relation),
+		url.PathEscape(rel.To),
+	}, "/")
+}
+
+// deepMerge merges src into dst. Nested objects are merged recursively and
+// any other value in src replaces the one in dst.
+func deepMerge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			deepMerge(dstMap, srcMap)
+			continue
+		}
+		if srcIsMap {
+			merged := make(map[string]interface{}, len(srcMap))
+			deepMerge(merged, srcMap)
+			dst[key] = merged
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// getString reads a string argument, returning an error if it is required
+// and missing or if it has the wrong type
+func getString(args map[string]interface{}, key string, required bool) (string, error) {
+	v, exists := args[key]
+	if !exists || v == nil {
+		if required {
+			return "", fmt.Errorf("%s is required", key)
+		}
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	if required && s == "" {
+		return "", fmt.Errorf("%s is required", key)
+	}
+	return s, nil
+}
@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+// RemoteGraphTool is a tool that invokes a graph served by another process
+// with server.GraphHandler, so graphs can be composed across services
+type RemoteGraphTool struct {
+	core.BaseTool
+	endpoint string
+	client   *http.Client
+	headers  map[string]string
+	timeout  time.Duration
+}
+
+// RemoteGraphOption configures a remote graph tool
+type RemoteGraphOption func(*RemoteGraphTool)
+
+// WithToolName sets the name and description the model sees
+func WithToolName(name, description string) RemoteGraphOption {
+	return func(t *RemoteGraphTool) {
+		t.BaseTool = *core.NewBaseTool(name, description, t.JSONSchema())
+	}
+}
+
+// WithRemoteTimeout bounds each call to the remote graph. The deadline is
+// sent along so the remote run stops as well.
+func WithRemoteTimeout(timeout time.Duration) RemoteGraphOption {
+	return func(t *RemoteGraphTool) {
+		t.timeout = timeout
+	}
+}
+
+// WithRemoteHeader sets a header sent with every request, such as an
+// authorization header
+func WithRemoteHeader(key, value string) RemoteGraphOption {
+	return func(t *RemoteGraphTool) {
+		t.headers[key] = value
+	}
+}
+
+// WithRemoteHTTPClient sets the HTTP client used to call the remote graph
+func WithRemoteHTTPClient(client *http.Client) RemoteGraphOption {
+	return func(t *RemoteGraphTool) {
+		t.client = client
+	}
+}
+
+// NewRemoteGraphTool creates a tool that posts its state argument to the
+// graph handler at endpoint and returns the final state
+func NewRemoteGraphTool(endpoint string, opts ...RemoteGraphOption) *RemoteGraphTool {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"state": map[string]interface{}{
+				"type":        "object",
+				"description": "The input state of the remote graph",
+			},
+		},
+		"required": []string{"state"},
+	}
+
+	t := &RemoteGraphTool{
+		BaseTool: *core.NewBaseTool("remote_graph", "Runs a remote graph with the given input state and returns its final state", schema),
+		endpoint: endpoint,
+		client:   &http.Client{},
+		headers:  make(map[string]string),
+		timeout:  60 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Execute invokes the remote graph. Errors reported by the remote graph keep
+// their registered sentinel, so errors.Is works across the process boundary.
+func (t *RemoteGraphTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	state, ok := args["state"]
+	if !ok {
+		return nil, fmt.Errorf("state is required")
+	}
+	body, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(wire.DeadlineHeader, deadline.Format(time.RFC3339Nano))
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("remote graph request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var remote struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if err := json.Unmarshal(respBody, &remote); err != nil || remote.Error == "" {
+			return nil, fmt.Errorf("remote graph error: %s: %s", resp.Status, string(respBody))
+		}
+		return nil, fmt.Errorf("remote graph error: %w", wire.ErrorFromCode(remote.Code, remote.Error))
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode remote graph output: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// defaultRetrieverLimit is the number of documents retrieved when the model
+// doesn't ask for a number
+const defaultRetrieverLimit = 4
+
+// Retriever finds the documents relevant to a query
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, limit int) ([]core.Document, error)
+}
+
+// RetrieverTool lets a model search a retriever and cite what it finds.
+// Documents are numbered in the order they are first retrieved and keep
+// their number when retrieved again, so the markers in the model's answer
+// resolve with core.ExtractCitations(answer, tool.Documents()). Documents
+// without an ID get one from core.DocumentID.
+type RetrieverTool struct {
+	core.BaseTool
+	retriever Retriever
+
+	mu    sync.Mutex
+	docs  []core.Document
+	index map[string]int
+}
+
+// NewRetrieverTool creates a retrieval tool with the given name and
+// description of what it searches
+func NewRetrieverTool(name, description string, retriever Retriever) *RetrieverTool {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "What to search for",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("The maximum number of documents to return, %d by default", defaultRetrieverLimit),
+			},
+		},
+		"required": []string{"query"},
+	}
+
+	return &RetrieverTool{
+		BaseTool: *core.NewBaseTool(
+			name,
+			description+". Results are numbered; cite them in your answer by number, like [1].",
+			schema,
+		),
+		retriever: retriever,
+		index:     make(map[string]int),
+	}
+}
+
+// Execute retrieves documents for the query and returns them numbered
+func (t *RetrieverTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	query, ok := args["query"].(string)
+	if !ok || query == "" {
+		return nil, fmt.Errorf("query must be a non-empty string")
+	}
+	limit := defaultRetrieverLimit
+	if raw, ok := args["limit"].(float64); ok && raw >= 1 {
+		limit = int(raw)
+	}
+
+	docs, err := t.retriever.Retrieve(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("retrieval failed: %w", err)
+	}
+	if len(docs) == 0 {
+		return "No documents found.", nil
+	}
+
+	var b strings.Builder
+	for _, doc := range docs {
+		marker := t.add(doc)
+		fmt.Fprintf(&b, "[%d]", marker)
+		if doc.Source != "" {
+			fmt.Fprintf(&b, " (%s)", doc.Source)
+		}
+		fmt.Fprintf(&b, "\n%s\n\n", strings.TrimSpace(doc.Content))
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// add numbers a document, returning the number it already has if it was
+// retrieved before
+func (t *RetrieverTool) add(doc core.Document) int {
+	if doc.ID == "" {
+		doc.ID = core.DocumentID(doc.Source, doc.Content)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i, ok := t.index[doc.ID]; ok {
+		return i + 1
+	}
+	t.index[doc.ID] = len(t.docs)
+	t.docs = append(t.docs, doc)
+	return len(t.docs)
+}
+
+// Documents returns the documents retrieved so far, in citation order
+func (t *RetrieverTool) Documents() []core.Document {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]core.Document(nil), t.docs...)
+}
+
+// Reset forgets the documents retrieved so far, restarting the numbering
+func (t *RetrieverTool) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.docs = nil
+	t.index = make(map[string]int)
+}
@@ -0,0 +1,85 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// errorCodes maps stable error codes to the sentinel errors they stand for,
+// so errors keep their identity when they cross the wire
+var (
+	errorCodesMu sync.RWMutex
+	errorCodes   = map[string]error{}
+	codeOrder    []string
+)
+
+func init() {
+	RegisterErrorCode("run_timeout", core.ErrRunTimeout)
+	RegisterErrorCode("state_too_large", core.ErrStateTooLarge)
+	RegisterErrorCode("too_many_messages", core.ErrTooManyMessages)
+	RegisterErrorCode("invalid_input", core.ErrInvalidInput)
+	RegisterErrorCode("invalid_output", core.ErrInvalidOutput)
+	RegisterErrorCode("circuit_open", core.ErrCircuitOpen)
+	RegisterErrorCode("node_not_found", core.ErrNodeNotFound)
+	RegisterErrorCode("deadline_exceeded", context.DeadlineExceeded)
+	RegisterErrorCode("codec_mismatch", core.ErrCodecMismatch)
+	RegisterErrorCode("corrupt_value", core.ErrCorruptValue)
+	RegisterErrorCode("undeclared_write", core.ErrUndeclaredWrite)
+	RegisterErrorCode("blob_not_found", core.ErrBlobNotFound)
+	RegisterErrorCode("invalid_feedback", core.ErrInvalidFeedback)
+}
+
+// RegisterErrorCode registers a stable code for a sentinel error. Packages
+// register their own sentinels so both servers and clients know them.
+func RegisterErrorCode(code string, err error) {
+	errorCodesMu.Lock()
+	defer errorCodesMu.Unlock()
+	if _, exists := errorCodes[code]; !exists {
+		codeOrder = append(codeOrder, code)
+	}
+	errorCodes[code] = err
+}
+
+// ErrorCode returns the code of the first registered sentinel that err
+// matches, or an empty string
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	errorCodesMu.RLock()
+	defer errorCodesMu.RUnlock()
+	for _, code := range codeOrder {
+		if errors.Is(err, errorCodes[code]) {
+			return code
+		}
+	}
+	return ""
+}
+
+// RemoteError is an error received over the wire. It matches the sentinel
+// registered for its code with errors.Is.
+type RemoteError struct {
+	// Code is the registered error code, if any
+	Code string `json:"code,omitempty"`
+
+	// Message is the error message
+	Message string `json:"message"`
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+func (e *RemoteError) Unwrap() error {
+	errorCodesMu.RLock()
+	defer errorCodesMu.RUnlock()
+	return errorCodes[e.Code]
+}
+
+// ErrorFromCode rebuilds an error received over the wire
+func ErrorFromCode(code, message string) error {
+	return &RemoteError{Code: code, Message: message}
+}
@@ -0,0 +1,238 @@
+// Package wire defines the versioned JSON format used for every frame sent
+// to clients of a running graph, whatever the transport
+package wire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// Version is the version of the wire format. It must be bumped whenever the
+// JSON encoding of a frame or any payload changes incompatibly.
+const Version = 1
+
+// DeadlineHeader carries the caller's deadline, in RFC 3339 format, on HTTP
+// requests that invoke a graph, so the graph stops when the caller gives up
+const DeadlineHeader = "Moego-Deadline"
+
+var (
+	// ErrUnsupportedVersion is returned when decoding a frame of a newer version
+	ErrUnsupportedVersion = errors.New("unsupported wire version")
+
+	// ErrWrongKind is returned when a payload is decoded as the wrong type
+	ErrWrongKind = errors.New("wrong frame kind")
+)
+
+// Kind identifies the payload of a frame
+type Kind string
+
+const (
+	// KindEvent frames carry a core.Event
+	KindEvent Kind = "event"
+
+	// KindValues frames carry the full state after a step
+	KindValues Kind = "values"
+
+	// KindUpdates frames carry the state update of a step
+	KindUpdates Kind = "updates"
+
+	// KindCustom frames carry custom data emitted by nodes
+	KindCustom Kind = "custom"
+
+	// KindMessages frames carry LLM messages or core.MessageChunk values
+	KindMessages Kind = "messages"
+
+	// KindHeartbeat frames carry a core.Heartbeat
+	KindHeartbeat Kind = "heartbeat"
+
+	// KindStatus frames carry a status change of a run served by a run manager
+	KindStatus Kind = "status"
+
+	// KindInterrupt frames carry a core.InterruptInfo. The run is paused
+	// until it is resumed.
+	KindInterrupt Kind = "interrupt"
+
+	// KindError frames carry an ErrorPayload and end the run
+	KindError Kind = "error"
+
+	// KindEnd frames have no payload and end the run
+	KindEnd Kind = "end"
+)
+
+// Frame is the envelope of everything sent to clients
+type Frame struct {
+	// V is the wire format version
+	V int `json:"v"`
+
+	// Seq numbers the frames of a run from 1, so clients can detect gaps
+	Seq uint64 `json:"seq"`
+
+	// RunID identifies the run the frame belongs to
+	RunID string `json:"run_id"`
+
+	// Kind identifies the payload
+	Kind Kind `json:"kind"`
+
+	// Payload is the JSON encoded payload
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// Metadata describes where the payload came from, such as the source of
+	// values frames carrying a state edited while the run was paused
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ErrorPayload is the payload of an error frame
+type ErrorPayload struct {
+	// Message describes the error
+	Message string `json:"message"`
+
+	// Code is the registered code of the error, if any
+	Code string `json:"code,omitempty"`
+}
+
+// Err returns the error the payload describes
+func (p ErrorPayload) Err() error {
+	return ErrorFromCode(p.Code, p.Message)
+}
+
+// Encoder turns the events and stream events of a run into numbered frames.
+// It is safe for concurrent use.
+type Encoder struct {
+	runID string
+	seq   atomic.Uint64
+}
+
+// NewEncoder creates an encoder for the run
+func NewEncoder(runID string) *Encoder {
+	return &Encoder{runID: runID}
+}
+
+// NewEncoderAfter creates an encoder whose first frame follows lastSeq, for
+// continuing a stream after a client reconnects
+func NewEncoderAfter(runID string, lastSeq uint64) *Encoder {
+	e := &Encoder{runID: runID}
+	e.seq.Store(lastSeq)
+	return e
+}
+
+// Frame creates the next frame with the given payload
+func (e *Encoder) Frame(kind Kind, payload interface{}) (Frame, error) {
+	frame := Frame{
+		V:     Version,
+		Seq:   e.seq.Add(1),
+		RunID: e.runID,
+		Kind:  kind,
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return Frame{}, fmt.Errorf("failed to marshal %s payload: %w", kind, err)
+		}
+		frame.Payload = data
+	}
+	return frame, nil
+}
+
+// Event creates a frame for a graph event
+func (e *Encoder) Event(evt core.Event) (Frame, error) {
+	return e.Frame(KindEvent, evt)
+}
+
+// Stream creates a frame for a stream event, keeping its metadata. Debug
+// stream events carrying a core.Event become event frames.
+func (e *Encoder) Stream(evt core.StreamEvent) (Frame, error) {
+	if graphEvent, ok := evt.Data.(core.Event); ok {
+		return e.Event(graphEvent)
+	}
+	frame, err := e.Frame(Kind(evt.Mode), evt.Data)
+	if err != nil {
+		return Frame{}, err
+	}
+	frame.Metadata = evt.Metadata
+	return frame, nil
+}
+
+// Error creates a frame reporting that the run failed
+func (e *Encoder) Error(err error) (Frame, error) {
+	return e.Frame(KindError, ErrorPayload{Message: err.Error(), Code: ErrorCode(err)})
+}
+
+// End creates a frame reporting that the run completed
+func (e *Encoder) End() (Frame, error) {
+	return e.Frame(KindEnd, nil)
+}
+
+// Marshal encodes a frame as JSON
+func Marshal(f Frame) ([]byte, error) {
+	return json.Marshal(f)
+}
+
+// Unmarshal decodes a JSON frame, rejecting frames of a newer version
+func Unmarshal(data []byte) (Frame, error) {
+	var f Frame
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Frame{}, err
+	}
+	if f.V > Version {
+		return Frame{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, f.V)
+	}
+	return f, nil
+}
+
+// DecodePayload decodes the payload of a frame into P
+func DecodePayload[P any](f Frame) (P, error) {
+	var payload P
+	if len(f.Payload) == 0 {
+		return payload, nil
+	}
+	err := json.Unmarshal(f.Payload, &payload)
+	return payload, err
+}
+
+// Event decodes the payload of an event frame
+func (f Frame) Event() (core.Event, error) {
+	if f.Kind != KindEvent {
+		return core.Event{}, fmt.Errorf("%w: %s is not %s", ErrWrongKind, f.Kind, KindEvent)
+	}
+	return DecodePayload[core.Event](f)
+}
+
+// Heartbeat decodes the payload of a heartbeat frame
+func (f Frame) Heartbeat() (core.Heartbeat, error) {
+	if f.Kind != KindHeartbeat {
+		return core.Heartbeat{}, fmt.Errorf("%w: %s is not %s", ErrWrongKind, f.Kind, KindHeartbeat)
+	}
+	return DecodePayload[core.Heartbeat](f)
+}
+
+// Interrupt decodes the payload of an interrupt frame
+func (f Frame) Interrupt() (core.InterruptInfo, error) {
+	if f.Kind != KindInterrupt {
+		return core.InterruptInfo{}, fmt.Errorf("%w: %s is not %s", ErrWrongKind, f.Kind, KindInterrupt)
+	}
+	return DecodePayload[core.InterruptInfo](f)
+}
+
+// Error decodes the payload of an error frame
+func (f Frame) Error() (ErrorPayload, error) {
+	if f.Kind != KindError {
+		return ErrorPayload{}, fmt.Errorf("%w: %s is not %s", ErrWrongKind, f.Kind, KindError)
+	}
+	return DecodePayload[ErrorPayload](f)
+}
+
+// WriteSSE writes a frame as a server-sent event, using the sequence number
+// as the event ID and the kind as the event name
+func WriteSSE(w io.Writer, f Frame) error {
+	data, err := Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", f.Seq, f.Kind, data)
+	return err
+}
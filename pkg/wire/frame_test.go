@@ -0,0 +1,137 @@
+package wire_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+	"github.com/forrestdevs/moego/pkg/wire"
+)
+
+// goldenPath is the recorded form of the current wire version. Changing the
+// format means bumping wire.Version and recording a new file, so clients
+// built against the old one keep a file to compare with.
+func goldenPath(name string) string {
+	return fmt.Sprintf("testdata/%s_v%d.json", name, wire.Version)
+}
+
+func TestSchemaMatchesVersion(t *testing.T) {
+	got, err := wire.JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema: %v", err)
+	}
+	want, err := os.ReadFile(goldenPath("schema"))
+	if err != nil {
+		t.Fatalf("no schema recorded for wire version %d: %v", wire.Version, err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(got), bytes.TrimSpace(want)) {
+		t.Errorf("the wire schema changed without bumping wire.Version; bump it and record %s:\n%s", goldenPath("schema"), got)
+	}
+}
+
+// sampleFrames encodes one frame of every kind with fixed contents
+func sampleFrames(t *testing.T) []wire.Frame {
+	t.Helper()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	encoder := wire.NewEncoder("run-1")
+	var frames []wire.Frame
+	add := func(frame wire.Frame, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("encoding frame %d: %v", len(frames)+1, err)
+		}
+		frames = append(frames, frame)
+	}
+
+	add(encoder.Stream(core.StreamEvent{Mode: core.StreamDebug, Data: core.Event{
+		Type: core.EventChainStart, Name: "triage", RunID: "run-1", Timestamp: at,
+		Metadata: map[string]interface{}{"langgraph_step": 1},
+	}}))
+	add(encoder.Stream(core.StreamEvent{Mode: core.StreamValues, Data: map[string]interface{}{"count": 1}, Metadata: map[string]interface{}{"source": "edit"}}))
+	add(encoder.Stream(core.StreamEvent{Mode: core.StreamUpdates, Data: map[string]interface{}{"count": 2}}))
+	add(encoder.Stream(core.StreamEvent{Mode: core.StreamMessages, Data: core.MessageChunk{Type: core.ChunkContent, Name: "writer", Content: "Hel"}}))
+	add(encoder.Frame(wire.KindHeartbeat, core.Heartbeat{Node: "triage", Elapsed: time.Second}))
+	add(encoder.Frame(wire.KindInterrupt, core.InterruptInfo{NodeName: "review"}))
+	add(encoder.Error(fmt.Errorf("too slow: %w", core.ErrRunTimeout)))
+	add(encoder.End())
+	return frames
+}
+
+func TestFramesMatchVersion(t *testing.T) {
+	var got bytes.Buffer
+	for _, frame := range sampleFrames(t) {
+		data, err := wire.Marshal(frame)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		got.Write(data)
+		got.WriteByte('\n')
+	}
+	want, err := os.ReadFile(goldenPath("frames"))
+	if err != nil {
+		t.Fatalf("no frames recorded for wire version %d: %v", wire.Version, err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("encoded frames changed without bumping wire.Version; bump it and record %s:\n%s", goldenPath("frames"), got.String())
+	}
+}
+
+func TestFramesDecodeTyped(t *testing.T) {
+	frames := sampleFrames(t)
+	decoded := make([]wire.Frame, len(frames))
+	for i, frame := range frames {
+		data, err := wire.Marshal(frame)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if decoded[i], err = wire.Unmarshal(data); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if decoded[i].Seq != uint64(i+1) || decoded[i].RunID != "run-1" {
+			t.Errorf("frame %d has seq %d of run %s", i+1, decoded[i].Seq, decoded[i].RunID)
+		}
+	}
+
+	evt, err := decoded[0].Event()
+	if err != nil || evt.Name != "triage" || evt.Type != core.EventChainStart {
+		t.Errorf("Event() = %+v, %v", evt, err)
+	}
+	if decoded[1].Metadata["source"] != "edit" {
+		t.Errorf("values metadata = %v, want the stream event's", decoded[1].Metadata)
+	}
+	chunk, err := wire.DecodePayload[core.MessageChunk](decoded[3])
+	if err != nil || chunk.Content != "Hel" {
+		t.Errorf("message chunk = %+v, %v", chunk, err)
+	}
+	beat, err := decoded[4].Heartbeat()
+	if err != nil || beat.Elapsed != time.Second {
+		t.Errorf("Heartbeat() = %+v, %v", beat, err)
+	}
+	info, err := decoded[5].Interrupt()
+	if err != nil || info.NodeName != "review" {
+		t.Errorf("Interrupt() = %+v, %v", info, err)
+	}
+	payload, err := decoded[6].Error()
+	if err != nil || !errors.Is(payload.Err(), core.ErrRunTimeout) {
+		t.Errorf("Error() = %+v, %v, want ErrRunTimeout", payload, err)
+	}
+	if _, err := decoded[7].Event(); !errors.Is(err, wire.ErrWrongKind) {
+		t.Errorf("Event() of an end frame = %v, want ErrWrongKind", err)
+	}
+}
+
+func TestUnmarshalRejectsNewerVersion(t *testing.T) {
+	frame := func(v int) []byte {
+		return []byte(fmt.Sprintf(`{"v":%d,"seq":1,"run_id":"run-1","kind":"end"}`, v))
+	}
+	if _, err := wire.Unmarshal(frame(wire.Version + 1)); !errors.Is(err, wire.ErrUnsupportedVersion) {
+		t.Errorf("Unmarshal of a newer frame = %v, want ErrUnsupportedVersion", err)
+	}
+	if _, err := wire.Unmarshal(frame(wire.Version)); err != nil {
+		t.Errorf("Unmarshal of a current frame: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package wire
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forrestdevs/moego/pkg/core"
+)
+
+// payloadTypes are the Go types of the structured payloads, by kind
+var payloadTypes = map[string]reflect.Type{
+	"Frame":        reflect.TypeOf(Frame{}),
+	"Event":        reflect.TypeOf(core.Event{}),
+	"Heartbeat":    reflect.TypeOf(core.Heartbeat{}),
+	"MessageChunk": reflect.TypeOf(core.MessageChunk{}),
+	"DraftDiff":    reflect.TypeOf(core.DraftDiff{}),
+	"ErrorPayload": reflect.TypeOf(ErrorPayload{}),
+	"Interrupt":    reflect.TypeOf(core.InterruptInfo{}),
+}
+
+// JSONSchema returns a JSON Schema document describing frames and their
+// structured payloads, generated from the Go types, for client code generation
+func JSONSchema() ([]byte, error) {
+	defs := make(map[string]interface{}, len(payloadTypes))
+	for name, t := range payloadTypes {
+		defs[name] = schemaFor(t)
+	}
+
+	kinds := []string{
+		string(KindEvent), string(KindValues), string(KindUpdates), string(KindCustom),
+		string(KindMessages), string(KindHeartbeat), string(KindStatus), string(KindInterrupt), string(KindError), string(KindEnd),
+	}
+	frame := defs["Frame"].(map[string]interface{})
+	frame["properties"].(map[string]interface{})["kind"] = map[string]interface{}{
+		"type": "string",
+		"enum": kinds,
+	}
+	frame["properties"].(map[string]interface{})["v"] = map[string]interface{}{
+		"type":  "integer",
+		"const": Version,
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     "https://github.com/forrestdevs/moego/wire/v" + strconv.Itoa(Version),
+		"title":   "moego wire frame",
+		"$ref":    "#/$defs/Frame",
+		"$defs":   defs,
+	}, "", "  ")
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	rawType      = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// schemaFor returns the JSON Schema of a Go type as encoding/json encodes it
+func schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "description": "nanoseconds"}
+	case rawType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaFor(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		return map[string]interface{}{}
+	}
+}